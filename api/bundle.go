@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+
+	"timeship/internal/bundle"
+	"timeship/internal/config"
+	"timeship/internal/tags"
+	"timeship/internal/tokens"
+
+	"github.com/joho/godotenv"
+)
+
+// openStores opens the token and tag databases of a config, nil if they
+// aren't configured
+func openStores(cfg *config.Config) (*tokens.Store, *tags.Store, func()) {
+	var tokenStore *tokens.Store
+	var tagStore *tags.Store
+	closeStores := func() {
+		if tokenStore != nil {
+			tokenStore.Close()
+		}
+		if tagStore != nil {
+			tagStore.Close()
+		}
+	}
+	var err error
+	if cfg.Tokens != "" {
+		if tokenStore, err = tokens.Open(cfg.Tokens); err != nil {
+			log.Fatalf("Failed to open token database: %v", err)
+		}
+	}
+	if cfg.Tags != "" {
+		if tagStore, err = tags.Open(cfg.Tags); err != nil {
+			closeStores()
+			log.Fatalf("Failed to open tag database: %v", err)
+		}
+	}
+	return tokenStore, tagStore, closeStores
+}
+
+// runExport implements the "export" command, which writes the config,
+// tokens, tags and bookmarks to a bundle
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to YAML config file")
+	outputFlag := flags.String("o", "", "file to write the bundle to instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Exports the effective config with its secrets and the issued tokens, tags\n")
+		fmt.Fprintf(flags.Output(), "and bookmarks to a JSON bundle, to import on another instance.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	godotenv.Load()
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	data, err := cfg.Export()
+	if err != nil {
+		log.Fatalf("Failed to export config: %v", err)
+	}
+	tokenStore, tagStore, closeStores := openStores(cfg)
+	defer closeStores()
+	b, err := bundle.Export(data, tokenStore, tagStore)
+	if err != nil {
+		log.Fatalf("Failed to export: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *outputFlag != "" {
+		// Bundles hold secrets, so only the owner may read them
+		f, err := os.OpenFile(*outputFlag, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			log.Fatalf("Failed to create bundle: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := b.Write(w); err != nil {
+		log.Fatalf("Failed to write bundle: %v", err)
+	}
+	log.Printf("Exported config, %d tokens, %d tags and %d bookmarks", len(b.Tokens), len(b.Tags), len(b.Bookmarks))
+}
+
+// runImport implements the "import" command, which writes the config of a
+// bundle and adds its tokens, tags and bookmarks to the databases
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to write the config of the bundle to")
+	forceFlag := flags.Bool("force", false, "replace an existing config file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import [flags] <bundle>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Imports a bundle created by export: writes its config unless the config\n")
+		fmt.Fprintf(flags.Output(), "file exists, then adds its tokens, tags and bookmarks to the databases of\n")
+		fmt.Fprintf(flags.Output(), "the config. Run it before starting the server. Use - to read stdin.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || *configFlag == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			log.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	b, err := bundle.Read(r)
+	if err != nil {
+		log.Fatalf("Failed to read bundle: %v", err)
+	}
+
+	if b.Config != "" {
+		if _, err := config.Parse([]byte(b.Config)); err != nil {
+			log.Fatalf("Invalid config in bundle: %v", err)
+		}
+		_, err := os.Stat(*configFlag)
+		switch {
+		case err == nil && !*forceFlag:
+			log.Printf("Keeping existing config %s, use -force to replace it", *configFlag)
+		case err == nil || errors.Is(err, fs.ErrNotExist):
+			if err := os.WriteFile(*configFlag, []byte(b.Config), 0600); err != nil {
+				log.Fatalf("Failed to write config: %v", err)
+			}
+			log.Printf("Wrote config %s", *configFlag)
+		default:
+			log.Fatalf("Failed to check config: %v", err)
+		}
+	}
+
+	godotenv.Load()
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	tokenStore, tagStore, closeStores := openStores(cfg)
+	defer closeStores()
+	counts, err := b.Import(tokenStore, tagStore)
+	if err != nil {
+		log.Fatalf("Failed to import: %v", err)
+	}
+	log.Printf("Imported %d tokens, %d tags and %d bookmarks", counts.Tokens, counts.Tags, counts.Bookmarks)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/pinned"
+	"timeship/internal/storage/registry"
+
+	"github.com/joho/godotenv"
+)
+
+// The offline commands use the storages of the config directly, without
+// starting the server. Locations are given as storage://path, or as a path
+// of the default storage.
+
+// openConfigured loads the config and opens its storages for an offline
+// command
+func openConfigured(configPath string) (*config.Config, map[string]storage.Storage) {
+	godotenv.Load()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	storages, err := openStorages(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create storages: %v", err)
+	}
+	return cfg, storages
+}
+
+// locate returns the storage of a location like "local://photos" and the
+// path of the location in it, selecting the snapshot if not empty
+func locate(cfg *config.Config, storages map[string]storage.Storage, location, snapshot string) (storage.Storage, url.URL) {
+	name, p, ok := strings.Cut(location, "://")
+	if !ok {
+		name, p = cfg.DefaultStorage(), location
+	}
+	store, ok := storages[name]
+	if !ok {
+		log.Fatalf("Storage not found: %s", name)
+	}
+	nodePath := url.URL{Scheme: name, Path: strings.Trim(p, "/")}
+	if snapshot != "" {
+		nodePath.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	return store, nodePath
+}
+
+// locationFlags creates the flags shared by the commands reading locations
+func locationFlags(name, args, description string) (*flag.FlagSet, *string, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to YAML config file")
+	snapshotFlag := flags.String("snapshot", "", "snapshot ID to read from instead of the current state, e.g. zfs:daily-2025-11-09")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] %s\n\n", os.Args[0], name, args)
+		fmt.Fprintf(flags.Output(), "%s\n\n", description)
+		flags.PrintDefaults()
+	}
+	return flags, configFlag, snapshotFlag
+}
+
+// runCheck implements the "check" command, which validates the config,
+// checks that all storages are reachable and find their snapshots, and
+// prints the effective config
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to YAML config file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s check [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Validates the config, checks that all storages are reachable and find\n")
+		fmt.Fprintf(flags.Output(), "their snapshots, and prints the effective config with secrets redacted.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// Loading validates the config, including custom snapshot patterns
+	godotenv.Load()
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	storages := map[string]storage.Storage{}
+	defer closeStorages(storages)
+	failed := false
+	for _, sc := range cfg.Storages {
+		store, err := registry.Open(sc)
+		if err != nil {
+			fmt.Printf("%s: %v\n", sc.Name, err)
+			failed = true
+			continue
+		}
+		storages[sc.Name] = store
+		if err := checkStorage(sc.Name, store); err != nil {
+			failed = true
+		}
+	}
+	for _, pc := range cfg.Pins {
+		name := pc.Name
+		if name == "" {
+			name = pinned.DefaultName(pc.Storage, pc.Snapshot)
+		}
+		base, ok := storages[pc.Storage]
+		if !ok {
+			fmt.Printf("%s: storage %s failed to open\n", name, pc.Storage)
+			failed = true
+			continue
+		}
+		if _, err := pinned.New(name, base, pc.Storage, pc.Snapshot); err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok, pinned to %s\n", name, pc.Snapshot)
+	}
+
+	dump, err := cfg.Dump()
+	if err != nil {
+		log.Fatalf("Failed to dump config: %v", err)
+	}
+	fmt.Printf("\n# Effective config\n%s", dump)
+
+	if failed {
+		closeStorages(storages)
+		os.Exit(1)
+	}
+}
+
+// checkStorage prints whether a storage is reachable and which snapshots it
+// finds by type, returning the first failure
+func checkStorage(name string, store storage.Storage) error {
+	if checker, ok := store.(storage.HealthChecker); ok {
+		if err := checker.CheckHealth(); err != nil {
+			fmt.Printf("%s: unreachable: %v\n", name, err)
+			return err
+		}
+	}
+	lister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		fmt.Printf("%s: ok, no snapshot support\n", name)
+		return nil
+	}
+	snapshots, err := lister.ListSnapshots(url.URL{Scheme: name})
+	if err != nil {
+		fmt.Printf("%s: listing snapshots failed: %v\n", name, err)
+		return err
+	}
+	types := map[string]int{}
+	for _, snap := range snapshots {
+		types[snap.Type]++
+	}
+	counts := make([]string, 0, len(types))
+	for _, t := range slices.Sorted(maps.Keys(types)) {
+		counts = append(counts, fmt.Sprintf("%d %s", types[t], t))
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "none found")
+	}
+	fmt.Printf("%s: ok, snapshots: %s\n", name, strings.Join(counts, ", "))
+	return nil
+}
+
+// runLs implements the "ls" command, which lists a directory
+func runLs(args []string) {
+	flags, configFlag, snapshotFlag := locationFlags("ls", "[location]", "Lists a directory, the root of the default storage by default.")
+	long := flags.Bool("l", false, "show the type, size and modification time")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, storages := openConfigured(*configFlag)
+	defer closeStorages(storages)
+	store, dir := locate(cfg, storages, flags.Arg(0), *snapshotFlag)
+
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		log.Fatalf("Storage %s does not support listing", dir.Scheme)
+	}
+	nodes, err := lister.ListContents(dir)
+	if err != nil {
+		log.Fatalf("Failed to list %s: %v", flags.Arg(0), err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, node := range nodes {
+		name := node.Basename
+		if node.Type == "dir" {
+			name += "/"
+		}
+		if *long {
+			modified := time.Unix(node.LastModified, 0).Format("2006-01-02 15:04")
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", node.Type, node.Size, modified, name)
+		} else {
+			fmt.Fprintln(w, name)
+		}
+	}
+	w.Flush()
+}
+
+// runCat implements the "cat" command, which prints files
+func runCat(args []string) {
+	flags, configFlag, snapshotFlag := locationFlags("cat", "<location>...", "Prints the contents of files.")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, storages := openConfigured(*configFlag)
+	defer closeStorages(storages)
+	for _, location := range flags.Args() {
+		store, file := locate(cfg, storages, location, *snapshotFlag)
+		reader, ok := store.(storage.Reader)
+		if !ok {
+			log.Fatalf("Storage %s does not support reading", file.Scheme)
+		}
+		if err := copyFile(reader, file); err != nil {
+			log.Fatalf("Failed to read %s: %v", location, err)
+		}
+	}
+}
+
+// copyFile writes the content of a file to stdout
+func copyFile(reader storage.Reader, file url.URL) error {
+	stream, err := reader.ReadStream(file)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_, err = io.Copy(os.Stdout, stream)
+	return err
+}
+
+// runSnapshots implements the "snapshots" command, which lists the snapshots
+// of a file or directory
+func runSnapshots(args []string) {
+	flags := flag.NewFlagSet("snapshots", flag.ExitOnError)
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to YAML config file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s snapshots [flags] [location]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Lists the snapshots of a file or directory, oldest first.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, storages := openConfigured(*configFlag)
+	defer closeStorages(storages)
+	store, nodePath := locate(cfg, storages, flags.Arg(0), "")
+
+	lister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		log.Fatalf("Storage %s does not support snapshots", nodePath.Scheme)
+	}
+	snapshots, err := lister.ListSnapshots(nodePath)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots of %s: %v", flags.Arg(0), err)
+	}
+	slices.SortStableFunc(snapshots, func(a, b storage.Snapshot) int {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, snap := range snapshots {
+		created := time.Unix(snap.Timestamp, 0).Format("2006-01-02 15:04")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", snap.ID, created, snap.Name)
+	}
+	w.Flush()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// daemonEnv is set for the process started in the background by -daemon, so
+// it runs the server instead of starting another one
+const daemonEnv = "TIMESHIP_DAEMONIZED"
+
+// daemonReadyTimeout is how long -daemon waits for the process started in the
+// background to be ready
+const daemonReadyTimeout = 2 * time.Minute
+
+// daemonReadyMessage is written by the process started in the background to
+// the pipe it inherited once it's ready
+const daemonReadyMessage = "ready\n"
+
+// errAlreadyRunning is returned for PID files of processes still running
+var errAlreadyRunning = errors.New("already running")
+
+// openLog opens a log file for appending, creating it if needed
+func openLog(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// readPID returns the process ID in a PID file, zero if it has none
+func readPID(f *os.File) int {
+	data := make([]byte, 32)
+	n, _ := f.ReadAt(data, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+	return pid
+}
+
+// alreadyRunning is the error for a PID file of a running process
+func alreadyRunning(pid int) error {
+	if pid == 0 {
+		return errAlreadyRunning
+	}
+	return fmt.Errorf("%w with PID %d", errAlreadyRunning, pid)
+}
@@ -0,0 +1,65 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// daemonize isn't supported, Windows runs the server in the background as a
+// service instead
+func daemonize(logPath string) (int, error) {
+	return 0, errors.New("not supported on this platform, install a service with 'timeship service install' instead")
+}
+
+// daemonReadyPipe returns nil, as there are no processes started by
+// daemonize
+func daemonReadyPipe() *os.File {
+	return nil
+}
+
+// writePIDFile creates a file at path with the ID of this process, failing
+// if it exists and names another process that is still running. Files of
+// processes that exited are replaced. Returns a function removing the file.
+func writePIDFile(path string) (remove func(), err error) {
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			existing, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			pid := readPID(existing)
+			existing.Close()
+			if pid == 0 || processRunning(pid) {
+				return nil, alreadyRunning(pid)
+			}
+			os.Remove(path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+		f.Close()
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+		return func() { os.Remove(path) }, nil
+	}
+	return nil, errAlreadyRunning
+}
+
+// processRunning reports whether a process with the ID exists
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
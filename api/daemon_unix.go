@@ -0,0 +1,141 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// daemonReadyFD is the file descriptor the process started in the
+// background inherits the pipe to report its readiness on
+const daemonReadyFD = 3
+
+// daemonize starts this program again with the same arguments in a new
+// session, so it keeps running after the terminal is closed, and returns its
+// process ID once it's ready to serve. Its output goes to the log file if
+// set, otherwise it's discarded.
+func daemonize(logPath string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if logPath != "" {
+		out, err = openLog(logPath)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.ExtraFiles = []*os.File{readyWriter}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+
+	// The pipe closes without a message if the process exits while starting
+	result := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(ready).ReadString('\n')
+		if line == daemonReadyMessage {
+			result <- nil
+			return
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			err = errors.New("exited while starting")
+		case err == nil:
+			err = fmt.Errorf("unexpected message %q", line)
+		}
+		result <- err
+	}()
+	select {
+	case err = <-result:
+	case <-time.After(daemonReadyTimeout):
+		err = fmt.Errorf("not ready after %s", daemonReadyTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return 0, fmt.Errorf("process %d failed to start, see the log: %w", pid, err)
+	}
+	return pid, cmd.Process.Release()
+}
+
+// daemonReadyPipe returns the pipe to report readiness on in the process
+// started by daemonize, nil in other processes. Processes the server starts
+// inherit neither the pipe nor the environment marking it as the daemon.
+func daemonReadyPipe() *os.File {
+	if os.Getenv(daemonEnv) == "" {
+		return nil
+	}
+	os.Unsetenv(daemonEnv)
+	syscall.CloseOnExec(daemonReadyFD)
+	return os.NewFile(daemonReadyFD, "ready")
+}
+
+// writePIDFile writes the ID of this process to path and keeps it locked
+// while running, failing if another process holds the lock. Returns a
+// function removing the file.
+func writePIDFile(path string) (remove func(), err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			pid := readPID(f)
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, alreadyRunning(pid)
+			}
+			return nil, err
+		}
+
+		// The process that held the lock may have removed the file in
+		// between, then the lock is on a file no one else sees
+		opened, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(path); err != nil || !os.SameFile(opened, current) {
+			f.Close()
+			continue
+		}
+
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if _, err := fmt.Fprintf(f, "%d\n", os.Getpid()); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return func() {
+			os.Remove(path)
+			f.Close()
+		}, nil
+	}
+}
@@ -0,0 +1,391 @@
+// Package access decides which storages and paths a user may read or write.
+//
+// Users authenticate with bearer tokens and are granted permissions on path
+// prefixes by rules like "local://public/**", which covers public and
+// everything below it. A rule for "*://**" covers all storages. Without a
+// matching rule, access is denied. Directories leading to a granted prefix
+// stay visible, so clients can navigate to it, but only the entries on the
+// way are listed.
+//
+// Users can also have a home, a directory of a storage they're confined to.
+// The storage then shows the home as its root to them, and their rules
+// apply to the paths as they see them.
+package access
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Permissions
+const (
+	// Read allows listing directories and reading files
+	Read = "read"
+
+	// Write allows creating, changing and deleting nodes
+	Write = "write"
+)
+
+// Permissions lists all permissions
+var Permissions = []string{Read, Write}
+
+// ErrUnauthenticated is returned for requests without a valid token
+var ErrUnauthenticated = errors.New("missing or invalid token")
+
+// Rule grants permissions on a path prefix of a storage
+type Rule struct {
+	// Storage is the name of the storage, "*" matches all storages
+	Storage string
+
+	// Prefix is the path the rule covers together with everything below it,
+	// empty for the whole storage
+	Prefix string
+
+	// Permissions are the granted permissions
+	Permissions []string
+}
+
+// ParseRule parses a rule path like "local://public/**". The trailing "/**"
+// is optional, as rules always cover everything below their prefix.
+func ParseRule(rulePath string, permissions []string) (Rule, error) {
+	storage, prefix, ok := strings.Cut(rulePath, "://")
+	if !ok || storage == "" {
+		return Rule{}, fmt.Errorf("invalid rule path %q, expected storage://path/**", rulePath)
+	}
+	prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, "**"), "/")
+	if strings.ContainsAny(prefix, "*?[") {
+		return Rule{}, fmt.Errorf("invalid rule path %q, only a trailing /** is supported", rulePath)
+	}
+	if len(permissions) == 0 {
+		return Rule{}, fmt.Errorf("rule %q: no permissions", rulePath)
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(Permissions, permission) {
+			return Rule{}, fmt.Errorf("rule %q: unknown permission %q", rulePath, permission)
+		}
+	}
+	return Rule{Storage: storage, Prefix: cleanPath(prefix), Permissions: permissions}, nil
+}
+
+// String returns the rule path, e.g. "local://public/**"
+func (r Rule) String() string {
+	if r.Prefix == "" {
+		return r.Storage + "://**"
+	}
+	return r.Storage + "://" + r.Prefix + "/**"
+}
+
+// cleanPath normalizes a path relative to the storage root, "" for the root
+func cleanPath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// within reports whether p is prefix or below it
+func within(p, prefix string) bool {
+	return prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// User is granted access by rules
+type User struct {
+	// Name identifies the user in logs
+	Name string
+
+	// Token authenticates the user, an empty token makes the rules apply to
+	// requests without a token
+	Token string
+
+	// Rules grant the user permissions
+	Rules []Rule
+
+	// HomeStorage is the name of the storage the user is confined to a
+	// directory of, empty if the user has no home
+	HomeStorage string
+
+	// HomePath is the directory of HomeStorage shown to the user as its root
+	HomePath string
+
+	// Owner is the configured user that issued the token the user
+	// authenticated with, nil for configured users. Tokens never grant more
+	// than their owner currently may.
+	Owner *User
+}
+
+// ParseHome parses a home like "local://homes/{user}", replacing {user} with
+// the user name, into the storage name and directory
+func ParseHome(home, userName string) (storageName, dir string, err error) {
+	storageName, dir, ok := strings.Cut(strings.ReplaceAll(home, "{user}", userName), "://")
+	if !ok || storageName == "" || storageName == "*" {
+		return "", "", fmt.Errorf("invalid home %q, expected storage://path", home)
+	}
+	dir = cleanPath(dir)
+	if dir == "" || strings.ContainsAny(dir, "*?[{}") {
+		return "", "", fmt.Errorf("invalid home %q, expected a directory below the storage root", home)
+	}
+	return storageName, dir, nil
+}
+
+// Allowed reports whether the user has the permission on a path
+func (u *User) Allowed(storage, p, permission string) bool {
+	if u.Owner != nil && !u.Owner.Allowed(storage, p, permission) {
+		return false
+	}
+	p = cleanPath(p)
+	for _, rule := range u.Rules {
+		if (rule.Storage == "*" || rule.Storage == storage) && within(p, rule.Prefix) && slices.Contains(rule.Permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Visible reports whether the user may see a node, because they may read it
+// or it leads to a prefix they were granted any permission on
+func (u *User) Visible(storage, p string) bool {
+	if u.Owner != nil && !u.Owner.Visible(storage, p) {
+		return false
+	}
+	if u.Allowed(storage, p, Read) {
+		return true
+	}
+	p = cleanPath(p)
+	for _, rule := range u.Rules {
+		if (rule.Storage == "*" || rule.Storage == storage) && rule.Prefix != p && within(rule.Prefix, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the user has all permissions of a rule on
+// everything the rule covers, so they may grant it to a token
+func (u *User) Covers(rule Rule) bool {
+	for _, permission := range rule.Permissions {
+		covered := false
+		for _, own := range u.Rules {
+			if (own.Storage == "*" || own.Storage == rule.Storage) && within(rule.Prefix, own.Prefix) && slices.Contains(own.Permissions, permission) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return u.Owner == nil || u.Owner.Covers(rule)
+}
+
+// IssuedToken is a token issued at runtime by a configured user
+type IssuedToken struct {
+	// Owner is the name of the user the token was issued by
+	Owner string
+
+	// Name describes the token
+	Name string
+
+	// Rules grant the token permissions, limited to those of the owner
+	Rules []Rule
+}
+
+// Issuer looks up tokens issued at runtime, e.g. through the API
+type Issuer interface {
+	// Lookup returns the token, nil if it's unknown, revoked or expired
+	Lookup(token string) (*IssuedToken, error)
+}
+
+// Config configures a policy
+type Config struct {
+	// Issuer looks up tokens issued at runtime, nil if there are none
+	Issuer Issuer
+
+	// Failures is how many invalid tokens a source may send before it's
+	// locked out, defaults to 5
+	Failures int
+
+	// Lockout is how long the first lockout lasts, doubling with each
+	// further invalid token, defaults to 1s
+	Lockout time.Duration
+
+	// MaxLockout caps the lockouts, defaults to 15m. Sources without
+	// failures for this long are forgiven.
+	MaxLockout time.Duration
+
+	// TrustedProxies are the addresses of reverse proxies whose
+	// X-Forwarded-For header tells the source of a request
+	TrustedProxies []netip.Prefix
+}
+
+// Policy authenticates users
+type Policy struct {
+	users     []User
+	anonymous *User
+	issuer    Issuer
+	trusted   []netip.Prefix
+
+	// sources and accounts lock out IP addresses and user names
+	sources  *throttle
+	accounts *throttle
+}
+
+// New creates a policy for the users with the default lockout
+func New(users []User) (*Policy, error) {
+	return NewWithConfig(users, Config{})
+}
+
+// NewWithConfig creates a policy for the users. Tokens must be unique and at
+// most one user may have no token. Users with a home and no rules may read
+// and write all of their home.
+func NewWithConfig(users []User, config Config) (*Policy, error) {
+	p := &Policy{
+		issuer:   config.Issuer,
+		trusted:  config.TrustedProxies,
+		sources:  newThrottle(config),
+		accounts: newThrottle(config),
+	}
+	tokens := map[string]bool{}
+	for i := range users {
+		user := &users[i]
+		if user.HomeStorage != "" && len(user.Rules) == 0 {
+			user.Rules = []Rule{{Storage: user.HomeStorage, Permissions: Permissions}}
+		}
+		if user.Token == "" {
+			if p.anonymous != nil {
+				return nil, errors.New("only one user may have no token")
+			}
+			p.anonymous = user
+			continue
+		}
+		if tokens[user.Token] {
+			return nil, fmt.Errorf("user %s: token is used by another user", user.Name)
+		}
+		tokens[user.Token] = true
+		p.users = append(p.users, *user)
+	}
+	return p, nil
+}
+
+// Anonymous reports whether requests without a token are let in as the user
+// without a token
+func (p *Policy) Anonymous() bool {
+	return p.anonymous != nil
+}
+
+// Authenticate returns the user of a request's bearer token, or of the
+// access_token query parameter for links like downloads and thumbnails.
+// Basic credentials name the user as well, with the token as the password.
+// Requests without a token get the user without a token, if there is one.
+// Sources sending too many invalid tokens, and users whose name is sent with
+// too many invalid tokens, are locked out for a while, failing with a
+// ThrottledError even if the token is valid.
+func (p *Policy) Authenticate(r *http.Request) (*User, error) {
+	token := r.URL.Query().Get("access_token")
+	account := ""
+	if scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(credentials)
+	} else if name, password, ok := r.BasicAuth(); ok {
+		account, token = name, password
+	}
+	if token == "" {
+		if p.anonymous == nil {
+			return nil, ErrUnauthenticated
+		}
+		return p.anonymous, nil
+	}
+
+	source := sourceIP(r, p.trusted)
+	wait := p.sources.wait(source)
+	if account != "" {
+		wait = max(wait, p.accounts.wait(account))
+	}
+	if wait > 0 {
+		return nil, &ThrottledError{RetryAfter: wait}
+	}
+
+	// Compare all tokens in constant time, so timing doesn't reveal them
+	var found *User
+	for i := range p.users {
+		if subtle.ConstantTimeCompare([]byte(p.users[i].Token), []byte(token)) == 1 {
+			found = &p.users[i]
+		}
+	}
+	if found == nil && p.issuer != nil {
+		issued, err := p.issuer.Lookup(token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+		}
+		if issued != nil {
+			found = p.issuedUser(issued)
+		}
+	}
+	// Tokens sent with a user name must be the user's
+	if found != nil && account != "" && found.Name != account {
+		found = nil
+	}
+	if found == nil {
+		p.sources.fail(source)
+		// Only configured users are tracked, so guessing names doesn't
+		// fill the memory
+		if account != "" && p.Lookup(account) != nil {
+			p.accounts.fail(account)
+		}
+		return nil, ErrUnauthenticated
+	}
+	p.sources.succeed(source)
+	if account != "" {
+		p.accounts.succeed(account)
+	}
+	return found, nil
+}
+
+// Lookup returns the configured user with the name, nil if there is none,
+// e.g. to act on behalf of a user outside of a request. Tokens issued by the
+// user aren't considered.
+func (p *Policy) Lookup(name string) *User {
+	if p.anonymous != nil && p.anonymous.Name == name {
+		return p.anonymous
+	}
+	for i := range p.users {
+		if p.users[i].Name == name {
+			return &p.users[i]
+		}
+	}
+	return nil
+}
+
+// issuedUser returns the user of an issued token, nil if its owner is no
+// longer configured
+func (p *Policy) issuedUser(issued *IssuedToken) *User {
+	for i := range p.users {
+		owner := &p.users[i]
+		if owner.Name == issued.Owner {
+			return &User{
+				Name:        owner.Name,
+				Rules:       issued.Rules,
+				HomeStorage: owner.HomeStorage,
+				HomePath:    owner.HomePath,
+				Owner:       owner,
+			}
+		}
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the authenticated user
+func NewContext(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// FromContext returns the authenticated user, nil if there is none
+func FromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(contextKey{}).(*User)
+	return user
+}
@@ -0,0 +1,303 @@
+package access
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		path    string
+		storage string
+		prefix  string
+		wantErr bool
+	}{
+		{"local://public/**", "local", "public", false},
+		{"local://public", "local", "public", false},
+		{"local://public/", "local", "public", false},
+		{"local://**", "local", "", false},
+		{"local://", "local", "", false},
+		{"*://**", "*", "", false},
+		{"local://a/../b/**", "local", "b", false},
+		{"public/**", "", "", true},
+		{"://public", "", "", true},
+		{"local://*.txt", "", "", true},
+		{"local://a/**/b", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rule, err := ParseRule(tt.path, []string{Read})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (rule.Storage != tt.storage || rule.Prefix != tt.prefix) {
+				t.Errorf("expected %s %q, got %s %q", tt.storage, tt.prefix, rule.Storage, rule.Prefix)
+			}
+			if err == nil {
+				if again, err := ParseRule(rule.String(), rule.Permissions); err != nil || again.Storage != rule.Storage || again.Prefix != rule.Prefix {
+					t.Errorf("expected %s to parse back, got %+v, %v", rule, again, err)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseRule("local://**", nil); err == nil {
+		t.Error("expected error without permissions")
+	}
+	if _, err := ParseRule("local://**", []string{"admin"}); err == nil {
+		t.Error("expected error for unknown permission")
+	}
+}
+
+func TestParseHome(t *testing.T) {
+	tests := []struct {
+		home    string
+		storage string
+		dir     string
+		wantErr bool
+	}{
+		{"local://homes/{user}", "local", "homes/alice", false},
+		{"local://{user}", "local", "alice", false},
+		{"local://shared/", "local", "shared", false},
+		{"local://homes/../{user}", "local", "alice", false},
+		{"local://", "", "", true},
+		{"local://..", "", "", true},
+		{"*://homes/{user}", "", "", true},
+		{"homes/{user}", "", "", true},
+		{"local://homes/*", "", "", true},
+		{"local://homes/{name}", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.home, func(t *testing.T) {
+			storage, dir, err := ParseHome(tt.home, "alice")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if storage != tt.storage || dir != tt.dir {
+				t.Errorf("expected %s %q, got %s %q", tt.storage, tt.dir, storage, dir)
+			}
+		})
+	}
+}
+
+func TestUser(t *testing.T) {
+	rule := func(path string, permissions ...string) Rule {
+		r, err := ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	user := &User{Rules: []Rule{
+		rule("local://public/**", Read),
+		rule("local://uploads/inbox/**", Write),
+		rule("backup://**", Read, Write),
+	}}
+
+	tests := []struct {
+		storage string
+		path    string
+		read    bool
+		write   bool
+		visible bool
+	}{
+		{"local", "public", true, false, true},
+		{"local", "public/a/b.txt", true, false, true},
+		{"local", "/public/a.txt", true, false, true},
+		{"local", "publicity.txt", false, false, false},
+		{"local", "", false, false, true},
+		{"local", "private", false, false, false},
+		{"local", "public/../private", false, false, false},
+		{"local", "uploads", false, false, true},
+		{"local", "uploads/inbox", false, true, false},
+		{"local", "uploads/inbox/a.txt", false, true, false},
+		{"local", "uploads/other", false, false, false},
+		{"backup", "", true, true, true},
+		{"backup", "any/path", true, true, true},
+		{"other", "", false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.storage+"://"+tt.path, func(t *testing.T) {
+			if got := user.Allowed(tt.storage, tt.path, Read); got != tt.read {
+				t.Errorf("expected read %v, got %v", tt.read, got)
+			}
+			if got := user.Allowed(tt.storage, tt.path, Write); got != tt.write {
+				t.Errorf("expected write %v, got %v", tt.write, got)
+			}
+			if got := user.Visible(tt.storage, tt.path); got != tt.visible {
+				t.Errorf("expected visible %v, got %v", tt.visible, got)
+			}
+		})
+	}
+
+	all := &User{Rules: []Rule{rule("*://**", Read)}}
+	if !all.Allowed("anything", "a/b", Read) || all.Allowed("anything", "a/b", Write) {
+		t.Error("expected wildcard storage to grant read only")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := New([]User{
+		{Name: "alice", Token: "alice-token"},
+		{Name: "bob", Token: "bob-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   string
+	}{
+		{"bearer", "Bearer alice-token", "", "alice"},
+		{"lowercase scheme", "bearer bob-token", "", "bob"},
+		{"query", "", "bob-token", "bob"},
+		{"header wins", "Bearer alice-token", "bob-token", "alice"},
+		{"invalid", "Bearer nope", "", ""},
+		{"basic auth", "Basic YWxpY2U6YWxpY2UtdG9rZW4=", "", "alice"},
+		{"basic auth of another user", "Basic Ym9iOmFsaWNlLXRva2Vu", "", ""},
+		{"missing", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/storages?access_token="+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			user, err := policy.Authenticate(r)
+			if tt.want == "" {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("expected ErrUnauthenticated, got %v", err)
+				}
+				return
+			}
+			if err != nil || user.Name != tt.want {
+				t.Errorf("expected %s, got %v, %v", tt.want, user, err)
+			}
+		})
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		policy, err := New([]User{{Name: "alice", Token: "alice-token"}, {Name: "guest"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := policy.Authenticate(httptest.NewRequest("GET", "/storages", nil))
+		if err != nil || user.Name != "guest" {
+			t.Errorf("expected guest, got %v, %v", user, err)
+		}
+		r := httptest.NewRequest("GET", "/storages", nil)
+		r.Header.Set("Authorization", "Bearer wrong")
+		if _, err := policy.Authenticate(r); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("expected invalid tokens to fail, got %v", err)
+		}
+	})
+
+	t.Run("home", func(t *testing.T) {
+		policy, err := New([]User{{Name: "alice", HomeStorage: "local", HomePath: "homes/alice"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := policy.Authenticate(httptest.NewRequest("GET", "/storages", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.Allowed("local", "", Write) || !user.Allowed("local", "a/b.txt", Read) || user.Visible("other", "") {
+			t.Errorf("expected access to the home storage only, got %+v", user.Rules)
+		}
+	})
+
+	t.Run("invalid users", func(t *testing.T) {
+		if _, err := New([]User{{Name: "a", Token: "x"}, {Name: "b", Token: "x"}}); err == nil {
+			t.Error("expected error for duplicate tokens")
+		}
+		if _, err := New([]User{{Name: "a"}, {Name: "b"}}); err == nil {
+			t.Error("expected error for two users without token")
+		}
+	})
+}
+
+// issuer issues a fixed set of tokens
+type issuer map[string]*IssuedToken
+
+func (i issuer) Lookup(token string) (*IssuedToken, error) {
+	return i[token], nil
+}
+
+func TestIssuedTokens(t *testing.T) {
+	rule := func(path string, permissions ...string) Rule {
+		r, err := ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	policy, err := NewWithConfig([]User{
+		{Name: "alice", Token: "alice-token", Rules: []Rule{rule("local://photos/**", Read, Write)}},
+	}, Config{Issuer: issuer{
+		"tst_photos": {Owner: "alice", Name: "photos", Rules: []Rule{rule("local://photos/2026/**", Read)}},
+		"tst_wide":   {Owner: "alice", Name: "wide", Rules: []Rule{rule("local://**", Read, Write)}},
+		"tst_orphan": {Owner: "carol", Name: "orphan", Rules: []Rule{rule("local://**", Read)}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate := func(token string) (*User, error) {
+		r := httptest.NewRequest("GET", "/storages", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return policy.Authenticate(r)
+	}
+
+	user, err := authenticate("tst_photos")
+	if err != nil || user.Name != "alice" || user.Owner == nil {
+		t.Fatalf("expected alice's token, got %+v, %v", user, err)
+	}
+	if !user.Allowed("local", "photos/2026/a.jpg", Read) || user.Allowed("local", "photos/2026/a.jpg", Write) || user.Allowed("local", "photos/2025", Read) {
+		t.Error("expected the token's rules to apply")
+	}
+	if !user.Visible("local", "photos") || user.Visible("local", "private") {
+		t.Error("expected directories leading to the token's rules to be visible")
+	}
+
+	// Tokens never grant more than their owner may
+	wide, err := authenticate("tst_wide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wide.Allowed("local", "photos/a.jpg", Write) || wide.Allowed("local", "private/b.txt", Read) {
+		t.Error("expected the token to be limited by its owner")
+	}
+
+	if _, err := authenticate("tst_orphan"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected tokens of unknown owners to fail, got %v", err)
+	}
+	if _, err := authenticate("tst_unknown"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected unknown tokens to fail, got %v", err)
+	}
+
+	t.Run("covers", func(t *testing.T) {
+		alice := &policy.users[0]
+		tests := []struct {
+			rule   Rule
+			covers bool
+		}{
+			{rule("local://photos/**", Read, Write), true},
+			{rule("local://photos/2026/**", Read), true},
+			{rule("local://**", Read), false},
+			{rule("local://private/**", Read), false},
+			{rule("*://photos/**", Read), false},
+			{rule("other://photos/**", Read), false},
+		}
+		for _, tt := range tests {
+			if got := alice.Covers(tt.rule); got != tt.covers {
+				t.Errorf("%s: expected covers %v, got %v", tt.rule, tt.covers, got)
+			}
+		}
+		if user.Covers(rule("local://photos/**", Read)) {
+			t.Error("expected tokens to cover only their own rules")
+		}
+	})
+}
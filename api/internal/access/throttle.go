@@ -0,0 +1,181 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrThrottled is returned for requests from sources sending too many
+// invalid tokens
+var ErrThrottled = errors.New("too many invalid tokens")
+
+// ThrottledError is returned while a source is locked out
+type ThrottledError struct {
+	// RetryAfter is how long the lockout still lasts
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", ErrThrottled, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return ErrThrottled
+}
+
+// Throttling defaults
+const (
+	defaultFailures   = 5
+	defaultLockout    = time.Second
+	defaultMaxLockout = 15 * time.Minute
+
+	// maxKeys limits how many sources or accounts with failures are
+	// remembered, further ones aren't tracked until others expired
+	maxKeys = 10000
+)
+
+// record is the failure record of a source or account
+type record struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// throttle locks out keys, e.g. sources or accounts, with exponential
+// backoff after repeated failures
+type throttle struct {
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	records map[string]*record
+}
+
+// newThrottle creates a throttle, filling in the defaults
+func newThrottle(config Config) *throttle {
+	if config.Failures <= 0 {
+		config.Failures = defaultFailures
+	}
+	if config.Lockout <= 0 {
+		config.Lockout = defaultLockout
+	}
+	if config.MaxLockout <= 0 {
+		config.MaxLockout = defaultMaxLockout
+	}
+	return &throttle{config: config, now: time.Now, records: map[string]*record{}}
+}
+
+// wait returns how long the key is still locked out, zero if it isn't
+func (t *throttle) wait(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rec, ok := t.records[key]
+	if !ok {
+		return 0
+	}
+	return max(0, rec.until.Sub(t.now()))
+}
+
+// fail records a failure of the key, locking it out once it failed too
+// often
+func (t *throttle) fail(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+
+	rec, ok := t.records[key]
+	if !ok || now.Sub(rec.last) > t.config.MaxLockout {
+		if !ok && len(t.records) >= maxKeys && !t.forget(now) {
+			return
+		}
+		rec = &record{}
+		t.records[key] = rec
+	}
+	rec.failures++
+	rec.last = now
+	if excess := rec.failures - t.config.Failures; excess >= 0 {
+		lockout := t.config.Lockout
+		for i := 0; i < excess && lockout < t.config.MaxLockout; i++ {
+			lockout *= 2
+		}
+		rec.until = now.Add(min(lockout, t.config.MaxLockout))
+	}
+}
+
+// succeed forgives the failures of the key
+func (t *throttle) succeed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.records, key)
+}
+
+// forget drops the records without recent failures, or else those that
+// aren't locked out, so memory stays bounded without lifting a lockout.
+// Returns whether there's room for another record.
+func (t *throttle) forget(now time.Time) bool {
+	for key, rec := range t.records {
+		if now.Sub(rec.last) > t.config.MaxLockout {
+			delete(t.records, key)
+		}
+	}
+	if len(t.records) < maxKeys {
+		return true
+	}
+	for key, rec := range t.records {
+		if !rec.until.After(now) {
+			delete(t.records, key)
+		}
+	}
+	return len(t.records) < maxKeys
+}
+
+// sourceIP returns the IP address a request comes from. Requests from
+// trusted proxies come from the last address in X-Forwarded-For that isn't
+// a trusted proxy itself. IPv6 addresses are grouped by their /64 prefix, as
+// a single host usually gets a whole /64.
+func sourceIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	if isTrusted(addr, trusted) {
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+			if err != nil {
+				break
+			}
+			addr = hop.Unmap()
+			if !isTrusted(addr, trusted) {
+				break
+			}
+		}
+	}
+
+	if addr.Is6() {
+		return netip.PrefixFrom(addr, 64).Masked().String()
+	}
+	return addr.String()
+}
+
+// isTrusted reports whether the address is one of the trusted proxies
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package access
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	th := newThrottle(Config{Failures: 3, Lockout: time.Second, MaxLockout: 10 * time.Second})
+	th.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		fail    bool
+		wait    time.Duration
+	}{
+		{"first failure", 0, true, 0},
+		{"second failure", 0, true, 0},
+		{"locked out", 0, true, time.Second},
+		{"lockout passes", time.Second, false, 0},
+		{"doubles", 0, true, 2 * time.Second},
+		{"doubles again", 2 * time.Second, true, 4 * time.Second},
+		{"doubles once more", 4 * time.Second, true, 8 * time.Second},
+		{"capped at max", 8 * time.Second, true, 10 * time.Second},
+		{"forgiven after max lockout", 21 * time.Second, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			if tt.fail {
+				th.fail("1.2.3.4")
+			}
+			if got := th.wait("1.2.3.4"); got != tt.wait {
+				t.Errorf("expected wait %v, got %v", tt.wait, got)
+			}
+		})
+	}
+
+	if got := th.wait("5.6.7.8"); got != 0 {
+		t.Errorf("expected other sources not to wait, got %v", got)
+	}
+	th.succeed("1.2.3.4")
+	if _, ok := th.records["1.2.3.4"]; ok {
+		t.Error("expected success to forgive failures")
+	}
+}
+
+func TestPolicyLockout(t *testing.T) {
+	policy, err := NewWithConfig([]User{{Name: "alice", Token: "alice-token"}}, Config{Failures: 2, Lockout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate := func(remoteAddr, token string) error {
+		r := httptest.NewRequest("GET", "/storages", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Authorization", "Bearer "+token)
+		_, err := policy.Authenticate(r)
+		return err
+	}
+
+	for range 2 {
+		if err := authenticate("10.0.0.1:1234", "guess"); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expected ErrUnauthenticated, got %v", err)
+		}
+	}
+	var throttled *ThrottledError
+	if err := authenticate("10.0.0.1:5678", "alice-token"); !errors.As(err, &throttled) || throttled.RetryAfter <= 0 {
+		t.Errorf("expected valid token to be locked out too, got %v", err)
+	}
+	if err := authenticate("10.0.0.2:1234", "alice-token"); err != nil {
+		t.Errorf("expected other source to pass, got %v", err)
+	}
+}
+
+func TestThrottleForget(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	th := newThrottle(Config{Failures: 1, Lockout: time.Minute, MaxLockout: time.Hour})
+	th.now = func() time.Time { return now }
+
+	th.fail("locked")
+	for i := range maxKeys - 1 {
+		th.records[strconv.Itoa(i)] = &record{failures: 1, last: now}
+	}
+	// Records that aren't locked out make room, lockouts stay
+	th.fail("new")
+	if th.wait("locked") == 0 || th.wait("new") == 0 {
+		t.Errorf("expected both to be locked out, got %v and %v", th.wait("locked"), th.wait("new"))
+	}
+
+	// Without room, new keys aren't tracked rather than lifting lockouts
+	for i := range maxKeys {
+		th.records[strconv.Itoa(i)] = &record{failures: 1, last: now, until: now.Add(time.Minute)}
+	}
+	th.fail("ignored")
+	if _, ok := th.records["ignored"]; ok || th.wait("locked") == 0 {
+		t.Error("expected lockouts to be kept when full")
+	}
+}
+
+func TestSourceIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"ipv4", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"ipv6 grouped by /64", "[2001:db8:1:2:3:4:5:6]:1234", nil, "2001:db8:1:2::/64"},
+		{"mapped ipv4", "[::ffff:192.0.2.1]:1234", nil, "192.0.2.1"},
+		{"untrusted forwarding", "192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed hops", "10.0.0.1:1234", []string{"1.1.1.1, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"several headers", "10.0.0.1:1234", []string{"1.1.1.1", "198.51.100.7"}, "198.51.100.7"},
+		{"invalid hop", "10.0.0.1:1234", []string{"garbage"}, "10.0.0.1"},
+		{"ipv6 client of proxy", "[fd00::1]:1234", []string{"2001:db8::1"}, "2001:db8::/64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/storages", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := sourceIP(r, trusted); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAccountLockout(t *testing.T) {
+	policy, err := NewWithConfig([]User{{Name: "alice", Token: "alice-token"}, {Name: "bob", Token: "bob-token"}}, Config{Failures: 2, Lockout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate := func(remoteAddr, name, token string) (*User, error) {
+		r := httptest.NewRequest("GET", "/storages", nil)
+		r.RemoteAddr = remoteAddr
+		r.SetBasicAuth(name, token)
+		return policy.Authenticate(r)
+	}
+
+	if user, err := authenticate("10.0.0.1:1234", "alice", "alice-token"); err != nil || user.Name != "alice" {
+		t.Fatalf("expected basic credentials to authenticate alice, got %v, %v", user, err)
+	}
+	if _, err := authenticate("10.0.0.1:1234", "alice", "bob-token"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected the token of another user to fail, got %v", err)
+	}
+
+	// Guesses from many sources lock out the account
+	authenticate("192.0.2.1:1234", "alice", "guess")
+	var throttled *ThrottledError
+	if _, err := authenticate("192.0.2.2:1234", "alice", "alice-token"); !errors.As(err, &throttled) {
+		t.Errorf("expected alice to be locked out, got %v", err)
+	}
+	if _, err := authenticate("192.0.2.3:1234", "bob", "bob-token"); err != nil {
+		t.Errorf("expected bob to pass, got %v", err)
+	}
+}
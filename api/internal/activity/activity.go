@@ -0,0 +1,182 @@
+// Package activity stores what happened to nodes in SQLite, so teams can see
+// who uploaded, deleted, restored, renamed or shared a path and discuss it
+// in comments.
+//
+// Events are stored by storage and path and listed newest first for a node
+// together with the nodes below it. Renames through the API move the events
+// of the renamed nodes along, so their history stays with them.
+package activity
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"timeship/internal/state"
+)
+
+// migrations create the events table. Comments are events with a text.
+var migrations = []string{`
+CREATE TABLE IF NOT EXISTS events (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	type        TEXT NOT NULL,
+	actor       TEXT NOT NULL,
+	storage     TEXT NOT NULL,
+	path        TEXT NOT NULL,
+	snapshot    TEXT NOT NULL,
+	from_path   TEXT NOT NULL,
+	text        TEXT NOT NULL,
+	created_at  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_path ON events (storage, path);
+`}
+
+// Event types
+const (
+	// Uploaded is recorded when a file was uploaded
+	Uploaded = "uploaded"
+
+	// Deleted is recorded when a node was deleted or trashed
+	Deleted = "deleted"
+
+	// Restored is recorded when a node was restored from a snapshot or the
+	// trash, on the path it was restored to
+	Restored = "restored"
+
+	// Renamed is recorded when a node was renamed or moved, on its new path
+	Renamed = "renamed"
+
+	// Shared is recorded when a token granting access to a node was issued
+	Shared = "shared"
+
+	// Commented is a comment of a user
+	Commented = "commented"
+)
+
+// MaxCommentLength is the maximum length of a comment in bytes
+const MaxCommentLength = 10000
+
+// Event is something that happened to a node
+type Event struct {
+	// ID identifies the event and orders events by when they were recorded
+	ID int64
+
+	// Type is one of the event types, e.g. "restored"
+	Type string
+
+	// Actor is the name of the user that caused the event, empty without
+	// access control
+	Actor string
+
+	// Storage is the name of the storage of the node
+	Storage string
+
+	// Path is the path of the node relative to the storage root
+	Path string
+
+	// Snapshot is the ID of the snapshot involved, e.g. the one a node was
+	// restored from
+	Snapshot string
+
+	// From is the path the node came from, e.g. the path it was renamed
+	// from or its path in the snapshot it was restored from
+	From string
+
+	// Text is the text of a comment or the name of a shared token
+	Text string
+
+	// CreatedAt is when the event happened as a Unix timestamp
+	CreatedAt int64
+}
+
+// Store stores events in a SQLite database
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens or creates the activity database at the given path
+func Open(path string) (*Store, error) {
+	db, err := state.Open(path, "activity", migrations, state.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open activity database: %w", err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores an event and returns it with its ID. The time is set if
+// it's zero.
+func (s *Store) Record(event Event) (Event, error) {
+	if event.CreatedAt == 0 {
+		event.CreatedAt = s.now().Unix()
+	}
+	result, err := s.db.Exec(`INSERT INTO events (type, actor, storage, path, snapshot, from_path, text, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.Type, event.Actor, event.Storage, event.Path, event.Snapshot, event.From, event.Text, event.CreatedAt)
+	if err != nil {
+		return Event{}, err
+	}
+	event.ID, err = result.LastInsertId()
+	return event, err
+}
+
+// Feed returns up to limit events of a node and the nodes below it, newest
+// first. Only events older than the event with the before ID are returned
+// if it's positive, to fetch the next page.
+func (s *Store) Feed(storage, path string, before int64, limit int) ([]Event, error) {
+	query := `SELECT id, type, actor, storage, path, snapshot, from_path, text, created_at FROM events
+		WHERE storage = ?1 AND (?2 = '' OR path = ?2 OR substr(path, 1, length(?3)) = ?3) AND (?4 <= 0 OR id < ?4)
+		ORDER BY id DESC LIMIT ?5`
+	rows, err := s.db.Query(query, storage, path, path+"/", before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.Actor, &e.Storage, &e.Path, &e.Snapshot, &e.From, &e.Text, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// DeleteComment deletes a comment of a user, failing with fs.ErrNotExist if
+// the user has no comment with the ID. Other events can't be deleted.
+func (s *Store) DeleteComment(actor string, id int64) error {
+	result, err := s.db.Exec(`DELETE FROM events WHERE id = ? AND actor = ? AND type = ?`, id, actor, Commented)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("comment %d: %w", id, fs.ErrNotExist)
+	}
+	return nil
+}
+
+// Move moves the events of a node and the nodes below it to another path,
+// after the node was renamed or moved
+func (s *Store) Move(storage, from, to string) error {
+	// Paths below the node keep their part after it. SQLite counts
+	// characters, not bytes, so lengths are taken in SQL.
+	_, err := s.db.Exec(`UPDATE events SET path = ?1 || substr(path, length(?2) + 1)
+		WHERE storage = ?3 AND (path = ?2 OR substr(path, 1, length(?4)) = ?4)`,
+		to, from, storage, from+"/")
+	return err
+}
+
+// ValidComment reports whether a comment can be stored
+func ValidComment(text string) bool {
+	return strings.TrimSpace(text) != "" && len(text) <= MaxCommentLength
+}
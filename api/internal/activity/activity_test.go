@@ -0,0 +1,114 @@
+package activity
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "activity.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	for _, e := range []Event{
+		{Type: Uploaded, Actor: "alice", Storage: "local", Path: "docs/taxes.pdf"},
+		{Type: Uploaded, Actor: "alice", Storage: "local", Path: "docs-old/a.txt"},
+		{Type: Restored, Actor: "bob", Storage: "local", Path: "docs/taxes.pdf", Snapshot: "daily", From: "docs/taxes.pdf"},
+		{Type: Uploaded, Actor: "alice", Storage: "other", Path: "docs/taxes.pdf"},
+		{Type: Commented, Actor: "bob", Storage: "local", Path: "docs", Text: "Cleaned up"},
+	} {
+		if _, err := store.Record(e); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	types := func(events []Event) []string {
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type+" "+e.Path)
+		}
+		return types
+	}
+
+	t.Run("feed", func(t *testing.T) {
+		events, err := store.Feed("local", "docs", 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Siblings with the same prefix and other storages are left out
+		got := types(events)
+		want := []string{"commented docs", "restored docs/taxes.pdf", "uploaded docs/taxes.pdf"}
+		if len(got) != len(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		}
+		if events[0].CreatedAt != now.Unix() || events[1].Snapshot != "daily" {
+			t.Errorf("unexpected events %+v", events)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		first, err := store.Feed("local", "", 0, 2)
+		if err != nil || len(first) != 2 {
+			t.Fatalf("expected 2 events, got %d, %v", len(first), err)
+		}
+		rest, err := store.Feed("local", "", first[1].ID, 10)
+		if err != nil || len(rest) != 2 || rest[0].ID >= first[1].ID {
+			t.Errorf("expected the 2 older events, got %+v, %v", rest, err)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		if err := store.Move("local", "docs", "papers"); err != nil {
+			t.Fatal(err)
+		}
+		if events, _ := store.Feed("local", "papers", 0, 10); len(events) != 3 || events[1].Path != "papers/taxes.pdf" {
+			t.Errorf("expected events to move, got %+v", events)
+		}
+		if events, _ := store.Feed("local", "docs-old", 0, 10); len(events) != 1 {
+			t.Errorf("expected sibling to stay, got %+v", events)
+		}
+	})
+
+	t.Run("delete comment", func(t *testing.T) {
+		events, _ := store.Feed("local", "papers", 0, 10)
+		comment, restore := events[0], events[1]
+		if err := store.DeleteComment("alice", comment.ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected alice not to delete bob's comment, got %v", err)
+		}
+		if err := store.DeleteComment("bob", restore.ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected other events not to be deleted, got %v", err)
+		}
+		if err := store.DeleteComment("bob", comment.ID); err != nil {
+			t.Errorf("DeleteComment failed: %v", err)
+		}
+	})
+}
+
+func TestValidComment(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Restored the March version", true},
+		{"", false},
+		{" \n", false},
+		{string(make([]byte, MaxCommentLength+1)), false},
+	}
+	for _, tt := range tests {
+		if got := ValidComment(tt.text); got != tt.want {
+			t.Errorf("ValidComment(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
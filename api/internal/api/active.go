@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Active content
+//
+// Files like HTML, SVG and XML can run scripts when opened in a browser. As
+// file content is served from the UI's origin, a malicious file from a backup
+// could then act on behalf of the user. The active content mode controls how
+// such files are served:
+//
+//	sandbox  served as they are, but in a sandbox without scripts or the
+//	         origin's cookies and storage (default)
+//	text     served as plain text, so they're shown as source
+//	allow    served as they are
+//
+// File content is always sent with nosniff unless active content is allowed,
+// so browsers don't guess other types as HTML.
+const (
+	ActiveContentSandbox = "sandbox"
+	ActiveContentText    = "text"
+	ActiveContentAllow   = "allow"
+)
+
+// validActiveContent checks that mode is a known active content mode
+func validActiveContent(mode string) error {
+	switch mode {
+	case "", ActiveContentSandbox, ActiveContentText, ActiveContentAllow:
+		return nil
+	default:
+		return fmt.Errorf("unknown active content mode %q, expected %q, %q or %q", mode, ActiveContentSandbox, ActiveContentText, ActiveContentAllow)
+	}
+}
+
+// activeMimeTypes are the MIME types browsers may run scripts of, besides
+// XML types ending in +xml
+var activeMimeTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+	"text/xsl":              true,
+}
+
+// isActiveContent reports whether browsers may run scripts of the MIME type
+func isActiveContent(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		// Unparsable types could still be sniffed as anything
+		return true
+	}
+	return activeMimeTypes[mediaType] || strings.HasSuffix(mediaType, "+xml")
+}
+
+// setContentType sets the Content-Type of file content, defusing active
+// content according to the active content mode
+func (s *Server) setContentType(w http.ResponseWriter, mimeType string) {
+	mode := s.config.ActiveContent
+	if mode == ActiveContentAllow {
+		w.Header().Set("Content-Type", mimeType)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !isActiveContent(mimeType) {
+		w.Header().Set("Content-Type", mimeType)
+		return
+	}
+	if mode == ActiveContentText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		return
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Security-Policy", "sandbox")
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"timeship/internal/activity"
+	"timeship/internal/tokens"
+)
+
+// defaultActivityLimit and maxActivityLimit bound the events of a page of
+// an activity feed
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 1000
+)
+
+// activityStore returns the activity database, or sends an error response
+// if it's not configured
+func (s *Server) activityStore(w http.ResponseWriter, r *http.Request) (*activity.Store, bool) {
+	if s.config.Activity == nil {
+		s.sendError(w, problemFeatureDisabled, "Activity database is not configured", r.URL.Path)
+		return nil, false
+	}
+	return s.config.Activity, true
+}
+
+// record stores an event of the user of a request if the activity database
+// is configured. Paths are stored without the home of the user, so all
+// users see the same history.
+func (s *Server) record(r *http.Request, event activity.Event) {
+	if s.config.Activity == nil {
+		return
+	}
+	if view, err := s.getStorage(r.Context(), event.Storage); err == nil {
+		_, u := baseNode(view, url.URL{Scheme: event.Storage, Path: event.Path})
+		event.Path = extractPath(u)
+		if event.From != "" {
+			_, u := baseNode(view, url.URL{Scheme: event.Storage, Path: event.From})
+			event.From = extractPath(u)
+		}
+	}
+	event.Actor = tagOwner(r)
+	if _, err := s.config.Activity.Record(event); err != nil {
+		log.Printf("Failed to record %s activity of %s://%s: %v", event.Type, event.Storage, event.Path, err)
+	}
+}
+
+// recordMove moves the events of a node renamed through the API to its new
+// path and records the rename
+func (s *Server) recordMove(r *http.Request, from, to url.URL) {
+	if s.config.Activity == nil {
+		return
+	}
+	if view, err := s.getStorage(r.Context(), from.Scheme); err == nil {
+		_, baseFrom := baseNode(view, from)
+		_, baseTo := baseNode(view, to)
+		if err := s.config.Activity.Move(from.Scheme, extractPath(baseFrom), extractPath(baseTo)); err != nil {
+			log.Printf("Failed to move activity of %s: %v", from.String(), err)
+		}
+	}
+	s.record(r, activity.Event{Type: activity.Renamed, Storage: from.Scheme, Path: extractPath(to), From: extractPath(from)})
+}
+
+// toAPIActivity converts an event to its API representation with paths seen
+// by the user
+func toAPIActivity(e activity.Event, eventPath, from string) ActivityEvent {
+	apiEvent := ActivityEvent{
+		Id:        e.ID,
+		Type:      ActivityEventType(e.Type),
+		Path:      eventPath,
+		CreatedAt: e.CreatedAt,
+	}
+	if e.Actor != "" {
+		apiEvent.Actor = &e.Actor
+	}
+	if e.Snapshot != "" {
+		apiEvent.Snapshot = &e.Snapshot
+	}
+	if from != "" {
+		apiEvent.From = &from
+	}
+	if e.Text != "" {
+		apiEvent.Text = &e.Text
+	}
+	return apiEvent
+}
+
+// GetStoragesStorageActivity lists what happened anywhere in a storage
+func (s *Server) GetStoragesStorageActivity(w http.ResponseWriter, r *http.Request, storageName Storage, params GetStoragesStorageActivityParams) {
+	s.GetStoragesStorageActivityPath(w, r, storageName, "", GetStoragesStorageActivityPathParams(params))
+}
+
+// GetStoragesStorageActivityPath lists what happened to a node and the nodes
+// below it, newest first
+func (s *Server) GetStoragesStorageActivityPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath, params GetStoragesStorageActivityPathParams) {
+	store, ok := s.activityStore(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultActivityLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	if limit < 1 || limit > maxActivityLimit {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Invalid limit, expected 1 to %d", maxActivityLimit), r.URL.Path)
+		return
+	}
+	var before int64
+	if params.Before != nil {
+		before = *params.Before
+	}
+	_, u, ok := s.tagTarget(w, r, string(storageName), nodePath)
+	if !ok {
+		return
+	}
+	// Events are stored without the home of the user
+	view, _ := s.getStorage(r.Context(), string(storageName))
+
+	events, err := store.Feed(u.Scheme, u.Path, before, limit+1)
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to list activity: "+err.Error(), r.URL.Path)
+		return
+	}
+	feed := ActivityFeed{Events: []ActivityEvent{}}
+	if len(events) > limit {
+		events = events[:limit]
+		next := events[limit-1].ID
+		feed.Before = &next
+	}
+	for _, e := range events {
+		eventPath, ok := userPath(view, e.Path)
+		if !ok {
+			continue
+		}
+		from, _ := userPath(view, e.From)
+		feed.Events = append(feed.Events, toAPIActivity(e, eventPath, from))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(feed)
+}
+
+// PostStoragesStorageActivityPath comments on a node
+func (s *Server) PostStoragesStorageActivityPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath) {
+	store, ok := s.activityStore(w, r)
+	if !ok {
+		return
+	}
+	var request CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if !activity.ValidComment(request.Text) {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Invalid comment, expected up to %d bytes of text", activity.MaxCommentLength), r.URL.Path)
+		return
+	}
+	base, u, ok := s.tagTarget(w, r, string(storageName), nodePath)
+	if !ok {
+		return
+	}
+	if _, exists := nodeState(r.Context(), base, u); !exists {
+		s.sendStorageError(w, r, &fs.PathError{Op: "comment", Path: nodePath, Err: fs.ErrNotExist})
+		return
+	}
+
+	event, err := store.Record(activity.Event{
+		Type:    activity.Commented,
+		Actor:   tagOwner(r),
+		Storage: u.Scheme,
+		Path:    u.Path,
+		Text:    request.Text,
+	})
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to store comment: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toAPIActivity(event, strings.Trim(path.Clean("/"+nodePath), "/"), ""))
+}
+
+// DeleteCommentsId deletes a comment of the user
+func (s *Server) DeleteCommentsId(w http.ResponseWriter, r *http.Request, id int64) {
+	store, ok := s.activityStore(w, r)
+	if !ok {
+		return
+	}
+	err := store.DeleteComment(tagOwner(r), id)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.sendError(w, problemCommentNotFound, fmt.Sprintf("comment not found: %d", id), r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to delete comment: "+err.Error(), r.URL.Path)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordShare records that a token granting access to nodes was issued. Rule
+// paths are seen through the storages of the user, so they're mapped out of
+// any home like other events.
+func (s *Server) recordShare(r *http.Request, t tokens.Token) {
+	for _, rule := range t.Rules {
+		if rule.Storage == "*" {
+			continue
+		}
+		s.record(r, activity.Event{Type: activity.Shared, Storage: rule.Storage, Path: rule.Prefix, Text: t.Name})
+	}
+}
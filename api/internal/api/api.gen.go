@@ -6,31 +6,133 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/oapi-codegen/runtime"
 	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
-// Defines values for ErrorResponseStatus.
 const (
-	False ErrorResponseStatus = false
+	BearerAuthScopes = "bearerAuth.Scopes"
+)
+
+// Defines values for ActivityEventType.
+const (
+	Commented ActivityEventType = "commented"
+	Deleted   ActivityEventType = "deleted"
+	Renamed   ActivityEventType = "renamed"
+	Restored  ActivityEventType = "restored"
+	Shared    ActivityEventType = "shared"
+	Uploaded  ActivityEventType = "uploaded"
+)
+
+// Defines values for ArchiveFormat.
+const (
+	ArchiveFormatTar    ArchiveFormat = "tar"
+	ArchiveFormatTarGz  ArchiveFormat = "tar.gz"
+	ArchiveFormatTarZst ArchiveFormat = "tar.zst"
+	ArchiveFormatZip    ArchiveFormat = "zip"
+)
+
+// Defines values for ArchiveVerificationSignature.
+const (
+	Invalid   ArchiveVerificationSignature = "invalid"
+	Unchecked ArchiveVerificationSignature = "unchecked"
+	Unsigned  ArchiveVerificationSignature = "unsigned"
+	Valid     ArchiveVerificationSignature = "valid"
+)
+
+// Defines values for CopyItemResultStatus.
+const (
+	Error   CopyItemResultStatus = "error"
+	Success CopyItemResultStatus = "success"
+)
+
+// Defines values for HealthStatusStatus.
+const (
+	HealthStatusStatusDraining HealthStatusStatus = "draining"
+	HealthStatusStatusOk       HealthStatusStatus = "ok"
+	HealthStatusStatusStale    HealthStatusStatus = "stale"
+)
+
+// Defines values for JobState.
+const (
+	Canceled    JobState = "canceled"
+	Failed      JobState = "failed"
+	Interrupted JobState = "interrupted"
+	Running     JobState = "running"
+	Succeeded   JobState = "succeeded"
+)
+
+// Defines values for ManifestAlgorithm.
+const (
+	Ed25519 ManifestAlgorithm = "ed25519"
 )
 
 // Defines values for NodeType.
 const (
-	Dir  NodeType = "dir"
-	File NodeType = "file"
+	Dir     NodeType = "dir"
+	File    NodeType = "file"
+	Link    NodeType = "link"
+	Special NodeType = "special"
+)
+
+// Defines values for ReadinessReportStatus.
+const (
+	ReadinessReportStatusDraining    ReadinessReportStatus = "draining"
+	ReadinessReportStatusOk          ReadinessReportStatus = "ok"
+	ReadinessReportStatusUnavailable ReadinessReportStatus = "unavailable"
+)
+
+// Defines values for RecentEntryKind.
+const (
+	RecentEntryKindBrowsed    RecentEntryKind = "browsed"
+	RecentEntryKindDownloaded RecentEntryKind = "downloaded"
+)
+
+// Defines values for ReportFileChange.
+const (
+	Added     ReportFileChange = "added"
+	Modified  ReportFileChange = "modified"
+	Unchanged ReportFileChange = "unchanged"
 )
 
 // Defines values for SnapshotType.
 const (
-	Borg   SnapshotType = "borg"
-	Git    SnapshotType = "git"
-	Restic SnapshotType = "restic"
-	Zfs    SnapshotType = "zfs"
+	Azure       SnapshotType = "azure"
+	B2          SnapshotType = "b2"
+	Borg        SnapshotType = "borg"
+	Gcs         SnapshotType = "gcs"
+	Git         SnapshotType = "git"
+	Restic      SnapshotType = "restic"
+	Timemachine SnapshotType = "timemachine"
+	Zfs         SnapshotType = "zfs"
+)
+
+// Defines values for TokenRuleAllow.
+const (
+	Read  TokenRuleAllow = "read"
+	Write TokenRuleAllow = "write"
+)
+
+// Defines values for GetNodesChildren.
+const (
+	GetNodesChildrenFalse     GetNodesChildren = "false"
+	GetNodesChildrenRecursive GetNodesChildren = "recursive"
+	GetNodesChildrenTrue      GetNodesChildren = "true"
+)
+
+// Defines values for GetNodesFormat.
+const (
+	GetNodesFormatHexdump GetNodesFormat = "hexdump"
+	GetNodesFormatTar     GetNodesFormat = "tar"
+	GetNodesFormatTarGz   GetNodesFormat = "tar.gz"
+	GetNodesFormatTarZst  GetNodesFormat = "tar.zst"
+	GetNodesFormatZip     GetNodesFormat = "zip"
 )
 
 // Defines values for GetNodesOrder.
@@ -43,6 +145,7 @@ const (
 const (
 	GetNodesSortModifiedAt GetNodesSort = "modified_at"
 	GetNodesSortName       GetNodesSort = "name"
+	GetNodesSortRelevance  GetNodesSort = "relevance"
 	GetNodesSortSize       GetNodesSort = "size"
 	GetNodesSortType       GetNodesSort = "type"
 )
@@ -60,10 +163,33 @@ const (
 	SnapshotsSortTimestamp SnapshotsSort = "timestamp"
 )
 
+// Defines values for GetRecentParamsKind.
+const (
+	GetRecentParamsKindBrowsed    GetRecentParamsKind = "browsed"
+	GetRecentParamsKindDownloaded GetRecentParamsKind = "downloaded"
+)
+
+// Defines values for GetStoragesStorageNodesParamsChildren.
+const (
+	GetStoragesStorageNodesParamsChildrenFalse     GetStoragesStorageNodesParamsChildren = "false"
+	GetStoragesStorageNodesParamsChildrenRecursive GetStoragesStorageNodesParamsChildren = "recursive"
+	GetStoragesStorageNodesParamsChildrenTrue      GetStoragesStorageNodesParamsChildren = "true"
+)
+
+// Defines values for GetStoragesStorageNodesParamsFormat.
+const (
+	GetStoragesStorageNodesParamsFormatHexdump GetStoragesStorageNodesParamsFormat = "hexdump"
+	GetStoragesStorageNodesParamsFormatTar     GetStoragesStorageNodesParamsFormat = "tar"
+	GetStoragesStorageNodesParamsFormatTarGz   GetStoragesStorageNodesParamsFormat = "tar.gz"
+	GetStoragesStorageNodesParamsFormatTarZst  GetStoragesStorageNodesParamsFormat = "tar.zst"
+	GetStoragesStorageNodesParamsFormatZip     GetStoragesStorageNodesParamsFormat = "zip"
+)
+
 // Defines values for GetStoragesStorageNodesParamsSort.
 const (
 	GetStoragesStorageNodesParamsSortModifiedAt GetStoragesStorageNodesParamsSort = "modified_at"
 	GetStoragesStorageNodesParamsSortName       GetStoragesStorageNodesParamsSort = "name"
+	GetStoragesStorageNodesParamsSortRelevance  GetStoragesStorageNodesParamsSort = "relevance"
 	GetStoragesStorageNodesParamsSortSize       GetStoragesStorageNodesParamsSort = "size"
 	GetStoragesStorageNodesParamsSortType       GetStoragesStorageNodesParamsSort = "type"
 )
@@ -74,10 +200,27 @@ const (
 	GetStoragesStorageNodesParamsOrderDesc GetStoragesStorageNodesParamsOrder = "desc"
 )
 
+// Defines values for GetStoragesStorageNodesPathParamsChildren.
+const (
+	False     GetStoragesStorageNodesPathParamsChildren = "false"
+	Recursive GetStoragesStorageNodesPathParamsChildren = "recursive"
+	True      GetStoragesStorageNodesPathParamsChildren = "true"
+)
+
+// Defines values for GetStoragesStorageNodesPathParamsFormat.
+const (
+	GetStoragesStorageNodesPathParamsFormatHexdump GetStoragesStorageNodesPathParamsFormat = "hexdump"
+	GetStoragesStorageNodesPathParamsFormatTar     GetStoragesStorageNodesPathParamsFormat = "tar"
+	GetStoragesStorageNodesPathParamsFormatTarGz   GetStoragesStorageNodesPathParamsFormat = "tar.gz"
+	GetStoragesStorageNodesPathParamsFormatTarZst  GetStoragesStorageNodesPathParamsFormat = "tar.zst"
+	GetStoragesStorageNodesPathParamsFormatZip     GetStoragesStorageNodesPathParamsFormat = "zip"
+)
+
 // Defines values for GetStoragesStorageNodesPathParamsSort.
 const (
 	GetStoragesStorageNodesPathParamsSortModifiedAt GetStoragesStorageNodesPathParamsSort = "modified_at"
 	GetStoragesStorageNodesPathParamsSortName       GetStoragesStorageNodesPathParamsSort = "name"
+	GetStoragesStorageNodesPathParamsSortRelevance  GetStoragesStorageNodesPathParamsSort = "relevance"
 	GetStoragesStorageNodesPathParamsSortSize       GetStoragesStorageNodesPathParamsSort = "size"
 	GetStoragesStorageNodesPathParamsSortType       GetStoragesStorageNodesPathParamsSort = "type"
 )
@@ -114,36 +257,568 @@ const (
 	GetStoragesStorageSnapshotsPathParamsOrderDesc GetStoragesStorageSnapshotsPathParamsOrder = "desc"
 )
 
+// ActivityEvent defines model for ActivityEvent.
+type ActivityEvent struct {
+	// Actor Name of the user that caused the event, missing without access control
+	Actor *string `json:"actor,omitempty"`
+
+	// CreatedAt When the event happened as a Unix timestamp
+	CreatedAt int64 `json:"created_at"`
+
+	// From Path a node was renamed from, or its path in the snapshot it was restored from
+	From *string `json:"from,omitempty"`
+
+	// Id ID of the event, newer events have higher IDs
+	Id int64 `json:"id"`
+
+	// Path Path of the node the event happened to
+	Path string `json:"path"`
+
+	// Snapshot ID of the snapshot a node was restored from
+	Snapshot *string `json:"snapshot,omitempty"`
+
+	// Text Text of a comment, or the name of the token a node was shared with
+	Text *string `json:"text,omitempty"`
+
+	// Type What happened. Restores and renames are recorded on the path the
+	// node ended up at, shares on the path the issued token grants
+	// access to.
+	Type ActivityEventType `json:"type"`
+}
+
+// ActivityEventType What happened. Restores and renames are recorded on the path the
+// node ended up at, shares on the path the issued token grants
+// access to.
+type ActivityEventType string
+
+// ActivityFeed defines model for ActivityFeed.
+type ActivityFeed struct {
+	// Before Pass as before to fetch the next page of older events, missing on the last page
+	Before *int64          `json:"before,omitempty"`
+	Events []ActivityEvent `json:"events"`
+}
+
+// Ancestor defines model for Ancestor.
+type Ancestor struct {
+	// Basename Base name of the directory, the storage name for the root
+	Basename string `json:"basename"`
+
+	// Exists Whether the directory exists in the listed snapshot or the current
+	// state, e.g. false if it was renamed since. Absent if the storage
+	// can't tell.
+	Exists *bool `json:"exists,omitempty"`
+
+	// Path Path relative to storage root, empty for the root
+	Path string `json:"path"`
+}
+
+// ArchiveFormat File format of a streamed archive. Tar archives also keep the owners
+// of files, for restoring them as root.
+type ArchiveFormat string
+
+// ArchiveVerification Result of comparing an archive with its manifest
+type ArchiveVerification struct {
+	// Archive Path of the archive relative to storage root
+	Archive string `json:"archive"`
+
+	// Changed Files whose size or checksum differ from the manifest
+	Changed []string `json:"changed"`
+
+	// Checked Number of files matching their size and checksum
+	Checked int `json:"checked"`
+
+	// Manifest Path of the manifest relative to storage root
+	Manifest string `json:"manifest"`
+
+	// Missing Files of the manifest missing from the archive
+	Missing []string `json:"missing"`
+
+	// Ok Whether the archive matches the manifest exactly and the signature isn't invalid
+	Ok bool `json:"ok"`
+
+	// Signature Whether the manifest signature matches the configured signing key.
+	// Signed manifests are unchecked if no signing key is configured.
+	Signature ArchiveVerificationSignature `json:"signature"`
+
+	// Unexpected Files of the archive missing from the manifest
+	Unexpected []string `json:"unexpected"`
+}
+
+// ArchiveVerificationSignature Whether the manifest signature matches the configured signing key.
+// Signed manifests are unchecked if no signing key is configured.
+type ArchiveVerificationSignature string
+
+// Bookmark defines model for Bookmark.
+type Bookmark struct {
+	// CreatedAt When the bookmark was created as a Unix timestamp
+	CreatedAt int64 `json:"created_at"`
+
+	// Id ID of the bookmark, used to delete it
+	Id string `json:"id"`
+
+	// Missing The node was deleted or can't be found anymore
+	Missing bool `json:"missing"`
+
+	// Name Name shown for the bookmark
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Storage string `json:"storage"`
+
+	// Type Type of the filesystem node. Symbolic links are reported as `link`
+	// if the storage doesn't follow them or their target can't be resolved.
+	// Sockets, FIFOs, device nodes and other non-regular files are reported
+	// as `special`, their content can't be read and they are skipped in
+	// archives.
+	Type *NodeType `json:"type,omitempty"`
+}
+
+// BookmarkList defines model for BookmarkList.
+type BookmarkList struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// CommentRequest defines model for CommentRequest.
+type CommentRequest struct {
+	// Text Text of the comment
+	Text string `json:"text"`
+}
+
+// ConfigBundle Portable export of a server. Tokens are exported with their hashes and
+// access rules, tags and bookmarks by path.
+type ConfigBundle struct {
+	Bookmarks *[]map[string]interface{} `json:"bookmarks,omitempty"`
+
+	// Config Effective configuration as YAML, including secrets
+	Config *string `json:"config,omitempty"`
+
+	// CreatedAt When the bundle was exported as a Unix timestamp
+	CreatedAt int64                     `json:"created_at"`
+	Tags      *[]map[string]interface{} `json:"tags,omitempty"`
+	Tokens    *[]map[string]interface{} `json:"tokens,omitempty"`
+
+	// Version Format version of the bundle
+	Version int `json:"version"`
+}
+
+// CopyItem defines model for CopyItem.
+type CopyItem struct {
+	// Path Path of a file or directory relative to the storage root
+	Path string `json:"path"`
+
+	// Snapshot Snapshot to copy the node from, the live storage if omitted
+	Snapshot *string `json:"snapshot,omitempty"`
+}
+
+// CopyItemResult defines model for CopyItemResult.
+type CopyItemResult struct {
+	Destination string               `json:"destination"`
+	Error       *string              `json:"error,omitempty"`
+	Snapshot    *string              `json:"snapshot,omitempty"`
+	Source      string               `json:"source"`
+	Status      CopyItemResultStatus `json:"status"`
+}
+
+// CopyItemResultStatus defines model for CopyItemResult.Status.
+type CopyItemResultStatus string
+
+// CopyRequest defines model for CopyRequest.
+type CopyRequest struct {
+	// Destination Directory to copy the items into
+	Destination string `json:"destination"`
+
+	// Items Files and directories to copy. Each item keeps its name in the
+	// destination. Items with a snapshot are restored from it.
+	Items []CopyItem `json:"items"`
+
+	// Preserve Keep the permissions and modification times of the copied nodes,
+	// and their owners when the server runs as root. Without it, copies
+	// get default permissions, the current time and the server's user.
+	Preserve *bool `json:"preserve,omitempty"`
+}
+
+// CopyResult defines model for CopyResult.
+type CopyResult struct {
+	// Copied Number of items copied
+	Copied      int              `json:"copied"`
+	Destination string           `json:"destination"`
+	Results     []CopyItemResult `json:"results"`
+}
+
+// CreateBookmarkRequest defines model for CreateBookmarkRequest.
+type CreateBookmarkRequest struct {
+	// Name Name shown for the bookmark, defaults to the name of the node
+	Name *string `json:"name,omitempty"`
+
+	// Path Path of the node, empty for the storage root
+	Path    string `json:"path"`
+	Storage string `json:"storage"`
+}
+
 // CreateNodeRequest defines model for CreateNodeRequest.
 type CreateNodeRequest struct {
 	// Content Initial content (only for files)
 	Content *string `json:"content,omitempty"`
 
-	// Name Name of the node to create
+	// Name Name of the node to create. May contain `/` separated segments,
+	// in which case missing intermediate directories are created
+	// (like `mkdir -p`).
 	Name string `json:"name"`
 
-	// Type Type of the filesystem node
+	// Type Type of the filesystem node. Symbolic links are reported as `link`
+	// if the storage doesn't follow them or their target can't be resolved.
+	// Sockets, FIFOs, device nodes and other non-regular files are reported
+	// as `special`, their content can't be read and they are skipped in
+	// archives.
 	Type NodeType `json:"type"`
 }
 
-// ErrorResponse defines model for ErrorResponse.
+// CreatePinRequest defines model for CreatePinRequest.
+type CreatePinRequest struct {
+	// Name Name of the pinned storage, following the rules of storage names as
+	// it's used as a URL scheme. Defaults to the storage name and the
+	// snapshot name joined by ".".
+	Name *string `json:"name,omitempty"`
+
+	// Snapshot Snapshot identifier
+	Snapshot string `json:"snapshot"`
+
+	// Storage Storage the snapshot belongs to
+	Storage string `json:"storage"`
+}
+
+// CreateSnapshotRequest defines model for CreateSnapshotRequest.
+type CreateSnapshotRequest struct {
+	// Name Snapshot name. Defaults to "timeship-" followed by the current
+	// date and time, which is parsed back as the snapshot timestamp.
+	Name *string `json:"name,omitempty"`
+}
+
+// CreateTokenRequest defines model for CreateTokenRequest.
+type CreateTokenRequest struct {
+	// ExpiresAt When the token expires as a Unix timestamp, never if missing
+	ExpiresAt *int64 `json:"expires_at,omitempty"`
+
+	// Name What the token is used for
+	Name string `json:"name"`
+
+	// Rules Permissions of the token, all of which the user must have
+	Rules []TokenRule `json:"rules"`
+}
+
+// CreatedToken defines model for CreatedToken.
+type CreatedToken struct {
+	// CreatedAt When the token was created as a Unix timestamp
+	CreatedAt int64 `json:"created_at"`
+
+	// ExpiresAt When the token expires as a Unix timestamp, missing if it never does
+	ExpiresAt *int64 `json:"expires_at,omitempty"`
+
+	// Id ID of the token, used to revoke it
+	Id string `json:"id"`
+
+	// Name What the token is used for
+	Name  string      `json:"name"`
+	Rules []TokenRule `json:"rules"`
+
+	// Token The token, only returned once
+	Token string `json:"token"`
+}
+
+// DownloadItem defines model for DownloadItem.
+type DownloadItem struct {
+	// Path Path of a file or directory relative to the storage root
+	Path string `json:"path"`
+
+	// Snapshot Snapshot to read the node from, the live storage if omitted
+	Snapshot *string `json:"snapshot,omitempty"`
+}
+
+// DownloadRequest defines model for DownloadRequest.
+type DownloadRequest struct {
+	// Format File format of a streamed archive. Tar archives also keep the owners
+	// of files, for restoring them as root.
+	Format *ArchiveFormat `json:"format,omitempty"`
+
+	// Items Files and directories to download. Directories are included with
+	// all their contents. Entries keep their paths relative to the
+	// closest directory containing all items. If items come from more
+	// than one source, each source gets a top-level directory named
+	// after its snapshot, or `current` for the live storage.
+	Items []DownloadItem `json:"items"`
+
+	// Name Archive name without extension (defaults to "download")
+	Name *string `json:"name,omitempty"`
+}
+
+// DrainStatus What a server shutting down waits for. New requests other than health
+// checks are rejected with 503 while draining.
+type DrainStatus struct {
+	// Deadline Unix timestamp when the server stops waiting and interrupts what's left
+	Deadline int64 `json:"deadline"`
+
+	// Jobs Running jobs
+	Jobs int64 `json:"jobs"`
+
+	// Requests Requests in flight, like downloads
+	Requests int64 `json:"requests"`
+
+	// Started Unix timestamp when draining started
+	Started int64 `json:"started"`
+}
+
+// ErrorResponse RFC 9457 problem details of a failed request
 type ErrorResponse struct {
-	// Message Human-readable error message
-	Message string `json:"message"`
+	// Code Machine-readable error code for clients to branch on, e.g.
+	// `storage_not_found`, `snapshot_not_found`, `node_not_found`,
+	// `path_outside_root`, `invalid_path`, `already_exists`,
+	// `directory_not_empty`, `permission_denied`, `not_supported`
+	// (the storage lacks the capability), `feature_disabled` (the
+	// server isn't configured for it), `not_implemented`,
+	// `bad_request`, `forbidden` or `internal_server_error`
+	Code string `json:"code"`
+
+	// Detail Human-readable explanation of this occurrence of the problem
+	Detail *string `json:"detail,omitempty"`
+
+	// Instance Path of the request that failed
+	Instance *string `json:"instance,omitempty"`
+
+	// Status HTTP status code of the response
+	Status int `json:"status"`
+
+	// Title Short human-readable summary of the kind of problem
+	Title string `json:"title"`
+
+	// Type URI identifying the kind of problem, derived from the code
+	Type string `json:"type"`
+}
+
+// ExportRequest Export a directory, typically of a snapshot, to another storage.
+// Patterns use Go path.Match syntax: patterns without a slash match
+// the name of files and directories at any depth, patterns with a
+// slash match the path relative to the exported directory.
+type ExportRequest struct {
+	// Destination Directory of the destination storage to export to, its root if omitted
+	Destination *string `json:"destination,omitempty"`
+
+	// DestinationStorage Name of the storage to export to
+	DestinationStorage string `json:"destination_storage"`
+
+	// Exclude Skip files and directories matching any of the patterns
+	Exclude *[]string `json:"exclude,omitempty"`
+
+	// Include Export only files matching any of the patterns
+	Include *[]string `json:"include,omitempty"`
+
+	// Path Directory to export, the storage root if omitted
+	Path *string `json:"path,omitempty"`
+
+	// Snapshot Snapshot to export the directory from, the live storage if omitted
+	Snapshot *string `json:"snapshot,omitempty"`
+}
+
+// HealthStatus defines model for HealthStatus.
+type HealthStatus struct {
+	// Drain What a server shutting down waits for. New requests other than health
+	// checks are rejected with 503 while draining.
+	Drain *DrainStatus `json:"drain,omitempty"`
+
+	// Snapshots Snapshot freshness of the storages with a maximum snapshot age,
+	// sorted by storage name. Omitted if no storage is monitored.
+	Snapshots *[]SnapshotFreshness `json:"snapshots,omitempty"`
+
+	// Status stale if a monitored storage has no recent snapshot, draining
+	// while the server shuts down
+	Status HealthStatusStatus `json:"status"`
+}
+
+// HealthStatusStatus stale if a monitored storage has no recent snapshot, draining
+// while the server shuts down
+type HealthStatusStatus string
+
+// ImageMetadata Dimensions and EXIF metadata of an image (only present with
+// fields=(exif) for JPEG, TIFF, PNG and GIF files with readable
+// metadata). Fields are omitted if unknown.
+type ImageMetadata struct {
+	CameraMake  *string `json:"camera_make,omitempty"`
+	CameraModel *string `json:"camera_model,omitempty"`
+
+	// DateTaken Local time of the camera when the photo was taken, without a time
+	// zone as EXIF doesn't record one. Sorts chronologically as a string.
+	DateTaken *string `json:"date_taken,omitempty"`
+
+	// Height Height in pixels as displayed, with the orientation applied
+	Height *int `json:"height,omitempty"`
+
+	// Latitude GPS latitude in degrees, negative in the south
+	Latitude *float64 `json:"latitude,omitempty"`
+
+	// Longitude GPS longitude in degrees, negative in the west
+	Longitude *float64 `json:"longitude,omitempty"`
+
+	// Orientation EXIF orientation
+	Orientation *int `json:"orientation,omitempty"`
+
+	// Width Width in pixels as displayed, with the orientation applied
+	Width *int `json:"width,omitempty"`
+}
+
+// ImportResult Numbers of records imported from a bundle, without those that already existed
+type ImportResult struct {
+	Bookmarks int `json:"bookmarks"`
+	Tags      int `json:"tags"`
+	Tokens    int `json:"tokens"`
+}
+
+// IndexStatus Indexing of the snapshot metadata of a storage into the metadata
+// cache. Indexed snapshots answer snapshot summaries of directory
+// listings without listing every snapshot.
+type IndexStatus struct {
+	// Current ID of the snapshot being indexed, absent if idle
+	Current *string `json:"current,omitempty"`
+
+	// Indexed Number of indexed snapshots
+	Indexed int `json:"indexed"`
+
+	// LastError Why the last snapshot failed to index, absent if it succeeded
+	LastError *string `json:"last_error,omitempty"`
+
+	// LastIndexed Unix timestamp of when the last snapshot was indexed, absent if
+	// none was indexed since the server started
+	LastIndexed *int64 `json:"last_indexed,omitempty"`
+
+	// NextRun Unix timestamp of the next scheduled run indexing all snapshots,
+	// absent if no schedule is configured
+	NextRun *int64 `json:"next_run,omitempty"`
+
+	// Nodes Number of nodes in all indexed snapshots
+	Nodes int64 `json:"nodes"`
+
+	// Paused Whether indexing is paused
+	Paused bool `json:"paused"`
+
+	// Queued Number of snapshots waiting to be indexed
+	Queued  int    `json:"queued"`
+	Storage string `json:"storage"`
+}
+
+// Job A long operation running in the background
+type Job struct {
+	// Bytes Number of bytes processed so far
+	Bytes int64 `json:"bytes"`
+
+	// Error Why the job failed
+	Error *string `json:"error,omitempty"`
+
+	// Files Number of files processed so far
+	Files int64 `json:"files"`
+
+	// Finished Unix timestamp when the job finished (only for finished jobs)
+	Finished *int64 `json:"finished,omitempty"`
+	Id       string `json:"id"`
+
+	// Message The current step, or the outcome once finished
+	Message *string `json:"message,omitempty"`
+
+	// Params What the job does, e.g. its source and destination
+	Params map[string]string `json:"params"`
+
+	// Started Unix timestamp when the job started
+	Started int64 `json:"started"`
+
+	// State interrupted if the server shut down while the job ran
+	State JobState `json:"state"`
+
+	// Type What kind of job it is: `export`, `restore` for restores from
+	// snapshots, which are only recorded once done, or the action of a
+	// scheduled job, `index`, `reindex`, `prune-trash` or
+	// `retention-report`
+	Type string `json:"type"`
+
+	// User User who started the job (only with access control)
+	User *string `json:"user,omitempty"`
+}
+
+// JobState interrupted if the server shut down while the job ran
+type JobState string
+
+// JobHistory defines model for JobHistory.
+type JobHistory struct {
+	// Before Pass as before to fetch the next page of older jobs, missing on the last page
+	Before *string `json:"before,omitempty"`
+	Jobs   []Job   `json:"jobs"`
+}
 
-	// Status Always false for error responses
-	Status ErrorResponseStatus `json:"status"`
+// JobList defines model for JobList.
+type JobList struct {
+	Jobs []Job `json:"jobs"`
 }
 
-// ErrorResponseStatus Always false for error responses
-type ErrorResponseStatus bool
+// Manifest Integrity manifest listing all files below a path with their checksums.
+// When a signing key is configured, the manifest is signed with Ed25519.
+// The signature covers the whole manifest except the signature, encoded
+// as compact JSON with the keys storage, path, snapshot (if any),
+// created, files (each with path, size and sha256, sorted by path),
+// algorithm and public_key in this order, without HTML escaping.
+type Manifest struct {
+	// Algorithm Signature algorithm (only present for signed manifests)
+	Algorithm *ManifestAlgorithm `json:"algorithm,omitempty"`
+
+	// Created Unix timestamp when the manifest was built
+	Created int64          `json:"created"`
+	Files   []ManifestFile `json:"files"`
+
+	// Path Manifest root path relative to storage root
+	Path string `json:"path"`
+
+	// PublicKey Base64 encoded public key of the signer
+	PublicKey *string `json:"public_key,omitempty"`
+
+	// Signature Base64 encoded signature of the canonical encoding of the manifest
+	Signature *string `json:"signature,omitempty"`
+
+	// Snapshot Snapshot the manifest was built from (if any)
+	Snapshot *string `json:"snapshot,omitempty"`
+	Storage  string  `json:"storage"`
+}
+
+// ManifestAlgorithm Signature algorithm (only present for signed manifests)
+type ManifestAlgorithm string
+
+// ManifestFile defines model for ManifestFile.
+type ManifestFile struct {
+	// Path Path relative to the manifest root
+	Path string `json:"path"`
+
+	// Sha256 Hex encoded SHA-256 checksum of the file content
+	Sha256 string `json:"sha256"`
+
+	// Size Size in bytes
+	Size int64 `json:"size"`
+}
 
 // Node Unified representation of any filesystem object (file or directory).
 // Path is relative to the storage root.
 type Node struct {
+	// AllocatedSize Bytes the file takes up on disk, less than file_size for sparse
+	// files (only present in listings of storages that know it)
+	AllocatedSize *int64 `json:"allocated_size,omitempty"`
+
 	// Basename Base name of the node
 	Basename string `json:"basename"`
 
+	// Changed Unix timestamp of the last change of the content or metadata
+	// (ctime), only present with fields=(times) on storages that know it
+	Changed *int64 `json:"changed,omitempty"`
+
+	// Children Children of a directory (only present with children=recursive for
+	// directories that were expanded within the depth)
+	Children *[]Node `json:"children,omitempty"`
+
+	// Created Unix timestamp of creation (birth time), only present with
+	// fields=(times) on file systems that record it
+	Created *int64 `json:"created,omitempty"`
+
 	// Dir Parent directory path relative to storage root (only present in search results)
 	Dir *string `json:"dir,omitempty"`
 
@@ -153,16 +828,50 @@ type Node struct {
 	// FileSize Size in bytes (0 for directories)
 	FileSize int64 `json:"file_size"`
 
+	// Group Owner group name, or numeric group ID if it can't be resolved
+	// (only present with fields=(permissions))
+	Group *string `json:"group,omitempty"`
+
+	// Image Dimensions and EXIF metadata of an image (only present with
+	// fields=(exif) for JPEG, TIFF, PNG and GIF files with readable
+	// metadata). Fields are omitted if unknown.
+	Image *ImageMetadata `json:"image,omitempty"`
+
 	// LastModified Unix timestamp of last modification
 	LastModified int64 `json:"last_modified"`
 
+	// LinkTarget Target of a symbolic link (always present for `link` nodes,
+	// for followed links only with fields=(permissions))
+	LinkTarget *string `json:"link_target,omitempty"`
+
 	// MimeType MIME type (only present for files when detection succeeds)
 	MimeType *string `json:"mime_type,omitempty"`
 
+	// Mode Unix permission bits in octal (only present with fields=(permissions))
+	Mode *string `json:"mode,omitempty"`
+
+	// NewestSnapshot Unix timestamp of the newest snapshot containing the node
+	// (only present with fields=(snapshots) if the node is in any snapshot)
+	NewestSnapshot *int64 `json:"newest_snapshot,omitempty"`
+
+	// Owner Owner user name, or numeric user ID if it can't be resolved
+	// (only present with fields=(permissions))
+	Owner *string `json:"owner,omitempty"`
+
+	// PageCount Number of pages of a PDF (only present with fields=(pages) if it can be read)
+	PageCount *int `json:"page_count,omitempty"`
+
 	// Path Path relative to storage root
 	Path string `json:"path"`
 
-	// Type Type of the filesystem node
+	// SnapshotCount Number of snapshots containing the node (only present with fields=(snapshots))
+	SnapshotCount *int `json:"snapshot_count,omitempty"`
+
+	// Type Type of the filesystem node. Symbolic links are reported as `link`
+	// if the storage doesn't follow them or their target can't be resolved.
+	// Sockets, FIFOs, device nodes and other non-regular files are reported
+	// as `special`, their content can't be read and they are skipped in
+	// archives.
 	Type NodeType `json:"type"`
 
 	// Url Public URL for the file (present when URL resolver is configured, null otherwise)
@@ -171,6 +880,14 @@ type Node struct {
 
 // NodeList Response containing list of nodes.
 type NodeList struct {
+	// Ancestors Directories leading to the current directory for breadcrumbs,
+	// from the storage root to the parent, empty for the root
+	Ancestors *[]Ancestor `json:"ancestors,omitempty"`
+
+	// Cursor Cursor to fetch the next page of search results with, absent when
+	// the search is complete
+	Cursor *string `json:"cursor,omitempty"`
+
 	// Dirname Current directory path relative to storage root
 	Dirname string `json:"dirname"`
 
@@ -183,10 +900,21 @@ type NodeList struct {
 	// Storages Available storage identifiers
 	Storages []string `json:"storages"`
 
+	// TotalAllocatedSize Total bytes the files counted by total_size take up on disk, less
+	// than total_size if there are sparse files. Only included with
+	// total_size if the storage knows it.
+	TotalAllocatedSize *int64 `json:"total_allocated_size,omitempty"`
+
 	// TotalSize Total size in bytes of all files in this directory and subdirectories.
 	// Only included when requested via fields=(total_size) query parameter.
 	// Computed using parallel directory traversal for optimal performance.
+	// Files with several hard links in the tree are counted once.
 	TotalSize *int64 `json:"total_size,omitempty"`
+
+	// Truncated Whether a recursive listing stopped expanding subdirectories
+	// because it got too large, or a sorted search found more results
+	// than it ranks, absent otherwise
+	Truncated *bool `json:"truncated,omitempty"`
 }
 
 // NodeSnapshotsList Response for snapshots endpoint.
@@ -205,35 +933,441 @@ type NodeSnapshotsList struct {
 	Storage string `json:"storage"`
 }
 
-// NodeType Type of the filesystem node
+// NodeTags Tags the user put on a node
+type NodeTags struct {
+	Tags []string `json:"tags"`
+}
+
+// NodeType Type of the filesystem node. Symbolic links are reported as `link`
+// if the storage doesn't follow them or their target can't be resolved.
+// Sockets, FIFOs, device nodes and other non-regular files are reported
+// as `special`, their content can't be read and they are skipped in
+// archives.
 type NodeType string
 
-// Snapshot Point-in-time snapshot of a file or directory.
-// Snapshot ID format: "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28")
-type Snapshot struct {
-	// Id Unique identifier for this snapshot in format "type:backend-id"
-	// Used in snapshot-nodes endpoint to reference this snapshot
-	Id string `json:"id"`
+// Pin A snapshot pinned as a virtual read-only storage. The pinned storage
+// is listed with the other storages and serves the snapshot contents
+// through the regular nodes endpoints.
+type Pin struct {
+	// Name Name of the pinned storage
+	Name string `json:"name"`
 
-	// Metadata Backend-specific metadata
-	Metadata *map[string]interface{} `json:"metadata,omitempty"`
+	// Snapshot Point-in-time snapshot of a file or directory.
+	// Snapshot ID format: "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28")
+	Snapshot Snapshot `json:"snapshot"`
 
-	// Name Human-readable name/label for snapshot
-	Name *string `json:"name,omitempty"`
+	// Storage Storage the snapshot belongs to
+	Storage string `json:"storage"`
+}
 
-	// Size Size of the node in this snapshot (file size or directory size)
-	Size *int64 `json:"size,omitempty"`
+// PinList defines model for PinList.
+type PinList struct {
+	Pins []Pin `json:"pins"`
+}
 
-	// Timestamp Unix timestamp when snapshot was created
-	Timestamp int64 `json:"timestamp"`
+// ReadinessReport defines model for ReadinessReport.
+type ReadinessReport struct {
+	// Status ok if all storages are ready, draining while the server shuts down
+	Status ReadinessReportStatus `json:"status"`
 
-	// Type Snapshot backend type
-	Type SnapshotType `json:"type"`
+	// Storages Readiness of each storage, sorted by name
+	Storages []StorageReadiness `json:"storages"`
+}
+
+// ReadinessReportStatus ok if all storages are ready, draining while the server shuts down
+type ReadinessReportStatus string
+
+// RecentEntry defines model for RecentEntry.
+type RecentEntry struct {
+	// AccessedAt When the path was last accessed as a Unix timestamp
+	AccessedAt int64 `json:"accessed_at"`
+
+	// Kind Whether a directory was browsed or a file downloaded
+	Kind RecentEntryKind `json:"kind"`
+	Path string          `json:"path"`
+
+	// Snapshot Snapshot the path was accessed in, missing for the current state
+	Snapshot *string `json:"snapshot,omitempty"`
+	Storage  string  `json:"storage"`
+}
+
+// RecentEntryKind Whether a directory was browsed or a file downloaded
+type RecentEntryKind string
+
+// RecentList defines model for RecentList.
+type RecentList struct {
+	Entries []RecentEntry `json:"entries"`
+}
+
+// ReportFile A file found by a report. Reports are streamed as newline-delimited
+// JSON, one file per line.
+type ReportFile struct {
+	// Change How the file differs from the latest snapshot, only present when
+	// comparing. Files are unchanged if their size and modification time
+	// match the snapshot.
+	Change *ReportFileChange `json:"change,omitempty"`
+
+	// LastModified Unix timestamp of the last modification
+	LastModified int64 `json:"last_modified"`
+
+	// Path Path of the file relative to the storage root
+	Path string `json:"path"`
+
+	// PreviousLastModified Modification time of the file in the snapshot, absent if added
+	PreviousLastModified *int64 `json:"previous_last_modified,omitempty"`
+
+	// PreviousSize Size of the file in the snapshot, absent if added
+	PreviousSize *int64 `json:"previous_size,omitempty"`
+	Size         int64  `json:"size"`
+
+	// Snapshot ID of the snapshot the file was compared against
+	Snapshot *string `json:"snapshot,omitempty"`
+}
+
+// ReportFileChange How the file differs from the latest snapshot, only present when
+// comparing. Files are unchanged if their size and modification time
+// match the snapshot.
+type ReportFileChange string
+
+// RetentionBuckets Snapshots grouped into a calendar granularity. Only periods with at
+// least one snapshot are listed, newest first.
+type RetentionBuckets struct {
+	// Covered Number of distinct periods with at least one snapshot
+	Covered int               `json:"covered"`
+	Periods []RetentionPeriod `json:"periods"`
+}
+
+// RetentionGap Interval between two consecutive snapshots longer than the maximum gap
+type RetentionGap struct {
+	// Duration Length of the gap in seconds
+	Duration int64 `json:"duration"`
+
+	// End Unix timestamp of the snapshot after the gap
+	End int64 `json:"end"`
+
+	// Start Unix timestamp of the snapshot before the gap
+	Start int64 `json:"start"`
+}
+
+// RetentionPeriod A calendar period containing at least one snapshot
+type RetentionPeriod struct {
+	// Count Number of snapshots in the period
+	Count int `json:"count"`
+
+	// Start Unix timestamp of the start of the period
+	Start int64 `json:"start"`
+}
+
+// RetentionReport Snapshot coverage of a storage, for verifying that a snapshot policy
+// (e.g. sanoid or zfs-auto-snapshot) produces the expected retention.
+// Periods are calendar periods in the server time zone, weeks start on Monday.
+type RetentionReport struct {
+	// Daily Snapshots grouped into a calendar granularity. Only periods with at
+	// least one snapshot are listed, newest first.
+	Daily RetentionBuckets `json:"daily"`
+
+	// Gaps Gaps longer than the maximum gap, newest first
+	Gaps []RetentionGap `json:"gaps"`
+
+	// Hourly Snapshots grouped into a calendar granularity. Only periods with at
+	// least one snapshot are listed, newest first.
+	Hourly RetentionBuckets `json:"hourly"`
+
+	// Monthly Snapshots grouped into a calendar granularity. Only periods with at
+	// least one snapshot are listed, newest first.
+	Monthly RetentionBuckets `json:"monthly"`
+
+	// Newest Unix timestamp of the newest snapshot, absent if there are none
+	Newest *int64 `json:"newest,omitempty"`
+
+	// Oldest Unix timestamp of the oldest snapshot, absent if there are none
+	Oldest  *int64 `json:"oldest,omitempty"`
+	Storage string `json:"storage"`
+
+	// Total Total number of snapshots
+	Total int `json:"total"`
+
+	// Weekly Snapshots grouped into a calendar granularity. Only periods with at
+	// least one snapshot are listed, newest first.
+	Weekly RetentionBuckets `json:"weekly"`
+}
+
+// Schedule A job started whenever its schedule matches
+type Schedule struct {
+	// Action What the job does: `index` indexes new snapshots into the
+	// metadata cache, `reindex` rebuilds the index, `export` exports a
+	// directory to another storage, `prune-trash` purges old trash
+	// items and `retention-report` reports gaps between snapshots
+	Action string `json:"action"`
+
+	// Last A long operation running in the background
+	Last *Job   `json:"last,omitempty"`
+	Name string `json:"name"`
+
+	// Next Unix timestamp when the job starts next (absent if the schedule never matches)
+	Next *int64 `json:"next,omitempty"`
+
+	// Params Configured parameters of the action
+	Params map[string]string `json:"params"`
+
+	// Schedule Cron expression of when the job starts
+	Schedule string `json:"schedule"`
+}
+
+// ScheduleList defines model for ScheduleList.
+type ScheduleList struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Snapshot Point-in-time snapshot of a file or directory.
+// Snapshot ID format: "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28")
+type Snapshot struct {
+	// Id Unique identifier for this snapshot in format "type:backend-id"
+	// Used in snapshot-nodes endpoint to reference this snapshot
+	Id string `json:"id"`
+
+	// Metadata Backend-specific metadata. Snapshots that record the node being
+	// deleted, like B2 hide markers, have `deleted: true` and no content.
+	Metadata *map[string]interface{} `json:"metadata,omitempty"`
+
+	// Name Human-readable name/label for snapshot
+	Name *string `json:"name,omitempty"`
+
+	// Size Size of the node in this snapshot (file size or directory size)
+	Size *int64 `json:"size,omitempty"`
+
+	// Timestamp Unix timestamp when snapshot was created
+	Timestamp int64 `json:"timestamp"`
+
+	// Type Snapshot backend type
+	Type SnapshotType `json:"type"`
+}
+
+// SnapshotFreshness defines model for SnapshotFreshness.
+type SnapshotFreshness struct {
+	// Checked Unix timestamp of the last check, omitted until the first check
+	Checked *int64 `json:"checked,omitempty"`
+
+	// Error Why the snapshots couldn't be listed
+	Error *string `json:"error,omitempty"`
+
+	// MaxAgeSeconds How old the newest snapshot may be
+	MaxAgeSeconds int64 `json:"max_age_seconds"`
+
+	// Newest Unix timestamp of the newest snapshot, omitted without snapshots
+	Newest *int64 `json:"newest,omitempty"`
+
+	// Stale Whether the newest snapshot is missing or older than the maximum age
+	Stale   bool   `json:"stale"`
+	Storage string `json:"storage"`
+}
+
+// SnapshotSpaceReport Space held by the snapshots of a storage, sizes in bytes
+type SnapshotSpaceReport struct {
+	// Dataset Dataset the snapshots are of
+	Dataset string `json:"dataset"`
+
+	// Shared Data held by several snapshots, freed only once all of them are destroyed
+	Shared int64 `json:"shared"`
+
+	// Snapshots Snapshots holding the most unique data first, newest first if equal
+	Snapshots []SnapshotSpaceUsage `json:"snapshots"`
+	Storage   string               `json:"storage"`
+
+	// Total Number of snapshots, including those left out by the limit
+	Total int `json:"total"`
+
+	// Unique Sum of the data held by single snapshots
+	Unique int64 `json:"unique"`
+
+	// Used Space freed if all snapshots were destroyed
+	Used int64 `json:"used"`
+}
+
+// SnapshotSpaceUsage defines model for SnapshotSpaceUsage.
+type SnapshotSpaceUsage struct {
+	// Id Snapshot identifier, e.g. for destroying it
+	Id   string `json:"id"`
+	Name string `json:"name"`
+
+	// Referenced Data the snapshot shows, shared or not
+	Referenced int64 `json:"referenced"`
+
+	// Timestamp Unix timestamp of the snapshot
+	Timestamp int64 `json:"timestamp"`
+
+	// Used Data only this snapshot holds, freed by destroying it
+	Used int64 `json:"used"`
+
+	// Written Data written between the previous snapshot and this one
+	Written int64 `json:"written"`
 }
 
 // SnapshotType Snapshot backend type
 type SnapshotType string
 
+// StatItemResult defines model for StatItemResult.
+type StatItemResult struct {
+	// Code Machine-readable error code like in ErrorResponse, e.g.
+	// `node_not_found` or `forbidden`, omitted on success
+	Code *string `json:"code,omitempty"`
+
+	// Error Why the node couldn't be looked up, omitted on success
+	Error *string `json:"error,omitempty"`
+
+	// Node Unified representation of any filesystem object (file or directory).
+	// Path is relative to the storage root.
+	Node *Node `json:"node,omitempty"`
+
+	// Path Requested path, cleaned
+	Path string `json:"path"`
+}
+
+// StatRequest defines model for StatRequest.
+type StatRequest struct {
+	// Fields Optional fields to include: `(permissions)` for the mode, owner
+	// and group and `(times)` for the creation and change times, as in
+	// directory listings
+	Fields *string `json:"fields,omitempty"`
+
+	// Paths Paths of files and directories relative to the storage root
+	Paths []string `json:"paths"`
+
+	// Snapshot Snapshot to look the nodes up in, the live storage if omitted
+	Snapshot *string `json:"snapshot,omitempty"`
+}
+
+// StatResult defines model for StatResult.
+type StatResult struct {
+	// Results One result per requested path, in the order of the request
+	Results []StatItemResult `json:"results"`
+}
+
+// StorageEvent A storage was added or removed, e.g. a drive was plugged in
+type StorageEvent struct {
+	// Event storage.added or storage.removed
+	Event string `json:"event"`
+
+	// Storage Name of the storage
+	Storage string `json:"storage"`
+
+	// Time When the storage was added or removed
+	Time time.Time `json:"time"`
+}
+
+// StorageReadiness defines model for StorageReadiness.
+type StorageReadiness struct {
+	// DurationMs How long the check took in milliseconds
+	DurationMs int64 `json:"duration_ms"`
+
+	// Error Why the storage is not ready
+	Error *string `json:"error,omitempty"`
+	Name  string  `json:"name"`
+	Ready bool    `json:"ready"`
+}
+
+// TagList defines model for TagList.
+type TagList struct {
+	Tags []TagSummary `json:"tags"`
+}
+
+// TagRequest defines model for TagRequest.
+type TagRequest struct {
+	// Tag Tag without slashes, control characters or surrounding spaces
+	Tag string `json:"tag"`
+}
+
+// TagSummary defines model for TagSummary.
+type TagSummary struct {
+	// Count Number of nodes with the tag
+	Count int    `json:"count"`
+	Tag   string `json:"tag"`
+}
+
+// TaggedNode A tagged or bookmarked node. Nodes renamed outside of Timeship are
+// found again in the same directory if the storage can tell, e.g. by
+// their inode on local storages, otherwise they're missing.
+type TaggedNode struct {
+	// Missing The node was deleted or can't be found anymore
+	Missing bool   `json:"missing"`
+	Path    string `json:"path"`
+	Storage string `json:"storage"`
+
+	// Type Type of the filesystem node. Symbolic links are reported as `link`
+	// if the storage doesn't follow them or their target can't be resolved.
+	// Sockets, FIFOs, device nodes and other non-regular files are reported
+	// as `special`, their content can't be read and they are skipped in
+	// archives.
+	Type *NodeType `json:"type,omitempty"`
+}
+
+// TaggedNodeList defines model for TaggedNodeList.
+type TaggedNodeList struct {
+	Nodes []TaggedNode `json:"nodes"`
+	Tag   string       `json:"tag"`
+}
+
+// Token An API token, without the token itself
+type Token struct {
+	// CreatedAt When the token was created as a Unix timestamp
+	CreatedAt int64 `json:"created_at"`
+
+	// ExpiresAt When the token expires as a Unix timestamp, missing if it never does
+	ExpiresAt *int64 `json:"expires_at,omitempty"`
+
+	// Id ID of the token, used to revoke it
+	Id string `json:"id"`
+
+	// Name What the token is used for
+	Name  string      `json:"name"`
+	Rules []TokenRule `json:"rules"`
+}
+
+// TokenList defines model for TokenList.
+type TokenList struct {
+	Tokens []Token `json:"tokens"`
+}
+
+// TokenRule Permissions on a path and everything below it
+type TokenRule struct {
+	Allow []TokenRuleAllow `json:"allow"`
+
+	// Path Storage and path prefix, "*" as the storage matches all storages
+	Path string `json:"path"`
+}
+
+// TokenRuleAllow defines model for TokenRule.Allow.
+type TokenRuleAllow string
+
+// TrashItem A deleted node kept in the storage trash
+type TrashItem struct {
+	// DeletedAt Unix timestamp when the node was deleted
+	DeletedAt int64 `json:"deleted_at"`
+
+	// FileSize Size in bytes (0 for directories)
+	FileSize int64 `json:"file_size"`
+
+	// Id Identifier of the item within the storage trash
+	Id string `json:"id"`
+
+	// Path Original path relative to storage root
+	Path string `json:"path"`
+
+	// Type Type of the filesystem node. Symbolic links are reported as `link`
+	// if the storage doesn't follow them or their target can't be resolved.
+	// Sockets, FIFOs, device nodes and other non-regular files are reported
+	// as `special`, their content can't be read and they are skipped in
+	// archives.
+	Type NodeType `json:"type"`
+}
+
+// TrashList defines model for TrashList.
+type TrashList struct {
+	// Items Trashed items, most recently deleted first
+	Items   []TrashItem `json:"items"`
+	Storage string      `json:"storage"`
+}
+
 // UpdateNodeRequest defines model for UpdateNodeRequest.
 type UpdateNodeRequest struct {
 	// Content Updated content (only for files)
@@ -243,11 +1377,108 @@ type UpdateNodeRequest struct {
 	Name *string `json:"name,omitempty"`
 }
 
+// VersionInfo defines model for VersionInfo.
+type VersionInfo struct {
+	BuiltBy string `json:"built_by"`
+	Commit  string `json:"commit"`
+
+	// Date Build date
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	Version   string `json:"version"`
+}
+
+// ZFSDataset Properties of the dataset containing the storage root, sizes in bytes
+type ZFSDataset struct {
+	// Available Space available to the dataset
+	Available int64 `json:"available"`
+
+	// CompressRatio Compression ratio achieved for the used space
+	CompressRatio float64 `json:"compress_ratio"`
+
+	// Compression Compression algorithm, e.g. lz4 or off
+	Compression string `json:"compression"`
+	Name        string `json:"name"`
+
+	// Referenced Space referenced by the current state of the dataset
+	Referenced int64 `json:"referenced"`
+
+	// Used Space used by the dataset and its descendants
+	Used int64 `json:"used"`
+
+	// UsedBySnapshots Space freed if all snapshots of the dataset were destroyed
+	UsedBySnapshots int64 `json:"used_by_snapshots"`
+}
+
+// ZFSDevice defines model for ZFSDevice.
+type ZFSDevice struct {
+	ChecksumErrors int64 `json:"checksum_errors"`
+
+	// Depth Nesting of the device, 0 for the pool, 1 for its top-level devices
+	Depth      int    `json:"depth"`
+	Name       string `json:"name"`
+	ReadErrors int64  `json:"read_errors"`
+
+	// State State of the device, absent for groups like logs or spares
+	State       *string `json:"state,omitempty"`
+	WriteErrors int64   `json:"write_errors"`
+}
+
+// ZFSHealth Health of the ZFS pool and dataset backing a storage
+type ZFSHealth struct {
+	// Dataset Properties of the dataset containing the storage root, sizes in bytes
+	Dataset ZFSDataset `json:"dataset"`
+
+	// Pool Status of a ZFS pool as reported by zpool status
+	Pool    ZFSPool `json:"pool"`
+	Storage string  `json:"storage"`
+}
+
+// ZFSPool Status of a ZFS pool as reported by zpool status
+type ZFSPool struct {
+	// Action How to fix the problem, absent if healthy
+	Action *string `json:"action,omitempty"`
+
+	// Devices The pool and its devices in the order of zpool status
+	Devices []ZFSDevice `json:"devices"`
+
+	// Errors Summary of data errors
+	Errors *string `json:"errors,omitempty"`
+
+	// LastScrub Unix timestamp the last scrub finished, absent if unknown
+	LastScrub *int64 `json:"last_scrub,omitempty"`
+	Name      string `json:"name"`
+
+	// Scan Last or running scrub or resilver as described by zpool status
+	Scan *string `json:"scan,omitempty"`
+
+	// State Health of the pool, e.g. ONLINE, DEGRADED or FAULTED
+	State string `json:"state"`
+
+	// Status Explanation of a problem with the pool, absent if healthy
+	Status *string `json:"status,omitempty"`
+}
+
+// ActivityBefore defines model for activityBefore.
+type ActivityBefore = int64
+
+// ActivityLimit defines model for activityLimit.
+type ActivityLimit = int
+
 // DeleteNodesRecursive defines model for deleteNodesRecursive.
 type DeleteNodesRecursive = bool
 
+// GetNodesBytes defines model for getNodesBytes.
+type GetNodesBytes = string
+
 // GetNodesChildren defines model for getNodesChildren.
-type GetNodesChildren = bool
+type GetNodesChildren string
+
+// GetNodesCursor defines model for getNodesCursor.
+type GetNodesCursor = string
+
+// GetNodesDepth defines model for getNodesDepth.
+type GetNodesDepth = int
 
 // GetNodesDownload defines model for getNodesDownload.
 type GetNodesDownload = bool
@@ -258,6 +1489,30 @@ type GetNodesFields = string
 // GetNodesFilter defines model for getNodesFilter.
 type GetNodesFilter = string
 
+// GetNodesFollow defines model for getNodesFollow.
+type GetNodesFollow = bool
+
+// GetNodesFormat defines model for getNodesFormat.
+type GetNodesFormat string
+
+// GetNodesHidden defines model for getNodesHidden.
+type GetNodesHidden = bool
+
+// GetNodesInline defines model for getNodesInline.
+type GetNodesInline = bool
+
+// GetNodesLength defines model for getNodesLength.
+type GetNodesLength = int64
+
+// GetNodesLimit defines model for getNodesLimit.
+type GetNodesLimit = int
+
+// GetNodesLines defines model for getNodesLines.
+type GetNodesLines = string
+
+// GetNodesOffset defines model for getNodesOffset.
+type GetNodesOffset = int64
+
 // GetNodesOrder defines model for getNodesOrder.
 type GetNodesOrder string
 
@@ -270,12 +1525,28 @@ type GetNodesSnapshot = string
 // GetNodesSort defines model for getNodesSort.
 type GetNodesSort string
 
-// GetNodesType Type of the filesystem node
+// GetNodesType Type of the filesystem node. Symbolic links are reported as `link`
+// if the storage doesn't follow them or their target can't be resolved.
+// Sockets, FIFOs, device nodes and other non-regular files are reported
+// as `special`, their content can't be read and they are skipped in
+// archives.
 type GetNodesType = NodeType
 
 // NodePath defines model for nodePath.
 type NodePath = string
 
+// PatchNodesIfMatch defines model for patchNodesIfMatch.
+type PatchNodesIfMatch = string
+
+// PatchNodesIfUnmodifiedSince defines model for patchNodesIfUnmodifiedSince.
+type PatchNodesIfUnmodifiedSince = string
+
+// PatchNodesOffset defines model for patchNodesOffset.
+type PatchNodesOffset = int64
+
+// ReportPath defines model for reportPath.
+type ReportPath = string
+
 // SnapshotsLimit defines model for snapshotsLimit.
 type SnapshotsLimit = int
 
@@ -288,23 +1559,35 @@ type SnapshotsOrder string
 // SnapshotsSort defines model for snapshotsSort.
 type SnapshotsSort string
 
-// SnapshotsType Snapshot backend type
-type SnapshotsType = SnapshotType
+// SnapshotsType defines model for snapshotsType.
+type SnapshotsType = []SnapshotType
 
 // Storage defines model for storage.
 type Storage = string
 
-// BadRequest400 defines model for badRequest400.
+// TrashId defines model for trashId.
+type TrashId = string
+
+// ActivityNotImplemented501 RFC 9457 problem details of a failed request
+type ActivityNotImplemented501 = ErrorResponse
+
+// BadRequest400 RFC 9457 problem details of a failed request
 type BadRequest400 = ErrorResponse
 
-// NodeConflict409 defines model for nodeConflict409.
+// IndexNotConfigured501 RFC 9457 problem details of a failed request
+type IndexNotConfigured501 = ErrorResponse
+
+// IndexNotFound404 RFC 9457 problem details of a failed request
+type IndexNotFound404 = ErrorResponse
+
+// NodeConflict409 RFC 9457 problem details of a failed request
 type NodeConflict409 = ErrorResponse
 
 // NodeCreated201 Unified representation of any filesystem object (file or directory).
 // Path is relative to the storage root.
 type NodeCreated201 = Node
 
-// NodeNotFound404 defines model for nodeNotFound404.
+// NodeNotFound404 RFC 9457 problem details of a failed request
 type NodeNotFound404 = ErrorResponse
 
 // NodeSuccess200 defines model for nodeSuccess200.
@@ -312,6 +1595,72 @@ type NodeSuccess200 struct {
 	union json.RawMessage
 }
 
+// RecentNotImplemented501 RFC 9457 problem details of a failed request
+type RecentNotImplemented501 = ErrorResponse
+
+// ReportNotSupported501 RFC 9457 problem details of a failed request
+type ReportNotSupported501 = ErrorResponse
+
+// TagsNotImplemented501 RFC 9457 problem details of a failed request
+type TagsNotImplemented501 = ErrorResponse
+
+// TokensForbidden403 RFC 9457 problem details of a failed request
+type TokensForbidden403 = ErrorResponse
+
+// TokensNotImplemented501 RFC 9457 problem details of a failed request
+type TokensNotImplemented501 = ErrorResponse
+
+// GetJobsHistoryParams defines parameters for GetJobsHistory.
+type GetJobsHistoryParams struct {
+	// Type Only return jobs of this type, e.g. `restore`
+	Type *string `form:"type,omitempty" json:"type,omitempty"`
+
+	// State Only return jobs that finished in this state, `succeeded`, `failed`, `canceled` or `interrupted`
+	State *string `form:"state,omitempty" json:"state,omitempty"`
+
+	// User Only return jobs started by this user
+	User *string `form:"user,omitempty" json:"user,omitempty"`
+
+	// Since Only return jobs that finished at or after this Unix timestamp
+	Since *int64 `form:"since,omitempty" json:"since,omitempty"`
+
+	// Until Only return jobs that finished before this Unix timestamp
+	Until *int64 `form:"until,omitempty" json:"until,omitempty"`
+
+	// Before Only return jobs that finished before this job, from the before of a previous page
+	Before *string `form:"before,omitempty" json:"before,omitempty"`
+
+	// Limit Maximum number of jobs to return
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetRecentParams defines parameters for GetRecent.
+type GetRecentParams struct {
+	// Kind Only list paths accessed this way
+	Kind *GetRecentParamsKind `form:"kind,omitempty" json:"kind,omitempty"`
+}
+
+// GetRecentParamsKind defines parameters for GetRecent.
+type GetRecentParamsKind string
+
+// GetStoragesStorageActivityParams defines parameters for GetStoragesStorageActivity.
+type GetStoragesStorageActivityParams struct {
+	// Limit Maximum number of events to return
+	Limit *ActivityLimit `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Before Only return events older than this event, from the before of a previous page
+	Before *ActivityBefore `form:"before,omitempty" json:"before,omitempty"`
+}
+
+// GetStoragesStorageActivityPathParams defines parameters for GetStoragesStorageActivityPath.
+type GetStoragesStorageActivityPathParams struct {
+	// Limit Maximum number of events to return
+	Limit *ActivityLimit `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Before Only return events older than this event, from the before of a previous page
+	Before *ActivityBefore `form:"before,omitempty" json:"before,omitempty"`
+}
+
 // GetStoragesStorageArchivesParams defines parameters for GetStoragesStorageArchives.
 type GetStoragesStorageArchivesParams struct {
 	// Path Directory to search (searches recursively)
@@ -324,7 +1673,14 @@ type PostStoragesStorageArchivesJSONBody struct {
 	Items []struct {
 		Path string `json:"path"`
 
-		// Type Type of the filesystem node
+		// Snapshot Snapshot to archive the node from, the live storage if omitted
+		Snapshot *string `json:"snapshot,omitempty"`
+
+		// Type Type of the filesystem node. Symbolic links are reported as `link`
+		// if the storage doesn't follow them or their target can't be resolved.
+		// Sockets, FIFOs, device nodes and other non-regular files are reported
+		// as `special`, their content can't be read and they are skipped in
+		// archives.
 		Type *NodeType `json:"type,omitempty"`
 	} `json:"items"`
 
@@ -344,16 +1700,25 @@ type PostStoragesStorageArchivesPathJSONBody struct {
 	Destination *string `json:"destination,omitempty"`
 }
 
-// PostStoragesStorageCopiesJSONBody defines parameters for PostStoragesStorageCopies.
-type PostStoragesStorageCopiesJSONBody struct {
-	// Destination Destination path
-	Destination string `json:"destination"`
-	Items       []struct {
-		Path string `json:"path"`
+// PostStoragesStorageDeltasPathParams defines parameters for PostStoragesStorageDeltasPath.
+type PostStoragesStorageDeltasPathParams struct {
+	// IfMatch ETag of the file as the client read it, or `*` for any existing file.
+	// The update fails with 412 if the file changed since.
+	IfMatch *PatchNodesIfMatch `json:"If-Match,omitempty"`
+}
 
-		// Type Type of the filesystem node
-		Type *NodeType `json:"type,omitempty"`
-	} `json:"items"`
+// GetStoragesStorageManifestsParams defines parameters for GetStoragesStorageManifests.
+type GetStoragesStorageManifestsParams struct {
+	// Snapshot Snapshot identifier in format "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28").
+	// When provided, returns the node as it existed in that snapshot.
+	Snapshot *GetNodesSnapshot `form:"snapshot,omitempty" json:"snapshot,omitempty"`
+}
+
+// GetStoragesStorageManifestsPathParams defines parameters for GetStoragesStorageManifestsPath.
+type GetStoragesStorageManifestsPathParams struct {
+	// Snapshot Snapshot identifier in format "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28").
+	// When provided, returns the node as it existed in that snapshot.
+	Snapshot *GetNodesSnapshot `form:"snapshot,omitempty" json:"snapshot,omitempty"`
 }
 
 // PostStoragesStorageMovesJSONBody defines parameters for PostStoragesStorageMoves.
@@ -366,7 +1731,11 @@ type PostStoragesStorageMovesJSONBody struct {
 		// Path Source path
 		Path string `json:"path"`
 
-		// Type Type of the filesystem node
+		// Type Type of the filesystem node. Symbolic links are reported as `link`
+		// if the storage doesn't follow them or their target can't be resolved.
+		// Sockets, FIFOs, device nodes and other non-regular files are reported
+		// as `special`, their content can't be read and they are skipped in
+		// archives.
 		Type *NodeType `json:"type,omitempty"`
 	} `json:"items"`
 }
@@ -379,16 +1748,79 @@ type GetStoragesStorageNodesParams struct {
 	// Filter Filename pattern (glob-style, e.g., *.pdf)
 	Filter *GetNodesFilter `form:"filter,omitempty" json:"filter,omitempty"`
 
-	// Search Search query - searches recursively from this path
+	// Search Search query - searches recursively from this path for nodes whose
+	// name contains the query, ignoring case. Queries with a slash also
+	// match paths below this path, e.g. `2024/rep`. Results are returned in
+	// pages in depth-first name order, with a cursor to fetch the next page.
 	Search *GetNodesSearch `form:"search,omitempty" json:"search,omitempty"`
 
-	// Children Include children in response (for directories)
-	Children *GetNodesChildren `form:"children,omitempty" json:"children,omitempty"`
+	// Limit Maximum number of search results per page. Pages may have fewer
+	// results if the search takes long, so the first results are returned
+	// quickly.
+	Limit *GetNodesLimit `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Cursor Cursor of a previous page of search results, to continue the search
+	// where it stopped with the same parameters. Cursors of sorted and
+	// unsorted searches can't be mixed.
+	Cursor *GetNodesCursor `form:"cursor,omitempty" json:"cursor,omitempty"`
+
+	// Children Include children in response (for directories). `recursive` also
+	// includes the children of subdirectories as a nested tree down to
+	// `depth` levels, with the same filters applied on every level, e.g.
+	// `type=dir` for a tree of directories only.
+	Children *GetStoragesStorageNodesParamsChildren `form:"children,omitempty" json:"children,omitempty"`
+
+	// Depth Levels of a recursive listing, 1 only lists the directory itself.
+	// Listings stop expanding subdirectories after 10000 nodes and are
+	// marked as truncated.
+	Depth *GetNodesDepth `form:"depth,omitempty" json:"depth,omitempty"`
 
 	// Download Set Content-Disposition to attachment (for files)
 	Download *GetNodesDownload `form:"download,omitempty" json:"download,omitempty"`
 
-	// Sort Sort field for children
+	// Inline Set Content-Disposition to inline with the filename (for files), so
+	// browsers show PDFs and images in a tab under their own name. Can't be
+	// combined with `download`.
+	Inline *GetNodesInline `form:"inline,omitempty" json:"inline,omitempty"`
+
+	// Lines Preview an inclusive, 1-based range of lines of a file instead of its
+	// whole content, e.g. `1-200`. `100-` reads from line 100 to the end and
+	// `-100` reads the last 100 lines (tail). Lines end with `\n`.
+	Lines *GetNodesLines `form:"lines,omitempty" json:"lines,omitempty"`
+
+	// Bytes Preview an inclusive, 0-based range of bytes of a file instead of its
+	// whole content, e.g. `0-65535`. `1024-` reads from byte 1024 to the end
+	// and `-65536` reads the last 65536 bytes (tail).
+	Bytes *GetNodesBytes `form:"bytes,omitempty" json:"bytes,omitempty"`
+
+	// Follow Stream a file as it grows, like `tail -f`, until the client
+	// disconnects. Starts at the last 10 lines, or at an open-ended `lines`
+	// or `bytes` range like `-100` or `100-`. Snapshots can't be followed.
+	Follow *GetNodesFollow `form:"follow,omitempty" json:"follow,omitempty"`
+
+	// Format Return the content in another format instead. For files, `hexdump`
+	// shows a byte range selected by `offset` and `length` as plain text,
+	// with 16 bytes per line in hex and ASCII like `hexdump -C`. For
+	// directories, the archive formats stream the directory with all its
+	// contents, keeping permissions, modification times and symbolic links.
+	Format *GetStoragesStorageNodesParamsFormat `form:"format,omitempty" json:"format,omitempty"`
+
+	// Offset First byte of the hexdump, or without a format the first byte of the
+	// content to return, like a Range header for clients that can't set
+	// headers
+	Offset *GetNodesOffset `form:"offset,omitempty" json:"offset,omitempty"`
+
+	// Length Number of bytes of the hexdump, 4096 by default and up to 1048576,
+	// or without a format the number of bytes of the content to return,
+	// up to the end of the file by default. Content ranges are sent as
+	// `206 Partial Content` with a Content-Range header.
+	Length *GetNodesLength `form:"length,omitempty" json:"length,omitempty"`
+
+	// Sort Sort field for children. Search results are in walk order if not
+	// sorted, sorted ones are ranked as a whole before paging, up to 10000
+	// of them. `relevance` only applies to search results and sorts the
+	// best matches first: names starting with the query, then names
+	// containing it, then paths containing it.
 	Sort *GetStoragesStorageNodesParamsSort `form:"sort,omitempty" json:"sort,omitempty"`
 
 	// Order Sort order
@@ -399,15 +1831,30 @@ type GetStoragesStorageNodesParams struct {
 	//
 	// Available fields:
 	// - (total_size): Include total size of directory and all subdirectories
+	// - (permissions): Include mode, owner, group and symlink target of each node
+	// - (snapshots): Include the number of snapshots containing each node and the newest one
+	// - (exif): Include the dimensions, date taken, camera and GPS location of images
+	// - (pages): Include the page count of PDFs
+	// - (times): Include the creation and change times of each node
 	//
 	// Example: fields=(total_size)
 	Fields *GetNodesFields `form:"fields,omitempty" json:"fields,omitempty"`
 
+	// Hidden Include hidden nodes (names starting with a dot) in directory listings.
+	// Nodes matching the ignore patterns of the storage are never listed.
+	Hidden *GetNodesHidden `form:"hidden,omitempty" json:"hidden,omitempty"`
+
 	// Snapshot Snapshot identifier in format "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28").
 	// When provided, returns the node as it existed in that snapshot.
 	Snapshot *GetNodesSnapshot `form:"snapshot,omitempty" json:"snapshot,omitempty"`
 }
 
+// GetStoragesStorageNodesParamsChildren defines parameters for GetStoragesStorageNodes.
+type GetStoragesStorageNodesParamsChildren string
+
+// GetStoragesStorageNodesParamsFormat defines parameters for GetStoragesStorageNodes.
+type GetStoragesStorageNodesParamsFormat string
+
 // GetStoragesStorageNodesParamsSort defines parameters for GetStoragesStorageNodes.
 type GetStoragesStorageNodesParamsSort string
 
@@ -437,16 +1884,79 @@ type GetStoragesStorageNodesPathParams struct {
 	// Filter Filename pattern (glob-style, e.g., *.pdf)
 	Filter *GetNodesFilter `form:"filter,omitempty" json:"filter,omitempty"`
 
-	// Search Search query - searches recursively from this path
+	// Search Search query - searches recursively from this path for nodes whose
+	// name contains the query, ignoring case. Queries with a slash also
+	// match paths below this path, e.g. `2024/rep`. Results are returned in
+	// pages in depth-first name order, with a cursor to fetch the next page.
 	Search *GetNodesSearch `form:"search,omitempty" json:"search,omitempty"`
 
-	// Children Include children in response (for directories)
-	Children *GetNodesChildren `form:"children,omitempty" json:"children,omitempty"`
+	// Limit Maximum number of search results per page. Pages may have fewer
+	// results if the search takes long, so the first results are returned
+	// quickly.
+	Limit *GetNodesLimit `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Cursor Cursor of a previous page of search results, to continue the search
+	// where it stopped with the same parameters. Cursors of sorted and
+	// unsorted searches can't be mixed.
+	Cursor *GetNodesCursor `form:"cursor,omitempty" json:"cursor,omitempty"`
+
+	// Children Include children in response (for directories). `recursive` also
+	// includes the children of subdirectories as a nested tree down to
+	// `depth` levels, with the same filters applied on every level, e.g.
+	// `type=dir` for a tree of directories only.
+	Children *GetStoragesStorageNodesPathParamsChildren `form:"children,omitempty" json:"children,omitempty"`
+
+	// Depth Levels of a recursive listing, 1 only lists the directory itself.
+	// Listings stop expanding subdirectories after 10000 nodes and are
+	// marked as truncated.
+	Depth *GetNodesDepth `form:"depth,omitempty" json:"depth,omitempty"`
 
 	// Download Set Content-Disposition to attachment (for files)
 	Download *GetNodesDownload `form:"download,omitempty" json:"download,omitempty"`
 
-	// Sort Sort field for children
+	// Inline Set Content-Disposition to inline with the filename (for files), so
+	// browsers show PDFs and images in a tab under their own name. Can't be
+	// combined with `download`.
+	Inline *GetNodesInline `form:"inline,omitempty" json:"inline,omitempty"`
+
+	// Lines Preview an inclusive, 1-based range of lines of a file instead of its
+	// whole content, e.g. `1-200`. `100-` reads from line 100 to the end and
+	// `-100` reads the last 100 lines (tail). Lines end with `\n`.
+	Lines *GetNodesLines `form:"lines,omitempty" json:"lines,omitempty"`
+
+	// Bytes Preview an inclusive, 0-based range of bytes of a file instead of its
+	// whole content, e.g. `0-65535`. `1024-` reads from byte 1024 to the end
+	// and `-65536` reads the last 65536 bytes (tail).
+	Bytes *GetNodesBytes `form:"bytes,omitempty" json:"bytes,omitempty"`
+
+	// Follow Stream a file as it grows, like `tail -f`, until the client
+	// disconnects. Starts at the last 10 lines, or at an open-ended `lines`
+	// or `bytes` range like `-100` or `100-`. Snapshots can't be followed.
+	Follow *GetNodesFollow `form:"follow,omitempty" json:"follow,omitempty"`
+
+	// Format Return the content in another format instead. For files, `hexdump`
+	// shows a byte range selected by `offset` and `length` as plain text,
+	// with 16 bytes per line in hex and ASCII like `hexdump -C`. For
+	// directories, the archive formats stream the directory with all its
+	// contents, keeping permissions, modification times and symbolic links.
+	Format *GetStoragesStorageNodesPathParamsFormat `form:"format,omitempty" json:"format,omitempty"`
+
+	// Offset First byte of the hexdump, or without a format the first byte of the
+	// content to return, like a Range header for clients that can't set
+	// headers
+	Offset *GetNodesOffset `form:"offset,omitempty" json:"offset,omitempty"`
+
+	// Length Number of bytes of the hexdump, 4096 by default and up to 1048576,
+	// or without a format the number of bytes of the content to return,
+	// up to the end of the file by default. Content ranges are sent as
+	// `206 Partial Content` with a Content-Range header.
+	Length *GetNodesLength `form:"length,omitempty" json:"length,omitempty"`
+
+	// Sort Sort field for children. Search results are in walk order if not
+	// sorted, sorted ones are ranked as a whole before paging, up to 10000
+	// of them. `relevance` only applies to search results and sorts the
+	// best matches first: names starting with the query, then names
+	// containing it, then paths containing it.
 	Sort *GetStoragesStorageNodesPathParamsSort `form:"sort,omitempty" json:"sort,omitempty"`
 
 	// Order Sort order
@@ -457,21 +1967,52 @@ type GetStoragesStorageNodesPathParams struct {
 	//
 	// Available fields:
 	// - (total_size): Include total size of directory and all subdirectories
+	// - (permissions): Include mode, owner, group and symlink target of each node
+	// - (snapshots): Include the number of snapshots containing each node and the newest one
+	// - (exif): Include the dimensions, date taken, camera and GPS location of images
+	// - (pages): Include the page count of PDFs
+	// - (times): Include the creation and change times of each node
 	//
 	// Example: fields=(total_size)
 	Fields *GetNodesFields `form:"fields,omitempty" json:"fields,omitempty"`
 
+	// Hidden Include hidden nodes (names starting with a dot) in directory listings.
+	// Nodes matching the ignore patterns of the storage are never listed.
+	Hidden *GetNodesHidden `form:"hidden,omitempty" json:"hidden,omitempty"`
+
 	// Snapshot Snapshot identifier in format "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28").
 	// When provided, returns the node as it existed in that snapshot.
 	Snapshot *GetNodesSnapshot `form:"snapshot,omitempty" json:"snapshot,omitempty"`
 }
 
+// GetStoragesStorageNodesPathParamsChildren defines parameters for GetStoragesStorageNodesPath.
+type GetStoragesStorageNodesPathParamsChildren string
+
+// GetStoragesStorageNodesPathParamsFormat defines parameters for GetStoragesStorageNodesPath.
+type GetStoragesStorageNodesPathParamsFormat string
+
 // GetStoragesStorageNodesPathParamsSort defines parameters for GetStoragesStorageNodesPath.
 type GetStoragesStorageNodesPathParamsSort string
 
 // GetStoragesStorageNodesPathParamsOrder defines parameters for GetStoragesStorageNodesPath.
 type GetStoragesStorageNodesPathParamsOrder string
 
+// PatchStoragesStorageNodesPathParams defines parameters for PatchStoragesStorageNodesPath.
+type PatchStoragesStorageNodesPathParams struct {
+	// Offset Byte offset to write an `application/octet-stream` body at, at most
+	// the size of the file. Required for partial writes, ignored for JSON
+	// updates.
+	Offset *PatchNodesOffset `form:"offset,omitempty" json:"offset,omitempty"`
+
+	// IfMatch ETag of the file as the client read it, or `*` for any existing file.
+	// The update fails with 412 if the file changed since.
+	IfMatch *PatchNodesIfMatch `json:"If-Match,omitempty"`
+
+	// IfUnmodifiedSince HTTP date of the modification time the client read. The update fails
+	// with 412 if the file was modified later. Ignored with `If-Match`.
+	IfUnmodifiedSince *PatchNodesIfUnmodifiedSince `json:"If-Unmodified-Since,omitempty"`
+}
+
 // PostStoragesStorageNodesPathMultipartBody defines parameters for PostStoragesStorageNodesPath.
 type PostStoragesStorageNodesPathMultipartBody struct {
 	// File File to upload
@@ -481,15 +2022,79 @@ type PostStoragesStorageNodesPathMultipartBody struct {
 	Name *string `json:"name,omitempty"`
 }
 
-// GetStoragesStorageSnapshotsParams defines parameters for GetStoragesStorageSnapshots.
-type GetStoragesStorageSnapshotsParams struct {
-	// Type Filter snapshots by type (optional, can repeat for multiple types)
-	Type *SnapshotsType `form:"type,omitempty" json:"type,omitempty"`
+// GetStoragesStorageRenderPathParams defines parameters for GetStoragesStorageRenderPath.
+type GetStoragesStorageRenderPathParams struct {
+	// Snapshot Snapshot identifier in format "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28").
+	// When provided, returns the node as it existed in that snapshot.
+	Snapshot *GetNodesSnapshot `form:"snapshot,omitempty" json:"snapshot,omitempty"`
+}
 
-	// Limit Maximum snapshots to return
-	Limit *SnapshotsLimit `form:"limit,omitempty" json:"limit,omitempty"`
+// GetStoragesStorageReportsLargestParams defines parameters for GetStoragesStorageReportsLargest.
+type GetStoragesStorageReportsLargestParams struct {
+	// Path Directory to report on, relative to the storage root (defaults to the root)
+	Path *ReportPath `form:"path,omitempty" json:"path,omitempty"`
 
-	// Offset Pagination offset
+	// Snapshot Snapshot identifier in format "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28").
+	// When provided, returns the node as it existed in that snapshot.
+	Snapshot *GetNodesSnapshot `form:"snapshot,omitempty" json:"snapshot,omitempty"`
+
+	// Limit Number of files to report
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetStoragesStorageReportsRecentParams defines parameters for GetStoragesStorageReportsRecent.
+type GetStoragesStorageReportsRecentParams struct {
+	// Path Directory to report on, relative to the storage root (defaults to the root)
+	Path *ReportPath `form:"path,omitempty" json:"path,omitempty"`
+
+	// Since Report files modified within this duration (e.g. "1h30m")
+	Since *string `form:"since,omitempty" json:"since,omitempty"`
+
+	// Compare Compare each file against the latest snapshot
+	Compare *bool `form:"compare,omitempty" json:"compare,omitempty"`
+
+	// Limit Stop after reporting this many files
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetStoragesStorageReportsSnapshotsParams defines parameters for GetStoragesStorageReportsSnapshots.
+type GetStoragesStorageReportsSnapshotsParams struct {
+	// Limit Number of snapshots to report, all if absent
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetStoragesStorageRetentionParams defines parameters for GetStoragesStorageRetention.
+type GetStoragesStorageRetentionParams struct {
+	// Type Filter snapshots by type (optional, can repeat for multiple types)
+	Type *SnapshotsType `form:"type,omitempty" json:"type,omitempty"`
+
+	// MaxGap Longest expected interval between consecutive snapshots as a
+	// duration (e.g. "1h30m"). Longer intervals are reported as gaps.
+	MaxGap *string `form:"max_gap,omitempty" json:"max_gap,omitempty"`
+}
+
+// GetStoragesStorageSignaturesPathParams defines parameters for GetStoragesStorageSignaturesPath.
+type GetStoragesStorageSignaturesPathParams struct {
+	// BlockSize Bytes per block. Larger blocks make smaller signatures, smaller
+	// blocks smaller deltas.
+	BlockSize *int `form:"block_size,omitempty" json:"block_size,omitempty"`
+}
+
+// DeleteStoragesStorageSnapshotsParams defines parameters for DeleteStoragesStorageSnapshots.
+type DeleteStoragesStorageSnapshotsParams struct {
+	// Id Snapshot identifier, e.g. "zfs:before-cleanup"
+	Id string `form:"id" json:"id"`
+}
+
+// GetStoragesStorageSnapshotsParams defines parameters for GetStoragesStorageSnapshots.
+type GetStoragesStorageSnapshotsParams struct {
+	// Type Filter snapshots by type (optional, can repeat for multiple types)
+	Type *SnapshotsType `form:"type,omitempty" json:"type,omitempty"`
+
+	// Limit Maximum snapshots to return
+	Limit *SnapshotsLimit `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Offset Pagination offset
 	Offset *SnapshotsOffset `form:"offset,omitempty" json:"offset,omitempty"`
 
 	// Sort Sort field for results
@@ -529,6 +2134,31 @@ type GetStoragesStorageSnapshotsPathParamsSort string
 // GetStoragesStorageSnapshotsPathParamsOrder defines parameters for GetStoragesStorageSnapshotsPath.
 type GetStoragesStorageSnapshotsPathParamsOrder string
 
+// DeleteStoragesStorageTagsPathParams defines parameters for DeleteStoragesStorageTagsPath.
+type DeleteStoragesStorageTagsPathParams struct {
+	// Tag Tag to remove
+	Tag string `form:"tag" json:"tag"`
+}
+
+// GetStoragesStorageThumbnailsPathParams defines parameters for GetStoragesStorageThumbnailsPath.
+type GetStoragesStorageThumbnailsPathParams struct {
+	// Snapshot Snapshot identifier in format "type:backend-id" (e.g., "zfs:tank@daily-2024-10-28").
+	// When provided, returns the node as it existed in that snapshot.
+	Snapshot *GetNodesSnapshot `form:"snapshot,omitempty" json:"snapshot,omitempty"`
+}
+
+// PostAdminImportJSONRequestBody defines body for PostAdminImport for application/json ContentType.
+type PostAdminImportJSONRequestBody = ConfigBundle
+
+// PostBookmarksJSONRequestBody defines body for PostBookmarks for application/json ContentType.
+type PostBookmarksJSONRequestBody = CreateBookmarkRequest
+
+// PostPinsJSONRequestBody defines body for PostPins for application/json ContentType.
+type PostPinsJSONRequestBody = CreatePinRequest
+
+// PostStoragesStorageActivityPathJSONRequestBody defines body for PostStoragesStorageActivityPath for application/json ContentType.
+type PostStoragesStorageActivityPathJSONRequestBody = CommentRequest
+
 // PostStoragesStorageArchivesJSONRequestBody defines body for PostStoragesStorageArchives for application/json ContentType.
 type PostStoragesStorageArchivesJSONRequestBody PostStoragesStorageArchivesJSONBody
 
@@ -536,7 +2166,13 @@ type PostStoragesStorageArchivesJSONRequestBody PostStoragesStorageArchivesJSONB
 type PostStoragesStorageArchivesPathJSONRequestBody PostStoragesStorageArchivesPathJSONBody
 
 // PostStoragesStorageCopiesJSONRequestBody defines body for PostStoragesStorageCopies for application/json ContentType.
-type PostStoragesStorageCopiesJSONRequestBody PostStoragesStorageCopiesJSONBody
+type PostStoragesStorageCopiesJSONRequestBody = CopyRequest
+
+// PostStoragesStorageDownloadsJSONRequestBody defines body for PostStoragesStorageDownloads for application/json ContentType.
+type PostStoragesStorageDownloadsJSONRequestBody = DownloadRequest
+
+// PostStoragesStorageExportsJSONRequestBody defines body for PostStoragesStorageExports for application/json ContentType.
+type PostStoragesStorageExportsJSONRequestBody = ExportRequest
 
 // PostStoragesStorageMovesJSONRequestBody defines body for PostStoragesStorageMoves for application/json ContentType.
 type PostStoragesStorageMovesJSONRequestBody PostStoragesStorageMovesJSONBody
@@ -556,6 +2192,18 @@ type PostStoragesStorageNodesPathJSONRequestBody = CreateNodeRequest
 // PostStoragesStorageNodesPathMultipartRequestBody defines body for PostStoragesStorageNodesPath for multipart/form-data ContentType.
 type PostStoragesStorageNodesPathMultipartRequestBody PostStoragesStorageNodesPathMultipartBody
 
+// PostStoragesStorageSnapshotsJSONRequestBody defines body for PostStoragesStorageSnapshots for application/json ContentType.
+type PostStoragesStorageSnapshotsJSONRequestBody = CreateSnapshotRequest
+
+// PostStoragesStorageStatJSONRequestBody defines body for PostStoragesStorageStat for application/json ContentType.
+type PostStoragesStorageStatJSONRequestBody = StatRequest
+
+// PostStoragesStorageTagsPathJSONRequestBody defines body for PostStoragesStorageTagsPath for application/json ContentType.
+type PostStoragesStorageTagsPathJSONRequestBody = TagRequest
+
+// PostTokensJSONRequestBody defines body for PostTokens for application/json ContentType.
+type PostTokensJSONRequestBody = CreateTokenRequest
+
 // AsNode returns the union data inside the NodeSuccess200 as a Node
 func (t NodeSuccess200) AsNode() (Node, error) {
 	var body Node
@@ -620,9 +2268,84 @@ func (t *NodeSuccess200) UnmarshalJSON(b []byte) error {
 
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
+	// Export the configuration and state
+	// (GET /admin/export)
+	GetAdminExport(w http.ResponseWriter, r *http.Request)
+	// Import tokens, tags and bookmarks
+	// (POST /admin/import)
+	PostAdminImport(w http.ResponseWriter, r *http.Request)
+	// Reload the configuration
+	// (POST /admin/reload)
+	PostAdminReload(w http.ResponseWriter, r *http.Request)
+	// List bookmarks
+	// (GET /bookmarks)
+	GetBookmarks(w http.ResponseWriter, r *http.Request)
+	// Bookmark a node
+	// (POST /bookmarks)
+	PostBookmarks(w http.ResponseWriter, r *http.Request)
+	// Delete a bookmark
+	// (DELETE /bookmarks/{id})
+	DeleteBookmarksId(w http.ResponseWriter, r *http.Request, id string)
+	// Delete a comment
+	// (DELETE /comments/{id})
+	DeleteCommentsId(w http.ResponseWriter, r *http.Request, id int64)
+	// Liveness probe
+	// (GET /healthz)
+	GetHealthz(w http.ResponseWriter, r *http.Request)
+	// List jobs
+	// (GET /jobs)
+	GetJobs(w http.ResponseWriter, r *http.Request)
+	// List finished jobs
+	// (GET /jobs/history)
+	GetJobsHistory(w http.ResponseWriter, r *http.Request, params GetJobsHistoryParams)
+	// Cancel a job
+	// (DELETE /jobs/{id})
+	DeleteJobsId(w http.ResponseWriter, r *http.Request, id string)
+	// Get a job
+	// (GET /jobs/{id})
+	GetJobsId(w http.ResponseWriter, r *http.Request, id string)
+	// Metrics
+	// (GET /metrics)
+	GetMetrics(w http.ResponseWriter, r *http.Request)
+	// List pinned snapshots
+	// (GET /pins)
+	GetPins(w http.ResponseWriter, r *http.Request)
+	// Pin a snapshot as a storage
+	// (POST /pins)
+	PostPins(w http.ResponseWriter, r *http.Request)
+	// Unpin a snapshot
+	// (DELETE /pins/{name})
+	DeletePinsName(w http.ResponseWriter, r *http.Request, name string)
+	// Readiness probe
+	// (GET /readyz)
+	GetReadyz(w http.ResponseWriter, r *http.Request)
+	// Forget recently accessed paths
+	// (DELETE /recent)
+	DeleteRecent(w http.ResponseWriter, r *http.Request)
+	// List recently accessed paths
+	// (GET /recent)
+	GetRecent(w http.ResponseWriter, r *http.Request, params GetRecentParams)
+	// List scheduled jobs
+	// (GET /schedules)
+	GetSchedules(w http.ResponseWriter, r *http.Request)
+	// Run a scheduled job now
+	// (POST /schedules/{name}/runs)
+	PostSchedulesNameRuns(w http.ResponseWriter, r *http.Request, name string)
 	// List available storage backends
 	// (GET /storages)
 	GetStorages(w http.ResponseWriter, r *http.Request)
+	// Stream storage changes
+	// (GET /storages/events)
+	GetStoragesEvents(w http.ResponseWriter, r *http.Request)
+	// Get the activity of a storage
+	// (GET /storages/{storage}/activity)
+	GetStoragesStorageActivity(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageActivityParams)
+	// Get the activity of a node
+	// (GET /storages/{storage}/activity/{path...})
+	GetStoragesStorageActivityPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params GetStoragesStorageActivityPathParams)
+	// Comment on a node
+	// (POST /storages/{storage}/activity/{path...})
+	PostStoragesStorageActivityPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath)
 	// List all archives
 	// (GET /storages/{storage}/archives)
 	GetStoragesStorageArchives(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageArchivesParams)
@@ -635,6 +2358,39 @@ type ServerInterface interface {
 	// Copy nodes to a new location
 	// (POST /storages/{storage}/copies)
 	PostStoragesStorageCopies(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Update a file with a delta
+	// (POST /storages/{storage}/deltas/{path...})
+	PostStoragesStorageDeltasPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params PostStoragesStorageDeltasPathParams)
+	// Download selected nodes as an archive
+	// (POST /storages/{storage}/downloads)
+	PostStoragesStorageDownloads(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Eject a removable drive
+	// (POST /storages/{storage}/eject)
+	PostStoragesStorageEject(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Export a directory to another storage
+	// (POST /storages/{storage}/exports)
+	PostStoragesStorageExports(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Drop the index
+	// (DELETE /storages/{storage}/index)
+	DeleteStoragesStorageIndex(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Get indexing status
+	// (GET /storages/{storage}/index)
+	GetStoragesStorageIndex(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Trigger indexing
+	// (POST /storages/{storage}/index)
+	PostStoragesStorageIndex(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Pause indexing
+	// (POST /storages/{storage}/index/pause)
+	PostStoragesStorageIndexPause(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Resume indexing
+	// (POST /storages/{storage}/index/resume)
+	PostStoragesStorageIndexResume(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Get integrity manifest for storage root
+	// (GET /storages/{storage}/manifests)
+	GetStoragesStorageManifests(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageManifestsParams)
+	// Get integrity manifest for a node
+	// (GET /storages/{storage}/manifests/{path...})
+	GetStoragesStorageManifestsPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params GetStoragesStorageManifestsPathParams)
 	// Move nodes to a new location
 	// (POST /storages/{storage}/moves)
 	PostStoragesStorageMoves(w http.ResponseWriter, r *http.Request, storage Storage)
@@ -652,16 +2408,91 @@ type ServerInterface interface {
 	GetStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params GetStoragesStorageNodesPathParams)
 	// Update node metadata or content
 	// (PATCH /storages/{storage}/nodes/{path...})
-	PatchStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath)
+	PatchStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params PatchStoragesStorageNodesPathParams)
 	// Create a new child node
 	// (POST /storages/{storage}/nodes/{path...})
 	PostStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath)
+	// Render a file preview as HTML
+	// (GET /storages/{storage}/render/{path...})
+	GetStoragesStorageRenderPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params GetStoragesStorageRenderPathParams)
+	// Largest files
+	// (GET /storages/{storage}/reports/largest)
+	GetStoragesStorageReportsLargest(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageReportsLargestParams)
+	// Recently modified files
+	// (GET /storages/{storage}/reports/recent)
+	GetStoragesStorageReportsRecent(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageReportsRecentParams)
+	// Snapshot space usage
+	// (GET /storages/{storage}/reports/snapshots)
+	GetStoragesStorageReportsSnapshots(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageReportsSnapshotsParams)
+	// Analyze snapshot retention
+	// (GET /storages/{storage}/retention)
+	GetStoragesStorageRetention(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageRetentionParams)
+	// Get the block signature of a file
+	// (GET /storages/{storage}/signatures/{path...})
+	GetStoragesStorageSignaturesPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params GetStoragesStorageSignaturesPathParams)
+	// Destroy a snapshot
+	// (DELETE /storages/{storage}/snapshots)
+	DeleteStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request, storage Storage, params DeleteStoragesStorageSnapshotsParams)
 	// Get snapshots at storage root
 	// (GET /storages/{storage}/snapshots)
 	GetStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageSnapshotsParams)
+	// Create a snapshot
+	// (POST /storages/{storage}/snapshots)
+	PostStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request, storage Storage)
 	// Get snapshots for a node
 	// (GET /storages/{storage}/snapshots/{path...})
 	GetStoragesStorageSnapshotsPath(w http.ResponseWriter, r *http.Request, storage Storage, path string, params GetStoragesStorageSnapshotsPathParams)
+	// Get metadata of many nodes
+	// (POST /storages/{storage}/stat)
+	PostStoragesStorageStat(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Untag a node
+	// (DELETE /storages/{storage}/tags/{path...})
+	DeleteStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params DeleteStoragesStorageTagsPathParams)
+	// Get the tags of a node
+	// (GET /storages/{storage}/tags/{path...})
+	GetStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath)
+	// Tag a node
+	// (POST /storages/{storage}/tags/{path...})
+	PostStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath)
+	// Get a thumbnail of a document
+	// (GET /storages/{storage}/thumbnails/{path...})
+	GetStoragesStorageThumbnailsPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath, params GetStoragesStorageThumbnailsPathParams)
+	// Empty the trash
+	// (DELETE /storages/{storage}/trash)
+	DeleteStoragesStorageTrash(w http.ResponseWriter, r *http.Request, storage Storage)
+	// List trashed nodes
+	// (GET /storages/{storage}/trash)
+	GetStoragesStorageTrash(w http.ResponseWriter, r *http.Request, storage Storage)
+	// Purge a trashed node
+	// (DELETE /storages/{storage}/trash/{id})
+	DeleteStoragesStorageTrashId(w http.ResponseWriter, r *http.Request, storage Storage, id TrashId)
+	// Restore a trashed node
+	// (POST /storages/{storage}/trash/{id}/restore)
+	PostStoragesStorageTrashIdRestore(w http.ResponseWriter, r *http.Request, storage Storage, id TrashId)
+	// Verify an archive against its manifest
+	// (GET /storages/{storage}/verifications/{path...})
+	GetStoragesStorageVerificationsPath(w http.ResponseWriter, r *http.Request, storage Storage, path NodePath)
+	// Get ZFS pool and dataset health
+	// (GET /storages/{storage}/zfs)
+	GetStoragesStorageZfs(w http.ResponseWriter, r *http.Request, storage Storage)
+	// List tags
+	// (GET /tags)
+	GetTags(w http.ResponseWriter, r *http.Request)
+	// List nodes by tag
+	// (GET /tags/{tag})
+	GetTagsTag(w http.ResponseWriter, r *http.Request, tag string)
+	// List API tokens
+	// (GET /tokens)
+	GetTokens(w http.ResponseWriter, r *http.Request)
+	// Create an API token
+	// (POST /tokens)
+	PostTokens(w http.ResponseWriter, r *http.Request)
+	// Revoke an API token
+	// (DELETE /tokens/{id})
+	DeleteTokensId(w http.ResponseWriter, r *http.Request, id string)
+	// Server version
+	// (GET /version)
+	GetVersion(w http.ResponseWriter, r *http.Request)
 }
 
 // ServerInterfaceWrapper converts contexts to parameters.
@@ -671,13 +2502,2166 @@ type ServerInterfaceWrapper struct {
 	ErrorHandlerFunc   func(w http.ResponseWriter, r *http.Request, err error)
 }
 
-type MiddlewareFunc func(http.Handler) http.Handler
+type MiddlewareFunc func(http.Handler) http.Handler
+
+// GetAdminExport operation middleware
+func (siw *ServerInterfaceWrapper) GetAdminExport(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetAdminExport(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostAdminImport operation middleware
+func (siw *ServerInterfaceWrapper) PostAdminImport(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostAdminImport(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostAdminReload operation middleware
+func (siw *ServerInterfaceWrapper) PostAdminReload(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostAdminReload(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetBookmarks operation middleware
+func (siw *ServerInterfaceWrapper) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetBookmarks(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostBookmarks operation middleware
+func (siw *ServerInterfaceWrapper) PostBookmarks(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostBookmarks(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteBookmarksId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteBookmarksId(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteBookmarksId(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteCommentsId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteCommentsId(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id int64
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteCommentsId(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetHealthz operation middleware
+func (siw *ServerInterfaceWrapper) GetHealthz(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetHealthz(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetJobs operation middleware
+func (siw *ServerInterfaceWrapper) GetJobs(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetJobs(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetJobsHistory operation middleware
+func (siw *ServerInterfaceWrapper) GetJobsHistory(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetJobsHistoryParams
+
+	// ------------- Optional query parameter "type" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "state" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "state", r.URL.Query(), &params.State)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "state", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "user" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "user", r.URL.Query(), &params.User)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "user", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "since" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "since", r.URL.Query(), &params.Since)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "since", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "until" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "until", r.URL.Query(), &params.Until)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "until", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "before" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "before", r.URL.Query(), &params.Before)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "before", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetJobsHistory(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteJobsId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteJobsId(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteJobsId(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetJobsId operation middleware
+func (siw *ServerInterfaceWrapper) GetJobsId(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetJobsId(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetMetrics operation middleware
+func (siw *ServerInterfaceWrapper) GetMetrics(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetMetrics(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetPins operation middleware
+func (siw *ServerInterfaceWrapper) GetPins(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetPins(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostPins operation middleware
+func (siw *ServerInterfaceWrapper) PostPins(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostPins(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeletePinsName operation middleware
+func (siw *ServerInterfaceWrapper) DeletePinsName(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", r.PathValue("name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeletePinsName(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetReadyz operation middleware
+func (siw *ServerInterfaceWrapper) GetReadyz(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetReadyz(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteRecent operation middleware
+func (siw *ServerInterfaceWrapper) DeleteRecent(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteRecent(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetRecent operation middleware
+func (siw *ServerInterfaceWrapper) GetRecent(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetRecentParams
+
+	// ------------- Optional query parameter "kind" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "kind", r.URL.Query(), &params.Kind)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "kind", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetRecent(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetSchedules operation middleware
+func (siw *ServerInterfaceWrapper) GetSchedules(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetSchedules(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostSchedulesNameRuns operation middleware
+func (siw *ServerInterfaceWrapper) PostSchedulesNameRuns(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", r.PathValue("name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostSchedulesNameRuns(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStorages operation middleware
+func (siw *ServerInterfaceWrapper) GetStorages(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStorages(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesEvents operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesEvents(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesEvents(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageActivity operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageActivity(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageActivityParams
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "before" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "before", r.URL.Query(), &params.Before)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "before", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageActivity(w, r, storage, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageActivityPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageActivityPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageActivityPathParams
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "before" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "before", r.URL.Query(), &params.Before)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "before", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageActivityPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageActivityPath operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageActivityPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageActivityPath(w, r, storage, path)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageArchives operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageArchives(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageArchivesParams
+
+	// ------------- Optional query parameter "path" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "path", r.URL.Query(), &params.Path)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageArchives(w, r, storage, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageArchives operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageArchives(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostStoragesStorageArchivesParams
+
+	// ------------- Optional query parameter "path" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "path", r.URL.Query(), &params.Path)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageArchives(w, r, storage, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageArchivesPath operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageArchivesPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path" -------------
+	var path string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageArchivesPath(w, r, storage, path)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageCopies operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageCopies(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageCopies(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageDeltasPath operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageDeltasPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostStoragesStorageDeltasPathParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch PatchNodesIfMatch
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-Match", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-Match", valueList[0], &IfMatch, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-Match", Err: err})
+			return
+		}
+
+		params.IfMatch = &IfMatch
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageDeltasPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageDownloads operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageDownloads(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageDownloads(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageEject operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageEject(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageEject(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageExports operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageExports(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageExports(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteStoragesStorageIndex operation middleware
+func (siw *ServerInterfaceWrapper) DeleteStoragesStorageIndex(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteStoragesStorageIndex(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageIndex operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageIndex(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageIndex(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageIndex operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageIndex(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageIndex(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageIndexPause operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageIndexPause(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageIndexPause(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageIndexResume operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageIndexResume(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageIndexResume(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageManifests operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageManifests(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageManifestsParams
+
+	// ------------- Optional query parameter "snapshot" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageManifests(w, r, storage, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageManifestsPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageManifestsPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageManifestsPathParams
+
+	// ------------- Optional query parameter "snapshot" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageManifestsPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageMoves operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageMoves(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageMoves(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageNodes operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageNodes(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageNodesParams
+
+	// ------------- Optional query parameter "type" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "filter" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "filter", r.URL.Query(), &params.Filter)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "filter", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "search" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "search", r.URL.Query(), &params.Search)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "search", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cursor", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "children" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "children", r.URL.Query(), &params.Children)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "children", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "depth" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "depth", r.URL.Query(), &params.Depth)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "depth", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "download" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "download", r.URL.Query(), &params.Download)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "download", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "inline" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "inline", r.URL.Query(), &params.Inline)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "inline", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "lines" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "lines", r.URL.Query(), &params.Lines)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "lines", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "bytes" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "bytes", r.URL.Query(), &params.Bytes)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "bytes", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "follow" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "follow", r.URL.Query(), &params.Follow)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "follow", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "format", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "offset" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "offset", r.URL.Query(), &params.Offset)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "offset", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "length" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "length", r.URL.Query(), &params.Length)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "length", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "order" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "fields" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "fields", r.URL.Query(), &params.Fields)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "fields", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "hidden" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "hidden", r.URL.Query(), &params.Hidden)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "hidden", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "snapshot" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageNodes(w, r, storage, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageNodes operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageNodes(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageNodes(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteStoragesStorageNodesPath operation middleware
+func (siw *ServerInterfaceWrapper) DeleteStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params DeleteStoragesStorageNodesPathParams
+
+	// ------------- Optional query parameter "recursive" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "recursive", r.URL.Query(), &params.Recursive)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "recursive", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteStoragesStorageNodesPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageNodesPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageNodesPathParams
+
+	// ------------- Optional query parameter "type" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "filter" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "filter", r.URL.Query(), &params.Filter)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "filter", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "search" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "search", r.URL.Query(), &params.Search)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "search", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cursor", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "children" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "children", r.URL.Query(), &params.Children)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "children", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "depth" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "depth", r.URL.Query(), &params.Depth)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "depth", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "download" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "download", r.URL.Query(), &params.Download)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "download", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "inline" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "inline", r.URL.Query(), &params.Inline)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "inline", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "lines" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "lines", r.URL.Query(), &params.Lines)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "lines", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "bytes" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "bytes", r.URL.Query(), &params.Bytes)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "bytes", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "follow" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "follow", r.URL.Query(), &params.Follow)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "follow", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "format", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "offset" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "offset", r.URL.Query(), &params.Offset)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "offset", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "length" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "length", r.URL.Query(), &params.Length)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "length", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "order" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "fields" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "fields", r.URL.Query(), &params.Fields)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "fields", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "hidden" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "hidden", r.URL.Query(), &params.Hidden)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "hidden", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "snapshot" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageNodesPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PatchStoragesStorageNodesPath operation middleware
+func (siw *ServerInterfaceWrapper) PatchStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PatchStoragesStorageNodesPathParams
+
+	// ------------- Optional query parameter "offset" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "offset", r.URL.Query(), &params.Offset)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "offset", Err: err})
+		return
+	}
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "If-Match" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Match")]; found {
+		var IfMatch PatchNodesIfMatch
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-Match", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-Match", valueList[0], &IfMatch, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-Match", Err: err})
+			return
+		}
+
+		params.IfMatch = &IfMatch
+
+	}
+
+	// ------------- Optional header parameter "If-Unmodified-Since" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("If-Unmodified-Since")]; found {
+		var IfUnmodifiedSince PatchNodesIfUnmodifiedSince
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "If-Unmodified-Since", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "If-Unmodified-Since", valueList[0], &IfUnmodifiedSince, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "If-Unmodified-Since", Err: err})
+			return
+		}
+
+		params.IfUnmodifiedSince = &IfUnmodifiedSince
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PatchStoragesStorageNodesPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageNodesPath operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageNodesPath(w, r, storage, path)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageRenderPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageRenderPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageRenderPathParams
+
+	// ------------- Optional query parameter "snapshot" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageRenderPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageReportsLargest operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageReportsLargest(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageReportsLargestParams
+
+	// ------------- Optional query parameter "path" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "path", r.URL.Query(), &params.Path)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "snapshot" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageReportsLargest(w, r, storage, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageReportsRecent operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageReportsRecent(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageReportsRecentParams
+
+	// ------------- Optional query parameter "path" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "path", r.URL.Query(), &params.Path)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "since" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "since", r.URL.Query(), &params.Since)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "since", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "compare" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "compare", r.URL.Query(), &params.Compare)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "compare", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageReportsRecent(w, r, storage, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageReportsSnapshots operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageReportsSnapshots(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
 
-// GetStorages operation middleware
-func (siw *ServerInterfaceWrapper) GetStorages(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageReportsSnapshotsParams
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetStorages(w, r)
+		siw.Handler.GetStoragesStorageReportsSnapshots(w, r, storage, params)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -687,8 +4671,8 @@ func (siw *ServerInterfaceWrapper) GetStorages(w http.ResponseWriter, r *http.Re
 	handler.ServeHTTP(w, r)
 }
 
-// GetStoragesStorageArchives operation middleware
-func (siw *ServerInterfaceWrapper) GetStoragesStorageArchives(w http.ResponseWriter, r *http.Request) {
+// GetStoragesStorageRetention operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageRetention(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -701,19 +4685,33 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageArchives(w http.ResponseWri
 		return
 	}
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	// Parameter object where we will unmarshal all parameters from the context
-	var params GetStoragesStorageArchivesParams
+	var params GetStoragesStorageRetentionParams
 
-	// ------------- Optional query parameter "path" -------------
+	// ------------- Optional query parameter "type" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "path", r.URL.Query(), &params.Path)
+	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "max_gap" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "max_gap", r.URL.Query(), &params.MaxGap)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "max_gap", Err: err})
 		return
 	}
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetStoragesStorageArchives(w, r, storage, params)
+		siw.Handler.GetStoragesStorageRetention(w, r, storage, params)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -723,8 +4721,8 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageArchives(w http.ResponseWri
 	handler.ServeHTTP(w, r)
 }
 
-// PostStoragesStorageArchives operation middleware
-func (siw *ServerInterfaceWrapper) PostStoragesStorageArchives(w http.ResponseWriter, r *http.Request) {
+// GetStoragesStorageSignaturesPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageSignaturesPath(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -737,19 +4735,34 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageArchives(w http.ResponseWr
 		return
 	}
 
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	// Parameter object where we will unmarshal all parameters from the context
-	var params PostStoragesStorageArchivesParams
+	var params GetStoragesStorageSignaturesPathParams
 
-	// ------------- Optional query parameter "path" -------------
+	// ------------- Optional query parameter "block_size" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "path", r.URL.Query(), &params.Path)
+	err = runtime.BindQueryParameter("form", true, false, "block_size", r.URL.Query(), &params.BlockSize)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "block_size", Err: err})
 		return
 	}
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostStoragesStorageArchives(w, r, storage, params)
+		siw.Handler.GetStoragesStorageSignaturesPath(w, r, storage, path, params)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -759,8 +4772,8 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageArchives(w http.ResponseWr
 	handler.ServeHTTP(w, r)
 }
 
-// PostStoragesStorageArchivesPath operation middleware
-func (siw *ServerInterfaceWrapper) PostStoragesStorageArchivesPath(w http.ResponseWriter, r *http.Request) {
+// DeleteStoragesStorageSnapshots operation middleware
+func (siw *ServerInterfaceWrapper) DeleteStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -773,17 +4786,32 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageArchivesPath(w http.Respon
 		return
 	}
 
-	// ------------- Path parameter "path" -------------
-	var path string
+	ctx := r.Context()
 
-	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params DeleteStoragesStorageSnapshotsParams
+
+	// ------------- Required query parameter "id" -------------
+
+	if paramValue := r.URL.Query().Get("id"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandlerFunc(w, r, &RequiredParamError{ParamName: "id"})
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "id", r.URL.Query(), &params.Id)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
 		return
 	}
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostStoragesStorageArchivesPath(w, r, storage, path)
+		siw.Handler.DeleteStoragesStorageSnapshots(w, r, storage, params)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -793,8 +4821,8 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageArchivesPath(w http.Respon
 	handler.ServeHTTP(w, r)
 }
 
-// PostStoragesStorageCopies operation middleware
-func (siw *ServerInterfaceWrapper) PostStoragesStorageCopies(w http.ResponseWriter, r *http.Request) {
+// GetStoragesStorageSnapshots operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -807,8 +4835,57 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageCopies(w http.ResponseWrit
 		return
 	}
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetStoragesStorageSnapshotsParams
+
+	// ------------- Optional query parameter "type" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "offset" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "offset", r.URL.Query(), &params.Offset)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "offset", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "order" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
+		return
+	}
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostStoragesStorageCopies(w, r, storage)
+		siw.Handler.GetStoragesStorageSnapshots(w, r, storage, params)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -818,8 +4895,8 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageCopies(w http.ResponseWrit
 	handler.ServeHTTP(w, r)
 }
 
-// PostStoragesStorageMoves operation middleware
-func (siw *ServerInterfaceWrapper) PostStoragesStorageMoves(w http.ResponseWriter, r *http.Request) {
+// PostStoragesStorageSnapshots operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -832,8 +4909,14 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageMoves(w http.ResponseWrite
 		return
 	}
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostStoragesStorageMoves(w, r, storage)
+		siw.Handler.PostStoragesStorageSnapshots(w, r, storage)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -843,8 +4926,8 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageMoves(w http.ResponseWrite
 	handler.ServeHTTP(w, r)
 }
 
-// GetStoragesStorageNodes operation middleware
-func (siw *ServerInterfaceWrapper) GetStoragesStorageNodes(w http.ResponseWriter, r *http.Request) {
+// GetStoragesStorageSnapshotsPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageSnapshotsPath(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -857,8 +4940,23 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageNodes(w http.ResponseWriter
 		return
 	}
 
+	// ------------- Path parameter "path..." -------------
+	var path string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	// Parameter object where we will unmarshal all parameters from the context
-	var params GetStoragesStorageNodesParams
+	var params GetStoragesStorageSnapshotsPathParams
 
 	// ------------- Optional query parameter "type" -------------
 
@@ -868,72 +4966,169 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageNodes(w http.ResponseWriter
 		return
 	}
 
-	// ------------- Optional query parameter "filter" -------------
+	// ------------- Optional query parameter "limit" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "filter", r.URL.Query(), &params.Filter)
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "filter", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "search" -------------
+	// ------------- Optional query parameter "offset" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "search", r.URL.Query(), &params.Search)
+	err = runtime.BindQueryParameter("form", true, false, "offset", r.URL.Query(), &params.Offset)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "search", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "offset", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "children" -------------
+	// ------------- Optional query parameter "sort" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "children", r.URL.Query(), &params.Children)
+	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "children", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "download" -------------
+	// ------------- Optional query parameter "order" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "download", r.URL.Query(), &params.Download)
+	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "download", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "sort" -------------
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageSnapshotsPath(w, r, storage, path, params)
+	}))
 
-	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostStoragesStorageStat operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageStat(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "order" -------------
+	ctx := r.Context()
 
-	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostStoragesStorageStat(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteStoragesStorageTagsPath operation middleware
+func (siw *ServerInterfaceWrapper) DeleteStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "fields" -------------
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
 
-	err = runtime.BindQueryParameter("form", true, false, "fields", r.URL.Query(), &params.Fields)
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "fields", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "snapshot" -------------
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params DeleteStoragesStorageTagsPathParams
+
+	// ------------- Required query parameter "tag" -------------
+
+	if paramValue := r.URL.Query().Get("tag"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandlerFunc(w, r, &RequiredParamError{ParamName: "tag"})
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "tag", r.URL.Query(), &params.Tag)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "tag", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteStoragesStorageTagsPath(w, r, storage, path, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetStoragesStorageTagsPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		return
+	}
+
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
 
-	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
 		return
 	}
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetStoragesStorageNodes(w, r, storage, params)
+		siw.Handler.GetStoragesStorageTagsPath(w, r, storage, path)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -943,8 +5138,8 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageNodes(w http.ResponseWriter
 	handler.ServeHTTP(w, r)
 }
 
-// PostStoragesStorageNodes operation middleware
-func (siw *ServerInterfaceWrapper) PostStoragesStorageNodes(w http.ResponseWriter, r *http.Request) {
+// PostStoragesStorageTagsPath operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -957,8 +5152,23 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageNodes(w http.ResponseWrite
 		return
 	}
 
+	// ------------- Path parameter "path..." -------------
+	var path NodePath
+
+	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostStoragesStorageNodes(w, r, storage)
+		siw.Handler.PostStoragesStorageTagsPath(w, r, storage, path)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -968,8 +5178,8 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageNodes(w http.ResponseWrite
 	handler.ServeHTTP(w, r)
 }
 
-// DeleteStoragesStorageNodesPath operation middleware
-func (siw *ServerInterfaceWrapper) DeleteStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+// GetStoragesStorageThumbnailsPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageThumbnailsPath(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -991,19 +5201,25 @@ func (siw *ServerInterfaceWrapper) DeleteStoragesStorageNodesPath(w http.Respons
 		return
 	}
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	// Parameter object where we will unmarshal all parameters from the context
-	var params DeleteStoragesStorageNodesPathParams
+	var params GetStoragesStorageThumbnailsPathParams
 
-	// ------------- Optional query parameter "recursive" -------------
+	// ------------- Optional query parameter "snapshot" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "recursive", r.URL.Query(), &params.Recursive)
+	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "recursive", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
 		return
 	}
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.DeleteStoragesStorageNodesPath(w, r, storage, path, params)
+		siw.Handler.GetStoragesStorageThumbnailsPath(w, r, storage, path, params)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1013,8 +5229,8 @@ func (siw *ServerInterfaceWrapper) DeleteStoragesStorageNodesPath(w http.Respons
 	handler.ServeHTTP(w, r)
 }
 
-// GetStoragesStorageNodesPath operation middleware
-func (siw *ServerInterfaceWrapper) GetStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+// DeleteStoragesStorageTrash operation middleware
+func (siw *ServerInterfaceWrapper) DeleteStoragesStorageTrash(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -1027,92 +5243,85 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageNodesPath(w http.ResponseWr
 		return
 	}
 
-	// ------------- Path parameter "path..." -------------
-	var path NodePath
+	ctx := r.Context()
 
-	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
-		return
-	}
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
 
-	// Parameter object where we will unmarshal all parameters from the context
-	var params GetStoragesStorageNodesPathParams
+	r = r.WithContext(ctx)
 
-	// ------------- Optional query parameter "type" -------------
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteStoragesStorageTrash(w, r, storage)
+	}))
 
-	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Optional query parameter "filter" -------------
+	handler.ServeHTTP(w, r)
+}
 
-	err = runtime.BindQueryParameter("form", true, false, "filter", r.URL.Query(), &params.Filter)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "filter", Err: err})
-		return
-	}
+// GetStoragesStorageTrash operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageTrash(w http.ResponseWriter, r *http.Request) {
 
-	// ------------- Optional query parameter "search" -------------
+	var err error
 
-	err = runtime.BindQueryParameter("form", true, false, "search", r.URL.Query(), &params.Search)
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "search", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "children" -------------
+	ctx := r.Context()
 
-	err = runtime.BindQueryParameter("form", true, false, "children", r.URL.Query(), &params.Children)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "children", Err: err})
-		return
-	}
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
 
-	// ------------- Optional query parameter "download" -------------
+	r = r.WithContext(ctx)
 
-	err = runtime.BindQueryParameter("form", true, false, "download", r.URL.Query(), &params.Download)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "download", Err: err})
-		return
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageTrash(w, r, storage)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Optional query parameter "sort" -------------
+	handler.ServeHTTP(w, r)
+}
 
-	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
-		return
-	}
+// DeleteStoragesStorageTrashId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteStoragesStorageTrashId(w http.ResponseWriter, r *http.Request) {
 
-	// ------------- Optional query parameter "order" -------------
+	var err error
 
-	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
+	// ------------- Path parameter "storage" -------------
+	var storage Storage
+
+	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "fields" -------------
+	// ------------- Path parameter "id" -------------
+	var id TrashId
 
-	err = runtime.BindQueryParameter("form", true, false, "fields", r.URL.Query(), &params.Fields)
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "fields", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "snapshot" -------------
+	ctx := r.Context()
 
-	err = runtime.BindQueryParameter("form", true, false, "snapshot", r.URL.Query(), &params.Snapshot)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "snapshot", Err: err})
-		return
-	}
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetStoragesStorageNodesPath(w, r, storage, path, params)
+		siw.Handler.DeleteStoragesStorageTrashId(w, r, storage, id)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1122,8 +5331,8 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageNodesPath(w http.ResponseWr
 	handler.ServeHTTP(w, r)
 }
 
-// PatchStoragesStorageNodesPath operation middleware
-func (siw *ServerInterfaceWrapper) PatchStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+// PostStoragesStorageTrashIdRestore operation middleware
+func (siw *ServerInterfaceWrapper) PostStoragesStorageTrashIdRestore(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -1136,17 +5345,23 @@ func (siw *ServerInterfaceWrapper) PatchStoragesStorageNodesPath(w http.Response
 		return
 	}
 
-	// ------------- Path parameter "path..." -------------
-	var path NodePath
+	// ------------- Path parameter "id" -------------
+	var id TrashId
 
-	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
 		return
 	}
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PatchStoragesStorageNodesPath(w, r, storage, path)
+		siw.Handler.PostStoragesStorageTrashIdRestore(w, r, storage, id)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1156,8 +5371,8 @@ func (siw *ServerInterfaceWrapper) PatchStoragesStorageNodesPath(w http.Response
 	handler.ServeHTTP(w, r)
 }
 
-// PostStoragesStorageNodesPath operation middleware
-func (siw *ServerInterfaceWrapper) PostStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request) {
+// GetStoragesStorageVerificationsPath operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageVerificationsPath(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -1179,8 +5394,14 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageNodesPath(w http.ResponseW
 		return
 	}
 
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostStoragesStorageNodesPath(w, r, storage, path)
+		siw.Handler.GetStoragesStorageVerificationsPath(w, r, storage, path)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1190,8 +5411,8 @@ func (siw *ServerInterfaceWrapper) PostStoragesStorageNodesPath(w http.ResponseW
 	handler.ServeHTTP(w, r)
 }
 
-// GetStoragesStorageSnapshots operation middleware
-func (siw *ServerInterfaceWrapper) GetStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request) {
+// GetStoragesStorageZfs operation middleware
+func (siw *ServerInterfaceWrapper) GetStoragesStorageZfs(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
@@ -1204,51 +5425,34 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageSnapshots(w http.ResponseWr
 		return
 	}
 
-	// Parameter object where we will unmarshal all parameters from the context
-	var params GetStoragesStorageSnapshotsParams
+	ctx := r.Context()
 
-	// ------------- Optional query parameter "type" -------------
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
 
-	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
-		return
-	}
+	r = r.WithContext(ctx)
 
-	// ------------- Optional query parameter "limit" -------------
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetStoragesStorageZfs(w, r, storage)
+	}))
 
-	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Optional query parameter "offset" -------------
-
-	err = runtime.BindQueryParameter("form", true, false, "offset", r.URL.Query(), &params.Offset)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "offset", Err: err})
-		return
-	}
+	handler.ServeHTTP(w, r)
+}
 
-	// ------------- Optional query parameter "sort" -------------
+// GetTags operation middleware
+func (siw *ServerInterfaceWrapper) GetTags(w http.ResponseWriter, r *http.Request) {
 
-	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
-		return
-	}
+	ctx := r.Context()
 
-	// ------------- Optional query parameter "order" -------------
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
 
-	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
-		return
-	}
+	r = r.WithContext(ctx)
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetStoragesStorageSnapshots(w, r, storage, params)
+		siw.Handler.GetTags(w, r)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1258,74 +5462,113 @@ func (siw *ServerInterfaceWrapper) GetStoragesStorageSnapshots(w http.ResponseWr
 	handler.ServeHTTP(w, r)
 }
 
-// GetStoragesStorageSnapshotsPath operation middleware
-func (siw *ServerInterfaceWrapper) GetStoragesStorageSnapshotsPath(w http.ResponseWriter, r *http.Request) {
+// GetTagsTag operation middleware
+func (siw *ServerInterfaceWrapper) GetTagsTag(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 
-	// ------------- Path parameter "storage" -------------
-	var storage Storage
+	// ------------- Path parameter "tag" -------------
+	var tag string
 
-	err = runtime.BindStyledParameterWithOptions("simple", "storage", r.PathValue("storage"), &storage, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	err = runtime.BindStyledParameterWithOptions("simple", "tag", r.PathValue("tag"), &tag, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "storage", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "tag", Err: err})
 		return
 	}
 
-	// ------------- Path parameter "path..." -------------
-	var path string
+	ctx := r.Context()
 
-	err = runtime.BindStyledParameterWithOptions("simple", "path", r.PathValue("path"), &path, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "path...", Err: err})
-		return
-	}
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
 
-	// Parameter object where we will unmarshal all parameters from the context
-	var params GetStoragesStorageSnapshotsPathParams
+	r = r.WithContext(ctx)
 
-	// ------------- Optional query parameter "type" -------------
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetTagsTag(w, r, tag)
+	}))
 
-	err = runtime.BindQueryParameter("form", true, false, "type", r.URL.Query(), &params.Type)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "type", Err: err})
-		return
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Optional query parameter "limit" -------------
+	handler.ServeHTTP(w, r)
+}
 
-	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
-		return
+// GetTokens operation middleware
+func (siw *ServerInterfaceWrapper) GetTokens(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetTokens(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Optional query parameter "offset" -------------
+	handler.ServeHTTP(w, r)
+}
 
-	err = runtime.BindQueryParameter("form", true, false, "offset", r.URL.Query(), &params.Offset)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "offset", Err: err})
-		return
+// PostTokens operation middleware
+func (siw *ServerInterfaceWrapper) PostTokens(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostTokens(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
-	// ------------- Optional query parameter "sort" -------------
+	handler.ServeHTTP(w, r)
+}
 
-	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
+// DeleteTokensId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteTokensId(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "id" -------------
+	var id string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "id", r.PathValue("id"), &id, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
 	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "id", Err: err})
 		return
 	}
 
-	// ------------- Optional query parameter "order" -------------
+	ctx := r.Context()
 
-	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
-	if err != nil {
-		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
-		return
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteTokensId(w, r, id)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
 	}
 
+	handler.ServeHTTP(w, r)
+}
+
+// GetVersion operation middleware
+func (siw *ServerInterfaceWrapper) GetVersion(w http.ResponseWriter, r *http.Request) {
+
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetStoragesStorageSnapshotsPath(w, r, storage, path, params)
+		siw.Handler.GetVersion(w, r)
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -1455,11 +5698,47 @@ func HandlerWithOptions(si ServerInterface, options StdHTTPServerOptions) http.H
 		ErrorHandlerFunc:   options.ErrorHandlerFunc,
 	}
 
+	m.HandleFunc("GET "+options.BaseURL+"/admin/export", wrapper.GetAdminExport)
+	m.HandleFunc("POST "+options.BaseURL+"/admin/import", wrapper.PostAdminImport)
+	m.HandleFunc("POST "+options.BaseURL+"/admin/reload", wrapper.PostAdminReload)
+	m.HandleFunc("GET "+options.BaseURL+"/bookmarks", wrapper.GetBookmarks)
+	m.HandleFunc("POST "+options.BaseURL+"/bookmarks", wrapper.PostBookmarks)
+	m.HandleFunc("DELETE "+options.BaseURL+"/bookmarks/{id}", wrapper.DeleteBookmarksId)
+	m.HandleFunc("DELETE "+options.BaseURL+"/comments/{id}", wrapper.DeleteCommentsId)
+	m.HandleFunc("GET "+options.BaseURL+"/healthz", wrapper.GetHealthz)
+	m.HandleFunc("GET "+options.BaseURL+"/jobs", wrapper.GetJobs)
+	m.HandleFunc("GET "+options.BaseURL+"/jobs/history", wrapper.GetJobsHistory)
+	m.HandleFunc("DELETE "+options.BaseURL+"/jobs/{id}", wrapper.DeleteJobsId)
+	m.HandleFunc("GET "+options.BaseURL+"/jobs/{id}", wrapper.GetJobsId)
+	m.HandleFunc("GET "+options.BaseURL+"/metrics", wrapper.GetMetrics)
+	m.HandleFunc("GET "+options.BaseURL+"/pins", wrapper.GetPins)
+	m.HandleFunc("POST "+options.BaseURL+"/pins", wrapper.PostPins)
+	m.HandleFunc("DELETE "+options.BaseURL+"/pins/{name}", wrapper.DeletePinsName)
+	m.HandleFunc("GET "+options.BaseURL+"/readyz", wrapper.GetReadyz)
+	m.HandleFunc("DELETE "+options.BaseURL+"/recent", wrapper.DeleteRecent)
+	m.HandleFunc("GET "+options.BaseURL+"/recent", wrapper.GetRecent)
+	m.HandleFunc("GET "+options.BaseURL+"/schedules", wrapper.GetSchedules)
+	m.HandleFunc("POST "+options.BaseURL+"/schedules/{name}/runs", wrapper.PostSchedulesNameRuns)
 	m.HandleFunc("GET "+options.BaseURL+"/storages", wrapper.GetStorages)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/events", wrapper.GetStoragesEvents)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/activity", wrapper.GetStoragesStorageActivity)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/activity/{path...}", wrapper.GetStoragesStorageActivityPath)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/activity/{path...}", wrapper.PostStoragesStorageActivityPath)
 	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/archives", wrapper.GetStoragesStorageArchives)
 	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/archives", wrapper.PostStoragesStorageArchives)
 	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/archives/{path}", wrapper.PostStoragesStorageArchivesPath)
 	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/copies", wrapper.PostStoragesStorageCopies)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/deltas/{path...}", wrapper.PostStoragesStorageDeltasPath)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/downloads", wrapper.PostStoragesStorageDownloads)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/eject", wrapper.PostStoragesStorageEject)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/exports", wrapper.PostStoragesStorageExports)
+	m.HandleFunc("DELETE "+options.BaseURL+"/storages/{storage}/index", wrapper.DeleteStoragesStorageIndex)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/index", wrapper.GetStoragesStorageIndex)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/index", wrapper.PostStoragesStorageIndex)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/index/pause", wrapper.PostStoragesStorageIndexPause)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/index/resume", wrapper.PostStoragesStorageIndexResume)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/manifests", wrapper.GetStoragesStorageManifests)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/manifests/{path...}", wrapper.GetStoragesStorageManifestsPath)
 	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/moves", wrapper.PostStoragesStorageMoves)
 	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/nodes", wrapper.GetStoragesStorageNodes)
 	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/nodes", wrapper.PostStoragesStorageNodes)
@@ -1467,8 +5746,33 @@ func HandlerWithOptions(si ServerInterface, options StdHTTPServerOptions) http.H
 	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/nodes/{path...}", wrapper.GetStoragesStorageNodesPath)
 	m.HandleFunc("PATCH "+options.BaseURL+"/storages/{storage}/nodes/{path...}", wrapper.PatchStoragesStorageNodesPath)
 	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/nodes/{path...}", wrapper.PostStoragesStorageNodesPath)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/render/{path...}", wrapper.GetStoragesStorageRenderPath)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/reports/largest", wrapper.GetStoragesStorageReportsLargest)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/reports/recent", wrapper.GetStoragesStorageReportsRecent)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/reports/snapshots", wrapper.GetStoragesStorageReportsSnapshots)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/retention", wrapper.GetStoragesStorageRetention)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/signatures/{path...}", wrapper.GetStoragesStorageSignaturesPath)
+	m.HandleFunc("DELETE "+options.BaseURL+"/storages/{storage}/snapshots", wrapper.DeleteStoragesStorageSnapshots)
 	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/snapshots", wrapper.GetStoragesStorageSnapshots)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/snapshots", wrapper.PostStoragesStorageSnapshots)
 	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/snapshots/{path...}", wrapper.GetStoragesStorageSnapshotsPath)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/stat", wrapper.PostStoragesStorageStat)
+	m.HandleFunc("DELETE "+options.BaseURL+"/storages/{storage}/tags/{path...}", wrapper.DeleteStoragesStorageTagsPath)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/tags/{path...}", wrapper.GetStoragesStorageTagsPath)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/tags/{path...}", wrapper.PostStoragesStorageTagsPath)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/thumbnails/{path...}", wrapper.GetStoragesStorageThumbnailsPath)
+	m.HandleFunc("DELETE "+options.BaseURL+"/storages/{storage}/trash", wrapper.DeleteStoragesStorageTrash)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/trash", wrapper.GetStoragesStorageTrash)
+	m.HandleFunc("DELETE "+options.BaseURL+"/storages/{storage}/trash/{id}", wrapper.DeleteStoragesStorageTrashId)
+	m.HandleFunc("POST "+options.BaseURL+"/storages/{storage}/trash/{id}/restore", wrapper.PostStoragesStorageTrashIdRestore)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/verifications/{path...}", wrapper.GetStoragesStorageVerificationsPath)
+	m.HandleFunc("GET "+options.BaseURL+"/storages/{storage}/zfs", wrapper.GetStoragesStorageZfs)
+	m.HandleFunc("GET "+options.BaseURL+"/tags", wrapper.GetTags)
+	m.HandleFunc("GET "+options.BaseURL+"/tags/{tag}", wrapper.GetTagsTag)
+	m.HandleFunc("GET "+options.BaseURL+"/tokens", wrapper.GetTokens)
+	m.HandleFunc("POST "+options.BaseURL+"/tokens", wrapper.PostTokens)
+	m.HandleFunc("DELETE "+options.BaseURL+"/tokens/{id}", wrapper.DeleteTokensId)
+	m.HandleFunc("GET "+options.BaseURL+"/version", wrapper.GetVersion)
 
 	return m
 }
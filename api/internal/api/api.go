@@ -1,63 +1,390 @@
 package api
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"timeship/internal/access"
+	"timeship/internal/activity"
+	"timeship/internal/hook"
+	"timeship/internal/jobs"
+	"timeship/internal/metacache"
+	"timeship/internal/pdfpreview"
+	"timeship/internal/recent"
+	"timeship/internal/scan"
 	"timeship/internal/storage"
+	"timeship/internal/storage/jail"
+	"timeship/internal/tags"
+	"timeship/internal/tokens"
+	"timeship/internal/webhook"
+
+	"golang.org/x/time/rate"
 )
 
+// Config holds optional server configuration
+type Config struct {
+	// ContentDigest adds a Repr-Digest header with the SHA-256 of the file
+	// to responses sending all of it. This requires reading the file twice.
+	ContentDigest bool
+
+	// SigningKey signs integrity manifests if set
+	SigningKey ed25519.PrivateKey
+
+	// Build describes the running binary for the version endpoint
+	Build BuildInfo
+
+	// ReadinessTimeout limits how long each storage readiness check may
+	// take, defaults to 5 seconds
+	ReadinessTimeout time.Duration
+
+	// ReadTimeout and WriteTimeout are the timeouts of the HTTP server.
+	// Uploads and file downloads extend their deadlines while data keeps
+	// flowing, so only stalled transfers are cut off. Zero disables this.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// StreamRateLimit limits each file download to this many bytes per
+	// second, zero means unlimited
+	StreamRateLimit int64
+
+	// TotalRateLimit limits all file downloads together to this many bytes
+	// per second, zero means unlimited
+	TotalRateLimit int64
+
+	// MetadataCache answers snapshot summaries of directory listings from
+	// indexed snapshots and indexes the rest in the background, nil disables
+	// caching
+	MetadataCache *metacache.Indexer
+
+	// PDFRenderer renders thumbnails of PDFs, nil disables thumbnails
+	PDFRenderer *pdfpreview.Renderer
+
+	// Scanner scans uploaded and saved content for viruses before it's
+	// stored, nil disables scanning
+	Scanner scan.Scanner
+
+	// Notifier sends webhooks on uploads, deletes, restores and new
+	// snapshots, nil disables webhooks
+	Notifier *webhook.Notifier
+
+	// Hooks runs commands before and after writes, deletes, restores and
+	// new snapshots, nil disables hooks
+	Hooks *hook.Runner
+
+	// Jobs runs long operations like exports in the background, defaults
+	// to a manager keeping jobs.DefaultKeep finished jobs. The server closes
+	// it.
+	Jobs *jobs.Manager
+
+	// JobHistory keeps finished jobs after the manager forgot them, nil
+	// disables the job history. The server closes it after the jobs.
+	JobHistory *jobs.History
+
+	// ResumeJobs starts the jobs interrupted by the last shutdown again,
+	// which needs the job history
+	ResumeJobs bool
+
+	// Schedules are tasks started as jobs whenever their schedule matches
+	Schedules []ScheduledTask
+
+	// SnapshotMaxAge is how old the newest snapshot of a storage may be by
+	// storage name. These storages are checked periodically and reported as
+	// stale by the health endpoint, the metrics and notifications.
+	SnapshotMaxAge map[string]time.Duration
+
+	// FreshnessInterval is how often the snapshots of the storages with a
+	// maximum age are checked, defaults to 5 minutes
+	FreshnessInterval time.Duration
+
+	// Access restricts requests to the storages and paths granted to the
+	// user of their token by the Authorize middleware, nil allows all
+	Access *access.Policy
+
+	// Tokens stores the API tokens issued by users, nil disables issuing
+	// tokens. The store must also be the issuer of Access.
+	Tokens *tokens.Store
+
+	// Tags stores the tags and bookmarks users put on nodes, nil disables
+	// tagging
+	Tags *tags.Store
+
+	// Activity records what happens to nodes and stores comments on them,
+	// nil disables the activity feed
+	Activity *activity.Store
+
+	// Recent remembers the paths each user browsed and downloaded most
+	// recently, nil disables tracking
+	Recent *recent.Tracker
+
+	// ActiveContent is how files browsers could run scripts of are served,
+	// see active.go, defaults to ActiveContentSandbox
+	ActiveContent string
+
+	// CSRF tells the UI that state-changing requests must repeat the CSRF
+	// token, as the CSRF middleware is in front of the server
+	CSRF bool
+
+	// Branding is passed to the UI to tell instances apart
+	Branding UIBranding
+
+	// Reload reloads the configuration, usually by calling Server.Reload
+	// with the storages and access policy of the config file, nil disables
+	// reloading through the API
+	Reload func() error
+
+	// ExportConfig returns the effective configuration as YAML with its
+	// secrets for bundles, nil disables exporting
+	ExportConfig func() ([]byte, error)
+
+	// EjectDrive stops serving the storage of a removable drive, failing
+	// with fs.ErrNotExist for other storages, nil without removable drives
+	EjectDrive func(name string) error
+}
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version string
+	Commit  string
+	Date    string
+	BuiltBy string
+}
+
 // Server implements the ServerInterface
 type Server struct {
+	// mu guards storages, which change when snapshots are pinned or the
+	// config is reloaded
+	mu             sync.RWMutex
 	storages       map[string]storage.Storage
 	defaultStorage string
+	config         Config
+
+	// pins are the names of the storages pinned through the API, guarded
+	// by mu
+	pins map[string]bool
+
+	// generation counts the requests in flight since the last reload,
+	// guarded by mu. retired waits for replaced storages to be closed.
+	generation *generation
+	retired    sync.WaitGroup
+
+	// accessPolicy is the access policy, starting as config.Access until
+	// the config is reloaded
+	accessPolicy atomic.Pointer[access.Policy]
+
+	// totalLimiter is shared by all downloads, nil if unlimited
+	totalLimiter *rate.Limiter
+
+	// updateLocks serializes conditional updates of the same nodes
+	updateLocks pathLocks
+
+	// scheduler starts the scheduled tasks, nil without any
+	scheduler *jobs.Scheduler
+
+	// freshness checks for recent snapshots, nil without storages with a
+	// maximum snapshot age
+	freshness *freshnessMonitor
+
+	// draining is set once Drain was called, inFlight counts the requests
+	// in flight except health checks
+	draining atomic.Pointer[drainState]
+	inFlight atomic.Int64
+
+	// events delivers storage changes to the clients streaming them
+	events storageEvents
+
+	// lockedOut and unauthenticated count the requests rejected by the
+	// access policy, reported on /metrics
+	lockedOut       atomic.Int64
+	unauthenticated atomic.Int64
 }
 
-// NewServer creates a new API server
+// NewServer creates a new API server with default configuration
 // defaultStorage specifies which storage to use as default
 // Returns an error if the defaultStorage is not found in the storages map
 func NewServer(storages map[string]storage.Storage, defaultStorage string) (*Server, error) {
+	return NewServerWithConfig(storages, defaultStorage, Config{})
+}
+
+// NewServerWithConfig creates a new API server with custom configuration
+func NewServerWithConfig(storages map[string]storage.Storage, defaultStorage string, config Config) (*Server, error) {
 	if defaultStorage != "" {
 		if _, ok := storages[defaultStorage]; !ok {
 			return nil, fmt.Errorf("default storage %q not found in storages map", defaultStorage)
 		}
 	}
+	if err := validActiveContent(config.ActiveContent); err != nil {
+		return nil, err
+	}
+	if config.Jobs == nil {
+		config.Jobs = jobs.New(jobs.DefaultKeep)
+	}
 
-	return &Server{
+	s := &Server{
 		storages:       storages,
 		defaultStorage: defaultStorage,
-	}, nil
+		config:         config,
+		pins:           map[string]bool{},
+		generation:     &generation{},
+		totalLimiter:   newRateLimiter(config.TotalRateLimit),
+	}
+	s.accessPolicy.Store(config.Access)
+	config.Jobs.OnFinish(s.jobFinished)
+
+	scheduled, err := s.scheduledJobs(config.Schedules)
+	if err != nil {
+		return nil, err
+	}
+	if len(scheduled) > 0 {
+		s.scheduler = jobs.NewScheduler(config.Jobs, scheduled)
+	}
+	if len(config.SnapshotMaxAge) > 0 {
+		s.startFreshnessMonitor()
+	}
+	if config.ResumeJobs && config.JobHistory != nil {
+		s.resumeJobs()
+	}
+	return s, nil
 }
 
 // getStorage returns the storage for the given name.
-// Returns the storage and an error if the storage is not found.
-func (s *Server) getStorage(name string) (storage.Storage, error) {
+// Returns the storage and an error if the storage is not found. Users with
+// a home in the storage get a view of their home.
+func (s *Server) getStorage(ctx context.Context, name string) (storage.Storage, error) {
 	if name == "" {
 		return nil, fmt.Errorf("storage name is required")
 	}
 
+	s.mu.RLock()
 	adpt, ok := s.storages[name]
+	s.mu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("storage not found: %s", name)
 	}
 
+	// Users with a home only see their home of its storage
+	if user := access.FromContext(ctx); user != nil && user.HomeStorage == name {
+		return jail.New(adpt, user.HomePath), nil
+	}
 	return adpt, nil
 }
 
+// storageNames returns the names of all storages, sorted alphabetically
+func (s *Server) storageNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.storages))
+	for name := range s.storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // sendError sends a RFC 9457 Problem Details error response
-func (s *Server) sendError(w http.ResponseWriter, title string, status int, detail string, instance string) {
+func (s *Server) sendError(w http.ResponseWriter, p problem, detail string, instance string) {
 	response := ErrorResponse{
-		Message: fmt.Sprintf("%s: %s", title, detail),
-		Status:  false,
+		Type:   problemTypePrefix + p.code,
+		Title:  p.title,
+		Status: p.status,
+		Code:   p.code,
+	}
+	if detail != "" {
+		response.Detail = &detail
+	}
+	if instance != "" {
+		response.Instance = &instance
 	}
 
 	w.Header().Set("Content-Type", "application/problem+json")
-	w.WriteHeader(status)
+	w.WriteHeader(p.status)
 	json.NewEncoder(w).Encode(response)
 }
 
+// ParamError sends a problem details response for requests with parameters
+// the router can't bind, for use as the ErrorHandlerFunc of the handler
+func (s *Server) ParamError(w http.ResponseWriter, r *http.Request, err error) {
+	s.sendError(w, problemInvalidParameter, err.Error(), r.URL.Path)
+}
+
+// problemTypePrefix prefixes the code of a problem to form its type URI
+const problemTypePrefix = "urn:timeship:problem:"
+
+// notify sends a webhook event if webhooks are configured
+func (s *Server) notify(event webhook.Event) {
+	if s.config.Notifier != nil {
+		s.config.Notifier.Notify(event)
+	}
+}
+
+// beforeHooks runs the before hooks of an operation if hooks are configured
+func (s *Server) beforeHooks(ctx context.Context, op hook.Operation) error {
+	if s.config.Hooks == nil {
+		return nil
+	}
+	return s.config.Hooks.Before(ctx, op)
+}
+
+// afterHooks starts the after hooks of an operation if hooks are configured
+func (s *Server) afterHooks(op hook.Operation) {
+	if s.config.Hooks != nil {
+		s.config.Hooks.After(op)
+	}
+}
+
 // sendNotImplemented sends a 501 Not Implemented response
 func (s *Server) sendNotImplemented(w http.ResponseWriter, r *http.Request) {
-	s.sendError(w, "Not Implemented", http.StatusNotImplemented, "This operation is not yet implemented", r.URL.Path)
+	s.sendError(w, problemNotImplemented, "This operation is not yet implemented", r.URL.Path)
+}
+
+// errorProblem maps a storage error to the problem it reports
+func errorProblem(err error) problem {
+	switch {
+	case errors.Is(err, storage.ErrNotSupported):
+		return problemNotSupported
+	case errors.Is(err, storage.ErrSpecialFile):
+		return problemSpecialFile
+	case errors.As(err, new(*scan.InfectedError)):
+		return problemInfectedFile
+	case errors.Is(err, scan.ErrScanFailed):
+		return problemScanFailed
+	case errors.Is(err, hook.ErrFailed):
+		return problemHookFailed
+	case errors.Is(err, storage.ErrInvalidOffset):
+		return problemInvalidOffset
+	case errors.Is(err, storage.ErrOutsideRoot):
+		return problemPathOutsideRoot
+	case errors.Is(err, fs.ErrInvalid), errors.Is(err, syscall.ENAMETOOLONG):
+		return problemInvalidPath
+	case errors.Is(err, storage.ErrSnapshotNotFound):
+		return problemSnapshotNotFound
+	case errors.Is(err, fs.ErrNotExist):
+		return problemNodeNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return problemPermissionDenied
+	case errors.Is(err, syscall.ENOTEMPTY):
+		// ENOTEMPTY also matches fs.ErrExist
+		return problemDirectoryNotEmpty
+	case errors.Is(err, fs.ErrExist):
+		return problemAlreadyExists
+	case errors.Is(err, syscall.ENOTDIR):
+		return problemNotADirectory
+	default:
+		return problemInternal
+	}
+}
+
+// sendStorageError sends an error response with the problem a storage error reports
+func (s *Server) sendStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	s.sendError(w, errorProblem(err), err.Error(), r.URL.Path)
 }
@@ -1,16 +1,65 @@
 package api
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
 	"io"
+	"io/fs"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	"timeship/internal/access"
+	"timeship/internal/activity"
+	"timeship/internal/archive"
+	"timeship/internal/hook"
+	"timeship/internal/jobs"
+	"timeship/internal/manifest"
+	"timeship/internal/metacache"
+	"timeship/internal/pdfpreview"
+	"timeship/internal/recent"
+	"timeship/internal/scan"
 	"timeship/internal/storage"
+	"timeship/internal/storage/local"
+	"timeship/internal/tags"
+	"timeship/internal/tokens"
+	"timeship/internal/webhook"
+
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // mockStorageV2 implements storage.Lister and storage.Reader for testing v2 API
@@ -170,54 +219,63 @@ func TestNotImplementedOperations(t *testing.T) {
 	tests := []struct {
 		name    string
 		handler func(w http.ResponseWriter, r *http.Request)
+		code    string
 	}{
 		{
 			name: "DeleteStoragesStorageNodesPath",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				server.DeleteStoragesStorageNodesPath(w, r, "local", "test", DeleteStoragesStorageNodesPathParams{})
 			},
+			code: "not_supported",
 		},
 		{
 			name: "PatchStoragesStorageNodesPath",
 			handler: func(w http.ResponseWriter, r *http.Request) {
-				server.PatchStoragesStorageNodesPath(w, r, "local", "test")
+				server.PatchStoragesStorageNodesPath(w, r, "local", "test", PatchStoragesStorageNodesPathParams{})
 			},
+			code: "not_supported",
 		},
 		{
 			name: "PostStoragesStorageNodesPath",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				server.PostStoragesStorageNodesPath(w, r, "local", "test")
 			},
+			code: "not_supported",
 		},
 		{
 			name: "PostStoragesStorageCopies",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				server.PostStoragesStorageCopies(w, r, "local")
 			},
+			code: "not_supported",
 		},
 		{
 			name: "PostStoragesStorageMoves",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				server.PostStoragesStorageMoves(w, r, "local")
 			},
+			code: "not_implemented",
 		},
 		{
 			name: "GetStoragesStorageArchives",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				server.GetStoragesStorageArchives(w, r, "local", GetStoragesStorageArchivesParams{})
 			},
+			code: "not_implemented",
 		},
 		{
 			name: "PostStoragesStorageArchives",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				server.PostStoragesStorageArchives(w, r, "local", PostStoragesStorageArchivesParams{})
 			},
+			code: "not_supported",
 		},
 		{
 			name: "PostStoragesStorageArchivesPath",
 			handler: func(w http.ResponseWriter, r *http.Request) {
 				server.PostStoragesStorageArchivesPath(w, r, "local", "test.zip")
 			},
+			code: "not_implemented",
 		},
 	}
 
@@ -238,12 +296,12 @@ func TestNotImplementedOperations(t *testing.T) {
 				t.Fatalf("failed to decode error response: %v", err)
 			}
 
-			if errorResp.Status != false {
-				t.Errorf("expected error status false, got %v", errorResp.Status)
+			if errorResp.Status != http.StatusNotImplemented {
+				t.Errorf("expected error status 501, got %v", errorResp.Status)
 			}
 
-			if !strings.Contains(errorResp.Message, "Not Implemented") {
-				t.Errorf("expected message containing 'Not Implemented', got '%s'", errorResp.Message)
+			if errorResp.Code != tt.code || errorResp.Type != "urn:timeship:problem:"+tt.code {
+				t.Errorf("expected %s problem, got %+v", tt.code, errorResp)
 			}
 		})
 	}
@@ -442,8 +500,8 @@ func TestGetStoragesStorageNodesPath_FileContent(t *testing.T) {
 		server.GetStoragesStorageNodesPath(w, req, "local", "test.txt", GetStoragesStorageNodesPathParams{})
 
 		resp := w.Result()
-		if resp.StatusCode != http.StatusNotFound {
-			t.Errorf("expected status 404, got %d", resp.StatusCode)
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", resp.StatusCode)
 		}
 	})
 
@@ -470,8 +528,8 @@ func TestGetStoragesStorageNodesPath_FileContent(t *testing.T) {
 		server.GetStoragesStorageNodesPath(w, req, "local", "test.txt", GetStoragesStorageNodesPathParams{})
 
 		resp := w.Result()
-		if resp.StatusCode != http.StatusNotFound {
-			t.Errorf("expected status 404, got %d", resp.StatusCode)
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", resp.StatusCode)
 		}
 	})
 
@@ -499,8 +557,36 @@ func TestGetStoragesStorageNodesPath_FileContent(t *testing.T) {
 		server.GetStoragesStorageNodesPath(w, req, "local", "test.txt", GetStoragesStorageNodesPathParams{})
 
 		resp := w.Result()
-		if resp.StatusCode != http.StatusNotFound {
-			t.Errorf("expected status 404, got %d", resp.StatusCode)
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("classified errors", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			mock   *mockStorageV2
+			status int
+		}{
+			{"missing", &mockStorageV2{mimeTypeErr: &fs.PathError{Op: "open", Path: "test.txt", Err: fs.ErrNotExist}, isFile: true}, http.StatusNotFound},
+			{"missing snapshot", &mockStorageV2{mimeType: "text/plain", sizeErr: fmt.Errorf("open: %w", storage.ErrSnapshotNotFound), isFile: true}, http.StatusNotFound},
+			{"permission denied", &mockStorageV2{mimeType: "text/plain", size: 100, readErr: &fs.PathError{Op: "open", Path: "test.txt", Err: fs.ErrPermission}, isFile: true}, http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			server, err := NewServer(map[string]storage.Storage{"local": tt.mock}, "local")
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/test.txt", nil)
+			req.Header.Set("Accept", "application/octet-stream")
+			w := httptest.NewRecorder()
+
+			server.GetStoragesStorageNodesPath(w, req, "local", "test.txt", GetStoragesStorageNodesPathParams{})
+
+			if w.Code != tt.status {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+			}
 		}
 	})
 
@@ -567,4 +653,6607 @@ func TestGetStoragesStorageNodesPath_FileContent(t *testing.T) {
 			t.Errorf("expected attachment disposition, got '%s'", contentDisposition)
 		}
 	})
+
+	t.Run("with inline parameter", func(t *testing.T) {
+		content := "%PDF-1.4"
+		mock := &mockStorageV2{
+			content:  content,
+			mimeType: "application/pdf",
+			size:     int64(len(content)),
+			isFile:   true,
+		}
+		server, err := NewServer(map[string]storage.Storage{"local": mock}, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		inline := true
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/docs/Račun.pdf", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "docs/Račun.pdf", GetStoragesStorageNodesPathParams{Inline: &inline})
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		want := `inline; filename="Ra_un.pdf"; filename*=UTF-8''Ra%C4%8Dun.pdf`
+		if got := resp.Header.Get("Content-Disposition"); got != want {
+			t.Errorf("expected disposition %s, got %s", want, got)
+		}
+
+		download := true
+		w = httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "docs/Račun.pdf", GetStoragesStorageNodesPathParams{Inline: &inline, Download: &download})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for download and inline, got %d", w.Code)
+		}
+	})
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain", "report.pdf", `attachment; filename="report.pdf"`},
+		{"spaces", "annual report.pdf", `attachment; filename="annual report.pdf"`},
+		{"quotes", `say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"backslash", `a\b.txt`, `attachment; filename="a_b.txt"; filename*=UTF-8''a%5Cb.txt`},
+		{"non-ascii", "Počitnice 2024.jpg", `attachment; filename="Po_itnice 2024.jpg"; filename*=UTF-8''Po%C4%8Ditnice%202024.jpg`},
+		{"emoji", "🎉.png", `attachment; filename="_.png"; filename*=UTF-8''%F0%9F%8E%89.png`},
+		{"percent", "100%.txt", `attachment; filename="100%.txt"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contentDisposition("attachment", tt.filename)
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+			// Clients decode the exact name from filename*
+			_, params, err := mime.ParseMediaType(got)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", got, err)
+			}
+			if params["filename"] != tt.filename {
+				t.Errorf("expected filename %q to round trip, got %q", tt.filename, params["filename"])
+			}
+		})
+	}
+}
+
+func TestContentDigest(t *testing.T) {
+	content := "hello"
+	mock := &mockStorageV2{
+		content:  content,
+		mimeType: "text/plain",
+		size:     int64(len(content)),
+		isFile:   true,
+	}
+	storages := map[string]storage.Storage{
+		"local": mock,
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		server, err := NewServer(storages, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/hello.txt", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "hello.txt", GetStoragesStorageNodesPathParams{})
+
+		if digest := w.Result().Header.Get("Repr-Digest"); digest != "" {
+			t.Errorf("expected no Repr-Digest header, got %q", digest)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		server, err := NewServerWithConfig(storages, "local", Config{ContentDigest: true})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/hello.txt", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "hello.txt", GetStoragesStorageNodesPathParams{})
+
+		resp := w.Result()
+		expected := "sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:"
+		if digest := resp.Header.Get("Repr-Digest"); digest != expected {
+			t.Errorf("expected Repr-Digest %q, got %q", expected, digest)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != content {
+			t.Errorf("expected body %q, got %q", content, string(body))
+		}
+	})
+
+	t.Run("only for whole files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		os.WriteFile(filepath.Join(tmpDir, "hello.txt"), []byte(content), 0644)
+		store, err := local.New(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{ContentDigest: true})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		handler := Handler(server)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/storages/local/nodes/hello.txt", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Repr-Digest") == "" {
+			t.Fatalf("expected 200 with Repr-Digest, got %d %v", w.Code, w.Header())
+		}
+		etag := w.Header().Get("ETag")
+
+		for name, header := range map[string]http.Header{
+			"range":        {"Range": {"bytes=0-1"}},
+			"not modified": {"If-None-Match": {etag}},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/hello.txt", nil)
+			maps.Copy(req.Header, header)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code == http.StatusOK || w.Header().Get("Repr-Digest") != "" {
+				t.Errorf("%s: expected no Repr-Digest, got %d %v", name, w.Code, w.Header())
+			}
+		}
+	})
+}
+
+func TestActiveContent(t *testing.T) {
+	tests := []struct {
+		mode        string
+		mimeType    string
+		contentType string
+		csp         string
+		nosniff     bool
+	}{
+		{"", "text/html; charset=utf-8", "text/html; charset=utf-8", "sandbox", true},
+		{"", "image/svg+xml", "image/svg+xml", "sandbox", true},
+		{"", "application/rss+xml", "application/rss+xml", "sandbox", true},
+		{"", "text/plain", "text/plain", "", true},
+		{"", "image/png", "image/png", "", true},
+		{ActiveContentSandbox, "application/xhtml+xml", "application/xhtml+xml", "sandbox", true},
+		{ActiveContentText, "text/html", "text/plain; charset=utf-8", "", true},
+		{ActiveContentText, "image/png", "image/png", "", true},
+		{ActiveContentAllow, "text/html", "text/html", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.mimeType, func(t *testing.T) {
+			content := "<script>alert(1)</script>"
+			mock := &mockStorageV2{content: content, mimeType: tt.mimeType, size: int64(len(content)), isFile: true}
+			server, err := NewServerWithConfig(map[string]storage.Storage{"local": mock}, "local", Config{ActiveContent: tt.mode})
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/file", nil)
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageNodesPath(w, req, "local", "file", GetStoragesStorageNodesPathParams{})
+
+			resp := w.Result()
+			if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.contentType, got)
+			}
+			if got := resp.Header.Get("Content-Security-Policy"); got != tt.csp {
+				t.Errorf("expected Content-Security-Policy %q, got %q", tt.csp, got)
+			}
+			if got := resp.Header.Get("X-Content-Type-Options") == "nosniff"; got != tt.nosniff {
+				t.Errorf("expected nosniff %v, got %v", tt.nosniff, got)
+			}
+		})
+	}
+
+	if _, err := NewServerWithConfig(map[string]storage.Storage{}, "", Config{ActiveContent: "run"}); err == nil {
+		t.Error("expected error for unknown active content mode")
+	}
+}
+
+func TestGetStoragesStorageManifestsPath(t *testing.T) {
+	content := "hello"
+	mock := &mockStorageV2{
+		content:  content,
+		mimeType: "text/plain",
+		size:     int64(len(content)),
+		isFile:   true,
+	}
+	storages := map[string]storage.Storage{
+		"local": mock,
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServerWithConfig(storages, "local", Config{SigningKey: key})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/manifests/hello.txt", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageManifestsPath(w, req, "local", "hello.txt", GetStoragesStorageManifestsPathParams{})
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+
+		var m Manifest
+		if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(m.Files) != 1 || m.Files[0].Path != "hello.txt" {
+			t.Fatalf("unexpected files: %+v", m.Files)
+		}
+		if m.Files[0].Sha256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+			t.Errorf("unexpected checksum %s", m.Files[0].Sha256)
+		}
+		if m.Signature == nil || *m.Signature == "" {
+			t.Error("expected manifest to be signed")
+		}
+	})
+
+	t.Run("sha256sum", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/manifests/hello.txt", nil)
+		req.Header.Set("Accept", "text/plain")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageManifestsPath(w, req, "local", "hello.txt", GetStoragesStorageManifestsPathParams{})
+
+		body, _ := io.ReadAll(w.Result().Body)
+		expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  hello.txt\n"
+		if string(body) != expected {
+			t.Errorf("expected %q, got %q", expected, string(body))
+		}
+	})
+
+	t.Run("storage not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/missing/manifests/hello.txt", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageManifestsPath(w, req, "missing", "hello.txt", GetStoragesStorageManifestsPathParams{})
+
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Result().StatusCode)
+		}
+	})
+}
+
+func TestDeleteAndTrash(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("hello"), 0644)
+
+	store, err := local.NewWithConfig(tmpDir, local.Config{Trash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	recursive := false
+	tests := []struct {
+		name     string
+		path     string
+		params   DeleteStoragesStorageNodesPathParams
+		expected int
+	}{
+		{"root", "", DeleteStoragesStorageNodesPathParams{}, http.StatusBadRequest},
+		{"non-empty directory", "docs", DeleteStoragesStorageNodesPathParams{Recursive: &recursive}, http.StatusConflict},
+		{"missing", "missing.txt", DeleteStoragesStorageNodesPathParams{}, http.StatusNotFound},
+		{"file", "docs/a.txt", DeleteStoragesStorageNodesPathParams{Recursive: &recursive}, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run("delete "+tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/storages/local/nodes/"+tt.path, nil)
+			w := httptest.NewRecorder()
+			server.DeleteStoragesStorageNodesPath(w, req, "local", tt.path, tt.params)
+
+			if w.Result().StatusCode != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, w.Result().StatusCode)
+			}
+		})
+	}
+
+	var items TrashList
+	t.Run("list", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/trash", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageTrash(w, req, "local")
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Result().StatusCode)
+		}
+		if err := json.NewDecoder(w.Result().Body).Decode(&items); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(items.Items) != 1 || items.Items[0].Path != "docs/a.txt" || items.Items[0].FileSize != 5 {
+			t.Fatalf("unexpected trash items: %+v", items.Items)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/trash/"+items.Items[0].Id+"/restore", nil)
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageTrashIdRestore(w, req, "local", items.Items[0].Id)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Result().StatusCode)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "docs", "a.txt")); err != nil {
+			t.Errorf("expected file to be restored: %v", err)
+		}
+	})
+
+	t.Run("restore missing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/trash/missing/restore", nil)
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageTrashIdRestore(w, req, "local", "missing")
+
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Result().StatusCode)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		server.DeleteStoragesStorageNodesPath(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/", nil), "local", "docs", DeleteStoragesStorageNodesPathParams{})
+
+		w := httptest.NewRecorder()
+		server.DeleteStoragesStorageTrash(w, httptest.NewRequest(http.MethodDelete, "/storages/local/trash", nil), "local")
+		if w.Result().StatusCode != http.StatusNoContent {
+			t.Errorf("expected status 204, got %d", w.Result().StatusCode)
+		}
+
+		w = httptest.NewRecorder()
+		server.DeleteStoragesStorageTrashId(w, httptest.NewRequest(http.MethodDelete, "/storages/local/trash/missing", nil), "local", "missing")
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Result().StatusCode)
+		}
+	})
+
+	t.Run("trash not supported", func(t *testing.T) {
+		server, _ := NewServer(map[string]storage.Storage{"local": &mockStorageV2{}}, "local")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageTrash(w, httptest.NewRequest(http.MethodGet, "/storages/local/trash", nil), "local")
+
+		if w.Result().StatusCode != http.StatusNotImplemented {
+			t.Errorf("expected status 501, got %d", w.Result().StatusCode)
+		}
+	})
+}
+
+func TestPostStoragesStorageNodesPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "existing.txt"), []byte("x"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		parent   string
+		body     string
+		expected int
+		created  string
+	}{
+		{"directory", "", `{"name":"docs","type":"dir"}`, http.StatusCreated, "docs"},
+		{"empty file", "docs", `{"name":"empty.txt","type":"file"}`, http.StatusCreated, "docs/empty.txt"},
+		{"file with content", "docs", `{"name":"notes.txt","type":"file","content":"hello"}`, http.StatusCreated, "docs/notes.txt"},
+		{"nested directories", "docs", `{"name":"a/b/c","type":"dir"}`, http.StatusCreated, "docs/a/b/c"},
+		{"existing file", "", `{"name":"existing.txt","type":"file"}`, http.StatusConflict, ""},
+		{"existing file with content", "", `{"name":"existing.txt","type":"file","content":"y"}`, http.StatusConflict, ""},
+		{"existing directory", "", `{"name":"docs","type":"dir"}`, http.StatusConflict, ""},
+		{"file in the way", "", `{"name":"existing.txt/sub","type":"dir"}`, http.StatusConflict, ""},
+		{"missing parent", "missing", `{"name":"dir","type":"dir"}`, http.StatusNotFound, ""},
+		{"dot dot", "", `{"name":"../escape","type":"dir"}`, http.StatusBadRequest, ""},
+		{"illegal character", "", `{"name":"a:b","type":"dir"}`, http.StatusBadRequest, ""},
+		{"control character", "", `{"name":"a\u0001b","type":"dir"}`, http.StatusBadRequest, ""},
+		{"empty name", "", `{"name":"","type":"dir"}`, http.StatusBadRequest, ""},
+		{"invalid type", "", `{"name":"x","type":"link"}`, http.StatusBadRequest, ""},
+		{"directory with content", "", `{"name":"x","type":"dir","content":"y"}`, http.StatusBadRequest, ""},
+		{"invalid json", "", `{`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes/"+tt.parent, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.PostStoragesStorageNodesPath(w, req, "local", tt.parent)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expected {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("expected status %d, got %d: %s", tt.expected, resp.StatusCode, body)
+			}
+			if tt.created == "" {
+				return
+			}
+
+			var node Node
+			if err := json.NewDecoder(resp.Body).Decode(&node); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if node.Path != tt.created {
+				t.Errorf("expected path %q, got %q", tt.created, node.Path)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(tt.created))); err != nil {
+				t.Errorf("expected node to be created: %v", err)
+			}
+			if !strings.HasSuffix(resp.Header.Get("Location"), "/"+tt.created) {
+				t.Errorf("unexpected Location header %q", resp.Header.Get("Location"))
+			}
+		})
+	}
+
+	data, _ := os.ReadFile(filepath.Join(tmpDir, "docs", "notes.txt"))
+	if string(data) != "hello" {
+		t.Errorf("expected content %q, got %q", "hello", data)
+	}
+
+	t.Run("upload", func(t *testing.T) {
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", "renamed.txt")
+		part, _ := mw.CreateFormFile("file", "original.txt")
+		part.Write([]byte("uploaded"))
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes/docs", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageNodesPath(w, req, "local", "docs")
+
+		if w.Result().StatusCode != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", w.Result().StatusCode)
+		}
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "docs", "renamed.txt"))
+		if string(data) != "uploaded" {
+			t.Errorf("expected content %q, got %q", "uploaded", data)
+		}
+	})
+
+	t.Run("upload without file", func(t *testing.T) {
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", "x.txt")
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageNodes(w, req, "local")
+
+		if w.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Result().StatusCode)
+		}
+	})
+}
+
+func TestDirectoryListingPermissions(t *testing.T) {
+	mock := &mockStorageV2{
+		nodes: []storage.FileNode{
+			{
+				Path:     url.URL{Scheme: "local", Path: "script.sh"},
+				Type:     "file",
+				Basename: "script.sh",
+				Mode:     0755 | fs.ModeSetuid,
+				Owner:    "alice",
+				Group:    "users",
+			},
+			{
+				Path:       url.URL{Scheme: "local", Path: "link"},
+				Type:       "file",
+				Basename:   "link",
+				Mode:       0777 | fs.ModeSymlink,
+				LinkTarget: "script.sh",
+			},
+		},
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": mock}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	list := func(t *testing.T, fields *string) NodeList {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "", GetStoragesStorageNodesPathParams{Fields: fields})
+
+		var response NodeList
+		if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	t.Run("not requested", func(t *testing.T) {
+		response := list(t, nil)
+		for _, node := range response.Files {
+			if node.Mode != nil || node.Owner != nil || node.LinkTarget != nil {
+				t.Errorf("expected no permission fields, got %+v", node)
+			}
+		}
+	})
+
+	t.Run("owners resolved on request", func(t *testing.T) {
+		resolver := &ownerResolverStorage{mockStorageV2: mock}
+		server, err := NewServer(map[string]storage.Storage{"local": resolver}, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes", nil)
+		req.Header.Set("Accept", "application/json")
+		server.GetStoragesStorageNodesPath(httptest.NewRecorder(), req, "local", "", GetStoragesStorageNodesPathParams{})
+		if resolver.calls != 0 {
+			t.Errorf("expected no owner lookups, got %d", resolver.calls)
+		}
+
+		fields := "(permissions)"
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "", GetStoragesStorageNodesPathParams{Fields: &fields})
+		var response NodeList
+		json.NewDecoder(w.Body).Decode(&response)
+		if len(response.Files) != 2 || response.Files[1].Owner == nil || *response.Files[1].Owner != "name-alice" {
+			t.Errorf("expected resolved owner, got %+v", response.Files)
+		}
+	})
+
+	t.Run("requested", func(t *testing.T) {
+		fields := "(permissions)"
+		response := list(t, &fields)
+		if len(response.Files) != 2 {
+			t.Fatalf("expected 2 files, got %d", len(response.Files))
+		}
+
+		link, script := response.Files[0], response.Files[1]
+		if script.Mode == nil || *script.Mode != "4755" {
+			t.Errorf("expected mode 4755, got %v", script.Mode)
+		}
+		if script.Owner == nil || *script.Owner != "alice" || script.Group == nil || *script.Group != "users" {
+			t.Errorf("unexpected owner %v group %v", script.Owner, script.Group)
+		}
+		if link.LinkTarget == nil || *link.LinkTarget != "script.sh" {
+			t.Errorf("expected link target script.sh, got %v", link.LinkTarget)
+		}
+	})
+}
+
+// ownerResolverStorage resolves owners by prefixing them, counting lookups
+type ownerResolverStorage struct {
+	*mockStorageV2
+	calls int
+}
+
+func (m *ownerResolverStorage) ResolveOwner(owner, group string) (string, string) {
+	m.calls++
+	return "name-" + owner, "name-" + group
+}
+
+func TestDirectoryListingHidden(t *testing.T) {
+	mock := &mockStorageV2{
+		nodes: []storage.FileNode{
+			{Path: url.URL{Scheme: "local", Path: ".config"}, Type: "dir", Basename: ".config"},
+			{Path: url.URL{Scheme: "local", Path: "docs"}, Type: "dir", Basename: "docs"},
+			{Path: url.URL{Scheme: "local", Path: ".bashrc"}, Type: "file", Basename: ".bashrc"},
+		},
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": mock}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	hidden := false
+	tests := []struct {
+		name     string
+		hidden   *bool
+		expected int
+	}{
+		{"default", nil, 3},
+		{"hidden=false", &hidden, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes", nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageNodes(w, req, "local", GetStoragesStorageNodesParams{Hidden: tt.hidden})
+
+			var response NodeList
+			if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(response.Files) != tt.expected {
+				t.Errorf("expected %d files, got %d", tt.expected, len(response.Files))
+			}
+		})
+	}
+}
+
+func TestDirectoryListingETag(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "application/json")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/storages/local/nodes", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expected 200 with a weak ETag, got %d and %q", w.Code, etag)
+	}
+
+	if w := get("/storages/local/nodes", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected 304 without body, got %d", w.Code)
+	}
+	if w := get("/storages/local/nodes", `"other", `+strings.TrimPrefix(etag, "W/")); w.Code != http.StatusNotModified {
+		t.Errorf("expected weak comparison to match, got %d", w.Code)
+	}
+	if w := get("/storages/local/nodes?sort=size", etag); w.Code != http.StatusOK {
+		t.Errorf("expected other queries to be tagged differently, got %d", w.Code)
+	}
+
+	// Changed directories are listed again
+	os.WriteFile(filepath.Join(tmpDir, "b.txt"), []byte("b"), 0644)
+	w = get("/storages/local/nodes", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected 200 with a new ETag, got %d and %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	// Trees depend on more than the listed nodes
+	if w := get("/storages/local/nodes?children=recursive", ""); w.Header().Get("ETag") != "" {
+		t.Errorf("expected recursive listings not to be tagged, got %q", w.Header().Get("ETag"))
+	}
+}
+
+func TestDirectoryListingRecursive(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, p := range []string{"a/b/c/d.txt", "a/x.txt", "e.txt"} {
+		os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(p)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, p), []byte(p), 0644)
+	}
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	// tree renders nodes as paths with their children in parentheses, "..."
+	// for directories that weren't expanded
+	var tree func(nodes []Node) string
+	tree = func(nodes []Node) string {
+		var parts []string
+		for _, n := range nodes {
+			switch {
+			case n.Children != nil:
+				parts = append(parts, n.Basename+"("+tree(*n.Children)+")")
+			case n.Type == Dir:
+				parts = append(parts, n.Basename+"(...)")
+			default:
+				parts = append(parts, n.Basename)
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/storages/local/nodes", "a(...) e.txt"},
+		{"/storages/local/nodes?children=recursive", "a(b(...) x.txt) e.txt"},
+		{"/storages/local/nodes?children=recursive&depth=10", "a(b(c(d.txt)) x.txt) e.txt"},
+		{"/storages/local/nodes?children=recursive&depth=1", "a(...) e.txt"},
+		{"/storages/local/nodes?children=recursive&depth=10&type=dir", "a(b(c()))"},
+		{"/storages/local/nodes/a?children=recursive", "b(c(...)) x.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			var response NodeList
+			json.NewDecoder(w.Body).Decode(&response)
+			if got := tree(response.Files); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+			if response.Truncated != nil {
+				t.Errorf("expected complete tree")
+			}
+		})
+	}
+
+	t.Run("invalid depth", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes?children=recursive&depth=11", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestDirectoryListingAncestors(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "a", "b", "c"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "a", "b", "c", "d.txt"), nil, 0644)
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	for target, want := range map[string]string{
+		"/storages/local/nodes":            "",
+		"/storages/local/nodes/a/b/c":      "local: a:a b:a/b",
+		"/storages/local/nodes/a?search=d": "local:",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var response NodeList
+		json.NewDecoder(w.Body).Decode(&response)
+		if response.Ancestors == nil {
+			t.Fatalf("expected ancestors for %s", target)
+		}
+		var got []string
+		for _, a := range *response.Ancestors {
+			if a.Exists == nil || !*a.Exists {
+				t.Errorf("expected %s to exist", a.Path)
+			}
+			got = append(got, a.Basename+":"+a.Path)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("expected ancestors %q of %s, got %q", want, target, got)
+		}
+	}
+}
+
+// mockTypedStorage is a mockStorageV2 that can tell the type of its nodes
+type mockTypedStorage struct {
+	mockStorageV2
+	typ     string
+	typeErr error
+}
+
+func (m *mockTypedStorage) NodeType(path url.URL) (string, error) {
+	return m.typ, m.typeErr
+}
+
+func TestNodeTypeBranching(t *testing.T) {
+	denied := &fs.PathError{Op: "readdir", Path: "docs", Err: fs.ErrPermission}
+	tests := []struct {
+		name   string
+		store  *mockTypedStorage
+		status int
+		body   string
+	}{
+		{"listing errors are kept", &mockTypedStorage{mockStorageV2: mockStorageV2{listErr: denied, content: "x"}, typ: "dir"}, http.StatusForbidden, ""},
+		{"files aren't listed", &mockTypedStorage{mockStorageV2: mockStorageV2{content: "hello", mimeType: "text/plain", size: 5}, typ: "file"}, http.StatusOK, "hello"},
+		{"missing nodes", &mockTypedStorage{typeErr: &fs.PathError{Op: "stat", Path: "docs", Err: fs.ErrNotExist}}, http.StatusNotFound, ""},
+		{"unknown types are guessed", &mockTypedStorage{mockStorageV2: mockStorageV2{isFile: true, content: "hello", mimeType: "text/plain", size: 5}, typeErr: storage.ErrNotSupported}, http.StatusOK, "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(map[string]storage.Storage{"local": tt.store}, "local")
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/docs", nil)
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageNodesPath(w, req, "local", "docs", GetStoragesStorageNodesPathParams{})
+			if w.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	store, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{ErrorHandlerFunc: server.ParamError})
+
+	tests := []struct {
+		method string
+		target string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/storages/missing/nodes/a", http.StatusNotFound, "storage_not_found"},
+		{http.MethodDelete, "/storages/local/nodes/..%2fetc", http.StatusBadRequest, "path_outside_root"},
+		{http.MethodDelete, "/storages/local/nodes/missing", http.StatusNotFound, "node_not_found"},
+		{http.MethodGet, "/storages/local/activity?limit=many", http.StatusBadRequest, "invalid_parameter"},
+		{http.MethodGet, "/storages/local/activity", http.StatusNotImplemented, "feature_disabled"},
+		{http.MethodGet, "/storages/local/reports/snapshots", http.StatusNotImplemented, "not_supported"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.target, tt.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s %s: expected problem details, got %s", tt.method, tt.target, ct)
+		}
+		var problem ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+			t.Fatalf("failed to decode problem details: %v", err)
+		}
+		if problem.Code != tt.code || problem.Status != tt.status || problem.Type != "urn:timeship:problem:"+tt.code {
+			t.Errorf("%s %s: expected %s problem, got %+v", tt.method, tt.target, tt.code, problem)
+		}
+		if problem.Instance == nil || problem.Detail == nil {
+			t.Errorf("%s %s: expected instance and detail, got %+v", tt.method, tt.target, problem)
+		}
+	}
+}
+
+func TestErrorProblem(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("open: %w", storage.ErrSnapshotNotFound), http.StatusNotFound, "snapshot_not_found"},
+		{fmt.Errorf("convert: %w", storage.ErrOutsideRoot), http.StatusBadRequest, "path_outside_root"},
+		{&fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist}, http.StatusNotFound, "node_not_found"},
+		{&fs.PathError{Op: "mkdir", Path: "a", Err: fs.ErrExist}, http.StatusConflict, "already_exists"},
+		{&fs.PathError{Op: "remove", Path: "a", Err: syscall.ENOTEMPTY}, http.StatusConflict, "directory_not_empty"},
+		{storage.ErrNotSupported, http.StatusNotImplemented, "not_supported"},
+		{errors.New("disk on fire"), http.StatusInternalServerError, "internal_server_error"},
+	}
+	for _, tt := range tests {
+		p := errorProblem(tt.err)
+		if p.status != tt.status || p.code != tt.code {
+			t.Errorf("errorProblem(%v) = %d %s, want %d %s", tt.err, p.status, p.code, tt.status, tt.code)
+		}
+	}
+}
+
+// mockSnapshotStorage implements storage.SnapshotLister for testing
+type mockSnapshotStorage struct {
+	snapshots []storage.Snapshot
+}
+
+func (m *mockSnapshotStorage) ListSnapshots(path url.URL) ([]storage.Snapshot, error) {
+	return m.snapshots, nil
+}
+
+func TestDirectoryListingTotalSize(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("allocated sizes and hard links are only reported on Unix")
+	}
+	tmpDir := t.TempDir()
+	dataDir := filepath.Join(tmpDir, "data")
+	os.MkdirAll(dataDir, 0755)
+	os.WriteFile(filepath.Join(dataDir, "a.bin"), make([]byte, 1000), 0644)
+	if err := os.Link(filepath.Join(dataDir, "a.bin"), filepath.Join(dataDir, "b.bin")); err != nil {
+		t.Fatal(err)
+	}
+	sparse, err := os.Create(filepath.Join(dataDir, "sparse.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sparse.Truncate(1 << 20)
+	sparse.Close()
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-09", "data")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "a.bin"), make([]byte, 10), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	list := func(t *testing.T, target string) NodeList {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var response NodeList
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	t.Run("hard links counted once", func(t *testing.T) {
+		response := list(t, "/storages/local/nodes/data?fields=(total_size)")
+		if response.TotalSize == nil || *response.TotalSize != 1000+1<<20 {
+			t.Fatalf("expected total size %d, got %v", 1000+1<<20, response.TotalSize)
+		}
+		if response.TotalAllocatedSize == nil || *response.TotalAllocatedSize >= *response.TotalSize {
+			t.Errorf("expected allocated size below %d for sparse file, got %v", *response.TotalSize, response.TotalAllocatedSize)
+		}
+	})
+
+	t.Run("allocated size of files", func(t *testing.T) {
+		response := list(t, "/storages/local/nodes/data")
+		for _, file := range response.Files {
+			if file.Basename == "a.bin" && (file.AllocatedSize == nil || *file.AllocatedSize < 1000) {
+				t.Errorf("expected at least 1000 bytes allocated for a.bin, got %v", file.AllocatedSize)
+			}
+			if file.Basename == "sparse.img" && file.AllocatedSize != nil && *file.AllocatedSize >= file.FileSize {
+				t.Errorf("expected sparse.img to allocate less than %d bytes, got %d", file.FileSize, *file.AllocatedSize)
+			}
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		response := list(t, "/storages/local/nodes/data?fields=(total_size)&snapshot=zfs:daily-2025-11-09")
+		if response.TotalSize == nil || *response.TotalSize != 10 {
+			t.Errorf("expected total size 10, got %v", response.TotalSize)
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, p := range []string{
+		"report.txt",
+		"docs/2024/report-q1.txt",
+		"docs/2024/notes.txt",
+		"docs/a-report.pdf",
+		"docs/reports/summary.txt",
+		".cache/report.tmp",
+		"photos/cat.jpg",
+	} {
+		os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(p)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, p), []byte(p), 0644)
+	}
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	search := func(t *testing.T, target string) (int, NodeList) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var response NodeList
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+		return w.Code, response
+	}
+	// searchAll fetches all pages and returns the paths found and the number
+	// of pages
+	searchAll := func(t *testing.T, target string) ([]string, int) {
+		t.Helper()
+		var paths []string
+		pages := 0
+		cursor := ""
+		for {
+			u := target
+			if cursor != "" {
+				u += "&cursor=" + url.QueryEscape(cursor)
+			}
+			code, response := search(t, u)
+			if code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", code)
+			}
+			pages++
+			for _, f := range response.Files {
+				paths = append(paths, f.Path)
+			}
+			if response.Cursor == nil {
+				return paths, pages
+			}
+			if pages > 10 {
+				t.Fatal("search did not finish")
+			}
+			cursor = *response.Cursor
+		}
+	}
+
+	all := []string{".cache/report.tmp", "docs/2024/report-q1.txt", "docs/a-report.pdf", "docs/reports", "report.txt"}
+
+	t.Run("recursive in name order", func(t *testing.T) {
+		paths, pages := searchAll(t, "/storages/local/nodes?search=REPORT")
+		if !slices.Equal(paths, all) || pages != 1 {
+			t.Errorf("expected %v in 1 page, got %v in %d", all, paths, pages)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		paths, pages := searchAll(t, "/storages/local/nodes?search=report&limit=2")
+		if !slices.Equal(paths, all) || pages != 3 {
+			t.Errorf("expected %v in 3 pages, got %v in %d", all, paths, pages)
+		}
+	})
+
+	t.Run("below path", func(t *testing.T) {
+		paths, _ := searchAll(t, "/storages/local/nodes/docs?search=report&limit=1")
+		expected := []string{"docs/2024/report-q1.txt", "docs/a-report.pdf", "docs/reports"}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+		_, response := search(t, "/storages/local/nodes/docs?search=report&limit=1")
+		if len(response.Files) != 1 || response.Files[0].Dir == nil || *response.Files[0].Dir != "docs/2024" {
+			t.Errorf("expected result in docs/2024, got %+v", response.Files)
+		}
+	})
+
+	t.Run("without hidden and by type", func(t *testing.T) {
+		paths, _ := searchAll(t, "/storages/local/nodes?search=report&hidden=false&type=file")
+		expected := []string{"docs/2024/report-q1.txt", "docs/a-report.pdf", "report.txt"}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("sorted by relevance", func(t *testing.T) {
+		_, response := search(t, "/storages/local/nodes?search=report&sort=relevance")
+		var paths []string
+		for _, f := range response.Files {
+			paths = append(paths, f.Path)
+		}
+		expected := []string{"report.txt", ".cache/report.tmp", "docs/reports", "docs/2024/report-q1.txt", "docs/a-report.pdf"}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("sorted across pages", func(t *testing.T) {
+		// The best match is found last by the walk, but ranked first
+		paths, pages := searchAll(t, "/storages/local/nodes?search=report&sort=relevance&limit=2")
+		expected := []string{"report.txt", ".cache/report.tmp", "docs/reports", "docs/2024/report-q1.txt", "docs/a-report.pdf"}
+		if !slices.Equal(paths, expected) || pages != 3 {
+			t.Errorf("expected %v in 3 pages, got %v in %d", expected, paths, pages)
+		}
+	})
+
+	t.Run("path match", func(t *testing.T) {
+		paths, _ := searchAll(t, "/storages/local/nodes?search=2024/NO&sort=relevance")
+		expected := []string{"docs/2024/notes.txt"}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("sorted by size descending", func(t *testing.T) {
+		_, response := search(t, "/storages/local/nodes?search=report&type=file&sort=size&order=desc")
+		for i := 1; i < len(response.Files); i++ {
+			if response.Files[i].FileSize > response.Files[i-1].FileSize {
+				t.Errorf("expected descending sizes, got %+v", response.Files)
+			}
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		if code, _ := search(t, "/storages/local/nodes?search=report&cursor=!!"); code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", code)
+		}
+		cursor := encodeSearchCursor("photos/cat.jpg")
+		if code, _ := search(t, "/storages/local/nodes/docs?search=report&cursor="+cursor); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for cursor of another directory, got %d", code)
+		}
+		if code, _ := search(t, "/storages/local/nodes?search=report&sort=name&cursor="+cursor); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for cursor of an unsorted search, got %d", code)
+		}
+		if code, _ := search(t, "/storages/local/nodes?search=report&cursor="+encodeSortedSearchCursor(2)); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for cursor of a sorted search, got %d", code)
+		}
+		if code, _ := search(t, "/storages/local/nodes?search=report&limit=0"); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for limit 0, got %d", code)
+		}
+	})
+}
+
+func TestComparePaths(t *testing.T) {
+	ordered := []string{"a", "a/b", "a/b/c", "a/c", "a-b", "b"}
+	for i := range ordered {
+		for j := range ordered {
+			if got := comparePaths(ordered[i], ordered[j]); (got < 0) != (i < j) || (got == 0) != (i == j) {
+				t.Errorf("comparePaths(%q, %q) = %d", ordered[i], ordered[j], got)
+			}
+		}
+	}
+}
+
+func TestGetStoragesStorageSnapshotsPath_FilterSort(t *testing.T) {
+	mock := &mockSnapshotStorage{
+		snapshots: []storage.Snapshot{
+			{ID: "zfs:b", Type: "zfs", Name: "b", Timestamp: 300, Size: 10},
+			{ID: "git:a", Type: "git", Name: "a", Timestamp: 200, Size: 30},
+			{ID: "zfs:c", Type: "zfs", Name: "c", Timestamp: 100, Size: 20},
+			{ID: "borg:d", Type: "borg", Name: "d", Timestamp: 400, Size: -1},
+		},
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": mock}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	sortName := GetStoragesStorageSnapshotsPathParamsSortName
+	sortSize := GetStoragesStorageSnapshotsPathParamsSortSize
+	asc := GetStoragesStorageSnapshotsPathParamsOrderAsc
+	zfsAndGit := SnapshotsType{Zfs, Git}
+	limit := SnapshotsLimit(2)
+
+	tests := []struct {
+		name     string
+		params   GetStoragesStorageSnapshotsPathParams
+		expected []string
+	}{
+		{"default newest first", GetStoragesStorageSnapshotsPathParams{}, []string{"borg:d", "zfs:b", "git:a", "zfs:c"}},
+		{"oldest first", GetStoragesStorageSnapshotsPathParams{Order: &asc}, []string{"zfs:c", "git:a", "zfs:b", "borg:d"}},
+		{"by name", GetStoragesStorageSnapshotsPathParams{Sort: &sortName, Order: &asc}, []string{"git:a", "zfs:b", "zfs:c", "borg:d"}},
+		{"by size", GetStoragesStorageSnapshotsPathParams{Sort: &sortSize}, []string{"git:a", "zfs:c", "zfs:b", "borg:d"}},
+		{"by type", GetStoragesStorageSnapshotsPathParams{Type: &zfsAndGit}, []string{"zfs:b", "git:a", "zfs:c"}},
+		{"filter before limit", GetStoragesStorageSnapshotsPathParams{Type: &zfsAndGit, Order: &asc, Limit: &limit}, []string{"zfs:c", "git:a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/snapshots/file.txt", nil)
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageSnapshotsPath(w, req, "local", "file.txt", tt.params)
+
+			var response NodeSnapshotsList
+			if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			ids := make([]string, len(response.Snapshots))
+			for i, snap := range response.Snapshots {
+				ids[i] = snap.Id
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestDirectoryListingSnapshotSummaries(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"file.txt", "other.txt", "new.txt"} {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	older := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-08")
+	newer := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-09")
+	os.MkdirAll(older, 0755)
+	os.MkdirAll(newer, 0755)
+	os.WriteFile(filepath.Join(older, "file.txt"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(newer, "file.txt"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(older, "other.txt"), []byte("old"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	cache, err := metacache.Open(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	indexer := metacache.NewIndexer(cache, metacache.Config{})
+	defer indexer.Close()
+
+	configs := []struct {
+		name   string
+		config Config
+	}{
+		{"live", Config{}},
+		// The first request lists snapshots and queues them for indexing,
+		// the second is answered from the cache
+		{"unindexed", Config{MetadataCache: indexer}},
+		{"indexed", Config{MetadataCache: indexer}},
+	}
+	for _, c := range configs {
+		t.Run(c.name, func(t *testing.T) {
+			deadline := time.Now().Add(5 * time.Second)
+			for indexer.Pending() > 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("timed out waiting for indexer")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", c.config)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			checkSnapshotSummaries(t, server)
+		})
+	}
+
+	snapshots, err := cache.Snapshots("local")
+	if err != nil || len(snapshots) != 2 {
+		t.Errorf("expected 2 indexed snapshots, got %v %v", snapshots, err)
+	}
+}
+
+// checkSnapshotSummaries checks the snapshot summaries of the root listing
+// created by TestDirectoryListingSnapshotSummaries
+func checkSnapshotSummaries(t *testing.T, server *Server) {
+	t.Helper()
+
+	fields := "(snapshots)"
+	req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	server.GetStoragesStorageNodesPath(w, req, "local", "", GetStoragesStorageNodesPathParams{Fields: &fields})
+
+	var response NodeList
+	if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	nodes := map[string]Node{}
+	for _, node := range response.Files {
+		nodes[node.Basename] = node
+	}
+
+	tests := []struct {
+		name   string
+		count  int
+		newest string
+	}{
+		{"file.txt", 2, "2025-11-09"},
+		{"other.txt", 1, "2025-11-08"},
+		{"new.txt", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := nodes[tt.name]
+			if node.SnapshotCount == nil || *node.SnapshotCount != tt.count {
+				t.Fatalf("expected %d snapshots, got %v", tt.count, node.SnapshotCount)
+			}
+			if tt.newest == "" {
+				if node.NewestSnapshot != nil {
+					t.Errorf("expected no newest snapshot, got %d", *node.NewestSnapshot)
+				}
+				return
+			}
+			if node.NewestSnapshot == nil {
+				t.Fatal("expected newest snapshot")
+			}
+			// Snapshot names are parsed in local time
+			if got := time.Unix(*node.NewestSnapshot, 0).Format("2006-01-02"); got != tt.newest {
+				t.Errorf("expected newest snapshot %s, got %s", tt.newest, got)
+			}
+		})
+	}
+}
+
+// mockSnapshotManager implements storage.SnapshotManager for testing
+type mockSnapshotManager struct {
+	mockSnapshotStorage
+	created   []string
+	destroyed []string
+}
+
+func (m *mockSnapshotManager) CreateSnapshot(name string) (storage.Snapshot, error) {
+	if name == "" {
+		name = "generated"
+	}
+	if name == "exists" {
+		return storage.Snapshot{}, fs.ErrExist
+	}
+	m.created = append(m.created, name)
+	return storage.Snapshot{ID: "zfs:" + name, Type: "zfs", Name: name, Timestamp: 100, Size: -1}, nil
+}
+
+func (m *mockSnapshotManager) DestroySnapshot(id string) error {
+	if id == "zfs:missing" {
+		return fs.ErrNotExist
+	}
+	m.destroyed = append(m.destroyed, id)
+	return nil
+}
+
+func TestManageSnapshots(t *testing.T) {
+	mock := &mockSnapshotManager{}
+	server, err := NewServer(map[string]storage.Storage{
+		"local":    mock,
+		"readonly": &mockSnapshotStorage{},
+	}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	createTests := []struct {
+		name     string
+		storage  string
+		body     string
+		status   int
+		expected string
+	}{
+		{"named", "local", `{"name":"before-cleanup"}`, http.StatusCreated, "zfs:before-cleanup"},
+		{"empty body", "local", ``, http.StatusCreated, "zfs:generated"},
+		{"invalid body", "local", `{`, http.StatusBadRequest, ""},
+		{"conflict", "local", `{"name":"exists"}`, http.StatusConflict, ""},
+		{"not supported", "readonly", `{}`, http.StatusNotImplemented, ""},
+	}
+
+	for _, tt := range createTests {
+		t.Run("create "+tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/storages/"+tt.storage+"/snapshots", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.PostStoragesStorageSnapshots(w, req, Storage(tt.storage))
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.expected == "" {
+				return
+			}
+			var snap Snapshot
+			if err := json.NewDecoder(w.Body).Decode(&snap); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if snap.Id != tt.expected {
+				t.Errorf("expected snapshot %s, got %s", tt.expected, snap.Id)
+			}
+		})
+	}
+
+	deleteTests := []struct {
+		name    string
+		storage string
+		id      string
+		status  int
+	}{
+		{"destroy", "local", "zfs:before-cleanup", http.StatusNoContent},
+		{"missing id", "local", "", http.StatusBadRequest},
+		{"not found", "local", "zfs:missing", http.StatusNotFound},
+		{"not supported", "readonly", "zfs:x", http.StatusNotImplemented},
+	}
+
+	for _, tt := range deleteTests {
+		t.Run("delete "+tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/storages/"+tt.storage+"/snapshots", nil)
+			w := httptest.NewRecorder()
+			server.DeleteStoragesStorageSnapshots(w, req, Storage(tt.storage), DeleteStoragesStorageSnapshotsParams{Id: tt.id})
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if len(mock.destroyed) != 1 || mock.destroyed[0] != "zfs:before-cleanup" {
+		t.Errorf("unexpected destroyed snapshots %v", mock.destroyed)
+	}
+}
+
+func TestAnalyzeRetention(t *testing.T) {
+	at := func(value string) int64 {
+		ts, err := time.Parse(time.DateTime, value)
+		if err != nil {
+			t.Fatalf("invalid time %q: %v", value, err)
+		}
+		return ts.Unix()
+	}
+
+	snapshots := []storage.Snapshot{
+		{ID: "zfs:a", Timestamp: at("2025-11-09 13:00:00")},
+		{ID: "zfs:b", Timestamp: at("2025-11-09 12:30:00")},
+		{ID: "zfs:c", Timestamp: at("2025-11-09 12:00:00")},
+		{ID: "zfs:d", Timestamp: at("2025-11-08 00:00:00")},
+		{ID: "zfs:e", Timestamp: at("2025-10-31 00:00:00")},
+	}
+
+	report := analyzeRetention(snapshots, 25*time.Hour, time.UTC)
+
+	if report.Total != 5 {
+		t.Errorf("expected 5 snapshots, got %d", report.Total)
+	}
+	if report.Oldest == nil || *report.Oldest != at("2025-10-31 00:00:00") {
+		t.Errorf("unexpected oldest %v", report.Oldest)
+	}
+	if report.Newest == nil || *report.Newest != at("2025-11-09 13:00:00") {
+		t.Errorf("unexpected newest %v", report.Newest)
+	}
+
+	tests := []struct {
+		name    string
+		buckets RetentionBuckets
+		starts  []string
+		counts  []int
+	}{
+		{"hourly", report.Hourly, []string{"2025-11-09 13:00:00", "2025-11-09 12:00:00", "2025-11-08 00:00:00", "2025-10-31 00:00:00"}, []int{1, 2, 1, 1}},
+		{"daily", report.Daily, []string{"2025-11-09 00:00:00", "2025-11-08 00:00:00", "2025-10-31 00:00:00"}, []int{3, 1, 1}},
+		{"weekly", report.Weekly, []string{"2025-11-03 00:00:00", "2025-10-27 00:00:00"}, []int{4, 1}},
+		{"monthly", report.Monthly, []string{"2025-11-01 00:00:00", "2025-10-01 00:00:00"}, []int{4, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.buckets.Covered != len(tt.starts) || len(tt.buckets.Periods) != len(tt.starts) {
+				t.Fatalf("expected %d periods, got %+v", len(tt.starts), tt.buckets)
+			}
+			for i, period := range tt.buckets.Periods {
+				if period.Start != at(tt.starts[i]) || period.Count != tt.counts[i] {
+					t.Errorf("period %d: expected %s x%d, got %s x%d", i, tt.starts[i], tt.counts[i], time.Unix(period.Start, 0).UTC(), period.Count)
+				}
+			}
+		})
+	}
+
+	t.Run("gaps", func(t *testing.T) {
+		if len(report.Gaps) != 2 {
+			t.Fatalf("expected 2 gaps, got %+v", report.Gaps)
+		}
+		if report.Gaps[0].Start != at("2025-11-08 00:00:00") || report.Gaps[0].End != at("2025-11-09 12:00:00") {
+			t.Errorf("unexpected newest gap %+v", report.Gaps[0])
+		}
+		if report.Gaps[1].Duration != int64(8*24*time.Hour/time.Second) {
+			t.Errorf("unexpected oldest gap %+v", report.Gaps[1])
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		report := analyzeRetention(nil, time.Hour, time.UTC)
+		if report.Total != 0 || report.Oldest != nil || report.Newest != nil || len(report.Gaps) != 0 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+}
+
+func TestGetStoragesStorageRetention(t *testing.T) {
+	mock := &mockSnapshotStorage{
+		snapshots: []storage.Snapshot{
+			{ID: "zfs:a", Type: "zfs", Timestamp: 7200},
+			{ID: "git:b", Type: "git", Timestamp: 3600},
+			{ID: "zfs:c", Type: "zfs", Timestamp: 0},
+		},
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": mock}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	zfsOnly := SnapshotsType{Zfs}
+	oneHour := "1h"
+	invalid := "soon"
+
+	tests := []struct {
+		name   string
+		params GetStoragesStorageRetentionParams
+		status int
+		total  int
+		gaps   int
+	}{
+		{"default", GetStoragesStorageRetentionParams{}, http.StatusOK, 3, 0},
+		{"filtered", GetStoragesStorageRetentionParams{Type: &zfsOnly, MaxGap: &oneHour}, http.StatusOK, 2, 1},
+		{"invalid max gap", GetStoragesStorageRetentionParams{MaxGap: &invalid}, http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/retention", nil)
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageRetention(w, req, "local", tt.params)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var report RetentionReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if report.Storage != "local" || report.Total != tt.total || len(report.Gaps) != tt.gaps {
+				t.Errorf("unexpected report %+v", report)
+			}
+		})
+	}
+}
+
+// mockZFSStorage implements storage.ZFSHealthReporter for testing
+type mockZFSStorage struct {
+	health storage.ZFSHealth
+	err    error
+}
+
+func (m *mockZFSStorage) ZFSHealth() (storage.ZFSHealth, error) {
+	return m.health, m.err
+}
+
+func TestGetStoragesStorageZfs(t *testing.T) {
+	healthy := &mockZFSStorage{health: storage.ZFSHealth{
+		Pool: storage.ZFSPool{
+			Name:      "tank",
+			State:     "DEGRADED",
+			Status:    "One or more devices could not be opened.",
+			LastScrub: 1760221524,
+			Devices: []storage.ZFSDevice{
+				{Name: "tank", State: "DEGRADED"},
+				{Name: "sdb", State: "UNAVAIL", Depth: 1, Checksum: 3},
+				{Name: "spares"},
+			},
+		},
+		Dataset: storage.ZFSDataset{Name: "tank/data", Used: 1024, Compression: "lz4", CompressRatio: 1.5},
+	}}
+	server, err := NewServer(map[string]storage.Storage{
+		"local":  healthy,
+		"ext4":   &mockZFSStorage{err: fmt.Errorf("root is not on a ZFS dataset: %w", storage.ErrNotSupported)},
+		"remote": &mockHealthStorage{},
+	}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/zfs", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageZfs(w, req, "local")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var health ZFSHealth
+		if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if health.Storage != "local" || health.Pool.State != "DEGRADED" || health.Pool.Status == nil || health.Pool.Scan != nil {
+			t.Errorf("unexpected pool %+v", health.Pool)
+		}
+		if health.Pool.LastScrub == nil || *health.Pool.LastScrub != 1760221524 {
+			t.Errorf("expected last scrub, got %v", health.Pool.LastScrub)
+		}
+		if len(health.Pool.Devices) != 3 || health.Pool.Devices[1].ChecksumErrors != 3 || health.Pool.Devices[2].State != nil {
+			t.Errorf("unexpected devices %+v", health.Pool.Devices)
+		}
+		if health.Dataset.Name != "tank/data" || health.Dataset.Used != 1024 || health.Dataset.CompressRatio != 1.5 {
+			t.Errorf("unexpected dataset %+v", health.Dataset)
+		}
+	})
+
+	for _, name := range []string{"ext4", "remote"} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/storages/"+name+"/zfs", nil)
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageZfs(w, req, Storage(name))
+			if w.Code != http.StatusNotImplemented {
+				t.Errorf("expected status 501, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/missing/zfs", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageZfs(w, req, "missing")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+}
+
+// mockSpaceStorage implements storage.SnapshotSpaceReporter for testing
+type mockSpaceStorage struct {
+	space storage.SnapshotSpace
+}
+
+func (m *mockSpaceStorage) SnapshotSpace() (storage.SnapshotSpace, error) {
+	return m.space, nil
+}
+
+func TestGetStoragesStorageReportsSnapshots(t *testing.T) {
+	mock := &mockSpaceStorage{space: storage.SnapshotSpace{
+		Dataset: "tank/data",
+		Used:    1000,
+		Snapshots: []storage.SnapshotUsage{
+			{ID: "zfs:a", Name: "a", Timestamp: 100, Used: 100, Written: 500},
+			{ID: "zfs:b", Name: "b", Timestamp: 200, Used: 600, Written: 700},
+			{ID: "zfs:c", Name: "c", Timestamp: 300, Used: 100, Written: 50},
+		},
+	}}
+	server, err := NewServer(map[string]storage.Storage{"local": mock, "remote": &mockHealthStorage{}}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	one := 1
+	invalid := 0
+	tests := []struct {
+		name    string
+		storage Storage
+		params  GetStoragesStorageReportsSnapshotsParams
+		status  int
+		want    []string
+	}{
+		{"all", "local", GetStoragesStorageReportsSnapshotsParams{}, http.StatusOK, []string{"zfs:b", "zfs:c", "zfs:a"}},
+		{"limit", "local", GetStoragesStorageReportsSnapshotsParams{Limit: &one}, http.StatusOK, []string{"zfs:b"}},
+		{"invalid limit", "local", GetStoragesStorageReportsSnapshotsParams{Limit: &invalid}, http.StatusBadRequest, nil},
+		{"not supported", "remote", GetStoragesStorageReportsSnapshotsParams{}, http.StatusNotImplemented, nil},
+		{"not found", "missing", GetStoragesStorageReportsSnapshotsParams{}, http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/storages/"+string(tt.storage)+"/reports/snapshots", nil)
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageReportsSnapshots(w, req, tt.storage, tt.params)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var report SnapshotSpaceReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if report.Dataset != "tank/data" || report.Used != 1000 || report.Unique != 800 || report.Shared != 200 || report.Total != 3 {
+				t.Errorf("unexpected report %+v", report)
+			}
+			var got []string
+			for _, snap := range report.Snapshots {
+				got = append(got, snap.Id)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPins(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("current"), 0644)
+	daily := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-09")
+	os.MkdirAll(daily, 0755)
+	os.WriteFile(filepath.Join(daily, "file.txt"), []byte("old"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	defer store.Close()
+
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	createTests := []struct {
+		name   string
+		body   string
+		status int
+		pin    string
+	}{
+		{"default name", `{"storage":"local","snapshot":"zfs:daily-2025-11-09"}`, http.StatusCreated, "local.daily-2025-11-09"},
+		{"custom name", `{"storage":"local","snapshot":"zfs:daily-2025-11-09","name":"local.2025-11-09"}`, http.StatusCreated, "local.2025-11-09"},
+		{"duplicate", `{"storage":"local","snapshot":"zfs:daily-2025-11-09"}`, http.StatusConflict, ""},
+		{"invalid name", `{"storage":"local","snapshot":"zfs:daily-2025-11-09","name":"local@2025-11-09"}`, http.StatusBadRequest, ""},
+		{"missing snapshot", `{"storage":"local"}`, http.StatusBadRequest, ""},
+		{"unknown snapshot", `{"storage":"local","snapshot":"zfs:missing"}`, http.StatusNotFound, ""},
+		{"unknown storage", `{"storage":"other","snapshot":"zfs:daily-2025-11-09"}`, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range createTests {
+		t.Run("create "+tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/pins", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.PostPins(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.pin == "" {
+				return
+			}
+			var pin Pin
+			if err := json.NewDecoder(w.Body).Decode(&pin); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if pin.Name != tt.pin || pin.Storage != "local" || pin.Snapshot.Id != "zfs:daily-2025-11-09" {
+				t.Errorf("unexpected pin %+v", pin)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/pins", nil)
+		w := httptest.NewRecorder()
+		server.GetPins(w, req)
+
+		var response PinList
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(response.Pins) != 2 || response.Pins[0].Name != "local.2025-11-09" {
+			t.Errorf("unexpected pins %+v", response.Pins)
+		}
+	})
+
+	t.Run("read pinned content", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local.2025-11-09/nodes/file.txt", nil)
+		req.Header.Set("Accept", "application/octet-stream")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local.2025-11-09", "file.txt", GetStoragesStorageNodesPathParams{})
+
+		if w.Code != http.StatusOK || w.Body.String() != "old" {
+			t.Errorf("expected snapshot content, got %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("listing is read-only", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local.2025-11-09/nodes", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local.2025-11-09", "", GetStoragesStorageNodesPathParams{})
+
+		var response NodeList
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if !response.ReadOnly {
+			t.Error("expected pinned storage to be read-only")
+		}
+		if !slices.Contains(response.Storages, "local.2025-11-09") {
+			t.Errorf("expected pinned storage in storages, got %v", response.Storages)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.DeletePinsName(w, httptest.NewRequest(http.MethodDelete, "/pins/local.2025-11-09", nil), "local.2025-11-09")
+		if w.Code != http.StatusNoContent {
+			t.Errorf("expected status 204, got %d", w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		server.DeletePinsName(w, httptest.NewRequest(http.MethodDelete, "/pins/local", nil), "local")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected regular storage not to be unpinned, got %d", w.Code)
+		}
+		if _, err := server.getStorage(context.Background(), "local"); err != nil {
+			t.Errorf("expected local storage to remain: %v", err)
+		}
+	})
+}
+
+// mockHealthStorage implements storage.HealthChecker for testing
+type mockHealthStorage struct {
+	err   error
+	delay time.Duration
+}
+
+func (m *mockHealthStorage) CheckHealth() error {
+	time.Sleep(m.delay)
+	return m.err
+}
+
+func TestUIConfig(t *testing.T) {
+	store, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	server, err := NewServer(map[string]storage.Storage{"local": store, "snapshots": &mockSnapshotStorage{}}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	got := server.UIConfig("/timeship/", "/timeship/api")
+	want := UIConfig{
+		Base:      "/timeship/",
+		APIPrefix: "/timeship/api",
+		Auth:      AuthNone,
+		Features:  UIFeatures{Write: true, Snapshots: true, Search: true},
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	policy, err := access.New([]access.User{{Name: "admin", Token: "admin-token"}, {Name: "guest"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy, Recent: recent.New(0), CSRF: true, Branding: UIBranding{Name: "Offsite NAS"}})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if got := server.UIConfig("/", "/api"); got.Auth != AuthOptional || !got.CSRF || !got.Features.Recent || got.Features.Tags || got.Branding.Name != "Offsite NAS" {
+		t.Errorf("unexpected config %+v", got)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("healthz", func(t *testing.T) {
+		server, err := NewServer(map[string]storage.Storage{"local": &mockStorageV2{}}, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		server.GetHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var status HealthStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if status.Status != HealthStatusStatusOk {
+			t.Errorf("expected status ok, got %q", status.Status)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		storages   map[string]storage.Storage
+		wantStatus int
+		wantReady  map[string]bool
+	}{
+		{
+			name: "all ready",
+			storages: map[string]storage.Storage{
+				"checked": &mockHealthStorage{},
+				"listed":  &mockStorageV2{},
+				"other":   &mockSnapshotStorage{},
+			},
+			wantStatus: http.StatusOK,
+			wantReady:  map[string]bool{"checked": true, "listed": true, "other": true},
+		},
+		{
+			name: "failing check",
+			storages: map[string]storage.Storage{
+				"checked": &mockHealthStorage{err: fs.ErrNotExist},
+				"listed":  &mockStorageV2{},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReady:  map[string]bool{"checked": false, "listed": true},
+		},
+		{
+			name: "failing listing",
+			storages: map[string]storage.Storage{
+				"listed": &mockStorageV2{listErr: fs.ErrPermission},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReady:  map[string]bool{"listed": false},
+		},
+		{
+			name: "timeout",
+			storages: map[string]storage.Storage{
+				"slow": &mockHealthStorage{delay: time.Second},
+				"fast": &mockHealthStorage{},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReady:  map[string]bool{"slow": false, "fast": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("readyz "+tt.name, func(t *testing.T) {
+			var defaultName string
+			for name := range tt.storages {
+				defaultName = name
+			}
+			server, err := NewServerWithConfig(tt.storages, defaultName, Config{ReadinessTimeout: 50 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			server.GetReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var report ReadinessReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			wantReport := ReadinessReportStatusOk
+			if tt.wantStatus != http.StatusOK {
+				wantReport = ReadinessReportStatusUnavailable
+			}
+			if report.Status != wantReport {
+				t.Errorf("expected report status %q, got %q", wantReport, report.Status)
+			}
+			if len(report.Storages) != len(tt.wantReady) {
+				t.Fatalf("expected %d storages, got %d", len(tt.wantReady), len(report.Storages))
+			}
+			if !slices.IsSortedFunc(report.Storages, func(a, b StorageReadiness) int {
+				return strings.Compare(a.Name, b.Name)
+			}) {
+				t.Errorf("expected storages sorted by name")
+			}
+			for _, s := range report.Storages {
+				if s.Ready != tt.wantReady[s.Name] {
+					t.Errorf("storage %s: expected ready %v, got %v", s.Name, tt.wantReady[s.Name], s.Ready)
+				}
+				if !s.Ready && s.Error == nil {
+					t.Errorf("storage %s: expected an error", s.Name)
+				}
+			}
+
+			// The watchdog self-check agrees with the readiness check
+			if err := server.SelfCheck(50 * time.Millisecond); (err == nil) != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("unexpected self-check result %v", err)
+			}
+		})
+	}
+
+	t.Run("version", func(t *testing.T) {
+		build := BuildInfo{Version: "1.2.3", Commit: "abc123", Date: "2024-01-01", BuiltBy: "goreleaser"}
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": &mockStorageV2{}}, "local", Config{Build: build})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		server.GetVersion(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var info VersionInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if info.Version != build.Version || info.Commit != build.Commit || info.Date != build.Date || info.BuiltBy != build.BuiltBy {
+			t.Errorf("unexpected build info: %+v", info)
+		}
+		if info.GoVersion == "" {
+			t.Errorf("expected go version")
+		}
+	})
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func(prev trace.Tracer) { tracer = prev }(tracer)
+	tracer = provider.Tracer("test")
+
+	content := "Hello, World!"
+	mock := &mockStorageV2{
+		content:  content,
+		mimeType: "text/plain",
+		size:     int64(len(content)),
+		isFile:   true,
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": mock}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	ctx, parent := tracer.Start(t.Context(), "request")
+	req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/test.txt", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	snapshot := "snap1"
+	server.GetStoragesStorageNodesPath(w, req, "local", "test.txt", GetStoragesStorageNodesPathParams{Snapshot: &snapshot})
+	parent.End()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"storage.ListContents", "storage.MimeType", "storage.FileSize", "storage.ReadStream"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("expected span %s", name)
+			continue
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s: expected request span as parent", name)
+		}
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		if got := attrs["timeship.path"].AsString(); got != "test.txt" {
+			t.Errorf("span %s: expected path test.txt, got %q", name, got)
+		}
+		if got := attrs["timeship.snapshot"].AsString(); got != snapshot {
+			t.Errorf("span %s: expected snapshot %s, got %q", name, snapshot, got)
+		}
+	}
+
+	// Listing a file fails, which is how files are told apart from directories
+	if span := spans["storage.ListContents"]; span != nil && span.Status().Code != codes.Error {
+		t.Errorf("expected failed listing to be marked as error")
+	}
+	if span := spans["storage.ReadStream"]; span != nil {
+		var bytesRead int64
+		for _, kv := range span.Attributes() {
+			if kv.Key == "timeship.bytes_read" {
+				bytesRead = kv.Value.AsInt64()
+			}
+		}
+		if bytesRead != int64(len(content)) {
+			t.Errorf("expected %d bytes read, got %d", len(content), bytesRead)
+		}
+	}
+}
+
+// slowReader delays each read, simulating a slow storage
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.r.Read(p)
+}
+
+// mockSlowStorage streams its content slowly
+type mockSlowStorage struct {
+	mockStorageV2
+	delay time.Duration
+}
+
+func (m *mockSlowStorage) ReadStream(path url.URL) (io.ReadCloser, error) {
+	return io.NopCloser(&slowReader{r: strings.NewReader(m.content), delay: m.delay}), nil
+}
+
+func TestStreamingWriteTimeout(t *testing.T) {
+	content := strings.Repeat("x", 8*streamChunkSize)
+	mock := &mockSlowStorage{
+		mockStorageV2: mockStorageV2{
+			content:  content,
+			mimeType: "application/octet-stream",
+			size:     int64(len(content)),
+			isFile:   true,
+		},
+		delay: 20 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name         string
+		writeTimeout time.Duration
+		wantComplete bool
+	}{
+		{"fixed deadline cuts off download", 0, false},
+		{"extended deadline", 200 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServerWithConfig(map[string]storage.Storage{"local": mock}, "local", Config{WriteTimeout: tt.writeTimeout})
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			// The whole download takes longer than the server write timeout
+			ts := httptest.NewUnstartedServer(HandlerWithOptions(server, StdHTTPServerOptions{}))
+			ts.Config.WriteTimeout = 200 * time.Millisecond
+			ts.Start()
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + "/storages/local/nodes/big.bin")
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			complete := err == nil && len(body) == len(content)
+			if complete != tt.wantComplete {
+				t.Errorf("expected complete download %v, got %d of %d bytes (%v)", tt.wantComplete, len(body), len(content), err)
+			}
+		})
+	}
+}
+
+func TestDownloadRateLimit(t *testing.T) {
+	content := strings.Repeat("x", 256<<10)
+	mock := &mockStorageV2{
+		content:  content,
+		mimeType: "application/octet-stream",
+		size:     int64(len(content)),
+		isFile:   true,
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		minTime time.Duration
+	}{
+		{"unlimited", Config{}, 0},
+		// The first burst is free, the remaining 192KiB take 750ms
+		{"per stream", Config{StreamRateLimit: 256 << 10}, 600 * time.Millisecond},
+		{"total", Config{TotalRateLimit: 256 << 10}, 600 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServerWithConfig(map[string]storage.Storage{"local": mock}, "local", tt.config)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+
+			start := time.Now()
+			req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/big.bin", nil)
+			w := httptest.NewRecorder()
+			server.GetStoragesStorageNodesPath(w, req, "local", "big.bin", GetStoragesStorageNodesPathParams{})
+			elapsed := time.Since(start)
+
+			if w.Body.String() != content {
+				t.Fatalf("expected %d bytes, got %d", len(content), w.Body.Len())
+			}
+			if elapsed < tt.minTime {
+				t.Errorf("expected download to take at least %v, took %v", tt.minTime, elapsed)
+			}
+		})
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": mock}, "local", Config{StreamRateLimit: 1 << 10})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/big.bin", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "big.bin", GetStoragesStorageNodesPathParams{})
+
+		if w.Body.Len() >= len(content) {
+			t.Errorf("expected download to stop when the request is cancelled")
+		}
+	})
+}
+
+func TestServeContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "Hello, World!"
+	if err := os.WriteFile(filepath.Join(tmpDir, "hello.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(tmpDir, "hello.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		config     Config
+		header     http.Header
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "full content",
+			wantStatus: http.StatusOK,
+			wantBody:   content,
+		},
+		{
+			name:       "range",
+			header:     http.Header{"Range": {"bytes=7-11"}},
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "World",
+		},
+		{
+			name:       "range with limits",
+			config:     Config{WriteTimeout: time.Minute, StreamRateLimit: 1 << 20},
+			header:     http.Header{"Range": {"bytes=0-4"}},
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "Hello",
+		},
+		{
+			name:       "unsatisfiable range",
+			header:     http.Header{"Range": {"bytes=100-"}},
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:       "not modified",
+			header:     http.Header{"If-Modified-Since": {modTime.Format(http.TimeFormat)}},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "modified",
+			header:     http.Header{"If-Modified-Since": {modTime.Add(-time.Hour).Format(http.TimeFormat)}},
+			wantStatus: http.StatusOK,
+			wantBody:   content,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", tt.config)
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			ts := httptest.NewServer(HandlerWithOptions(server, StdHTTPServerOptions{}))
+			defer ts.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/storages/local/nodes/hello.txt", nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantBody && tt.wantBody != "" {
+				t.Errorf("expected body %q, got %q", tt.wantBody, body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if got := resp.Header.Get("Last-Modified"); got != modTime.Format(http.TimeFormat) {
+					t.Errorf("expected Last-Modified %q, got %q", modTime.Format(http.TimeFormat), got)
+				}
+				if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+					t.Errorf("expected Accept-Ranges bytes, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestServeContentIfRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "Hello, World!"
+	for _, name := range []string{"old.txt", "live.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(tmpDir, "old.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(HandlerWithOptions(server, StdHTTPServerOptions{}))
+	defer ts.Close()
+
+	get := func(name string, header http.Header) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/storages/local/nodes/"+name, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, _ := get("old.txt", nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+	liveResp, _ := get("live.txt", nil)
+
+	tests := []struct {
+		name       string
+		file       string
+		ifRange    string
+		wantStatus int
+		wantBody   string
+	}{
+		{"current etag", "old.txt", etag, http.StatusPartialContent, "World"},
+		{"changed etag", "old.txt", `"changed"`, http.StatusOK, content},
+		{"weak etag", "old.txt", "W/" + etag, http.StatusOK, content},
+		{"current date", "old.txt", modTime.Format(http.TimeFormat), http.StatusPartialContent, "World"},
+		{"changed date", "old.txt", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, content},
+		{"invalid date", "old.txt", "yesterday", http.StatusOK, content},
+		{"date of a live file", "live.txt", liveResp.Header.Get("Last-Modified"), http.StatusOK, content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(tt.file, http.Header{"Range": {"bytes=7-11"}, "If-Range": {tt.ifRange}})
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if body != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestCachedChecksum(t *testing.T) {
+	tmpDir := t.TempDir()
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily")
+	os.MkdirAll(snapDir, 0755)
+	content := "restored"
+	os.WriteFile(filepath.Join(snapDir, "file.txt"), []byte(content), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte(content), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	cache, err := metacache.Open(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	sum := sha256.Sum256([]byte(content))
+	err = cache.Add("local", storage.Snapshot{ID: "zfs:daily"}, func(add func(metacache.Entry) error) error {
+		return add(metacache.Entry{Path: "file.txt", Type: "file", Size: int64(len(content)), Hash: hex.EncodeToString(sum[:])})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := metacache.NewIndexer(cache, metacache.Config{})
+	defer indexer.Close()
+
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{MetadataCache: indexer})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	tests := []struct {
+		name     string
+		path     string
+		header   http.Header
+		wantSum  bool
+		wantCode int
+	}{
+		{"snapshot file", "/storages/local/nodes/file.txt?snapshot=zfs:daily", nil, true, http.StatusOK},
+		{"snapshot file range", "/storages/local/nodes/file.txt?snapshot=zfs:daily", http.Header{"Range": {"bytes=0-3"}}, true, http.StatusPartialContent},
+		{"live file", "/storages/local/nodes/file.txt", nil, false, http.StatusOK},
+		{"preview", "/storages/local/nodes/file.txt?snapshot=zfs:daily&bytes=0-3", nil, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+
+			checksum, digest := w.Header().Get("X-Checksum-SHA256"), w.Header().Get("Repr-Digest")
+			if !tt.wantSum {
+				if checksum != "" || digest != "" {
+					t.Errorf("expected no checksum, got %q and %q", checksum, digest)
+				}
+				return
+			}
+			if checksum != hex.EncodeToString(sum[:]) {
+				t.Errorf("expected checksum %x, got %q", sum, checksum)
+			}
+			if want := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"; digest != want {
+				t.Errorf("expected digest %q, got %q", want, digest)
+			}
+		})
+	}
+}
+
+func TestFilePreview(t *testing.T) {
+	content := "line 1\nline 2\nline 3\nline 4\nline 5\n"
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "app.log"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localStore, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	// The mock streams can't seek, so they are read from the start
+	mock := &mockStorageV2{
+		content:  content,
+		mimeType: "text/plain",
+		size:     int64(len(content)),
+		isFile:   true,
+	}
+
+	tests := []struct {
+		name       string
+		lines      string
+		bytes      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "head lines", lines: "1-2", wantStatus: http.StatusOK, wantBody: "line 1\nline 2\n"},
+		{name: "middle lines", lines: "2-3", wantStatus: http.StatusOK, wantBody: "line 2\nline 3\n"},
+		{name: "lines to end", lines: "4-", wantStatus: http.StatusOK, wantBody: "line 4\nline 5\n"},
+		{name: "lines past end", lines: "4-100", wantStatus: http.StatusOK, wantBody: "line 4\nline 5\n"},
+		{name: "lines after end", lines: "10-20", wantStatus: http.StatusOK, wantBody: ""},
+		{name: "tail lines", lines: "-2", wantStatus: http.StatusOK, wantBody: "line 4\nline 5\n"},
+		{name: "tail more lines than file", lines: "-10", wantStatus: http.StatusOK, wantBody: content},
+		{name: "head bytes", bytes: "0-5", wantStatus: http.StatusOK, wantBody: "line 1"},
+		{name: "middle bytes", bytes: "7-12", wantStatus: http.StatusOK, wantBody: "line 2"},
+		{name: "bytes to end", bytes: "28-", wantStatus: http.StatusOK, wantBody: "line 5\n"},
+		{name: "tail bytes", bytes: "-7", wantStatus: http.StatusOK, wantBody: "line 5\n"},
+		{name: "bytes after end", bytes: "100-200", wantStatus: http.StatusOK, wantBody: ""},
+		{name: "line zero", lines: "0-2", wantStatus: http.StatusBadRequest},
+		{name: "reversed range", bytes: "5-2", wantStatus: http.StatusBadRequest},
+		{name: "not a range", lines: "10", wantStatus: http.StatusBadRequest},
+		{name: "empty tail", lines: "-0", wantStatus: http.StatusBadRequest},
+		{name: "lines and bytes", lines: "1-2", bytes: "0-10", wantStatus: http.StatusBadRequest},
+	}
+
+	stores := map[string]storage.Storage{"seekable": localStore, "stream": mock}
+	for name, store := range stores {
+		server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		ts := httptest.NewServer(Handler(server))
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				query := url.Values{}
+				if tt.lines != "" {
+					query.Set("lines", tt.lines)
+				}
+				if tt.bytes != "" {
+					query.Set("bytes", tt.bytes)
+				}
+				resp, err := http.Get(ts.URL + "/storages/local/nodes/app.log?" + query.Encode())
+				if err != nil {
+					t.Fatalf("request failed: %v", err)
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode != tt.wantStatus {
+					t.Fatalf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+				}
+				if tt.wantStatus != http.StatusOK {
+					return
+				}
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.wantBody {
+					t.Errorf("expected body %q, got %q", tt.wantBody, body)
+				}
+				if got := resp.Header.Get("X-File-Size"); got != strconv.Itoa(len(content)) {
+					t.Errorf("expected X-File-Size %d, got %q", len(content), got)
+				}
+			})
+		}
+	}
+}
+
+func TestHexdump(t *testing.T) {
+	content := "0123456789abcdef\x00\x01\xffHello, world!\n"
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "data.bin"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localStore, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	mock := &mockStorageV2{
+		content:  content,
+		mimeType: "application/octet-stream",
+		size:     int64(len(content)),
+		isFile:   true,
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "whole file",
+			query:      "format=hexdump",
+			wantStatus: http.StatusOK,
+			wantBody: "00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+				"00000010  00 01 ff 48 65 6c 6c 6f  2c 20 77 6f 72 6c 64 21  |...Hello, world!|\n" +
+				"00000020  0a                                                |.|\n",
+		},
+		{
+			name:       "range",
+			query:      "format=hexdump&offset=14&length=6",
+			wantStatus: http.StatusOK,
+			wantBody:   "0000000e  65 66 00 01 ff 48                                 |ef...H|\n",
+		},
+		{name: "past end", query: "format=hexdump&offset=100", wantStatus: http.StatusOK, wantBody: ""},
+		{name: "too long", query: "format=hexdump&length=2000000", wantStatus: http.StatusBadRequest},
+		{name: "negative offset", query: "format=hexdump&offset=-1", wantStatus: http.StatusBadRequest},
+		{name: "unknown format", query: "format=base64", wantStatus: http.StatusBadRequest},
+		{name: "with lines", query: "format=hexdump&lines=1-2", wantStatus: http.StatusBadRequest},
+	}
+
+	stores := map[string]storage.Storage{"seekable": localStore, "stream": mock}
+	for name, store := range stores {
+		server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		ts := httptest.NewServer(Handler(server))
+		defer ts.Close()
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				resp, err := http.Get(ts.URL + "/storages/local/nodes/data.bin?" + tt.query)
+				if err != nil {
+					t.Fatalf("request failed: %v", err)
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode != tt.wantStatus {
+					t.Fatalf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+				}
+				if tt.wantStatus != http.StatusOK {
+					return
+				}
+				if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+					t.Errorf("expected text/plain, got %q", ct)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.wantBody {
+					t.Errorf("expected body\n%s\ngot\n%s", tt.wantBody, body)
+				}
+			})
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "app.log")
+	if err := os.WriteFile(logPath, []byte("line 1\nline 2\nline 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "app.log"), []byte("line 1\n"), 0644)
+	localStore, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	mock := &mockStorageV2{content: "line 1\n", mimeType: "text/plain", size: 7, isFile: true}
+
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": localStore, "mock": mock}, "local", Config{WriteTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(Handler(server))
+	defer ts.Close()
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			url        string
+			wantStatus int
+		}{
+			{"not supported", "/storages/mock/nodes/app.log?follow=true", http.StatusNotImplemented},
+			{"closed range", "/storages/local/nodes/app.log?follow=true&lines=1-2", http.StatusBadRequest},
+			{"snapshot", "/storages/local/nodes/app.log?follow=true&snapshot=zfs:daily", http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, err := http.Get(ts.URL + tt.url)
+				if err != nil {
+					t.Fatalf("request failed: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+				}
+			})
+		}
+	})
+
+	follow := func(t *testing.T, query string, expected ...string) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/storages/local/nodes/app.log?follow=true"+query, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+
+		buf := make([]byte, len(expected[0]))
+		if _, err := io.ReadFull(resp.Body, buf); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if string(buf) != expected[0] {
+			t.Errorf("expected %q, got %q", expected[0], buf)
+		}
+
+		// Appended lines arrive while the response is open
+		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(expected[1])
+		f.Close()
+
+		buf = make([]byte, len(expected[1]))
+		if _, err := io.ReadFull(resp.Body, buf); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if string(buf) != expected[1] {
+			t.Errorf("expected %q, got %q", expected[1], buf)
+		}
+	}
+
+	t.Run("tail lines", func(t *testing.T) {
+		follow(t, "&lines=-2", "line 2\nline 3\n", "line 4\n")
+	})
+
+	t.Run("from line", func(t *testing.T) {
+		follow(t, "&lines=4-", "line 4\n", "line 5\n")
+	})
+
+	t.Run("tail bytes", func(t *testing.T) {
+		follow(t, "&bytes=-7", "line 5\n", "line 6\n")
+	})
+
+	t.Run("default tail", func(t *testing.T) {
+		follow(t, "", "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n", "line 7\n")
+	})
+}
+
+func TestRenderPreview(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"README.md": "# Hello\n\n<script>alert(1)</script>\n",
+		"main.go":   "package main\n",
+		"image.png": "\x89PNG\r\n\x1a\n\x00\x00",
+		"big.txt":   strings.Repeat("x", 1<<20+1),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "README.md"), []byte("# Old\n"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(Handler(server))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		contains   string
+		excludes   string
+	}{
+		{"markdown", "/storages/local/render/README.md", http.StatusOK, "<h1>Hello</h1>", "<script"},
+		{"snapshot", "/storages/local/render/README.md?snapshot=zfs:daily", http.StatusOK, "<h1>Old</h1>", ""},
+		{"source", "/storages/local/render/main.go", http.StatusOK, "<pre", ""},
+		{"binary", "/storages/local/render/image.png", http.StatusUnsupportedMediaType, "", ""},
+		{"too large", "/storages/local/render/big.txt", http.StatusRequestEntityTooLarge, "", ""},
+		{"missing", "/storages/local/render/missing.md", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tt.url)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+				t.Errorf("expected HTML, got %q", ct)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), tt.contains) {
+				t.Errorf("expected %q in %s", tt.contains, body)
+			}
+			if tt.excludes != "" && strings.Contains(string(body), tt.excludes) {
+				t.Errorf("expected no %q in %s", tt.excludes, body)
+			}
+		})
+	}
+}
+
+func TestImageMetadata(t *testing.T) {
+	tmpDir := t.TempDir()
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 3, 5)))
+	os.WriteFile(filepath.Join(tmpDir, "photo.png"), img.Bytes(), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("hello"), 0644)
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily")
+	os.MkdirAll(snapDir, 0755)
+	img.Reset()
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 7, 2)))
+	os.WriteFile(filepath.Join(snapDir, "photo.png"), img.Bytes(), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	fields := "(exif)"
+
+	listImages := func(t *testing.T, params GetStoragesStorageNodesPathParams) map[string]*ImageMetadata {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "", params)
+		var list NodeList
+		if err := json.NewDecoder(w.Result().Body).Decode(&list); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		images := map[string]*ImageMetadata{}
+		for _, node := range list.Files {
+			images[node.Basename] = node.Image
+		}
+		return images
+	}
+
+	t.Run("listing", func(t *testing.T) {
+		images := listImages(t, GetStoragesStorageNodesPathParams{Fields: &fields})
+		if m := images["photo.png"]; m == nil || *m.Width != 3 || *m.Height != 5 {
+			t.Errorf("unexpected metadata %+v", m)
+		}
+		if images["notes.txt"] != nil {
+			t.Errorf("expected no metadata for text files, got %+v", images["notes.txt"])
+		}
+	})
+
+	t.Run("snapshot listing", func(t *testing.T) {
+		snapshot := "zfs:daily"
+		images := listImages(t, GetStoragesStorageNodesPathParams{Fields: &fields, Snapshot: &snapshot})
+		if m := images["photo.png"]; m == nil || *m.Width != 7 || *m.Height != 2 {
+			t.Errorf("unexpected metadata %+v", m)
+		}
+	})
+
+	t.Run("not requested", func(t *testing.T) {
+		if m := listImages(t, GetStoragesStorageNodesPathParams{})["photo.png"]; m != nil {
+			t.Errorf("expected no metadata, got %+v", m)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/photo.png", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "photo.png", GetStoragesStorageNodesPathParams{Fields: &fields})
+		var node Node
+		if err := json.NewDecoder(w.Result().Body).Decode(&node); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if node.Image == nil || *node.Image.Width != 3 || node.Image.DateTaken != nil {
+			t.Errorf("unexpected metadata %+v", node.Image)
+		}
+	})
+}
+
+// testPDF builds a PDF with the given number of empty pages
+func testPDF(pages int) []byte {
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", i+3))
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages)
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestPDFPreview(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "report.pdf"), testPDF(3), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("hello"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	storages := map[string]storage.Storage{"local": store}
+	server, err := NewServer(storages, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	t.Run("page count", func(t *testing.T) {
+		fields := "(pages)"
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "", GetStoragesStorageNodesPathParams{Fields: &fields})
+		var list NodeList
+		if err := json.NewDecoder(w.Result().Body).Decode(&list); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		for _, node := range list.Files {
+			switch node.Basename {
+			case "report.pdf":
+				if node.PageCount == nil || *node.PageCount != 3 {
+					t.Errorf("expected 3 pages, got %v", node.PageCount)
+				}
+			case "notes.txt":
+				if node.PageCount != nil {
+					t.Errorf("expected no page count, got %d", *node.PageCount)
+				}
+			}
+		}
+	})
+
+	thumbnail := func(t *testing.T, server *Server, path string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/thumbnails/"+path, nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageThumbnailsPath(w, req, "local", path, GetStoragesStorageThumbnailsPathParams{})
+		return w.Result()
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		if resp := thumbnail(t, server, "report.pdf"); resp.StatusCode != http.StatusNotImplemented {
+			t.Errorf("expected status 501, got %d", resp.StatusCode)
+		}
+	})
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fake mutool is a shell script")
+	}
+	// Writes a fake PNG to the output path
+	mutool := filepath.Join(t.TempDir(), "mutool")
+	script := "#!/bin/sh\nwhile [ \"$1\" != \"-o\" ]; do shift; done\nprintf 'PNG' > \"$2\"\n"
+	if err := os.WriteFile(mutool, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	server, err = NewServerWithConfig(storages, "local", Config{PDFRenderer: pdfpreview.NewRenderer(mutool, "")})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	t.Run("thumbnail", func(t *testing.T) {
+		resp := thumbnail(t, server, "report.pdf")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+			t.Errorf("expected image/png, got %q", ct)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != "PNG" {
+			t.Errorf("unexpected thumbnail %q", body)
+		}
+	})
+
+	t.Run("not a pdf", func(t *testing.T) {
+		if resp := thumbnail(t, server, "notes.txt"); resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status 415, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if resp := thumbnail(t, server, "missing.pdf"); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestDownloads(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs", "reports"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("current a"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "reports", "q1.txt"), []byte("q1"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "photos"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "photos", "cat.jpg"), []byte("cat"), 0644)
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily", "docs")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "a.txt"), []byte("old a"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	download := func(t *testing.T, body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/downloads", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageDownloads(w, req, "local")
+		return w.Result()
+	}
+	readZip := func(t *testing.T, resp *http.Response) map[string]string {
+		t.Helper()
+		data, _ := io.ReadAll(resp.Body)
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("failed to read zip: %v", err)
+		}
+		files := map[string]string{}
+		for _, f := range zr.File {
+			rc, _ := f.Open()
+			content, _ := io.ReadAll(rc)
+			rc.Close()
+			files[f.Name] = string(content)
+		}
+		return files
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{
+			name: "files from different directories",
+			body: `{"items": [{"path": "docs/a.txt"}, {"path": "photos/cat.jpg"}]}`,
+			want: map[string]string{"docs/a.txt": "current a", "photos/cat.jpg": "cat"},
+		},
+		{
+			name: "directory",
+			body: `{"items": [{"path": "docs/reports"}, {"path": "docs/reports/q1.txt"}]}`,
+			want: map[string]string{"reports/": "", "reports/q1.txt": "q1"},
+		},
+		{
+			name: "snapshot",
+			body: `{"items": [{"path": "docs/a.txt", "snapshot": "zfs:daily"}]}`,
+			want: map[string]string{"a.txt": "old a"},
+		},
+		{
+			name: "mixed sources",
+			body: `{"items": [{"path": "docs/a.txt"}, {"path": "docs/a.txt", "snapshot": "zfs:daily"}]}`,
+			want: map[string]string{"current/a.txt": "current a", "zfs_daily/a.txt": "old a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := download(t, tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", resp.StatusCode)
+			}
+			if got := readZip(t, resp); !maps.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("tar.gz", func(t *testing.T) {
+		resp := download(t, `{"name": "selected", "format": "tar.gz", "items": [{"path": "docs/a.txt"}]}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="selected.tar.gz"` {
+			t.Errorf("unexpected disposition %s", got)
+		}
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read gzip: %v", err)
+		}
+		h, err := tar.NewReader(gz).Next()
+		if err != nil || h.Name != "a.txt" || h.Size != int64(len("current a")) {
+			t.Errorf("unexpected entry %+v: %v", h, err)
+		}
+	})
+
+	t.Run("special files skipped", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("Unix sockets are listed as regular files on Windows")
+		}
+		os.MkdirAll(filepath.Join(tmpDir, "run"), 0755)
+		os.WriteFile(filepath.Join(tmpDir, "run", "app.pid"), []byte("42"), 0644)
+		ln, err := net.Listen("unix", filepath.Join(tmpDir, "run", "app.sock"))
+		if err != nil {
+			t.Skipf("unable to create socket: %v", err)
+		}
+		defer ln.Close()
+
+		resp := download(t, `{"items": [{"path": "run"}, {"path": "docs/a.txt"}]}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		want := map[string]string{"run/": "", "run/app.pid": "42", "docs/a.txt": "current a"}
+		if got := readZip(t, resp); !maps.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+
+		resp = download(t, `{"items": [{"path": "run/app.sock"}, {"path": "run/app.pid"}]}`)
+		want = map[string]string{"app.pid": "42"}
+		if got := readZip(t, resp); !maps.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/run/app.sock", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "run/app.sock", GetStoragesStorageNodesPathParams{})
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status 422 reading socket, got %d", w.Code)
+		}
+	})
+
+	t.Run("directory download", func(t *testing.T) {
+		modTime := time.Date(2024, 7, 1, 14, 3, 22, 0, time.UTC)
+		q1 := filepath.Join(tmpDir, "docs", "reports", "q1.txt")
+		os.Chmod(q1, 0600)
+		os.Chtimes(q1, modTime, modTime)
+
+		format := GetStoragesStorageNodesPathParamsFormatTarZst
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/docs?format=tar.zst", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "docs", GetStoragesStorageNodesPathParams{Format: &format})
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="docs.tar.zst"` {
+			t.Errorf("unexpected disposition %s", got)
+		}
+		zr, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read zstd: %v", err)
+		}
+		defer zr.Close()
+		headers := map[string]*tar.Header{}
+		tr := tar.NewReader(zr)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read tar: %v", err)
+			}
+			headers[h.Name] = h
+		}
+		h := headers["docs/reports/q1.txt"]
+		if h == nil {
+			t.Fatalf("expected docs/reports/q1.txt, got %v", slices.Collect(maps.Keys(headers)))
+		}
+		if runtime.GOOS != "windows" && h.Mode != 0600 {
+			t.Errorf("expected mode 0600, got %o", h.Mode)
+		}
+		if !h.ModTime.Equal(modTime) {
+			t.Errorf("expected modification time %v, got %v", modTime, h.ModTime)
+		}
+		if headers["docs/"] == nil || headers["docs/a.txt"] == nil {
+			t.Errorf("expected the directory with its files, got %v", slices.Collect(maps.Keys(headers)))
+		}
+	})
+
+	t.Run("archive format of file", func(t *testing.T) {
+		format := GetStoragesStorageNodesPathParamsFormatZip
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/docs/a.txt?format=zip", nil)
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "docs/a.txt", GetStoragesStorageNodesPathParams{Format: &format})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+
+	errorTests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"missing item", `{"items": [{"path": "docs/missing.txt"}]}`, http.StatusNotFound},
+		{"no items", `{"items": []}`, http.StatusBadRequest},
+		{"unknown format", `{"format": "rar", "items": [{"path": "docs"}]}`, http.StatusBadRequest},
+		{"invalid name", `{"name": "../x", "items": [{"path": "docs"}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := download(t, tt.body); resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestArchiveManifest(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs", "reports"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("current a"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "reports", "q1.txt"), []byte("q1"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "backups"), 0755)
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily", "docs")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "a.txt"), []byte("old a"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{SigningKey: key})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	create := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/archives?path=backups", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	verify := func(t *testing.T, archivePath string) ArchiveVerification {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/verifications/"+archivePath, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var result ArchiveVerification
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode verification: %v", err)
+		}
+		return result
+	}
+
+	w := create(t, `{"name": "backup", "items": [{"path": "docs"}, {"path": "docs/a.txt", "snapshot": "zfs:daily"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != "/storages/local/nodes/backups/backup.zip" {
+		t.Errorf("unexpected location %q", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "backups", "backup.zip.manifest.json"))
+	if err != nil {
+		t.Fatalf("expected a manifest: %v", err)
+	}
+	var m manifest.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	sum := sha256.Sum256([]byte("old a"))
+	want := []manifest.File{
+		{Path: "current/docs/a.txt", Size: 9},
+		{Path: "current/docs/reports/q1.txt", Size: 2},
+		{Path: "zfs_daily/docs/a.txt", Size: 5, SHA256: hex.EncodeToString(sum[:])},
+	}
+	if len(m.Files) != len(want) || m.Path != "backups/backup.zip" || m.Signature == "" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	for i := range want {
+		if m.Files[i].Path != want[i].Path || m.Files[i].Size != want[i].Size {
+			t.Errorf("expected %+v, got %+v", want[i], m.Files[i])
+		}
+	}
+	if m.Files[2].SHA256 != want[2].SHA256 {
+		t.Errorf("expected checksum %s, got %s", want[2].SHA256, m.Files[2].SHA256)
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		result := verify(t, "backups/backup.zip")
+		if !result.Ok || result.Checked != 3 || result.Signature != Valid {
+			t.Errorf("expected a valid archive, got %+v", result)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		if w := create(t, `{"name": "backup", "items": [{"path": "docs"}]}`); w.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("missing item", func(t *testing.T) {
+		if w := create(t, `{"name": "other", "items": [{"path": "missing"}]}`); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "backups", "other.zip")); err == nil {
+			t.Error("expected no archive")
+		}
+	})
+
+	t.Run("tampered archive", func(t *testing.T) {
+		var buf bytes.Buffer
+		aw, _ := archive.NewWriter(&buf, archive.Zip)
+		aw.Add(archive.Entry{Name: "current/docs/a.txt", Size: 9}, strings.NewReader("changed a"))
+		aw.Add(archive.Entry{Name: "extra.txt", Size: 1}, strings.NewReader("x"))
+		aw.Close()
+		os.WriteFile(filepath.Join(tmpDir, "backups", "tampered.zip"), buf.Bytes(), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "backups", "tampered.zip.manifest.json"), data, 0644)
+
+		result := verify(t, "backups/tampered.zip")
+		if result.Ok || result.Checked != 0 || result.Signature != Valid ||
+			!slices.Equal(result.Changed, []string{"current/docs/a.txt"}) ||
+			!slices.Equal(result.Missing, []string{"current/docs/reports/q1.txt", "zfs_daily/docs/a.txt"}) ||
+			!slices.Equal(result.Unexpected, []string{"extra.txt"}) {
+			t.Errorf("unexpected verification %+v", result)
+		}
+	})
+
+	t.Run("tampered manifest", func(t *testing.T) {
+		tampered := m
+		tampered.Files = slices.Clone(m.Files)
+		tampered.Files[0].SHA256 = tampered.Files[1].SHA256
+		manifestData, _ := json.Marshal(tampered)
+		archiveData, _ := os.ReadFile(filepath.Join(tmpDir, "backups", "backup.zip"))
+		os.WriteFile(filepath.Join(tmpDir, "backups", "resigned.zip"), archiveData, 0644)
+		os.WriteFile(filepath.Join(tmpDir, "backups", "resigned.zip.manifest.json"), manifestData, 0644)
+
+		result := verify(t, "backups/resigned.zip")
+		if result.Ok || result.Signature != Invalid {
+			t.Errorf("expected an invalid signature, got %+v", result)
+		}
+	})
+
+	t.Run("no manifest", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "backups", "plain.zip"), []byte("zip"), 0644)
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/verifications/backups/plain.zip", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+}
+
+// BenchmarkCopyBuffer compares io.Copy with pooled buffers when hashing small
+// files, as done for content digests
+func BenchmarkCopyBuffer(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "small.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 4<<10)), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	copies := []struct {
+		name string
+		copy func(io.Writer, io.Reader) (int64, error)
+	}{
+		{"io.Copy", io.Copy},
+		{"pooled", copyBuffer},
+	}
+
+	for _, c := range copies {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				h := sha256.New()
+				for pb.Next() {
+					f, err := os.Open(path)
+					if err != nil {
+						b.Fatal(err)
+					}
+					h.Reset()
+					if _, err := c.copy(h, f); err != nil {
+						b.Fatal(err)
+					}
+					f.Close()
+				}
+			})
+		})
+	}
+}
+
+func TestIndexManagement(t *testing.T) {
+	tmpDir := t.TempDir()
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-09")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "file.txt"), []byte("old"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	storages := map[string]storage.Storage{"local": store}
+
+	cache, err := metacache.Open(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	indexer := metacache.NewIndexer(cache, metacache.Config{})
+	defer indexer.Close()
+
+	server, err := NewServerWithConfig(storages, "local", Config{MetadataCache: indexer})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	request := func(method, path string) (*httptest.ResponseRecorder, IndexStatus) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		var status IndexStatus
+		if w.Header().Get("Content-Type") == "application/json" {
+			if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+		return w, status
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		server, _ := NewServer(storages, "local")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageIndex(w, httptest.NewRequest(http.MethodGet, "/storages/local/index", nil), "local")
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("expected 501, got %d", w.Code)
+		}
+	})
+
+	t.Run("unknown storage", func(t *testing.T) {
+		if w, _ := request(http.MethodGet, "/storages/missing/index"); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("pause", func(t *testing.T) {
+		w, status := request(http.MethodPost, "/storages/local/index/pause")
+		if w.Code != http.StatusOK || !status.Paused {
+			t.Errorf("expected paused, got %d %+v", w.Code, status)
+		}
+	})
+
+	t.Run("trigger while paused", func(t *testing.T) {
+		w, status := request(http.MethodPost, "/storages/local/index")
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", w.Code)
+		}
+		if status.Storage != "local" || status.Queued != 1 || status.Indexed != 0 {
+			t.Errorf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		w, status := request(http.MethodPost, "/storages/local/index/resume")
+		if w.Code != http.StatusOK || status.Paused {
+			t.Fatalf("expected resumed, got %d %+v", w.Code, status)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for indexer.Pending() > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for indexer")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		_, status = request(http.MethodGet, "/storages/local/index")
+		if status.Indexed != 1 || status.Nodes != 1 || status.LastIndexed == nil || status.NextRun != nil {
+			t.Errorf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		if w, _ := request(http.MethodDelete, "/storages/local/index"); w.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", w.Code)
+		}
+		if _, status := request(http.MethodGet, "/storages/local/index"); status.Indexed != 0 {
+			t.Errorf("expected empty index, got %+v", status)
+		}
+	})
+}
+
+func TestReports(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := time.Now().Add(-72 * time.Hour)
+	files := []struct {
+		path    string
+		size    int
+		modTime time.Time
+	}{
+		{"videos/holiday.mp4", 3000, old},
+		{"videos/2024/trip.mp4", 2000, time.Now()},
+		{"docs/report.txt", 100, time.Now()},
+		{"docs/notes.txt", 10, time.Now()},
+		{"docs/old.txt", 50, old},
+	}
+	for _, f := range files {
+		p := filepath.Join(tmpDir, f.path)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, make([]byte, f.size), 0644)
+		os.Chtimes(p, f.modTime, f.modTime)
+	}
+
+	// The snapshot has an unchanged and an older version of two files
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-09", "docs")
+	os.MkdirAll(snapDir, 0755)
+	for _, f := range files[2:4] {
+		p := filepath.Join(snapDir, filepath.Base(f.path))
+		size := f.size
+		if f.path == "docs/notes.txt" {
+			size = 5
+		}
+		os.WriteFile(p, make([]byte, size), 0644)
+		os.Chtimes(p, f.modTime, f.modTime)
+	}
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	storages := map[string]storage.Storage{
+		"local": store,
+		// Walked by listing each directory
+		"listed": &mockStorageV2{nodes: []storage.FileNode{
+			{Path: url.URL{Scheme: "listed", Path: "a.bin"}, Type: "file", Size: 7},
+		}},
+	}
+	server, err := NewServer(storages, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	report := func(t *testing.T, target string) (int, []ReportFile) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("expected ndjson, got %q", ct)
+		}
+		var lines []ReportFile
+		dec := json.NewDecoder(w.Body)
+		for dec.More() {
+			var line ReportFile
+			if err := dec.Decode(&line); err != nil {
+				t.Fatalf("failed to decode line: %v", err)
+			}
+			lines = append(lines, line)
+		}
+		return w.Code, lines
+	}
+
+	paths := func(lines []ReportFile) []string {
+		var paths []string
+		for _, line := range lines {
+			paths = append(paths, line.Path)
+		}
+		return paths
+	}
+
+	t.Run("largest", func(t *testing.T) {
+		_, lines := report(t, "/storages/local/reports/largest?limit=3")
+		expected := []string{"videos/holiday.mp4", "videos/2024/trip.mp4", "docs/report.txt"}
+		if got := paths(lines); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		if lines[0].Size != 3000 {
+			t.Errorf("expected size 3000, got %d", lines[0].Size)
+		}
+	})
+
+	t.Run("largest below path", func(t *testing.T) {
+		_, lines := report(t, "/storages/local/reports/largest?path=docs")
+		expected := []string{"docs/report.txt", "docs/old.txt", "docs/notes.txt"}
+		if got := paths(lines); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("largest in snapshot", func(t *testing.T) {
+		_, lines := report(t, "/storages/local/reports/largest?snapshot=zfs:daily-2025-11-09")
+		expected := []string{"docs/report.txt", "docs/notes.txt"}
+		if got := paths(lines); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("recent", func(t *testing.T) {
+		_, lines := report(t, "/storages/local/reports/recent?since=24h")
+		got := paths(lines)
+		slices.Sort(got)
+		expected := []string{"docs/notes.txt", "docs/report.txt", "videos/2024/trip.mp4"}
+		if !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		for _, line := range lines {
+			if line.Change != nil {
+				t.Errorf("expected no change without compare, got %v", *line.Change)
+			}
+		}
+	})
+
+	t.Run("recent with limit", func(t *testing.T) {
+		_, lines := report(t, "/storages/local/reports/recent?limit=2")
+		if len(lines) != 2 {
+			t.Errorf("expected 2 files, got %v", paths(lines))
+		}
+	})
+
+	t.Run("recent compared with snapshot", func(t *testing.T) {
+		_, lines := report(t, "/storages/local/reports/recent?compare=true")
+		changes := map[string]ReportFileChange{}
+		for _, line := range lines {
+			if line.Change == nil {
+				t.Fatalf("expected change for %s", line.Path)
+			}
+			changes[line.Path] = *line.Change
+			if *line.Change != Added && (line.Snapshot == nil || *line.Snapshot != "zfs:daily-2025-11-09") {
+				t.Errorf("expected snapshot for %s, got %v", line.Path, line.Snapshot)
+			}
+		}
+		expected := map[string]ReportFileChange{
+			"docs/report.txt":      Unchanged,
+			"docs/notes.txt":       Modified,
+			"videos/2024/trip.mp4": Added,
+		}
+		if !maps.Equal(changes, expected) {
+			t.Errorf("expected %v, got %v", expected, changes)
+		}
+	})
+
+	t.Run("listed storage", func(t *testing.T) {
+		_, lines := report(t, "/storages/listed/reports/largest")
+		if len(lines) != 1 || lines[0].Path != "a.bin" || lines[0].Size != 7 {
+			t.Errorf("unexpected report %+v", lines)
+		}
+	})
+
+	failures := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"missing directory", "/storages/local/reports/largest?path=missing", http.StatusNotFound},
+		{"missing storage", "/storages/missing/reports/largest", http.StatusNotFound},
+		{"invalid since", "/storages/local/reports/recent?since=yesterday", http.StatusBadRequest},
+		{"invalid limit", "/storages/local/reports/largest?limit=0", http.StatusBadRequest},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := report(t, tt.target); code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, code)
+			}
+		})
+	}
+}
+
+func TestCopies(t *testing.T) {
+	modTime := time.Date(2024, 7, 1, 14, 3, 22, 0, time.UTC)
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "backup"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("current a"), 0644)
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily", "docs")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "a.txt"), []byte("old a"), 0600)
+	os.Chtimes(filepath.Join(snapDir, "a.txt"), modTime, modTime)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	copyNodes := func(t *testing.T, body string) (int, CopyResult) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/copies", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageCopies(w, req, "local")
+		var result CopyResult
+		if w.Code == http.StatusOK || w.Code == http.StatusMultiStatus {
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Fatalf("failed to decode result: %v", err)
+			}
+		}
+		return w.Code, result
+	}
+
+	t.Run("restore with preserve", func(t *testing.T) {
+		code, result := copyNodes(t, `{"destination":"backup","preserve":true,"items":[{"path":"docs/a.txt","snapshot":"zfs:daily"}]}`)
+		if code != http.StatusOK || result.Copied != 1 {
+			t.Fatalf("expected 1 copied with 200, got %d: %+v", code, result)
+		}
+		if got := result.Results[0]; got.Destination != "backup/a.txt" || got.Status != Success {
+			t.Errorf("unexpected result %+v", got)
+		}
+		info, err := os.Stat(filepath.Join(tmpDir, "backup", "a.txt"))
+		if err != nil {
+			t.Fatalf("expected restored file: %v", err)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("expected modification time %v, got %v", modTime, info.ModTime())
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+			t.Errorf("expected permissions 0600, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		code, result := copyNodes(t, `{"destination":"backup","items":[{"path":"docs"},{"path":"missing.txt"}]}`)
+		if code != http.StatusMultiStatus || result.Copied != 1 || len(result.Results) != 2 {
+			t.Fatalf("expected 1 of 2 copied with 207, got %d: %+v", code, result)
+		}
+		if got := result.Results[1]; got.Status != Error || got.Error == nil {
+			t.Errorf("expected error result, got %+v", got)
+		}
+	})
+
+	t.Run("existing destination", func(t *testing.T) {
+		code, result := copyNodes(t, `{"destination":"backup","items":[{"path":"docs/a.txt"}]}`)
+		if code != http.StatusMultiStatus || result.Copied != 0 {
+			t.Errorf("expected nothing copied with 207, got %d: %+v", code, result)
+		}
+		if data, _ := os.ReadFile(filepath.Join(tmpDir, "backup", "a.txt")); string(data) != "old a" {
+			t.Errorf("expected existing file to be kept, got %q", data)
+		}
+	})
+
+	t.Run("no items", func(t *testing.T) {
+		if code, _ := copyNodes(t, `{"destination":"backup","items":[]}`); code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", code)
+		}
+	})
+}
+
+func TestUpdateNode(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte("a: 1\n"), 0600)
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	read := func(t *testing.T) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/config.yaml", nil)
+		req.Header.Set("Accept", "application/octet-stream")
+		w := httptest.NewRecorder()
+		server.GetStoragesStorageNodesPath(w, req, "local", "config.yaml", GetStoragesStorageNodesPathParams{})
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("expected ETag on file content")
+		}
+		return etag
+	}
+	update := func(t *testing.T, nodePath string, body string, params PatchStoragesStorageNodesPathParams) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPatch, "/storages/local/nodes/"+nodePath, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		server.PatchStoragesStorageNodesPath(w, req, "local", nodePath, params)
+		return w
+	}
+	content := func() string {
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "config.yaml"))
+		return string(data)
+	}
+
+	t.Run("matching etag", func(t *testing.T) {
+		etag := read(t)
+		w := update(t, "config.yaml", `{"content":"a: 2\n"}`, PatchStoragesStorageNodesPathParams{IfMatch: &etag})
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if content() != "a: 2\n" {
+			t.Errorf("expected updated content, got %q", content())
+		}
+		if newETag := w.Header().Get("ETag"); newETag == "" || newETag == etag || newETag != read(t) {
+			t.Errorf("expected new ETag matching reads, got %q", newETag)
+		}
+		info, _ := os.Stat(filepath.Join(tmpDir, "config.yaml"))
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+			t.Errorf("expected permissions to be kept, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("stale etag", func(t *testing.T) {
+		stale := read(t)
+		update(t, "config.yaml", `{"content":"a: 3\n"}`, PatchStoragesStorageNodesPathParams{})
+		w := update(t, "config.yaml", `{"content":"a: 4\n"}`, PatchStoragesStorageNodesPathParams{IfMatch: &stale})
+		if w.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected 412, got %d", w.Code)
+		}
+		if content() != "a: 3\n" {
+			t.Errorf("expected the other change to be kept, got %q", content())
+		}
+		if w.Header().Get("ETag") != read(t) {
+			t.Errorf("expected current ETag with 412, got %q", w.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("if unmodified since", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+		if w := update(t, "config.yaml", `{"content":"x"}`, PatchStoragesStorageNodesPathParams{IfUnmodifiedSince: &past}); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected 412, got %d", w.Code)
+		}
+		future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		if w := update(t, "config.yaml", `{"content":"a: 5\n"}`, PatchStoragesStorageNodesPathParams{IfUnmodifiedSince: &future}); w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d", w.Code)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		nodePath string
+		body     string
+		ifMatch  string
+		status   int
+	}{
+		{"any existing", "config.yaml", `{"content":"a: 6\n"}`, "*", http.StatusOK},
+		{"missing", "missing.yaml", `{"content":"x"}`, "*", http.StatusNotFound},
+		{"weak etag", "config.yaml", `{"content":"x"}`, `W/"abc"`, http.StatusPreconditionFailed},
+		{"directory content", "docs", `{"content":"x"}`, "", http.StatusBadRequest},
+		{"nothing to update", "config.yaml", `{}`, "", http.StatusBadRequest},
+		{"rename not supported", "config.yaml", `{"name":"other.yaml"}`, "", http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params PatchStoragesStorageNodesPathParams
+			if tt.ifMatch != "" {
+				params.IfMatch = &tt.ifMatch
+			}
+			if w := update(t, tt.nodePath, tt.body, params); w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// eicarScanner finds the EICAR test signature, or fails if unavailable
+type eicarScanner struct {
+	unavailable bool
+}
+
+func (s *eicarScanner) Scan(ctx context.Context, r io.Reader) error {
+	if s.unavailable {
+		return errors.New("connection refused")
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(content), "EICAR") {
+		return &scan.InfectedError{Signature: "Eicar-Test-Signature"}
+	}
+	return nil
+}
+
+func TestVirusScanning(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("clean"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	scanner := &eicarScanner{}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Scanner: scanner})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	upload := func(t *testing.T, name, content string) int {
+		t.Helper()
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageNodes(w, req, "local")
+		return w.Code
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(tmpDir, name))
+		return err == nil
+	}
+
+	t.Run("clean upload", func(t *testing.T) {
+		if code := upload(t, "clean.txt", "hello"); code != http.StatusCreated {
+			t.Errorf("expected 201, got %d", code)
+		}
+		if !exists("clean.txt") {
+			t.Error("expected clean file to be stored")
+		}
+	})
+
+	t.Run("infected upload", func(t *testing.T) {
+		if code := upload(t, "virus.com", "X5O!P%@AP EICAR-STANDARD-ANTIVIRUS-TEST-FILE"); code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", code)
+		}
+		if exists("virus.com") {
+			t.Error("expected infected file not to be stored")
+		}
+		entries, _ := os.ReadDir(tmpDir)
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".timeship-") {
+				t.Errorf("expected no temporary files left, found %s", entry.Name())
+			}
+		}
+	})
+
+	t.Run("infected save", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPatch, "/storages/local/nodes/notes.txt", strings.NewReader(`{"content":"EICAR"}`))
+		w := httptest.NewRecorder()
+		server.PatchStoragesStorageNodesPath(w, req, "local", "notes.txt", PatchStoragesStorageNodesPathParams{})
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", w.Code)
+		}
+		if data, _ := os.ReadFile(filepath.Join(tmpDir, "notes.txt")); string(data) != "clean" {
+			t.Errorf("expected content to be kept, got %q", data)
+		}
+	})
+
+	t.Run("scanner unavailable", func(t *testing.T) {
+		scanner.unavailable = true
+		defer func() { scanner.unavailable = false }()
+		if code := upload(t, "unscanned.txt", "hello"); code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", code)
+		}
+		if exists("unscanned.txt") {
+			t.Error("expected unscanned file not to be stored")
+		}
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "old.txt"), []byte("old"), 0644)
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "gone.txt"), []byte("gone"), 0644)
+
+	var mu sync.Mutex
+	var events []webhook.Event
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	notifier := webhook.New([]webhook.Hook{{URL: receiver.URL}})
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Notifier: notifier})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	var body strings.Builder
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "new.txt")
+	part.Write([]byte("new"))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	server.PostStoragesStorageNodes(httptest.NewRecorder(), req, "local")
+
+	req = httptest.NewRequest(http.MethodDelete, "/storages/local/nodes/old.txt", nil)
+	server.DeleteStoragesStorageNodesPath(httptest.NewRecorder(), req, "local", "old.txt", DeleteStoragesStorageNodesPathParams{})
+
+	req = httptest.NewRequest(http.MethodPost, "/storages/local/copies", strings.NewReader(`{"destination":"","items":[{"path":"gone.txt","snapshot":"zfs:daily"}]}`))
+	server.PostStoragesStorageCopies(httptest.NewRecorder(), req, "local")
+
+	// Failed operations send nothing
+	req = httptest.NewRequest(http.MethodDelete, "/storages/local/nodes/missing.txt", nil)
+	server.DeleteStoragesStorageNodesPath(httptest.NewRecorder(), req, "local", "missing.txt", DeleteStoragesStorageNodesPathParams{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	want := []webhook.Event{
+		{Type: webhook.UploadCompleted, Storage: "local", Path: "new.txt"},
+		{Type: webhook.NodeDeleted, Storage: "local", Path: "old.txt"},
+		{Type: webhook.NodeRestored, Storage: "local", Path: "gone.txt", Snapshot: "zfs:daily", Destination: "gone.txt"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i := range want {
+		events[i].Time = time.Time{}
+		if events[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], events[i])
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test hooks need a shell")
+	}
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "old.txt"), []byte("old"), 0644)
+	hookDir := t.TempDir()
+	logPath := filepath.Join(hookDir, "log")
+	script := filepath.Join(hookDir, "hook.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> \""+logPath+"\"\ncase \"$2\" in *blocked*) echo 'no space left'; exit 1;; esac\n"), 0755)
+
+	parse := func(command string) *hook.Command {
+		c, err := hook.ParseCommand(command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	runner := hook.New([]hook.Hook{
+		{Operation: hook.Write, Command: parse(script + " before-write {{.Path}}")},
+		{Operation: hook.Delete, After: true, Command: parse(script + " after-delete {{.Path}}")},
+	})
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Hooks: runner})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	upload := func(name string) *httptest.ResponseRecorder {
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", name)
+		part.Write([]byte("content"))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		server.PostStoragesStorageNodes(w, req, "local")
+		return w
+	}
+
+	if w := upload("new.txt"); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := upload("blocked.txt")
+	if w.Code != http.StatusFailedDependency || !strings.Contains(w.Body.String(), "no space left") {
+		t.Errorf("expected 424 with the hook output, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "blocked.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected blocked upload not to be written, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/storages/local/nodes/old.txt", nil)
+	server.DeleteStoragesStorageNodesPath(httptest.NewRecorder(), req, "local", "old.txt", DeleteStoragesStorageNodesPathParams{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := runner.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	got, _ := os.ReadFile(logPath)
+	if want := "before-write new.txt\nbefore-write blocked.txt\nafter-delete old.txt\n"; string(got) != want {
+		t.Errorf("expected hook log %q, got %q", want, got)
+	}
+}
+
+// patternRecorder records the patterns routes are registered under
+type patternRecorder struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (m *patternRecorder) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.HandleFunc(pattern, handler)
+}
+
+func TestAccessControl(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"root.txt", "public/a.txt", "private/b.txt", "uploads/other/c.txt"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	os.MkdirAll(filepath.Join(tmpDir, "uploads", "inbox"), 0755)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	other, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	rule := func(path string, permissions ...string) access.Rule {
+		r, err := access.ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	policy, err := access.New([]access.User{
+		{Name: "admin", Token: "admin-token", Rules: []access.Rule{rule("*://**", access.Read, access.Write)}},
+		{Name: "guest", Token: "guest-token", Rules: []access.Rule{
+			rule("local://public/**", access.Read),
+			rule("local://uploads/inbox/**", access.Write),
+		}},
+		{Name: "editor", Token: "editor-token", Rules: []access.Rule{rule("local://public/a.txt", access.Read, access.Write)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": &renamingStorage{Storage: store, root: tmpDir}, "other": other}, "local", Config{Access: policy})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	mux := &patternRecorder{ServeMux: http.NewServeMux()}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{
+		BaseRouter:  mux,
+		Middlewares: []MiddlewareFunc{server.Authorize},
+	})
+
+	t.Run("all routes have rules", func(t *testing.T) {
+		for _, pattern := range mux.patterns {
+			if _, ok := routes[pattern]; !ok {
+				t.Errorf("no access rules for %q", pattern)
+			}
+		}
+	})
+
+	t.Run("methods of all routes", func(t *testing.T) {
+		want := []string{http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodPatch, http.MethodPost}
+		if got := Methods(); !slices.Equal(got, want) {
+			t.Errorf("expected methods %v, got %v", want, got)
+		}
+	})
+
+	do := func(method, target, token string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	listing := func(w *httptest.ResponseRecorder) []string {
+		var list NodeList
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("failed to decode listing: %v", err)
+		}
+		names := []string{}
+		for _, file := range list.Files {
+			names = append(names, file.Basename)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+	}{
+		{"public route", http.MethodGet, "/healthz", "", http.StatusOK},
+		{"no token", http.MethodGet, "/storages", "", http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/storages/local/nodes", "nope", http.StatusUnauthorized},
+		{"granted file", http.MethodGet, "/storages/local/nodes/public/a.txt", "guest-token", http.StatusOK},
+		{"token in query", http.MethodGet, "/storages/local/nodes/public/a.txt?access_token=guest-token", "", http.StatusOK},
+		{"other file", http.MethodGet, "/storages/local/nodes/private/b.txt", "guest-token", http.StatusForbidden},
+		{"escaping prefix", http.MethodGet, "/storages/local/nodes/public/..%2Fprivate/b.txt", "guest-token", http.StatusForbidden},
+		{"other storage", http.MethodGet, "/storages/other/nodes", "guest-token", http.StatusForbidden},
+		{"delete without write", http.MethodDelete, "/storages/local/nodes/public/a.txt", "guest-token", http.StatusForbidden},
+		{"archive of leading directory", http.MethodGet, "/storages/local/nodes?format=zip", "guest-token", http.StatusForbidden},
+		{"snapshot without whole storage", http.MethodPost, "/storages/local/snapshots", "guest-token", http.StatusForbidden},
+		{"admin", http.MethodGet, "/storages/local/nodes/private/b.txt", "admin-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.target, tt.token, nil)
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+		})
+	}
+
+	t.Run("storages are hidden", func(t *testing.T) {
+		w := do(http.MethodGet, "/storages", "guest-token", nil)
+		if got := strings.TrimSpace(w.Body.String()); got != `{"storages":["local"]}` {
+			t.Errorf("expected only local, got %s", got)
+		}
+	})
+
+	t.Run("readiness of hidden storages", func(t *testing.T) {
+		tests := []struct {
+			token string
+			want  []string
+		}{
+			{"", []string{}},
+			{"nope", []string{}},
+			{"guest-token", []string{"local"}},
+			{"admin-token", []string{"local", "other"}},
+		}
+		for _, tt := range tests {
+			w := do(http.MethodGet, "/readyz", tt.token, nil)
+			var report ReadinessReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			names := []string{}
+			for _, s := range report.Storages {
+				names = append(names, s.Name)
+			}
+			if w.Code != http.StatusOK || report.Status != ReadinessReportStatusOk || !slices.Equal(names, tt.want) {
+				t.Errorf("token %q: expected ok with %v, got %d %q with %v", tt.token, tt.want, w.Code, report.Status, names)
+			}
+		}
+	})
+
+	t.Run("listings hide entries", func(t *testing.T) {
+		if got := listing(do(http.MethodGet, "/storages/local/nodes", "guest-token", nil)); !slices.Equal(got, []string{"public", "uploads"}) {
+			t.Errorf("expected entries leading to granted paths, got %v", got)
+		}
+		if got := listing(do(http.MethodGet, "/storages/local/nodes/uploads", "guest-token", nil)); len(got) != 0 {
+			t.Errorf("expected write-only inbox to stay hidden, got %v", got)
+		}
+		if got := listing(do(http.MethodGet, "/storages/local/nodes", "admin-token", nil)); len(got) != 4 {
+			t.Errorf("expected all entries for admin, got %v", got)
+		}
+	})
+
+	t.Run("write-only upload", func(t *testing.T) {
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "new.txt")
+		part.Write([]byte("new"))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes/uploads/inbox", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer guest-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Errorf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("copies check each item", func(t *testing.T) {
+		w := do(http.MethodPost, "/storages/local/copies", "guest-token", strings.NewReader(`{"destination":"uploads/inbox","items":[{"path":"public/a.txt"},{"path":"private/b.txt"}]}`))
+		var result CopyResult
+		json.NewDecoder(w.Body).Decode(&result)
+		if w.Code != http.StatusMultiStatus || result.Copied != 1 || result.Results[1].Status != Error {
+			t.Errorf("expected only the public file to be copied, got %d %+v", w.Code, result)
+		}
+	})
+
+	t.Run("forbidden rename keeps content", func(t *testing.T) {
+		w := do(http.MethodPatch, "/storages/local/nodes/public/a.txt", "editor-token", strings.NewReader(`{"content":"changed","name":"renamed.txt"}`))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+		if data, _ := os.ReadFile(filepath.Join(tmpDir, "public", "a.txt")); string(data) != "public/a.txt" {
+			t.Errorf("expected content to be kept, got %q", data)
+		}
+	})
+
+	t.Run("downloads check each item", func(t *testing.T) {
+		w := do(http.MethodPost, "/storages/local/downloads", "guest-token", strings.NewReader(`{"items":[{"path":"public"},{"path":"private"}]}`))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("lockout", func(t *testing.T) {
+		var w *httptest.ResponseRecorder
+		for _, token := range []string{"a", "b", "c", "d", "e", "guest-token"} {
+			req := httptest.NewRequest(http.MethodGet, "/storages", nil)
+			req.RemoteAddr = "203.0.113.7:4321"
+			req.Header.Set("Authorization", "Bearer "+token)
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+		}
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Errorf("expected 429 with Retry-After, got %d %q: %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+		}
+		if w := do(http.MethodGet, "/storages", "guest-token", nil); w.Code != http.StatusOK {
+			t.Errorf("expected other sources to pass, got %d", w.Code)
+		}
+
+		w = do(http.MethodGet, "/metrics", "", nil)
+		for _, want := range []string{
+			"# TYPE timeship_auth_rejected_total counter\n",
+			"timeship_auth_rejected_total{reason=\"locked_out\"} 1\n",
+		} {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("expected %q in metrics:\n%s", want, w.Body.String())
+			}
+		}
+	})
+}
+
+func TestHomes(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"secret.txt", "homes/alice/a.txt", "homes/bob/b.txt"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	policy, err := access.New([]access.User{
+		{Name: "alice", Token: "alice-token", HomeStorage: "local", HomePath: "homes/alice"},
+		{Name: "bob", Token: "bob-token", HomeStorage: "local", HomePath: "homes/bob"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}})
+
+	do := func(method, target, token string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("listing shows the home", func(t *testing.T) {
+		w := do(http.MethodGet, "/storages/local/nodes", "alice-token", nil)
+		var list NodeList
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("failed to decode listing: %v", err)
+		}
+		if len(list.Files) != 1 || list.Files[0].Basename != "a.txt" || list.Files[0].Path != "a.txt" {
+			t.Errorf("expected home with paths relative to it, got %+v", list.Files)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/b.txt", nil)
+		req.Header.Set("Authorization", "Bearer bob-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != "homes/bob/b.txt" {
+			t.Errorf("expected bob's file, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("other homes are out of reach", func(t *testing.T) {
+		for _, target := range []string{"/storages/local/nodes/b.txt", "/storages/local/nodes/..%2Fbob/b.txt", "/storages/local/nodes/..%2F..%2Fsecret.txt"} {
+			if w := do(http.MethodGet, target, "alice-token", nil); w.Code != http.StatusNotFound {
+				t.Errorf("%s: expected 404, got %d: %s", target, w.Code, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("upload lands in the home", func(t *testing.T) {
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "new.txt")
+		part.Write([]byte("new"))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/nodes", strings.NewReader(body.String()))
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "homes", "alice", "new.txt")); err != nil {
+			t.Errorf("expected upload in home, got %v", err)
+		}
+	})
+
+	t.Run("index is forbidden", func(t *testing.T) {
+		if w := do(http.MethodPost, "/storages/local/index", "alice-token", nil); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestTokens(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"photos/a.jpg", "private/b.txt"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	tokenStore, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tokenStore.Close()
+	rule := func(path string, permissions ...string) access.Rule {
+		r, err := access.ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	policy, err := access.NewWithConfig([]access.User{
+		{Name: "alice", Token: "alice-token", Rules: []access.Rule{rule("local://photos/**", access.Read, access.Write)}},
+		{Name: "bob", Token: "bob-token", Rules: []access.Rule{rule("local://**", access.Read)}},
+	}, access.Config{Issuer: tokenStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy, Tokens: tokenStore})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}})
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/tokens", "alice-token", `{"name":"gallery","rules":[{"path":"local://photos/**","allow":["read"]}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created CreatedToken
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Token == "" || created.Id == "" || created.Name != "gallery" || created.ExpiresAt != nil {
+		t.Fatalf("unexpected token %+v", created)
+	}
+
+	t.Run("token grants its rules", func(t *testing.T) {
+		if w := do(http.MethodGet, "/storages/local/nodes/photos/a.jpg", created.Token, ""); w.Code != http.StatusOK {
+			t.Errorf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := do(http.MethodDelete, "/storages/local/nodes/photos/a.jpg", created.Token, ""); w.Code != http.StatusForbidden {
+			t.Errorf("expected read-only token, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := do(http.MethodGet, "/storages/local/nodes/private/b.txt", created.Token, ""); w.Code != http.StatusForbidden {
+			t.Errorf("expected 403, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		var list TokenList
+		json.NewDecoder(do(http.MethodGet, "/tokens", "alice-token", "").Body).Decode(&list)
+		if len(list.Tokens) != 1 || list.Tokens[0].Id != created.Id || list.Tokens[0].Rules[0].Path != "local://photos/**" {
+			t.Errorf("expected alice's token, got %+v", list.Tokens)
+		}
+		json.NewDecoder(do(http.MethodGet, "/tokens", "bob-token", "").Body).Decode(&list)
+		if len(list.Tokens) != 0 {
+			t.Errorf("expected no tokens of bob, got %+v", list.Tokens)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		body   string
+		status int
+	}{
+		{"more than the user may", http.MethodPost, "/tokens", "alice-token", `{"name":"x","rules":[{"path":"local://**","allow":["read"]}]}`, http.StatusForbidden},
+		{"write the user lacks", http.MethodPost, "/tokens", "bob-token", `{"name":"x","rules":[{"path":"local://**","allow":["write"]}]}`, http.StatusForbidden},
+		{"no rules", http.MethodPost, "/tokens", "alice-token", `{"name":"x","rules":[]}`, http.StatusBadRequest},
+		{"invalid rule", http.MethodPost, "/tokens", "alice-token", `{"name":"x","rules":[{"path":"photos","allow":["read"]}]}`, http.StatusBadRequest},
+		{"expired", http.MethodPost, "/tokens", "alice-token", `{"name":"x","expires_at":1,"rules":[{"path":"local://photos/**","allow":["read"]}]}`, http.StatusBadRequest},
+		{"tokens can't issue tokens", http.MethodPost, "/tokens", created.Token, `{"name":"x","rules":[{"path":"local://photos/**","allow":["read"]}]}`, http.StatusForbidden},
+		{"other user's token", http.MethodDelete, "/tokens/" + created.Id, "bob-token", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.target, tt.token, tt.body); w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("revoke", func(t *testing.T) {
+		if w := do(http.MethodDelete, "/tokens/"+created.Id, "alice-token", ""); w.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := do(http.MethodGet, "/storages/local/nodes/photos/a.jpg", created.Token, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected revoked token to fail, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+// renamingStorage renames nodes of a local storage
+type renamingStorage struct {
+	*local.Storage
+	root string
+}
+
+func (s *renamingStorage) Move(from, to url.URL) error {
+	return os.Rename(filepath.Join(s.root, filepath.FromSlash(from.Path)), filepath.Join(s.root, filepath.FromSlash(to.Path)))
+}
+
+func TestTags(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"docs/taxes.pdf", "docs/notes.txt", "homes/alice/a.txt"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	localStore, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	store := &renamingStorage{Storage: localStore, root: tmpDir}
+	tagStore, err := tags.Open(filepath.Join(t.TempDir(), "tags.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tagStore.Close()
+	rule, err := access.ParseRule("local://**", []string{access.Read, access.Write})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := access.New([]access.User{
+		{Name: "bob", Token: "bob-token", Rules: []access.Rule{rule}},
+		{Name: "alice", Token: "alice-token", HomeStorage: "local", HomePath: "homes/alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy, Tags: tagStore})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}})
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	tagged := func(token, tag string) []TaggedNode {
+		t.Helper()
+		w := do(http.MethodGet, "/tags/"+tag, token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var list TaggedNodeList
+		json.NewDecoder(w.Body).Decode(&list)
+		return list.Nodes
+	}
+
+	for _, target := range []string{"/storages/local/tags/docs/taxes.pdf", "/storages/local/tags/docs"} {
+		if w := do(http.MethodPost, target, "bob-token", `{"tag":"2024"}`); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	w := do(http.MethodPost, "/storages/local/tags/docs/taxes.pdf", "bob-token", `{"tag":"taxes"}`)
+	var nodeTags NodeTags
+	json.NewDecoder(w.Body).Decode(&nodeTags)
+	if w.Code != http.StatusOK || !slices.Equal(nodeTags.Tags, []string{"2024", "taxes"}) {
+		t.Fatalf("expected both tags, got %d: %+v", w.Code, nodeTags)
+	}
+
+	t.Run("list tags", func(t *testing.T) {
+		var list TagList
+		json.NewDecoder(do(http.MethodGet, "/tags", "bob-token", "").Body).Decode(&list)
+		if len(list.Tags) != 2 || list.Tags[0] != (TagSummary{Tag: "2024", Count: 2}) || list.Tags[1] != (TagSummary{Tag: "taxes", Count: 1}) {
+			t.Errorf("unexpected tags %+v", list.Tags)
+		}
+	})
+
+	t.Run("list by tag", func(t *testing.T) {
+		nodes := tagged("bob-token", "2024")
+		if len(nodes) != 2 || nodes[0].Path != "docs" || *nodes[0].Type != Dir || nodes[1].Path != "docs/taxes.pdf" || *nodes[1].Type != File {
+			t.Errorf("unexpected nodes %+v", nodes)
+		}
+	})
+
+	t.Run("tags are per user", func(t *testing.T) {
+		if nodes := tagged("alice-token", "2024"); len(nodes) != 0 {
+			t.Errorf("expected no nodes of alice, got %+v", nodes)
+		}
+	})
+
+	t.Run("rename through the API", func(t *testing.T) {
+		if w := do(http.MethodPatch, "/storages/local/nodes/docs", "bob-token", `{"name":"papers"}`); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		nodes := tagged("bob-token", "taxes")
+		if len(nodes) != 1 || nodes[0].Path != "papers/taxes.pdf" || nodes[0].Missing {
+			t.Errorf("expected tag to follow the rename, got %+v", nodes)
+		}
+	})
+
+	t.Run("rename outside of the API", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("inodes are not available on Windows")
+		}
+		if err := os.Rename(filepath.Join(tmpDir, "papers", "taxes.pdf"), filepath.Join(tmpDir, "papers", "taxes-2024.pdf")); err != nil {
+			t.Fatal(err)
+		}
+		nodes := tagged("bob-token", "taxes")
+		if len(nodes) != 1 || nodes[0].Path != "papers/taxes-2024.pdf" || nodes[0].Missing {
+			t.Errorf("expected tag to follow the rename, got %+v", nodes)
+		}
+	})
+
+	t.Run("deleted nodes are missing", func(t *testing.T) {
+		os.WriteFile(filepath.Join(tmpDir, "papers", "gone.txt"), nil, 0644)
+		do(http.MethodPost, "/storages/local/tags/papers/gone.txt", "bob-token", `{"tag":"gone"}`)
+		os.Remove(filepath.Join(tmpDir, "papers", "gone.txt"))
+		nodes := tagged("bob-token", "gone")
+		if len(nodes) != 1 || !nodes[0].Missing || nodes[0].Type != nil {
+			t.Errorf("expected missing node, got %+v", nodes)
+		}
+		if w := do(http.MethodDelete, "/storages/local/tags/papers/gone.txt?tag=gone", "bob-token", ""); w.Code != http.StatusOK {
+			t.Errorf("expected missing node to be untagged, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("bookmarks", func(t *testing.T) {
+		w := do(http.MethodPost, "/bookmarks", "alice-token", `{"storage":"local","path":"a.txt"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var created Bookmark
+		json.NewDecoder(w.Body).Decode(&created)
+		if created.Id == "" || created.Name != "a.txt" || created.Path != "a.txt" {
+			t.Errorf("unexpected bookmark %+v", created)
+		}
+
+		// Renames move bookmarks of all users, which see them in their home
+		if w := do(http.MethodPatch, "/storages/local/nodes/homes/alice/a.txt", "bob-token", `{"name":"b.txt"}`); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var list BookmarkList
+		json.NewDecoder(do(http.MethodGet, "/bookmarks", "alice-token", "").Body).Decode(&list)
+		if len(list.Bookmarks) != 1 || list.Bookmarks[0].Path != "b.txt" || list.Bookmarks[0].Missing {
+			t.Errorf("expected renamed bookmark in the home, got %+v", list.Bookmarks)
+		}
+		json.NewDecoder(do(http.MethodGet, "/bookmarks", "bob-token", "").Body).Decode(&list)
+		if len(list.Bookmarks) != 0 {
+			t.Errorf("expected no bookmarks of bob, got %+v", list.Bookmarks)
+		}
+
+		if w := do(http.MethodDelete, "/bookmarks/"+created.Id, "bob-token", ""); w.Code != http.StatusNotFound {
+			t.Errorf("expected other user's bookmark not to be found, got %d", w.Code)
+		}
+		if w := do(http.MethodDelete, "/bookmarks/"+created.Id, "alice-token", ""); w.Code != http.StatusNoContent {
+			t.Errorf("expected 204, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		body   string
+		status int
+	}{
+		{"invalid tag", http.MethodPost, "/storages/local/tags/papers", "bob-token", `{"tag":"a/b"}`, http.StatusBadRequest},
+		{"missing node", http.MethodPost, "/storages/local/tags/nothing.txt", "bob-token", `{"tag":"x"}`, http.StatusNotFound},
+		{"untag missing tag", http.MethodDelete, "/storages/local/tags/papers?tag=x", "bob-token", "", http.StatusNotFound},
+		{"bookmark outside the home", http.MethodPost, "/bookmarks", "alice-token", `{"storage":"local","path":"../../papers"}`, http.StatusNotFound},
+		{"bookmark missing node", http.MethodPost, "/bookmarks", "bob-token", `{"storage":"local","path":"nothing"}`, http.StatusNotFound},
+		{"bookmark without storage", http.MethodPost, "/bookmarks", "bob-token", `{"path":"papers"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.target, tt.token, tt.body); w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		HandlerWithOptions(server, StdHTTPServerOptions{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags", nil))
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("expected 501, got %d", w.Code)
+		}
+	})
+}
+
+func TestActivity(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"docs/taxes.pdf", "docs/notes.txt", "homes/alice/a.txt"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	localStore, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	store := &renamingStorage{Storage: localStore, root: tmpDir}
+	activityStore, err := activity.Open(filepath.Join(t.TempDir(), "activity.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer activityStore.Close()
+	tokenStore, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tokenStore.Close()
+	rule, err := access.ParseRule("local://**", []string{access.Read, access.Write})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := access.NewWithConfig([]access.User{
+		{Name: "bob", Token: "bob-token", Rules: []access.Rule{rule}},
+		{Name: "alice", Token: "alice-token", HomeStorage: "local", HomePath: "homes/alice"},
+	}, access.Config{Issuer: tokenStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy, Activity: activityStore, Tokens: tokenStore})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}})
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	feed := func(target, token string) ActivityFeed {
+		t.Helper()
+		w := do(http.MethodGet, target, token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var feed ActivityFeed
+		json.NewDecoder(w.Body).Decode(&feed)
+		return feed
+	}
+
+	if w := do(http.MethodPost, "/storages/local/activity/docs/taxes.pdf", "bob-token", `{"text":"Checked the totals"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/storages/local/nodes/docs/notes.txt", "bob-token", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, "/storages/local/nodes/docs", "bob-token", `{"name":"papers"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Run("feed", func(t *testing.T) {
+		events := feed("/storages/local/activity/papers", "bob-token").Events
+		if len(events) != 3 {
+			t.Fatalf("expected 3 events, got %+v", events)
+		}
+		renamed, deleted, commented := events[0], events[1], events[2]
+		if renamed.Type != Renamed || renamed.Path != "papers" || renamed.From == nil || *renamed.From != "docs" {
+			t.Errorf("unexpected rename %+v", renamed)
+		}
+		if deleted.Type != Deleted || deleted.Path != "papers/notes.txt" || deleted.Actor == nil || *deleted.Actor != "bob" {
+			t.Errorf("expected delete to move with the rename, got %+v", deleted)
+		}
+		if commented.Type != Commented || commented.Path != "papers/taxes.pdf" || commented.Text == nil || *commented.Text != "Checked the totals" {
+			t.Errorf("unexpected comment %+v", commented)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		first := feed("/storages/local/activity/papers?limit=2", "bob-token")
+		if len(first.Events) != 2 || first.Before == nil {
+			t.Fatalf("expected a first page, got %+v", first)
+		}
+		rest := feed(fmt.Sprintf("/storages/local/activity/papers?limit=2&before=%d", *first.Before), "bob-token")
+		if len(rest.Events) != 1 || rest.Before != nil || rest.Events[0].Type != Commented {
+			t.Errorf("expected the last page, got %+v", rest)
+		}
+	})
+
+	t.Run("home", func(t *testing.T) {
+		if w := do(http.MethodPatch, "/storages/local/nodes/a.txt", "alice-token", `{"name":"b.txt"}`); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		// Users with a home see paths in their home, others the full path
+		if events := feed("/storages/local/activity", "alice-token").Events; len(events) != 1 || events[0].Path != "b.txt" || *events[0].From != "a.txt" {
+			t.Errorf("unexpected events of alice %+v", events)
+		}
+		if events := feed("/storages/local/activity/homes", "bob-token").Events; len(events) != 1 || events[0].Path != "homes/alice/b.txt" {
+			t.Errorf("unexpected events of bob %+v", events)
+		}
+	})
+
+	t.Run("share from home", func(t *testing.T) {
+		if w := do(http.MethodPost, "/tokens", "alice-token", `{"name":"link","rules":[{"path":"local://b.txt","allow":["read"]}]}`); w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		// Rules of users with a home are within it
+		events := feed("/storages/local/activity/homes/alice/b.txt", "bob-token").Events
+		if len(events) != 2 || events[0].Type != Shared || events[0].Text == nil || *events[0].Text != "link" {
+			t.Errorf("expected the share in the home, got %+v", events)
+		}
+		if events := feed("/storages/local/activity/b.txt", "alice-token").Events; len(events) != 2 || events[0].Path != "b.txt" {
+			t.Errorf("unexpected events of alice %+v", events)
+		}
+	})
+
+	t.Run("delete comment", func(t *testing.T) {
+		comment := feed("/storages/local/activity/papers/taxes.pdf", "bob-token").Events[0]
+		if w := do(http.MethodDelete, fmt.Sprintf("/comments/%d", comment.Id), "alice-token", ""); w.Code != http.StatusNotFound {
+			t.Errorf("expected other user's comment not to be found, got %d", w.Code)
+		}
+		if w := do(http.MethodDelete, fmt.Sprintf("/comments/%d", comment.Id), "bob-token", ""); w.Code != http.StatusNoContent {
+			t.Errorf("expected 204, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"empty comment", http.MethodPost, "/storages/local/activity/papers", `{"text":" "}`, http.StatusBadRequest},
+		{"comment on missing node", http.MethodPost, "/storages/local/activity/nothing.txt", `{"text":"x"}`, http.StatusNotFound},
+		{"invalid limit", http.MethodGet, "/storages/local/activity/papers?limit=0", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.target, "bob-token", tt.body); w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		HandlerWithOptions(server, StdHTTPServerOptions{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/storages/local/activity/papers", nil))
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("expected 501, got %d", w.Code)
+		}
+	})
+}
+
+func TestRecent(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"docs/taxes.pdf", "homes/alice/a.txt"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644)
+	}
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	rule, err := access.ParseRule("local://docs/**", []string{access.Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := access.New([]access.User{
+		{Name: "bob", Token: "bob-token", Rules: []access.Rule{rule}},
+		{Name: "alice", Token: "alice-token", HomeStorage: "local", HomePath: "homes/alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy, Recent: recent.New(10)})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}})
+
+	do := func(method, target, token, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	entries := func(target, token string) []string {
+		t.Helper()
+		w := do(http.MethodGet, target, token, "application/json")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var list RecentList
+		json.NewDecoder(w.Body).Decode(&list)
+		var entries []string
+		for _, e := range list.Entries {
+			entries = append(entries, string(e.Kind)+" "+e.Path)
+		}
+		return entries
+	}
+
+	do(http.MethodGet, "/storages/local/nodes/docs", "bob-token", "application/json")
+	do(http.MethodGet, "/storages/local/nodes/docs/taxes.pdf", "bob-token", "application/octet-stream")
+	do(http.MethodGet, "/storages/local/nodes/docs/taxes.pdf?lines=1-2", "bob-token", "text/plain")
+	do(http.MethodGet, "/storages/local/nodes/docs?search=taxes", "bob-token", "application/json")
+	do(http.MethodGet, "/storages/local/nodes", "alice-token", "application/json")
+
+	t.Run("list", func(t *testing.T) {
+		// Previews and searches don't count
+		want := []string{"downloaded docs/taxes.pdf", "browsed docs"}
+		if got := entries("/recent", "bob-token"); !slices.Equal(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		if got := entries("/recent?kind=browsed", "bob-token"); !slices.Equal(got, []string{"browsed docs"}) {
+			t.Errorf("expected browsed paths only, got %v", got)
+		}
+		if got := entries("/recent", "alice-token"); !slices.Equal(got, []string{"browsed "}) {
+			t.Errorf("expected alice's home, got %v", got)
+		}
+	})
+
+	t.Run("forget", func(t *testing.T) {
+		if w := do(http.MethodDelete, "/recent", "bob-token", ""); w.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := entries("/recent", "bob-token"); len(got) != 0 {
+			t.Errorf("expected no paths, got %v", got)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		HandlerWithOptions(server, StdHTTPServerOptions{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/recent", nil))
+		if w.Code != http.StatusNotImplemented {
+			t.Errorf("expected 501, got %d", w.Code)
+		}
+	})
+}
+
+// closeRecorder records whether a local storage was closed
+type closeRecorder struct {
+	*local.Storage
+	closed atomic.Bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+	return c.Storage.Close()
+}
+
+func TestReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("current"), 0644)
+	daily := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-09")
+	os.MkdirAll(daily, 0755)
+	os.WriteFile(filepath.Join(daily, "file.txt"), []byte("old"), 0644)
+
+	open := func() *closeRecorder {
+		store, err := local.New(tmpDir)
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		return &closeRecorder{Storage: store}
+	}
+	rule := func(path string, permissions ...string) access.Rule {
+		r, err := access.ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	admin := access.User{Name: "admin", Token: "admin-token", Rules: []access.Rule{rule("*://**", access.Read, access.Write)}}
+	guest := access.User{Name: "guest", Token: "guest-token", Rules: []access.Rule{rule("local://**", access.Read, access.Write)}}
+	policy, err := access.New([]access.User{admin, guest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := open()
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": old}, "local", Config{Access: policy})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize, server.Track}})
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/pins", "admin-token", `{"storage":"local","snapshot":"zfs:daily-2025-11-09"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected pin, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Run("endpoint", func(t *testing.T) {
+		if w := do(http.MethodPost, "/admin/reload", "guest-token", ""); w.Code != http.StatusForbidden {
+			t.Errorf("expected admins only, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := do(http.MethodPost, "/admin/reload", "admin-token", ""); w.Code != http.StatusNotImplemented {
+			t.Errorf("expected 501 without reload, got %d: %s", w.Code, w.Body.String())
+		}
+		server.config.Reload = func() error { return errors.New("invalid config") }
+		defer func() { server.config.Reload = nil }()
+		if w := do(http.MethodPost, "/admin/reload", "admin-token", ""); w.Code != http.StatusInternalServerError {
+			t.Errorf("expected failed reload, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	// Keep a request in flight while reloading
+	started, release, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		server.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/storages/local/nodes/file.txt", nil))
+	}()
+	<-started
+
+	policy, err = access.New([]access.User{admin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := open()
+	defer other.Close()
+	if err := server.Reload(map[string]storage.Storage{"other": other}, "local", policy); err == nil {
+		t.Error("expected missing default storage to fail")
+	}
+	current := open()
+	if err := server.Reload(map[string]storage.Storage{"local": current}, "local", policy); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	t.Run("in-flight requests keep replaced storages", func(t *testing.T) {
+		time.Sleep(10 * time.Millisecond)
+		if old.closed.Load() {
+			t.Fatal("expected replaced storage to stay open during requests")
+		}
+		close(release)
+		<-finished
+		server.retired.Wait()
+		if !old.closed.Load() || current.closed.Load() {
+			t.Errorf("expected only the replaced storage to be closed")
+		}
+	})
+
+	t.Run("access policy is replaced", func(t *testing.T) {
+		if w := do(http.MethodGet, "/storages/local/nodes/file.txt", "guest-token", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected removed user to be rejected, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := do(http.MethodGet, "/storages/local/nodes/file.txt", "admin-token", ""); w.Code != http.StatusOK || w.Body.String() != "current" {
+			t.Errorf("expected new storage, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("pins are kept", func(t *testing.T) {
+		w := do(http.MethodGet, "/storages/local.daily-2025-11-09/nodes/file.txt", "admin-token", "")
+		if w.Code != http.StatusOK || w.Body.String() != "old" {
+			t.Errorf("expected pinned content, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestExportJob(t *testing.T) {
+	srcDir := t.TempDir()
+	snapDir := filepath.Join(srcDir, ".zfs", "snapshot", "nightly", "etc")
+	os.MkdirAll(filepath.Join(snapDir, "nginx"), 0755)
+	os.WriteFile(filepath.Join(snapDir, "hosts"), []byte("127.0.0.1 localhost"), 0644)
+	os.WriteFile(filepath.Join(snapDir, "nginx", "nginx.conf"), []byte("http {}"), 0644)
+	os.WriteFile(filepath.Join(snapDir, "nginx", "nginx.conf.bak"), []byte("old"), 0644)
+	os.MkdirAll(filepath.Join(srcDir, "etc"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "etc", "hosts"), []byte("changed"), 0644)
+
+	src, err := local.New(srcDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	dstDir := t.TempDir()
+	dst, err := local.NewWithConfig(dstDir, local.Config{Name: "backup"})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": src, "backup": dst}, "local", Config{})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.config.Jobs.Close()
+	handler := Handler(server)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("export", func(t *testing.T) {
+		w := request(http.MethodPost, "/storages/local/exports", `{"path": "etc", "snapshot": "zfs:nightly", "destination_storage": "backup", "destination": "exports/etc", "exclude": ["*.bak"]}`)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+		}
+		var job Job
+		json.NewDecoder(w.Body).Decode(&job)
+		if got := w.Header().Get("Location"); got != "/jobs/"+job.Id {
+			t.Errorf("unexpected location %q", got)
+		}
+		if job.Type != "export" || job.Params["snapshot"] != "zfs:nightly" || job.Params["destination_storage"] != "backup" {
+			t.Errorf("unexpected job %+v", job)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for job.State == Running && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+			w = request(http.MethodGet, "/jobs/"+job.Id, "")
+			json.NewDecoder(w.Body).Decode(&job)
+		}
+		if job.State != Succeeded || job.Files != 2 || job.Finished == nil {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dstDir, "exports", "etc", "hosts")); string(data) != "127.0.0.1 localhost" {
+			t.Errorf("expected the snapshot content, got %q", data)
+		}
+		if _, err := os.Stat(filepath.Join(dstDir, "exports", "etc", "nginx", "nginx.conf.bak")); !os.IsNotExist(err) {
+			t.Errorf("expected excluded file to be skipped, got %v", err)
+		}
+
+		w = request(http.MethodGet, "/jobs", "")
+		var list JobList
+		json.NewDecoder(w.Body).Decode(&list)
+		if len(list.Jobs) != 1 || list.Jobs[0].Id != job.Id {
+			t.Errorf("unexpected jobs %+v", list.Jobs)
+		}
+		if w := request(http.MethodDelete, "/jobs/"+job.Id, ""); w.Code != http.StatusConflict {
+			t.Errorf("expected 409 canceling a finished job, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if w := request(http.MethodPost, "/storages/local/exports", `{"destination_storage": "missing"}`); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for a missing destination, got %d", w.Code)
+		}
+		if w := request(http.MethodPost, "/storages/local/exports", `{"destination_storage": "backup", "include": ["["]}`); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for an invalid pattern, got %d", w.Code)
+		}
+		if w := request(http.MethodGet, "/jobs/missing", ""); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for a missing job, got %d", w.Code)
+		}
+	})
+}
+
+func TestSchedules(t *testing.T) {
+	srcDir := t.TempDir()
+	for name, content := range map[string]string{"older": "old hosts", "newer": "new hosts"} {
+		os.MkdirAll(filepath.Join(srcDir, ".zfs", "snapshot", name, "etc"), 0755)
+		os.WriteFile(filepath.Join(srcDir, ".zfs", "snapshot", name, "etc", "hosts"), []byte(content), 0644)
+	}
+	now := time.Now()
+	os.Chtimes(filepath.Join(srcDir, ".zfs", "snapshot", "older"), now.Add(-72*time.Hour), now.Add(-72*time.Hour))
+	os.Chtimes(filepath.Join(srcDir, ".zfs", "snapshot", "newer"), now.Add(-time.Hour), now.Add(-time.Hour))
+	os.WriteFile(filepath.Join(srcDir, "old.txt"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(srcDir, "new.txt"), []byte("new"), 0644)
+
+	src, err := local.NewWithConfig(srcDir, local.Config{Trash: true})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	for _, name := range []string{"old.txt", "new.txt"} {
+		if err := src.Delete(url.URL{Scheme: "local", Path: name}); err != nil {
+			t.Fatalf("failed to trash %s: %v", name, err)
+		}
+	}
+	// Age one of the trashed files
+	infos, _ := filepath.Glob(filepath.Join(srcDir, ".timeship-trash", "info", "*.json"))
+	for _, info := range infos {
+		data, _ := os.ReadFile(info)
+		var item map[string]any
+		json.Unmarshal(data, &item)
+		if item["path"] == "old.txt" {
+			item["deleted_at"] = now.Add(-48 * time.Hour).Unix()
+			data, _ = json.Marshal(item)
+			os.WriteFile(info, data, 0600)
+		}
+	}
+
+	dstDir := t.TempDir()
+	dst, err := local.NewWithConfig(dstDir, local.Config{Name: "backup"})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": src, "backup": dst}, "local", Config{
+		Schedules: []ScheduledTask{
+			{Name: "etc", Schedule: "@daily", Action: ActionExport, Storage: "local", Path: "etc", Snapshot: "latest", DestinationStorage: "backup", Destination: "etc"},
+			{Name: "trash", Schedule: "@daily", Action: ActionPruneTrash, Storage: "local", OlderThan: 24 * time.Hour},
+			{Name: "retention", Schedule: "@weekly", Action: ActionRetentionReport, Storage: "local", MaxGap: 25 * time.Hour, DestinationStorage: "backup", Destination: "reports/retention.json"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	handler := Handler(server)
+
+	run := func(t *testing.T, name string) Job {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/schedules/"+name+"/runs", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+		}
+		var job Job
+		json.NewDecoder(w.Body).Decode(&job)
+		finished, err := server.config.Jobs.Wait(job.Id)
+		if err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+		return describeJob(finished)
+	}
+
+	t.Run("export latest snapshot", func(t *testing.T) {
+		job := run(t, "etc")
+		if job.State != Succeeded || job.Files != 1 {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dstDir, "etc", "hosts")); string(data) != "new hosts" {
+			t.Errorf("expected the newest snapshot, got %q", data)
+		}
+	})
+
+	t.Run("prune trash", func(t *testing.T) {
+		job := run(t, "trash")
+		if job.State != Succeeded || job.Files != 1 || job.Message == nil {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		items, _ := src.ListTrash()
+		if len(items) != 1 || items[0].Path.Path != "new.txt" {
+			t.Errorf("expected only the new item to be kept, got %+v", items)
+		}
+	})
+
+	t.Run("retention report", func(t *testing.T) {
+		job := run(t, "retention")
+		if job.State != Succeeded || job.Message == nil || !strings.Contains(*job.Message, "2 snapshots, 1 gaps") {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		var report RetentionReport
+		data, _ := os.ReadFile(filepath.Join(dstDir, "reports", "retention.json"))
+		if err := json.Unmarshal(data, &report); err != nil || report.Total != 2 || len(report.Gaps) != 1 {
+			t.Errorf("unexpected report %s: %v", data, err)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/schedules", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var list ScheduleList
+		json.NewDecoder(w.Body).Decode(&list)
+		if len(list.Schedules) != 3 {
+			t.Fatalf("expected 3 schedules, got %+v", list.Schedules)
+		}
+		etc := list.Schedules[0]
+		if etc.Name != "etc" || etc.Action != "export" || etc.Next == nil || etc.Params["snapshot"] != "latest" {
+			t.Errorf("unexpected schedule %+v", etc)
+		}
+		if etc.Last == nil || etc.Last.State != Succeeded {
+			t.Errorf("expected the last run, got %+v", etc.Last)
+		}
+	})
+
+	t.Run("unknown schedule", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/schedules/missing/runs", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("invalid task", func(t *testing.T) {
+		_, err := NewServerWithConfig(map[string]storage.Storage{"local": src}, "local", Config{
+			Schedules: []ScheduledTask{{Name: "index", Schedule: "@daily", Action: ActionIndex, Storage: "local"}},
+		})
+		if err == nil {
+			t.Error("expected an error without metadata cache")
+		}
+	})
+}
+
+func TestJobFailedNotification(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhook.Event
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	store, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	notifier := webhook.New([]webhook.Hook{{URL: receiver.URL, Events: []string{webhook.JobFailed}}})
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Notifier: notifier})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/storages/local/exports", strings.NewReader(`{"path": "etc", "snapshot": "zfs:missing", "destination_storage": "local", "destination": "out"}`))
+	w := httptest.NewRecorder()
+	Handler(server).ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job Job
+	json.NewDecoder(w.Body).Decode(&job)
+	if finished, _ := server.config.Jobs.Wait(job.Id); finished.State != jobs.Failed {
+		t.Fatalf("expected the job to fail, got %+v", finished)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != webhook.JobFailed || events[0].Job != job.Id || events[0].Storage != "local" || events[0].Error == "" {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestSnapshotFreshness(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhook.Event
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	// snapshot creates a snapshot of a directory taken at the given time
+	snapshot := func(dir, name string, taken time.Time) {
+		t.Helper()
+		snapDir := filepath.Join(dir, ".zfs", "snapshot", name)
+		if err := os.MkdirAll(snapDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(snapDir, taken, taken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	freshDir, oldDir := t.TempDir(), t.TempDir()
+	snapshot(freshDir, "hourly", time.Now().Add(-time.Hour))
+	snapshot(oldDir, "weekly", time.Now().Add(-48*time.Hour))
+	storages := map[string]storage.Storage{}
+	for name, dir := range map[string]string{"fresh": freshDir, "old": oldDir, "unmonitored": t.TempDir()} {
+		store, err := local.NewWithConfig(dir, local.Config{Name: name})
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		storages[name] = store
+	}
+
+	notifier := webhook.New([]webhook.Hook{{URL: receiver.URL, Events: []string{webhook.SnapshotMissing}}})
+	server, err := NewServerWithConfig(storages, "fresh", Config{
+		Notifier:          notifier,
+		SnapshotMaxAge:    map[string]time.Duration{"fresh": 24 * time.Hour, "old": 24 * time.Hour},
+		FreshnessInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	// Checks don't overlap, so this waits for a running first check
+	server.checkFreshness()
+
+	w := httptest.NewRecorder()
+	Handler(server).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+	var health HealthStatus
+	json.NewDecoder(w.Body).Decode(&health)
+	if health.Status != HealthStatusStatusStale || health.Snapshots == nil || len(*health.Snapshots) != 2 {
+		t.Fatalf("unexpected health %+v", health)
+	}
+	fresh, old := (*health.Snapshots)[0], (*health.Snapshots)[1]
+	if fresh.Storage != "fresh" || fresh.Stale || fresh.Newest == nil || fresh.Checked == nil || fresh.MaxAgeSeconds != 86400 {
+		t.Errorf("unexpected freshness %+v", fresh)
+	}
+	if old.Storage != "old" || !old.Stale || old.Newest == nil {
+		t.Errorf("unexpected freshness %+v", old)
+	}
+
+	w = httptest.NewRecorder()
+	Handler(server).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected metrics, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	metrics := w.Body.String()
+	for _, want := range []string{
+		"# TYPE timeship_snapshot_stale gauge\n",
+		`timeship_snapshot_stale{storage="fresh"} 0`,
+		`timeship_snapshot_stale{storage="old"} 1`,
+		`timeship_snapshot_max_age_seconds{storage="old"} 86400`,
+		fmt.Sprintf(`timeship_snapshot_newest_timestamp_seconds{storage="old"} %d`, *old.Newest),
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(metrics, "unmonitored") {
+		t.Errorf("unexpected unmonitored storage in metrics:\n%s", metrics)
+	}
+
+	// A new snapshot makes the storage healthy again
+	snapshot(oldDir, "daily", time.Now())
+	server.checkFreshness()
+	w = httptest.NewRecorder()
+	Handler(server).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := notifier.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != webhook.SnapshotMissing || events[0].Storage != "old" || events[0].Since == nil {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestStat(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{
+		"docs/a.txt":                            "current a",
+		"docs/b.md":                             "b",
+		"private/secret.txt":                    "secret",
+		".zfs/snapshot/daily/docs/a.txt":        "old a",
+		".zfs/snapshot/daily/docs/removed.txt":  "removed",
+		".zfs/snapshot/daily/private/.keep.txt": "",
+	} {
+		p := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	docs, err := access.ParseRule("local://docs/**", []string{access.Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := access.New([]access.User{
+		{Name: "admin", Token: "admin-token", Rules: []access.Rule{{Storage: "*", Permissions: []string{access.Read, access.Write}}}},
+		{Name: "guest", Token: "guest-token", Rules: []access.Rule{docs}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}})
+
+	stat := func(token, body string) (int, StatResult) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/storages/local/stat", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var result StatResult
+		json.NewDecoder(w.Body).Decode(&result)
+		return w.Code, result
+	}
+
+	t.Run("live", func(t *testing.T) {
+		code, result := stat("admin-token", `{"paths": ["docs/a.txt", "/docs/", "docs/missing.txt", "", "docs/../docs/b.md"], "fields": "(permissions)"}`)
+		if code != http.StatusOK || len(result.Results) != 5 {
+			t.Fatalf("expected 5 results, got %d: %+v", code, result)
+		}
+		a, dir, missing, root, b := result.Results[0], result.Results[1], result.Results[2], result.Results[3], result.Results[4]
+		if a.Path != "docs/a.txt" || a.Node == nil || a.Node.Type != File || a.Node.FileSize != 9 || a.Node.Mode == nil || *a.Node.Mode != "0640" {
+			t.Errorf("unexpected result %+v", a)
+		}
+		if dir.Path != "docs" || dir.Node == nil || dir.Node.Type != Dir || dir.Node.Basename != "docs" {
+			t.Errorf("unexpected result %+v", dir)
+		}
+		if missing.Node != nil || missing.Code == nil || *missing.Code != "node_not_found" || missing.Error == nil {
+			t.Errorf("unexpected result %+v", missing)
+		}
+		if root.Path != "" || root.Node == nil || root.Node.Type != Dir {
+			t.Errorf("unexpected result %+v", root)
+		}
+		if b.Path != "docs/b.md" || b.Node == nil || b.Node.Path != "docs/b.md" || b.Node.Mode == nil {
+			t.Errorf("unexpected result %+v", b)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		_, result := stat("admin-token", `{"paths": ["docs/a.txt", "docs/removed.txt", "docs/b.md"], "snapshot": "zfs:daily"}`)
+		if len(result.Results) != 3 {
+			t.Fatalf("expected 3 results, got %+v", result)
+		}
+		if n := result.Results[0].Node; n == nil || n.FileSize != 5 {
+			t.Errorf("expected the snapshot version, got %+v", result.Results[0])
+		}
+		if result.Results[1].Node == nil || result.Results[2].Node != nil {
+			t.Errorf("expected only nodes of the snapshot, got %+v", result.Results)
+		}
+	})
+
+	t.Run("access", func(t *testing.T) {
+		_, result := stat("guest-token", `{"paths": ["docs/a.txt", "private/secret.txt", "private/missing.txt"]}`)
+		if len(result.Results) != 3 || result.Results[0].Node == nil {
+			t.Fatalf("unexpected results %+v", result)
+		}
+		// Denied nodes don't reveal whether they exist
+		for _, denied := range result.Results[1:] {
+			if denied.Node != nil || denied.Code == nil || *denied.Code != "forbidden" {
+				t.Errorf("expected access to be denied, got %+v", denied)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		paths := make([]string, maxStatPaths+1)
+		for i := range paths {
+			paths[i] = fmt.Sprintf("docs/%d.txt", i)
+		}
+		tooMany, _ := json.Marshal(map[string]any{"paths": paths})
+		for _, body := range []string{`{"paths": []}`, `not json`, string(tooMany)} {
+			if code, _ := stat("admin-token", body); code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", code)
+			}
+		}
+	})
+}
+
+// mockStaterStorage streams files that can't seek, modified at a different
+// time in each snapshot
+type mockStaterStorage struct {
+	mockStorageV2
+	modified map[string]int64
+}
+
+func (m *mockStaterStorage) LastModified(path url.URL) (int64, error) {
+	return m.modified[path.Query().Get("snapshot")], nil
+}
+
+func TestFileLastModified(t *testing.T) {
+	live, daily := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 3, 0, 0, 0, time.UTC)
+	mock := &mockStaterStorage{
+		mockStorageV2: mockStorageV2{content: "line 1\nline 2\n", mimeType: "text/plain", size: 14, isFile: true},
+		modified:      map[string]int64{"": live.Unix(), "zfs:daily": daily.Unix()},
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": mock}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	get := func(target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		Handler(server).ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		target string
+		want   time.Time
+	}{
+		{"/storages/local/nodes/notes.txt", live},
+		{"/storages/local/nodes/notes.txt?snapshot=zfs:daily", daily},
+		{"/storages/local/nodes/notes.txt?snapshot=zfs:daily&lines=1-1", daily},
+		{"/storages/local/nodes/notes.txt?format=hexdump&length=4", live},
+	}
+	for _, tt := range tests {
+		w := get(tt.target)
+		if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != tt.want.Format(http.TimeFormat) {
+			t.Errorf("%s: expected 200 modified %s, got %d %q", tt.target, tt.want, w.Code, w.Header().Get("Last-Modified"))
+		}
+	}
+
+	// Unchanged versions don't have to be sent again
+	if w := get("/storages/local/nodes/notes.txt?snapshot=zfs:daily", "If-Modified-Since", daily.Format(http.TimeFormat)); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected 304, got %d", w.Code)
+	}
+	if w := get("/storages/local/nodes/notes.txt", "If-Modified-Since", daily.Format(http.TimeFormat)); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for a newer file, got %d", w.Code)
+	}
+
+	t.Run("seekable snapshot file", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		snapFile := filepath.Join(tmpDir, ".zfs", "snapshot", "daily", "notes.txt")
+		if err := os.MkdirAll(filepath.Dir(snapFile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("new"), 0644)
+		os.WriteFile(snapFile, []byte("old"), 0644)
+		if err := os.Chtimes(snapFile, daily, daily); err != nil {
+			t.Fatal(err)
+		}
+		store, err := local.New(tmpDir)
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		w := httptest.NewRecorder()
+		Handler(server).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/storages/local/nodes/notes.txt?snapshot=zfs:daily", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "old" || w.Header().Get("Last-Modified") != daily.Format(http.TimeFormat) {
+			t.Errorf("expected the snapshot version modified %s, got %d %q", daily, w.Code, w.Header().Get("Last-Modified"))
+		}
+	})
+}
+
+func TestNodeTimesField(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("change times are not available on Windows")
+	}
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("a"), 0644)
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	get := func(target string, v any) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d: %s", target, w.Code, w.Body.String())
+		}
+		json.NewDecoder(w.Body).Decode(v)
+	}
+
+	var list NodeList
+	get("/storages/local/nodes/docs", &list)
+	if len(list.Files) != 1 || list.Files[0].Changed != nil || list.Files[0].Created != nil {
+		t.Errorf("expected no times without the field, got %+v", list.Files)
+	}
+	get("/storages/local/nodes/docs?fields=(times)", &list)
+	if len(list.Files) != 1 || list.Files[0].Changed == nil || *list.Files[0].Changed <= 0 {
+		t.Errorf("expected change time in listing, got %+v", list.Files)
+	}
+
+	var node Node
+	get("/storages/local/nodes/docs/a.txt?fields=(times)", &node)
+	if node.Changed == nil || *node.Changed <= 0 {
+		t.Errorf("expected change time in metadata, got %+v", node)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/storages/local/stat", strings.NewReader(`{"paths": ["docs", "docs/a.txt"], "fields": "(times)"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var result StatResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, item := range result.Results {
+		if item.Node == nil || item.Node.Changed == nil || *item.Node.Changed <= 0 {
+			t.Errorf("expected change time of %s, got %+v", item.Path, item)
+		}
+	}
+}
+
+func TestByteRange(t *testing.T) {
+	content := "0123456789abcdef"
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "data.bin"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localStore, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	mock := &mockStorageV2{
+		content:  content,
+		mimeType: "application/octet-stream",
+		size:     int64(len(content)),
+		isFile:   true,
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		header     string
+		wantStatus int
+		wantBody   string
+		wantRange  string
+	}{
+		{name: "offset and length", query: "offset=4&length=3", wantStatus: http.StatusPartialContent, wantBody: "456", wantRange: "bytes 4-6/16"},
+		{name: "offset only", query: "offset=10", wantStatus: http.StatusPartialContent, wantBody: "abcdef", wantRange: "bytes 10-15/16"},
+		{name: "length only", query: "length=2", wantStatus: http.StatusPartialContent, wantBody: "01", wantRange: "bytes 0-1/16"},
+		{name: "past end", query: "offset=14&length=10", wantStatus: http.StatusPartialContent, wantBody: "ef", wantRange: "bytes 14-15/16"},
+		{name: "beyond file", query: "offset=16", wantStatus: http.StatusRequestedRangeNotSatisfiable},
+		{name: "negative offset", query: "offset=-1", wantStatus: http.StatusBadRequest},
+		{name: "zero length", query: "length=0", wantStatus: http.StatusBadRequest},
+		{name: "with lines", query: "offset=1&lines=1-2", wantStatus: http.StatusBadRequest},
+		{name: "with range header", query: "offset=1", header: "bytes=0-1", wantStatus: http.StatusBadRequest},
+	}
+
+	stores := map[string]storage.Storage{"seekable": localStore, "stream": mock}
+	for name, store := range stores {
+		server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		handler := Handler(server)
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/storages/local/nodes/data.bin?"+tt.query, nil)
+				if tt.header != "" {
+					req.Header.Set("Range", tt.header)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+
+				if w.Code != tt.wantStatus {
+					t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+				}
+				if tt.wantStatus != http.StatusPartialContent {
+					return
+				}
+				if w.Body.String() != tt.wantBody {
+					t.Errorf("expected body %q, got %q", tt.wantBody, w.Body.String())
+				}
+				if cr := w.Header().Get("Content-Range"); cr != tt.wantRange {
+					t.Errorf("expected Content-Range %q, got %q", tt.wantRange, cr)
+				}
+			})
+		}
+	}
+}
+
+func TestPartialWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "data.bin"), []byte("0123456789"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	patch := func(target, body string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	content := func() string {
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "data.bin"))
+		return string(data)
+	}
+
+	w := patch("/storages/local/nodes/data.bin?offset=3", "abc", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if content() != "012abc6789" {
+		t.Errorf("expected the range to be replaced, got %q", content())
+	}
+	var node Node
+	json.NewDecoder(w.Body).Decode(&node)
+	if node.Path != "data.bin" || node.FileSize != 10 {
+		t.Errorf("unexpected node %+v", node)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected ETag of the updated file")
+	}
+
+	// Appending at the current size resumes a write
+	if w := patch("/storages/local/nodes/data.bin?offset=10", "XY", http.Header{"If-Match": {etag}}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if content() != "012abc6789XY" {
+		t.Errorf("expected the file to grow, got %q", content())
+	}
+	if w := patch("/storages/local/nodes/data.bin?offset=0", "!", http.Header{"If-Match": {etag}}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 with a stale ETag, got %d", w.Code)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "past end", target: "/storages/local/nodes/data.bin?offset=13", want: http.StatusRequestedRangeNotSatisfiable},
+		{name: "without offset", target: "/storages/local/nodes/data.bin", want: http.StatusBadRequest},
+		{name: "missing file", target: "/storages/local/nodes/missing.bin?offset=0", want: http.StatusNotFound},
+		{name: "directory", target: "/storages/local/nodes/docs?offset=0", want: http.StatusBadRequest},
+	} {
+		if w := patch(tt.target, "!", nil); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if content() != "012abc6789XY" {
+		t.Errorf("expected failed writes to keep the file, got %q", content())
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "missing.bin")); !os.IsNotExist(err) {
+		t.Errorf("expected missing file not to be created, got %v", err)
+	}
+}
+
+func TestDeltaSync(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "data.bin"), []byte("0123456789"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	server, err := NewServer(map[string]storage.Storage{"local": store}, "local")
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	handler := Handler(server)
+
+	send := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	content := func() string {
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "data.bin"))
+		return string(data)
+	}
+
+	w := send(http.MethodGet, "/storages/local/signatures/data.bin?block_size=256", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// Magic, block size and strong sum length, then one block
+	if sig := w.Body.Bytes(); len(sig) != 12+4+32 || string(sig[:4]) != "\x72\x73\x01\x37" || string(sig[4:12]) != "\x00\x00\x01\x00\x00\x00\x00\x20" {
+		t.Errorf("unexpected signature %x", sig)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected ETag of the file")
+	}
+	if w := send(http.MethodGet, "/storages/local/signatures/data.bin?block_size=1", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too small blocks, got %d", w.Code)
+	}
+	if w := send(http.MethodGet, "/storages/local/signatures/docs", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a directory, got %d", w.Code)
+	}
+	if w := send(http.MethodGet, "/storages/local/signatures/missing.bin", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, got %d", w.Code)
+	}
+
+	// Copy 0-4, insert XY, copy 7-9
+	delta := "\x72\x73\x02\x36" + "\x45\x00\x05" + "\x02XY" + "\x45\x07\x03" + "\x00"
+	if w := send(http.MethodPost, "/storages/local/deltas/data.bin", "\x72\x73\x02\x36\x45\x20\x05\x00", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a delta copying past the end, got %d: %s", w.Code, w.Body.String())
+	}
+	if content() != "0123456789" {
+		t.Errorf("expected invalid delta to keep the file, got %q", content())
+	}
+
+	w = send(http.MethodPost, "/storages/local/deltas/data.bin", delta, http.Header{"If-Match": {etag}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if content() != "01234XY789" {
+		t.Errorf("expected patched content, got %q", content())
+	}
+	if newETag := w.Header().Get("ETag"); newETag == "" || newETag == etag {
+		t.Errorf("expected new ETag, got %q", newETag)
+	}
+	if w := send(http.MethodPost, "/storages/local/deltas/data.bin", delta, http.Header{"If-Match": {etag}}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for a delta of an older version, got %d", w.Code)
+	}
+	if w := send(http.MethodPost, "/storages/local/deltas/missing.bin", delta, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, got %d", w.Code)
+	}
+
+	// A conditional delta arriving slowly doesn't hold up other updates
+	etag = fileETag(context.Background(), store, url.URL{Scheme: "local", Path: "data.bin"})
+	pr, pw := io.Pipe()
+	req := httptest.NewRequest(http.MethodPost, "/storages/local/deltas/data.bin", pr)
+	req.Header.Set("If-Match", etag)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	pw.Write([]byte(delta[:4]))
+	updated := make(chan int, 1)
+	go func() {
+		w := send(http.MethodPatch, "/storages/local/nodes/data.bin?offset=0", "ab", http.Header{"If-Match": {etag}})
+		updated <- w.Code
+	}()
+	select {
+	case code := <-updated:
+		if code != http.StatusOK {
+			t.Errorf("expected 200 for the update, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected update not to wait for the delta")
+	}
+	pw.Close()
+	<-done
+}
+
+func TestExportImport(t *testing.T) {
+	rule := func(path string, permissions ...string) access.Rule {
+		r, err := access.ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	users := []access.User{
+		{Name: "admin", Token: "admin-token", Rules: []access.Rule{rule("*://**", access.Read, access.Write)}},
+		{Name: "guest", Token: "guest-token", Rules: []access.Rule{rule("local://**", access.Read, access.Write)}},
+	}
+	// newServer returns the handler of a server with its own databases
+	newServer := func() (http.Handler, *tokens.Store, *tags.Store) {
+		store, err := local.New(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		tokenStore, err := tokens.Open(filepath.Join(t.TempDir(), "tokens.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { tokenStore.Close() })
+		tagStore, err := tags.Open(filepath.Join(t.TempDir(), "tags.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { tagStore.Close() })
+		policy, err := access.NewWithConfig(users, access.Config{Issuer: tokenStore})
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{
+			Access: policy,
+			Tokens: tokenStore,
+			Tags:   tagStore,
+			ExportConfig: func() ([]byte, error) {
+				return []byte("storages:\n  - name: local\n    type: local\n    root: /data\n"), nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		return HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}}), tokenStore, tagStore
+	}
+	do := func(handler http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	source, sourceTokens, sourceTags := newServer()
+	_, issued, err := sourceTokens.Create("guest", "sync", []access.Rule{rule("local://**", access.Read)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sourceTags.Tag("guest", "taxes", tags.Node{Storage: "local", Path: "docs/taxes.pdf", Identity: "1:2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sourceTags.AddBookmark("guest", "Docs", tags.Node{Storage: "local", Path: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := do(source, http.MethodGet, "/admin/export", "guest-token", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected admins only, got %d: %s", w.Code, w.Body.String())
+	}
+	w := do(source, http.MethodGet, "/admin/export", "admin-token", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("expected an attachment, got %q", w.Header().Get("Content-Disposition"))
+	}
+	exported := w.Body.String()
+	var b ConfigBundle
+	if err := json.Unmarshal([]byte(exported), &b); err != nil || b.Version != 1 || b.Config == nil || !strings.Contains(*b.Config, "root: /data") || b.Tokens == nil || len(*b.Tokens) != 1 {
+		t.Fatalf("unexpected bundle %s: %v", exported, err)
+	}
+
+	target, _, targetTags := newServer()
+	if w := do(target, http.MethodGet, "/storages/local/nodes", issued, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected token to be unknown before importing, got %d", w.Code)
+	}
+	if w := do(target, http.MethodPost, "/admin/import", "admin-token", `{"version":99}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected unsupported version to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(target, http.MethodPost, "/admin/import", "admin-token", exported)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result ImportResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if result != (ImportResult{Tokens: 1, Tags: 1, Bookmarks: 1}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if w := do(target, http.MethodGet, "/storages/local/nodes", issued, ""); w.Code != http.StatusOK {
+		t.Errorf("expected imported token to work, got %d: %s", w.Code, w.Body.String())
+	}
+	if nodes, err := targetTags.Tagged("guest", "taxes"); err != nil || len(nodes) != 1 || nodes[0].Path != "docs/taxes.pdf" {
+		t.Errorf("expected imported tag, got %+v, %v", nodes, err)
+	}
+
+	w = do(target, http.MethodPost, "/admin/import", "admin-token", exported)
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || result != (ImportResult{}) {
+		t.Errorf("expected existing records to be skipped, got %d %+v", w.Code, result)
+	}
+}
+
+func TestJobHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily", "docs")
+	os.MkdirAll(snapDir, 0755)
+	os.WriteFile(filepath.Join(snapDir, "a.txt"), []byte("old a"), 0644)
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	history, err := jobs.OpenHistory(filepath.Join(t.TempDir(), "jobs.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := func(path string, permissions ...string) access.Rule {
+		r, err := access.ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	policy, err := access.New([]access.User{
+		{Name: "admin", Token: "admin-token", Rules: []access.Rule{rule("*://**", access.Read, access.Write)}},
+		{Name: "guest", Token: "guest-token", Rules: []access.Rule{rule("local://docs/**", access.Read, access.Write)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The manager only keeps the newest finished job
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": store}, "local", Config{Access: policy, Jobs: jobs.New(1), JobHistory: history})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize}})
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	list := func(target, token string) JobHistory {
+		t.Helper()
+		w := do(http.MethodGet, target, token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var h JobHistory
+		json.NewDecoder(w.Body).Decode(&h)
+		return h
+	}
+
+	if w := do(http.MethodPost, "/storages/local/copies", "guest-token", `{"destination":"docs","items":[{"path":"docs/a.txt","snapshot":"zfs:daily"},{"path":"other.txt","snapshot":"zfs:daily"}]}`); w.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/storages/local/copies", "admin-token", `{"destination":"","items":[{"path":"docs/a.txt","snapshot":"zfs:daily"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	t.Run("restores are recorded", func(t *testing.T) {
+		h := list("/jobs/history?type=restore", "admin-token")
+		if len(h.Jobs) != 3 || h.Jobs[0].User == nil || *h.Jobs[0].User != "admin" || h.Jobs[0].Params["destination"] != "a.txt" {
+			t.Fatalf("expected 3 restores, newest first, got %+v", h.Jobs)
+		}
+		if h.Jobs[1].State != Failed || h.Jobs[1].Params["path"] != "other.txt" || h.Jobs[2].State != Succeeded {
+			t.Errorf("unexpected restores %+v", h.Jobs)
+		}
+	})
+
+	t.Run("users see their own jobs", func(t *testing.T) {
+		h := list("/jobs/history?user=admin", "guest-token")
+		if len(h.Jobs) != 2 || *h.Jobs[0].User != "guest" {
+			t.Errorf("expected only guest's jobs, got %+v", h.Jobs)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		h := list("/jobs/history?limit=2", "admin-token")
+		if len(h.Jobs) != 2 || h.Before == nil {
+			t.Fatalf("expected a full page, got %+v", h)
+		}
+		next := list("/jobs/history?limit=2&before="+*h.Before, "admin-token")
+		if len(next.Jobs) != 1 || next.Before != nil || next.Jobs[0].Id == h.Jobs[1].Id {
+			t.Errorf("expected the last page, got %+v", next)
+		}
+		if w := do(http.MethodGet, "/jobs/history?state=running", "admin-token", ""); w.Code != http.StatusBadRequest {
+			t.Errorf("expected running jobs not to be in the history, got %d", w.Code)
+		}
+	})
+
+	t.Run("forgotten jobs are looked up in the history", func(t *testing.T) {
+		oldest := list("/jobs/history?state=succeeded&until="+strconv.FormatInt(time.Now().Unix()+1, 10), "admin-token").Jobs
+		id := oldest[len(oldest)-1].Id
+		if _, ok := server.config.Jobs.Get(id); ok {
+			t.Fatal("expected the manager to have forgotten the job")
+		}
+		if w := do(http.MethodGet, "/jobs/"+id, "guest-token", ""); w.Code != http.StatusOK {
+			t.Errorf("expected job from the history, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestDrain(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("content"), 0644)
+	// Each server closes its storages
+	open := func() storage.Storage {
+		store, err := local.New(tmpDir)
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		return store
+	}
+
+	t.Run("waits for jobs", func(t *testing.T) {
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": open()}, "local", Config{})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		defer server.Close()
+		handler := HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize, server.Track}})
+		request := func(target string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			return w
+		}
+
+		release := make(chan struct{})
+		server.config.Jobs.Start(jobs.Export, nil, "", func(ctx context.Context, progress func(jobs.Progress)) error {
+			<-release
+			return nil
+		})
+		drained := make(chan bool)
+		go func() { drained <- server.Drain(context.Background(), 5*time.Second) }()
+		for server.drain() == nil {
+			time.Sleep(time.Millisecond)
+		}
+
+		w := request("/healthz")
+		var health HealthStatus
+		json.NewDecoder(w.Body).Decode(&health)
+		if w.Code != http.StatusOK || health.Status != HealthStatusStatusDraining || health.Drain == nil || health.Drain.Jobs != 1 {
+			t.Errorf("expected a draining status, got %d: %+v", w.Code, health)
+		}
+		if w := request("/readyz"); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 readiness while draining, got %d", w.Code)
+		}
+		w = request("/storages")
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("expected 503 with Retry-After for new requests, got %d: %v", w.Code, w.Header())
+		}
+
+		close(release)
+		if !<-drained {
+			t.Error("expected drain to finish once the job is done")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": open()}, "local", Config{})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		defer server.Close()
+		started := server.config.Jobs.Start(jobs.Export, nil, "", func(ctx context.Context, progress func(jobs.Progress)) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if server.Drain(context.Background(), 10*time.Millisecond) {
+			t.Error("expected drain to time out")
+		}
+		server.Close()
+		if job, _ := server.config.Jobs.Get(started.ID); job.State != jobs.Interrupted {
+			t.Errorf("expected the job to be interrupted, got %+v", job)
+		}
+	})
+
+	t.Run("resume jobs", func(t *testing.T) {
+		history, err := jobs.OpenHistory(filepath.Join(t.TempDir(), "jobs.db"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := local.NewWithConfig(t.TempDir(), local.Config{Name: "backup"})
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		now := time.Now()
+		interrupted := jobs.Job{
+			ID:       "interrupted",
+			Type:     jobs.Export,
+			Params:   map[string]string{"storage": "local", "path": "", "destination_storage": "backup", "destination": "copy"},
+			State:    jobs.Interrupted,
+			Started:  now.Add(-time.Minute),
+			Finished: now,
+		}
+		if err := history.Add(interrupted); err != nil {
+			t.Fatal(err)
+		}
+
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": open(), "backup": dst}, "local", Config{JobHistory: history, ResumeJobs: true})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		defer server.Close()
+		list := server.config.Jobs.List()
+		if len(list) != 1 || list[0].Type != jobs.Export || list[0].Params["destination"] != "copy" {
+			t.Fatalf("expected the export to be resumed, got %+v", list)
+		}
+		if job, err := server.config.Jobs.Wait(list[0].ID); err != nil || job.State != jobs.Succeeded {
+			t.Errorf("expected the resumed job to succeed, got %+v, %v", job, err)
+		}
+		old, err := history.Get("interrupted")
+		if err != nil || old.State != jobs.Canceled || !strings.HasPrefix(old.Progress.Message, "Resumed as job ") {
+			t.Errorf("expected the old job to be marked resumed, got %+v, %v", old, err)
+		}
+	})
+
+	t.Run("resume jobs of users", func(t *testing.T) {
+		root := t.TempDir()
+		os.MkdirAll(filepath.Join(root, "homes", "alice"), 0755)
+		os.WriteFile(filepath.Join(root, "homes", "alice", "mine.txt"), []byte("mine"), 0644)
+		os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644)
+		src, err := local.New(root)
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		backupDir := t.TempDir()
+		dst, err := local.NewWithConfig(backupDir, local.Config{Name: "backup"})
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		policy, err := access.New([]access.User{
+			{Name: "alice", Token: "alice-token", HomeStorage: "local", HomePath: "homes/alice", Rules: []access.Rule{
+				{Storage: "local", Permissions: access.Permissions},
+				{Storage: "backup", Prefix: "alice", Permissions: access.Permissions},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		history, err := jobs.OpenHistory(filepath.Join(t.TempDir(), "jobs.db"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		add := func(id, user, destination string, extra map[string]string) {
+			params := map[string]string{"storage": "local", "path": "", "destination_storage": "backup", "destination": destination}
+			maps.Copy(params, extra)
+			job := jobs.Job{ID: id, Type: jobs.Export, Params: params, User: user, State: jobs.Interrupted, Started: now.Add(-time.Minute), Finished: now}
+			if err := history.Add(job); err != nil {
+				t.Fatal(err)
+			}
+		}
+		add("home", "alice", "alice/copy", nil)
+		add("forbidden", "alice", "elsewhere", nil)
+		add("gone", "bob", "alice/copy", nil)
+		add("token", "alice", "alice/copy", map[string]string{"via": "token"})
+
+		server, err := NewServerWithConfig(map[string]storage.Storage{"local": src, "backup": dst}, "local", Config{Access: policy, JobHistory: history, ResumeJobs: true})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		defer server.Close()
+		list := server.config.Jobs.List()
+		if len(list) != 1 || list[0].User != "alice" {
+			t.Fatalf("expected only the job of alice to be resumed, got %+v", list)
+		}
+		if job, err := server.config.Jobs.Wait(list[0].ID); err != nil || job.State != jobs.Succeeded {
+			t.Fatalf("expected the resumed job to succeed, got %+v, %v", job, err)
+		}
+		if _, err := os.Stat(filepath.Join(backupDir, "alice", "copy", "mine.txt")); err != nil {
+			t.Errorf("expected the home to be exported: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(backupDir, "alice", "copy", "secret.txt")); err == nil {
+			t.Error("expected nothing outside of the home to be exported")
+		}
+		for _, id := range []string{"forbidden", "gone", "token"} {
+			if job, err := history.Get(id); err != nil || job.State != jobs.Failed || job.Error == "" {
+				t.Errorf("expected job %s to fail, got %+v, %v", id, job, err)
+			}
+		}
+	})
+}
+
+// count returns the number of streams subscribed to storage events
+func (e *storageEvents) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.subscribers)
+}
+
+func TestStorageEvents(t *testing.T) {
+	open := func() storage.Storage {
+		store, err := local.New(t.TempDir())
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		return store
+	}
+	rule := func(path string, permissions ...string) access.Rule {
+		r, err := access.ParseRule(path, permissions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	policy, err := access.New([]access.User{
+		{Name: "admin", Token: "admin-token", Rules: []access.Rule{rule("*://**", access.Read, access.Write)}},
+		{Name: "guest", Token: "guest-token", Rules: []access.Rule{rule("local://**", access.Read)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerWithConfig(map[string]storage.Storage{"local": open()}, "local", Config{Access: policy})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Close()
+	ts := httptest.NewServer(HandlerWithOptions(server, StdHTTPServerOptions{Middlewares: []MiddlewareFunc{server.Authorize, server.Track}}))
+	defer ts.Close()
+
+	// stream returns the events of a stream as they arrive
+	stream := func(token string) (<-chan string, func()) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/storages/events", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		lines := make(chan string, 10)
+		go func() {
+			defer close(lines)
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if line, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+					lines <- line
+				}
+			}
+		}()
+		return lines, func() { resp.Body.Close() }
+	}
+	next := func(events <-chan string) (StorageEvent, bool) {
+		t.Helper()
+		select {
+		case data, ok := <-events:
+			var event StorageEvent
+			if ok {
+				json.Unmarshal([]byte(data), &event)
+			}
+			return event, ok
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return StorageEvent{}, false
+		}
+	}
+
+	adminEvents, closeAdmin := stream("admin-token")
+	defer closeAdmin()
+	guestEvents, closeGuest := stream("guest-token")
+	defer closeGuest()
+	// Wait for both subscriptions before changing anything
+	for server.events.count() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Run("added", func(t *testing.T) {
+		if err := server.AddStorage("usb", open()); err != nil {
+			t.Fatal(err)
+		}
+		if err := server.AddStorage("usb", open()); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("expected a taken name to fail, got %v", err)
+		}
+		if event, _ := next(adminEvents); event.Event != "storage.added" || event.Storage != "usb" || event.Time.IsZero() {
+			t.Errorf("unexpected event %+v", event)
+		}
+		if !slices.Contains(server.storageNames(), "usb") {
+			t.Errorf("expected the storage to be served, got %v", server.storageNames())
+		}
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		if !server.RemoveStorage("usb") {
+			t.Fatal("expected the storage to be removed")
+		}
+		if server.RemoveStorage("usb") {
+			t.Error("expected a missing storage not to be removed")
+		}
+		if event, _ := next(adminEvents); event.Event != "storage.removed" || event.Storage != "usb" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	})
+
+	t.Run("eject", func(t *testing.T) {
+		do := func(name, token string) int {
+			req, _ := http.NewRequest(http.MethodPost, ts.URL+"/storages/"+name+"/eject", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		if code := do("local", "admin-token"); code != http.StatusNotImplemented {
+			t.Errorf("expected 501 without removable drives, got %d", code)
+		}
+		server.config.EjectDrive = func(name string) error {
+			if name != "stick" {
+				return fs.ErrNotExist
+			}
+			server.RemoveStorage(name)
+			return nil
+		}
+		defer func() { server.config.EjectDrive = nil }()
+		if err := server.AddStorage("stick", open()); err != nil {
+			t.Fatal(err)
+		}
+		if code := do("stick", "guest-token"); code != http.StatusForbidden {
+			t.Errorf("expected 403 without write permission, got %d", code)
+		}
+		if code := do("local", "admin-token"); code != http.StatusNotFound {
+			t.Errorf("expected 404 for a configured storage, got %d", code)
+		}
+		if code := do("stick", "admin-token"); code != http.StatusAccepted {
+			t.Errorf("expected 202, got %d", code)
+		}
+		for _, want := range []string{"storage.added", "storage.removed"} {
+			if event, _ := next(adminEvents); event.Event != want || event.Storage != "stick" {
+				t.Errorf("expected %s, got %+v", want, event)
+			}
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		if err := server.Reload(map[string]storage.Storage{"local": open(), "nas": open()}, "local", policy); err != nil {
+			t.Fatal(err)
+		}
+		if event, _ := next(adminEvents); event.Event != "storage.added" || event.Storage != "nas" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	})
+
+	t.Run("draining ends streams", func(t *testing.T) {
+		server.Drain(context.Background(), time.Second)
+		for {
+			if _, ok := next(adminEvents); !ok {
+				break
+			}
+		}
+		// The guest saw none of the storages it can't see
+		if event, ok := next(guestEvents); ok {
+			t.Errorf("expected no events for the guest, got %+v", event)
+		}
+	})
 }
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/archive"
+	"timeship/internal/manifest"
+	"timeship/internal/storage"
+)
+
+// manifestSuffix is appended to the name of an archive for its manifest
+const manifestSuffix = ".manifest.json"
+
+// PostStoragesStorageArchives creates a zip archive of nodes in a directory
+// of the storage, with a manifest of the archived files next to it
+func (s *Server) PostStoragesStorageArchives(w http.ResponseWriter, r *http.Request, storageName Storage, params PostStoragesStorageArchivesParams) {
+	ctx := r.Context()
+	store, err := s.getStorage(ctx, string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	reader, canRead := store.(storage.Reader)
+	_, canWrite := store.(storage.Writer)
+	if !canRead || !canWrite {
+		s.sendError(w, problemNotSupported, "Storage does not support reading and writing files", r.URL.Path)
+		return
+	}
+	lister, _ := store.(storage.Lister)
+
+	var request PostStoragesStorageArchivesJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if len(request.Items) == 0 {
+		s.sendError(w, problemBadRequest, "No items to archive", r.URL.Path)
+		return
+	}
+	name := request.Name + archive.Zip.Extension()
+	if err := validateName(name); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid archive name: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	dir := ""
+	if params.Path != nil {
+		dir = strings.Trim(path.Clean("/"+*params.Path), "/")
+	}
+	archivePath := url.URL{Scheme: string(storageName), Path: path.Join(dir, name)}
+	manifestPath := archivePath
+	manifestPath.Path += manifestSuffix
+
+	// Resolve all items up front, so missing ones fail before writing
+	requested := make([]DownloadItem, len(request.Items))
+	for i, item := range request.Items {
+		requested[i] = DownloadItem{Path: item.Path, Snapshot: item.Snapshot}
+	}
+	items := selectDownloadItems(string(storageName), requested)
+	for _, item := range items {
+		if !s.allowed(r, string(storageName), item.path, access.Read) {
+			s.sendForbidden(w, r)
+			return
+		}
+	}
+	for i := range items {
+		if err := s.statDownloadItem(ctx, reader, lister, &items[i]); err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+	}
+	nameDownloadItems(items)
+
+	// The archive is written before the manifest, so check both for
+	// conflicts first
+	if existence, ok := store.(storage.Existence); ok {
+		if exists, err := existence.FileExists(manifestPath); err != nil || exists {
+			if err == nil {
+				err = &fs.PathError{Op: "create", Path: manifestPath.Path, Err: fs.ErrExist}
+			}
+			s.sendStorageError(w, r, err)
+			return
+		}
+	}
+
+	m := &manifest.Manifest{
+		Storage: string(storageName),
+		Path:    archivePath.Path,
+		Created: time.Now().Unix(),
+		Files:   []manifest.File{},
+	}
+	if err := s.createArchive(ctx, store, reader, lister, items, archivePath, m); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	m.Sort()
+	if s.config.SigningKey != nil {
+		m.Sign(s.config.SigningKey)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = s.writeNew(ctx, store, manifestPath, bytes.NewReader(data))
+	}
+	if err != nil {
+		// An archive without its manifest can't be verified
+		if deleter, ok := store.(storage.Deleter); ok {
+			if err := deleter.Delete(archivePath); err != nil {
+				log.Printf("Failed to delete archive %s without manifest: %v", archivePath.String(), err)
+			}
+		}
+		s.sendStorageError(w, r, fmt.Errorf("failed to write manifest: %w", err))
+		return
+	}
+
+	node := describeNode(store, archivePath, File)
+	location := strings.TrimSuffix(r.URL.Path, "/archives") + "/nodes"
+	for _, segment := range strings.Split(archivePath.Path, "/") {
+		location += "/" + url.PathEscape(segment)
+	}
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(node)
+}
+
+// createArchive writes a zip archive of resolved items to the storage while
+// adding the archived files to a manifest
+func (s *Server) createArchive(ctx context.Context, store storage.Storage, reader storage.Reader, lister storage.Lister, items []downloadItem, archivePath url.URL, m *manifest.Manifest) error {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		out := bufio.NewWriterSize(pw, copyBufferSize)
+		aw, err := archive.NewWriter(out, archive.Zip)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		mw := &manifestWriter{Writer: aw, manifest: m}
+		for _, item := range items {
+			if err := s.archiveItem(ctx, mw, reader, lister, item); err != nil {
+				pw.CloseWithError(fmt.Errorf("failed to archive %s: %w", item.vfPath.String(), err))
+				return
+			}
+		}
+		if err := aw.Close(); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(out.Flush())
+	}()
+
+	err := s.writeNew(ctx, store, archivePath, pr)
+	// Stop the archive if the storage didn't read all of it
+	pr.Close()
+	<-done
+	return err
+}
+
+// manifestWriter adds the files written to an archive to a manifest
+type manifestWriter struct {
+	archive.Writer
+	manifest *manifest.Manifest
+}
+
+func (w *manifestWriter) Add(e archive.Entry, content io.Reader) error {
+	if e.Dir || e.LinkTarget != "" {
+		return w.Writer.Add(e, content)
+	}
+	// The content is hashed as it's archived, so files changing meanwhile
+	// match their manifest entry
+	h := sha256.New()
+	counter := &byteCounter{}
+	if err := w.Writer.Add(e, io.TeeReader(content, io.MultiWriter(h, counter))); err != nil {
+		return err
+	}
+	w.manifest.Files = append(w.manifest.Files, manifest.File{
+		Path:   e.Name,
+		Size:   counter.n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	})
+	return nil
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// GetStoragesStorageVerificationsPath verifies an archive against the
+// manifest next to it
+func (s *Server) GetStoragesStorageVerificationsPath(w http.ResponseWriter, r *http.Request, storageName Storage, archivePath NodePath) {
+	ctx := r.Context()
+	store, err := s.getStorage(ctx, string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support reading files", r.URL.Path)
+		return
+	}
+
+	vfPath := url.URL{Scheme: string(storageName), Path: strings.Trim(path.Clean("/"+archivePath), "/")}
+	format, ok := archive.FormatOf(vfPath.Path)
+	if !ok {
+		s.sendError(w, problemBadRequest, "Not an archive: "+vfPath.Path, r.URL.Path)
+		return
+	}
+	manifestPath := vfPath
+	manifestPath.Path += manifestSuffix
+
+	stored, err := readManifest(ctx, reader, manifestPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.sendError(w, problemManifestNotFound, "No manifest for archive "+vfPath.Path, r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendError(w, problemBadRequest, "Invalid manifest: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	found := &manifest.Manifest{}
+	err = walkArchive(ctx, reader, vfPath, format, func(e archive.Entry, content io.Reader) error {
+		if e.Dir || e.LinkTarget != "" {
+			return nil
+		}
+		return found.Add(e.Name, content)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if err != nil {
+		s.sendError(w, problemBadRequest, "Invalid archive: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	result := stored.Check(found.Files)
+	signature := verifySignature(stored, s.config.SigningKey)
+	response := ArchiveVerification{
+		Archive:    vfPath.Path,
+		Manifest:   manifestPath.Path,
+		Ok:         result.OK() && signature != Invalid,
+		Checked:    result.Checked,
+		Missing:    result.Missing,
+		Changed:    result.Changed,
+		Unexpected: result.Unexpected,
+		Signature:  signature,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// verifySignature checks the signature of a manifest with the public key
+// of the signing key, not the key in the manifest, which anyone could
+// replace along with the signature
+func verifySignature(m *manifest.Manifest, key ed25519.PrivateKey) ArchiveVerificationSignature {
+	switch {
+	case m.Signature == "":
+		return Unsigned
+	case key == nil:
+		return Unchecked
+	case m.Verify(key.Public().(ed25519.PublicKey)) != nil:
+		return Invalid
+	default:
+		return Valid
+	}
+}
+
+// readManifest reads a manifest written next to an archive
+func readManifest(ctx context.Context, reader storage.Reader, vfPath url.URL) (*manifest.Manifest, error) {
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var m manifest.Manifest
+	if err := json.NewDecoder(stream).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// walkArchive walks the entries of an archive in the storage. Archives are
+// read with random access, so streams without it are copied to a temporary
+// file first.
+func walkArchive(ctx context.Context, reader storage.Reader, vfPath url.URL, format archive.Format, fn func(e archive.Entry, content io.Reader) error) error {
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	if ra, ok := stream.(io.ReaderAt); ok {
+		size, err := traceStorage(ctx, "FileSize", reader, vfPath, reader.FileSize)
+		if err != nil {
+			return err
+		}
+		return archive.Walk(ra, size, format, fn)
+	}
+
+	tmp, err := os.CreateTemp("", "timeship-archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, stream)
+	if err != nil {
+		return err
+	}
+	return archive.Walk(tmp, size, format, fn)
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"timeship/internal/access"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordRejected counts a rejected request for /metrics and marks its span
+// with the reason
+func (s *Server) recordRejected(r *http.Request, reason string) {
+	switch reason {
+	case "locked_out":
+		s.lockedOut.Add(1)
+	default:
+		s.unauthenticated.Add(1)
+	}
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("timeship.auth.rejected", reason))
+}
+
+// Checks of routes, from the weakest to the strongest
+const (
+	// checkPublic needs no token
+	checkPublic = iota
+
+	// checkUser needs a user, the handler checks the storages and paths
+	// involved
+	checkUser
+
+	// checkVisible needs the path to be visible, e.g. to list it
+	checkVisible
+
+	// checkRead needs read permission on the path
+	checkRead
+
+	// checkWrite needs write permission on the path
+	checkWrite
+
+	// checkAdmin needs write permission on all storages
+	checkAdmin
+)
+
+// Sources of the checked path
+const (
+	// fromRoot checks the storage root, so the whole storage
+	fromRoot = iota
+
+	// fromPath checks the path parameter
+	fromPath
+
+	// fromQuery checks the path query parameter, the root if it's missing
+	fromQuery
+)
+
+// routeAccess describes what a route needs
+type routeAccess struct {
+	check int
+	from  int
+	// stream marks long-lived streams that don't use storages, which
+	// reloading and draining don't wait for
+	stream bool
+}
+
+// routes maps the patterns of all routes to what they need. Routes missing
+// here are denied, so new routes can't be left open by accident.
+var routes = map[string]routeAccess{
+	"GET /healthz": {check: checkPublic},
+	"GET /readyz":  {check: checkPublic},
+	"GET /version": {check: checkPublic},
+	"GET /metrics": {check: checkPublic},
+
+	"POST /admin/reload":          {check: checkAdmin},
+	"GET /admin/export":           {check: checkAdmin},
+	"POST /admin/import":          {check: checkAdmin},
+	"GET /schedules":              {check: checkAdmin},
+	"POST /schedules/{name}/runs": {check: checkAdmin},
+
+	"GET /storages":        {check: checkUser},
+	"GET /storages/events": {check: checkUser, stream: true},
+	"GET /tokens":          {check: checkUser},
+	"POST /tokens":         {check: checkUser},
+	"DELETE /tokens/{id}":  {check: checkUser},
+	"GET /jobs":            {check: checkUser},
+	"GET /jobs/history":    {check: checkUser},
+	"GET /jobs/{id}":       {check: checkUser},
+	"DELETE /jobs/{id}":    {check: checkUser},
+	"GET /pins":            {check: checkUser},
+	"POST /pins":           {check: checkUser},
+	"DELETE /pins/{name}":  {check: checkUser},
+
+	"GET /tags":              {check: checkUser},
+	"GET /tags/{tag}":        {check: checkUser},
+	"GET /bookmarks":         {check: checkUser},
+	"POST /bookmarks":        {check: checkUser},
+	"DELETE /bookmarks/{id}": {check: checkUser},
+	"DELETE /comments/{id}":  {check: checkUser},
+	"GET /recent":            {check: checkUser},
+	"DELETE /recent":         {check: checkUser},
+
+	"GET /storages/{storage}/archives":         {check: checkRead, from: fromQuery},
+	"POST /storages/{storage}/archives":        {check: checkWrite, from: fromQuery},
+	"POST /storages/{storage}/archives/{path}": {check: checkWrite, from: fromPath},
+	"POST /storages/{storage}/copies":          {check: checkUser},
+	"POST /storages/{storage}/downloads":       {check: checkUser},
+	"POST /storages/{storage}/exports":         {check: checkUser},
+	"POST /storages/{storage}/moves":           {check: checkUser},
+	"POST /storages/{storage}/stat":            {check: checkUser},
+
+	"GET /storages/{storage}/index":                   {check: checkVisible},
+	"POST /storages/{storage}/index":                  {check: checkWrite},
+	"DELETE /storages/{storage}/index":                {check: checkWrite},
+	"POST /storages/{storage}/index/pause":            {check: checkWrite},
+	"POST /storages/{storage}/index/resume":           {check: checkWrite},
+	"GET /storages/{storage}/manifests":               {check: checkRead},
+	"GET /storages/{storage}/manifests/{path...}":     {check: checkRead, from: fromPath},
+	"GET /storages/{storage}/verifications/{path...}": {check: checkRead, from: fromPath},
+
+	"GET /storages/{storage}/nodes":              {check: checkVisible},
+	"POST /storages/{storage}/nodes":             {check: checkWrite},
+	"GET /storages/{storage}/nodes/{path...}":    {check: checkVisible, from: fromPath},
+	"POST /storages/{storage}/nodes/{path...}":   {check: checkWrite, from: fromPath},
+	"PATCH /storages/{storage}/nodes/{path...}":  {check: checkWrite, from: fromPath},
+	"DELETE /storages/{storage}/nodes/{path...}": {check: checkWrite, from: fromPath},
+
+	"GET /storages/{storage}/tags/{path...}":    {check: checkVisible, from: fromPath},
+	"POST /storages/{storage}/tags/{path...}":   {check: checkRead, from: fromPath},
+	"DELETE /storages/{storage}/tags/{path...}": {check: checkVisible, from: fromPath},
+
+	"GET /storages/{storage}/activity":            {check: checkRead},
+	"GET /storages/{storage}/activity/{path...}":  {check: checkRead, from: fromPath},
+	"POST /storages/{storage}/activity/{path...}": {check: checkRead, from: fromPath},
+
+	"GET /storages/{storage}/render/{path...}":     {check: checkRead, from: fromPath},
+	"GET /storages/{storage}/thumbnails/{path...}": {check: checkRead, from: fromPath},
+	"GET /storages/{storage}/signatures/{path...}": {check: checkRead, from: fromPath},
+	"POST /storages/{storage}/deltas/{path...}":    {check: checkWrite, from: fromPath},
+	"GET /storages/{storage}/reports/largest":      {check: checkRead, from: fromQuery},
+	"GET /storages/{storage}/reports/recent":       {check: checkRead, from: fromQuery},
+	"GET /storages/{storage}/reports/snapshots":    {check: checkVisible},
+	"GET /storages/{storage}/retention":            {check: checkVisible},
+	"GET /storages/{storage}/zfs":                  {check: checkVisible},
+	"POST /storages/{storage}/eject":               {check: checkWrite},
+
+	"GET /storages/{storage}/snapshots":           {check: checkVisible},
+	"POST /storages/{storage}/snapshots":          {check: checkWrite},
+	"DELETE /storages/{storage}/snapshots":        {check: checkWrite},
+	"GET /storages/{storage}/snapshots/{path...}": {check: checkVisible, from: fromPath},
+
+	"GET /storages/{storage}/trash":               {check: checkVisible},
+	"DELETE /storages/{storage}/trash":            {check: checkWrite},
+	"DELETE /storages/{storage}/trash/{id}":       {check: checkWrite},
+	"POST /storages/{storage}/trash/{id}/restore": {check: checkVisible},
+}
+
+// Methods returns the methods of all routes, e.g. for the CORS policy. GET
+// routes also serve HEAD requests.
+func Methods() []string {
+	methods := []string{}
+	for pattern := range routes {
+		method, _, _ := strings.Cut(pattern, " ")
+		methods = append(methods, method)
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	slices.Sort(methods)
+	return slices.Compact(methods)
+}
+
+// Authorize is a middleware checking that the user of a request's token may
+// access the storage and path of the route. Handlers hide the entries of
+// listings the user can't see. Without access control, all requests pass.
+func (s *Server) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := s.policy()
+		if policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route, ok := routes[r.Pattern]
+		if !ok {
+			log.Printf("No access rules for route %q, denying", r.Pattern)
+			s.sendForbidden(w, r)
+			return
+		}
+		if route.check == checkPublic {
+			// Users sending a valid token also see the details of the
+			// storages they may see, e.g. in /readyz
+			if user, err := policy.Authenticate(r); err == nil {
+				r = r.WithContext(access.NewContext(r.Context(), user))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := policy.Authenticate(r)
+		var throttled *access.ThrottledError
+		if errors.As(err, &throttled) {
+			s.recordRejected(r, "locked_out")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			s.sendError(w, problemTooManyRequests, err.Error(), r.URL.Path)
+			return
+		}
+		if err != nil {
+			s.recordRejected(r, "unauthenticated")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="timeship"`)
+			s.sendError(w, problemUnauthorized, err.Error(), r.URL.Path)
+			return
+		}
+
+		storageName := r.PathValue("storage")
+		nodePath := ""
+		switch route.from {
+		case fromPath:
+			nodePath = r.PathValue("path")
+		case fromQuery:
+			nodePath = r.URL.Query().Get("path")
+		}
+		allowed := true
+		switch route.check {
+		case checkVisible:
+			allowed = user.Visible(storageName, nodePath)
+		case checkRead:
+			allowed = user.Allowed(storageName, nodePath, access.Read)
+		case checkWrite:
+			allowed = user.Allowed(storageName, nodePath, access.Write)
+		case checkAdmin:
+			allowed = user.Covers(access.Rule{Storage: "*", Permissions: []string{access.Write}})
+		}
+		if !allowed {
+			s.sendForbidden(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(access.NewContext(r.Context(), user)))
+	})
+}
+
+// allowed reports whether the user of a request has a permission on a path,
+// always true without access control
+func (s *Server) allowed(r *http.Request, storageName, nodePath, permission string) bool {
+	if s.policy() == nil {
+		return true
+	}
+	user := access.FromContext(r.Context())
+	return user != nil && user.Allowed(storageName, nodePath, permission)
+}
+
+// visible reports whether the user of a request may see a node, always true
+// without access control
+func (s *Server) visible(r *http.Request, storageName, nodePath string) bool {
+	if s.policy() == nil {
+		return true
+	}
+	user := access.FromContext(r.Context())
+	return user != nil && user.Visible(storageName, nodePath)
+}
+
+// visibleStorageNames returns the sorted names of the storages the user of
+// a request may see
+func (s *Server) visibleStorageNames(r *http.Request) []string {
+	names := s.storageNames()
+	visible := names[:0]
+	for _, name := range names {
+		if s.visible(r, name, "") {
+			visible = append(visible, name)
+		}
+	}
+	return visible
+}
+
+// sendForbidden sends a 403 Forbidden response
+func (s *Server) sendForbidden(w http.ResponseWriter, r *http.Request) {
+	s.sendError(w, problemForbidden, "Access denied", r.URL.Path)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// byteRange is a range of bytes requested with the offset and length
+// parameters instead of a Range header
+type byteRange struct {
+	offset int64
+	// length is 0 to read to the end of the file
+	length int64
+}
+
+// parseByteRange parses the offset and length parameters of a raw content
+// request, returns nil if neither is set or they select a hexdump
+func parseByteRange(r *http.Request, params GetStoragesStorageNodesPathParams) (*byteRange, error) {
+	if params.Format != nil && *params.Format != "" {
+		return nil, nil
+	}
+	if params.Offset == nil && params.Length == nil {
+		return nil, nil
+	}
+	if (params.Lines != nil && *params.Lines != "") || (params.Bytes != nil && *params.Bytes != "") || (params.Follow != nil && *params.Follow) {
+		return nil, errors.New("offset and length can't be combined with lines, bytes or follow")
+	}
+	if r.Header.Get("Range") != "" {
+		return nil, errors.New("offset and length can't be combined with a Range header")
+	}
+
+	var rng byteRange
+	if params.Offset != nil {
+		if *params.Offset < 0 {
+			return nil, errors.New("offset must not be negative")
+		}
+		rng.offset = *params.Offset
+	}
+	if params.Length != nil {
+		if *params.Length < 1 {
+			return nil, errors.New("length must be positive")
+		}
+		rng.length = *params.Length
+	}
+	return &rng, nil
+}
+
+// header returns the range as the value of a Range header
+func (b byteRange) header() string {
+	if b.length == 0 {
+		return fmt.Sprintf("bytes=%d-", b.offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", b.offset, b.offset+b.length-1)
+}
+
+// serveByteRange sends a range of a stream that can't seek as a partial
+// response, skipping to its offset
+func (s *Server) serveByteRange(w http.ResponseWriter, r *http.Request, stream io.Reader, fileSize int64, rng byteRange) error {
+	if rng.offset >= fileSize {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", fileSize))
+		http.Error(w, "invalid range: failed to overlap", http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	length := fileSize - rng.offset
+	if rng.length > 0 {
+		length = min(length, rng.length)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.offset, rng.offset+length-1, fileSize))
+	w.WriteHeader(http.StatusPartialContent)
+	if err := skipTo(stream, rng.offset); err != nil {
+		return err
+	}
+	_, err := s.copyResponse(r.Context(), w, io.LimitReader(stream, length))
+	return err
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/activity"
+	"timeship/internal/hook"
+	"timeship/internal/jobs"
+	"timeship/internal/storage"
+	"timeship/internal/webhook"
+)
+
+// PostStoragesStorageCopies copies nodes into a destination directory. Items
+// with a snapshot are restored from it. Each item is copied on its own, so
+// failures are reported per item with 207 Multi-Status.
+func (s *Server) PostStoragesStorageCopies(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	copier, ok := store.(storage.Copier)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support copying", r.URL.Path)
+		return
+	}
+
+	var request CopyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if len(request.Items) == 0 {
+		s.sendError(w, problemBadRequest, "No items to copy", r.URL.Path)
+		return
+	}
+	opts := storage.CopyOptions{}
+	if request.Preserve != nil {
+		opts.Preserve = *request.Preserve
+	}
+
+	destination := strings.Trim(path.Clean("/"+request.Destination), "/")
+	result := CopyResult{
+		Destination: destination,
+		Results:     make([]CopyItemResult, 0, len(request.Items)),
+	}
+	for _, item := range request.Items {
+		source := strings.Trim(path.Clean("/"+item.Path), "/")
+		from := url.URL{Scheme: string(storageName), Path: source}
+		if item.Snapshot != nil && *item.Snapshot != "" {
+			from.RawQuery = url.Values{"snapshot": {*item.Snapshot}}.Encode()
+		}
+		to := url.URL{Scheme: string(storageName), Path: path.Join(destination, path.Base("/"+source))}
+
+		itemResult := CopyItemResult{
+			Source:      source,
+			Snapshot:    item.Snapshot,
+			Destination: to.Path,
+			Status:      Success,
+		}
+		// Copies from snapshots restore, others write the destination
+		op := hook.Operation{Name: hook.Write, Storage: string(storageName), Path: to.Path}
+		if from.RawQuery != "" {
+			op = hook.Operation{Name: hook.Restore, Storage: string(storageName), Path: source, Snapshot: *item.Snapshot, Destination: to.Path}
+		}
+		started := time.Now()
+		var err error
+		if !s.allowed(r, string(storageName), source, access.Read) || !s.allowed(r, string(storageName), to.Path, access.Write) {
+			err = errors.New("access denied")
+		} else {
+			err = s.beforeHooks(r.Context(), op)
+		}
+		if err == nil {
+			_, span := startStorageSpan(r.Context(), "Copy", store, from)
+			err = copier.Copy(from, to, opts)
+			endSpan(span, err)
+		}
+		if from.RawQuery != "" {
+			s.config.Jobs.Record(jobs.Restore, map[string]string{
+				"storage":     string(storageName),
+				"path":        source,
+				"snapshot":    *item.Snapshot,
+				"destination": to.Path,
+			}, tagOwner(r), started, jobs.Progress{}, err)
+		}
+		if err != nil {
+			message := err.Error()
+			itemResult.Status = Error
+			itemResult.Error = &message
+		} else {
+			result.Copied++
+			s.afterHooks(op)
+			if from.RawQuery != "" {
+				s.notify(webhook.Event{Type: webhook.NodeRestored, Storage: string(storageName), Path: source, Snapshot: *item.Snapshot, Destination: to.Path})
+				s.record(r, activity.Event{Type: activity.Restored, Storage: string(storageName), Path: to.Path, Snapshot: *item.Snapshot, From: source})
+			}
+		}
+		result.Results = append(result.Results, itemResult)
+	}
+
+	status := http.StatusOK
+	if result.Copied < len(request.Items) {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"timeship/internal/activity"
+	"timeship/internal/hook"
+	"timeship/internal/scan"
+	"timeship/internal/storage"
+	"timeship/internal/storage/jail"
+	"timeship/internal/webhook"
+)
+
+// maxNameLength is the maximum length of a node name in bytes, the common
+// limit of filesystems
+const maxNameLength = 255
+
+// illegalNameChars are characters not allowed in node names, matching the
+// CreateNodeRequest name pattern
+const illegalNameChars = `\/?%*:|"<>`
+
+// validateName checks that a single path segment is a legal node name
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name must not be empty")
+	case name == "." || name == "..":
+		return fmt.Errorf("name %q is reserved", name)
+	case len(name) > maxNameLength:
+		return fmt.Errorf("name must be at most %d bytes", maxNameLength)
+	case !utf8.ValidString(name):
+		return errors.New("name must be valid UTF-8")
+	case strings.ContainsAny(name, illegalNameChars):
+		return fmt.Errorf("name must not contain any of %s", illegalNameChars)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return errors.New("name must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// splitName validates a name of "/" separated segments and returns the segments
+func splitName(name string) ([]string, error) {
+	segments := strings.Split(strings.Trim(name, "/"), "/")
+	for _, segment := range segments {
+		if err := validateName(segment); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+func (s *Server) PostStoragesStorageNodes(w http.ResponseWriter, r *http.Request, storage Storage) {
+	// Delegate to the path-based handler with empty path
+	s.PostStoragesStorageNodesPath(w, r, storage, "")
+}
+
+// PostStoragesStorageNodesPath creates a file or directory as a child of path.
+// JSON requests create empty directories or files with optional content,
+// multipart requests upload a file.
+func (s *Server) PostStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storageName Storage, parentPath NodePath) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	creator, ok := store.(storage.Creator)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support creating nodes", r.URL.Path)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		s.uploadFile(w, r, storageName, parentPath, store, creator)
+		return
+	}
+
+	var request CreateNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if request.Type != Dir && request.Type != File {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Invalid node type %q", request.Type), r.URL.Path)
+		return
+	}
+	if request.Type == Dir && request.Content != nil {
+		s.sendError(w, problemBadRequest, "Directories can't have content", r.URL.Path)
+		return
+	}
+
+	vfPath, ok := s.prepareCreate(w, r, storageName, parentPath, request.Name, creator)
+	if !ok {
+		return
+	}
+
+	switch {
+	case request.Type == Dir:
+		err = creator.CreateDirectory(vfPath)
+	case request.Content != nil:
+		err = s.writeNew(r.Context(), store, vfPath, strings.NewReader(*request.Content))
+	default:
+		err = creator.CreateFile(vfPath)
+	}
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	s.sendCreated(w, r, store, vfPath, request.Name, request.Type)
+}
+
+// uploadFile handles a multipart file upload. The optional "name" field must
+// precede the "file" field, so the upload can be streamed to the storage.
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request, storageName Storage, parentPath string, store storage.Storage, creator storage.Creator) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.sendError(w, problemBadRequest, "Invalid multipart body: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	name := ""
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			s.sendError(w, problemBadRequest, "Missing file field", r.URL.Path)
+			return
+		}
+		if err != nil {
+			s.sendError(w, problemBadRequest, "Invalid multipart body: "+err.Error(), r.URL.Path)
+			return
+		}
+
+		if part.FormName() == "name" {
+			value, err := io.ReadAll(io.LimitReader(part, maxNameLength*16))
+			if err != nil {
+				s.sendError(w, problemBadRequest, "Invalid name field: "+err.Error(), r.URL.Path)
+				return
+			}
+			name = string(value)
+			continue
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		if name == "" {
+			name = part.FileName()
+		}
+
+		vfPath, ok := s.prepareCreate(w, r, storageName, parentPath, name, creator)
+		if !ok {
+			return
+		}
+
+		if err := s.writeNew(r.Context(), store, vfPath, s.newDeadlineReader(w, part)); err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		s.notify(webhook.Event{Type: webhook.UploadCompleted, Storage: string(storageName), Path: extractPath(vfPath)})
+		s.record(r, activity.Event{Type: activity.Uploaded, Storage: string(storageName), Path: extractPath(vfPath)})
+
+		s.sendCreated(w, r, store, vfPath, name, File)
+		return
+	}
+}
+
+// prepareCreate validates the name of a new node and creates missing
+// intermediate directories. Returns the path of the new node, or false if an
+// error response was sent.
+func (s *Server) prepareCreate(w http.ResponseWriter, r *http.Request, storageName Storage, parentPath string, name string, creator storage.Creator) (url.URL, bool) {
+	segments, err := splitName(name)
+	if err != nil {
+		s.sendError(w, problemBadRequest, "Invalid name: "+err.Error(), r.URL.Path)
+		return url.URL{}, false
+	}
+
+	vfPath := url.URL{
+		Scheme: string(storageName),
+		Path:   strings.Trim(parentPath, "/"),
+	}
+
+	// Create missing intermediate directories like mkdir -p
+	for _, segment := range segments[:len(segments)-1] {
+		vfPath.Path = path.Join(vfPath.Path, segment)
+		if err := creator.CreateDirectory(vfPath); err != nil && !errors.Is(err, fs.ErrExist) {
+			s.sendStorageError(w, r, err)
+			return url.URL{}, false
+		}
+	}
+
+	vfPath.Path = path.Join(vfPath.Path, segments[len(segments)-1])
+	return vfPath, true
+}
+
+// writeNew writes the content of a new file, failing if the node already exists
+func (s *Server) writeNew(ctx context.Context, store storage.Storage, vfPath url.URL, content io.Reader) error {
+	// Storages creating files atomically fail if the node exists themselves.
+	// Jails only do if the storage they're a view of does.
+	base := store
+	if j, ok := store.(*jail.Storage); ok {
+		base = j.Base()
+	}
+	exclusive, ok := store.(storage.ExclusiveWriter)
+	if _, baseOK := base.(storage.ExclusiveWriter); ok && baseOK {
+		return s.writeContent(ctx, newFileWriter{exclusive}, vfPath, content)
+	}
+
+	writer, ok := store.(storage.Writer)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+
+	// Writes replace existing files, so check for conflicts first. Nodes
+	// created between the check and the write are replaced.
+	if existence, ok := store.(storage.Existence); ok {
+		fileExists, err := existence.FileExists(vfPath)
+		if err != nil {
+			return err
+		}
+		dirExists, err := existence.DirectoryExists(vfPath)
+		if err != nil {
+			return err
+		}
+		if fileExists || dirExists {
+			return &fs.PathError{Op: "create", Path: vfPath.Path, Err: fs.ErrExist}
+		}
+	}
+
+	return s.writeContent(ctx, writer, vfPath, content)
+}
+
+// newFileWriter writes through WriteNew, so writeContent fails instead of
+// replacing existing files
+type newFileWriter struct {
+	writer storage.ExclusiveWriter
+}
+
+func (w newFileWriter) WriteStream(path url.URL, r io.Reader) error {
+	return w.writer.WriteNew(path, r)
+}
+
+// writeContent writes content from a client, running the write hooks around
+// it. With a scanner, the content is scanned while it's written, and
+// infected content fails the write before it's committed.
+func (s *Server) writeContent(ctx context.Context, writer storage.Writer, vfPath url.URL, content io.Reader) error {
+	op := hook.Operation{Name: hook.Write, Storage: vfPath.Scheme, Path: extractPath(vfPath)}
+	if err := s.beforeHooks(ctx, op); err != nil {
+		return err
+	}
+	if s.config.Scanner != nil {
+		sr := scan.NewReader(ctx, s.config.Scanner, content)
+		defer sr.Close()
+		content = sr
+	}
+	err := writer.WriteStream(vfPath, content)
+	if errors.As(err, new(*scan.InfectedError)) {
+		log.Printf("Rejected infected content for %s: %v", vfPath.String(), err)
+	}
+	if err != nil {
+		return err
+	}
+	s.afterHooks(op)
+	return nil
+}
+
+// sendCreated sends a 201 Created response describing the new node
+func (s *Server) sendCreated(w http.ResponseWriter, r *http.Request, store storage.Storage, vfPath url.URL, name string, nodeType NodeType) {
+	node := describeNode(store, vfPath, nodeType)
+
+	location := strings.TrimSuffix(r.URL.Path, "/")
+	for _, segment := range strings.Split(strings.Trim(name, "/"), "/") {
+		location += "/" + url.PathEscape(segment)
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(node)
+}
+
+// describeNode describes a node that was just created or updated
+func describeNode(store storage.Storage, vfPath url.URL, nodeType NodeType) Node {
+	nodePath := extractPath(vfPath)
+	basename := path.Base(nodePath)
+
+	node := Node{
+		Path:     nodePath,
+		Type:     nodeType,
+		Basename: basename,
+	}
+	if nodeType == File {
+		if idx := strings.LastIndex(basename, "."); idx > 0 {
+			node.Extension = basename[idx+1:]
+		}
+		if reader, ok := store.(storage.Reader); ok {
+			if size, err := reader.FileSize(vfPath); err == nil {
+				node.FileSize = size
+			}
+			if mimeType, err := reader.MimeType(vfPath); err == nil && mimeType != "" {
+				node.MimeType = &mimeType
+			}
+		}
+	}
+	if stater, ok := store.(storage.Stater); ok {
+		lastModified, err := stater.LastModified(vfPath)
+		if err != nil {
+			log.Printf("Failed to get last modified time for %s: %v", vfPath.String(), err)
+		}
+		node.LastModified = lastModified
+	}
+	return node
+}
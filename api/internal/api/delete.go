@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"timeship/internal/activity"
+	"timeship/internal/hook"
+	"timeship/internal/storage"
+	"timeship/internal/webhook"
+)
+
+// DeleteStoragesStorageNodesPath handles deleting a file or directory.
+// Directories are deleted recursively unless recursive=false is given,
+// in which case only empty directories can be deleted.
+func (s *Server) DeleteStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storageName Storage, path NodePath, params DeleteStoragesStorageNodesPathParams) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	if path == "" {
+		s.sendError(w, problemBadRequest, "Cannot delete the storage root", r.URL.Path)
+		return
+	}
+
+	deleter, ok := store.(storage.Deleter)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support deleting", r.URL.Path)
+		return
+	}
+
+	vfPath := url.URL{
+		Scheme: string(storageName),
+		Path:   path,
+	}
+
+	op := hook.Operation{Name: hook.Delete, Storage: string(storageName), Path: extractPath(vfPath)}
+	if err := s.beforeHooks(r.Context(), op); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	recursive := params.Recursive == nil || *params.Recursive
+	if recursive {
+		err = deleter.DeleteDirectory(vfPath)
+	} else {
+		err = deleter.Delete(vfPath)
+	}
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	s.notify(webhook.Event{Type: webhook.NodeDeleted, Storage: string(storageName), Path: extractPath(vfPath)})
+	s.record(r, activity.Event{Type: activity.Deleted, Storage: string(storageName), Path: extractPath(vfPath)})
+	s.afterHooks(op)
+
+	w.WriteHeader(http.StatusNoContent)
+}
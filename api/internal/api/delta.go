@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"timeship/internal/rsync"
+	"timeship/internal/storage"
+)
+
+// GetStoragesStorageSignaturesPath sends the librsync signature of a file,
+// to compute a delta against
+func (s *Server) GetStoragesStorageSignaturesPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath, params GetStoragesStorageSignaturesPathParams) {
+	ctx := r.Context()
+	store, err := s.getStorage(ctx, string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support reading files", r.URL.Path)
+		return
+	}
+	blockSize := rsync.DefaultBlockSize
+	if params.BlockSize != nil {
+		blockSize = *params.BlockSize
+	}
+	if blockSize < rsync.MinBlockSize || blockSize > rsync.MaxBlockSize {
+		s.sendError(w, problemBadRequest, "block_size must be between 256 and 1048576", r.URL.Path)
+		return
+	}
+
+	vfPath := url.URL{Scheme: string(storageName), Path: strings.Trim(nodePath, "/")}
+	if !s.isFile(w, r, store, vfPath) {
+		return
+	}
+	etag := fileETag(ctx, reader, vfPath)
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// The signature is sent as it's computed, through the limits of
+	// downloads
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(rsync.WriteSignature(pw, stream, blockSize))
+	}()
+	if _, err := s.copyResponse(ctx, w, pr); err != nil {
+		// Headers are already sent, so errors can only be logged
+		log.Printf("Failed to send signature of %s: %v", vfPath.String(), err)
+	}
+	pr.Close()
+	<-done
+}
+
+// PostStoragesStorageDeltasPath applies a librsync delta to a file and
+// replaces the file with the result
+func (s *Server) PostStoragesStorageDeltasPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath, params PostStoragesStorageDeltasPathParams) {
+	ctx := r.Context()
+	store, err := s.getStorage(ctx, string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	reader, canRead := store.(storage.Reader)
+	writer, canWrite := store.(storage.Writer)
+	if !canRead || !canWrite {
+		s.sendError(w, problemNotSupported, "Storage does not support reading and writing files", r.URL.Path)
+		return
+	}
+
+	vfPath := url.URL{Scheme: string(storageName), Path: strings.Trim(nodePath, "/")}
+	if !s.isFile(w, r, store, vfPath) {
+		return
+	}
+
+	// Checking and writing must not interleave with other updates of the
+	// file, or both of two concurrent deltas could pass the check. The delta
+	// is received first, so a slow client doesn't hold up other updates.
+	// Others don't wait at all.
+	delta := r.Body
+	if params.IfMatch != nil {
+		tmp, err := os.CreateTemp("", "timeship-delta-*")
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		_, err = io.Copy(tmp, r.Body)
+		if err == nil {
+			_, err = tmp.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		delta = tmp
+		defer s.updateLocks.lock(vfPath)()
+	}
+	etag := fileETag(ctx, reader, vfPath)
+	if params.IfMatch != nil && !matchETag(*params.IfMatch, etag) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		s.sendError(w, problemPreconditionFailed, "The file was changed since its signature was computed", r.URL.Path)
+		return
+	}
+
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	defer stream.Close()
+	basis, ok := stream.(io.ReadSeeker)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support seeking in files", r.URL.Path)
+		return
+	}
+
+	// The file is replaced atomically, so the basis can be read while the
+	// result is written
+	pr, pw := io.Pipe()
+	var patchErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		patchErr = rsync.Patch(pw, basis, delta)
+		pw.CloseWithError(patchErr)
+	}()
+	_, span := startStorageSpan(ctx, "WriteStream", store, vfPath)
+	err = s.writeContent(ctx, writer, vfPath, pr)
+	endSpan(span, err)
+	pr.Close()
+	<-done
+	if errors.Is(patchErr, rsync.ErrInvalidDelta) {
+		s.sendError(w, problemBadRequest, patchErr.Error(), r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	if etag := fileETag(ctx, store, vfPath); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(describeNode(store, vfPath, File))
+}
+
+// isFile checks that a node isn't the root or a directory if the storage
+// can tell, and sends an error if it is
+func (s *Server) isFile(w http.ResponseWriter, r *http.Request, store storage.Storage, vfPath url.URL) bool {
+	if vfPath.Path == "" {
+		s.sendError(w, problemBadRequest, "The storage root is not a file", r.URL.Path)
+		return false
+	}
+	typ, err := nodeType(r.Context(), store, vfPath)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return false
+	}
+	if typ == "dir" {
+		s.sendError(w, problemBadRequest, "Directories have no content", r.URL.Path)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/archive"
+	"timeship/internal/storage"
+)
+
+// downloadItem is a selected node resolved in its storage
+type downloadItem struct {
+	vfPath   url.URL
+	path     string
+	snapshot string
+	// entry describes the node in the archive, its name is empty for the
+	// root
+	entry archive.Entry
+}
+
+// PostStoragesStorageDownloads streams an archive of selected files and
+// directories
+func (s *Server) PostStoragesStorageDownloads(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	ctx := r.Context()
+
+	var request DownloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if len(request.Items) == 0 {
+		s.sendError(w, problemBadRequest, "No items to download", r.URL.Path)
+		return
+	}
+	format := archive.Zip
+	if request.Format != nil {
+		format = archive.Format(*request.Format)
+	}
+	if !slices.Contains(archive.Formats, format) {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Unsupported archive format %q", format), r.URL.Path)
+		return
+	}
+	name := "download"
+	if request.Name != nil && *request.Name != "" {
+		name = *request.Name
+	}
+	if strings.ContainsAny(name, `\/?%*:|"<>`) {
+		s.sendError(w, problemBadRequest, "Invalid archive name", r.URL.Path)
+		return
+	}
+
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support reading files", r.URL.Path)
+		return
+	}
+	lister, _ := store.(storage.Lister)
+
+	// Resolve all items up front, so missing ones fail before streaming
+	items := selectDownloadItems(string(storageName), request.Items)
+	for _, item := range items {
+		if !s.allowed(r, string(storageName), item.path, access.Read) {
+			s.sendForbidden(w, r)
+			return
+		}
+	}
+	for i := range items {
+		if err := s.statDownloadItem(ctx, reader, lister, &items[i]); err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+	}
+	nameDownloadItems(items)
+	s.serveArchive(w, r, reader, lister, items, format, name)
+}
+
+// serveDirectoryArchive streams an archive of a directory, which is named
+// after the directory
+func (s *Server) serveDirectoryArchive(w http.ResponseWriter, r *http.Request, storageName Storage, dirPath string, store storage.Storage, params GetStoragesStorageNodesPathParams) {
+	format := archive.Format(*params.Format)
+	if !slices.Contains(archive.Formats, format) {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Format %q is only supported for files", format), r.URL.Path)
+		return
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support reading files", r.URL.Path)
+		return
+	}
+	lister, _ := store.(storage.Lister)
+
+	item := DownloadItem{Path: dirPath, Snapshot: params.Snapshot}
+	items := selectDownloadItems(string(storageName), []DownloadItem{item})
+	if err := s.statDownloadItem(r.Context(), reader, lister, &items[0]); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	nameDownloadItems(items)
+
+	name := getBasename(items[0].path)
+	if name == "" {
+		name = string(storageName)
+	}
+	s.serveArchive(w, r, reader, lister, items, format, name)
+}
+
+// serveArchive streams an archive of resolved items
+func (s *Server) serveArchive(w http.ResponseWriter, r *http.Request, reader storage.Reader, lister storage.Lister, items []downloadItem, format archive.Format, name string) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", format.MimeType())
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name+format.Extension()))
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent, so errors can only be logged and end the archive early
+	out := bufio.NewWriterSize(&responseStream{ctx: ctx, w: w, server: s}, copyBufferSize)
+	aw, err := archive.NewWriter(out, format)
+	if err != nil {
+		log.Printf("Failed to create archive: %v", err)
+		return
+	}
+	for _, item := range items {
+		if err := s.archiveItem(ctx, aw, reader, lister, item); err != nil {
+			log.Printf("Failed to archive %s: %v", item.vfPath.String(), err)
+			return
+		}
+	}
+	if err := aw.Close(); err != nil {
+		log.Printf("Failed to finish archive: %v", err)
+		return
+	}
+	out.Flush()
+}
+
+// selectDownloadItems cleans the requested paths and drops duplicates and
+// items already contained in a selected directory of the same source
+func selectDownloadItems(storageName string, requested []DownloadItem) []downloadItem {
+	var items []downloadItem
+	for _, req := range requested {
+		item := downloadItem{path: strings.Trim(path.Clean("/"+req.Path), "/")}
+		if req.Snapshot != nil {
+			item.snapshot = *req.Snapshot
+		}
+		item.vfPath = url.URL{Scheme: storageName, Path: item.path}
+		if item.snapshot != "" {
+			item.vfPath.RawQuery = url.Values{"snapshot": {item.snapshot}}.Encode()
+		}
+		items = append(items, item)
+	}
+
+	// Parents sort before their contents
+	slices.SortFunc(items, func(a, b downloadItem) int {
+		if c := strings.Compare(a.snapshot, b.snapshot); c != 0 {
+			return c
+		}
+		return strings.Compare(a.path, b.path)
+	})
+	var selected []downloadItem
+	for _, item := range items {
+		contained := slices.ContainsFunc(selected, func(parent downloadItem) bool {
+			return parent.snapshot == item.snapshot &&
+				(parent.path == item.path || parent.path == "" || strings.HasPrefix(item.path, parent.path+"/"))
+		})
+		if !contained {
+			selected = append(selected, item)
+		}
+	}
+	return selected
+}
+
+// statDownloadItem finds out if an item is a directory or file, with its
+// permissions and modification time from the listing of its parent
+func (s *Server) statDownloadItem(ctx context.Context, reader storage.Reader, lister storage.Lister, item *downloadItem) error {
+	if lister != nil && item.path != "" {
+		parent := item.vfPath
+		parent.Path = path.Dir(item.path)
+		if parent.Path == "." {
+			parent.Path = ""
+		}
+		nodes, err := traceStorage(ctx, "ListContents", reader, parent, lister.ListContents)
+		if err == nil {
+			for _, node := range nodes {
+				if node.Basename == path.Base(item.path) {
+					item.entry = downloadEntry(reader, node)
+					return nil
+				}
+			}
+		}
+	}
+
+	// The root and storages without listings of parents
+	if lister != nil {
+		if _, err := traceStorage(ctx, "ListContents", reader, item.vfPath, lister.ListContents); err == nil {
+			item.entry.Dir = true
+			return nil
+		}
+	}
+	size, err := traceStorage(ctx, "FileSize", reader, item.vfPath, reader.FileSize)
+	if err != nil {
+		return err
+	}
+	item.entry.Size = size
+	if stater, ok := reader.(storage.Stater); ok {
+		if lastModified, err := traceStorage(ctx, "LastModified", reader, item.vfPath, stater.LastModified); err == nil {
+			item.entry.ModTime = time.Unix(lastModified, 0)
+		}
+	}
+	return nil
+}
+
+// downloadEntry describes a node listed by a storage in an archive, without
+// its name
+func downloadEntry(store storage.Storage, node storage.FileNode) archive.Entry {
+	node.Owner, node.Group = resolveOwner(store, node)
+	entry := archive.Entry{
+		Dir:     node.Type == "dir",
+		Size:    node.Size,
+		Mode:    node.Mode,
+		ModTime: time.Unix(node.LastModified, 0),
+		Owner:   node.Owner,
+		Group:   node.Group,
+	}
+	if node.Type == "link" {
+		entry.LinkTarget = node.LinkTarget
+	}
+	return entry
+}
+
+// nameDownloadItems names the items relative to the closest directory
+// containing all of them. Items from more than one source are put in a
+// directory per source, so the same path from different snapshots doesn't
+// collide.
+func nameDownloadItems(items []downloadItem) {
+	common := ""
+	for i, item := range items {
+		parent := path.Dir(item.path)
+		if parent == "." {
+			parent = ""
+		}
+		if i == 0 {
+			common = parent
+			continue
+		}
+		for common != "" && parent != common && !strings.HasPrefix(parent, common+"/") {
+			common = path.Dir(common)
+			if common == "." {
+				common = ""
+			}
+		}
+	}
+
+	mixed := slices.ContainsFunc(items, func(item downloadItem) bool {
+		return item.snapshot != items[0].snapshot
+	})
+	for i := range items {
+		name := items[i].path
+		if common != "" {
+			name = strings.TrimPrefix(name, common+"/")
+		}
+		if mixed {
+			name = path.Join(sourceDirName(items[i].snapshot), name)
+		}
+		items[i].entry.Name = name
+	}
+}
+
+// sourceDirName returns the archive directory of items from a snapshot, or
+// from the live storage if empty
+func sourceDirName(snapshot string) string {
+	if snapshot == "" {
+		return "current"
+	}
+	return strings.NewReplacer("/", "_", ":", "_", `\`, "_").Replace(snapshot)
+}
+
+// archiveItem adds an item to an archive, with all contents of directories
+func (s *Server) archiveItem(ctx context.Context, aw archive.Writer, reader storage.Reader, lister storage.Lister, item downloadItem) error {
+	if !item.entry.Dir {
+		return s.archiveNode(ctx, aw, reader, item.vfPath, item.entry)
+	}
+
+	var walk func(u url.URL, name string) error
+	walk = func(u url.URL, name string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		nodes, err := traceStorage(ctx, "ListContents", reader, u, lister.ListContents)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			child := node.Path
+			child.RawQuery = item.vfPath.RawQuery
+			if node.Type == "link" && node.LinkTarget == "" {
+				// Links without a known target can't be restored
+				continue
+			}
+			if node.Type == "special" {
+				log.Printf("Skipping special file %s in archive", child.String())
+				continue
+			}
+			entry := downloadEntry(reader, node)
+			entry.Name = path.Join(name, node.Basename)
+			if err := s.archiveNode(ctx, aw, reader, child, entry); err != nil {
+				return err
+			}
+			if entry.Dir {
+				if err := walk(child, entry.Name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if item.entry.Name != "" {
+		if err := aw.Add(item.entry, nil); err != nil {
+			return err
+		}
+	}
+	return walk(item.vfPath, item.entry.Name)
+}
+
+// archiveNode adds a node to an archive, with the content of files
+func (s *Server) archiveNode(ctx context.Context, aw archive.Writer, reader storage.Reader, vfPath url.URL, entry archive.Entry) error {
+	if entry.Dir || entry.LinkTarget != "" {
+		return aw.Add(entry, nil)
+	}
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if errors.Is(err, storage.ErrSpecialFile) {
+		// Selected special files are skipped like the ones in directories
+		log.Printf("Skipping special file %s in archive", vfPath.String())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	return aw.Add(entry, stream)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/jobs"
+)
+
+// drainPollInterval is how often draining checks for requests and jobs
+const drainPollInterval = 100 * time.Millisecond
+
+// drainState describes a drain in progress
+type drainState struct {
+	started  time.Time
+	deadline time.Time
+}
+
+// Drain stops serving new requests and starting scheduled jobs, then waits
+// until the requests in flight and the running jobs finished, the timeout
+// passed or ctx is canceled. Health checks are still answered and report
+// that the server is draining, event streams end right away. Returns whether
+// everything finished.
+func (s *Server) Drain(ctx context.Context, timeout time.Duration) bool {
+	now := time.Now()
+	s.draining.Store(&drainState{started: now, deadline: now.Add(timeout)})
+	s.events.close()
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		requests, running := s.inFlight.Load(), s.config.Jobs.Running()
+		if requests == 0 && running == 0 {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Printf("Stopped draining with %d requests and %d jobs running", requests, running)
+			return false
+		}
+	}
+}
+
+// drain returns the drain in progress, nil if the server isn't draining
+func (s *Server) drain() *drainState {
+	return s.draining.Load()
+}
+
+// describeDrain converts a drain to its API representation
+func (s *Server) describeDrain(d *drainState) DrainStatus {
+	return DrainStatus{
+		Started:  d.started.Unix(),
+		Deadline: d.deadline.Unix(),
+		Requests: s.inFlight.Load(),
+		Jobs:     int64(s.config.Jobs.Running()),
+	}
+}
+
+// rejectDraining answers a request that came in while draining, asking the
+// client to retry on another instance or after the restart
+func (s *Server) rejectDraining(w http.ResponseWriter, r *http.Request, d *drainState) {
+	retry := max(1, int(time.Until(d.deadline).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	w.Header().Set("Connection", "close")
+	s.sendError(w, problemServiceUnavailable, "Server is shutting down", r.URL.Path)
+}
+
+// resumeJobs starts the jobs interrupted by the last shutdown again from the
+// beginning. Only jobs of the actions of scheduled tasks can be resumed,
+// like exports. Jobs that can't be resumed are marked as failed.
+func (s *Server) resumeJobs() {
+	interrupted, err := s.config.JobHistory.List(jobs.Query{State: jobs.Interrupted, Limit: 1000})
+	if err != nil {
+		log.Printf("Failed to list interrupted jobs: %v", err)
+		return
+	}
+	// Resume the oldest first
+	for i := len(interrupted) - 1; i >= 0; i-- {
+		job := interrupted[i]
+		task, err := taskFromParams(job.Type, job.Params)
+		var fn jobs.Func
+		if err == nil {
+			fn, err = s.taskFunc(task)
+		}
+		if err == nil {
+			fn, err = s.onBehalfOf(job, task, fn)
+		}
+		if err != nil {
+			log.Printf("Not resuming job %s (%s): %v", job.ID, job.Type, err)
+			if err := s.config.JobHistory.MarkFailed(job.ID, "Not resumed: "+err.Error()); err != nil {
+				log.Printf("Failed to mark job %s as failed: %v", job.ID, err)
+			}
+			continue
+		}
+		resumed := s.config.Jobs.Start(job.Type, job.Params, job.User, fn)
+		if err := s.config.JobHistory.MarkResumed(job.ID, resumed.ID); err != nil {
+			log.Printf("Failed to mark job %s as resumed: %v", job.ID, err)
+		}
+		log.Printf("Resumed job %s (%s) as %s", job.ID, job.Type, resumed.ID)
+	}
+}
+
+// onBehalfOf wraps the function of a resumed job started by a user, so it
+// sees the storages like the user does, e.g. only the user's home, once the
+// user is authenticated again and still may read the source and write the
+// destination. Jobs of scheduled tasks and jobs started without access
+// control run as they are.
+func (s *Server) onBehalfOf(job jobs.Job, task ScheduledTask, fn jobs.Func) (jobs.Func, error) {
+	policy := s.policy()
+	if policy == nil || job.User == "" {
+		return fn, nil
+	}
+	if job.Type != jobs.Export {
+		return nil, fmt.Errorf("%s jobs of users can't be resumed", job.Type)
+	}
+	if job.Params["via"] == "token" {
+		return nil, errors.New("started with an API token, which can't be authenticated again")
+	}
+	user := policy.Lookup(job.User)
+	if user == nil {
+		return nil, fmt.Errorf("user %s is no longer configured", job.User)
+	}
+	if !user.Allowed(task.Storage, task.Path, access.Read) || !user.Allowed(task.DestinationStorage, task.Destination, access.Write) {
+		return nil, fmt.Errorf("user %s may no longer read the source or write the destination", job.User)
+	}
+	return func(ctx context.Context, progress func(jobs.Progress)) error {
+		return fn(access.NewContext(ctx, user), progress)
+	}, nil
+}
+
+// taskFromParams returns the task a job with the action of a scheduled task
+// as its type was started for, the inverse of ScheduledTask.params
+func taskFromParams(action string, params map[string]string) (ScheduledTask, error) {
+	task := ScheduledTask{
+		Action:             action,
+		Storage:            params["storage"],
+		Path:               params["path"],
+		Snapshot:           params["snapshot"],
+		DestinationStorage: params["destination_storage"],
+		Destination:        params["destination"],
+	}
+	if task.Storage == "" {
+		return task, errors.New("storage is missing")
+	}
+	if v := params["include"]; v != "" {
+		task.Include = strings.Split(v, ",")
+	}
+	if v := params["exclude"]; v != "" {
+		task.Exclude = strings.Split(v, ",")
+	}
+	for key, d := range map[string]*time.Duration{"older_than": &task.OlderThan, "max_gap": &task.MaxGap} {
+		if v := params[key]; v != "" {
+			var err error
+			if *d, err = time.ParseDuration(v); err != nil {
+				return task, fmt.Errorf("invalid %s: %w", key, err)
+			}
+		}
+	}
+	return task, nil
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// fileETag returns a strong ETag of a file from its version, or from its
+// size and modification time, or "" if the storage knows neither
+func fileETag(ctx context.Context, store storage.Storage, vfPath url.URL) string {
+	if versioner, ok := store.(storage.Versioner); ok {
+		version, err := traceStorage(ctx, "Version", store, vfPath, versioner.Version)
+		if err != nil || version == "" {
+			return ""
+		}
+		return `"` + version + `"`
+	}
+
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		return ""
+	}
+	stater, ok := store.(storage.Stater)
+	if !ok {
+		return ""
+	}
+	size, err := traceStorage(ctx, "FileSize", store, vfPath, reader.FileSize)
+	if err != nil {
+		return ""
+	}
+	lastModified, err := traceStorage(ctx, "LastModified", store, vfPath, stater.LastModified)
+	if err != nil || lastModified <= 0 {
+		return ""
+	}
+	return `"` + strconv.FormatInt(lastModified, 36) + "-" + strconv.FormatInt(size, 36) + `"`
+}
+
+// fileModTime returns the modification time of a file, of its version in
+// the snapshot if the path has one, or the zero time if the storage doesn't
+// know it
+func fileModTime(ctx context.Context, store storage.Storage, vfPath url.URL) time.Time {
+	stater, ok := store.(storage.Stater)
+	if !ok {
+		return time.Time{}
+	}
+	lastModified, err := traceStorage(ctx, "LastModified", store, vfPath, stater.LastModified)
+	if err != nil || lastModified <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(lastModified, 0)
+}
+
+// setLastModified sets the Last-Modified header unless the time is unknown
+func setLastModified(w http.ResponseWriter, modTime time.Time) {
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified reports whether a GET or HEAD request can be answered with
+// 304 Not Modified, from If-None-Match or else If-Modified-Since
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etag != "" && matchNoneETag(inm, etag)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// listingETag returns a weak ETag of a directory listing from its nodes and
+// everything else the response depends on: the query, the credentials and
+// the visible storages
+func listingETag(r *http.Request, nodes []storage.FileNode, storages []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%q\n", r.URL.RawQuery, r.Header.Get("Authorization"), storages)
+	for _, n := range nodes {
+		fmt.Fprintf(h, "%q %s %d %d %d %o %s %s %q %s\n", n.Basename, n.Type, n.Size, n.AllocatedSize, n.LastModified, uint32(n.Mode), n.Owner, n.Group, n.LinkTarget, n.FileID)
+	}
+	return `W/"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// matchNoneETag reports whether an If-None-Match header matches an ETag,
+// comparing weakly as RFC 9110 requires
+func matchNoneETag(ifNoneMatch string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// matchETag reports whether an If-Match header matches an ETag. Weak ETags
+// never match, as If-Match uses strong comparison.
+func matchETag(ifMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || (etag != "" && candidate == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRange reports whether the Range of a request may be served for a file
+// with an ETag and modification time, or whether the file changed since the
+// client got the part it resumes from and has to be sent whole. Only a strong
+// ETag validates, and a date only once the second of the modification time is
+// over, as a file still being written could change again within it.
+func ifRange(r *http.Request, etag string, modTime time.Time) bool {
+	validator := strings.TrimSpace(r.Header.Get("If-Range"))
+	if validator == "" {
+		return true
+	}
+	if strings.HasPrefix(validator, `"`) || strings.HasPrefix(validator, "W/") {
+		return etag != "" && !strings.HasPrefix(etag, "W/") && validator == etag
+	}
+	date, err := http.ParseTime(validator)
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	modTime = modTime.Truncate(time.Second)
+	return modTime.Equal(date) && time.Since(modTime) > time.Second
+}
+
+// checkPreconditions checks If-Match, or else If-Unmodified-Since, against
+// the current state of an existing node. Returns false if the node changed
+// since the client read it. The ETag is empty for directories.
+func checkPreconditions(ctx context.Context, store storage.Storage, vfPath url.URL, etag string, params PatchStoragesStorageNodesPathParams) bool {
+	if params.IfMatch != nil {
+		return matchETag(*params.IfMatch, etag)
+	}
+	if params.IfUnmodifiedSince == nil {
+		return true
+	}
+	since, err := http.ParseTime(*params.IfUnmodifiedSince)
+	if err != nil {
+		// Invalid dates are ignored, as required by RFC 9110
+		return true
+	}
+	stater, ok := store.(storage.Stater)
+	if !ok {
+		return true
+	}
+	lastModified, err := traceStorage(ctx, "LastModified", store, vfPath, stater.LastModified)
+	if err != nil {
+		return false
+	}
+	return lastModified <= since.Unix()
+}
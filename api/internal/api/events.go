@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"timeship/internal/webhook"
+)
+
+// eventKeepAlive is how often an idle event stream gets a comment, so
+// proxies don't close it
+const eventKeepAlive = 30 * time.Second
+
+// eventBuffer is how many events wait for a slow client before its stream
+// is ended, so it reconnects and lists the storages again
+const eventBuffer = 16
+
+// storageEvents delivers storage changes to the subscribed streams
+type storageEvents struct {
+	mu          sync.Mutex
+	subscribers map[chan StorageEvent]bool
+	// closed is set when the server drains, ending all streams
+	closed bool
+}
+
+// subscribe returns a channel receiving the events until unsubscribed, which
+// is closed when the stream should end
+func (e *storageEvents) subscribe() (chan StorageEvent, func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ch := make(chan StorageEvent, eventBuffer)
+	if e.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if e.subscribers == nil {
+		e.subscribers = map[chan StorageEvent]bool{}
+	}
+	e.subscribers[ch] = true
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.subscribers[ch] {
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends an event to all subscribers, dropping those that fell behind
+func (e *storageEvents) publish(event StorageEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// close ends all streams and new ones right away
+func (e *storageEvents) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	for ch := range e.subscribers {
+		close(ch)
+	}
+	e.subscribers = nil
+}
+
+// storagesChanged notifies streams and webhooks about added and removed
+// storages
+func (s *Server) storagesChanged(added, removed []string) {
+	now := time.Now().UTC()
+	for _, name := range removed {
+		s.events.publish(StorageEvent{Event: webhook.StorageRemoved, Storage: name, Time: now})
+		s.notify(webhook.Event{Type: webhook.StorageRemoved, Storage: name})
+	}
+	for _, name := range added {
+		s.events.publish(StorageEvent{Event: webhook.StorageAdded, Storage: name, Time: now})
+		s.notify(webhook.Event{Type: webhook.StorageAdded, Storage: name})
+	}
+}
+
+// GetStoragesEvents streams the storages added and removed as Server-Sent
+// Events until the client goes away or the server drains
+func (s *Server) GetStoragesEvents(w http.ResponseWriter, r *http.Request) {
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	// The write deadline is extended before each write, so waiting for
+	// events doesn't count towards it
+	write := func(format string, args ...any) error {
+		if s.config.WriteTimeout > 0 {
+			err := rc.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !s.visible(r, event.Storage, "") {
+				continue
+			}
+			data, _ := json.Marshal(event)
+			err = write("event: %s\ndata: %s\n\n", event.Event, data)
+		case <-keepAlive.C:
+			err = write(": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && r.Context().Err() == nil {
+				log.Printf("Failed to stream events: %v", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"timeship/internal/bundle"
+)
+
+// GetAdminExport returns a bundle of the configuration, the tokens and the
+// tags and bookmarks
+func (s *Server) GetAdminExport(w http.ResponseWriter, r *http.Request) {
+	if s.config.ExportConfig == nil {
+		s.sendError(w, problemFeatureDisabled, "Exporting is not supported", r.URL.Path)
+		return
+	}
+	config, err := s.config.ExportConfig()
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to export config: "+err.Error(), r.URL.Path)
+		return
+	}
+	b, err := bundle.Export(config, s.config.Tokens, s.config.Tags)
+	if err != nil {
+		s.sendError(w, problemInternal, err.Error(), r.URL.Path)
+		return
+	}
+
+	name := "timeship-" + time.Unix(b.CreatedAt, 0).UTC().Format("20060102-150405") + ".json"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	b.Write(w)
+}
+
+// PostAdminImport adds the tokens, tags and bookmarks of a bundle to the
+// stores. The configuration of the bundle isn't applied.
+func (s *Server) PostAdminImport(w http.ResponseWriter, r *http.Request) {
+	b, err := bundle.Read(r.Body)
+	if err != nil {
+		s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+		return
+	}
+	counts, err := b.Import(s.config.Tokens, s.config.Tags)
+	if err != nil {
+		s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ImportResult{
+		Tokens:    counts.Tokens,
+		Tags:      counts.Tags,
+		Bookmarks: counts.Bookmarks,
+	})
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"sync"
+
+	"timeship/internal/imagemeta"
+	"timeship/internal/pdfpreview"
+	"timeship/internal/storage"
+)
+
+// fileMetadataWorkers is how many files of a listing are read at once for
+// metadata fields
+const fileMetadataWorkers = 8
+
+// maxBufferedPDF is the largest PDF of a storage without seekable streams
+// that is read into memory to count its pages
+const maxBufferedPDF = 16 << 20
+
+// readListing calls read concurrently for the files of a directory listing
+// that match. Nodes are read from dir, which may select a snapshot.
+func readListing(ctx context.Context, dir url.URL, nodes []storage.FileNode, match func(storage.FileNode) bool, read func(child url.URL, node storage.FileNode)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, fileMetadataWorkers)
+	for _, node := range nodes {
+		if node.Type != "file" || !match(node) {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		child := dir
+		child.Path = node.Path.Path
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			read(child, node)
+		}()
+	}
+	wg.Wait()
+}
+
+// imageMetadata reads the metadata of the images in a directory listing,
+// keyed by basename
+func imageMetadata(ctx context.Context, store storage.Storage, dir url.URL, nodes []storage.FileNode) map[string]*ImageMetadata {
+	result := map[string]*ImageMetadata{}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		return result
+	}
+
+	var mu sync.Mutex
+	isImage := func(node storage.FileNode) bool {
+		return imagemeta.Supported(node.Basename, node.MimeType)
+	}
+	readListing(ctx, dir, nodes, isImage, func(child url.URL, node storage.FileNode) {
+		if m := readImageMetadata(ctx, reader, child); m != nil {
+			mu.Lock()
+			result[node.Basename] = m
+			mu.Unlock()
+		}
+	})
+	return result
+}
+
+// pageCounts reads the page counts of the PDFs in a directory listing, keyed
+// by basename
+func pageCounts(ctx context.Context, store storage.Storage, dir url.URL, nodes []storage.FileNode) map[string]int {
+	result := map[string]int{}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		return result
+	}
+
+	var mu sync.Mutex
+	isPDF := func(node storage.FileNode) bool {
+		return pdfpreview.Supported(node.Basename, node.MimeType)
+	}
+	readListing(ctx, dir, nodes, isPDF, func(child url.URL, node storage.FileNode) {
+		if count := readPageCount(ctx, reader, child, node.Size); count > 0 {
+			mu.Lock()
+			result[node.Basename] = count
+			mu.Unlock()
+		}
+	})
+	return result
+}
+
+// readPageCount reads the page count of a PDF, or returns 0 if it can't be
+// read
+func readPageCount(ctx context.Context, reader storage.Reader, vfPath url.URL, size int64) int {
+	if ctx.Err() != nil {
+		return 0
+	}
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		log.Printf("Failed to open %s: %v", vfPath.String(), err)
+		return 0
+	}
+	defer stream.Close()
+
+	// Page counts are read from the end of the file, so they need random
+	// access
+	var r io.ReaderAt
+	switch s := stream.(type) {
+	case io.ReaderAt:
+		r = s
+	case io.ReadSeeker:
+		r = &seekReaderAt{rs: s}
+	default:
+		if size > maxBufferedPDF {
+			return 0
+		}
+		content, err := io.ReadAll(stream)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", vfPath.String(), err)
+			return 0
+		}
+		r = bytes.NewReader(content)
+	}
+
+	count, err := pdfpreview.PageCount(r, size)
+	if err != nil {
+		log.Printf("Failed to count pages of %s: %v", vfPath.String(), err)
+		return 0
+	}
+	return count
+}
+
+// seekReaderAt provides random access to a seekable stream
+type seekReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (r *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readImageMetadata reads the metadata of an image, or returns nil if it has
+// none
+func readImageMetadata(ctx context.Context, reader storage.Reader, vfPath url.URL) *ImageMetadata {
+	if ctx.Err() != nil {
+		return nil
+	}
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		log.Printf("Failed to open %s: %v", vfPath.String(), err)
+		return nil
+	}
+	defer stream.Close()
+
+	m, err := imagemeta.Read(stream)
+	if err != nil {
+		if !errors.Is(err, imagemeta.ErrNoMetadata) {
+			log.Printf("Failed to read image metadata of %s: %v", vfPath.String(), err)
+		}
+		return nil
+	}
+	return toImageMetadata(m)
+}
+
+// toImageMetadata converts metadata to its API representation, leaving out
+// unknown fields
+func toImageMetadata(m imagemeta.Metadata) *ImageMetadata {
+	var result ImageMetadata
+	if m.Width > 0 && m.Height > 0 {
+		result.Width = &m.Width
+		result.Height = &m.Height
+	}
+	if !m.DateTaken.IsZero() {
+		dateTaken := m.DateTaken.Format("2006-01-02T15:04:05")
+		result.DateTaken = &dateTaken
+	}
+	if m.CameraMake != "" {
+		result.CameraMake = &m.CameraMake
+	}
+	if m.CameraModel != "" {
+		result.CameraModel = &m.CameraModel
+	}
+	if m.Orientation >= 1 && m.Orientation <= 8 {
+		result.Orientation = &m.Orientation
+	}
+	if m.HasLocation {
+		result.Latitude = &m.Latitude
+		result.Longitude = &m.Longitude
+	}
+	return &result
+}
+
+// nodeTimes reads the birth and change times of the nodes in a directory
+// listing, keyed by basename
+func nodeTimes(ctx context.Context, store storage.Storage, dir url.URL, nodes []storage.FileNode) map[string]storage.NodeTimes {
+	result := map[string]storage.NodeTimes{}
+	if _, ok := store.(storage.TimeStater); !ok {
+		return result
+	}
+	for _, node := range nodes {
+		if ctx.Err() != nil {
+			break
+		}
+		child := dir
+		child.Path = node.Path.Path
+		result[node.Basename] = readNodeTimes(ctx, store, child)
+	}
+	return result
+}
+
+// readNodeTimes reads the birth and change times of a node, zero where they
+// can't be read
+func readNodeTimes(ctx context.Context, store storage.Storage, vfPath url.URL) storage.NodeTimes {
+	stater, ok := store.(storage.TimeStater)
+	if !ok {
+		return storage.NodeTimes{}
+	}
+	times, err := traceStorage(ctx, "NodeTimes", store, vfPath, stater.NodeTimes)
+	if err != nil {
+		log.Printf("Failed to get times of %s: %v", vfPath.String(), err)
+		return storage.NodeTimes{}
+	}
+	return times
+}
+
+// setTimes adds the known birth and change times to a node
+func setTimes(apiNode *Node, times storage.NodeTimes) {
+	if times.Created > 0 {
+		apiNode.Created = &times.Created
+	}
+	if times.Changed > 0 {
+		apiNode.Changed = &times.Changed
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// followTailLines is how many lines are sent before following a file without
+// a range, the same as tail -f
+const followTailLines = 10
+
+// serveFollow streams a file as it grows until the client goes away. The
+// stream starts at the open-ended range given with lines or bytes, or at the
+// last lines of the file.
+func (s *Server) serveFollow(w http.ResponseWriter, r *http.Request, vfPath url.URL, store storage.Storage, mimeType string, fileSize int64, preview *previewRange) {
+	ctx := r.Context()
+
+	follower, ok := store.(storage.Follower)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support following files", r.URL.Path)
+		return
+	}
+	if vfPath.Query().Get("snapshot") != "" {
+		s.sendError(w, problemBadRequest, "Snapshots don't change, so they can't be followed", r.URL.Path)
+		return
+	}
+	rng := previewRange{lines: true, tail: followTailLines}
+	if preview != nil {
+		rng = *preview
+	}
+	if rng.tail == 0 && rng.end >= 0 {
+		s.sendError(w, problemBadRequest, "Following requires a range without an end, like 100- or -100", r.URL.Path)
+		return
+	}
+
+	_, span := startStorageSpan(ctx, "FollowStream", store, vfPath)
+	stream, err := follower.FollowStream(vfPath)
+	endSpan(span, err)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	defer stream.Close()
+	// Closing the stream stops reads waiting for more content
+	stop := context.AfterFunc(ctx, func() { stream.Close() })
+	defer stop()
+
+	var content io.Reader = stream
+	switch {
+	case rng.lines && rng.tail > 0:
+		offset, err := tailOffset(stream, fileSize, rng.tail)
+		if err == nil {
+			_, err = stream.Seek(offset, io.SeekStart)
+		}
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+	case rng.lines:
+		// Lines that weren't written yet are waited for, like tail -n +N -f
+		br := bufio.NewReaderSize(stream, copyBufferSize)
+		if err := skipLines(br, rng.start-1); err != nil {
+			if ctx.Err() == nil {
+				s.sendStorageError(w, r, err)
+			}
+			return
+		}
+		content = br
+	default:
+		offset := rng.start
+		if rng.tail > 0 {
+			offset = max(0, fileSize-rng.tail)
+		}
+		if _, err := stream.Seek(offset, io.SeekStart); err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+	}
+
+	s.setContentType(w, mimeType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if err := s.copyFollowed(w, content); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to follow %s: %v", vfPath.String(), err)
+	}
+}
+
+// copyFollowed copies a followed stream to the response, flushing whatever
+// was read right away. The write deadline is extended before each write, so
+// waiting for content doesn't count towards it.
+func (s *Server) copyFollowed(w http.ResponseWriter, stream io.Reader) error {
+	rc := http.NewResponseController(w)
+	rc.Flush()
+
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+	for {
+		n, err := stream.Read(*buf)
+		if n > 0 {
+			if s.config.WriteTimeout > 0 {
+				err := rc.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+				if err != nil && !errors.Is(err, http.ErrNotSupported) {
+					return err
+				}
+			}
+			if _, err := w.Write((*buf)[:n]); err != nil {
+				return err
+			}
+			rc.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
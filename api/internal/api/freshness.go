@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"timeship/internal/storage"
+	"timeship/internal/webhook"
+)
+
+// defaultFreshnessInterval is how often snapshot freshness is checked if not
+// configured
+const defaultFreshnessInterval = 5 * time.Minute
+
+// freshness is the result of checking the newest snapshot of a storage
+type freshness struct {
+	storage string
+	maxAge  time.Duration
+	// newest is when the newest snapshot was taken, zero without snapshots
+	newest time.Time
+	// checked is when the snapshots were listed, zero until the first check
+	checked time.Time
+	err     error
+}
+
+// stale reports whether the storage has no snapshot newer than its maximum
+// age. Storages that weren't checked yet aren't stale.
+func (f freshness) stale(now time.Time) bool {
+	if f.checked.IsZero() {
+		return false
+	}
+	return f.err != nil || f.newest.IsZero() || now.Sub(f.newest) > f.maxAge
+}
+
+// freshnessMonitor periodically checks that the monitored storages have a
+// recent snapshot
+type freshnessMonitor struct {
+	// checking keeps checks from overlapping
+	checking sync.Mutex
+
+	mu     sync.Mutex
+	status map[string]freshness
+	// alerted are the storages a missing snapshot was notified for, until
+	// they have a recent snapshot again
+	alerted map[string]bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startFreshnessMonitor checks the storages with a maximum snapshot age
+// right away and then periodically until the server is closed
+func (s *Server) startFreshnessMonitor() {
+	m := &freshnessMonitor{
+		status:  map[string]freshness{},
+		alerted: map[string]bool{},
+		stop:    make(chan struct{}),
+	}
+	for name, maxAge := range s.config.SnapshotMaxAge {
+		m.status[name] = freshness{storage: name, maxAge: maxAge}
+	}
+	s.freshness = m
+
+	interval := s.config.FreshnessInterval
+	if interval <= 0 {
+		interval = defaultFreshnessInterval
+	}
+	m.wg.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.checkFreshness()
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+		}
+	})
+}
+
+// close stops checking and waits for a running check to finish
+func (m *freshnessMonitor) close() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// checkFreshness lists the snapshots of the monitored storages and notifies
+// once when a storage has no recent snapshot
+func (s *Server) checkFreshness() {
+	m := s.freshness
+	m.checking.Lock()
+	defer m.checking.Unlock()
+	for name, maxAge := range s.config.SnapshotMaxAge {
+		f := freshness{storage: name, maxAge: maxAge}
+		f.newest, f.err = s.newestSnapshotTime(name)
+		f.checked = time.Now()
+
+		m.mu.Lock()
+		m.status[name] = f
+		stale := f.stale(f.checked)
+		alert := stale && !m.alerted[name]
+		recovered := !stale && m.alerted[name]
+		m.alerted[name] = stale
+		m.mu.Unlock()
+
+		switch {
+		case alert:
+			event := webhook.Event{Type: webhook.SnapshotMissing, Storage: name}
+			switch {
+			case f.err != nil:
+				event.Error = f.err.Error()
+			case f.newest.IsZero():
+				event.Error = "no snapshots"
+			default:
+				since := f.newest.UTC()
+				event.Since = &since
+			}
+			log.Printf("No snapshot of %s newer than %s", name, maxAge)
+			s.notify(event)
+		case recovered:
+			log.Printf("Snapshots of %s are recent again", name)
+		}
+	}
+}
+
+// newestSnapshotTime returns when the newest snapshot of a storage was taken,
+// zero if it has none
+func (s *Server) newestSnapshotTime(name string) (time.Time, error) {
+	store, err := s.getStorage(context.Background(), name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	lister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		return time.Time{}, fmt.Errorf("snapshots: %w", storage.ErrNotSupported)
+	}
+	snapshots, err := lister.ListSnapshots(url.URL{Scheme: name})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var newest int64
+	for _, snap := range snapshots {
+		newest = max(newest, snap.Timestamp)
+	}
+	if newest == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(newest, 0), nil
+}
+
+// snapshotFreshness returns the results of the last checks sorted by
+// storage name, nil without monitored storages
+func (s *Server) snapshotFreshness() []freshness {
+	m := s.freshness
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]freshness, 0, len(m.status))
+	for _, f := range m.status {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].storage < list[j].storage })
+	return list
+}
+
+// describeFreshness converts a check result to its API representation
+func describeFreshness(f freshness, now time.Time) SnapshotFreshness {
+	sf := SnapshotFreshness{
+		Storage:       f.storage,
+		MaxAgeSeconds: int64(f.maxAge / time.Second),
+		Stale:         f.stale(now),
+	}
+	if !f.newest.IsZero() {
+		newest := f.newest.Unix()
+		sf.Newest = &newest
+	}
+	if !f.checked.IsZero() {
+		checked := f.checked.Unix()
+		sf.Checked = &checked
+	}
+	if f.err != nil {
+		msg := f.err.Error()
+		sf.Error = &msg
+	}
+	return sf
+}
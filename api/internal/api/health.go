@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// defaultReadinessTimeout limits storage readiness checks if not configured
+const defaultReadinessTimeout = 5 * time.Second
+
+// GetHealthz reports that the server is alive and whether the monitored
+// storages have recent snapshots. The freshness of each storage is only
+// included for the storages the user may see, the status covers all.
+func (s *Server) GetHealthz(w http.ResponseWriter, r *http.Request) {
+	health := HealthStatus{Status: HealthStatusStatusOk}
+	status := http.StatusOK
+	if checks := s.snapshotFreshness(); checks != nil {
+		now := time.Now()
+		snapshots := []SnapshotFreshness{}
+		for _, f := range checks {
+			freshness := describeFreshness(f, now)
+			if freshness.Stale {
+				health.Status = HealthStatusStatusStale
+				status = http.StatusServiceUnavailable
+			}
+			if s.visible(r, f.storage, "") {
+				snapshots = append(snapshots, freshness)
+			}
+		}
+		health.Snapshots = &snapshots
+	}
+	// Draining servers pass, so they aren't restarted before they finished
+	if d := s.drain(); d != nil {
+		drain := s.describeDrain(d)
+		health.Status = HealthStatusStatusDraining
+		health.Drain = &drain
+		status = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
+
+// GetMetrics returns metrics in the Prometheus text format. Metrics of a
+// storage are only included if the user may see it.
+func (s *Server) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	version := s.config.Build.Version
+	if version == "" {
+		version = "dev"
+	}
+	writeMetric(&b, "timeship_build_info", "Build information of the server", []string{
+		fmt.Sprintf("{version=%s,go_version=%s} 1", metricLabel(version), metricLabel(runtime.Version())),
+	})
+
+	writeCounter(&b, "timeship_auth_rejected_total", "Requests rejected for invalid tokens or lockouts", []string{
+		fmt.Sprintf("{reason=\"locked_out\"} %d", s.lockedOut.Load()),
+		fmt.Sprintf("{reason=\"unauthenticated\"} %d", s.unauthenticated.Load()),
+	})
+
+	if checks := s.snapshotFreshness(); checks != nil {
+		now := time.Now()
+		var newest, maxAge, checked, stale []string
+		for _, f := range checks {
+			if !s.visible(r, f.storage, "") {
+				continue
+			}
+			storage := "{storage=" + metricLabel(f.storage) + "} "
+			if !f.newest.IsZero() {
+				newest = append(newest, storage+strconv.FormatInt(f.newest.Unix(), 10))
+			}
+			maxAge = append(maxAge, storage+strconv.FormatInt(int64(f.maxAge/time.Second), 10))
+			if !f.checked.IsZero() {
+				checked = append(checked, storage+strconv.FormatInt(f.checked.Unix(), 10))
+			}
+			value := "0"
+			if f.stale(now) {
+				value = "1"
+			}
+			stale = append(stale, storage+value)
+		}
+		writeMetric(&b, "timeship_snapshot_newest_timestamp_seconds", "Unix time of the newest snapshot of a storage", newest)
+		writeMetric(&b, "timeship_snapshot_max_age_seconds", "How old the newest snapshot of a storage may be", maxAge)
+		writeMetric(&b, "timeship_snapshot_checked_timestamp_seconds", "Unix time the snapshots of a storage were last checked", checked)
+		writeMetric(&b, "timeship_snapshot_stale", "Whether a storage has no snapshot newer than its maximum age", stale)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, b.String())
+}
+
+// writeMetric writes a gauge with its samples, which are the labels and
+// value following the metric name
+func writeMetric(b *strings.Builder, name, help string, samples []string) {
+	writeSamples(b, name, "gauge", help, samples)
+}
+
+// writeCounter writes a counter with its samples like writeMetric
+func writeCounter(b *strings.Builder, name, help string, samples []string) {
+	writeSamples(b, name, "counter", help, samples)
+}
+
+// writeSamples writes a metric of a type with its samples
+func writeSamples(b *strings.Builder, name, kind, help string, samples []string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, sample := range samples {
+		fmt.Fprintf(b, "%s%s\n", name, sample)
+	}
+}
+
+// metricLabel quotes a label value of the Prometheus text format
+func metricLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+// GetReadyz checks that all storages are reachable. The result of each
+// storage, with its error, is only included for the storages the user may
+// see, the status covers all.
+func (s *Server) GetReadyz(w http.ResponseWriter, r *http.Request) {
+	timeout := s.config.ReadinessTimeout
+	if timeout <= 0 {
+		timeout = defaultReadinessTimeout
+	}
+
+	if s.drain() != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ReadinessReport{Status: ReadinessReportStatusDraining, Storages: []StorageReadiness{}})
+		return
+	}
+
+	names := s.storageNames()
+	results := make([]StorageReadiness, len(names))
+	done := make(chan struct{}, len(names))
+	for i, name := range names {
+		go func() {
+			results[i] = s.checkReadiness(name, timeout)
+			done <- struct{}{}
+		}()
+	}
+	for range names {
+		<-done
+	}
+
+	report := ReadinessReport{Status: ReadinessReportStatusOk, Storages: []StorageReadiness{}}
+	status := http.StatusOK
+	for _, result := range results {
+		if !result.Ready {
+			report.Status = ReadinessReportStatusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+		if s.visible(r, result.Name, "") {
+			report.Storages = append(report.Storages, result)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// checkReadiness checks a storage, giving up after the timeout. Storages
+// without a health check are ready if their root can be listed.
+func (s *Server) checkReadiness(name string, timeout time.Duration) StorageReadiness {
+	start := time.Now()
+	result := StorageReadiness{Name: name}
+
+	store, err := s.getStorage(context.Background(), name)
+	if err != nil {
+		msg := err.Error()
+		result.Error = &msg
+		return result
+	}
+
+	// Checks can't be cancelled, a hanging check finishes in the background
+	checked := make(chan error, 1)
+	go func() {
+		checked <- checkHealth(name, store)
+	}()
+
+	select {
+	case err = <-checked:
+	case <-time.After(timeout):
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	result.Ready = err == nil
+	if err != nil {
+		msg := err.Error()
+		result.Error = &msg
+	}
+	return result
+}
+
+// SelfCheck checks that every storage can be opened and responds within the
+// timeout, like /readyz, e.g. before telling a watchdog the server is alive
+func (s *Server) SelfCheck(timeout time.Duration) error {
+	names := s.storageNames()
+	results := make([]StorageReadiness, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Go(func() {
+			results[i] = s.checkReadiness(name, timeout)
+		})
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if !result.Ready {
+			errs = append(errs, fmt.Errorf("storage %s: %s", result.Name, *result.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkHealth checks that a storage is reachable. Storages that can neither
+// be checked nor listed have nothing to check.
+func checkHealth(name string, store storage.Storage) error {
+	if checker, ok := store.(storage.HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	if lister, ok := store.(storage.Lister); ok {
+		_, err := lister.ListContents(url.URL{Scheme: name})
+		return err
+	}
+	return nil
+}
+
+// GetVersion returns build information of the server
+func (s *Server) GetVersion(w http.ResponseWriter, r *http.Request) {
+	build := s.config.Build
+	info := VersionInfo{
+		Version:   build.Version,
+		Commit:    build.Commit,
+		Date:      build.Date,
+		BuiltBy:   build.BuiltBy,
+		GoVersion: runtime.Version(),
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"timeship/internal/archive"
+)
+
+// hexdumpDefaultLength is how many bytes are dumped without a length
+const hexdumpDefaultLength = 4096
+
+// hexdumpMaxLength limits the bytes of a single dump, as the formatted
+// output is about four times larger
+const hexdumpMaxLength = 1 << 20
+
+// hexdumpLineSize is the number of bytes per line
+const hexdumpLineSize = 16
+
+// hexdumpRange is a range of bytes to show as a hexdump
+type hexdumpRange struct {
+	offset, length int64
+}
+
+// parseHexdump parses the format, offset and length parameters, returns nil
+// if no hexdump was requested
+func parseHexdump(params GetStoragesStorageNodesPathParams) (*hexdumpRange, error) {
+	if params.Format == nil || *params.Format == "" {
+		return nil, nil
+	}
+	if slices.Contains(archive.Formats, archive.Format(*params.Format)) {
+		return nil, fmt.Errorf("format %q is only supported for directories", *params.Format)
+	}
+	if *params.Format != GetStoragesStorageNodesPathParamsFormatHexdump {
+		return nil, fmt.Errorf("unsupported format %q", *params.Format)
+	}
+	if (params.Lines != nil && *params.Lines != "") || (params.Bytes != nil && *params.Bytes != "") || (params.Follow != nil && *params.Follow) {
+		return nil, errors.New("hexdump can't be combined with lines, bytes or follow")
+	}
+
+	rng := hexdumpRange{length: hexdumpDefaultLength}
+	if params.Offset != nil {
+		if *params.Offset < 0 {
+			return nil, errors.New("offset must not be negative")
+		}
+		rng.offset = *params.Offset
+	}
+	if params.Length != nil {
+		if *params.Length < 1 || *params.Length > hexdumpMaxLength {
+			return nil, fmt.Errorf("length must be between 1 and %d", hexdumpMaxLength)
+		}
+		rng.length = *params.Length
+	}
+	return &rng, nil
+}
+
+// serveHexdump sends a range of bytes of a file formatted like hexdump -C.
+// The size of the whole file is sent in X-File-Size.
+func (s *Server) serveHexdump(ctx context.Context, w http.ResponseWriter, stream io.Reader, fileSize int64, rng hexdumpRange) error {
+	var content []byte
+	if rng.offset < fileSize {
+		if err := skipTo(stream, rng.offset); err != nil {
+			return err
+		}
+		var err error
+		content, err = io.ReadAll(io.LimitReader(stream, min(rng.length, fileSize-rng.offset)))
+		if err != nil {
+			return err
+		}
+	}
+
+	var dump bytes.Buffer
+	dump.Grow(len(content) / hexdumpLineSize * 80)
+	writeHexdump(&dump, content, rng.offset)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-File-Size", strconv.FormatInt(fileSize, 10))
+	w.Header().Set("Content-Length", strconv.Itoa(dump.Len()))
+	w.WriteHeader(http.StatusOK)
+	_, err := s.copyResponse(ctx, w, &dump)
+	return err
+}
+
+// writeHexdump formats content read at an offset, with the offset, 16 bytes
+// in hex and the same bytes as ASCII on each line
+func writeHexdump(dump *bytes.Buffer, content []byte, offset int64) {
+	const digits = "0123456789abcdef"
+	for len(content) > 0 {
+		line := content[:min(hexdumpLineSize, len(content))]
+		content = content[len(line):]
+
+		fmt.Fprintf(dump, "%08x ", offset)
+		for i := range hexdumpLineSize {
+			if i%8 == 0 {
+				dump.WriteByte(' ')
+			}
+			if i < len(line) {
+				dump.Write([]byte{digits[line[i]>>4], digits[line[i]&0xf], ' '})
+			} else {
+				dump.WriteString("   ")
+			}
+		}
+		dump.WriteString(" |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			dump.WriteByte(c)
+		}
+		dump.WriteString("|\n")
+		offset += int64(len(line))
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"timeship/internal/metacache"
+	"timeship/internal/storage"
+	"timeship/internal/storage/jail"
+)
+
+// getIndexer returns the metadata cache indexer after checking that the
+// storage exists, or sends an error response
+func (s *Server) getIndexer(w http.ResponseWriter, r *http.Request, storageName Storage) (*metacache.Indexer, storage.Storage, bool) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return nil, nil, false
+	}
+	// The index covers the whole storage, not just a user's home
+	if _, ok := store.(*jail.Storage); ok {
+		s.sendForbidden(w, r)
+		return nil, nil, false
+	}
+	if s.config.MetadataCache == nil {
+		s.sendError(w, problemFeatureDisabled, "Metadata cache is not configured", r.URL.Path)
+		return nil, nil, false
+	}
+	return s.config.MetadataCache, store, true
+}
+
+// sendIndexStatus sends the indexing status of a storage
+func (s *Server) sendIndexStatus(w http.ResponseWriter, r *http.Request, indexer *metacache.Indexer, storageName Storage, status int) {
+	st, err := indexer.Status(string(storageName))
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to read metadata cache: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	response := IndexStatus{
+		Storage: string(storageName),
+		Paused:  st.Paused,
+		Queued:  st.Queued,
+		Indexed: st.Indexed,
+		Nodes:   st.Nodes,
+	}
+	if st.Current != "" {
+		response.Current = &st.Current
+	}
+	if st.LastIndexed != 0 {
+		response.LastIndexed = &st.LastIndexed
+	}
+	if st.LastError != "" {
+		response.LastError = &st.LastError
+	}
+	if st.NextRun != 0 {
+		response.NextRun = &st.NextRun
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetStoragesStorageIndex reports the indexing status of a storage
+func (s *Server) GetStoragesStorageIndex(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	indexer, _, ok := s.getIndexer(w, r, storageName)
+	if !ok {
+		return
+	}
+	s.sendIndexStatus(w, r, indexer, storageName, http.StatusOK)
+}
+
+// PostStoragesStorageIndex queues all snapshots of a storage for indexing
+func (s *Server) PostStoragesStorageIndex(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	indexer, store, ok := s.getIndexer(w, r, storageName)
+	if !ok {
+		return
+	}
+	if _, ok := store.(storage.SnapshotLister); !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support snapshots", r.URL.Path)
+		return
+	}
+
+	if err := indexer.EnqueueAll(string(storageName), store); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	s.sendIndexStatus(w, r, indexer, storageName, http.StatusAccepted)
+}
+
+// DeleteStoragesStorageIndex cancels indexing of a storage and deletes its
+// cached metadata
+func (s *Server) DeleteStoragesStorageIndex(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	indexer, _, ok := s.getIndexer(w, r, storageName)
+	if !ok {
+		return
+	}
+
+	if err := indexer.Drop(string(storageName)); err != nil {
+		s.sendError(w, problemInternal, "Failed to drop index: "+err.Error(), r.URL.Path)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostStoragesStorageIndexPause pauses indexing of a storage
+func (s *Server) PostStoragesStorageIndexPause(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	indexer, _, ok := s.getIndexer(w, r, storageName)
+	if !ok {
+		return
+	}
+	indexer.Pause(string(storageName))
+	s.sendIndexStatus(w, r, indexer, storageName, http.StatusOK)
+}
+
+// PostStoragesStorageIndexResume resumes indexing of a paused storage
+func (s *Server) PostStoragesStorageIndexResume(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	indexer, _, ok := s.getIndexer(w, r, storageName)
+	if !ok {
+		return
+	}
+	indexer.Resume(string(storageName))
+	s.sendIndexStatus(w, r, indexer, storageName, http.StatusOK)
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/export"
+	"timeship/internal/jobs"
+	"timeship/internal/storage"
+	"timeship/internal/webhook"
+)
+
+// PostStoragesStorageExports starts a job exporting a directory, typically
+// of a snapshot, to another storage
+func (s *Server) PostStoragesStorageExports(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	ctx := r.Context()
+	src, err := s.getStorage(ctx, string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	var request PostStoragesStorageExportsJSONRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	opts := export.Options{}
+	if request.Include != nil {
+		opts.Include = *request.Include
+	}
+	if request.Exclude != nil {
+		opts.Exclude = *request.Exclude
+	}
+	if err := opts.Validate(); err != nil {
+		s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+		return
+	}
+
+	dstName := request.DestinationStorage
+	dst, err := s.getStorage(ctx, dstName)
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	_, canList := src.(storage.Lister)
+	_, canRead := src.(storage.Reader)
+	_, canWrite := dst.(storage.Writer)
+	if !canList || !canRead || !canWrite {
+		s.sendError(w, problemNotSupported, "Storage does not support listing and reading, or the destination does not support writing", r.URL.Path)
+		return
+	}
+
+	from := url.URL{Scheme: string(storageName)}
+	if request.Path != nil {
+		from.Path = strings.Trim(path.Clean("/"+*request.Path), "/")
+	}
+	if request.Snapshot != nil && *request.Snapshot != "" {
+		from.RawQuery = url.Values{"snapshot": {*request.Snapshot}}.Encode()
+	}
+	to := url.URL{Scheme: dstName}
+	if request.Destination != nil {
+		to.Path = strings.Trim(path.Clean("/"+*request.Destination), "/")
+	}
+	if !s.allowed(r, from.Scheme, from.Path, access.Read) || !s.allowed(r, to.Scheme, to.Path, access.Write) {
+		s.sendForbidden(w, r)
+		return
+	}
+
+	params := map[string]string{
+		"storage":             from.Scheme,
+		"path":                from.Path,
+		"destination_storage": to.Scheme,
+		"destination":         to.Path,
+	}
+	if request.Snapshot != nil && *request.Snapshot != "" {
+		params["snapshot"] = *request.Snapshot
+	}
+	if len(opts.Include) > 0 {
+		params["include"] = strings.Join(opts.Include, ",")
+	}
+	if len(opts.Exclude) > 0 {
+		params["exclude"] = strings.Join(opts.Exclude, ",")
+	}
+	// Tokens aren't stored, so their jobs can't be resumed on their behalf
+	if user := access.FromContext(ctx); user != nil && user.Owner != nil {
+		params["via"] = "token"
+	}
+
+	// The job outlives the request, so keep a reload from closing the
+	// storages while it runs
+	release := s.holdStorages()
+	job := s.config.Jobs.Start(jobs.Export, params, tagOwner(r), func(ctx context.Context, progress func(jobs.Progress)) error {
+		defer release()
+		_, err := export.Export(ctx, src, from, dst, to, opts, func(p export.Progress) {
+			progress(jobs.Progress{Files: p.Files, Bytes: p.Bytes})
+		})
+		return err
+	})
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/storages/"+string(storageName)+"/exports")+"/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(describeJob(job))
+}
+
+// holdStorages keeps the current storages open across a reload until the
+// returned function is called, like a request in flight
+func (s *Server) holdStorages() func() {
+	s.mu.RLock()
+	gen := s.generation
+	gen.requests.Add(1)
+	s.mu.RUnlock()
+	return gen.requests.Done
+}
+
+// maxJobHistoryLimit bounds the jobs of a page of the job history
+const maxJobHistoryLimit = 1000
+
+// GetJobs lists the jobs of the user, or all jobs for administrators
+func (s *Server) GetJobs(w http.ResponseWriter, r *http.Request) {
+	list := JobList{Jobs: []Job{}}
+	for _, job := range s.config.Jobs.List() {
+		if s.ownsJob(r, job) {
+			list.Jobs = append(list.Jobs, describeJob(job))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetJobsHistory lists the finished jobs in the job history, the most
+// recently finished first
+func (s *Server) GetJobsHistory(w http.ResponseWriter, r *http.Request, params GetJobsHistoryParams) {
+	if s.config.JobHistory == nil {
+		s.sendError(w, problemFeatureDisabled, "Job history is not configured", r.URL.Path)
+		return
+	}
+	limit := jobs.DefaultHistoryLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	if limit < 1 || limit > maxJobHistoryLimit {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Invalid limit, expected 1 to %d", maxJobHistoryLimit), r.URL.Path)
+		return
+	}
+	query := jobs.Query{Limit: limit + 1}
+	if params.Type != nil {
+		query.Type = *params.Type
+	}
+	if params.State != nil {
+		query.State = jobs.State(*params.State)
+		switch query.State {
+		case jobs.Succeeded, jobs.Failed, jobs.Canceled, jobs.Interrupted:
+		default:
+			s.sendError(w, problemBadRequest, "Invalid state, expected succeeded, failed, canceled or interrupted", r.URL.Path)
+			return
+		}
+	}
+	if params.User != nil {
+		query.User = *params.User
+	}
+	if params.Since != nil {
+		query.Since = time.Unix(*params.Since, 0)
+	}
+	if params.Until != nil {
+		query.Until = time.Unix(*params.Until, 0)
+	}
+	if params.Before != nil {
+		query.Before = *params.Before
+	}
+	// Users only see their own jobs
+	if !s.seesAllJobs(r) {
+		if access.FromContext(r.Context()) == nil {
+			s.sendForbidden(w, r)
+			return
+		}
+		query.User = tagOwner(r)
+	}
+
+	list, err := s.config.JobHistory.List(query)
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to list jobs: "+err.Error(), r.URL.Path)
+		return
+	}
+	history := JobHistory{Jobs: make([]Job, 0, len(list))}
+	if len(list) > limit {
+		list = list[:limit]
+		history.Before = &list[limit-1].ID
+	}
+	for _, job := range list {
+		history.Jobs = append(history.Jobs, describeJob(job))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(history)
+}
+
+// GetJobsId returns a job with its progress, looking up jobs the manager
+// forgot in the job history
+func (s *Server) GetJobsId(w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := s.config.Jobs.Get(id)
+	if !ok && s.config.JobHistory != nil {
+		if stored, err := s.config.JobHistory.Get(id); err == nil {
+			job, ok = stored, true
+		}
+	}
+	if !ok || !s.ownsJob(r, job) {
+		s.sendError(w, problemJobNotFound, "No job with ID "+id, r.URL.Path)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(describeJob(job))
+}
+
+// DeleteJobsId cancels a running job
+func (s *Server) DeleteJobsId(w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := s.config.Jobs.Get(id)
+	if !ok || !s.ownsJob(r, job) {
+		s.sendError(w, problemJobNotFound, "No job with ID "+id, r.URL.Path)
+		return
+	}
+	err := s.config.Jobs.Cancel(id)
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		s.sendError(w, problemJobNotFound, "No job with ID "+id, r.URL.Path)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		s.sendError(w, problemConflict, err.Error(), r.URL.Path)
+		return
+	}
+	job, _ = s.config.Jobs.Get(id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(describeJob(job))
+}
+
+// ownsJob reports whether the user of a request may see a job. Users see
+// their own jobs and administrators see all, everyone sees all without
+// access control.
+func (s *Server) ownsJob(r *http.Request, job jobs.Job) bool {
+	return s.seesAllJobs(r) || (access.FromContext(r.Context()) != nil && job.User == tagOwner(r))
+}
+
+// seesAllJobs reports whether the user of a request may see the jobs of all
+// users
+func (s *Server) seesAllJobs(r *http.Request) bool {
+	if s.policy() == nil {
+		return true
+	}
+	user := access.FromContext(r.Context())
+	return user != nil && user.Covers(access.Rule{Storage: "*", Permissions: []string{access.Write}})
+}
+
+// jobFinished adds finished jobs to the job history and notifies of failed
+// jobs
+func (s *Server) jobFinished(job jobs.Job) {
+	if s.config.JobHistory != nil {
+		if err := s.config.JobHistory.Add(job); err != nil {
+			log.Printf("Error recording job %s: %v", job.ID, err)
+		}
+	}
+	if job.State != jobs.Failed {
+		return
+	}
+	s.notify(webhook.Event{
+		Type:    webhook.JobFailed,
+		Storage: job.Params["storage"],
+		Path:    job.Params["path"],
+		Job:     job.ID,
+		Error:   job.Error,
+	})
+}
+
+// describeJob converts a job to its API representation
+func describeJob(job jobs.Job) Job {
+	j := Job{
+		Id:      job.ID,
+		Type:    job.Type,
+		Params:  job.Params,
+		State:   JobState(job.State),
+		Files:   job.Progress.Files,
+		Bytes:   job.Progress.Bytes,
+		Started: job.Started.Unix(),
+	}
+	if j.Params == nil {
+		j.Params = map[string]string{}
+	}
+	if job.User != "" {
+		j.User = &job.User
+	}
+	if !job.Finished.IsZero() {
+		finished := job.Finished.Unix()
+		j.Finished = &finished
+	}
+	if job.Progress.Message != "" {
+		j.Message = &job.Progress.Message
+	}
+	if job.Error != "" {
+		j.Error = &job.Error
+	}
+	return j
+}
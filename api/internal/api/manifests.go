@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"timeship/internal/manifest"
+)
+
+// GetStoragesStorageManifests handles getting the manifest of the storage root
+func (s *Server) GetStoragesStorageManifests(w http.ResponseWriter, r *http.Request, storage Storage, params GetStoragesStorageManifestsParams) {
+	// Delegate to the path-based handler with empty path
+	pathParams := GetStoragesStorageManifestsPathParams{
+		Snapshot: params.Snapshot,
+	}
+	s.GetStoragesStorageManifestsPath(w, r, storage, "", pathParams)
+}
+
+// GetStoragesStorageManifestsPath builds an integrity manifest for a node
+func (s *Server) GetStoragesStorageManifestsPath(w http.ResponseWriter, r *http.Request, storageName Storage, path NodePath, params GetStoragesStorageManifestsPathParams) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	vfPath := url.URL{
+		Scheme: string(storageName),
+		Path:   path,
+	}
+	if params.Snapshot != nil && *params.Snapshot != "" {
+		q := vfPath.Query()
+		q.Set("snapshot", *params.Snapshot)
+		vfPath.RawQuery = q.Encode()
+	}
+
+	m, err := manifest.Build(store, vfPath)
+	if err != nil {
+		s.sendError(w, problemNodeNotFound, fmt.Sprintf("Failed to build manifest: %v", err), r.URL.Path)
+		return
+	}
+
+	if s.config.SigningKey != nil {
+		m.Sign(s.config.SigningKey)
+	}
+
+	// Plain sha256sum format for use with standard tools
+	if strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(m.SHA256Sum()))
+		return
+	}
+
+	files := make([]ManifestFile, len(m.Files))
+	for i, f := range m.Files {
+		files[i] = ManifestFile{
+			Path:   f.Path,
+			Size:   f.Size,
+			Sha256: f.SHA256,
+		}
+	}
+
+	response := Manifest{
+		Storage: m.Storage,
+		Path:    m.Path,
+		Created: m.Created,
+		Files:   files,
+	}
+	if m.Snapshot != "" {
+		response.Snapshot = &m.Snapshot
+	}
+	if m.Signature != "" {
+		algorithm := ManifestAlgorithm(m.Algorithm)
+		response.Algorithm = &algorithm
+		response.PublicKey = &m.PublicKey
+		response.Signature = &m.Signature
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
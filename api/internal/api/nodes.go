@@ -1,7 +1,12 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -10,11 +15,23 @@ import (
 	"net/url"
 	"sort"
 	"strings"
-	"sync/atomic"
+	"sync"
+	"time"
 
+	"timeship/internal/access"
+	"timeship/internal/imagemeta"
+	"timeship/internal/pdfpreview"
+	"timeship/internal/recent"
 	"timeship/internal/storage"
+	"timeship/internal/storage/jail"
+	"timeship/internal/storage/pinned"
+)
 
-	"github.com/charlievieth/fastwalk"
+// Limits of recursive directory listings
+const (
+	defaultTreeDepth = 2
+	maxTreeDepth     = 10
+	maxTreeNodes     = 10000
 )
 
 // extractPath returns just the path component from a url.URL without the scheme and host
@@ -29,12 +46,23 @@ func (s *Server) GetStoragesStorageNodes(w http.ResponseWriter, r *http.Request,
 		Type:     params.Type,
 		Filter:   params.Filter,
 		Search:   params.Search,
-		Children: params.Children,
+		Limit:    params.Limit,
+		Cursor:   params.Cursor,
+		Children: (*GetStoragesStorageNodesPathParamsChildren)(params.Children),
+		Depth:    params.Depth,
 		Download: params.Download,
+		Inline:   params.Inline,
+		Lines:    params.Lines,
+		Bytes:    params.Bytes,
+		Follow:   params.Follow,
+		Format:   (*GetStoragesStorageNodesPathParamsFormat)(params.Format),
+		Offset:   params.Offset,
+		Length:   params.Length,
 		Sort:     (*GetStoragesStorageNodesPathParamsSort)(params.Sort),
 		Order:    (*GetStoragesStorageNodesPathParamsOrder)(params.Order),
 		Fields:   params.Fields,
 		Snapshot: params.Snapshot,
+		Hidden:   params.Hidden,
 	}
 	s.GetStoragesStorageNodesPath(w, r, storage, "", pathParams)
 }
@@ -43,9 +71,9 @@ func (s *Server) GetStoragesStorageNodes(w http.ResponseWriter, r *http.Request,
 // This combines both directory listing and file retrieval functionality
 func (s *Server) GetStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storageName Storage, path NodePath, params GetStoragesStorageNodesPathParams) {
 	// Get the storage
-	store, err := s.getStorage(string(storageName))
+	store, err := s.getStorage(r.Context(), string(storageName))
 	if err != nil {
-		s.sendError(w, "Storage Not Found", http.StatusNotFound, err.Error(), r.URL.Path)
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
 		return
 	}
 
@@ -69,10 +97,41 @@ func (s *Server) GetStoragesStorageNodesPath(w http.ResponseWriter, r *http.Requ
 	lister, canList := store.(storage.Lister)
 	reader, canRead := store.(storage.Reader)
 
+	// Branch on the type of the node if the storage can tell, so errors of
+	// listing a directory aren't hidden by reading it as a file instead
+	typ, err := nodeType(r.Context(), store, vfPath)
+	if err != nil {
+		// Nodes the user can't read don't reveal whether they exist
+		if !s.allowed(r, string(storageName), path, access.Read) {
+			s.sendForbidden(w, r)
+			return
+		}
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if typ == "dir" && !canList {
+		s.sendStorageError(w, r, fmt.Errorf("listing directories: %w", storage.ErrNotSupported))
+		return
+	}
+
 	// First, try to list as a directory
-	if canList {
-		nodes, err := lister.ListContents(vfPath)
+	if canList && (typ == "" || typ == "dir") {
+		nodes, err := traceStorage(r.Context(), "ListContents", store, vfPath, lister.ListContents)
+		if err != nil && typ == "dir" {
+			s.sendStorageError(w, r, err)
+			return
+		}
 		if err == nil {
+			if params.Format != nil && *params.Format != "" {
+				// Directories leading to granted paths can be listed, but
+				// not downloaded
+				if !s.allowed(r, string(storageName), path, access.Read) {
+					s.sendForbidden(w, r)
+					return
+				}
+				s.serveDirectoryArchive(w, r, storageName, path, store, params)
+				return
+			}
 			// It's a directory - return listing as JSON
 			s.serveDirectoryListing(w, r, storageName, path, nodes, params, store)
 			return
@@ -80,6 +139,10 @@ func (s *Server) GetStoragesStorageNodesPath(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Not a directory, try to handle as a file
+	if !s.allowed(r, string(storageName), path, access.Read) {
+		s.sendForbidden(w, r)
+		return
+	}
 	if canRead {
 		// If client wants JSON, return file metadata
 		if wantsJSON {
@@ -92,11 +155,186 @@ func (s *Server) GetStoragesStorageNodesPath(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Neither listing nor reading worked
-	s.sendError(w, "Not Found", http.StatusNotFound, "Node not found or storage does not support required operations", r.URL.Path)
+	s.sendError(w, problemNodeNotFound, "Node not found or storage does not support required operations", r.URL.Path)
+}
+
+// nodeType returns the type of a node, "dir", "file" or "special", or an
+// empty type if the storage can't tell without listing or reading it
+func nodeType(ctx context.Context, store storage.Storage, vfPath url.URL) (string, error) {
+	if typer, ok := store.(storage.NodeTyper); ok {
+		typ, err := traceStorage(ctx, "NodeType", store, vfPath, typer.NodeType)
+		if errors.Is(err, storage.ErrNotSupported) {
+			return "", nil
+		}
+		return typ, err
+	}
+	return "", nil
 }
 
 // serveDirectoryListing returns directory listing as JSON
 func (s *Server) serveDirectoryListing(w http.ResponseWriter, r *http.Request, storageName Storage, path string, nodes []storage.FileNode, params GetStoragesStorageNodesPathParams, store storage.Storage) {
+	// Searches walk the whole tree instead
+	if params.Search != nil && *params.Search != "" {
+		s.serveSearch(w, r, storageName, path, params, store, store.(storage.Lister))
+		return
+	}
+
+	recursive := params.Children != nil && *params.Children == Recursive
+	depth := defaultTreeDepth
+	if params.Depth != nil {
+		depth = *params.Depth
+	}
+	if recursive && (depth < 1 || depth > maxTreeDepth) {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Invalid depth, expected 1 to %d", maxTreeDepth), r.URL.Path)
+		return
+	}
+
+	nodes = s.filterListing(r, storageName, nodes, params)
+
+	// Build list of available storages
+	storages := s.visibleStorageNames(r)
+
+	// Polling an unchanged directory costs a 304 instead of the fields and
+	// encoding of every node. Trees, total sizes and snapshot summaries
+	// depend on more than the listed nodes, so they aren't tagged.
+	fields := ""
+	if params.Fields != nil {
+		fields = *params.Fields
+	}
+	if !recursive && !strings.Contains(fields, "(total_size)") && !strings.Contains(fields, "(snapshots)") && !strings.Contains(fields, "(times)") {
+		etag := listingETag(r, nodes, storages)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if inm := r.Header.Get("If-None-Match"); inm != "" && matchNoneETag(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	includePermissions := params.Fields != nil && strings.Contains(*params.Fields, "(permissions)")
+
+	var summaries map[string]snapshotSummary
+	if params.Fields != nil && strings.Contains(*params.Fields, "(snapshots)") {
+		summaries = s.snapshotSummaries(r.Context(), store, url.URL{Scheme: string(storageName), Path: path})
+	}
+
+	// Fields read from the files themselves read them from the listed snapshot
+	dir := url.URL{Scheme: string(storageName), Path: path}
+	if params.Snapshot != nil && *params.Snapshot != "" {
+		dir.RawQuery = url.Values{"snapshot": {*params.Snapshot}}.Encode()
+	}
+	var images map[string]*ImageMetadata
+	if params.Fields != nil && strings.Contains(*params.Fields, "(exif)") {
+		images = imageMetadata(r.Context(), store, dir, nodes)
+	}
+	var pages map[string]int
+	if params.Fields != nil && strings.Contains(*params.Fields, "(pages)") {
+		pages = pageCounts(r.Context(), store, dir, nodes)
+	}
+	var times map[string]storage.NodeTimes
+	if params.Fields != nil && strings.Contains(*params.Fields, "(times)") {
+		times = nodeTimes(r.Context(), store, dir, nodes)
+	}
+
+	// Convert storage.FileNode to api.Node
+	files := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		apiNode := toListedNode(store, node, includePermissions)
+		if summaries != nil {
+			summary := summaries[node.Basename]
+			apiNode.SnapshotCount = &summary.count
+			if summary.count > 0 {
+				apiNode.NewestSnapshot = &summary.newest
+			}
+		}
+		apiNode.Image = images[node.Basename]
+		if count, ok := pages[node.Basename]; ok {
+			apiNode.PageCount = &count
+		}
+		setTimes(&apiNode, times[node.Basename])
+
+		files = append(files, apiNode)
+	}
+
+	// Recursive listings expand subdirectories into a nested tree
+	truncated := false
+	if recursive {
+		truncated = s.expandTree(r, storageName, store, dir, files, depth, includePermissions, params)
+	}
+
+	s.trackRecent(r, recent.Browsed, storageName, path, params.Snapshot)
+
+	// Pinned snapshots are always read-only
+	_, readOnly := store.(*pinned.Storage)
+
+	// dirname is just the path without storage prefix
+	dirname := path
+
+	// Create response - Files contains the direct children, not wrapped in a directory node
+	response := NodeList{
+		Files:     files,
+		Dirname:   dirname,
+		Ancestors: ancestors(r.Context(), store, dir),
+		ReadOnly:  readOnly,
+		Storages:  storages,
+	}
+	if truncated {
+		response.Truncated = &truncated
+	}
+
+	// Handle optional fields
+	if params.Fields != nil && *params.Fields != "" {
+		fields := *params.Fields
+		// Parse fields parameter - looking for (total_size)
+		if strings.Contains(fields, "(total_size)") && s.allowed(r, string(storageName), path, access.Read) {
+			// Compute total size if requested
+			totalSize, allocated, err := computeTotalSize(r.Context(), store, dir)
+			if err != nil {
+				log.Printf("Failed to compute total_size for %s://%s: %v", storageName, path, err)
+			} else {
+				response.TotalSize = &totalSize
+				if allocated > 0 {
+					response.TotalAllocatedSize = &allocated
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ancestors returns the directories leading to a directory, from the root
+// to its parent, with whether they exist in the snapshot of the directory
+func ancestors(ctx context.Context, store storage.Storage, dir url.URL) *[]Ancestor {
+	list := []Ancestor{}
+	dirPath := strings.Trim(dir.Path, "/")
+	if dirPath == "" {
+		return &list
+	}
+	existence, canTell := store.(storage.Existence)
+	parts := strings.Split(dirPath, "/")
+	for i := range parts {
+		ancestor := Ancestor{Path: strings.Join(parts[:i], "/"), Basename: dir.Scheme}
+		if i > 0 {
+			ancestor.Basename = parts[i-1]
+		}
+		if canTell {
+			u := dir
+			u.Path = ancestor.Path
+			if exists, err := traceStorage(ctx, "DirectoryExists", store, u, existence.DirectoryExists); err == nil {
+				ancestor.Exists = &exists
+			}
+		}
+		list = append(list, ancestor)
+	}
+	return &list
+}
+
+// filterListing sorts the nodes of a directory listing, directories first,
+// and leaves out the nodes the request filters out or the user may not see
+func (s *Server) filterListing(r *http.Request, storageName Storage, nodes []storage.FileNode, params GetStoragesStorageNodesPathParams) []storage.FileNode {
 	// Sort nodes: directories first, then by name
 	sort.Slice(nodes, func(i, j int) bool {
 		if nodes[i].Type != nodes[j].Type {
@@ -116,103 +354,209 @@ func (s *Server) serveDirectoryListing(w http.ResponseWriter, r *http.Request, s
 		nodes = filtered
 	}
 
-	// Apply filename filter if specified (glob pattern)
-	if params.Filter != nil && *params.Filter != "" {
-		// TODO: Implement glob pattern matching
-		// For now, we'll do simple substring matching
-		pattern := *params.Filter
+	// Hide nodes the user may not see. Only directories can lead to granted
+	// paths, so files must be readable.
+	if s.policy() != nil {
 		filtered := []storage.FileNode{}
 		for _, node := range nodes {
-			if strings.Contains(node.Basename, strings.Trim(pattern, "*")) {
+			nodePath := extractPath(node.Path)
+			if s.allowed(r, string(storageName), nodePath, access.Read) || (node.Type == "dir" && s.visible(r, string(storageName), nodePath)) {
 				filtered = append(filtered, node)
 			}
 		}
 		nodes = filtered
 	}
 
-	// Apply search if specified
-	if params.Search != nil && *params.Search != "" {
-		// TODO: Implement recursive search
-		// For now, we'll do simple name matching on current level
-		query := strings.ToLower(*params.Search)
+	// Skip hidden nodes if requested
+	if params.Hidden != nil && !*params.Hidden {
 		filtered := []storage.FileNode{}
 		for _, node := range nodes {
-			if strings.Contains(strings.ToLower(node.Basename), query) {
+			if !strings.HasPrefix(node.Basename, ".") {
 				filtered = append(filtered, node)
 			}
 		}
 		nodes = filtered
 	}
 
-	// Convert storage.FileNode to api.Node
-	files := make([]Node, 0, len(nodes))
-	for _, node := range nodes {
-		apiNode := Node{
-			Path:         extractPath(node.Path),
-			Type:         NodeType(node.Type),
-			Basename:     node.Basename,
-			Extension:    node.Extension,
-			FileSize:     node.Size,
-			LastModified: node.LastModified,
+	// Apply filename filter if specified (glob pattern)
+	if params.Filter != nil && *params.Filter != "" {
+		// TODO: Implement glob pattern matching
+		// For now, we'll do simple substring matching
+		pattern := *params.Filter
+		filtered := []storage.FileNode{}
+		for _, node := range nodes {
+			if strings.Contains(node.Basename, strings.Trim(pattern, "*")) {
+				filtered = append(filtered, node)
+			}
 		}
+		nodes = filtered
+	}
+	return nodes
+}
 
-		// Add optional fields
-		if node.MimeType != "" {
-			apiNode.MimeType = &node.MimeType
+// expandTree adds the children of the directories among the listed nodes
+// as a nested tree, level by level, until depth levels are listed or
+// maxTreeNodes nodes were listed in total. It reports whether subdirectories
+// were left unexpanded because the tree got too large.
+func (s *Server) expandTree(r *http.Request, storageName Storage, store storage.Storage, dir url.URL, nodes []Node, depth int, includePermissions bool, params GetStoragesStorageNodesPathParams) bool {
+	lister := store.(storage.Lister)
+	budget := maxTreeNodes - len(nodes)
+	var level []*Node
+	for i := range nodes {
+		if nodes[i].Type == Dir {
+			level = append(level, &nodes[i])
 		}
+	}
+	for d := 1; d < depth && len(level) > 0; d++ {
+		var next []*Node
+		for _, node := range level {
+			if r.Context().Err() != nil {
+				return true
+			}
+			subdir := dir
+			subdir.Path = node.Path
+			listed, err := traceStorage(r.Context(), "ListContents", store, subdir, lister.ListContents)
+			if err != nil {
+				log.Printf("Failed to list %s://%s in a tree: %v", storageName, node.Path, err)
+				continue
+			}
+			listed = s.filterListing(r, storageName, listed, params)
+			if len(listed) > budget {
+				return true
+			}
+			budget -= len(listed)
 
-		files = append(files, apiNode)
+			children := make([]Node, len(listed))
+			for i, child := range listed {
+				children[i] = toListedNode(store, child, includePermissions)
+			}
+			node.Children = &children
+			for i := range children {
+				if children[i].Type == Dir {
+					next = append(next, &children[i])
+				}
+			}
+		}
+		level = next
 	}
+	return false
+}
 
-	// Build list of available storages
-	storages := make([]string, 0, len(s.storages))
-	for name := range s.storages {
-		storages = append(storages, name)
+// toListedNode converts a node of a directory listing of a storage to its API
+// representation
+func toListedNode(store storage.Storage, node storage.FileNode, includePermissions bool) Node {
+	apiNode := Node{
+		Path:         extractPath(node.Path),
+		Type:         NodeType(node.Type),
+		Basename:     node.Basename,
+		Extension:    node.Extension,
+		FileSize:     node.Size,
+		LastModified: node.LastModified,
 	}
-	sort.Strings(storages)
 
-	// dirname is just the path without storage prefix
-	dirname := path
+	// Add optional fields
+	if node.MimeType != "" {
+		apiNode.MimeType = &node.MimeType
+	}
+	if node.AllocatedSize > 0 {
+		apiNode.AllocatedSize = &node.AllocatedSize
+	}
+	if includePermissions {
+		node.Owner, node.Group = resolveOwner(store, node)
+		setPermissions(&apiNode, node)
+	} else if node.Type == "link" && node.LinkTarget != "" {
+		apiNode.LinkTarget = &node.LinkTarget
+	}
+	return apiNode
+}
 
-	// Create response - Files contains the direct children, not wrapped in a directory node
-	response := NodeList{
-		Files:    files,
-		Dirname:  dirname,
-		ReadOnly: false, // TODO: Determine read-only status from storage capabilities
-		Storages: storages,
+// resolveOwner returns the owner user and group names of a listed node, for
+// storages that list numeric IDs to spare lookups that aren't needed
+func resolveOwner(store storage.Storage, node storage.FileNode) (string, string) {
+	if resolver, ok := store.(storage.OwnerResolver); ok {
+		return resolver.ResolveOwner(node.Owner, node.Group)
 	}
+	return node.Owner, node.Group
+}
 
-	// Handle optional fields
-	if params.Fields != nil && *params.Fields != "" {
-		fields := *params.Fields
-		// Parse fields parameter - looking for (total_size)
-		if strings.Contains(fields, "(total_size)") {
-			// Compute total size if requested
-			totalSize, err := s.computeTotalSize(store, storageName, path)
-			if err != nil {
-				log.Printf("Failed to compute total_size for %s://%s: %v", storageName, path, err)
-			} else {
-				response.TotalSize = &totalSize
-			}
+// setPermissions adds the ownership and permission fields of a node
+func setPermissions(apiNode *Node, node storage.FileNode) {
+	if node.Mode != 0 {
+		mode := fmt.Sprintf("%04o", unixMode(node.Mode))
+		apiNode.Mode = &mode
+	}
+	if node.Owner != "" {
+		apiNode.Owner = &node.Owner
+	}
+	if node.Group != "" {
+		apiNode.Group = &node.Group
+	}
+	if node.LinkTarget != "" {
+		apiNode.LinkTarget = &node.LinkTarget
+	}
+}
+
+// unixMode converts a fs.FileMode to Unix permission bits including
+// setuid, setgid and sticky bits
+func unixMode(mode fs.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+// serveFileMetadata returns file metadata as JSON
+func (s *Server) serveFileMetadata(w http.ResponseWriter, r *http.Request, storageName Storage, path string, vfPath url.URL, reader storage.Reader, params GetStoragesStorageNodesPathParams) {
+	ctx := r.Context()
+
+	node, err := readFileNode(ctx, reader, path, vfPath)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	basename, fileSize := node.Basename, node.FileSize
+	mimeType := ""
+	if node.MimeType != nil {
+		mimeType = *node.MimeType
+	}
+
+	if params.Fields != nil && strings.Contains(*params.Fields, "(exif)") && imagemeta.Supported(basename, mimeType) {
+		node.Image = readImageMetadata(ctx, reader, vfPath)
+	}
+	if params.Fields != nil && strings.Contains(*params.Fields, "(pages)") && pdfpreview.Supported(basename, mimeType) {
+		if count := readPageCount(ctx, reader, vfPath, fileSize); count > 0 {
+			node.PageCount = &count
 		}
 	}
+	if params.Fields != nil && strings.Contains(*params.Fields, "(times)") {
+		setTimes(&node, readNodeTimes(ctx, reader, vfPath))
+	}
 
+	if etag := fileETag(ctx, reader, vfPath); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(node)
 }
 
-// serveFileMetadata returns file metadata as JSON
-func (s *Server) serveFileMetadata(w http.ResponseWriter, r *http.Request, storageName Storage, path string, vfPath url.URL, reader storage.Reader, params GetStoragesStorageNodesPathParams) {
+// readFileNode returns the metadata of a file read from the storage
+func readFileNode(ctx context.Context, reader storage.Reader, path string, vfPath url.URL) (Node, error) {
 	// Get file size
-	fileSize, err := reader.FileSize(vfPath)
+	fileSize, err := traceStorage(ctx, "FileSize", reader, vfPath, reader.FileSize)
 	if err != nil {
-		s.sendError(w, "Not Found", http.StatusNotFound, "Failed to get file size: "+err.Error(), r.URL.Path)
-		return
+		return Node{}, fmt.Errorf("failed to get file size: %w", err)
 	}
 
 	// Get MIME type
-	mimeType, err := reader.MimeType(vfPath)
+	mimeType, err := traceStorage(ctx, "MimeType", reader, vfPath, reader.MimeType)
 	if err != nil {
 		log.Printf("Failed to get MIME type for %s: %v", vfPath.String(), err)
 		mimeType = "application/octet-stream"
@@ -221,7 +565,7 @@ func (s *Server) serveFileMetadata(w http.ResponseWriter, r *http.Request, stora
 	// Get last modified time if storage supports it
 	var lastModified int64
 	if stater, ok := reader.(storage.Stater); ok {
-		lastModified, err = stater.LastModified(vfPath)
+		lastModified, err = traceStorage(ctx, "LastModified", reader, vfPath, stater.LastModified)
 		if err != nil {
 			log.Printf("Failed to get last modified time for %s: %v", vfPath.String(), err)
 			lastModified = 0
@@ -248,56 +592,292 @@ func (s *Server) serveFileMetadata(w http.ResponseWriter, r *http.Request, stora
 	if mimeType != "" {
 		node.MimeType = &mimeType
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(node)
+	return node, nil
 }
 
 // serveFileContent streams file content
 func (s *Server) serveFileContent(w http.ResponseWriter, r *http.Request, storageName Storage, path string, vfPath url.URL, reader storage.Reader, params GetStoragesStorageNodesPathParams) {
+	ctx := r.Context()
+
+	preview, err := parsePreview(params)
+	if err != nil {
+		s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+		return
+	}
+	hexdump, err := parseHexdump(params)
+	if err != nil {
+		s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+		return
+	}
+	byteRange, err := parseByteRange(r, params)
+	if err != nil {
+		s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+		return
+	}
+	download := params.Download != nil && *params.Download
+	inline := params.Inline != nil && *params.Inline
+	if download && inline {
+		s.sendError(w, problemBadRequest, "download and inline can't be combined", r.URL.Path)
+		return
+	}
+
 	// Get MIME type
-	mimeType, err := reader.MimeType(vfPath)
+	mimeType, err := traceStorage(ctx, "MimeType", reader, vfPath, reader.MimeType)
+	if errors.Is(err, storage.ErrSpecialFile) {
+		s.sendStorageError(w, r, err)
+		return
+	}
 	if err != nil {
-		s.sendError(w, "Not Found", http.StatusNotFound, "Failed to get file MIME type: "+err.Error(), r.URL.Path)
+		s.sendStorageError(w, r, fmt.Errorf("failed to get file MIME type: %w", err))
 		return
 	}
 
 	// Get file size
-	fileSize, err := reader.FileSize(vfPath)
+	fileSize, err := traceStorage(ctx, "FileSize", reader, vfPath, reader.FileSize)
 	if err != nil {
-		s.sendError(w, "Not Found", http.StatusNotFound, "Failed to get file size: "+err.Error(), r.URL.Path)
+		s.sendStorageError(w, r, fmt.Errorf("failed to get file size: %w", err))
 		return
 	}
 
+	if params.Follow != nil && *params.Follow {
+		s.serveFollow(w, r, vfPath, reader, mimeType, fileSize, preview)
+		return
+	}
+
+	// Checksums of snapshot files the metadata cache already hashed are sent
+	// either way, as they cost nothing. They describe the whole file, so
+	// they're sent with parts of it too. Previews aren't the file, so they
+	// get none.
+	digest := ""
+	var checksum []byte
+	if preview == nil && hexdump == nil {
+		checksum = s.cachedChecksum(reader, vfPath, fileSize)
+	}
+	if checksum != nil {
+		digest = reprDigest(checksum)
+	}
+
+	// Clients send the ETag back in If-Match to update the file without
+	// losing changes made since they read it, and in If-Range to resume
+	// downloading it
+	etag := ""
+	if preview == nil && hexdump == nil {
+		etag = fileETag(ctx, reader, vfPath)
+	}
+	// Files read from a snapshot have the modification time of their
+	// version there
+	modTime := fileModTime(ctx, reader, vfPath)
+
 	// Open file stream
-	stream, err := reader.ReadStream(vfPath)
+	stream, err := traceStream(ctx, reader, vfPath, reader)
 	if err != nil {
-		s.sendError(w, "Not Found", http.StatusNotFound, "Failed to open file: "+err.Error(), r.URL.Path)
+		s.sendStorageError(w, r, fmt.Errorf("failed to open file: %w", err))
 		return
 	}
 	defer stream.Close()
 
+	// Previews only read part of the file, so they don't count as downloads
+	if preview == nil && hexdump == nil {
+		s.trackRecent(r, recent.Downloaded, storageName, path, params.Snapshot)
+	}
+
+	if hexdump != nil {
+		setLastModified(w, modTime)
+		// Headers may already be sent, so read errors can only be logged
+		if err := s.serveHexdump(ctx, w, stream, fileSize, *hexdump); err != nil {
+			log.Printf("Failed to hexdump %s: %v", vfPath.String(), err)
+		}
+		return
+	}
+
 	// Set headers
-	w.Header().Set("Content-Type", mimeType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
+	s.setContentType(w, mimeType)
+	if digest != "" {
+		w.Header().Set("Repr-Digest", digest)
+	} else if s.config.ContentDigest && preview == nil {
+		// Hashing reads the whole file, so it's only done once the
+		// response turns out to send all of it rather than a range or
+		// nothing at all
+		w = &digestWriter{ResponseWriter: w, digest: func() (string, error) {
+			return contentDigest(ctx, reader, vfPath)
+		}}
+	}
+	if checksum != nil {
+		w.Header().Set("X-Checksum-SHA256", hex.EncodeToString(checksum))
+	}
+
+	// Set Content-Disposition if download or inline display is requested
+	if download {
+		w.Header().Set("Content-Disposition", contentDisposition("attachment", getBasename(path)))
+	} else if inline {
+		w.Header().Set("Content-Disposition", contentDisposition("inline", getBasename(path)))
+	}
+
+	if preview != nil {
+		setLastModified(w, modTime)
+		// Headers may already be sent, so read errors can only be logged
+		if err := s.servePreview(ctx, w, stream, fileSize, *preview); err != nil {
+			log.Printf("Failed to preview %s: %v", vfPath.String(), err)
+		}
+		return
+	}
 
-	// Set Content-Disposition if download is requested
-	if params.Download != nil && *params.Download {
-		basename := getBasename(path)
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", basename))
+	// Seekable streams like local files are served by http.ServeContent,
+	// which handles Range and conditional requests and sends files with
+	// sendfile through the ReadFrom of the response
+	if seeker, ok := stream.(io.ReadSeeker); ok {
+		// A file replaced while it was opened may be either version, so
+		// it can't be validated and isn't served in parts
+		if etag != "" && fileETag(ctx, reader, vfPath) != etag {
+			etag = ""
+			modTime = time.Time{}
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		// If-Range is evaluated here instead of by http.ServeContent, as it
+		// honors dates a live file could still change within. Resuming
+		// from a changed file would concatenate parts of both versions.
+		// Offset and length are served as the Range they stand for
+		if byteRange != nil {
+			r = r.Clone(ctx)
+			r.Header.Set("Range", byteRange.header())
+		}
+		if r.Header.Get("Range") != "" {
+			resume := ifRange(r, etag, modTime)
+			r = r.Clone(ctx)
+			r.Header.Del("If-Range")
+			if !resume {
+				r.Header.Del("Range")
+			}
+		}
+		http.ServeContent(&responseCopier{ResponseWriter: w, ctx: ctx, server: s}, r, getBasename(path), modTime, seeker)
+		return
 	}
 
+	// Ranges are only served from seekable streams, so clients shouldn't
+	// try to resume others
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	setLastModified(w, modTime)
+	if notModified(r, etag, modTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if byteRange != nil {
+		// Headers may already be sent, so read errors can only be logged
+		if err := s.serveByteRange(w, r, stream, fileSize, *byteRange); err != nil {
+			log.Printf("Failed to read %s: %v", vfPath.String(), err)
+		}
+		return
+	}
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
 	w.WriteHeader(http.StatusOK)
 
 	// Stream the file content
-	_, err = io.Copy(w, stream)
+	_, err = s.copyResponse(ctx, w, stream)
 	if err != nil {
 		// At this point we've already written headers, so we can't send an error response
 		return
 	}
 }
 
+// contentDigest returns the SHA-256 digest of a file in RFC 9530
+// Repr-Digest header format
+func contentDigest(ctx context.Context, reader storage.Reader, vfPath url.URL) (string, error) {
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	h := sha256.New()
+	if _, err := copyBuffer(h, stream); err != nil {
+		return "", err
+	}
+	return reprDigest(h.Sum(nil)), nil
+}
+
+// reprDigest formats a SHA-256 checksum as a Repr-Digest header value
+func reprDigest(checksum []byte) string {
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(checksum) + ":"
+}
+
+// digestWriter adds the Repr-Digest header to responses sending the whole
+// file with 200 OK, computing it only when their header is written
+type digestWriter struct {
+	http.ResponseWriter
+	digest      func() (string, error)
+	wroteHeader bool
+}
+
+func (d *digestWriter) WriteHeader(code int) {
+	if !d.wroteHeader && code == http.StatusOK {
+		// The header can't be left out once the content was read, so
+		// failures are logged and the content sent without it
+		if digest, err := d.digest(); err == nil {
+			d.Header().Set("Repr-Digest", digest)
+		} else {
+			log.Printf("Failed to compute digest: %v", err)
+		}
+	}
+	d.wroteHeader = true
+	d.ResponseWriter.WriteHeader(code)
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	if !d.wroteHeader {
+		d.WriteHeader(http.StatusOK)
+	}
+	return d.ResponseWriter.Write(p)
+}
+
+// ReadFrom keeps sending files with sendfile through the response
+func (d *digestWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !d.wroteHeader {
+		d.WriteHeader(http.StatusOK)
+	}
+	return io.Copy(d.ResponseWriter, src)
+}
+
+// Unwrap allows http.ResponseController to reach the connection
+func (d *digestWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
+
+// cachedChecksum returns the SHA-256 of a snapshot file from the metadata
+// cache, or nil if it isn't hashed there. Snapshots are immutable,
+// so the hash of an indexed snapshot can't be stale. Files of the live tree
+// change, so they never have one.
+func (s *Server) cachedChecksum(store storage.Storage, vfPath url.URL, fileSize int64) []byte {
+	indexer := s.config.MetadataCache
+	snapshotID := vfPath.Query().Get("snapshot")
+	if indexer == nil || snapshotID == "" {
+		return nil
+	}
+
+	// Homes are answered from the index of their whole storage
+	if j, ok := store.(*jail.Storage); ok {
+		vfPath = j.ToBase(vfPath)
+	}
+	history, err := indexer.Cache().History(vfPath.Scheme, strings.Trim(vfPath.Path, "/"))
+	if err != nil {
+		log.Printf("Failed to read metadata cache of %s: %v", vfPath.String(), err)
+		return nil
+	}
+	entry, ok := history[snapshotID]
+	if !ok || entry.Type != "file" || entry.Size != fileSize {
+		return nil
+	}
+	sum, err := hex.DecodeString(entry.Hash)
+	if err != nil || len(sum) != sha256.Size {
+		return nil
+	}
+	return sum
+}
+
 // getBasename returns the last component of a path
 func getBasename(path string) string {
 	if path == "" {
@@ -310,53 +890,76 @@ func getBasename(path string) string {
 	return parts[len(parts)-1]
 }
 
-// computeTotalSize computes the total size of all files in a directory tree
-// using fastwalk for parallel traversal
-func (s *Server) computeTotalSize(store storage.Storage, storage Storage, path string) (int64, error) {
-	// We need a concrete type that has a root path
-	// For now, we'll check if it's a local storage
-	type localStorage interface {
-		GetRootPath() string
-	}
-
-	la, ok := store.(localStorage)
-	if !ok {
-		return 0, fmt.Errorf("storage does not support total size computation")
+// contentDisposition formats a Content-Disposition header with a filename.
+// Names that aren't plain ASCII get an ASCII fallback in filename and the
+// exact name in filename* (RFC 5987), which all current browsers prefer.
+func contentDisposition(dispositionType, filename string) string {
+	fallback := make([]byte, 0, len(filename))
+	plain := true
+	for _, r := range filename {
+		// Quotes and backslashes would need escaping not all clients support
+		if r == '"' || r == '\\' || r < 0x20 || r > 0x7e {
+			fallback = append(fallback, '_')
+			plain = false
+			continue
+		}
+		fallback = append(fallback, byte(r))
 	}
-
-	rootPath := la.GetRootPath()
-	targetPath := rootPath
-	if path != "" {
-		targetPath = rootPath + "/" + path
+	if plain {
+		return fmt.Sprintf(`%s; filename="%s"`, dispositionType, filename)
 	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, dispositionType, fallback, encodeRFC5987(filename))
+}
 
-	var totalSize atomic.Int64
-
-	conf := fastwalk.Config{
-		Follow: false, // Don't follow symlinks to avoid cycles
+// encodeRFC5987 percent-encodes a UTF-8 string except for the attr-chars of
+// RFC 5987
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		}
 	}
+	return b.String()
+}
 
-	walkFn := func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			// Log but don't stop on individual errors
-			log.Printf("Error walking %s: %v", path, err)
+// computeTotalSize computes the total size of all files in a directory tree
+// and the bytes they take up on disk, counting files with several hard links
+// once
+func computeTotalSize(ctx context.Context, store storage.Storage, dir url.URL) (size, allocated int64, err error) {
+	// Listing each directory of remote storages would be too slow
+	if _, ok := store.(storage.Walker); !ok {
+		return 0, 0, fmt.Errorf("storage does not support total size computation")
+	}
+
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	err = walkTree(ctx, store, dir, func(node storage.FileNode) error {
+		if node.Type != "file" {
 			return nil
 		}
-
-		// Only count regular files
-		if d.Type().IsRegular() {
-			if info, err := d.Info(); err == nil {
-				totalSize.Add(info.Size())
+		mu.Lock()
+		defer mu.Unlock()
+		if node.FileID != "" {
+			if seen[node.FileID] {
+				return nil
 			}
+			seen[node.FileID] = true
 		}
-
+		size += node.Size
+		allocated += node.AllocatedSize
 		return nil
-	}
-
-	err := fastwalk.Walk(&conf, targetPath, walkFn)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to walk directory: %w", err)
+		return 0, 0, fmt.Errorf("failed to walk directory: %w", err)
 	}
-
-	return totalSize.Load(), nil
+	return size, allocated, nil
 }
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"timeship/internal/hook"
+	"timeship/internal/storage"
+)
+
+// patchContent writes the request body into an existing file at the offset
+// parameter, keeping the rest of the file
+func (s *Server) patchContent(w http.ResponseWriter, r *http.Request, store storage.Storage, vfPath url.URL, params PatchStoragesStorageNodesPathParams) {
+	ctx := r.Context()
+	writer, ok := store.(storage.WriterAt)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support partial writes", r.URL.Path)
+		return
+	}
+	if params.Offset == nil || *params.Offset < 0 {
+		s.sendError(w, problemBadRequest, "Partial writes require a non-negative offset", r.URL.Path)
+		return
+	}
+	// Scanners need the whole file, and the range is written in place, so
+	// infected content couldn't be kept out
+	if s.config.Scanner != nil {
+		s.sendError(w, problemFeatureDisabled, "Partial writes are disabled while writes are scanned for viruses", r.URL.Path)
+		return
+	}
+
+	// Conditional writes must not interleave with other updates, or both of
+	// two concurrent edits could pass the check. Others don't wait, as the
+	// body may take long to arrive.
+	if params.IfMatch != nil || params.IfUnmodifiedSince != nil {
+		defer s.updateLocks.lock(vfPath)()
+	}
+	etag := fileETag(ctx, store, vfPath)
+	if !checkPreconditions(ctx, store, vfPath, etag, params) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		s.sendError(w, problemPreconditionFailed, "The node was changed since it was read", r.URL.Path)
+		return
+	}
+
+	op := hook.Operation{Name: hook.Write, Storage: vfPath.Scheme, Path: extractPath(vfPath)}
+	if err := s.beforeHooks(ctx, op); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	_, span := startStorageSpan(ctx, "WriteStreamAt", store, vfPath)
+	err := writer.WriteStreamAt(vfPath, *params.Offset, r.Body)
+	endSpan(span, err)
+	if errors.Is(err, syscall.EISDIR) {
+		s.sendError(w, problemBadRequest, "Directories can't have content", r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	s.afterHooks(op)
+
+	if etag := fileETag(ctx, store, vfPath); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(describeNode(store, vfPath, File))
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/url"
+	"slices"
+	"sync"
+)
+
+// pathLocks serializes conditional updates of the same nodes, so checking
+// and writing don't interleave while updates of other nodes go ahead. The
+// zero value is ready to use.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is the lock of a node, removed once nobody holds or waits for it
+type pathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock locks the nodes at the paths, returning the function unlocking them.
+// Paths are locked in order, so updates locking the same paths, like the
+// source and target of a rename, can't deadlock.
+func (l *pathLocks) lock(paths ...url.URL) (unlock func()) {
+	keys := make([]string, len(paths))
+	for i, p := range paths {
+		keys[i] = p.Scheme + "://" + p.Path
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*pathLock{}
+	}
+	held := make([]*pathLock, len(keys))
+	for i, key := range keys {
+		pl := l.locks[key]
+		if pl == nil {
+			pl = &pathLock{}
+			l.locks[key] = pl
+		}
+		pl.refs++
+		held[i] = pl
+	}
+	l.mu.Unlock()
+
+	for _, pl := range held {
+		pl.mu.Lock()
+	}
+	return func() {
+		for _, pl := range held {
+			pl.mu.Unlock()
+		}
+		l.mu.Lock()
+		for i, pl := range held {
+			pl.refs--
+			if pl.refs == 0 {
+				delete(l.locks, keys[i])
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"timeship/internal/access"
+	"timeship/internal/storage"
+	"timeship/internal/storage/jail"
+	"timeship/internal/storage/pinned"
+)
+
+// toPin converts a pinned storage to its API representation
+func toPin(store *pinned.Storage) Pin {
+	return Pin{
+		Name:     store.Name(),
+		Storage:  store.BaseName(),
+		Snapshot: toAPISnapshot(store.Snapshot()),
+	}
+}
+
+// GetPins lists all pinned snapshots
+func (s *Server) GetPins(w http.ResponseWriter, r *http.Request) {
+	pins := []Pin{}
+	for _, name := range s.visibleStorageNames(r) {
+		store, err := s.getStorage(r.Context(), name)
+		if err != nil {
+			continue
+		}
+		if p, ok := store.(*pinned.Storage); ok {
+			pins = append(pins, toPin(p))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PinList{Pins: pins})
+}
+
+// PostPins pins a snapshot as a virtual read-only storage
+func (s *Server) PostPins(w http.ResponseWriter, r *http.Request) {
+	var request CreatePinRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if request.Snapshot == "" {
+		s.sendError(w, problemBadRequest, "Missing snapshot", r.URL.Path)
+		return
+	}
+	// Pins are managed like snapshots, which needs access to the whole storage
+	if !s.allowed(r, request.Storage, "", access.Write) {
+		s.sendForbidden(w, r)
+		return
+	}
+
+	base, err := s.getStorage(r.Context(), request.Storage)
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	// Pins are shared by all users, so they can't show a user's home
+	if _, ok := base.(*jail.Storage); ok {
+		s.sendForbidden(w, r)
+		return
+	}
+
+	name := pinned.DefaultName(request.Storage, request.Snapshot)
+	if request.Name != nil {
+		name = *request.Name
+	}
+	if !pinned.ValidName(name) {
+		s.sendError(w, problemBadRequest, "Invalid name, expected a letter followed by letters, digits, '+', '-' or '.'", r.URL.Path)
+		return
+	}
+
+	store, err := pinned.New(name, base, request.Storage, request.Snapshot)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	if err := s.addPin(name, store); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toPin(store))
+}
+
+// DeletePinsName removes a pinned snapshot
+func (s *Server) DeletePinsName(w http.ResponseWriter, r *http.Request, name string) {
+	s.mu.Lock()
+	pin, ok := s.storages[name].(*pinned.Storage)
+	if ok && !s.allowed(r, pin.BaseName(), "", access.Write) {
+		s.mu.Unlock()
+		s.sendForbidden(w, r)
+		return
+	}
+	if ok {
+		delete(s.storages, name)
+		delete(s.pins, name)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.sendError(w, problemPinNotFound, "pin not found: "+name, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addPin adds a pinned storage, failing with fs.ErrExist if the name is
+// taken
+func (s *Server) addPin(name string, store storage.Storage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.storages[name]; ok {
+		return fmt.Errorf("storage %s: %w", name, fs.ErrExist)
+	}
+	s.storages[name] = store
+	s.pins[name] = true
+	return nil
+}
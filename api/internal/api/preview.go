@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// previewRange is an inclusive range of lines or bytes of a file. A range
+// with a tail selects the last tail units, an end of -1 reads to the end.
+type previewRange struct {
+	lines      bool
+	start, end int64
+	tail       int64
+}
+
+// parsePreviewRange parses ranges like "1-200", "100-" and "-100". Starts
+// below first are rejected.
+func parsePreviewRange(s string, first int64) (previewRange, error) {
+	startStr, endStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return previewRange{}, fmt.Errorf("invalid range %q, expected start-end, start- or -count", s)
+	}
+	if startStr == "" {
+		tail, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || tail < 1 {
+			return previewRange{}, fmt.Errorf("invalid range %q, expected a positive count", s)
+		}
+		return previewRange{tail: tail}, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < first {
+		return previewRange{}, fmt.Errorf("invalid range %q, expected a start of at least %d", s, first)
+	}
+	end := int64(-1)
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return previewRange{}, fmt.Errorf("invalid range %q, expected an end of at least the start", s)
+		}
+	}
+	return previewRange{start: start, end: end}, nil
+}
+
+// parsePreview parses the lines and bytes parameters, returns nil if no
+// preview was requested
+func parsePreview(params GetStoragesStorageNodesPathParams) (*previewRange, error) {
+	hasLines := params.Lines != nil && *params.Lines != ""
+	hasBytes := params.Bytes != nil && *params.Bytes != ""
+	var rng previewRange
+	var err error
+	switch {
+	case hasLines && hasBytes:
+		return nil, errors.New("lines and bytes can't be combined")
+	case hasLines:
+		rng, err = parsePreviewRange(*params.Lines, 1)
+		rng.lines = true
+	case hasBytes:
+		rng, err = parsePreviewRange(*params.Bytes, 0)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rng, nil
+}
+
+// servePreview sends a range of lines or bytes of a file. The size of the
+// whole file is sent in X-File-Size, so clients can tell if there's more.
+func (s *Server) servePreview(ctx context.Context, w http.ResponseWriter, stream io.Reader, fileSize int64, rng previewRange) error {
+	w.Header().Set("X-File-Size", strconv.FormatInt(fileSize, 10))
+	if rng.lines {
+		return s.serveLines(ctx, w, stream, fileSize, rng)
+	}
+
+	offset, length := rng.start, fileSize-rng.start
+	if rng.tail > 0 {
+		offset = max(0, fileSize-rng.tail)
+		length = fileSize - offset
+	} else if rng.end >= 0 {
+		length = min(length, rng.end-rng.start+1)
+	}
+	length = max(0, length)
+	if offset > 0 && length > 0 {
+		if err := skipTo(stream, offset); err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusOK)
+	_, err := s.copyResponse(ctx, w, io.LimitReader(stream, length))
+	return err
+}
+
+// serveLines sends a range of lines. Tails of seekable files are found by
+// reading backwards from the end, other streams are read from the start.
+func (s *Server) serveLines(ctx context.Context, w http.ResponseWriter, stream io.Reader, fileSize int64, rng previewRange) error {
+	if rng.tail > 0 {
+		if seeker, ok := stream.(io.ReadSeeker); ok {
+			offset, err := tailOffset(seeker, fileSize, rng.tail)
+			if err != nil {
+				return err
+			}
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+			w.Header().Set("Content-Length", strconv.FormatInt(fileSize-offset, 10))
+			w.WriteHeader(http.StatusOK)
+			_, err = s.copyResponse(ctx, w, io.LimitReader(stream, fileSize-offset))
+			return err
+		}
+		tail, err := tailLines(stream, rng.tail)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(tail)))
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(tail)
+		return err
+	}
+
+	br := bufio.NewReaderSize(stream, copyBufferSize)
+	if err := skipLines(br, rng.start-1); err != nil && err != io.EOF {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	if rng.end < 0 {
+		_, err := s.copyResponse(ctx, w, br)
+		return err
+	}
+	return copyLines(w, br, rng.end-rng.start+1)
+}
+
+// skipTo advances a stream to an offset, seeking if possible
+func skipTo(stream io.Reader, offset int64) error {
+	if seeker, ok := stream.(io.Seeker); ok {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, stream, offset)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// skipLines discards n lines
+func skipLines(br *bufio.Reader, n int64) error {
+	for n > 0 {
+		_, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Long line, keep reading until its end
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		n--
+	}
+	return nil
+}
+
+// copyLines copies up to n lines
+func copyLines(w io.Writer, br *bufio.Reader, n int64) error {
+	for n > 0 {
+		line, err := br.ReadSlice('\n')
+		if _, werr := w.Write(line); werr != nil {
+			return werr
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n--
+	}
+	return nil
+}
+
+// tailOffset returns the offset of the last n lines of a file by reading
+// backwards in chunks. A trailing newline ends the last line rather than
+// starting another one.
+func tailOffset(r io.ReadSeeker, size int64, n int64) (int64, error) {
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+
+	end := size
+	for end > 0 {
+		start := max(0, end-int64(len(*buf)))
+		chunk := (*buf)[:end-start]
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			n--
+			if n == 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// tailLines reads a stream to the end, keeping its last n lines
+func tailLines(r io.Reader, n int64) ([]byte, error) {
+	br := bufio.NewReaderSize(r, copyBufferSize)
+	lines := make([][]byte, 0, min(n, 1024))
+	next := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if int64(len(lines)) < n {
+				lines = append(lines, line)
+			} else {
+				// Replace the oldest line
+				lines[next] = line
+				next = (next + 1) % len(lines)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes.Join(slices.Concat(lines[next:], lines[:next]), nil), nil
+}
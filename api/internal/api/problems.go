@@ -0,0 +1,67 @@
+package api
+
+import "net/http"
+
+// problem is a kind of problem reported in problem details. Its code is
+// what clients branch on, so each meaning has its own, even where kinds
+// share a status.
+type problem struct {
+	code   string
+	title  string
+	status int
+}
+
+// Problems of requests
+var (
+	problemBadRequest           = problem{"bad_request", "Bad Request", http.StatusBadRequest}
+	problemInvalidParameter     = problem{"invalid_parameter", "Invalid Parameter", http.StatusBadRequest}
+	problemUnauthorized         = problem{"unauthorized", "Unauthorized", http.StatusUnauthorized}
+	problemForbidden            = problem{"forbidden", "Forbidden", http.StatusForbidden}
+	problemConflict             = problem{"conflict", "Conflict", http.StatusConflict}
+	problemPreconditionFailed   = problem{"precondition_failed", "Precondition Failed", http.StatusPreconditionFailed}
+	problemContentTooLarge      = problem{"content_too_large", "Content Too Large", http.StatusRequestEntityTooLarge}
+	problemUnsupportedMediaType = problem{"unsupported_media_type", "Unsupported Media Type", http.StatusUnsupportedMediaType}
+	problemTooManyRequests      = problem{"too_many_requests", "Too Many Requests", http.StatusTooManyRequests}
+)
+
+// Problems of resources that don't exist
+var (
+	problemStorageNotFound  = problem{"storage_not_found", "Storage Not Found", http.StatusNotFound}
+	problemNodeNotFound     = problem{"node_not_found", "Node Not Found", http.StatusNotFound}
+	problemSnapshotNotFound = problem{"snapshot_not_found", "Snapshot Not Found", http.StatusNotFound}
+	problemJobNotFound      = problem{"job_not_found", "Job Not Found", http.StatusNotFound}
+	problemScheduleNotFound = problem{"schedule_not_found", "Schedule Not Found", http.StatusNotFound}
+	problemTokenNotFound    = problem{"token_not_found", "Token Not Found", http.StatusNotFound}
+	problemTagNotFound      = problem{"tag_not_found", "Tag Not Found", http.StatusNotFound}
+	problemPinNotFound      = problem{"pin_not_found", "Pin Not Found", http.StatusNotFound}
+	problemManifestNotFound = problem{"manifest_not_found", "Manifest Not Found", http.StatusNotFound}
+	problemDriveNotFound    = problem{"drive_not_found", "Drive Not Found", http.StatusNotFound}
+	problemCommentNotFound  = problem{"comment_not_found", "Comment Not Found", http.StatusNotFound}
+	problemBookmarkNotFound = problem{"bookmark_not_found", "Bookmark Not Found", http.StatusNotFound}
+)
+
+// Problems of storage operations, see errorProblem
+var (
+	problemPathOutsideRoot   = problem{"path_outside_root", "Path Outside Root", http.StatusBadRequest}
+	problemInvalidPath       = problem{"invalid_path", "Invalid Path", http.StatusBadRequest}
+	problemPermissionDenied  = problem{"permission_denied", "Permission Denied", http.StatusForbidden}
+	problemAlreadyExists     = problem{"already_exists", "Already Exists", http.StatusConflict}
+	problemDirectoryNotEmpty = problem{"directory_not_empty", "Directory Not Empty", http.StatusConflict}
+	problemNotADirectory     = problem{"not_a_directory", "Not A Directory", http.StatusConflict}
+	problemInvalidOffset     = problem{"invalid_offset", "Invalid Offset", http.StatusRequestedRangeNotSatisfiable}
+	problemSpecialFile       = problem{"special_file", "Special File", http.StatusUnprocessableEntity}
+	problemInfectedFile      = problem{"infected_file", "Infected File", http.StatusUnprocessableEntity}
+	problemHookFailed        = problem{"hook_failed", "Hook Failed", http.StatusFailedDependency}
+	problemScanFailed        = problem{"scan_failed", "Scan Failed", http.StatusServiceUnavailable}
+)
+
+// Problems of the server. Operations the server doesn't implement, storages
+// lacking a capability and features that are disabled or not configured are
+// all 501s, told apart by their codes.
+var (
+	problemInternal           = problem{"internal_server_error", "Internal Server Error", http.StatusInternalServerError}
+	problemServiceUnavailable = problem{"service_unavailable", "Service Unavailable", http.StatusServiceUnavailable}
+	problemNotImplemented     = problem{"not_implemented", "Not Implemented", http.StatusNotImplemented}
+	problemNotSupported       = problem{"not_supported", "Not Supported", http.StatusNotImplemented}
+	problemFeatureDisabled    = problem{"feature_disabled", "Feature Disabled", http.StatusNotImplemented}
+)
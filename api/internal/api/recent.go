@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"timeship/internal/recent"
+)
+
+// trackRecent remembers that the user of a request accessed a path if
+// tracking is enabled
+func (s *Server) trackRecent(r *http.Request, kind string, storageName Storage, nodePath string, snapshot *string) {
+	if s.config.Recent == nil {
+		return
+	}
+	e := recent.Entry{Kind: kind, Storage: string(storageName), Path: nodePath}
+	if snapshot != nil {
+		e.Snapshot = *snapshot
+	}
+	s.config.Recent.Track(tagOwner(r), e)
+}
+
+// GetRecent lists the paths the user browsed and downloaded most recently.
+// Paths the user can't see anymore are left out.
+func (s *Server) GetRecent(w http.ResponseWriter, r *http.Request, params GetRecentParams) {
+	if s.config.Recent == nil {
+		s.sendError(w, problemFeatureDisabled, "Tracking recently accessed paths is disabled", r.URL.Path)
+		return
+	}
+	kind := ""
+	if params.Kind != nil {
+		kind = string(*params.Kind)
+	}
+
+	list := RecentList{Entries: []RecentEntry{}}
+	for _, e := range s.config.Recent.List(tagOwner(r), kind) {
+		if !s.visible(r, e.Storage, e.Path) {
+			continue
+		}
+		entry := RecentEntry{
+			Kind:       RecentEntryKind(e.Kind),
+			Storage:    e.Storage,
+			Path:       e.Path,
+			AccessedAt: e.Time.Unix(),
+		}
+		if e.Snapshot != "" {
+			entry.Snapshot = &e.Snapshot
+		}
+		list.Entries = append(list.Entries, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// DeleteRecent forgets the paths the user accessed
+func (s *Server) DeleteRecent(w http.ResponseWriter, r *http.Request) {
+	if s.config.Recent == nil {
+		s.sendError(w, problemFeatureDisabled, "Tracking recently accessed paths is disabled", r.URL.Path)
+		return
+	}
+	s.config.Recent.Forget(tagOwner(r))
+	w.WriteHeader(http.StatusNoContent)
+}
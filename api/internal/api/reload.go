@@ -0,0 +1,195 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"timeship/internal/access"
+	"timeship/internal/storage"
+	"timeship/internal/storage/pinned"
+)
+
+// generation counts the requests started while the server used a set of
+// storages
+type generation struct {
+	requests sync.WaitGroup
+}
+
+// Track is a middleware counting the requests in flight, so storages
+// replaced by Reload are only closed once the requests that may use them are
+// finished, and Drain waits for them. Requests other than health checks are
+// rejected while draining. Event streams aren't counted.
+func (s *Server) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routes[r.Pattern]
+		if route.check != checkPublic {
+			if d := s.drain(); d != nil {
+				s.rejectDraining(w, r, d)
+				return
+			}
+		}
+		// Streams end on their own when draining and don't use storages
+		if route.stream {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if route.check != checkPublic {
+			s.inFlight.Add(1)
+			defer s.inFlight.Add(-1)
+		}
+
+		s.mu.RLock()
+		gen := s.generation
+		gen.requests.Add(1)
+		s.mu.RUnlock()
+		defer gen.requests.Done()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// policy returns the access policy, nil without access control
+func (s *Server) policy() *access.Policy {
+	return s.accessPolicy.Load()
+}
+
+// Reload replaces the storages, the default storage and the access policy,
+// e.g. after the config changed. The server takes over the storages map.
+// Pins created through the API are pinned again to the new storage of the
+// same name if it still has the snapshot. The replaced storages are closed
+// in the background once the requests started before are finished. Added
+// and removed storages are reported like drives that come and go.
+func (s *Server) Reload(storages map[string]storage.Storage, defaultStorage string, policy *access.Policy) error {
+	if defaultStorage != "" {
+		if _, ok := storages[defaultStorage]; !ok {
+			return fmt.Errorf("default storage %q not found in storages map", defaultStorage)
+		}
+	}
+
+	// Pin again without holding the lock, as listing snapshots may be slow
+	s.mu.RLock()
+	var pins []*pinned.Storage
+	seen := map[string]bool{}
+	for name := range s.pins {
+		if pin, ok := s.storages[name].(*pinned.Storage); ok {
+			pins = append(pins, pin)
+			seen[name] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	repinned := map[string]bool{}
+	for _, pin := range pins {
+		name := pin.Name()
+		if _, ok := storages[name]; ok {
+			log.Printf("Pin %s dropped: replaced by a configured storage", name)
+			continue
+		}
+		base, ok := storages[pin.BaseName()]
+		if !ok {
+			log.Printf("Pin %s dropped: storage %s was removed", name, pin.BaseName())
+			continue
+		}
+		store, err := pinned.New(name, base, pin.BaseName(), pin.Snapshot().ID)
+		if err != nil {
+			log.Printf("Pin %s dropped: %v", name, err)
+			continue
+		}
+		storages[name] = store
+		repinned[name] = true
+	}
+
+	s.mu.Lock()
+	for name := range s.pins {
+		if !seen[name] {
+			log.Printf("Pin %s dropped: created while reloading", name)
+		}
+	}
+	replaced, gen := s.storages, s.generation
+	s.storages = storages
+	s.defaultStorage = defaultStorage
+	s.accessPolicy.Store(policy)
+	s.pins = repinned
+	s.generation = &generation{}
+	s.mu.Unlock()
+
+	var added, removed []string
+	for name := range storages {
+		if _, ok := replaced[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for name := range replaced {
+		if _, ok := storages[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	s.storagesChanged(added, removed)
+
+	s.retired.Add(1)
+	go func() {
+		defer s.retired.Done()
+		gen.requests.Wait()
+		closeReplaced(replaced, storages)
+	}()
+	return nil
+}
+
+// closeReplaced closes the replaced storages that support it and aren't
+// still in use
+func closeReplaced(replaced, current map[string]storage.Storage) {
+	for name, store := range replaced {
+		if current[name] == store {
+			continue
+		}
+		if closer, ok := store.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("Error closing storage %s: %v", name, err)
+			}
+		}
+	}
+}
+
+// Close stops the scheduled tasks and snapshot checks, interrupts running
+// jobs and closes the job history, waits for the storages replaced by Reload
+// to be closed, then closes the current storages that support it. Call it
+// once no requests are served anymore.
+func (s *Server) Close() {
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+	if s.freshness != nil {
+		s.freshness.close()
+	}
+	s.config.Jobs.Interrupt()
+	if s.scheduler != nil {
+		s.scheduler.Close()
+	}
+	if s.config.JobHistory != nil {
+		s.config.JobHistory.Close()
+	}
+	s.retired.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	closeReplaced(s.storages, nil)
+}
+
+// PostAdminReload reloads the configuration
+func (s *Server) PostAdminReload(w http.ResponseWriter, r *http.Request) {
+	if s.config.Reload == nil {
+		s.sendError(w, problemFeatureDisabled, "Reloading is not supported", r.URL.Path)
+		return
+	}
+	if err := s.config.Reload(); err != nil {
+		s.sendError(w, problemInternal, "Failed to reload config: "+err.Error(), r.URL.Path)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
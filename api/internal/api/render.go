@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"timeship/internal/render"
+	"timeship/internal/storage"
+)
+
+// GetStoragesStorageRenderPath renders a Markdown or source file as an HTML
+// fragment for previews
+func (s *Server) GetStoragesStorageRenderPath(w http.ResponseWriter, r *http.Request, storageName Storage, path NodePath, params GetStoragesStorageRenderPathParams) {
+	ctx := r.Context()
+
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support reading files", r.URL.Path)
+		return
+	}
+
+	vfPath := url.URL{
+		Scheme: string(storageName),
+		Path:   path,
+	}
+	if params.Snapshot != nil && *params.Snapshot != "" {
+		vfPath.RawQuery = url.Values{"snapshot": {*params.Snapshot}}.Encode()
+	}
+
+	size, err := traceStorage(ctx, "FileSize", reader, vfPath, reader.FileSize)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if size > render.MaxSize {
+		s.sendError(w, problemContentTooLarge, fmt.Sprintf("Files larger than %d bytes are not rendered", render.MaxSize), r.URL.Path)
+		return
+	}
+	mimeType, err := traceStorage(ctx, "MimeType", reader, vfPath, reader.MimeType)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	stream, err := traceStream(ctx, reader, vfPath, reader)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	defer stream.Close()
+	// The file may have grown since its size was checked
+	content, err := io.ReadAll(io.LimitReader(stream, render.MaxSize))
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	html, err := render.Render(path, mimeType, content)
+	if errors.Is(err, render.ErrUnsupported) {
+		s.sendError(w, problemUnsupportedMediaType, err.Error(), r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to render file: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Opened on its own, the fragment can't run scripts or load anything but
+	// images
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src * data:; style-src 'unsafe-inline'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(html)
+}
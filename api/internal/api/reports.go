@@ -0,0 +1,379 @@
+package api
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// errReportFull stops a walk once a report has enough files
+var errReportFull = errors.New("report is full")
+
+// GetStoragesStorageReportsLargest reports the largest files below a directory
+func (s *Server) GetStoragesStorageReportsLargest(w http.ResponseWriter, r *http.Request, storageName Storage, params GetStoragesStorageReportsLargestParams) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	limit := 100
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	if limit < 1 || limit > 10000 {
+		s.sendError(w, problemBadRequest, "Invalid limit, expected 1 to 10000", r.URL.Path)
+		return
+	}
+
+	dir := reportDir(storageName, params.Path)
+	if params.Snapshot != nil && *params.Snapshot != "" {
+		dir.RawQuery = url.Values{"snapshot": {*params.Snapshot}}.Encode()
+	}
+
+	// Keep the largest files seen so far in a min-heap
+	var mu sync.Mutex
+	largest := &fileHeap{}
+	err = walkTree(r.Context(), store, dir, func(node storage.FileNode) error {
+		if node.Type != "file" {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if largest.Len() < limit {
+			heap.Push(largest, node)
+		} else if node.Size > (*largest)[0].Size {
+			(*largest)[0] = node
+			heap.Fix(largest, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	files := []storage.FileNode(*largest)
+	slices.SortFunc(files, func(a, b storage.FileNode) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path.Path, b.Path.Path)
+	})
+
+	rw := s.newReportWriter(w, 0)
+	for _, node := range files {
+		if err := rw.write(toReportFile(node)); err != nil {
+			return
+		}
+	}
+	rw.finish()
+}
+
+// GetStoragesStorageReportsRecent streams files modified within a time window
+// below a directory
+func (s *Server) GetStoragesStorageReportsRecent(w http.ResponseWriter, r *http.Request, storageName Storage, params GetStoragesStorageReportsRecentParams) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	since := 24 * time.Hour
+	if params.Since != nil {
+		since, err = time.ParseDuration(*params.Since)
+		if err != nil || since <= 0 {
+			s.sendError(w, problemBadRequest, "Invalid since, expected a positive duration like 24h", r.URL.Path)
+			return
+		}
+	}
+	limit := 1000
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	if limit < 1 || limit > 100000 {
+		s.sendError(w, problemBadRequest, "Invalid limit, expected 1 to 100000", r.URL.Path)
+		return
+	}
+
+	dir := reportDir(storageName, params.Path)
+
+	var compare *snapshotComparer
+	if params.Compare != nil && *params.Compare {
+		compare, err = newSnapshotComparer(r.Context(), store, dir)
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+	}
+
+	cutoff := time.Now().Add(-since).Unix()
+	rw := s.newReportWriter(w, limit)
+	err = walkTree(r.Context(), store, dir, func(node storage.FileNode) error {
+		if node.Type != "file" || node.LastModified < cutoff {
+			return nil
+		}
+		file := toReportFile(node)
+		if compare != nil {
+			compare.annotate(node, &file)
+		}
+		return rw.write(file)
+	})
+	if err != nil && !errors.Is(err, errReportFull) {
+		if !rw.started() {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		// The status was already sent, so the report just ends early
+		log.Printf("Failed to walk %s: %v", dir.String(), err)
+	}
+	rw.finish()
+}
+
+// reportDir returns the directory a report walks
+func reportDir(storageName Storage, path *ReportPath) url.URL {
+	dir := url.URL{Scheme: string(storageName)}
+	if path != nil {
+		dir.Path = strings.Trim(*path, "/")
+	}
+	return dir
+}
+
+// toReportFile converts a file node to a report line
+func toReportFile(node storage.FileNode) ReportFile {
+	return ReportFile{
+		Path:         strings.TrimPrefix(node.Path.Path, "/"),
+		Size:         node.Size,
+		LastModified: node.LastModified,
+	}
+}
+
+// walkTree calls fn for every node below dir, possibly concurrently. Storages
+// that can't walk trees themselves are walked one listing at a time.
+func walkTree(ctx context.Context, store storage.Storage, dir url.URL, fn func(storage.FileNode) error) error {
+	// Stop walking when the client goes away
+	walkFn := func(node storage.FileNode) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(node)
+	}
+
+	if walker, ok := store.(storage.Walker); ok {
+		_, span := startStorageSpan(ctx, "Walk", store, dir)
+		err := walker.Walk(dir, walkFn)
+		endSpan(span, err)
+		return err
+	}
+
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return listTree(ctx, store, lister, dir, walkFn)
+}
+
+// listTree walks a tree by listing each directory
+func listTree(ctx context.Context, store storage.Storage, lister storage.Lister, dir url.URL, fn func(storage.FileNode) error) error {
+	nodes, err := traceStorage(ctx, "ListContents", store, dir, lister.ListContents)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		err := fn(node)
+		if errors.Is(err, fs.SkipDir) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Links are listed as their target, so don't follow them into cycles
+		if node.Type != "dir" || node.LinkTarget != "" {
+			continue
+		}
+		child := dir
+		child.Path = node.Path.Path
+		if err := listTree(ctx, store, lister, child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileHeap is a min-heap of files by size
+type fileHeap []storage.FileNode
+
+func (h fileHeap) Len() int           { return len(h) }
+func (h fileHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h fileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x any)        { *h = append(*h, x.(storage.FileNode)) }
+func (h *fileHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// snapshotComparer compares files against the latest snapshot of a storage
+type snapshotComparer struct {
+	ctx      context.Context
+	store    storage.Storage
+	snapshot string
+	reader   storage.Reader
+	stater   storage.Stater
+}
+
+// newSnapshotComparer finds the latest snapshot of a directory. Without
+// snapshots, every file is reported as added.
+func newSnapshotComparer(ctx context.Context, store storage.Storage, dir url.URL) (*snapshotComparer, error) {
+	snapshotLister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	stater, ok := store.(storage.Stater)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+
+	snapshots, err := traceStorage(ctx, "ListSnapshots", store, dir, snapshotLister.ListSnapshots)
+	if err != nil {
+		return nil, err
+	}
+	c := &snapshotComparer{ctx: ctx, store: store, reader: reader, stater: stater}
+	if len(snapshots) > 0 {
+		latest := slices.MaxFunc(snapshots, func(a, b storage.Snapshot) int {
+			return cmp.Compare(a.Timestamp, b.Timestamp)
+		})
+		c.snapshot = latest.ID
+	}
+	return c, nil
+}
+
+// annotate adds how a file differs from the snapshot to its report line
+func (c *snapshotComparer) annotate(node storage.FileNode, file *ReportFile) {
+	change := Added
+	if c.snapshot == "" {
+		file.Change = &change
+		return
+	}
+	file.Snapshot = &c.snapshot
+
+	snapPath := node.Path
+	snapPath.RawQuery = url.Values{"snapshot": {c.snapshot}}.Encode()
+	size, err := traceStorage(c.ctx, "FileSize", c.store, snapPath, c.reader.FileSize)
+	if err == nil {
+		var lastModified int64
+		lastModified, err = traceStorage(c.ctx, "LastModified", c.store, snapPath, c.stater.LastModified)
+		if err == nil {
+			change = Unchanged
+			if size != node.Size || lastModified != node.LastModified {
+				change = Modified
+			}
+			file.PreviousSize = &size
+			file.PreviousLastModified = &lastModified
+		}
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		// Leave the change unknown rather than guessing
+		log.Printf("Failed to compare %s with snapshot %s: %v", node.Path.String(), c.snapshot, err)
+		return
+	}
+	file.Change = &change
+}
+
+// reportWriter streams report lines as newline-delimited JSON. Lines may be
+// written concurrently while walking. The status is sent with the first line,
+// so errors before it can still be sent as error responses.
+type reportWriter struct {
+	mu       sync.Mutex
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	enc      *json.Encoder
+	timeout  time.Duration
+	extended time.Time
+	sent     bool
+	limit    int
+	count    int
+}
+
+// newReportWriter creates a writer sending at most limit lines, zero means
+// unlimited
+func (s *Server) newReportWriter(w http.ResponseWriter, limit int) *reportWriter {
+	return &reportWriter{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		enc:     json.NewEncoder(w),
+		timeout: s.config.WriteTimeout,
+		limit:   limit,
+	}
+}
+
+// write sends a line and flushes it to the client. Returns errReportFull
+// once the limit is reached.
+func (rw *reportWriter) write(v any) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.limit > 0 && rw.count >= rw.limit {
+		return errReportFull
+	}
+	rw.sendHeader()
+
+	// Walks may take longer than the write timeout, so only stalled clients
+	// are cut off. Deadlines are extended at most once a second.
+	if now := time.Now(); rw.timeout > 0 && now.Sub(rw.extended) >= time.Second {
+		rw.extended = now
+		rw.rc.SetWriteDeadline(now.Add(rw.timeout))
+	}
+
+	if err := rw.enc.Encode(v); err != nil {
+		return err
+	}
+	rw.count++
+	rw.rc.Flush()
+
+	if rw.limit > 0 && rw.count >= rw.limit {
+		return errReportFull
+	}
+	return nil
+}
+
+// started reports whether the status was sent
+func (rw *reportWriter) started() bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.sent
+}
+
+// finish sends the status if no line was written
+func (rw *reportWriter) finish() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.sendHeader()
+}
+
+// sendHeader sends the status once, rw.mu must be held
+func (rw *reportWriter) sendHeader() {
+	if rw.sent {
+		return
+	}
+	rw.sent = true
+	rw.w.Header().Set("Content-Type", "application/x-ndjson")
+	rw.w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// defaultMaxGap is the longest expected interval between snapshots if not
+// specified, a day with some slack for snapshot jobs running late
+const defaultMaxGap = 25 * time.Hour
+
+// GetStoragesStorageRetention reports the snapshot coverage of a storage
+func (s *Server) GetStoragesStorageRetention(w http.ResponseWriter, r *http.Request, storageName Storage, params GetStoragesStorageRetentionParams) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	snapshotLister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support snapshots", r.URL.Path)
+		return
+	}
+
+	maxGap := defaultMaxGap
+	if params.MaxGap != nil {
+		maxGap, err = time.ParseDuration(*params.MaxGap)
+		if err != nil || maxGap <= 0 {
+			s.sendError(w, problemBadRequest, "Invalid max_gap, expected a positive duration like 25h", r.URL.Path)
+			return
+		}
+	}
+
+	snapshots, err := traceStorage(r.Context(), "ListSnapshots", store, url.URL{Scheme: string(storageName)}, snapshotLister.ListSnapshots)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	snapshots = filterSnapshots(snapshots, params.Type)
+
+	report := analyzeRetention(snapshots, maxGap, time.Local)
+	report.Storage = string(storageName)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// analyzeRetention groups snapshots into calendar periods in the given
+// location and finds gaps between consecutive snapshots longer than maxGap
+func analyzeRetention(snapshots []storage.Snapshot, maxGap time.Duration, loc *time.Location) RetentionReport {
+	timestamps := make([]int64, len(snapshots))
+	for i, snap := range snapshots {
+		timestamps[i] = snap.Timestamp
+	}
+	slices.Sort(timestamps)
+
+	report := RetentionReport{
+		Total:   len(timestamps),
+		Hourly:  bucketTimestamps(timestamps, loc, hourStart),
+		Daily:   bucketTimestamps(timestamps, loc, dayStart),
+		Weekly:  bucketTimestamps(timestamps, loc, weekStart),
+		Monthly: bucketTimestamps(timestamps, loc, monthStart),
+		Gaps:    []RetentionGap{},
+	}
+	if len(timestamps) == 0 {
+		return report
+	}
+
+	report.Oldest = &timestamps[0]
+	report.Newest = &timestamps[len(timestamps)-1]
+
+	// Walk newest first, so gaps are reported in the same order as periods
+	maxGapSeconds := int64(maxGap / time.Second)
+	for i := len(timestamps) - 1; i > 0; i-- {
+		start, end := timestamps[i-1], timestamps[i]
+		if end-start > maxGapSeconds {
+			report.Gaps = append(report.Gaps, RetentionGap{
+				Start:    start,
+				End:      end,
+				Duration: end - start,
+			})
+		}
+	}
+
+	return report
+}
+
+// bucketTimestamps counts sorted timestamps per period, newest period first
+func bucketTimestamps(timestamps []int64, loc *time.Location, periodStart func(time.Time) time.Time) RetentionBuckets {
+	buckets := RetentionBuckets{Periods: []RetentionPeriod{}}
+	for i := len(timestamps) - 1; i >= 0; i-- {
+		start := periodStart(time.Unix(timestamps[i], 0).In(loc)).Unix()
+		last := len(buckets.Periods) - 1
+		if last >= 0 && buckets.Periods[last].Start == start {
+			buckets.Periods[last].Count++
+			continue
+		}
+		buckets.Periods = append(buckets.Periods, RetentionPeriod{Start: start, Count: 1})
+	}
+	buckets.Covered = len(buckets.Periods)
+	return buckets
+}
+
+func hourStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// weekStart returns the start of the ISO week, which starts on Monday
+func weekStart(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, t.Location())
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
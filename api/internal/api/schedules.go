@@ -0,0 +1,431 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"timeship/internal/export"
+	"timeship/internal/jobs"
+	"timeship/internal/schedule"
+	"timeship/internal/storage"
+	"timeship/internal/webhook"
+)
+
+// Actions of scheduled tasks
+const (
+	// ActionIndex indexes new snapshots into the metadata cache
+	ActionIndex = "index"
+
+	// ActionReindex drops the metadata cache of a storage and indexes all
+	// its snapshots again
+	ActionReindex = "reindex"
+
+	// ActionExport exports a directory to another storage
+	ActionExport = "export"
+
+	// ActionPruneTrash purges trashed nodes older than a duration
+	ActionPruneTrash = "prune-trash"
+
+	// ActionRetentionReport reports gaps between snapshots
+	ActionRetentionReport = "retention-report"
+)
+
+// latestSnapshot is the snapshot of scheduled exports resolved to the newest
+// snapshot of the storage when the export starts
+const latestSnapshot = "latest"
+
+// ScheduledTask is a job the server starts whenever its schedule matches
+type ScheduledTask struct {
+	// Name identifies the task in the API
+	Name string
+
+	// Schedule is a cron expression, see schedule.Parse
+	Schedule string
+
+	// Action is what the task does, one of the Action constants
+	Action string
+
+	// Storage is the storage the action works on
+	Storage string
+
+	// Path is the directory to export
+	Path string
+
+	// Snapshot is the snapshot to export from, "latest" for the newest one
+	// when the export starts, the live storage if empty
+	Snapshot string
+
+	// DestinationStorage is the storage exports and retention reports are
+	// written to, defaults to Storage for retention reports
+	DestinationStorage string
+
+	// Destination is the directory exports are written to, or the file
+	// retention reports are written to. Reports are only logged if empty.
+	Destination string
+
+	// Include and Exclude select the exported files, see export.Options
+	Include []string
+	Exclude []string
+
+	// OlderThan is how long trashed nodes are kept by prune-trash
+	OlderThan time.Duration
+
+	// MaxGap is the longest expected interval between snapshots in
+	// retention reports, defaults to 25 hours
+	MaxGap time.Duration
+}
+
+// params describes the task for its jobs
+func (t ScheduledTask) params() map[string]string {
+	params := map[string]string{"storage": t.Storage}
+	set := func(key, value string) {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	set("path", t.Path)
+	set("snapshot", t.Snapshot)
+	set("destination_storage", t.DestinationStorage)
+	set("destination", t.Destination)
+	set("include", strings.Join(t.Include, ","))
+	set("exclude", strings.Join(t.Exclude, ","))
+	if t.OlderThan > 0 {
+		params["older_than"] = t.OlderThan.String()
+	}
+	if t.MaxGap > 0 {
+		params["max_gap"] = t.MaxGap.String()
+	}
+	return params
+}
+
+// scheduledJobs prepares the jobs of scheduled tasks
+func (s *Server) scheduledJobs(tasks []ScheduledTask) ([]jobs.Scheduled, error) {
+	var scheduled []jobs.Scheduled
+	for _, task := range tasks {
+		sched, err := schedule.Parse(task.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("scheduled task %q: %w", task.Name, err)
+		}
+		fn, err := s.taskFunc(task)
+		if err != nil {
+			return nil, fmt.Errorf("scheduled task %q: %w", task.Name, err)
+		}
+		scheduled = append(scheduled, jobs.Scheduled{
+			Name:     task.Name,
+			Expr:     task.Schedule,
+			Schedule: sched,
+			Type:     task.Action,
+			Params:   task.params(),
+			Func:     fn,
+		})
+	}
+	return scheduled, nil
+}
+
+// taskFunc returns the function running the action of a task. Storages are
+// looked up by name on each run, so runs after a reload use the new ones.
+func (s *Server) taskFunc(task ScheduledTask) (jobs.Func, error) {
+	var run func(ctx context.Context, task ScheduledTask, progress func(jobs.Progress)) error
+	switch task.Action {
+	case ActionIndex, ActionReindex:
+		if s.config.MetadataCache == nil {
+			return nil, errors.New("metadata cache is not configured")
+		}
+		run = s.runIndex
+	case ActionExport:
+		if task.DestinationStorage == "" {
+			return nil, errors.New("destination storage is required")
+		}
+		opts := export.Options{Include: task.Include, Exclude: task.Exclude}
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+		run = s.runExport
+	case ActionPruneTrash:
+		if task.OlderThan <= 0 {
+			return nil, errors.New("older than must be positive")
+		}
+		run = s.runPruneTrash
+	case ActionRetentionReport:
+		run = s.runRetentionReport
+	default:
+		return nil, fmt.Errorf("unknown action %q", task.Action)
+	}
+	return func(ctx context.Context, progress func(jobs.Progress)) error {
+		release := s.holdStorages()
+		defer release()
+		return run(ctx, task, progress)
+	}, nil
+}
+
+// runIndex queues the snapshots of a storage for indexing, after dropping
+// its index for reindex, and waits until they're indexed
+func (s *Server) runIndex(ctx context.Context, task ScheduledTask, progress func(jobs.Progress)) error {
+	store, err := s.getStorage(ctx, task.Storage)
+	if err != nil {
+		return err
+	}
+	indexer := s.config.MetadataCache
+	if task.Action == ActionReindex {
+		if err := indexer.Drop(task.Storage); err != nil {
+			return err
+		}
+	}
+	// Only errors of this run fail it
+	before, err := indexer.Status(task.Storage)
+	if err != nil {
+		return err
+	}
+	if err := indexer.EnqueueAll(task.Storage, store); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		status, err := indexer.Status(task.Storage)
+		if err != nil {
+			return err
+		}
+		if status.Queued <= 0 && status.Current == "" {
+			if status.LastError != "" && status.LastError != before.LastError {
+				return errors.New(status.LastError)
+			}
+			progress(jobs.Progress{Files: int64(status.Indexed), Message: fmt.Sprintf("%d snapshots indexed", status.Indexed)})
+			return nil
+		}
+		progress(jobs.Progress{Files: int64(status.Indexed), Message: fmt.Sprintf("%d snapshots queued", status.Queued)})
+		if status.Paused {
+			return errors.New("indexing is paused")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runExport exports a directory of a storage to another storage
+func (s *Server) runExport(ctx context.Context, task ScheduledTask, progress func(jobs.Progress)) error {
+	src, err := s.getStorage(ctx, task.Storage)
+	if err != nil {
+		return err
+	}
+	dst, err := s.getStorage(ctx, task.DestinationStorage)
+	if err != nil {
+		return err
+	}
+
+	from := url.URL{Scheme: task.Storage, Path: strings.Trim(path.Clean("/"+task.Path), "/")}
+	snapshot := task.Snapshot
+	if snapshot == latestSnapshot {
+		if snapshot, err = newestSnapshot(src, task.Storage); err != nil {
+			return err
+		}
+	}
+	if snapshot != "" {
+		from.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	to := url.URL{Scheme: task.DestinationStorage, Path: strings.Trim(path.Clean("/"+task.Destination), "/")}
+
+	opts := export.Options{Include: task.Include, Exclude: task.Exclude}
+	total, err := export.Export(ctx, src, from, dst, to, opts, func(p export.Progress) {
+		progress(jobs.Progress{Files: p.Files, Bytes: p.Bytes})
+	})
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Exported %d files", total.Files)
+	if snapshot != "" {
+		message += " from " + snapshot
+	}
+	progress(jobs.Progress{Files: total.Files, Bytes: total.Bytes, Message: message})
+	return nil
+}
+
+// newestSnapshot returns the ID of the newest snapshot of a storage
+func newestSnapshot(store storage.Storage, storageName string) (string, error) {
+	lister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		return "", fmt.Errorf("snapshots: %w", storage.ErrNotSupported)
+	}
+	snapshots, err := lister.ListSnapshots(url.URL{Scheme: storageName})
+	if err != nil {
+		return "", err
+	}
+	var newest *storage.Snapshot
+	for i, snap := range snapshots {
+		if newest == nil || snap.Timestamp > newest.Timestamp {
+			newest = &snapshots[i]
+		}
+	}
+	if newest == nil {
+		return "", fmt.Errorf("storage %s has no snapshots", storageName)
+	}
+	return newest.ID, nil
+}
+
+// runPruneTrash purges the trashed nodes of a storage deleted longer ago
+// than the task keeps them
+func (s *Server) runPruneTrash(ctx context.Context, task ScheduledTask, progress func(jobs.Progress)) error {
+	store, err := s.getStorage(ctx, task.Storage)
+	if err != nil {
+		return err
+	}
+	trasher, ok := store.(storage.Trasher)
+	if !ok {
+		return fmt.Errorf("trash: %w", storage.ErrNotSupported)
+	}
+	items, err := trasher.ListTrash()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-task.OlderThan).Unix()
+	var purged jobs.Progress
+	for _, item := range items {
+		if item.DeletedAt >= cutoff {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := trasher.PurgeTrash(item.ID); err != nil {
+			return fmt.Errorf("failed to purge %s: %w", item.Path.Path, err)
+		}
+		purged.Files++
+		purged.Bytes += item.Size
+		progress(purged)
+	}
+	purged.Message = fmt.Sprintf("Purged %d items older than %s", purged.Files, task.OlderThan)
+	progress(purged)
+	return nil
+}
+
+// runRetentionReport logs the snapshot coverage of a storage and writes the
+// report to the destination if set
+func (s *Server) runRetentionReport(ctx context.Context, task ScheduledTask, progress func(jobs.Progress)) error {
+	store, err := s.getStorage(ctx, task.Storage)
+	if err != nil {
+		return err
+	}
+	lister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		return fmt.Errorf("snapshots: %w", storage.ErrNotSupported)
+	}
+	snapshots, err := lister.ListSnapshots(url.URL{Scheme: task.Storage})
+	if err != nil {
+		return err
+	}
+
+	maxGap := task.MaxGap
+	if maxGap <= 0 {
+		maxGap = defaultMaxGap
+	}
+	report := analyzeRetention(snapshots, maxGap, time.Local)
+	report.Storage = task.Storage
+	message := fmt.Sprintf("%d snapshots, %d gaps longer than %s", report.Total, len(report.Gaps), maxGap)
+	if report.Newest != nil {
+		message += fmt.Sprintf(", newest %s ago", time.Since(time.Unix(*report.Newest, 0)).Round(time.Minute))
+	}
+	log.Printf("Retention of %s: %s", task.Storage, message)
+	// Warn when snapshots stopped, as the gaps only cover past snapshots
+	switch {
+	case report.Newest == nil:
+		s.notify(webhook.Event{Type: webhook.SnapshotMissing, Storage: task.Storage, Error: "no snapshots"})
+	case time.Since(time.Unix(*report.Newest, 0)) > maxGap:
+		since := time.Unix(*report.Newest, 0).UTC()
+		s.notify(webhook.Event{Type: webhook.SnapshotMissing, Storage: task.Storage, Since: &since})
+	}
+
+	if task.Destination != "" {
+		dstName := task.DestinationStorage
+		if dstName == "" {
+			dstName = task.Storage
+		}
+		dst, err := s.getStorage(ctx, dstName)
+		if err != nil {
+			return err
+		}
+		writer, ok := dst.(storage.Writer)
+		if !ok {
+			return fmt.Errorf("destination: %w", storage.ErrNotSupported)
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		to := url.URL{Scheme: dstName, Path: strings.Trim(path.Clean("/"+task.Destination), "/")}
+		if err := export.CreateParents(dst, to); err != nil {
+			return err
+		}
+		if err := writer.WriteStream(to, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		message += ", written to " + to.Path
+	}
+	progress(jobs.Progress{Files: int64(report.Total), Message: message})
+	return nil
+}
+
+// GetSchedules lists the scheduled jobs with their last runs
+func (s *Server) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	list := ScheduleList{Schedules: []Schedule{}}
+	if s.scheduler != nil {
+		for _, status := range s.scheduler.Status() {
+			sched := Schedule{
+				Name:     status.Name,
+				Schedule: status.Expr,
+				Action:   status.Type,
+				Params:   status.Params,
+			}
+			if !status.Next.IsZero() {
+				next := status.Next.Unix()
+				sched.Next = &next
+			}
+			if status.Last != nil {
+				last := describeJob(*status.Last)
+				sched.Last = &last
+			}
+			list.Schedules = append(list.Schedules, sched)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// PostSchedulesNameRuns starts a scheduled job now
+func (s *Server) PostSchedulesNameRuns(w http.ResponseWriter, r *http.Request, name string) {
+	if s.scheduler == nil {
+		s.sendError(w, problemScheduleNotFound, "No scheduled job "+name, r.URL.Path)
+		return
+	}
+	job, err := s.scheduler.Run(name)
+	switch {
+	case errors.Is(err, jobs.ErrUnknownSchedule):
+		s.sendError(w, problemScheduleNotFound, "No scheduled job "+name, r.URL.Path)
+		return
+	case errors.Is(err, jobs.ErrRunning):
+		s.sendError(w, problemConflict, "The last run of "+name+" is still running", r.URL.Path)
+		return
+	case err != nil:
+		s.sendError(w, problemServiceUnavailable, err.Error(), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/schedules/"+name+"/runs")+"/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(describeJob(job))
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/storage"
+	"timeship/internal/storage/pinned"
+)
+
+const (
+	// defaultSearchLimit is the number of search results per page if not
+	// requested otherwise
+	defaultSearchLimit = 100
+
+	// maxSearchLimit is the maximum number of search results per page
+	maxSearchLimit = 1000
+
+	// searchPageTime is how long a search looks for results before returning
+	// a partial page, so the first results show up quickly in large trees
+	searchPageTime = 2 * time.Second
+
+	// maxSortedSearchResults is the maximum number of results a sorted
+	// search ranks
+	maxSortedSearchResults = 10000
+
+	// sortedSearchTime is how long a sorted search looks for results to rank
+	sortedSearchTime = 10 * time.Second
+)
+
+// errSearchPageDone stops a search once a page is complete
+var errSearchPageDone = errors.New("search page done")
+
+// serveSearch searches the tree below a directory for nodes whose name
+// contains the query and returns a page of them with the cursor of the next
+// page. Unsorted results are paged in walk order as the walk goes on, while
+// sorted ones are ranked as a whole and paged by their offset, so every page
+// of a sorted search walks the tree again.
+func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request, storageName Storage, dirPath string, params GetStoragesStorageNodesPathParams, store storage.Storage, lister storage.Lister) {
+	limit := defaultSearchLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	if limit < 1 || limit > maxSearchLimit {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Invalid limit, expected 1 to %d", maxSearchLimit), r.URL.Path)
+		return
+	}
+	after, offset := "", 0
+	if params.Cursor != nil && *params.Cursor != "" {
+		var err error
+		if params.Sort != nil {
+			offset, err = decodeSortedSearchCursor(*params.Cursor)
+		} else {
+			after, err = decodeSearchCursor(*params.Cursor, dirPath)
+		}
+		if err != nil {
+			s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+			return
+		}
+	}
+
+	query := strings.ToLower(*params.Search)
+	hidden := params.Hidden == nil || *params.Hidden
+	match := func(node storage.FileNode) bool {
+		if !hidden && strings.HasPrefix(node.Basename, ".") {
+			return false
+		}
+		if !s.allowed(r, string(storageName), extractPath(node.Path), access.Read) {
+			return false
+		}
+		if params.Type != nil && string(*params.Type) != node.Type {
+			return false
+		}
+		if params.Filter != nil && !strings.Contains(node.Basename, strings.Trim(*params.Filter, "*")) {
+			return false
+		}
+		return searchScore(node, dirPath, query) > 0
+	}
+	descend := func(node storage.FileNode) bool {
+		if node.Type != "dir" || (!hidden && strings.HasPrefix(node.Basename, ".")) {
+			return false
+		}
+		return s.visible(r, string(storageName), extractPath(node.Path))
+	}
+
+	dir := url.URL{Scheme: string(storageName), Path: dirPath}
+	if params.Snapshot != nil && *params.Snapshot != "" {
+		dir.RawQuery = url.Values{"snapshot": {*params.Snapshot}}.Encode()
+	}
+
+	var nodes []storage.FileNode
+	var cursor string
+	truncated := false
+	if params.Sort != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), sortedSearchTime)
+		defer cancel()
+		all, _, more, err := searchTree(ctx, store, lister, dir, "", maxSortedSearchResults, match, descend)
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		sortSearchResults(all, dirPath, query, *params.Sort, params.Order)
+		nodes = all[min(offset, len(all)):min(offset+limit, len(all))]
+		if offset+limit < len(all) {
+			cursor = encodeSortedSearchCursor(offset + limit)
+		}
+		truncated = more
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), searchPageTime)
+		defer cancel()
+		found, last, more, err := searchTree(ctx, store, lister, dir, after, limit, match, descend)
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		nodes = found
+		if more {
+			cursor = encodeSearchCursor(last)
+		}
+	}
+
+	includePermissions := params.Fields != nil && strings.Contains(*params.Fields, "(permissions)")
+	files := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		nodePath := extractPath(node.Path)
+		parent := path.Dir(nodePath)
+		if parent == "." {
+			parent = ""
+		}
+		apiNode := Node{
+			Path:         nodePath,
+			Type:         NodeType(node.Type),
+			Basename:     node.Basename,
+			Extension:    node.Extension,
+			FileSize:     node.Size,
+			LastModified: node.LastModified,
+			Dir:          &parent,
+		}
+		if node.MimeType != "" {
+			apiNode.MimeType = &node.MimeType
+		}
+		if node.AllocatedSize > 0 {
+			apiNode.AllocatedSize = &node.AllocatedSize
+		}
+		if includePermissions {
+			node.Owner, node.Group = resolveOwner(store, node)
+			setPermissions(&apiNode, node)
+		} else if node.Type == "link" && node.LinkTarget != "" {
+			apiNode.LinkTarget = &node.LinkTarget
+		}
+		files = append(files, apiNode)
+	}
+
+	_, readOnly := store.(*pinned.Storage)
+	response := NodeList{
+		Files:     files,
+		Dirname:   dirPath,
+		Ancestors: ancestors(r.Context(), store, dir),
+		ReadOnly:  readOnly,
+		Storages:  s.visibleStorageNames(r),
+	}
+	if cursor != "" {
+		response.Cursor = &cursor
+	}
+	if truncated {
+		response.Truncated = &truncated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// searchTree walks the tree below dir depth first, listing the children of
+// each directory in name order, and returns the matching nodes visited after
+// the node at the path after, or from the start if empty. The walk stops
+// once limit nodes match or the context is done, returning the path of the
+// last visited node to continue after and whether there is more to walk.
+// Directories are only descended into if descend returns true.
+func searchTree(ctx context.Context, store storage.Storage, lister storage.Lister, dir url.URL, after string, limit int, match, descend func(storage.FileNode) bool) (found []storage.FileNode, last string, more bool, err error) {
+	last = after
+
+	var walk func(u url.URL) error
+	walk = func(u url.URL) error {
+		nodes, err := traceStorage(ctx, "ListContents", store, u, lister.ListContents)
+		if err != nil {
+			// Directories that can't be listed anymore are skipped, but the
+			// search itself stops if it ran out of time
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return nil
+		}
+		slices.SortFunc(nodes, func(a, b storage.FileNode) int {
+			return strings.Compare(path.Base(a.Path.Path), path.Base(b.Path.Path))
+		})
+		for _, node := range nodes {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			nodePath := strings.Trim(node.Path.Path, "/")
+
+			// Nodes up to the cursor were visited on previous pages, except
+			// for the contents of the cursor and its parents
+			resumed := after != "" && (nodePath == after || strings.HasPrefix(after, nodePath+"/"))
+			if after != "" && !resumed && comparePaths(nodePath, after) < 0 {
+				continue
+			}
+
+			if !resumed && match(node) {
+				found = append(found, node)
+			}
+			last = nodePath
+			if len(found) == limit {
+				return errSearchPageDone
+			}
+			if descend(node) {
+				child := node.Path
+				child.RawQuery = dir.RawQuery
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	err = walk(dir)
+	switch {
+	case err == nil:
+		return found, "", false, nil
+	case errors.Is(err, errSearchPageDone), errors.Is(err, context.DeadlineExceeded):
+		return found, last, true, nil
+	default:
+		return nil, "", false, err
+	}
+}
+
+// searchScore rates how well a node matches a lowercase search query, zero
+// if it doesn't match. Names starting with the query rank highest, then
+// names containing it. Queries with a slash also match the path below the
+// searched directory, e.g. "2024/rep", which ranks lowest.
+func searchScore(node storage.FileNode, dirPath, query string) int {
+	name := strings.ToLower(node.Basename)
+	switch {
+	case strings.HasPrefix(name, query):
+		return 3
+	case strings.Contains(name, query):
+		return 2
+	}
+	if strings.Contains(query, "/") {
+		relPath := strings.TrimPrefix(extractPath(node.Path), strings.Trim(dirPath, "/")+"/")
+		if strings.Contains(strings.ToLower(relPath), query) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// sortSearchResults sorts search results by the given field and order,
+// relevance sorts the best matches first. Ties keep the walk order.
+func sortSearchResults(nodes []storage.FileNode, dirPath, query string, field GetStoragesStorageNodesPathParamsSort, order *GetStoragesStorageNodesPathParamsOrder) {
+	desc := order != nil && *order == GetStoragesStorageNodesPathParamsOrderDesc
+
+	compare := func(a, b storage.FileNode) int {
+		switch field {
+		case GetStoragesStorageNodesPathParamsSortRelevance:
+			if c := cmp.Compare(searchScore(b, dirPath, query), searchScore(a, dirPath, query)); c != 0 {
+				return c
+			}
+			// Shallower nodes are more likely what's looked for
+			return cmp.Compare(strings.Count(a.Path.Path, "/"), strings.Count(b.Path.Path, "/"))
+		case GetStoragesStorageNodesPathParamsSortName:
+			return strings.Compare(a.Basename, b.Basename)
+		case GetStoragesStorageNodesPathParamsSortSize:
+			return cmp.Compare(a.Size, b.Size)
+		case GetStoragesStorageNodesPathParamsSortModifiedAt:
+			return cmp.Compare(a.LastModified, b.LastModified)
+		case GetStoragesStorageNodesPathParamsSortType:
+			return strings.Compare(a.Type, b.Type)
+		}
+		return 0
+	}
+
+	slices.SortStableFunc(nodes, func(a, b storage.FileNode) int {
+		if desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+}
+
+// comparePaths compares slash-separated paths in depth-first order, where
+// parents come before their contents and siblings are in name order
+func comparePaths(a, b string) int {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// searchCursorPrefix starts every search cursor, so the cursor of a search
+// that hasn't visited anything yet isn't empty
+const searchCursorPrefix = "after:"
+
+// encodeSearchCursor encodes the path a search continues after as an opaque
+// cursor
+func encodeSearchCursor(after string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(searchCursorPrefix + after))
+}
+
+// decodeSearchCursor decodes a search cursor, which must continue after a
+// path below the searched directory
+func decodeSearchCursor(cursor, dirPath string) (string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), searchCursorPrefix) {
+		return "", fmt.Errorf("invalid cursor")
+	}
+	after := strings.TrimPrefix(string(decoded), searchCursorPrefix)
+	dirPath = strings.Trim(dirPath, "/")
+	if after != "" && dirPath != "" && !strings.HasPrefix(after, dirPath+"/") {
+		return "", fmt.Errorf("cursor is not from a search of %s", dirPath)
+	}
+	return after, nil
+}
+
+// sortedSearchCursorPrefix starts every cursor of a sorted search, which
+// continues at an offset of the ranked results instead of after a path
+const sortedSearchCursorPrefix = "offset:"
+
+// encodeSortedSearchCursor encodes the offset a sorted search continues at as
+// an opaque cursor
+func encodeSortedSearchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sortedSearchCursorPrefix + strconv.Itoa(offset)))
+}
+
+// decodeSortedSearchCursor decodes the cursor of a sorted search
+func decodeSortedSearchCursor(cursor string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	rest, ok := strings.CutPrefix(string(decoded), sortedSearchCursorPrefix)
+	if !ok {
+		return 0, fmt.Errorf("cursor is not from a sorted search")
+	}
+	offset, err := strconv.Atoi(rest)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return offset, nil
+}
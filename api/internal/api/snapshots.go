@@ -1,11 +1,22 @@
 package api
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"timeship/internal/hook"
 	"timeship/internal/storage"
+	"timeship/internal/storage/jail"
+	"timeship/internal/webhook"
 )
 
 // GetStoragesStorageSnapshots handles getting snapshots at storage root
@@ -24,16 +35,16 @@ func (s *Server) GetStoragesStorageSnapshots(w http.ResponseWriter, r *http.Requ
 // GetStoragesStorageSnapshotsPath handles getting snapshots for a specific node
 func (s *Server) GetStoragesStorageSnapshotsPath(w http.ResponseWriter, r *http.Request, storageName Storage, path string, params GetStoragesStorageSnapshotsPathParams) {
 	// Get the storage storage
-	store, err := s.getStorage(string(storageName))
+	store, err := s.getStorage(r.Context(), string(storageName))
 	if err != nil {
-		s.sendError(w, "Storage Not Found", http.StatusNotFound, err.Error(), r.URL.Path)
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
 		return
 	}
 
 	// Check if storage supports snapshots
 	snapshotLister, ok := store.(storage.SnapshotLister)
 	if !ok {
-		s.sendError(w, "Not Supported", http.StatusNotImplemented, "Storage storage does not support snapshots", r.URL.Path)
+		s.sendError(w, problemNotSupported, "Storage storage does not support snapshots", r.URL.Path)
 		return
 	}
 
@@ -43,12 +54,15 @@ func (s *Server) GetStoragesStorageSnapshotsPath(w http.ResponseWriter, r *http.
 	}
 
 	// Get snapshots from the storage
-	snapshots, err := snapshotLister.ListSnapshots(vfPath)
+	snapshots, err := traceStorage(r.Context(), "ListSnapshots", store, vfPath, snapshotLister.ListSnapshots)
 	if err != nil {
-		s.sendError(w, "Error", http.StatusInternalServerError, fmt.Sprintf("Failed to get snapshots: %v", err), r.URL.Path)
+		s.sendStorageError(w, r, fmt.Errorf("failed to get snapshots: %w", err))
 		return
 	}
 
+	snapshots = filterSnapshots(snapshots, params.Type)
+	sortSnapshots(snapshots, params.Sort, params.Order)
+
 	// Apply pagination (limit and offset)
 	limit := 1000
 	if params.Limit != nil {
@@ -74,18 +88,7 @@ func (s *Server) GetStoragesStorageSnapshotsPath(w http.ResponseWriter, r *http.
 	// Convert to API response
 	apiSnapshots := make([]Snapshot, len(snapshots))
 	for i, snap := range snapshots {
-		apiSnapshots[i] = Snapshot{
-			Id:        snap.ID,
-			Type:      SnapshotType(snap.Type),
-			Timestamp: snap.Timestamp,
-			Name:      &snap.Name,
-		}
-		if snap.Size >= 0 {
-			apiSnapshots[i].Size = &snap.Size
-		}
-		if snap.Metadata != nil {
-			apiSnapshots[i].Metadata = (*map[string]interface{})(&snap.Metadata)
-		}
+		apiSnapshots[i] = toAPISnapshot(snap)
 	}
 
 	response := NodeSnapshotsList{
@@ -98,3 +101,258 @@ func (s *Server) GetStoragesStorageSnapshotsPath(w http.ResponseWriter, r *http.
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// filterSnapshots keeps only snapshots of the given types, if any
+func filterSnapshots(snapshots []storage.Snapshot, types *SnapshotsType) []storage.Snapshot {
+	if types == nil || len(*types) == 0 {
+		return snapshots
+	}
+
+	allowed := map[string]bool{}
+	for _, t := range *types {
+		allowed[string(t)] = true
+	}
+
+	filtered := []storage.Snapshot{}
+	for _, snap := range snapshots {
+		if allowed[snap.Type] {
+			filtered = append(filtered, snap)
+		}
+	}
+	return filtered
+}
+
+// sortSnapshots sorts snapshots by the given field and order.
+// Defaults to newest first.
+func sortSnapshots(snapshots []storage.Snapshot, field *GetStoragesStorageSnapshotsPathParamsSort, order *GetStoragesStorageSnapshotsPathParamsOrder) {
+	sortField := GetStoragesStorageSnapshotsPathParamsSortTimestamp
+	if field != nil {
+		sortField = *field
+	}
+	desc := order == nil || *order == GetStoragesStorageSnapshotsPathParamsOrderDesc
+
+	compare := func(a, b storage.Snapshot) int {
+		switch sortField {
+		case GetStoragesStorageSnapshotsPathParamsSortName:
+			if c := strings.Compare(a.Name, b.Name); c != 0 {
+				return c
+			}
+		case GetStoragesStorageSnapshotsPathParamsSortSize:
+			if c := cmp.Compare(a.Size, b.Size); c != 0 {
+				return c
+			}
+		}
+		// Ties are broken by timestamp
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	}
+
+	slices.SortStableFunc(snapshots, func(a, b storage.Snapshot) int {
+		if desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+}
+
+// snapshotSummary describes the snapshots containing a node
+type snapshotSummary struct {
+	count  int
+	newest int64
+}
+
+// snapshotSummaries returns the snapshot summary of each child of a directory,
+// keyed by basename. Each snapshot of the directory is listed once, so this
+// takes one listing per snapshot rather than one snapshot lookup per child.
+// Returns an empty map if the storage doesn't support snapshots.
+func (s *Server) snapshotSummaries(ctx context.Context, store storage.Storage, dir url.URL) map[string]snapshotSummary {
+	summaries := map[string]snapshotSummary{}
+
+	snapshotLister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		return summaries
+	}
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return summaries
+	}
+
+	snapshots, err := traceStorage(ctx, "ListSnapshots", store, dir, snapshotLister.ListSnapshots)
+	if err != nil {
+		log.Printf("Failed to list snapshots of %s: %v", dir.String(), err)
+		return summaries
+	}
+
+	// Indexed snapshots are answered from the metadata cache with a single
+	// query, the rest are listed and queued for indexing
+	snapshots = s.cachedSummaries(store, dir, snapshots, summaries)
+
+	for _, snap := range snapshots {
+		snapDir := dir
+		q := snapDir.Query()
+		q.Set("snapshot", snap.ID)
+		snapDir.RawQuery = q.Encode()
+
+		// The directory may not exist in older snapshots
+		nodes, err := traceStorage(ctx, "ListContents", store, snapDir, lister.ListContents)
+		if err != nil {
+			continue
+		}
+
+		for _, node := range nodes {
+			summary := summaries[node.Basename]
+			summary.count++
+			summary.newest = max(summary.newest, snap.Timestamp)
+			summaries[node.Basename] = summary
+		}
+	}
+
+	return summaries
+}
+
+// cachedSummaries adds the children of a directory in the snapshots indexed by
+// the metadata cache to the summaries. Snapshots that are not indexed yet are
+// returned, so they can be listed directly, and queued for indexing unless
+// indexing is scheduled.
+func (s *Server) cachedSummaries(store storage.Storage, dir url.URL, snapshots []storage.Snapshot, summaries map[string]snapshotSummary) []storage.Snapshot {
+	indexer := s.config.MetadataCache
+	if indexer == nil {
+		return snapshots
+	}
+	cache := indexer.Cache()
+
+	// Homes are answered from the index of their whole storage
+	if j, ok := store.(*jail.Storage); ok {
+		store, dir = j.Base(), j.ToBase(dir)
+	}
+
+	indexed, err := cache.Snapshots(dir.Scheme)
+	if err != nil {
+		log.Printf("Failed to read metadata cache of %s: %v", dir.Scheme, err)
+		return snapshots
+	}
+	children, err := cache.Children(dir.Scheme, strings.Trim(dir.Path, "/"))
+	if err != nil {
+		log.Printf("Failed to read metadata cache of %s: %v", dir.String(), err)
+		return snapshots
+	}
+
+	scheduled := indexer.Scheduled()
+	timestamps := map[string]int64{}
+	remaining := []storage.Snapshot{}
+	for _, snap := range snapshots {
+		if _, ok := indexed[snap.ID]; ok {
+			timestamps[snap.ID] = snap.Timestamp
+			continue
+		}
+		if !scheduled {
+			indexer.Enqueue(dir.Scheme, store, snap)
+		}
+		remaining = append(remaining, snap)
+	}
+
+	for _, child := range children {
+		timestamp, ok := timestamps[child.Snapshot]
+		if !ok {
+			// Indexed, but no longer listed by the storage
+			continue
+		}
+		basename := path.Base(child.Path)
+		summary := summaries[basename]
+		summary.count++
+		summary.newest = max(summary.newest, timestamp)
+		summaries[basename] = summary
+	}
+
+	return remaining
+}
+
+// toAPISnapshot converts a storage snapshot to its API representation
+func toAPISnapshot(snap storage.Snapshot) Snapshot {
+	apiSnapshot := Snapshot{
+		Id:        snap.ID,
+		Type:      SnapshotType(snap.Type),
+		Timestamp: snap.Timestamp,
+		Name:      &snap.Name,
+	}
+	if snap.Size >= 0 {
+		apiSnapshot.Size = &snap.Size
+	}
+	if snap.Metadata != nil {
+		apiSnapshot.Metadata = (*map[string]interface{})(&snap.Metadata)
+	}
+	return apiSnapshot
+}
+
+// getSnapshotManager returns the storage as a SnapshotManager, or sends an error response
+func (s *Server) getSnapshotManager(w http.ResponseWriter, r *http.Request, storageName Storage) (storage.SnapshotManager, bool) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return nil, false
+	}
+
+	manager, ok := store.(storage.SnapshotManager)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support managing snapshots", r.URL.Path)
+		return nil, false
+	}
+	return manager, true
+}
+
+// PostStoragesStorageSnapshots creates a snapshot of the storage
+func (s *Server) PostStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	manager, ok := s.getSnapshotManager(w, r, storageName)
+	if !ok {
+		return
+	}
+
+	// The body is optional, an empty one creates a snapshot with a generated name
+	var request CreateSnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	name := ""
+	if request.Name != nil {
+		name = *request.Name
+	}
+
+	op := hook.Operation{Name: hook.Snapshot, Storage: string(storageName)}
+	if err := s.beforeHooks(r.Context(), op); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	snap, err := manager.CreateSnapshot(name)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	s.notify(webhook.Event{Type: webhook.SnapshotCreated, Storage: string(storageName), Snapshot: snap.ID})
+	op.Snapshot = snap.ID
+	s.afterHooks(op)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toAPISnapshot(snap))
+}
+
+// DeleteStoragesStorageSnapshots destroys a snapshot of the storage
+func (s *Server) DeleteStoragesStorageSnapshots(w http.ResponseWriter, r *http.Request, storageName Storage, params DeleteStoragesStorageSnapshotsParams) {
+	manager, ok := s.getSnapshotManager(w, r, storageName)
+	if !ok {
+		return
+	}
+
+	if params.Id == "" {
+		s.sendError(w, problemBadRequest, "Missing snapshot id", r.URL.Path)
+		return
+	}
+
+	if err := manager.DestroySnapshot(params.Id); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"timeship/internal/storage"
+)
+
+// GetStoragesStorageReportsSnapshots reports the space held by each snapshot
+// of a storage, the snapshots holding the most unique data first
+func (s *Server) GetStoragesStorageReportsSnapshots(w http.ResponseWriter, r *http.Request, storageName Storage, params GetStoragesStorageReportsSnapshotsParams) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	if params.Limit != nil && (*params.Limit < 1 || *params.Limit > 10000) {
+		s.sendError(w, problemBadRequest, "Invalid limit, expected 1 to 10000", r.URL.Path)
+		return
+	}
+
+	reporter, ok := store.(storage.SnapshotSpaceReporter)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not report snapshot space usage", r.URL.Path)
+		return
+	}
+
+	space, err := reporter.SnapshotSpace()
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	report := describeSnapshotSpace(string(storageName), space)
+	if params.Limit != nil && len(report.Snapshots) > *params.Limit {
+		report.Snapshots = report.Snapshots[:*params.Limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// describeSnapshotSpace converts the snapshot space of a storage to its API
+// form, sorting the snapshots by their unique data. The space of all
+// snapshots not held by single ones is shared by several.
+func describeSnapshotSpace(name string, space storage.SnapshotSpace) SnapshotSpaceReport {
+	report := SnapshotSpaceReport{
+		Storage:   name,
+		Dataset:   space.Dataset,
+		Used:      space.Used,
+		Total:     len(space.Snapshots),
+		Snapshots: make([]SnapshotSpaceUsage, len(space.Snapshots)),
+	}
+	for i, snap := range space.Snapshots {
+		report.Unique += snap.Used
+		report.Snapshots[i] = SnapshotSpaceUsage{
+			Id:         snap.ID,
+			Name:       snap.Name,
+			Timestamp:  snap.Timestamp,
+			Used:       snap.Used,
+			Written:    snap.Written,
+			Referenced: snap.Referenced,
+		}
+	}
+	report.Shared = max(report.Used-report.Unique, 0)
+
+	slices.SortStableFunc(report.Snapshots, func(a, b SnapshotSpaceUsage) int {
+		if c := cmp.Compare(b.Used, a.Used); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Timestamp, a.Timestamp)
+	})
+	return report
+}
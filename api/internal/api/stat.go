@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"timeship/internal/access"
+	"timeship/internal/storage"
+)
+
+// maxStatPaths limits how many nodes can be looked up in one request
+const maxStatPaths = 1000
+
+// PostStoragesStorageStat returns the metadata of several nodes, with an
+// error for each node that couldn't be looked up
+func (s *Server) PostStoragesStorageStat(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	var request StatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if len(request.Paths) == 0 || len(request.Paths) > maxStatPaths {
+		s.sendError(w, problemBadRequest, fmt.Sprintf("Expected 1 to %d paths", maxStatPaths), r.URL.Path)
+		return
+	}
+
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	lister, canList := store.(storage.Lister)
+	reader, canRead := store.(storage.Reader)
+	if !canList && !canRead {
+		s.sendError(w, problemNotSupported, "Storage does not support listing or reading", r.URL.Path)
+		return
+	}
+	includePermissions := request.Fields != nil && strings.Contains(*request.Fields, "(permissions)")
+	includeTimes := request.Fields != nil && strings.Contains(*request.Fields, "(times)")
+
+	stat := &nodeStater{
+		ctx:      r.Context(),
+		store:    store,
+		lister:   lister,
+		reader:   reader,
+		listings: map[string]listing{},
+	}
+	result := StatResult{Results: make([]StatItemResult, len(request.Paths))}
+	for i, p := range request.Paths {
+		nodePath := strings.Trim(path.Clean("/"+p), "/")
+		item := StatItemResult{Path: nodePath}
+
+		vfPath := url.URL{Scheme: string(storageName), Path: nodePath}
+		if request.Snapshot != nil && *request.Snapshot != "" {
+			vfPath.RawQuery = url.Values{"snapshot": {*request.Snapshot}}.Encode()
+		}
+
+		// Nodes the user can't read don't reveal whether they exist
+		if !s.allowed(r, string(storageName), nodePath, access.Read) {
+			msg, code := "Access denied", problemForbidden.code
+			item.Error, item.Code = &msg, &code
+		} else if node, err := stat.node(vfPath, includePermissions); err != nil {
+			msg, code := err.Error(), errorProblem(err).code
+			item.Error, item.Code = &msg, &code
+		} else {
+			if includeTimes {
+				setTimes(&node, readNodeTimes(r.Context(), store, vfPath))
+			}
+			item.Node = &node
+		}
+		result.Results[i] = item
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// listing is a directory listing or why it failed
+type listing struct {
+	nodes []storage.FileNode
+	err   error
+}
+
+// nodeStater looks up nodes in the listings of their parents, listing each
+// parent once
+type nodeStater struct {
+	ctx      context.Context
+	store    storage.Storage
+	lister   storage.Lister
+	reader   storage.Reader
+	listings map[string]listing
+}
+
+// node returns the metadata of a node. Storages that can't list parents
+// only return files.
+func (n *nodeStater) node(vfPath url.URL, includePermissions bool) (Node, error) {
+	if vfPath.Path == "" {
+		if n.lister == nil {
+			return Node{}, fmt.Errorf("listing directories: %w", storage.ErrNotSupported)
+		}
+		if _, err := n.list(vfPath); err != nil {
+			return Node{}, err
+		}
+		return Node{Path: "", Type: Dir}, nil
+	}
+
+	if n.lister != nil {
+		parent := vfPath
+		parent.Path = path.Dir(vfPath.Path)
+		if parent.Path == "." {
+			parent.Path = ""
+		}
+		nodes, err := n.list(parent)
+		if err == nil {
+			name := path.Base(vfPath.Path)
+			for _, node := range nodes {
+				if node.Basename == name {
+					return toListedNode(n.store, node, includePermissions), nil
+				}
+			}
+			return Node{}, fmt.Errorf("%s: %w", vfPath.Path, fs.ErrNotExist)
+		}
+		if n.reader == nil {
+			return Node{}, err
+		}
+	}
+	return readFileNode(n.ctx, n.reader, vfPath.Path, vfPath)
+}
+
+// list returns the listing of a directory, listing it on first use
+func (n *nodeStater) list(dir url.URL) ([]storage.FileNode, error) {
+	key := dir.String()
+	if l, ok := n.listings[key]; ok {
+		return l.nodes, l.err
+	}
+	nodes, err := traceStorage(n.ctx, "ListContents", n.store, dir, n.lister.ListContents)
+	n.listings[key] = listing{nodes: nodes, err: err}
+	return nodes, err
+}
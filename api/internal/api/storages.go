@@ -2,20 +2,21 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
 	"net/http"
-	"sort"
+	"slices"
+
+	"timeship/internal/storage"
+	"timeship/internal/storage/pinned"
 )
 
 // GetStorages lists all available storage backends
 func (s *Server) GetStorages(w http.ResponseWriter, r *http.Request) {
-	// Build list of available storages
-	storages := make([]string, 0, len(s.storages))
-	for name := range s.storages {
-		storages = append(storages, name)
-	}
-
-	// Sort alphabetically
-	sort.Strings(storages)
+	// Build list of available storages, sorted alphabetically
+	storages := s.visibleStorageNames(r)
 
 	response := struct {
 		Storages []string `json:"storages"`
@@ -27,3 +28,76 @@ func (s *Server) GetStorages(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// AddStorage adds a storage while the server is running, e.g. for a drive
+// that was mounted, failing with fs.ErrExist if the name is taken. The
+// server takes over the storage.
+func (s *Server) AddStorage(name string, store storage.Storage) error {
+	s.mu.Lock()
+	if _, ok := s.storages[name]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("storage %s: %w", name, fs.ErrExist)
+	}
+	s.storages[name] = store
+	s.mu.Unlock()
+
+	s.storagesChanged([]string{name}, nil)
+	return nil
+}
+
+// RemoveStorage removes a storage added by AddStorage or the config, with
+// the snapshots pinned from it, e.g. because its drive was unmounted.
+// Returns false if there's no such storage. The storage is closed in the
+// background once the requests that may use it are finished.
+func (s *Server) RemoveStorage(name string) bool {
+	s.mu.Lock()
+	store, ok := s.storages[name]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	removed := map[string]storage.Storage{name: store}
+	delete(s.storages, name)
+	for pinName, other := range s.storages {
+		if pin, ok := other.(*pinned.Storage); ok && pin.BaseName() == name {
+			delete(s.storages, pinName)
+			delete(s.pins, pinName)
+			removed[pinName] = pin
+		}
+	}
+	if s.defaultStorage == name {
+		s.defaultStorage = ""
+	}
+	gen := s.generation
+	s.generation = &generation{}
+	s.mu.Unlock()
+
+	s.retired.Add(1)
+	go func() {
+		defer s.retired.Done()
+		gen.requests.Wait()
+		closeReplaced(removed, nil)
+	}()
+
+	names := slices.Sorted(maps.Keys(removed))
+	s.storagesChanged(nil, names)
+	return true
+}
+
+// PostStoragesStorageEject stops serving the storage of a removable drive,
+// so it can be unmounted
+func (s *Server) PostStoragesStorageEject(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	if s.config.EjectDrive == nil {
+		s.sendError(w, problemFeatureDisabled, "Removable drives are not configured", r.URL.Path)
+		return
+	}
+	if err := s.config.EjectDrive(string(storageName)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			s.sendError(w, problemDriveNotFound, err.Error(), r.URL.Path)
+			return
+		}
+		s.sendError(w, problemInternal, err.Error(), r.URL.Path)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
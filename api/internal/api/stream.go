@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// streamChunkSize is how much of a download is written before its write
+// deadline is extended again
+const streamChunkSize = 128 << 10
+
+// rateLimitBurst is the most a rate limited download writes at once
+const rateLimitBurst = 64 << 10
+
+// copyBufferSize is the size of pooled copy buffers, the same as io.Copy uses
+const copyBufferSize = 32 << 10
+
+// copyBufferPool reuses buffers of content digests, tail previews and
+// followed files, so serving many of them doesn't allocate a buffer for
+// each. Plain file responses don't use it, as they read by themselves with
+// sendfile or buffers pooled by net/http.
+var copyBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// copyBuffer copies src to dst with a pooled buffer. Writers that read by
+// themselves are used directly.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	if _, ok := dst.(io.ReaderFrom); ok {
+		return io.Copy(dst, src)
+	}
+	buf := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(buf)
+	// Hide WriterTo of src, e.g. of files, which would allocate a buffer
+	return io.CopyBuffer(dst, struct{ io.Reader }{src}, *buf)
+}
+
+// newRateLimiter returns a limiter of bytes per second, or nil if unlimited
+func newRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(min(bytesPerSecond, rateLimitBurst)))
+}
+
+// downloadLimiters returns the rate limiters a new download is subject to
+func (s *Server) downloadLimiters() []*rate.Limiter {
+	var limiters []*rate.Limiter
+	if limiter := newRateLimiter(s.config.StreamRateLimit); limiter != nil {
+		limiters = append(limiters, limiter)
+	}
+	if s.totalLimiter != nil {
+		limiters = append(limiters, s.totalLimiter)
+	}
+	return limiters
+}
+
+// copyResponse copies a stream to the response in chunks, waiting for the
+// rate limits after each one. The write deadline is extended before each
+// chunk, so a long download is only cut off if a chunk takes longer than the
+// write timeout, and waiting for the rate limit doesn't count towards it.
+func (s *Server) copyResponse(ctx context.Context, w http.ResponseWriter, stream io.Reader) (int64, error) {
+	timeout := s.config.WriteTimeout
+	limiters := s.downloadLimiters()
+	if timeout <= 0 && len(limiters) == 0 {
+		return io.Copy(w, stream)
+	}
+
+	chunk := int64(streamChunkSize)
+	for _, limiter := range limiters {
+		chunk = min(chunk, int64(limiter.Burst()))
+	}
+
+	// Copy from a limited file directly, sendfile only looks through one
+	// LimitedReader
+	remaining := int64(-1)
+	if lr, ok := stream.(*io.LimitedReader); ok {
+		stream, remaining = lr.R, lr.N
+	}
+
+	rc := http.NewResponseController(w)
+	var written int64
+	for {
+		if timeout > 0 {
+			err := rc.SetWriteDeadline(time.Now().Add(timeout))
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return written, err
+			}
+		}
+		size := chunk
+		if remaining >= 0 {
+			size = min(size, remaining-written)
+		}
+		if size == 0 {
+			return written, nil
+		}
+		// CopyN keeps the file reachable for sendfile through a LimitedReader
+		n, err := io.CopyN(w, stream, size)
+		written += n
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		// Pay for the written chunk before the next one
+		for _, limiter := range limiters {
+			if err := limiter.WaitN(ctx, int(n)); err != nil {
+				return written, err
+			}
+		}
+	}
+}
+
+// responseCopier copies content written with ReadFrom, as done by
+// http.ServeContent, through copyResponse
+type responseCopier struct {
+	http.ResponseWriter
+	ctx    context.Context
+	server *Server
+}
+
+func (c *responseCopier) ReadFrom(src io.Reader) (int64, error) {
+	return c.server.copyResponse(c.ctx, c.ResponseWriter, src)
+}
+
+// Unwrap allows http.ResponseController to reach the connection
+func (c *responseCopier) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// responseStream writes content produced by writers like archives through
+// copyResponse, so it's rate limited and extends the write deadline
+type responseStream struct {
+	ctx    context.Context
+	w      http.ResponseWriter
+	server *Server
+}
+
+func (rs *responseStream) Write(p []byte) (int, error) {
+	n, err := rs.server.copyResponse(rs.ctx, rs.w, bytes.NewReader(p))
+	return int(n), err
+}
+
+// deadlineReader extends the read and write deadlines of a request while its
+// body is read, so a long upload is only cut off if it stalls and the
+// response can still be written after it
+type deadlineReader struct {
+	r            io.Reader
+	rc           *http.ResponseController
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	extended     time.Time
+}
+
+// newDeadlineReader wraps a reader of the request body of w
+func (s *Server) newDeadlineReader(w http.ResponseWriter, r io.Reader) io.Reader {
+	if s.config.ReadTimeout <= 0 && s.config.WriteTimeout <= 0 {
+		return r
+	}
+	return &deadlineReader{
+		r:            r,
+		rc:           http.NewResponseController(w),
+		readTimeout:  s.config.ReadTimeout,
+		writeTimeout: s.config.WriteTimeout,
+	}
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	// Deadlines are extended at most once a second rather than on every read
+	if now := time.Now(); now.Sub(d.extended) >= time.Second {
+		d.extended = now
+		if d.readTimeout > 0 {
+			d.rc.SetReadDeadline(now.Add(d.readTimeout))
+		}
+		if d.writeTimeout > 0 {
+			d.rc.SetWriteDeadline(now.Add(d.writeTimeout))
+		}
+	}
+	return d.r.Read(p)
+}
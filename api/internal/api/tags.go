@@ -0,0 +1,415 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"timeship/internal/access"
+	"timeship/internal/storage"
+	"timeship/internal/storage/jail"
+	"timeship/internal/tags"
+)
+
+// tagOwner returns the name of the user whose tags and bookmarks a request
+// manages, empty without access control. Tokens act for the user that
+// issued them.
+func tagOwner(r *http.Request) string {
+	user := access.FromContext(r.Context())
+	switch {
+	case user == nil:
+		return ""
+	case user.Owner != nil:
+		return user.Owner.Name
+	}
+	return user.Name
+}
+
+// tagStore returns the tag database, or sends an error response if it's not
+// configured
+func (s *Server) tagStore(w http.ResponseWriter, r *http.Request) (*tags.Store, bool) {
+	if s.config.Tags == nil {
+		s.sendError(w, problemFeatureDisabled, "Tag database is not configured", r.URL.Path)
+		return nil, false
+	}
+	return s.config.Tags, true
+}
+
+// baseNode returns the storage of a node without the home of the user and
+// the path of the node in it. Tags and bookmarks are stored with these
+// paths, so renames by any user move them.
+func baseNode(store storage.Storage, u url.URL) (storage.Storage, url.URL) {
+	if j, ok := store.(*jail.Storage); ok {
+		return j.Base(), j.ToBase(u)
+	}
+	return store, u
+}
+
+// userPath converts the path of a stored node to the path seen through a
+// storage of the user, false if it's outside the home of the user
+func userPath(store storage.Storage, basePath string) (string, bool) {
+	j, ok := store.(*jail.Storage)
+	if !ok || j.Root() == "" {
+		return basePath, true
+	}
+	if basePath == j.Root() {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(basePath, j.Root()+"/"); ok {
+		return rest, true
+	}
+	return "", false
+}
+
+// nodeState returns the type of a node and whether it exists. Nodes of
+// storages that can't tell are assumed to exist with an unknown type.
+func nodeState(ctx context.Context, store storage.Storage, u url.URL) (*NodeType, bool) {
+	existence, ok := store.(storage.Existence)
+	if !ok {
+		return nil, true
+	}
+	if dirExists, err := traceStorage(ctx, "DirectoryExists", store, u, existence.DirectoryExists); err != nil {
+		return nil, true
+	} else if dirExists {
+		nodeType := Dir
+		return &nodeType, true
+	}
+	if fileExists, err := traceStorage(ctx, "FileExists", store, u, existence.FileExists); err != nil {
+		return nil, true
+	} else if fileExists {
+		nodeType := File
+		return &nodeType, true
+	}
+	return nil, false
+}
+
+// nodeIdentity returns the identity of a node that survives renames, empty
+// if the storage can't tell
+func nodeIdentity(store storage.Storage, u url.URL) string {
+	identifier, ok := store.(storage.Identifier)
+	if !ok {
+		return ""
+	}
+	id, err := identifier.Identity(u)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// findRenamed looks for a node renamed outside of the API among the nodes of
+// its directory by its identity and returns its new path
+func findRenamed(ctx context.Context, store storage.Storage, node tags.Node) (string, bool) {
+	lister, ok := store.(storage.Lister)
+	if node.Identity == "" || !ok {
+		return "", false
+	}
+	dir := path.Dir(node.Path)
+	if dir == "." {
+		dir = ""
+	}
+	dirURL := url.URL{Scheme: node.Storage, Path: dir}
+	nodes, err := traceStorage(ctx, "ListContents", store, dirURL, lister.ListContents)
+	if err != nil {
+		return "", false
+	}
+	for _, n := range nodes {
+		if nodeIdentity(store, n.Path) == node.Identity {
+			return extractPath(n.Path), true
+		}
+	}
+	return "", false
+}
+
+// resolveTagged describes a tagged or bookmarked node for the user of a
+// request, following it if it was renamed outside of the API. Nodes the user
+// can't see are left out.
+func (s *Server) resolveTagged(r *http.Request, store *tags.Store, node tags.Node) (TaggedNode, bool) {
+	ctx := r.Context()
+	view, err := s.getStorage(ctx, node.Storage)
+	if err != nil {
+		// Nodes of removed storages are missing until the storage is back
+		if !s.visible(r, node.Storage, node.Path) {
+			return TaggedNode{}, false
+		}
+		return TaggedNode{Storage: node.Storage, Path: node.Path, Missing: true}, true
+	}
+	nodePath, ok := userPath(view, node.Path)
+	if !ok || !s.visible(r, node.Storage, nodePath) {
+		return TaggedNode{}, false
+	}
+
+	base, _ := baseNode(view, url.URL{})
+	nodeType, exists := nodeState(ctx, base, url.URL{Scheme: node.Storage, Path: node.Path})
+	if !exists {
+		if renamed, ok := findRenamed(ctx, base, node); ok {
+			if err := store.Move(node.Storage, node.Path, renamed); err != nil {
+				log.Printf("Failed to move tags of renamed %s://%s: %v", node.Storage, node.Path, err)
+			}
+			nodePath, ok = userPath(view, renamed)
+			if !ok || !s.visible(r, node.Storage, nodePath) {
+				return TaggedNode{}, false
+			}
+			nodeType, exists = nodeState(ctx, base, url.URL{Scheme: node.Storage, Path: renamed})
+		}
+	}
+	return TaggedNode{Storage: node.Storage, Path: nodePath, Type: nodeType, Missing: !exists}, true
+}
+
+// tagTarget returns the storage of a node of a request without the home of
+// the user and the path of the node in it, or sends an error response
+func (s *Server) tagTarget(w http.ResponseWriter, r *http.Request, storageName, nodePath string) (storage.Storage, url.URL, bool) {
+	view, err := s.getStorage(r.Context(), storageName)
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return nil, url.URL{}, false
+	}
+	base, u := baseNode(view, url.URL{Scheme: storageName, Path: strings.Trim(path.Clean("/"+nodePath), "/")})
+	u.Path = strings.Trim(u.Path, "/")
+	return base, u, true
+}
+
+// moveTags moves the tags and bookmarks of a node renamed through the API
+func (s *Server) moveTags(store storage.Storage, from, to url.URL) {
+	if s.config.Tags == nil {
+		return
+	}
+	_, baseFrom := baseNode(store, from)
+	_, baseTo := baseNode(store, to)
+	if err := s.config.Tags.Move(from.Scheme, extractPath(baseFrom), extractPath(baseTo)); err != nil {
+		log.Printf("Failed to move tags of %s: %v", from.String(), err)
+	}
+}
+
+// sendNodeTags sends the tags of the user of a request on a node
+func (s *Server) sendNodeTags(w http.ResponseWriter, r *http.Request, store *tags.Store, u url.URL) {
+	nodeTags, err := store.NodeTags(tagOwner(r), u.Scheme, u.Path)
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to list tags: "+err.Error(), r.URL.Path)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(NodeTags{Tags: nodeTags})
+}
+
+// GetTags lists the tags of the user with the number of nodes they're on
+func (s *Server) GetTags(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	counts, err := store.Tags(tagOwner(r))
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to list tags: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	list := TagList{Tags: make([]TagSummary, len(counts))}
+	for i, c := range counts {
+		list.Tags[i] = TagSummary{Tag: c.Tag, Count: c.Count}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetTagsTag lists the nodes the user put a tag on
+func (s *Server) GetTagsTag(w http.ResponseWriter, r *http.Request, tag string) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	tagged, err := store.Tagged(tagOwner(r), tag)
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to list tagged nodes: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	list := TaggedNodeList{Tag: tag, Nodes: []TaggedNode{}}
+	for _, node := range tagged {
+		if n, ok := s.resolveTagged(r, store, node); ok {
+			list.Nodes = append(list.Nodes, n)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetStoragesStorageTagsPath lists the tags the user put on a node
+func (s *Server) GetStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	_, u, ok := s.tagTarget(w, r, string(storageName), nodePath)
+	if !ok {
+		return
+	}
+	s.sendNodeTags(w, r, store, u)
+}
+
+// PostStoragesStorageTagsPath puts a tag on a node
+func (s *Server) PostStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	var request TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if !tags.ValidTag(request.Tag) {
+		s.sendError(w, problemBadRequest, "Invalid tag, expected up to 100 bytes without slashes, control characters or surrounding spaces", r.URL.Path)
+		return
+	}
+	base, u, ok := s.tagTarget(w, r, string(storageName), nodePath)
+	if !ok {
+		return
+	}
+	if _, exists := nodeState(r.Context(), base, u); !exists {
+		s.sendStorageError(w, r, &fs.PathError{Op: "tag", Path: nodePath, Err: fs.ErrNotExist})
+		return
+	}
+
+	node := tags.Node{Storage: u.Scheme, Path: u.Path, Identity: nodeIdentity(base, u)}
+	if err := store.Tag(tagOwner(r), request.Tag, node); err != nil {
+		s.sendError(w, problemInternal, "Failed to tag node: "+err.Error(), r.URL.Path)
+		return
+	}
+	s.sendNodeTags(w, r, store, u)
+}
+
+// DeleteStoragesStorageTagsPath removes a tag the user put on a node. Nodes
+// that are missing can be untagged too.
+func (s *Server) DeleteStoragesStorageTagsPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath, params DeleteStoragesStorageTagsPathParams) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	_, u, ok := s.tagTarget(w, r, string(storageName), nodePath)
+	if !ok {
+		return
+	}
+	err := store.Untag(tagOwner(r), params.Tag, u.Scheme, u.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.sendError(w, problemTagNotFound, "tag not found: "+params.Tag, r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to untag node: "+err.Error(), r.URL.Path)
+		return
+	}
+	s.sendNodeTags(w, r, store, u)
+}
+
+// toAPIBookmark converts a bookmark to its API representation
+func toAPIBookmark(b tags.Bookmark, node TaggedNode) Bookmark {
+	return Bookmark{
+		Id:        b.ID,
+		Name:      b.Name,
+		Storage:   node.Storage,
+		Path:      node.Path,
+		Type:      node.Type,
+		Missing:   node.Missing,
+		CreatedAt: b.CreatedAt,
+	}
+}
+
+// GetBookmarks lists the bookmarks of the user
+func (s *Server) GetBookmarks(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	bookmarks, err := store.Bookmarks(tagOwner(r))
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to list bookmarks: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	list := BookmarkList{Bookmarks: []Bookmark{}}
+	for _, b := range bookmarks {
+		if node, ok := s.resolveTagged(r, store, b.Node); ok {
+			list.Bookmarks = append(list.Bookmarks, toAPIBookmark(b, node))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// PostBookmarks bookmarks a node the user can see
+func (s *Server) PostBookmarks(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	var request CreateBookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if request.Storage == "" {
+		s.sendError(w, problemBadRequest, "Missing storage", r.URL.Path)
+		return
+	}
+	nodePath := strings.Trim(path.Clean("/"+request.Path), "/")
+	if !s.visible(r, request.Storage, nodePath) {
+		s.sendForbidden(w, r)
+		return
+	}
+	base, u, ok := s.tagTarget(w, r, request.Storage, nodePath)
+	if !ok {
+		return
+	}
+	nodeType, exists := nodeState(r.Context(), base, u)
+	if !exists {
+		s.sendStorageError(w, r, &fs.PathError{Op: "bookmark", Path: nodePath, Err: fs.ErrNotExist})
+		return
+	}
+
+	name := path.Base("/" + nodePath)
+	if nodePath == "" {
+		name = request.Storage
+	}
+	if request.Name != nil && *request.Name != "" {
+		name = *request.Name
+	}
+	node := tags.Node{Storage: u.Scheme, Path: u.Path, Identity: nodeIdentity(base, u)}
+	b, err := store.AddBookmark(tagOwner(r), name, node)
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to create bookmark: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toAPIBookmark(b, TaggedNode{Storage: request.Storage, Path: nodePath, Type: nodeType}))
+}
+
+// DeleteBookmarksId deletes a bookmark of the user
+func (s *Server) DeleteBookmarksId(w http.ResponseWriter, r *http.Request, id string) {
+	store, ok := s.tagStore(w, r)
+	if !ok {
+		return
+	}
+	err := store.DeleteBookmark(tagOwner(r), id)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.sendError(w, problemBookmarkNotFound, "bookmark not found: "+id, r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to delete bookmark: "+err.Error(), r.URL.Path)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
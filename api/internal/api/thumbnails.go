@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"timeship/internal/pdfpreview"
+	"timeship/internal/storage"
+)
+
+// GetStoragesStorageThumbnailsPath renders a thumbnail of the first page of
+// a PDF
+func (s *Server) GetStoragesStorageThumbnailsPath(w http.ResponseWriter, r *http.Request, storageName Storage, path NodePath, params GetStoragesStorageThumbnailsPathParams) {
+	ctx := r.Context()
+
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support reading files", r.URL.Path)
+		return
+	}
+	if s.config.PDFRenderer == nil {
+		s.sendError(w, problemFeatureDisabled, "PDF thumbnails are not configured", r.URL.Path)
+		return
+	}
+
+	vfPath := url.URL{
+		Scheme: string(storageName),
+		Path:   path,
+	}
+	if params.Snapshot != nil && *params.Snapshot != "" {
+		vfPath.RawQuery = url.Values{"snapshot": {*params.Snapshot}}.Encode()
+	}
+
+	size, err := traceStorage(ctx, "FileSize", reader, vfPath, reader.FileSize)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	mimeType, err := traceStorage(ctx, "MimeType", reader, vfPath, reader.MimeType)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	if !pdfpreview.Supported(path, mimeType) {
+		s.sendError(w, problemUnsupportedMediaType, "Thumbnails are only rendered for PDFs", r.URL.Path)
+		return
+	}
+	var lastModified int64
+	if stater, ok := reader.(storage.Stater); ok {
+		lastModified, err = traceStorage(ctx, "LastModified", reader, vfPath, stater.LastModified)
+		if err != nil {
+			log.Printf("Failed to get last modified time for %s: %v", vfPath.String(), err)
+		}
+	}
+
+	// A changed file gets a new thumbnail
+	key := fmt.Sprintf("%s %d %d", vfPath.String(), size, lastModified)
+	png, err := s.config.PDFRenderer.Render(ctx, key, func() (io.ReadCloser, error) {
+		return traceStream(ctx, reader, vfPath, reader)
+	})
+	if err != nil {
+		s.sendStorageError(w, r, fmt.Errorf("failed to render thumbnail: %w", err))
+		return
+	}
+
+	var modTime time.Time
+	if lastModified > 0 {
+		modTime = time.Unix(lastModified, 0)
+	}
+	w.Header().Set("Content-Type", "image/png")
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(png))
+}
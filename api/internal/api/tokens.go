@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/tokens"
+)
+
+// toAPIToken converts an issued token to its API representation
+func toAPIToken(t tokens.Token) Token {
+	apiToken := Token{
+		Id:        t.ID,
+		Name:      t.Name,
+		Rules:     make([]TokenRule, len(t.Rules)),
+		CreatedAt: t.CreatedAt,
+	}
+	for i, rule := range t.Rules {
+		apiToken.Rules[i] = TokenRule{Path: rule.String()}
+		for _, permission := range rule.Permissions {
+			apiToken.Rules[i].Allow = append(apiToken.Rules[i].Allow, TokenRuleAllow(permission))
+		}
+	}
+	if t.ExpiresAt > 0 {
+		apiToken.ExpiresAt = &t.ExpiresAt
+	}
+	return apiToken
+}
+
+// tokenOwner returns the user managing tokens, or sends an error response.
+// Only configured users with a token manage tokens, not tokens themselves.
+func (s *Server) tokenOwner(w http.ResponseWriter, r *http.Request) (*access.User, bool) {
+	if s.config.Tokens == nil || s.policy() == nil {
+		s.sendError(w, problemFeatureDisabled, "Token database is not configured", r.URL.Path)
+		return nil, false
+	}
+	user := access.FromContext(r.Context())
+	if user == nil || user.Token == "" || user.Owner != nil {
+		s.sendError(w, problemForbidden, "Tokens can only be managed by configured users with a token", r.URL.Path)
+		return nil, false
+	}
+	return user, true
+}
+
+// GetTokens lists the tokens issued by the user
+func (s *Server) GetTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	issued, err := s.config.Tokens.List(user.Name)
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to list tokens: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	list := TokenList{Tokens: make([]Token, len(issued))}
+	for i, t := range issued {
+		list.Tokens[i] = toAPIToken(t)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
+
+// PostTokens issues a token with some of the user's permissions
+func (s *Server) PostTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	var request CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if request.Name == "" {
+		s.sendError(w, problemBadRequest, "Missing name", r.URL.Path)
+		return
+	}
+	if len(request.Rules) == 0 {
+		s.sendError(w, problemBadRequest, "Missing rules", r.URL.Path)
+		return
+	}
+	var expiresAt int64
+	if request.ExpiresAt != nil {
+		expiresAt = *request.ExpiresAt
+		if expiresAt <= time.Now().Unix() {
+			s.sendError(w, problemBadRequest, "Expiry must be in the future", r.URL.Path)
+			return
+		}
+	}
+
+	rules := make([]access.Rule, len(request.Rules))
+	for i, rr := range request.Rules {
+		permissions := make([]string, len(rr.Allow))
+		for j, permission := range rr.Allow {
+			permissions[j] = string(permission)
+		}
+		rule, err := access.ParseRule(rr.Path, permissions)
+		if err != nil {
+			s.sendError(w, problemBadRequest, err.Error(), r.URL.Path)
+			return
+		}
+		if !user.Covers(rule) {
+			s.sendError(w, problemForbidden, "Rule "+rule.String()+" grants more than you may", r.URL.Path)
+			return
+		}
+		rules[i] = rule
+	}
+
+	issued, token, err := s.config.Tokens.Create(user.Name, request.Name, rules, expiresAt)
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to create token: "+err.Error(), r.URL.Path)
+		return
+	}
+
+	s.recordShare(r, issued)
+
+	apiToken := toAPIToken(issued)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedToken{
+		Id:        apiToken.Id,
+		Name:      apiToken.Name,
+		Rules:     apiToken.Rules,
+		CreatedAt: apiToken.CreatedAt,
+		ExpiresAt: apiToken.ExpiresAt,
+		Token:     token,
+	})
+}
+
+// DeleteTokensId revokes a token issued by the user
+func (s *Server) DeleteTokensId(w http.ResponseWriter, r *http.Request, id string) {
+	user, ok := s.tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	err := s.config.Tokens.Revoke(user.Name, id)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.sendError(w, problemTokenNotFound, "token not found: "+id, r.URL.Path)
+		return
+	}
+	if err != nil {
+		s.sendError(w, problemInternal, "Failed to revoke token: "+err.Error(), r.URL.Path)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
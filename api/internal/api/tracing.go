@@ -0,0 +1,105 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"timeship/internal/storage"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records storage operations as children of the request span
+var tracer = otel.Tracer("timeship/internal/api")
+
+// startStorageSpan starts a span for a storage operation on a path
+func startStorageSpan(ctx context.Context, op string, store storage.Storage, path url.URL) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("timeship.storage", path.Scheme),
+		attribute.String("timeship.storage.type", fmt.Sprintf("%T", store)),
+		attribute.String("timeship.path", path.Path),
+	}
+	if snapshot := path.Query().Get("snapshot"); snapshot != "" {
+		attrs = append(attrs, attribute.String("timeship.snapshot", snapshot))
+	}
+	return tracer.Start(ctx, "storage."+op, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, marking it as failed if there was an error
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceStorage runs a storage operation on a path in its own span
+func traceStorage[T any](ctx context.Context, op string, store storage.Storage, path url.URL, fn func(url.URL) (T, error)) (T, error) {
+	_, span := startStorageSpan(ctx, op, store, path)
+	v, err := fn(path)
+	endSpan(span, err)
+	return v, err
+}
+
+// traceStream opens a file stream whose span lasts until the stream is
+// closed, so it covers the whole transfer
+func traceStream(ctx context.Context, store storage.Storage, path url.URL, reader storage.Reader) (io.ReadCloser, error) {
+	_, span := startStorageSpan(ctx, "ReadStream", store, path)
+	stream, err := reader.ReadStream(path)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	if !span.IsRecording() {
+		// Keep the stream unwrapped so copies can still use sendfile
+		span.End()
+		return stream, nil
+	}
+	traced := &tracedStream{ReadCloser: stream, span: span}
+	if seeker, ok := stream.(io.Seeker); ok {
+		return &tracedSeekStream{tracedStream: traced, seeker: seeker}, nil
+	}
+	return traced, nil
+}
+
+// tracedStream counts the bytes read from a stream and ends its span on close
+type tracedStream struct {
+	io.ReadCloser
+	span trace.Span
+	n    int64
+	err  error
+}
+
+func (t *tracedStream) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.n += int64(n)
+	if err != nil && err != io.EOF {
+		t.err = err
+	}
+	return n, err
+}
+
+func (t *tracedStream) Close() error {
+	err := t.ReadCloser.Close()
+	t.span.SetAttributes(attribute.Int64("timeship.bytes_read", t.n))
+	endSpan(t.span, cmp.Or(t.err, err))
+	return err
+}
+
+// tracedSeekStream is a tracedStream that keeps its stream seekable, so
+// ranges can still be served
+type tracedSeekStream struct {
+	*tracedStream
+	seeker io.Seeker
+}
+
+func (t *tracedSeekStream) Seek(offset int64, whence int) (int64, error) {
+	return t.seeker.Seek(offset, whence)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"timeship/internal/access"
+	"timeship/internal/activity"
+	"timeship/internal/hook"
+	"timeship/internal/storage"
+	"timeship/internal/webhook"
+)
+
+// getTrasher returns the trash of a storage, sending an error response if unavailable
+func (s *Server) getTrasher(w http.ResponseWriter, r *http.Request, storageName Storage) (storage.Trasher, bool) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return nil, false
+	}
+
+	trasher, ok := store.(storage.Trasher)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage does not support trash", r.URL.Path)
+		return nil, false
+	}
+
+	return trasher, true
+}
+
+// toTrashItem converts a storage trash item to the API representation
+func toTrashItem(item storage.TrashItem) TrashItem {
+	return TrashItem{
+		Id:        item.ID,
+		Path:      extractPath(item.Path),
+		Type:      NodeType(item.Type),
+		FileSize:  item.Size,
+		DeletedAt: item.DeletedAt,
+	}
+}
+
+// GetStoragesStorageTrash lists the trashed nodes of a storage
+func (s *Server) GetStoragesStorageTrash(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	trasher, ok := s.getTrasher(w, r, storageName)
+	if !ok {
+		return
+	}
+
+	items, err := trasher.ListTrash()
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	response := TrashList{
+		Storage: string(storageName),
+		Items:   make([]TrashItem, 0, len(items)),
+	}
+	for _, item := range items {
+		if s.allowed(r, string(storageName), extractPath(item.Path), access.Read) {
+			response.Items = append(response.Items, toTrashItem(item))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteStoragesStorageTrash permanently deletes all trashed nodes
+func (s *Server) DeleteStoragesStorageTrash(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	trasher, ok := s.getTrasher(w, r, storageName)
+	if !ok {
+		return
+	}
+
+	if err := trasher.EmptyTrash(); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteStoragesStorageTrashId permanently deletes a single trashed node
+func (s *Server) DeleteStoragesStorageTrashId(w http.ResponseWriter, r *http.Request, storageName Storage, id TrashId) {
+	trasher, ok := s.getTrasher(w, r, storageName)
+	if !ok {
+		return
+	}
+
+	if err := trasher.PurgeTrash(id); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostStoragesStorageTrashIdRestore moves a trashed node back to its original path
+func (s *Server) PostStoragesStorageTrashIdRestore(w http.ResponseWriter, r *http.Request, storageName Storage, id TrashId) {
+	trasher, ok := s.getTrasher(w, r, storageName)
+	if !ok {
+		return
+	}
+
+	op := hook.Operation{Name: hook.Restore, Storage: string(storageName)}
+	if s.config.Hooks != nil || s.policy() != nil {
+		// Hooks and access checks need the original path, which is only
+		// known from the listing
+		items, err := trasher.ListTrash()
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		for _, item := range items {
+			if item.ID == id {
+				op.Path = extractPath(item.Path)
+			}
+		}
+		if !s.allowed(r, string(storageName), op.Path, access.Write) {
+			s.sendForbidden(w, r)
+			return
+		}
+	}
+	if err := s.beforeHooks(r.Context(), op); err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	item, err := trasher.RestoreTrash(id)
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+	s.notify(webhook.Event{Type: webhook.NodeRestored, Storage: string(storageName), Path: extractPath(item.Path)})
+	s.record(r, activity.Event{Type: activity.Restored, Storage: string(storageName), Path: extractPath(item.Path)})
+	op.Path = extractPath(item.Path)
+	s.afterHooks(op)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toTrashItem(item))
+}
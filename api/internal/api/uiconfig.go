@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"timeship/internal/storage"
+)
+
+// Authentication modes of the UI config
+const (
+	// AuthNone means there is no access control
+	AuthNone = "none"
+
+	// AuthOptional means requests without a token are let in as the user
+	// without a token, others can sign in with a token
+	AuthOptional = "optional"
+
+	// AuthToken means every request needs a token
+	AuthToken = "token"
+)
+
+// UIConfig is the runtime configuration of the UI, so one build of it works
+// behind any reverse proxy path and with any features enabled
+type UIConfig struct {
+	// Base is the path the UI is served at, ending with a slash
+	Base string `json:"base"`
+
+	// APIPrefix is the path the API is served at
+	APIPrefix string `json:"api_prefix"`
+
+	// Auth is how users authenticate, "none", "optional" or "token"
+	Auth string `json:"auth"`
+
+	// CSRF is whether state-changing requests must send the CSRF token
+	CSRF bool `json:"csrf"`
+
+	// Branding tells instances apart
+	Branding UIBranding `json:"branding"`
+
+	// Features are the features the UI can offer
+	Features UIFeatures `json:"features"`
+}
+
+// UIBranding is how the UI presents the instance, empty fields keep the
+// defaults of the UI
+type UIBranding struct {
+	// Name is the title of the UI
+	Name string `json:"name,omitempty"`
+
+	// LogoURL is the URL of the logo
+	LogoURL string `json:"logo_url,omitempty"`
+
+	// AccentColor is the hex color of buttons and links
+	AccentColor string `json:"accent_color,omitempty"`
+}
+
+// UIFeatures are the features the UI can offer, true if the server has them
+// enabled and at least one storage supports them
+type UIFeatures struct {
+	Write      bool `json:"write"`
+	Snapshots  bool `json:"snapshots"`
+	Trash      bool `json:"trash"`
+	Search     bool `json:"search"`
+	Thumbnails bool `json:"thumbnails"`
+	Tags       bool `json:"tags"`
+	Activity   bool `json:"activity"`
+	Recent     bool `json:"recent"`
+}
+
+// UIConfig returns the runtime configuration of a UI served at base, with
+// the API served at apiPrefix
+func (s *Server) UIConfig(base, apiPrefix string) UIConfig {
+	c := UIConfig{
+		Base:      base,
+		APIPrefix: apiPrefix,
+		Auth:      AuthNone,
+		CSRF:      s.config.CSRF,
+		Branding:  s.config.Branding,
+		Features: UIFeatures{
+			Thumbnails: s.config.PDFRenderer != nil,
+			Tags:       s.config.Tags != nil,
+			Activity:   s.config.Activity != nil,
+			Recent:     s.config.Recent != nil,
+		},
+	}
+	if policy := s.accessPolicy.Load(); policy != nil {
+		c.Auth = AuthToken
+		if policy.Anonymous() {
+			c.Auth = AuthOptional
+		}
+	}
+
+	s.mu.RLock()
+	stores := slices.Collect(maps.Values(s.storages))
+	s.mu.RUnlock()
+	for _, store := range stores {
+		_, write := store.(storage.Writer)
+		_, snapshots := store.(storage.SnapshotLister)
+		_, search := store.(storage.Lister)
+		trash := false
+		if trasher, ok := store.(storage.Trasher); ok {
+			// Storages may have the trash disabled
+			_, err := trasher.ListTrash()
+			trash = !errors.Is(err, storage.ErrNotSupported)
+		}
+		c.Features.Write = c.Features.Write || write
+		c.Features.Snapshots = c.Features.Snapshots || snapshots
+		c.Features.Trash = c.Features.Trash || trash
+		c.Features.Search = c.Features.Search || search
+	}
+	return c
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"timeship/internal/access"
+	"timeship/internal/storage"
+)
+
+// PatchStoragesStorageNodesPath replaces the content of a file or renames a
+// node. With If-Match or If-Unmodified-Since, the update fails with 412 if
+// the node changed since the client read it, so concurrent edits aren't lost.
+// An application/octet-stream body is written into the file at the offset.
+func (s *Server) PatchStoragesStorageNodesPath(w http.ResponseWriter, r *http.Request, storageName Storage, nodePath NodePath, params PatchStoragesStorageNodesPathParams) {
+	ctx := r.Context()
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/octet-stream" {
+		vfPath := url.URL{Scheme: string(storageName), Path: strings.Trim(nodePath, "/")}
+		if vfPath.Path == "" {
+			s.sendError(w, problemBadRequest, "The storage root can't be updated", r.URL.Path)
+			return
+		}
+		s.patchContent(w, r, store, vfPath, params)
+		return
+	}
+
+	writer, canWrite := store.(storage.Writer)
+	mover, canMove := store.(storage.Mover)
+	if !canWrite && !canMove {
+		s.sendError(w, problemNotSupported, "Storage does not support updating nodes", r.URL.Path)
+		return
+	}
+
+	var request UpdateNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.sendError(w, problemBadRequest, "Invalid request body: "+err.Error(), r.URL.Path)
+		return
+	}
+	if request.Name == nil && request.Content == nil {
+		s.sendError(w, problemBadRequest, "Nothing to update", r.URL.Path)
+		return
+	}
+	if request.Content != nil && !canWrite {
+		s.sendError(w, problemNotSupported, "Storage does not support writing files", r.URL.Path)
+		return
+	}
+	if request.Name != nil && !canMove {
+		s.sendError(w, problemNotSupported, "Storage does not support renaming nodes", r.URL.Path)
+		return
+	}
+	vfPath := url.URL{Scheme: string(storageName), Path: strings.Trim(nodePath, "/")}
+	if vfPath.Path == "" {
+		s.sendError(w, problemBadRequest, "The storage root can't be updated", r.URL.Path)
+		return
+	}
+
+	// The target of a rename is checked before anything is written, so a
+	// forbidden rename doesn't leave the content replaced
+	to := vfPath
+	if request.Name != nil {
+		if err := validateName(*request.Name); err != nil {
+			s.sendError(w, problemBadRequest, "Invalid name: "+err.Error(), r.URL.Path)
+			return
+		}
+		to.Path = path.Join(path.Dir(vfPath.Path), *request.Name)
+		if !s.allowed(r, string(storageName), to.Path, access.Write) {
+			s.sendForbidden(w, r)
+			return
+		}
+	}
+
+	// Conditional updates must not interleave with other updates of the
+	// node, or both of two concurrent edits could pass the check. Others
+	// don't wait, as hooks and scans may take long.
+	if params.IfMatch != nil || params.IfUnmodifiedSince != nil {
+		defer s.updateLocks.lock(vfPath, to)()
+	}
+
+	nodeType := File
+	if existence, ok := store.(storage.Existence); ok {
+		fileExists, err := traceStorage(ctx, "FileExists", store, vfPath, existence.FileExists)
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		dirExists, err := traceStorage(ctx, "DirectoryExists", store, vfPath, existence.DirectoryExists)
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		if !fileExists && !dirExists {
+			s.sendStorageError(w, r, &fs.PathError{Op: "update", Path: vfPath.Path, Err: fs.ErrNotExist})
+			return
+		}
+		if dirExists {
+			nodeType = Dir
+		}
+	}
+	if nodeType == Dir && request.Content != nil {
+		s.sendError(w, problemBadRequest, "Directories can't have content", r.URL.Path)
+		return
+	}
+
+	etag := ""
+	if nodeType == File {
+		etag = fileETag(ctx, store, vfPath)
+	}
+	if !checkPreconditions(ctx, store, vfPath, etag, params) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		s.sendError(w, problemPreconditionFailed, "The node was changed since it was read", r.URL.Path)
+		return
+	}
+
+	if request.Content != nil {
+		_, span := startStorageSpan(ctx, "WriteStream", store, vfPath)
+		err := s.writeContent(ctx, writer, vfPath, strings.NewReader(*request.Content))
+		endSpan(span, err)
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+	}
+	if to.Path != vfPath.Path {
+		_, span := startStorageSpan(ctx, "Move", store, vfPath)
+		err := mover.Move(vfPath, to)
+		endSpan(span, err)
+		if err != nil {
+			s.sendStorageError(w, r, err)
+			return
+		}
+		s.moveTags(store, vfPath, to)
+		s.recordMove(r, vfPath, to)
+		vfPath = to
+	}
+
+	if nodeType == File {
+		if etag := fileETag(ctx, store, vfPath); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(describeNode(store, vfPath, nodeType))
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"timeship/internal/storage"
+)
+
+// GetStoragesStorageZfs reports the health of the ZFS pool and dataset
+// backing a storage
+func (s *Server) GetStoragesStorageZfs(w http.ResponseWriter, r *http.Request, storageName Storage) {
+	store, err := s.getStorage(r.Context(), string(storageName))
+	if err != nil {
+		s.sendError(w, problemStorageNotFound, err.Error(), r.URL.Path)
+		return
+	}
+
+	reporter, ok := store.(storage.ZFSHealthReporter)
+	if !ok {
+		s.sendError(w, problemNotSupported, "Storage is not backed by ZFS", r.URL.Path)
+		return
+	}
+
+	health, err := reporter.ZFSHealth()
+	if err != nil {
+		s.sendStorageError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(describeZFSHealth(string(storageName), health))
+}
+
+// describeZFSHealth converts the ZFS health of a storage to its API form
+func describeZFSHealth(name string, health storage.ZFSHealth) ZFSHealth {
+	p, d := health.Pool, health.Dataset
+	pool := ZFSPool{
+		Name:    p.Name,
+		State:   p.State,
+		Devices: make([]ZFSDevice, len(p.Devices)),
+	}
+	if p.Status != "" {
+		pool.Status = &p.Status
+	}
+	if p.Action != "" {
+		pool.Action = &p.Action
+	}
+	if p.Scan != "" {
+		pool.Scan = &p.Scan
+	}
+	if p.LastScrub != 0 {
+		pool.LastScrub = &p.LastScrub
+	}
+	if p.Errors != "" {
+		pool.Errors = &p.Errors
+	}
+	for i, device := range p.Devices {
+		pool.Devices[i] = ZFSDevice{
+			Name:           device.Name,
+			Depth:          device.Depth,
+			ReadErrors:     device.Read,
+			WriteErrors:    device.Write,
+			ChecksumErrors: device.Checksum,
+		}
+		if device.State != "" {
+			pool.Devices[i].State = &device.State
+		}
+	}
+
+	return ZFSHealth{
+		Storage: name,
+		Pool:    pool,
+		Dataset: ZFSDataset{
+			Name:            d.Name,
+			Used:            d.Used,
+			Available:       d.Available,
+			Referenced:      d.Referenced,
+			UsedBySnapshots: d.UsedBySnapshots,
+			Compression:     d.Compression,
+			CompressRatio:   d.CompressRatio,
+		},
+	}
+}
@@ -0,0 +1,233 @@
+// Package archive writes files into streamed archives like zip and tar,
+// without seeking, so they can be sent as they're written. Permissions,
+// modification times, owners and symbolic links are kept, so files can be
+// restored as they were. Archives can be walked again to verify them.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is the file format of an archive
+type Format string
+
+const (
+	Zip    Format = "zip"
+	Tar    Format = "tar"
+	TarGz  Format = "tar.gz"
+	TarZst Format = "tar.zst"
+)
+
+// Formats are all supported formats
+var Formats = []Format{Zip, Tar, TarGz, TarZst}
+
+// MimeType returns the media type of archives of the format
+func (f Format) MimeType() string {
+	switch f {
+	case Tar:
+		return "application/x-tar"
+	case TarGz:
+		return "application/gzip"
+	case TarZst:
+		return "application/zstd"
+	default:
+		return "application/zip"
+	}
+}
+
+// Extension returns the file extension of the format with the dot
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Entry is a file or directory written to an archive
+type Entry struct {
+	// Name is the slash-separated path within the archive
+	Name string
+	Dir  bool
+	// Size is the size of the content of files. Tar needs it up front.
+	Size int64
+	// Mode holds the permission bits, defaults are used if zero
+	Mode    fs.FileMode
+	ModTime time.Time
+	// Owner and Group are user and group names or numeric IDs, only kept
+	// by tar
+	Owner, Group string
+	// LinkTarget makes the entry a symbolic link to it
+	LinkTarget string
+}
+
+// Writer writes entries to an archive
+type Writer interface {
+	// Add adds an entry with the content of files
+	Add(e Entry, content io.Reader) error
+	// Close finishes the archive, but doesn't close the underlying writer
+	Close() error
+}
+
+// NewWriter creates a writer of an archive in the given format
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case Zip:
+		return &zipWriter{zw: zip.NewWriter(w)}, nil
+	case Tar:
+		return &tarWriter{tw: tar.NewWriter(w)}, nil
+	case TarGz:
+		gz := gzip.NewWriter(w)
+		return &tarWriter{tw: tar.NewWriter(gz), compressor: gz}, nil
+	case TarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(zw), compressor: zw}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// defaultMode returns the permissions of an entry, or defaults if unknown
+func defaultMode(e Entry) fs.FileMode {
+	if perm := e.Mode.Perm(); perm != 0 {
+		return perm
+	}
+	switch {
+	case e.Dir:
+		return 0755
+	case e.LinkTarget != "":
+		return 0777
+	}
+	return 0644
+}
+
+// compressedExtensions are files that hardly shrink when compressed again,
+// so they're stored as they are in zip archives
+var compressedExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".m4a": true, ".ogg": true, ".flac": true, ".opus": true,
+	".mp4": true, ".m4v": true, ".mkv": true, ".mov": true, ".webm": true, ".avi": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) Add(e Entry, content io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     e.Name,
+		Method:   zip.Deflate,
+		Modified: e.ModTime,
+	}
+	switch {
+	case e.Dir:
+		header.Name = strings.TrimSuffix(e.Name, "/") + "/"
+		header.Method = zip.Store
+		header.SetMode(fs.ModeDir | defaultMode(e))
+	case e.LinkTarget != "":
+		// Links are stored with their target as content, like Info-ZIP does
+		header.Method = zip.Store
+		header.SetMode(fs.ModeSymlink | defaultMode(e))
+		content = strings.NewReader(e.LinkTarget)
+	default:
+		header.SetMode(defaultMode(e))
+		if compressedExtensions[strings.ToLower(path.Ext(e.Name))] {
+			header.Method = zip.Store
+		}
+	}
+	fw, err := z.zw.CreateHeader(header)
+	if err != nil || e.Dir {
+		return err
+	}
+	// Zip records the size after the content, so it may differ from Size
+	_, err = io.Copy(fw, content)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+type tarWriter struct {
+	tw *tar.Writer
+	// compressor is nil for uncompressed archives
+	compressor io.WriteCloser
+}
+
+func (t *tarWriter) Add(e Entry, content io.Reader) error {
+	header := &tar.Header{
+		Name:    e.Name,
+		Mode:    int64(defaultMode(e)),
+		ModTime: e.ModTime,
+		Format:  tar.FormatPAX,
+	}
+	setOwner(e.Owner, &header.Uid, &header.Uname)
+	setOwner(e.Group, &header.Gid, &header.Gname)
+	switch {
+	case e.Dir:
+		header.Typeflag = tar.TypeDir
+		header.Name = strings.TrimSuffix(e.Name, "/") + "/"
+	case e.LinkTarget != "":
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = e.LinkTarget
+	default:
+		header.Typeflag = tar.TypeReg
+		header.Size = e.Size
+	}
+	if err := t.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+	// The size is written before the content, so files that grew since are
+	// cut off and files that shrank are padded with zeros like GNU tar does
+	n, err := io.Copy(t.tw, io.LimitReader(content, e.Size))
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(t.tw, zeros{}, e.Size-n)
+	return err
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.compressor == nil {
+		return nil
+	}
+	return t.compressor.Close()
+}
+
+// setOwner sets the numeric ID or the name of an owner, extraction as root
+// maps names to the IDs of the restoring system
+func setOwner(owner string, id *int, name *string) {
+	if owner == "" {
+		return
+	}
+	if n, err := strconv.Atoi(owner); err == nil {
+		*id = n
+		return
+	}
+	*name = owner
+}
+
+// zeros reads an endless stream of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
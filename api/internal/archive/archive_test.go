@@ -0,0 +1,216 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// readEntry is an entry read back from an archive
+type readEntry struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	// content is the target of links
+	content string
+}
+
+func readZip(t *testing.T, data []byte) []readEntry {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to read zip: %v", err)
+	}
+	var entries []readEntry
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		entries = append(entries, readEntry{f.Name, f.Mode(), f.Modified.UTC(), string(content)})
+	}
+	return entries
+}
+
+func readTarGz(t *testing.T, data []byte) []readEntry {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read gzip: %v", err)
+	}
+	return readTar(t, gz)
+}
+
+func readTarZst(t *testing.T, data []byte) []readEntry {
+	t.Helper()
+	zr, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read zstd: %v", err)
+	}
+	defer zr.Close()
+	return readTar(t, zr)
+}
+
+func readTar(t *testing.T, r io.Reader) []readEntry {
+	t.Helper()
+	tr := tar.NewReader(r)
+	var entries []readEntry
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		if h.Typeflag == tar.TypeSymlink {
+			content = []byte(h.Linkname)
+		}
+		entries = append(entries, readEntry{h.Name, h.FileInfo().Mode(), h.ModTime.UTC(), string(content)})
+	}
+	return entries
+}
+
+func TestWriter(t *testing.T) {
+	modTime := time.Date(2024, 7, 1, 14, 3, 22, 0, time.UTC)
+	readers := map[Format]func(*testing.T, []byte) []readEntry{
+		Zip: readZip,
+		Tar: func(t *testing.T, data []byte) []readEntry {
+			return readTar(t, bytes.NewReader(data))
+		},
+		TarGz:  readTarGz,
+		TarZst: readTarZst,
+	}
+
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("NewWriter failed: %v", err)
+			}
+			add := func(e Entry, content string) {
+				t.Helper()
+				if err := w.Add(e, strings.NewReader(content)); err != nil {
+					t.Fatalf("Add failed: %v", err)
+				}
+			}
+			add(Entry{Name: "docs", Dir: true, ModTime: modTime}, "")
+			add(Entry{Name: "docs/a.txt", Size: 5, Mode: 0600, ModTime: modTime}, "hello")
+			add(Entry{Name: "photo.jpg", Size: 3, ModTime: modTime}, "jpg")
+			add(Entry{Name: "latest", LinkTarget: "docs/a.txt", ModTime: modTime}, "")
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			want := []readEntry{
+				{"docs/", fs.ModeDir | 0755, modTime, ""},
+				{"docs/a.txt", 0600, modTime, "hello"},
+				{"photo.jpg", 0644, modTime, "jpg"},
+				{"latest", fs.ModeSymlink | 0777, modTime, "docs/a.txt"},
+			}
+			got := readers[format](t, buf.Bytes())
+			if len(got) != len(want) {
+				t.Fatalf("expected %d entries, got %+v", len(want), got)
+			}
+			for i := range want {
+				if got[i].name != want[i].name || got[i].mode != want[i].mode || !got[i].modTime.Equal(want[i].modTime) || got[i].content != want[i].content {
+					t.Errorf("expected %+v, got %+v", want[i], got[i])
+				}
+			}
+		})
+	}
+
+	t.Run("changed size", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, _ := NewWriter(&buf, TarGz)
+		w.Add(Entry{Name: "shrunk.txt", Size: 5}, strings.NewReader("abc"))
+		w.Add(Entry{Name: "grown.txt", Size: 2}, strings.NewReader("abc"))
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		got := readTarGz(t, buf.Bytes())
+		if len(got) != 2 || got[0].content != "abc\x00\x00" || got[1].content != "ab" {
+			t.Errorf("expected padded and cut off files, got %+v", got)
+		}
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, _ := NewWriter(&buf, Tar)
+		w.Add(Entry{Name: "a.txt", Owner: "alice", Group: "100"}, strings.NewReader(""))
+		w.Close()
+		h, err := tar.NewReader(&buf).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Uname != "alice" || h.Gid != 100 {
+			t.Errorf("expected owner alice and group 100, got %q and %d", h.Uname, h.Gid)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		if _, err := NewWriter(io.Discard, "rar"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestWalk(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, _ := NewWriter(&buf, format)
+			w.Add(Entry{Name: "docs", Dir: true}, nil)
+			w.Add(Entry{Name: "docs/a.txt", Size: 5, Mode: 0600}, strings.NewReader("hello"))
+			w.Add(Entry{Name: "latest", LinkTarget: "docs/a.txt"}, nil)
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			var got []string
+			err := Walk(bytes.NewReader(buf.Bytes()), int64(buf.Len()), format, func(e Entry, content io.Reader) error {
+				switch {
+				case e.Dir:
+					got = append(got, e.Name+"/")
+				case e.LinkTarget != "":
+					got = append(got, e.Name+" -> "+e.LinkTarget)
+				default:
+					data, err := io.ReadAll(content)
+					if err != nil {
+						return err
+					}
+					got = append(got, e.Name+": "+string(data))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Walk failed: %v", err)
+			}
+			want := []string{"docs/", "docs/a.txt: hello", "latest -> docs/a.txt"}
+			if strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+
+	t.Run("format of name", func(t *testing.T) {
+		if format, ok := FormatOf("backup.TAR.GZ"); !ok || format != TarGz {
+			t.Errorf("expected tar.gz, got %q", format)
+		}
+		if _, ok := FormatOf("backup.rar"); ok {
+			t.Error("expected no format")
+		}
+	})
+}
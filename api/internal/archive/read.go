@@ -0,0 +1,144 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// FormatOf returns the format of an archive from the extension of its name
+func FormatOf(name string) (Format, bool) {
+	name = strings.ToLower(name)
+	for _, format := range Formats {
+		if strings.HasSuffix(name, format.Extension()) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// Walk calls fn with each entry of an archive in the given format and the
+// content of files, e.g. to verify it. Zip archives are read from their
+// central directory at the end, so archives are read with random access.
+func Walk(r io.ReaderAt, size int64, format Format, fn func(e Entry, content io.Reader) error) error {
+	stream := io.NewSectionReader(r, 0, size)
+	switch format {
+	case Zip:
+		return walkZip(r, size, fn)
+	case Tar:
+		return walkTar(stream, fn)
+	case TarGz:
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return walkTar(gz, fn)
+	case TarZst:
+		zr, err := zstd.NewReader(stream)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return walkTar(zr, fn)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+func walkZip(r io.ReaderAt, size int64, fn func(e Entry, content io.Reader) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		e := Entry{
+			Name:    strings.TrimSuffix(f.Name, "/"),
+			Dir:     f.Mode().IsDir(),
+			Size:    int64(f.UncompressedSize64),
+			Mode:    f.Mode().Perm(),
+			ModTime: f.Modified,
+		}
+		if e.Dir {
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := walkZipFile(f, e, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkZipFile calls fn with a file or link of a zip archive
+func walkZipFile(f *zip.File, e Entry, fn func(e Entry, content io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if f.Mode()&fs.ModeSymlink == 0 {
+		return fn(e, rc)
+	}
+	// Links are stored with their target as content
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	e.LinkTarget = string(target)
+	e.Size = 0
+	return fn(e, nil)
+}
+
+func walkTar(r io.Reader, fn func(e Entry, content io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := Entry{
+			Name:    strings.TrimSuffix(h.Name, "/"),
+			Size:    h.Size,
+			Mode:    fs.FileMode(h.Mode).Perm(),
+			ModTime: h.ModTime,
+			Owner:   owner(h.Uname, h.Uid),
+			Group:   owner(h.Gname, h.Gid),
+		}
+		var content io.Reader
+		switch h.Typeflag {
+		case tar.TypeDir:
+			e.Dir = true
+		case tar.TypeSymlink:
+			e.LinkTarget = h.Linkname
+		case tar.TypeReg:
+			content = tr
+		default:
+			// Other types aren't written, so there's nothing to compare
+			continue
+		}
+		if err := fn(e, content); err != nil {
+			return err
+		}
+	}
+}
+
+// owner returns the name of an owner, or its numeric ID if it has none
+func owner(name string, id int) string {
+	if name != "" || id == 0 {
+		return name
+	}
+	return strconv.Itoa(id)
+}
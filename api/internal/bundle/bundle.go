@@ -0,0 +1,116 @@
+// Package bundle exports the configuration and the state users created at
+// runtime to a portable JSON bundle, and imports it on another instance.
+//
+// Bundles contain the configuration with its secrets, the issued tokens,
+// which keep working as only their hashes are stored, and the tags and
+// bookmarks of all users. Nodes are tagged and bookmarked by path, as their
+// identities, like inodes, don't carry over to another machine.
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"timeship/internal/tags"
+	"timeship/internal/tokens"
+)
+
+// Version is the format version of bundles
+const Version = 1
+
+// Bundle is a portable export of a server
+type Bundle struct {
+	// Version is the format version of the bundle
+	Version int `json:"version"`
+
+	// CreatedAt is when the bundle was exported as a Unix timestamp
+	CreatedAt int64 `json:"created_at"`
+
+	// Config is the configuration as YAML, including secrets
+	Config string `json:"config,omitempty"`
+
+	Tokens    []tokens.Record       `json:"tokens,omitempty"`
+	Tags      []tags.TagRecord      `json:"tags,omitempty"`
+	Bookmarks []tags.BookmarkRecord `json:"bookmarks,omitempty"`
+}
+
+// Counts are the numbers of records imported from a bundle
+type Counts struct {
+	Tokens    int `json:"tokens"`
+	Tags      int `json:"tags"`
+	Bookmarks int `json:"bookmarks"`
+}
+
+// Export creates a bundle of a configuration and the stores. The stores
+// may be nil if they aren't configured.
+func Export(config []byte, tokenStore *tokens.Store, tagStore *tags.Store) (*Bundle, error) {
+	b := &Bundle{
+		Version:   Version,
+		CreatedAt: time.Now().Unix(),
+		Config:    string(config),
+	}
+	if tokenStore != nil {
+		records, err := tokenStore.Export()
+		if err != nil {
+			return nil, fmt.Errorf("exporting tokens: %w", err)
+		}
+		b.Tokens = records
+	}
+	if tagStore != nil {
+		tagRecords, bookmarks, err := tagStore.Export()
+		if err != nil {
+			return nil, fmt.Errorf("exporting tags: %w", err)
+		}
+		b.Tags, b.Bookmarks = tagRecords, bookmarks
+	}
+	return b, nil
+}
+
+// Read reads and checks a bundle
+func Read(r io.Reader) (*Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if b.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	return &b, nil
+}
+
+// Write writes a bundle as indented JSON
+func (b *Bundle) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// Import adds the tokens, tags and bookmarks of the bundle to the stores,
+// skipping those that are already stored. It fails if the bundle has
+// records for a store that is nil, as they would be lost.
+func (b *Bundle) Import(tokenStore *tokens.Store, tagStore *tags.Store) (Counts, error) {
+	var counts Counts
+	if len(b.Tokens) > 0 && tokenStore == nil {
+		return counts, fmt.Errorf("bundle has %d tokens, but no token database is configured", len(b.Tokens))
+	}
+	if (len(b.Tags) > 0 || len(b.Bookmarks) > 0) && tagStore == nil {
+		return counts, fmt.Errorf("bundle has tags or bookmarks, but no tag database is configured")
+	}
+	if len(b.Tokens) > 0 {
+		n, err := tokenStore.Import(b.Tokens)
+		if err != nil {
+			return counts, fmt.Errorf("importing tokens: %w", err)
+		}
+		counts.Tokens = n
+	}
+	if len(b.Tags) > 0 || len(b.Bookmarks) > 0 {
+		nTags, nBookmarks, err := tagStore.Import(b.Tags, b.Bookmarks)
+		if err != nil {
+			return counts, fmt.Errorf("importing tags: %w", err)
+		}
+		counts.Tags, counts.Bookmarks = nTags, nBookmarks
+	}
+	return counts, nil
+}
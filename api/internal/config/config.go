@@ -0,0 +1,1469 @@
+// Package config loads the server configuration.
+//
+// Configuration is read from an optional YAML file and TIMESHIP_* environment
+// variables. Environment variables take precedence over the file, so existing
+// deployments configured purely through the environment keep working.
+//
+// Example config file:
+//
+//	address: ":8080"
+//	listeners:
+//	  - address: ":8080"
+//	  - address: ":8443"
+//	    tls_cert: /etc/timeship/cert.pem
+//	    tls_key: /etc/timeship/key.pem
+//	    read_only: true
+//	    hsts: true
+//	  - address: unix:/run/timeship/timeship.sock
+//	mdns: true
+//	api_prefix: /api
+//	branding:
+//	  name: Offsite NAS
+//	  logo_url: https://example.com/logo.png
+//	  accent_color: "#2e7d32"
+//	write_timeout: 30s
+//	stream_rate_limit: 20MB/s
+//	total_rate_limit: 50MB/s
+//	metadata_cache:
+//	  path: /var/lib/timeship/metadata.db
+//	  schedule: "0 3 * * *"
+//	thumbnails:
+//	  mutool: /usr/bin/mutool
+//	  cache_dir: /var/cache/timeship/thumbnails
+//	scan:
+//	  clamd: /run/clamav/clamd.ctl
+//	webhooks:
+//	  - url: https://ntfy.example.com/timeship
+//	    secret: s3cret
+//	    events: [node.deleted, node.restored]
+//	notifications:
+//	  - type: ntfy
+//	    url: https://ntfy.sh/my-backups
+//	    events: [job.failed, snapshot.missing]
+//	hooks:
+//	  - before: write
+//	    command: zfs snapshot tank/data@pre-write-{{.Time.Unix}}
+//	schedules:
+//	  - name: etc-to-s3
+//	    schedule: "0 4 * * *"
+//	    action: export
+//	    storage: local
+//	    path: etc
+//	    snapshot: latest
+//	    destination_storage: s3
+//	    destination: etc
+//	access:
+//	  - name: admin
+//	    token: s3cret
+//	    rules:
+//	      - {path: "*://**", allow: [read, write]}
+//	  - name: guest
+//	    token: guest-token
+//	    rules:
+//	      - {path: "local://public/**", allow: [read]}
+//	  - name: alice
+//	    token: alice-token
+//	    home: local://homes/{user}
+//	lockout:
+//	  failures: 5
+//	  max_duration: 15m
+//	  trusted_proxies: [127.0.0.1, 10.0.0.0/8]
+//	tokens: /var/lib/timeship/tokens.db
+//	tags: /var/lib/timeship/tags.db
+//	activity: /var/lib/timeship/activity.db
+//	disable_recent: false
+//	cors_origins: [https://timeship.example.com]
+//	cors:
+//	  headers: [X-Requested-With]
+//	  max_age: 10m
+//	  routes:
+//	    - path: /storages/public/
+//	      origins: ["*"]
+//	      methods: [GET, HEAD]
+//	storages:
+//	  - name: local
+//	    root: /mnt/tank
+//	    max_snapshot_age: 26h
+//	  - name: old-nas
+//	    root: /mnt/old-nas
+//	    filename_encoding: shift_jis
+//	    transliterate_filenames: true
+//	    trash: true
+//	    trash_retention: 720h
+//	    symlinks: hide
+//	    ignore: [.git, node_modules, .DS_Store]
+//	    snapshot_patterns:
+//	      - regex: 'nightly\.(\d{2}\.\d{2}\.\d{4})'
+//	        layout: "02.01.2006"
+//	    snapshot_timezone: Europe/Berlin
+//	  - name: mac
+//	    type: timemachine
+//	    root: /mnt/backup
+//	  - name: blobs
+//	    type: azure
+//	    account: mystorageaccount
+//	    container: backups
+//	  - name: bucket
+//	    type: gcs
+//	    bucket: my-bucket
+//	    credentials_file: /etc/timeship/gcs-key.json
+//	  - name: b2
+//	    type: b2
+//	    bucket: my-b2-bucket
+//	    key_id: 0012345678901230000000001
+//	    application_key: K001...
+//	  - name: drive
+//	    type: rclone
+//	    remote: gdrive:backups
+//	  - name: mirror
+//	    type: autoindex
+//	    url: https://mirror.example.com/pub/
+//	  - name: nas
+//	    type: remote
+//	    url: https://nas.example.com/api
+//	    remote_storage: tank
+//	    token: secret
+//	pins:
+//	  - storage: local
+//	    snapshot: zfs:daily-2025-11-09
+//	    name: local.2025-11-09
+//	removable:
+//	  path: /media
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/hook"
+	"timeship/internal/schedule"
+	"timeship/internal/webhook"
+
+	"gopkg.in/yaml.v3"
+)
+
+// storageNameRegex matches valid storage names. Names are used as URL schemes,
+// so they follow the same rules.
+var storageNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+// storageTypeRegex matches valid storage types
+var storageTypeRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// colorRegex matches CSS hex colors, e.g. "#2e7d32"
+var colorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Config is the top-level server configuration
+type Config struct {
+	// Address is the address to listen on, e.g. ":8080"
+	Address string `yaml:"address,omitempty"`
+
+	// Listeners lists several addresses to listen on, each with its own
+	// options, instead of Address
+	Listeners []ListenerConfig `yaml:"listeners,omitempty"`
+
+	// MDNS advertises the listeners on the local network with mDNS and
+	// DNS-SD, so clients can discover the server
+	MDNS bool `yaml:"mdns,omitempty"`
+
+	// APIPrefix is the path prefix the API is mounted on, e.g. "/api"
+	APIPrefix string `yaml:"api_prefix,omitempty"`
+
+	// Branding tells instances apart in the UI and the logs
+	Branding BrandingConfig `yaml:"branding,omitempty"`
+
+	// ReadTimeout limits reading a request, defaults to 15s. Uploads extend
+	// it while data keeps flowing.
+	ReadTimeout time.Duration `yaml:"read_timeout,omitempty"`
+
+	// WriteTimeout limits writing a response, defaults to 15s. File
+	// downloads extend it while data keeps flowing.
+	WriteTimeout time.Duration `yaml:"write_timeout,omitempty"`
+
+	// IdleTimeout limits how long idle keep-alive connections are kept
+	// open, defaults to 60s
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+
+	// DrainTimeout limits how long a shutdown waits for downloads and jobs
+	// to finish, defaults to 30s
+	DrainTimeout time.Duration `yaml:"drain_timeout,omitempty"`
+
+	// StreamRateLimit limits each file download to this many bytes per
+	// second, unlimited if zero
+	StreamRateLimit ByteSize `yaml:"stream_rate_limit,omitempty"`
+
+	// TotalRateLimit limits all file downloads together to this many bytes
+	// per second, unlimited if zero
+	TotalRateLimit ByteSize `yaml:"total_rate_limit,omitempty"`
+
+	// Storages lists the configured storages, the first one is the default
+	Storages []StorageConfig `yaml:"storages,omitempty"`
+
+	// Pins lists snapshots exposed as virtual read-only storages
+	Pins []PinConfig `yaml:"pins,omitempty"`
+
+	// Removable serves the drives mounted in a directory as storages while
+	// they're mounted
+	Removable RemovableConfig `yaml:"removable,omitempty"`
+
+	// ContentDigest adds a SHA-256 Repr-Digest header to responses sending
+	// whole files
+	ContentDigest bool `yaml:"content_digest,omitempty"`
+
+	// ActiveContent is how files browsers could run scripts of, like HTML
+	// and SVG, are served: "sandbox" (default) without scripts, "text" as
+	// plain text or "allow" as they are
+	ActiveContent string `yaml:"active_content,omitempty"`
+
+	// SigningKey is the path to a PEM encoded Ed25519 private key used to sign
+	// integrity manifests
+	SigningKey string `yaml:"signing_key,omitempty"`
+
+	// MetadataCache configures the optional snapshot metadata cache
+	MetadataCache MetadataCacheConfig `yaml:"metadata_cache,omitempty"`
+
+	// Thumbnails configures the optional thumbnails of PDFs
+	Thumbnails ThumbnailsConfig `yaml:"thumbnails,omitempty"`
+
+	// Scan configures the optional virus scanning of uploads
+	Scan ScanConfig `yaml:"scan,omitempty"`
+
+	// Webhooks lists receivers notified of uploads, deletes, restores, new
+	// snapshots and finished indexing
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty"`
+
+	// Notifications lists email, ntfy and Gotify receivers of the same
+	// events as webhooks, as human readable notifications
+	Notifications []NotificationConfig `yaml:"notifications,omitempty"`
+
+	// Hooks lists commands run before or after writes, deletes, restores
+	// and new snapshots
+	Hooks []HookConfig `yaml:"hooks,omitempty"`
+
+	// Schedules lists tasks run as jobs on cron schedules, like exports of
+	// the newest snapshot or pruning the trash
+	Schedules []ScheduleConfig `yaml:"schedules,omitempty"`
+
+	// Access lists the users allowed to use the API and what they may
+	// access, all requests are allowed if empty
+	Access []UserConfig `yaml:"access,omitempty"`
+
+	// Lockout configures how sources sending invalid tokens are locked out
+	Lockout LockoutConfig `yaml:"lockout,omitempty"`
+
+	// State is the path to a SQLite database keeping the state of the
+	// server. Tokens, tags, activity and the job history are stored there
+	// unless they have a database of their own, tokens only with access
+	// control.
+	State string `yaml:"state,omitempty"`
+
+	// Tokens is the path to a SQLite database of the tokens users issue
+	// through the API, issuing tokens is disabled if empty
+	Tokens string `yaml:"tokens,omitempty"`
+
+	// Tags is the path to a SQLite database of the tags and bookmarks users
+	// put on nodes, tagging is disabled if empty
+	Tags string `yaml:"tags,omitempty"`
+
+	// Activity is the path to a SQLite database recording what happens to
+	// nodes and the comments of users on them, the activity feed is
+	// disabled if empty
+	Activity string `yaml:"activity,omitempty"`
+
+	// JobHistory is the path to a SQLite database keeping finished jobs,
+	// including restores, the job history is disabled if empty
+	JobHistory string `yaml:"job_history,omitempty"`
+
+	// JobHistoryRetention is how long finished jobs are kept in the job
+	// history, defaults to 90 days
+	JobHistoryRetention time.Duration `yaml:"job_history_retention,omitempty"`
+
+	// ResumeJobs starts the jobs interrupted by a shutdown again after the
+	// restart, which needs the job history
+	ResumeJobs bool `yaml:"resume_jobs,omitempty"`
+
+	// DisableRecent stops remembering the paths each user browsed and
+	// downloaded most recently
+	DisableRecent bool `yaml:"disable_recent,omitempty"`
+
+	// CSRF requires state-changing requests without an Authorization header
+	// to repeat the token of the CSRF cookie in the X-CSRF-Token header
+	CSRF bool `yaml:"csrf,omitempty"`
+
+	// CORSOrigins are the origins browsers may call the API from, defaults
+	// to the development server of the UI
+	CORSOrigins []string `yaml:"cors_origins,omitempty"`
+
+	// CORS configures how browsers of the CORS origins may call the API,
+	// and other policies for some paths
+	CORS CORSConfig `yaml:"cors,omitempty"`
+}
+
+// CORSConfig configures how browsers may call the API from other origins
+type CORSConfig struct {
+	CORSPolicyConfig `yaml:",inline"`
+
+	// Routes apply other policies to paths of the API starting with their
+	// path, the longest one wins
+	Routes []CORSRouteConfig `yaml:"routes,omitempty"`
+}
+
+// CORSPolicyConfig configures a CORS policy
+type CORSPolicyConfig struct {
+	// Methods are allowed in requests, defaults to all methods of the API
+	Methods []string `yaml:"methods,omitempty"`
+
+	// Headers may be sent in requests, in addition to the ones of the UI
+	Headers []string `yaml:"headers,omitempty"`
+
+	// ExposedHeaders can be read from responses, in addition to the ones
+	// of the UI
+	ExposedHeaders []string `yaml:"exposed_headers,omitempty"`
+
+	// Credentials lets requests send cookies, which needs explicit origins
+	Credentials bool `yaml:"credentials,omitempty"`
+
+	// MaxAge is how long browsers may cache preflight responses, defaults
+	// to 5m
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+}
+
+// CORSRouteConfig configures the CORS policy of paths of the API, with the
+// lists and max age of the top-level policy if left empty
+type CORSRouteConfig struct {
+	// Path is the start of the paths, relative to the API prefix, e.g.
+	// "/storages/public/"
+	Path string `yaml:"path,omitempty"`
+
+	// Origins may call the paths, defaults to the CORS origins
+	Origins []string `yaml:"origins,omitempty"`
+
+	CORSPolicyConfig `yaml:",inline"`
+}
+
+// UserConfig configures a user of the API
+type UserConfig struct {
+	// Name identifies the user in logs
+	Name string `yaml:"name,omitempty"`
+
+	// Token authenticates the user as a bearer token. The rules of a user
+	// without a token apply to requests without one.
+	Token string `yaml:"token,omitempty"`
+
+	// Rules grant the user permissions on paths
+	Rules []RuleConfig `yaml:"rules,omitempty"`
+
+	// Home confines the user to a directory of a storage, e.g.
+	// "local://homes/{user}" with {user} replaced by the name. The storage
+	// shows the directory as its root to the user. Without rules, the user
+	// may read and write all of it.
+	Home string `yaml:"home,omitempty"`
+}
+
+// ListenerConfig configures an address the server listens on
+type ListenerConfig struct {
+	// Address is a TCP address, e.g. ":8443", or the path of a Unix socket
+	// prefixed with "unix:", e.g. "unix:/run/timeship/timeship.sock"
+	Address string `yaml:"address,omitempty"`
+
+	// TLSCert and TLSKey are the PEM files of the certificate and its
+	// private key, the listener serves HTTPS if they're set
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+
+	// ReadOnly rejects requests that could change anything, only letting
+	// through GET, HEAD and OPTIONS requests
+	ReadOnly bool `yaml:"read_only,omitempty"`
+
+	// HSTS tells browsers to only connect with HTTPS, requires TLS
+	HSTS bool `yaml:"hsts,omitempty"`
+}
+
+// BrandingConfig configures how the UI presents the instance, e.g. to tell
+// the home NAS from the offsite box
+type BrandingConfig struct {
+	// Name is shown as the title of the UI and in the startup banner,
+	// defaults to "Timeship"
+	Name string `yaml:"name,omitempty"`
+
+	// LogoURL is an http or https URL or an absolute path of the logo shown
+	// instead of the spaceship
+	LogoURL string `yaml:"logo_url,omitempty"`
+
+	// AccentColor is the hex color of buttons and links, e.g. "#2e7d32"
+	AccentColor string `yaml:"accent_color,omitempty"`
+}
+
+// LockoutConfig configures the lockout of sources and accounts sending
+// invalid tokens
+type LockoutConfig struct {
+	// Failures is how many invalid tokens a source or account may send
+	// before it's locked out, defaults to 5
+	Failures int `yaml:"failures,omitempty"`
+
+	// Duration is how long the first lockout lasts, doubling with each
+	// further invalid token, defaults to 1s
+	Duration time.Duration `yaml:"duration,omitempty"`
+
+	// MaxDuration caps the lockouts, defaults to 15m
+	MaxDuration time.Duration `yaml:"max_duration,omitempty"`
+
+	// TrustedProxies are the addresses or networks of reverse proxies,
+	// e.g. "10.0.0.0/8". The X-Forwarded-For header is only honored from
+	// them to tell the source of a request.
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+}
+
+// trustedProxies parses the trusted proxies, single addresses as networks
+// of one address
+func (c LockoutConfig) trustedProxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// RuleConfig grants permissions on a path and everything below it
+type RuleConfig struct {
+	// Path is the storage and path prefix, e.g. "local://public/**", or
+	// "*://**" for all storages
+	Path string `yaml:"path,omitempty"`
+
+	// Allow lists the granted permissions, read and write
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+// HookConfig configures a command run before or after an operation. Exactly
+// one of Before and After must be set.
+type HookConfig struct {
+	// Before runs the command before the operation, which fails if the
+	// command does, e.g. "write"
+	Before string `yaml:"before,omitempty"`
+
+	// After runs the command in the background after the operation
+	// succeeded, e.g. "restore"
+	After string `yaml:"after,omitempty"`
+
+	// Command is run with arguments split at spaces, each a Go template of
+	// the operation, e.g. "zpool scrub tank" or "logger restored {{.Path}}"
+	Command string `yaml:"command,omitempty"`
+
+	// Timeout limits how long the command may run, defaults to 1m
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// ScheduleConfig configures a task run as a job whenever its schedule
+// matches
+type ScheduleConfig struct {
+	// Name identifies the task in the API, e.g. "etc-to-s3"
+	Name string `yaml:"name,omitempty"`
+
+	// Schedule is a cron expression, e.g. "0 4 * * *"
+	Schedule string `yaml:"schedule,omitempty"`
+
+	// Action is "index" to index new snapshots into the metadata cache,
+	// "reindex" to rebuild the index, "export" to export a directory to
+	// another storage, "prune-trash" to purge old trash items or
+	// "retention-report" to report gaps between snapshots
+	Action string `yaml:"action,omitempty"`
+
+	// Storage is the name of the storage the action works on
+	Storage string `yaml:"storage,omitempty"`
+
+	// Path is the directory to export
+	Path string `yaml:"path,omitempty"`
+
+	// Snapshot is the snapshot to export from, "latest" for the newest one
+	Snapshot string `yaml:"snapshot,omitempty"`
+
+	// DestinationStorage is the storage exports and retention reports are
+	// written to, defaults to Storage for retention reports
+	DestinationStorage string `yaml:"destination_storage,omitempty"`
+
+	// Destination is the directory exports are written to, or the file
+	// retention reports are written to
+	Destination string `yaml:"destination,omitempty"`
+
+	// Include and Exclude are glob patterns selecting the exported files
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	// OlderThan is how long prune-trash keeps trashed nodes, e.g. 720h
+	OlderThan time.Duration `yaml:"older_than,omitempty"`
+
+	// MaxGap is the longest expected interval between snapshots in
+	// retention reports, defaults to 25h
+	MaxGap time.Duration `yaml:"max_gap,omitempty"`
+}
+
+// scheduleActions are the actions of scheduled tasks
+var scheduleActions = []string{"index", "reindex", "export", "prune-trash", "retention-report"}
+
+// WebhookConfig configures a receiver of webhook events
+type WebhookConfig struct {
+	// URL receives events as JSON POST requests
+	URL string `yaml:"url,omitempty"`
+
+	// Secret signs payloads with HMAC-SHA256 if set
+	Secret string `yaml:"secret,omitempty"`
+
+	// Events limits the event types sent, e.g. [node.deleted], all are sent
+	// if empty
+	Events []string `yaml:"events,omitempty"`
+
+	// Timeout limits each delivery attempt, defaults to 10s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// NotificationConfig configures a receiver of notifications
+type NotificationConfig struct {
+	// Type is "smtp", "ntfy" or "gotify"
+	Type string `yaml:"type,omitempty"`
+
+	// URL is the topic URL for ntfy, e.g. https://ntfy.sh/my-backups, or
+	// the server URL for Gotify
+	URL string `yaml:"url,omitempty"`
+
+	// Token is the access token for ntfy or the application token for
+	// Gotify
+	Token string `yaml:"token,omitempty"`
+
+	// Priority of the notifications, defaults to a higher priority for
+	// failures than for other events
+	Priority int `yaml:"priority,omitempty"`
+
+	// Address is the host:port of the mail server for smtp
+	Address string `yaml:"address,omitempty"`
+
+	// Username and Password authenticate with the mail server if set
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	// From is the sender address of emails
+	From string `yaml:"from,omitempty"`
+
+	// To are the recipient addresses of emails
+	To []string `yaml:"to,omitempty"`
+
+	// Events limits the event types sent, e.g. [job.failed], all are sent
+	// if empty
+	Events []string `yaml:"events,omitempty"`
+}
+
+// ScanConfig configures scanning uploaded and saved content for viruses
+// before it's stored. At most one scanner can be set.
+type ScanConfig struct {
+	// Clamd is the address of clamd, a Unix socket path or TCP host:port
+	Clamd string `yaml:"clamd,omitempty"`
+
+	// Command reads content from stdin and exits with 1 if it's infected,
+	// e.g. "clamdscan --no-summary -"
+	Command string `yaml:"command,omitempty"`
+}
+
+// ThumbnailsConfig configures rendering the first page of PDFs as thumbnails
+type ThumbnailsConfig struct {
+	// Mutool is the mutool binary of MuPDF, thumbnails are disabled if empty
+	Mutool string `yaml:"mutool,omitempty"`
+
+	// CacheDir stores rendered thumbnails until their file changes. They're
+	// rendered on every request if empty.
+	CacheDir string `yaml:"cache_dir,omitempty"`
+}
+
+// MetadataCacheConfig configures a SQLite cache of the file metadata of
+// snapshots, which answers snapshot summaries of directory listings without
+// walking every snapshot
+type MetadataCacheConfig struct {
+	// Path is the SQLite database file, the cache is disabled if empty
+	Path string `yaml:"path,omitempty"`
+
+	// Hash records the SHA-256 of each file, which reads all snapshot contents
+	Hash bool `yaml:"hash,omitempty"`
+
+	// IndexOnStart indexes all snapshots of all storages in the background
+	// at startup. Otherwise snapshots are indexed when first needed.
+	IndexOnStart bool `yaml:"index_on_start,omitempty"`
+
+	// Schedule is a cron expression of when to index all snapshots of all
+	// storages, e.g. "0 3 * * *" to index at night
+	Schedule string `yaml:"schedule,omitempty"`
+}
+
+// StorageConfig configures a single storage
+type StorageConfig struct {
+	// Name identifies the storage in the API and is used as the path scheme
+	Name string `yaml:"name,omitempty"`
+
+	// Type is the storage backend type, "local" (default), "timemachine",
+	// "azure", "gcs", "b2", "rclone", "autoindex", "remote", "plugin" or a
+	// type registered by another package
+	Type string `yaml:"type,omitempty"`
+
+	// Root is the root directory of a local storage, or the backup disk of a
+	// Time Machine storage
+	Root string `yaml:"root,omitempty"`
+
+	// Machine selects the backed up machine of a Time Machine storage,
+	// defaults to the first one
+	Machine string `yaml:"machine,omitempty"`
+
+	// Account is the storage account of an Azure Blob storage
+	Account string `yaml:"account,omitempty"`
+
+	// Container is the blob container of an Azure Blob storage
+	Container string `yaml:"container,omitempty"`
+
+	// SASToken authorizes requests to an Azure Blob storage, if empty the
+	// managed identity of the host is used
+	SASToken string `yaml:"sas_token,omitempty"`
+
+	// Bucket is the bucket of a Google Cloud Storage or Backblaze B2 storage
+	Bucket string `yaml:"bucket,omitempty"`
+
+	// CredentialsFile is a service account key or user credentials file for
+	// a Google Cloud Storage storage, if empty Application Default
+	// Credentials are used
+	CredentialsFile string `yaml:"credentials_file,omitempty"`
+
+	// Anonymous skips authentication of a Google Cloud Storage storage,
+	// e.g. for public buckets
+	Anonymous bool `yaml:"anonymous,omitempty"`
+
+	// KeyID is the application key ID of a Backblaze B2 storage
+	KeyID string `yaml:"key_id,omitempty"`
+
+	// ApplicationKey is the application key of a Backblaze B2 storage
+	ApplicationKey string `yaml:"application_key,omitempty"`
+
+	// Remote is the remote and optional path of an rclone storage,
+	// e.g. "gdrive:backups"
+	Remote string `yaml:"remote,omitempty"`
+
+	// RcloneConfig is the rclone config file of an rclone storage, defaults
+	// to the rclone default
+	RcloneConfig string `yaml:"rclone_config,omitempty"`
+
+	// URL is the directory index root of an autoindex storage, or the API
+	// URL of the timeship server of a remote storage
+	URL string `yaml:"url,omitempty"`
+
+	// RemoteStorage is the storage of the timeship server of a remote storage
+	RemoteStorage string `yaml:"remote_storage,omitempty"`
+
+	// Username and Password authenticate requests of an autoindex or
+	// remote storage with basic authentication
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+
+	// Token authenticates requests of a remote storage as a bearer token
+	Token string `yaml:"token,omitempty"`
+
+	// Endpoint overrides the service URL of a cloud storage
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// FilenameEncoding is the character encoding used for filenames that are
+	// not valid UTF-8, e.g. "latin1" or "shift_jis". Defaults to UTF-8.
+	FilenameEncoding string `yaml:"filename_encoding,omitempty"`
+
+	// TransliterateFilenames converts filenames decoded from the
+	// FilenameEncoding to ASCII where that's unambiguous, e.g. "café" to "cafe"
+	TransliterateFilenames bool `yaml:"transliterate_filenames,omitempty"`
+
+	// Trash moves deleted nodes to a trash directory instead of removing them
+	Trash bool `yaml:"trash,omitempty"`
+
+	// TrashRetention is how long trashed nodes are kept before they are
+	// purged, e.g. "720h". Zero keeps them until purged manually.
+	TrashRetention time.Duration `yaml:"trash_retention,omitempty"`
+
+	// Fsync flushes written files to disk before a write completes
+	Fsync bool `yaml:"fsync,omitempty"`
+
+	// Symlinks is the symlink policy: "follow" (default) lists links as their
+	// target, "link" lists them as links without following and "hide" omits them
+	Symlinks string `yaml:"symlinks,omitempty"`
+
+	// Ignore lists glob patterns of nodes that are never listed, e.g. ".git"
+	// or "node_modules". Patterns with a slash match the path from the root.
+	Ignore []string `yaml:"ignore,omitempty"`
+
+	// ManageSnapshots allows creating and destroying snapshots through the API
+	ManageSnapshots bool `yaml:"manage_snapshots,omitempty"`
+
+	// SnapshotPatterns parse timestamps from snapshot names, tried before
+	// the built-in patterns
+	SnapshotPatterns []SnapshotPatternConfig `yaml:"snapshot_patterns,omitempty"`
+
+	// SnapshotTimezone is the IANA time zone snapshot names are parsed in,
+	// e.g. "Europe/Berlin". Defaults to local time.
+	SnapshotTimezone string `yaml:"snapshot_timezone,omitempty"`
+
+	// MaxSnapshotAge is how old the newest snapshot may be, e.g. "26h".
+	// Older snapshots fail the health check and send a snapshot.missing
+	// notification. Zero disables the check.
+	MaxSnapshotAge time.Duration `yaml:"max_snapshot_age,omitempty"`
+
+	// Command is the program and its arguments of a plugin storage
+	Command []string `yaml:"command,omitempty"`
+
+	// Timeout limits how long the program of a plugin storage may take to
+	// answer a request before it's restarted, defaults to 30s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// Options are settings of plugin storages and storage types registered
+	// by other packages, which have no fields of their own
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// SnapshotPatternConfig extracts and parses a timestamp from snapshot names
+type SnapshotPatternConfig struct {
+	// Regex matches snapshot names, its first capturing group is the timestamp
+	Regex string `yaml:"regex,omitempty"`
+
+	// Layout is the Go time layout of the timestamp, e.g. "2006-01-02_15-04"
+	Layout string `yaml:"layout,omitempty"`
+
+	// Timezone is the IANA time zone of the timestamp, e.g. "Europe/Berlin".
+	// Defaults to the storage SnapshotTimezone.
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+// RemovableConfig configures storages for the drives mounted in a directory
+type RemovableConfig struct {
+	// Path is the directory drives are mounted in, e.g. "/media" or "/mnt",
+	// disabled if empty. Drives one level deeper, like
+	// /media/$USER/LABEL, are found too.
+	Path string `yaml:"path,omitempty"`
+
+	// Interval is how often the directory is checked, defaults to 5s
+	Interval time.Duration `yaml:"interval,omitempty"`
+
+	// Storage holds the options of the storages of the drives, e.g. the
+	// type "timemachine" for backup disks. The name is derived from the
+	// mount point and the root is the mount point.
+	Storage StorageConfig `yaml:"storage,omitempty"`
+}
+
+// PinConfig pins a snapshot of a storage as a virtual read-only storage
+type PinConfig struct {
+	// Name of the pinned storage, defaults to the storage name and the
+	// snapshot name joined by ".", e.g. "local.daily-2025-11-09". Pins are
+	// storages, so their names follow the same rules.
+	Name string `yaml:"name,omitempty"`
+
+	// Storage is the name of the storage the snapshot belongs to
+	Storage string `yaml:"storage,omitempty"`
+
+	// Snapshot is the snapshot ID, e.g. "zfs:daily-2025-11-09"
+	Snapshot string `yaml:"snapshot,omitempty"`
+}
+
+// Load reads the configuration from the given YAML file (if path is not empty),
+// applies environment variable overrides and fills in defaults.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+		}
+	}
+
+	cfg.applyEnv()
+
+	if err := cfg.applyDefaults(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Parse parses and validates a configuration without applying environment
+// variables, e.g. one exported from another instance
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config: %w", err)
+	}
+	if err := cfg.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides configuration values with TIMESHIP_* environment variables
+func (c *Config) applyEnv() {
+	if v := os.Getenv("TIMESHIP_ADDRESS"); v != "" {
+		c.Address = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_MDNS")); err == nil {
+		c.MDNS = v
+	}
+	if v := os.Getenv("TIMESHIP_API_PREFIX"); v != "" {
+		c.APIPrefix = v
+	}
+	if v := os.Getenv("TIMESHIP_NAME"); v != "" {
+		c.Branding.Name = v
+	}
+	if v := os.Getenv("TIMESHIP_LOGO_URL"); v != "" {
+		c.Branding.LogoURL = v
+	}
+	if v := os.Getenv("TIMESHIP_ACCENT_COLOR"); v != "" {
+		c.Branding.AccentColor = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TIMESHIP_READ_TIMEOUT")); err == nil {
+		c.ReadTimeout = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TIMESHIP_WRITE_TIMEOUT")); err == nil {
+		c.WriteTimeout = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TIMESHIP_IDLE_TIMEOUT")); err == nil {
+		c.IdleTimeout = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TIMESHIP_DRAIN_TIMEOUT")); err == nil {
+		c.DrainTimeout = v
+	}
+	if v := os.Getenv("TIMESHIP_REMOVABLE"); v != "" {
+		c.Removable.Path = v
+	}
+	if v, err := ParseByteSize(os.Getenv("TIMESHIP_STREAM_RATE_LIMIT")); err == nil {
+		c.StreamRateLimit = v
+	}
+	if v, err := ParseByteSize(os.Getenv("TIMESHIP_TOTAL_RATE_LIMIT")); err == nil {
+		c.TotalRateLimit = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_CONTENT_DIGEST")); err == nil {
+		c.ContentDigest = v
+	}
+	if v := os.Getenv("TIMESHIP_ACTIVE_CONTENT"); v != "" {
+		c.ActiveContent = v
+	}
+	if v := os.Getenv("TIMESHIP_SIGNING_KEY"); v != "" {
+		c.SigningKey = v
+	}
+	if v := os.Getenv("TIMESHIP_METADATA_CACHE"); v != "" {
+		c.MetadataCache.Path = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_METADATA_CACHE_HASH")); err == nil {
+		c.MetadataCache.Hash = v
+	}
+	if v := os.Getenv("TIMESHIP_METADATA_CACHE_SCHEDULE"); v != "" {
+		c.MetadataCache.Schedule = v
+	}
+	if v := os.Getenv("TIMESHIP_MUTOOL"); v != "" {
+		c.Thumbnails.Mutool = v
+	}
+	if v := os.Getenv("TIMESHIP_THUMBNAIL_CACHE"); v != "" {
+		c.Thumbnails.CacheDir = v
+	}
+	if v := os.Getenv("TIMESHIP_CLAMD"); v != "" {
+		c.Scan.Clamd = v
+	}
+	if v := os.Getenv("TIMESHIP_SCAN_COMMAND"); v != "" {
+		c.Scan.Command = v
+	}
+	// A single user with full access can be configured through the
+	// environment
+	if v := os.Getenv("TIMESHIP_TOKEN"); v != "" {
+		c.Access = append(c.Access, UserConfig{
+			Name:  "token",
+			Token: v,
+			Rules: []RuleConfig{{Path: "*://**", Allow: access.Permissions}},
+		})
+	}
+	if v := os.Getenv("TIMESHIP_STATE"); v != "" {
+		c.State = v
+	}
+	if v := os.Getenv("TIMESHIP_TOKENS"); v != "" {
+		c.Tokens = v
+	}
+	if v := os.Getenv("TIMESHIP_TAGS"); v != "" {
+		c.Tags = v
+	}
+	if v := os.Getenv("TIMESHIP_ACTIVITY"); v != "" {
+		c.Activity = v
+	}
+	if v := os.Getenv("TIMESHIP_JOB_HISTORY"); v != "" {
+		c.JobHistory = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TIMESHIP_JOB_HISTORY_RETENTION")); err == nil {
+		c.JobHistoryRetention = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_RESUME_JOBS")); err == nil {
+		c.ResumeJobs = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_DISABLE_RECENT")); err == nil {
+		c.DisableRecent = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_CSRF")); err == nil {
+		c.CSRF = v
+	}
+	if v := os.Getenv("TIMESHIP_CORS_ALLOWED_ORIGINS"); v != "" {
+		c.CORSOrigins = strings.Split(v, ",")
+		for i, origin := range c.CORSOrigins {
+			c.CORSOrigins[i] = strings.TrimSpace(origin)
+		}
+	}
+	// A single webhook can be configured through the environment
+	if v := os.Getenv("TIMESHIP_WEBHOOK_URL"); v != "" {
+		c.Webhooks = append(c.Webhooks, WebhookConfig{
+			URL:    v,
+			Secret: os.Getenv("TIMESHIP_WEBHOOK_SECRET"),
+		})
+	}
+	// And a single ntfy topic
+	if v := os.Getenv("TIMESHIP_NTFY_URL"); v != "" {
+		c.Notifications = append(c.Notifications, NotificationConfig{
+			Type:  "ntfy",
+			URL:   v,
+			Token: os.Getenv("TIMESHIP_NTFY_TOKEN"),
+		})
+	}
+
+	// TIMESHIP_ROOT configures the default storage root. Without a config file
+	// this is the only storage.
+	if v := os.Getenv("TIMESHIP_ROOT"); v != "" {
+		if len(c.Storages) == 0 {
+			c.Storages = append(c.Storages, StorageConfig{Name: "local"})
+		}
+		c.Storages[0].Root = v
+	}
+	if v := os.Getenv("TIMESHIP_FILENAME_ENCODING"); v != "" && len(c.Storages) > 0 {
+		c.Storages[0].FilenameEncoding = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_TRANSLITERATE_FILENAMES")); err == nil && len(c.Storages) > 0 {
+		c.Storages[0].TransliterateFilenames = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_TRASH")); err == nil && len(c.Storages) > 0 {
+		c.Storages[0].Trash = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("TIMESHIP_TRASH_RETENTION")); err == nil && len(c.Storages) > 0 {
+		c.Storages[0].TrashRetention = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_FSYNC")); err == nil && len(c.Storages) > 0 {
+		c.Storages[0].Fsync = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("TIMESHIP_MANAGE_SNAPSHOTS")); err == nil && len(c.Storages) > 0 {
+		c.Storages[0].ManageSnapshots = v
+	}
+	// A single snapshot pattern can be configured through the environment
+	if v := os.Getenv("TIMESHIP_SNAPSHOT_PATTERN"); v != "" && len(c.Storages) > 0 {
+		c.Storages[0].SnapshotPatterns = []SnapshotPatternConfig{{
+			Regex:  v,
+			Layout: os.Getenv("TIMESHIP_SNAPSHOT_LAYOUT"),
+		}}
+	}
+	if v := os.Getenv("TIMESHIP_SNAPSHOT_TIMEZONE"); v != "" && len(c.Storages) > 0 {
+		c.Storages[0].SnapshotTimezone = v
+	}
+	if v := os.Getenv("TIMESHIP_IGNORE"); v != "" && len(c.Storages) > 0 {
+		c.Storages[0].Ignore = strings.Split(v, ",")
+	}
+	if v, err := time.ParseDuration(os.Getenv("TIMESHIP_MAX_SNAPSHOT_AGE")); err == nil && len(c.Storages) > 0 {
+		c.Storages[0].MaxSnapshotAge = v
+	}
+}
+
+// applyDefaults fills in default values for unset fields
+func (c *Config) applyDefaults() error {
+	if c.Address == "" {
+		c.Address = ":8080"
+	}
+	if c.APIPrefix == "" {
+		c.APIPrefix = "/api"
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = 15 * time.Second
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = 15 * time.Second
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = 60 * time.Second
+	}
+	if c.DrainTimeout == 0 {
+		c.DrainTimeout = 30 * time.Second
+	}
+	if c.Removable.Path != "" {
+		if c.Removable.Interval == 0 {
+			c.Removable.Interval = 5 * time.Second
+		}
+		if c.Removable.Storage.Type == "" {
+			c.Removable.Storage.Type = "local"
+		}
+	}
+
+	if c.State != "" {
+		if c.Tokens == "" && len(c.Access) > 0 {
+			c.Tokens = c.State
+		}
+		if c.Tags == "" {
+			c.Tags = c.State
+		}
+		if c.Activity == "" {
+			c.Activity = c.State
+		}
+		if c.JobHistory == "" {
+			c.JobHistory = c.State
+		}
+	}
+
+	if len(c.Storages) == 0 {
+		c.Storages = append(c.Storages, StorageConfig{Name: "local"})
+	}
+
+	for i := range c.Storages {
+		s := &c.Storages[i]
+		if s.Type == "" {
+			s.Type = "local"
+		}
+		if s.Root == "" && s.Type == "local" {
+			// Fall back to the current directory, matching the behavior
+			// before config files were supported
+			wd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("unable to get current directory: %w", err)
+			}
+			s.Root = wd
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the configuration for errors
+func (c *Config) Validate() error {
+	if len(c.Storages) == 0 {
+		return errors.New("no storages configured")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.DrainTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if c.StreamRateLimit < 0 || c.TotalRateLimit < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	switch c.ActiveContent {
+	case "", "sandbox", "text", "allow":
+	default:
+		return fmt.Errorf("unknown active content mode %q", c.ActiveContent)
+	}
+	addresses := map[string]bool{}
+	for i, l := range c.Listeners {
+		if l.Address == "" || l.Address == "unix:" {
+			return fmt.Errorf("listener %d: address is required", i)
+		}
+		if addresses[l.Address] {
+			return fmt.Errorf("listener %q: duplicate address", l.Address)
+		}
+		addresses[l.Address] = true
+		if (l.TLSCert == "") != (l.TLSKey == "") {
+			return fmt.Errorf("listener %q: tls_cert and tls_key must be set together", l.Address)
+		}
+		if l.HSTS && l.TLSCert == "" {
+			return fmt.Errorf("listener %q: hsts requires tls", l.Address)
+		}
+	}
+	if l := c.Branding.LogoURL; l != "" && !strings.HasPrefix(l, "http://") && !strings.HasPrefix(l, "https://") && !strings.HasPrefix(l, "/") {
+		return errors.New("branding: logo url must be an http or https url or an absolute path")
+	}
+	if c.Branding.AccentColor != "" && !colorRegex.MatchString(c.Branding.AccentColor) {
+		return fmt.Errorf("branding: accent color %q must be a hex color like #2e7d32", c.Branding.AccentColor)
+	}
+	if c.Scan.Clamd != "" && c.Scan.Command != "" {
+		return errors.New("scan: only one of clamd and command can be set")
+	}
+	for i, w := range c.Webhooks {
+		if !strings.HasPrefix(w.URL, "http://") && !strings.HasPrefix(w.URL, "https://") {
+			return fmt.Errorf("webhook %d: http or https url is required", i)
+		}
+		for _, event := range w.Events {
+			if !slices.Contains(webhook.Events, event) {
+				return fmt.Errorf("webhook %d: unknown event %q", i, event)
+			}
+		}
+		if w.Timeout < 0 {
+			return fmt.Errorf("webhook %d: timeout must not be negative", i)
+		}
+	}
+	for i, n := range c.Notifications {
+		switch n.Type {
+		case "ntfy", "gotify":
+			if !strings.HasPrefix(n.URL, "http://") && !strings.HasPrefix(n.URL, "https://") {
+				return fmt.Errorf("notification %d: http or https url is required", i)
+			}
+			if n.Type == "gotify" && n.Token == "" {
+				return fmt.Errorf("notification %d: token is required", i)
+			}
+		case "smtp":
+			if _, _, err := net.SplitHostPort(n.Address); err != nil {
+				return fmt.Errorf("notification %d: address of the form host:port is required", i)
+			}
+			if n.From == "" || len(n.To) == 0 {
+				return fmt.Errorf("notification %d: from and to are required", i)
+			}
+		default:
+			return fmt.Errorf("notification %d: unknown type %q", i, n.Type)
+		}
+		if n.Priority < 0 {
+			return fmt.Errorf("notification %d: priority must not be negative", i)
+		}
+		for _, event := range n.Events {
+			if !slices.Contains(webhook.Events, event) {
+				return fmt.Errorf("notification %d: unknown event %q", i, event)
+			}
+		}
+	}
+	if err := c.CORS.validate(c.CORSOrigins); err != nil {
+		return fmt.Errorf("cors: %w", err)
+	}
+	for i, r := range c.CORS.Routes {
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("cors route %d: path must start with /", i)
+		}
+		origins := r.Origins
+		if len(origins) == 0 {
+			origins = c.CORSOrigins
+		}
+		if err := r.validate(origins); err != nil {
+			return fmt.Errorf("cors route %q: %w", r.Path, err)
+		}
+	}
+	for i, h := range c.Hooks {
+		if (h.Before == "") == (h.After == "") {
+			return fmt.Errorf("hook %d: exactly one of before and after is required", i)
+		}
+		if operation := h.Before + h.After; !slices.Contains(hook.Operations, operation) {
+			return fmt.Errorf("hook %d: unknown operation %q", i, operation)
+		}
+		if _, err := hook.ParseCommand(h.Command); err != nil {
+			return fmt.Errorf("hook %d: %w", i, err)
+		}
+		if h.Timeout < 0 {
+			return fmt.Errorf("hook %d: timeout must not be negative", i)
+		}
+	}
+	if c.Lockout.Failures < 0 || c.Lockout.Duration < 0 || c.Lockout.MaxDuration < 0 {
+		return errors.New("lockout: failures and durations must not be negative")
+	}
+	if _, err := c.Lockout.trustedProxies(); err != nil {
+		return fmt.Errorf("lockout: %w", err)
+	}
+	if _, err := c.AccessPolicy(nil); err != nil {
+		return fmt.Errorf("access: %w", err)
+	}
+	if c.JobHistoryRetention < 0 {
+		return errors.New("job history retention must not be negative")
+	}
+	if c.ResumeJobs && c.JobHistory == "" {
+		return errors.New("resume jobs: the job history is required to resume jobs")
+	}
+	if c.Tokens != "" && len(c.Access) == 0 {
+		return errors.New("tokens: access control is required to issue tokens")
+	}
+	if c.MetadataCache.Schedule != "" {
+		if _, err := schedule.Parse(c.MetadataCache.Schedule); err != nil {
+			return fmt.Errorf("metadata cache: %w", err)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, s := range c.Storages {
+		if s.Name == "" {
+			return fmt.Errorf("storage %d: name is required", i)
+		}
+		if !storageNameRegex.MatchString(s.Name) {
+			return fmt.Errorf("storage %q: name must start with a letter and contain only letters, digits, '+', '-' or '.'", s.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("storage %q: duplicate name", s.Name)
+		}
+		names[s.Name] = true
+
+		switch s.Type {
+		case "local":
+		case "timemachine":
+			if s.Root == "" {
+				return fmt.Errorf("storage %q: root is required", s.Name)
+			}
+		case "azure":
+			if s.Container == "" {
+				return fmt.Errorf("storage %q: container is required", s.Name)
+			}
+			if s.Account == "" && s.Endpoint == "" {
+				return fmt.Errorf("storage %q: account or endpoint is required", s.Name)
+			}
+		case "gcs":
+			if s.Bucket == "" {
+				return fmt.Errorf("storage %q: bucket is required", s.Name)
+			}
+		case "b2":
+			if s.Bucket == "" {
+				return fmt.Errorf("storage %q: bucket is required", s.Name)
+			}
+			if s.KeyID == "" || s.ApplicationKey == "" {
+				return fmt.Errorf("storage %q: key_id and application_key are required", s.Name)
+			}
+		case "rclone":
+			if !strings.Contains(s.Remote, ":") {
+				return fmt.Errorf("storage %q: remote of the form name:[path] is required", s.Name)
+			}
+		case "plugin":
+			if len(s.Command) == 0 {
+				return fmt.Errorf("storage %q: command is required", s.Name)
+			}
+			if s.Timeout < 0 {
+				return fmt.Errorf("storage %q: timeout must not be negative", s.Name)
+			}
+		case "autoindex", "remote":
+			if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+				return fmt.Errorf("storage %q: http or https url is required", s.Name)
+			}
+			if s.Type == "remote" && s.RemoteStorage == "" {
+				return fmt.Errorf("storage %q: remote_storage is required", s.Name)
+			}
+		default:
+			// Other types are checked when they're opened, as they may be
+			// registered by packages the config doesn't know
+			if !storageTypeRegex.MatchString(s.Type) {
+				return fmt.Errorf("storage %q: invalid type %q", s.Name, s.Type)
+			}
+		}
+		switch s.Symlinks {
+		case "", "follow", "link", "hide":
+		default:
+			return fmt.Errorf("storage %q: unknown symlink policy %q", s.Name, s.Symlinks)
+		}
+		for _, pattern := range s.Ignore {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("storage %q: invalid ignore pattern %q: %w", s.Name, pattern, err)
+			}
+		}
+		if s.TrashRetention < 0 {
+			return fmt.Errorf("storage %q: trash retention must not be negative", s.Name)
+		}
+		if s.MaxSnapshotAge < 0 {
+			return fmt.Errorf("storage %q: max snapshot age must not be negative", s.Name)
+		}
+		if s.SnapshotTimezone != "" {
+			if _, err := time.LoadLocation(s.SnapshotTimezone); err != nil {
+				return fmt.Errorf("storage %q: invalid snapshot timezone: %w", s.Name, err)
+			}
+		}
+		for _, p := range s.SnapshotPatterns {
+			if err := p.Validate(); err != nil {
+				return fmt.Errorf("storage %q: %w", s.Name, err)
+			}
+		}
+	}
+
+	if r := c.Removable; r.Path != "" {
+		if !filepath.IsAbs(r.Path) {
+			return errors.New("removable: path must be absolute")
+		}
+		if r.Interval < 0 {
+			return errors.New("removable: interval must not be negative")
+		}
+		if r.Storage.Name != "" || r.Storage.Root != "" {
+			return errors.New("removable: the name and root of the storages are set for each drive")
+		}
+		if r.Storage.Type != "local" && r.Storage.Type != "timemachine" {
+			return fmt.Errorf("removable: storages must be of type local or timemachine, not %q", r.Storage.Type)
+		}
+	}
+
+	for i, p := range c.Pins {
+		if !names[p.Storage] {
+			return fmt.Errorf("pin %d: unknown storage %q", i, p.Storage)
+		}
+		if p.Snapshot == "" {
+			return fmt.Errorf("pin %d: snapshot is required", i)
+		}
+		if p.Name != "" && !storageNameRegex.MatchString(p.Name) {
+			return fmt.Errorf("pin %q: name must start with a letter followed by letters, digits, '+', '-' or '.'", p.Name)
+		}
+	}
+
+	scheduleNames := map[string]bool{}
+	for i, sc := range c.Schedules {
+		if sc.Name == "" {
+			return fmt.Errorf("schedule %d: name is required", i)
+		}
+		if scheduleNames[sc.Name] {
+			return fmt.Errorf("schedule %q: duplicate name", sc.Name)
+		}
+		scheduleNames[sc.Name] = true
+		if _, err := schedule.Parse(sc.Schedule); err != nil {
+			return fmt.Errorf("schedule %q: %w", sc.Name, err)
+		}
+		if !slices.Contains(scheduleActions, sc.Action) {
+			return fmt.Errorf("schedule %q: unknown action %q", sc.Name, sc.Action)
+		}
+		if !names[sc.Storage] {
+			return fmt.Errorf("schedule %q: unknown storage %q", sc.Name, sc.Storage)
+		}
+		if sc.DestinationStorage != "" && !names[sc.DestinationStorage] {
+			return fmt.Errorf("schedule %q: unknown destination storage %q", sc.Name, sc.DestinationStorage)
+		}
+		for _, pattern := range append(slices.Clone(sc.Include), sc.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("schedule %q: invalid pattern %q: %w", sc.Name, pattern, err)
+			}
+		}
+		if sc.OlderThan < 0 || sc.MaxGap < 0 {
+			return fmt.Errorf("schedule %q: durations must not be negative", sc.Name)
+		}
+		switch sc.Action {
+		case "index", "reindex":
+			if c.MetadataCache.Path == "" {
+				return fmt.Errorf("schedule %q: metadata cache is required", sc.Name)
+			}
+		case "export":
+			if sc.DestinationStorage == "" {
+				return fmt.Errorf("schedule %q: destination_storage is required", sc.Name)
+			}
+		case "prune-trash":
+			if sc.OlderThan == 0 {
+				return fmt.Errorf("schedule %q: older_than is required", sc.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate checks the methods of the policy, and that it only lets explicit
+// origins send credentials
+func (p CORSPolicyConfig) validate(origins []string) error {
+	for _, method := range p.Methods {
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		default:
+			return fmt.Errorf("unknown method %q", method)
+		}
+	}
+	if p.Credentials && slices.Contains(origins, "*") {
+		return errors.New("credentials can't be sent from any origin")
+	}
+	if p.MaxAge < 0 {
+		return errors.New("max age must not be negative")
+	}
+	return nil
+}
+
+// Validate checks that the regex compiles and captures the timestamp, and
+// that the layout and time zone are set and valid
+func (p SnapshotPatternConfig) Validate() error {
+	re, err := regexp.Compile(p.Regex)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot pattern regex %q: %w", p.Regex, err)
+	}
+	if re.NumSubexp() < 1 {
+		return fmt.Errorf("snapshot pattern regex %q must have a capturing group", p.Regex)
+	}
+	if p.Layout == "" {
+		return fmt.Errorf("snapshot pattern %q must have a layout", p.Regex)
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return fmt.Errorf("invalid snapshot pattern timezone %q: %w", p.Timezone, err)
+		}
+	}
+	return nil
+}
+
+// AllListeners returns the configured listeners, or a listener of Address
+// if there are none
+func (c *Config) AllListeners() []ListenerConfig {
+	if len(c.Listeners) == 0 {
+		return []ListenerConfig{{Address: c.Address}}
+	}
+	return c.Listeners
+}
+
+// DefaultStorage returns the name of the default storage
+func (c *Config) DefaultStorage() string {
+	if len(c.Storages) == 0 {
+		return ""
+	}
+	return c.Storages[0].Name
+}
+
+// AccessPolicy creates the access policy of the users, nil if there are none.
+// The issuer looks up tokens issued through the API, if any.
+func (c *Config) AccessPolicy(issuer access.Issuer) (*access.Policy, error) {
+	if len(c.Access) == 0 {
+		return nil, nil
+	}
+	names := map[string]bool{}
+	users := make([]access.User, len(c.Access))
+	for i, u := range c.Access {
+		if u.Name == "" {
+			return nil, fmt.Errorf("user %d: name is required", i)
+		}
+		if names[u.Name] {
+			return nil, fmt.Errorf("user %s: duplicate name", u.Name)
+		}
+		names[u.Name] = true
+		users[i] = access.User{Name: u.Name, Token: u.Token}
+		if u.Home != "" {
+			storageName, dir, err := access.ParseHome(u.Home, u.Name)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %w", u.Name, err)
+			}
+			if !slices.ContainsFunc(c.Storages, func(s StorageConfig) bool { return s.Name == storageName }) {
+				return nil, fmt.Errorf("user %s: home storage %q not found", u.Name, storageName)
+			}
+			users[i].HomeStorage, users[i].HomePath = storageName, dir
+		}
+		for _, rc := range u.Rules {
+			rule, err := access.ParseRule(rc.Path, rc.Allow)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %w", u.Name, err)
+			}
+			users[i].Rules = append(users[i].Rules, rule)
+		}
+	}
+	trusted, err := c.Lockout.trustedProxies()
+	if err != nil {
+		return nil, fmt.Errorf("lockout: %w", err)
+	}
+	return access.NewWithConfig(users, access.Config{
+		Issuer:         issuer,
+		Failures:       c.Lockout.Failures,
+		Lockout:        c.Lockout.Duration,
+		MaxLockout:     c.Lockout.MaxDuration,
+		TrustedProxies: trusted,
+	})
+}
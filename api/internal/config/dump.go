@@ -0,0 +1,88 @@
+package config
+
+import (
+	"bytes"
+	"net/url"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in dumps
+const redacted = "REDACTED"
+
+// Dump returns the configuration as YAML with tokens, keys, passwords,
+// storage options and webhook secrets redacted, so the effective
+// configuration can be shared
+func (c *Config) Dump() ([]byte, error) {
+	d := *c
+
+	d.Storages = slices.Clone(c.Storages)
+	for i := range d.Storages {
+		s := &d.Storages[i]
+		s.SASToken = redact(s.SASToken)
+		s.ApplicationKey = redact(s.ApplicationKey)
+		s.Password = redact(s.Password)
+		s.Token = redact(s.Token)
+		s.URL = redactURL(s.URL)
+		// Options of other storage types may hold anything, so all of them
+		// are redacted
+		if s.Options != nil {
+			options := make(map[string]string, len(s.Options))
+			for k, v := range s.Options {
+				options[k] = redact(v)
+			}
+			s.Options = options
+		}
+	}
+
+	d.Webhooks = slices.Clone(c.Webhooks)
+	for i := range d.Webhooks {
+		d.Webhooks[i].URL = redactURL(d.Webhooks[i].URL)
+		d.Webhooks[i].Secret = redact(d.Webhooks[i].Secret)
+	}
+
+	d.Access = slices.Clone(c.Access)
+	for i := range d.Access {
+		d.Access[i].Token = redact(d.Access[i].Token)
+	}
+
+	return encode(&d)
+}
+
+// Export returns the configuration as YAML including its secrets, to move
+// it to another instance
+func (c *Config) Export() ([]byte, error) {
+	return encode(c)
+}
+
+// encode encodes a configuration as YAML
+func encode(c *Config) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// redact hides a secret unless it's empty
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactURL hides the password of a URL
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
@@ -0,0 +1,155 @@
+// Package demo generates sample data to try Timeship without real backups.
+//
+// The generated tree contains documents, images, code and logs that change
+// over a week, with a daily snapshot of each day in .zfs/snapshot, where the
+// local storage finds ZFS snapshots. No ZFS is needed to browse them.
+//
+// The tree is written to disk rather than kept in memory, as there is no
+// in-memory storage. Served by the local storage, the demo shows the same
+// snapshots, search, previews and restores as real backups do.
+package demo
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Days is the number of daily snapshots generated
+const Days = 7
+
+// file is a generated file, present from the day it's created until the
+// day it's deleted
+type file struct {
+	path    string
+	created int
+	deleted int // zero if never deleted
+
+	// content returns the content of the file on a day and the day it last
+	// changed
+	content func(day int) ([]byte, int)
+}
+
+// static returns content that never changes
+func static(content []byte) func(int) ([]byte, int) {
+	return func(int) ([]byte, int) { return content, 0 }
+}
+
+// files are the generated files. Day 0 is the oldest snapshot, day Days is
+// the current state.
+var files = []file{
+	{path: "README.md", content: static([]byte(readme))},
+	{path: "documents/notes.md", content: func(day int) ([]byte, int) {
+		var b strings.Builder
+		b.WriteString("# Notes\n\n")
+		for i := 0; i <= day; i++ {
+			fmt.Fprintf(&b, "- Day %d: %s\n", i+1, notes[i%len(notes)])
+		}
+		return []byte(b.String()), day
+	}},
+	{path: "documents/budget.csv", content: func(day int) ([]byte, int) {
+		if day < 4 {
+			return []byte("item,amount\nrent,1200\ngroceries,350\ninternet,40\n"), 0
+		}
+		return []byte("item,amount\nrent,1250\ngroceries,350\ninternet,40\n"), 4
+	}},
+	{path: "documents/report-draft.txt", created: 1, deleted: 5, content: static([]byte("Quarterly report\n\nTODO: write the report.\n"))},
+	{path: "documents/report.txt", created: 5, content: static([]byte("Quarterly report\n\nEverything went according to plan.\n"))},
+	{path: "photos/sunset.png", content: static(gradient(color.RGBA{255, 120, 40, 255}, color.RGBA{60, 20, 90, 255}))},
+	{path: "photos/forest.png", created: 2, content: static(gradient(color.RGBA{30, 110, 50, 255}, color.RGBA{200, 230, 120, 255}))},
+	{path: "photos/sea.png", created: 3, content: static(gradient(color.RGBA{20, 60, 160, 255}, color.RGBA{160, 220, 250, 255}))},
+	{path: "code/main.go", content: func(day int) ([]byte, int) {
+		greeting, changed := "Hello", 0
+		if day >= 3 {
+			greeting, changed = "Hello, Timeship", 3
+		}
+		return fmt.Appendf(nil, "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(%q)\n}\n", greeting), changed
+	}},
+	{path: "logs/backup.log", content: func(day int) ([]byte, int) {
+		var b strings.Builder
+		for i := 0; i <= day; i++ {
+			fmt.Fprintf(&b, "day %d: backup finished, %d files\n", i+1, 40+i*3)
+		}
+		return []byte(b.String()), day
+	}},
+}
+
+// notes are the lines added to the notes day by day
+var notes = []string{
+	"Set up the backup server",
+	"Scheduled daily snapshots",
+	"Restored a file deleted by accident",
+	"Cleaned up old photos",
+	"Started the quarterly report",
+	"Finished the quarterly report",
+	"Checked the snapshots of the week",
+	"Planned next week",
+}
+
+const readme = `# Timeship Demo
+
+This directory was generated with sample data. Its files change over a week
+and each day has a snapshot, so you can browse older versions, compare them
+and restore files, e.g. documents/report-draft.txt, which was deleted.
+
+Nothing here is real data and the directory is removed when the server stops.
+`
+
+// Generate writes the sample files as they are now into dir and a daily
+// snapshot of each of the Days days before into dir/.zfs/snapshot
+func Generate(dir string, now time.Time) error {
+	for day := 0; day < Days; day++ {
+		at := now.AddDate(0, 0, day-Days)
+		name := "daily-" + at.Format("2006-01-02")
+		if err := writeDay(filepath.Join(dir, ".zfs", "snapshot", name), day, now); err != nil {
+			return err
+		}
+	}
+	return writeDay(dir, Days, now)
+}
+
+// writeDay writes the files as they are on a day
+func writeDay(dir string, day int, now time.Time) error {
+	for _, f := range files {
+		if day < f.created || (f.deleted > 0 && day >= f.deleted) {
+			continue
+		}
+		content, changed := f.content(day)
+		p := filepath.Join(dir, filepath.FromSlash(f.path))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			return err
+		}
+		at := now.AddDate(0, 0, max(f.created, changed)-Days)
+		if err := os.Chtimes(p, at, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gradient returns a small PNG fading from one color to another
+func gradient(from, to color.RGBA) []byte {
+	const width, height = 320, 200
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	mix := func(a, b uint8, y int) uint8 {
+		return uint8((int(a)*(height-1-y) + int(b)*y) / (height - 1))
+	}
+	for y := 0; y < height; y++ {
+		c := color.RGBA{mix(from.R, to.R, y), mix(from.G, to.G, y), mix(from.B, to.B, y), 255}
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
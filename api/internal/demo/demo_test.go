@@ -0,0 +1,60 @@
+package demo
+
+import (
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"timeship/internal/storage/local"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2025, 11, 9, 12, 0, 0, 0, time.Local)
+	if err := Generate(dir, now); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	store, err := local.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	snapshots, err := store.ListSnapshots(url.URL{Scheme: "local", Path: "documents/notes.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != Days {
+		t.Fatalf("expected %d snapshots, got %d", Days, len(snapshots))
+	}
+	oldest := time.Unix(snapshots[len(snapshots)-1].Timestamp, 0)
+	if snapshots[0].Timestamp == snapshots[1].Timestamp || oldest.Format("2006-01-02") != "2025-11-02" {
+		t.Errorf("expected daily snapshots from 2025-11-02, got %+v", snapshots)
+	}
+
+	read := func(p, snapshot string) string {
+		u := url.URL{Scheme: "local", Path: p}
+		if snapshot != "" {
+			u.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+		}
+		r, err := store.ReadStream(u)
+		if err != nil {
+			return ""
+		}
+		defer r.Close()
+		data, _ := io.ReadAll(r)
+		return string(data)
+	}
+
+	if read("documents/notes.md", "zfs:daily-2025-11-02") == read("documents/notes.md", "") {
+		t.Error("expected notes to change between snapshots")
+	}
+	if read("documents/report-draft.txt", "") != "" || read("documents/report-draft.txt", "zfs:daily-2025-11-04") == "" {
+		t.Error("expected the draft to be deleted but kept in older snapshots")
+	}
+	if read("photos/sea.png", "") == "" {
+		t.Error("expected generated photos")
+	}
+}
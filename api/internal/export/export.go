@@ -0,0 +1,193 @@
+// Package export copies a subtree of a storage, typically from a snapshot,
+// to another storage, e.g. last night's ZFS snapshot of /etc to an S3
+// bucket. Files are streamed from one storage to the other, so exports work
+// between any storages that can be listed, read and written.
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+
+	"timeship/internal/storage"
+)
+
+// Options selects the files of an export
+type Options struct {
+	// Include exports only the files matching any of the patterns, all
+	// files if empty
+	Include []string
+
+	// Exclude skips the files and directories matching any of the patterns
+	Exclude []string
+}
+
+// Validate checks that the patterns are valid. Patterns use path.Match
+// syntax. Patterns without a slash match the base name at any depth,
+// patterns with a slash match the path relative to the exported directory.
+func (o Options) Validate() error {
+	for _, pattern := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Progress counts the exported files and bytes
+type Progress struct {
+	Files int64
+	Bytes int64
+}
+
+// Export copies the files below from to the directory to of dst and calls
+// progress after each file. Files already at the destination are replaced.
+// Symbolic links and special files are skipped, as storages can't write
+// them. The query of from, e.g. its snapshot, is kept for all its children.
+func Export(ctx context.Context, src storage.Storage, from url.URL, dst storage.Storage, to url.URL, opts Options, progress func(Progress)) (Progress, error) {
+	var total Progress
+	if err := opts.Validate(); err != nil {
+		return total, err
+	}
+	lister, ok := src.(storage.Lister)
+	if !ok {
+		return total, fmt.Errorf("source: %w", storage.ErrNotSupported)
+	}
+	reader, ok := src.(storage.Reader)
+	if !ok {
+		return total, fmt.Errorf("source: %w", storage.ErrNotSupported)
+	}
+	writer, ok := dst.(storage.Writer)
+	if !ok {
+		return total, fmt.Errorf("destination: %w", storage.ErrNotSupported)
+	}
+	// Object stores have no directories to create
+	creator, _ := dst.(storage.Creator)
+
+	root := strings.Trim(from.Path, "/")
+	var walk func(dir url.URL, target url.URL) error
+	walk = func(dir url.URL, target url.URL) error {
+		if creator != nil && strings.Trim(target.Path, "/") != "" {
+			if err := creator.CreateDirectory(target); err != nil && !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+		}
+		nodes, err := lister.ListContents(dir)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			child := node.Path
+			child.RawQuery = from.RawQuery
+			rel := strings.TrimPrefix(strings.TrimPrefix(strings.Trim(child.Path, "/"), root), "/")
+			childTarget := target
+			childTarget.Path = path.Join(target.Path, node.Basename)
+
+			if match(opts.Exclude, rel) {
+				continue
+			}
+			switch node.Type {
+			case "dir":
+				if err := walk(child, childTarget); err != nil {
+					return err
+				}
+				continue
+			case "link", "special":
+				log.Printf("Skipping %s %s in export", node.Type, child.String())
+				continue
+			}
+			if len(opts.Include) > 0 && !match(opts.Include, rel) {
+				continue
+			}
+			n, err := copyFile(ctx, reader, child, writer, childTarget)
+			if err != nil {
+				return fmt.Errorf("failed to export %s: %w", child.Path, err)
+			}
+			total.Files++
+			total.Bytes += n
+			if progress != nil {
+				progress(total)
+			}
+		}
+		return nil
+	}
+
+	if err := CreateParents(dst, to); err != nil {
+		return total, err
+	}
+	return total, walk(from, to)
+}
+
+// CreateParents creates the missing parent directories of a path like
+// mkdir -p. Storages without directories are left as they are.
+func CreateParents(dst storage.Storage, to url.URL) error {
+	creator, ok := dst.(storage.Creator)
+	if !ok {
+		return nil
+	}
+	parent := to
+	segments := strings.Split(strings.Trim(to.Path, "/"), "/")
+	for i := range len(segments) - 1 {
+		parent.Path = strings.Join(segments[:i+1], "/")
+		if err := creator.CreateDirectory(parent); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile streams a file from one storage to another
+func copyFile(ctx context.Context, reader storage.Reader, from url.URL, writer storage.Writer, to url.URL) (int64, error) {
+	stream, err := reader.ReadStream(from)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	counted := &countingReader{ctx: ctx, r: stream}
+	if err := writer.WriteStream(to, counted); err != nil {
+		return counted.n, err
+	}
+	return counted.n, nil
+}
+
+// countingReader counts the bytes read and stops when the context is done
+type countingReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// match reports whether a path relative to the exported directory matches
+// any of the patterns
+func match(patterns []string, rel string) bool {
+	name := path.Base(rel)
+	for _, pattern := range patterns {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = rel
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
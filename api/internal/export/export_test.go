@@ -0,0 +1,109 @@
+package export
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"timeship/internal/storage/local"
+)
+
+// files returns the relative paths and contents of all files below dir
+func files(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	found := map[string]string{}
+	filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, _ := os.ReadFile(p)
+		rel, _ := filepath.Rel(dir, p)
+		found[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return found
+}
+
+func TestExport(t *testing.T) {
+	srcDir := t.TempDir()
+	snapDir := filepath.Join(srcDir, ".zfs", "snapshot", "nightly", "etc")
+	os.MkdirAll(filepath.Join(snapDir, "nginx"), 0755)
+	os.MkdirAll(filepath.Join(snapDir, "cache"), 0755)
+	os.WriteFile(filepath.Join(snapDir, "hosts"), []byte("127.0.0.1 localhost"), 0644)
+	os.WriteFile(filepath.Join(snapDir, "nginx", "nginx.conf"), []byte("http {}"), 0644)
+	os.WriteFile(filepath.Join(snapDir, "nginx", "nginx.conf.bak"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(snapDir, "cache", "data"), []byte("cached"), 0644)
+	os.Symlink("hosts", filepath.Join(snapDir, "hosts.link"))
+	// The live tree differs from the snapshot
+	os.MkdirAll(filepath.Join(srcDir, "etc"), 0755)
+	os.WriteFile(filepath.Join(srcDir, "etc", "hosts"), []byte("changed"), 0644)
+
+	src, err := local.NewWithConfig(srcDir, local.Config{Name: "src", Symlinks: local.SymlinksLink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	from := url.URL{Scheme: "src", Path: "etc", RawQuery: url.Values{"snapshot": {"zfs:nightly"}}.Encode()}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"everything", Options{}, []string{"hosts", "cache/data", "nginx/nginx.conf", "nginx/nginx.conf.bak"}},
+		{"include", Options{Include: []string{"*.conf", "hosts"}}, []string{"hosts", "nginx/nginx.conf"}},
+		{"exclude", Options{Exclude: []string{"*.bak", "cache"}}, []string{"hosts", "nginx/nginx.conf"}},
+		{"exclude path", Options{Exclude: []string{"/nginx/*"}}, []string{"hosts", "cache/data"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dstDir := t.TempDir()
+			dst, err := local.NewWithConfig(dstDir, local.Config{Name: "dst"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dst.Close()
+
+			var calls int
+			progress, err := Export(context.Background(), src, from, dst, url.URL{Scheme: "dst", Path: "backups/etc"}, tt.opts, func(Progress) { calls++ })
+			if err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+			got := files(t, filepath.Join(dstDir, "backups", "etc"))
+			var names []string
+			for name := range got {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(names, want) {
+				t.Fatalf("expected %v, got %v", want, names)
+			}
+			if got["hosts"] != "127.0.0.1 localhost" {
+				t.Errorf("expected the snapshot content, got %q", got["hosts"])
+			}
+			if progress.Files != int64(len(want)) || calls != len(want) || progress.Bytes == 0 {
+				t.Errorf("unexpected progress %+v after %d calls", progress, calls)
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		dst, _ := local.NewWithConfig(t.TempDir(), local.Config{Name: "dst"})
+		defer dst.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := Export(ctx, src, from, dst, url.URL{Scheme: "dst"}, Options{}, nil); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		if err := (Options{Include: []string{"["}}).Validate(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,388 @@
+//go:build linux || darwin || freebsd
+
+// Package fusefs exposes a storage as a read-only FUSE filesystem.
+//
+// The filesystem reuses the storage capability interfaces, so any storage that
+// implements storage.Lister and storage.Reader can be mounted. Snapshots are
+// exposed as subdirectories, so standard tools like rsync and diff can operate
+// on snapshot contents:
+//
+//	<mountpoint>/current/...           live contents of the storage
+//	<mountpoint>/snapshots/<name>/...  contents as of each snapshot
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"timeship/internal/storage"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Supported reports whether FUSE mounting is supported on this platform
+const Supported = true
+
+// cacheTimeout is how long the kernel may cache entries and attributes.
+// Snapshot contents never change and live contents change rarely enough for
+// browsing, so a short timeout is a good tradeoff.
+const cacheTimeout = 5 * time.Second
+
+// Options configures a mount
+type Options struct {
+	// AllowOther allows other users to access the mount
+	AllowOther bool
+
+	// Debug enables FUSE debug logging
+	Debug bool
+}
+
+// Mount mounts the storage at the mountpoint and returns the running server.
+// Call Unmount on the server to unmount, and Wait to block until it is unmounted.
+func Mount(mountpoint string, name string, store storage.Storage, options Options) (*fuse.Server, error) {
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return nil, errors.New("storage does not support listing")
+	}
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		return nil, errors.New("storage does not support reading")
+	}
+
+	root := &rootNode{
+		fsys: &filesystem{
+			name:   name,
+			lister: lister,
+			reader: reader,
+		},
+	}
+	root.fsys.snapshotLister, _ = store.(storage.SnapshotLister)
+
+	timeout := cacheTimeout
+	return fs.Mount(mountpoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			AllowOther: options.AllowOther,
+			Debug:      options.Debug,
+			FsName:     "timeship:" + name,
+			Name:       "timeship",
+			Options:    []string{"ro"},
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+}
+
+// filesystem holds the storage capabilities shared by all nodes
+type filesystem struct {
+	name           string
+	lister         storage.Lister
+	reader         storage.Reader
+	snapshotLister storage.SnapshotLister
+}
+
+// rootNode is the mount root containing the "current" and "snapshots" directories
+type rootNode struct {
+	fs.Inode
+	fsys *filesystem
+}
+
+var _ = (fs.NodeOnAdder)((*rootNode)(nil))
+
+func (r *rootNode) OnAdd(ctx context.Context) {
+	current := &node{
+		fsys:  r.fsys,
+		path:  url.URL{Scheme: r.fsys.name},
+		isDir: true,
+	}
+	r.AddChild("current", r.NewPersistentInode(ctx, current, fs.StableAttr{Mode: fuse.S_IFDIR}), false)
+
+	if r.fsys.snapshotLister != nil {
+		snapshots := &snapshotsNode{fsys: r.fsys}
+		r.AddChild("snapshots", r.NewPersistentInode(ctx, snapshots, fs.StableAttr{Mode: fuse.S_IFDIR}), false)
+	}
+}
+
+// snapshotsNode lists all snapshots of the storage root as directories
+type snapshotsNode struct {
+	fs.Inode
+	fsys *filesystem
+}
+
+var _ = (fs.NodeReaddirer)((*snapshotsNode)(nil))
+var _ = (fs.NodeLookuper)((*snapshotsNode)(nil))
+
+// snapshots returns the snapshots keyed by their directory name
+func (n *snapshotsNode) snapshots() (map[string]storage.Snapshot, []string, syscall.Errno) {
+	snapshots, err := n.fsys.snapshotLister.ListSnapshots(url.URL{Scheme: n.fsys.name})
+	if err != nil {
+		return nil, nil, toErrno(err)
+	}
+
+	byName := make(map[string]storage.Snapshot, len(snapshots))
+	names := make([]string, 0, len(snapshots))
+	for _, snap := range snapshots {
+		name := snap.Name
+		if name == "" {
+			name = snap.ID
+		}
+		if _, exists := byName[name]; exists {
+			continue
+		}
+		byName[name] = snap
+		names = append(names, name)
+	}
+	return byName, names, 0
+}
+
+func (n *snapshotsNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	_, names, errno := n.snapshots()
+	if errno != 0 {
+		return nil, errno
+	}
+
+	entries := make([]fuse.DirEntry, len(names))
+	for i, name := range names {
+		entries[i] = fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR}
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *snapshotsNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	byName, _, errno := n.snapshots()
+	if errno != 0 {
+		return nil, errno
+	}
+
+	snap, ok := byName[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	u := url.URL{Scheme: n.fsys.name}
+	q := u.Query()
+	q.Set("snapshot", snap.ID)
+	u.RawQuery = q.Encode()
+
+	child := &node{
+		fsys:  n.fsys,
+		path:  u,
+		isDir: true,
+		mtime: snap.Timestamp,
+	}
+	child.fillAttr(&out.Attr)
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: fuse.S_IFDIR}), 0
+}
+
+// node is a file or directory of the storage
+type node struct {
+	fs.Inode
+	fsys  *filesystem
+	path  url.URL
+	isDir bool
+	size  int64
+	mtime int64
+
+	// target is the target of an unfollowed symbolic link
+	target string
+}
+
+var _ = (fs.NodeGetattrer)((*node)(nil))
+var _ = (fs.NodeReaddirer)((*node)(nil))
+var _ = (fs.NodeLookuper)((*node)(nil))
+var _ = (fs.NodeOpener)((*node)(nil))
+var _ = (fs.NodeReader)((*node)(nil))
+var _ = (fs.NodeReadlinker)((*node)(nil))
+
+// fillAttr fills in read-only attributes
+func (n *node) fillAttr(attr *fuse.Attr) {
+	switch {
+	case n.isDir:
+		attr.Mode = fuse.S_IFDIR | 0555
+	case n.target != "":
+		attr.Mode = fuse.S_IFLNK | 0777
+		attr.Size = uint64(len(n.target))
+	default:
+		attr.Mode = fuse.S_IFREG | 0444
+		attr.Size = uint64(n.size)
+	}
+	mtime := time.Unix(n.mtime, 0)
+	attr.SetTimes(nil, &mtime, nil)
+}
+
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	n.fillAttr(&out.Attr)
+	return 0
+}
+
+// list returns the children of a directory node, with the snapshot preserved
+func (n *node) list() ([]storage.FileNode, syscall.Errno) {
+	nodes, err := n.fsys.lister.ListContents(n.path)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	for i := range nodes {
+		nodes[i].Path.RawQuery = n.path.RawQuery
+	}
+	return nodes, 0
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	nodes, errno := n.list()
+	if errno != 0 {
+		return nil, errno
+	}
+
+	entries := make([]fuse.DirEntry, len(nodes))
+	for i, child := range nodes {
+		entries[i] = fuse.DirEntry{Name: child.Basename, Mode: nodeMode(child)}
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	nodes, errno := n.list()
+	if errno != 0 {
+		return nil, errno
+	}
+
+	for _, child := range nodes {
+		if child.Basename != name {
+			continue
+		}
+		c := &node{
+			fsys:  n.fsys,
+			path:  child.Path,
+			isDir: child.Type == "dir",
+			size:  child.Size,
+			mtime: child.LastModified,
+		}
+		if child.Type == "link" {
+			c.target = child.LinkTarget
+		}
+		c.fillAttr(&out.Attr)
+		return n.NewInode(ctx, c, fs.StableAttr{Mode: nodeMode(child)}), 0
+	}
+
+	return nil, syscall.ENOENT
+}
+
+func (n *node) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	if n.target == "" {
+		return nil, syscall.EINVAL
+	}
+	return []byte(n.target), 0
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+
+	stream, err := n.fsys.reader.ReadStream(n.path)
+	if err != nil {
+		return nil, 0, toErrno(err)
+	}
+
+	return &handle{node: n, stream: stream}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (n *node) Read(ctx context.Context, f fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h, ok := f.(*handle)
+	if !ok {
+		return nil, syscall.EBADF
+	}
+
+	read, err := h.readAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, toErrno(err)
+	}
+	return fuse.ReadResultData(dest[:read]), 0
+}
+
+// handle is an open file. Streams that support io.ReaderAt are read at
+// arbitrary offsets, others are read sequentially and reopened on seeks.
+type handle struct {
+	node *node
+
+	mu     sync.Mutex
+	stream io.ReadCloser
+	offset int64
+}
+
+var _ = (fs.FileReleaser)((*handle)(nil))
+
+func (h *handle) readAt(dest []byte, off int64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ra, ok := h.stream.(io.ReaderAt); ok {
+		return ra.ReadAt(dest, off)
+	}
+
+	if off < h.offset {
+		// Seeking backwards requires reopening the stream
+		stream, err := h.node.fsys.reader.ReadStream(h.node.path)
+		if err != nil {
+			return 0, err
+		}
+		h.stream.Close()
+		h.stream = stream
+		h.offset = 0
+	}
+
+	if off > h.offset {
+		skipped, err := io.CopyN(io.Discard, h.stream, off-h.offset)
+		h.offset += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	read, err := io.ReadFull(h.stream, dest)
+	h.offset += int64(read)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return read, err
+}
+
+func (h *handle) Release(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stream.Close()
+	return 0
+}
+
+// nodeMode returns the file type bits of a storage node
+func nodeMode(node storage.FileNode) uint32 {
+	switch node.Type {
+	case "dir":
+		return fuse.S_IFDIR
+	case "link":
+		return fuse.S_IFLNK
+	default:
+		return fuse.S_IFREG
+	}
+}
+
+// toErrno maps storage errors to errno values
+func toErrno(err error) syscall.Errno {
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, os.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, os.ErrPermission):
+		return syscall.EACCES
+	default:
+		return syscall.EIO
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !(linux || darwin || freebsd)
+
+package fusefs
+
+import (
+	"errors"
+
+	"timeship/internal/storage"
+)
+
+// Supported reports whether FUSE mounting is supported on this platform
+const Supported = false
+
+// Options configures a mount
+type Options struct {
+	// AllowOther allows other users to access the mount
+	AllowOther bool
+
+	// Debug enables FUSE debug logging
+	Debug bool
+}
+
+// Server is a placeholder for the FUSE server on unsupported platforms
+type Server struct{}
+
+// Unmount is a no-op on unsupported platforms
+func (s *Server) Unmount() error { return nil }
+
+// Wait is a no-op on unsupported platforms
+func (s *Server) Wait() {}
+
+// Mount is not supported on this platform
+func Mount(mountpoint string, name string, store storage.Storage, options Options) (*Server, error) {
+	return nil, errors.New("FUSE mounts are not supported on this platform")
+}
@@ -0,0 +1,91 @@
+//go:build linux || darwin || freebsd
+
+package fusefs
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// sequentialReader is a storage.Reader whose streams don't support io.ReaderAt
+type sequentialReader struct {
+	content string
+	opened  int
+}
+
+func (r *sequentialReader) ReadStream(path url.URL) (io.ReadCloser, error) {
+	r.opened++
+	return io.NopCloser(strings.NewReader(r.content)), nil
+}
+
+func (r *sequentialReader) FileSize(path url.URL) (int64, error) {
+	return int64(len(r.content)), nil
+}
+
+func (r *sequentialReader) MimeType(path url.URL) (string, error) {
+	return "text/plain", nil
+}
+
+func TestHandleReadAt(t *testing.T) {
+	reader := &sequentialReader{content: "0123456789"}
+	n := &node{
+		fsys: &filesystem{name: "local", reader: reader},
+		path: url.URL{Scheme: "local", Path: "file.txt"},
+	}
+
+	fh, _, errno := n.Open(context.Background(), syscall.O_RDONLY)
+	if errno != 0 {
+		t.Fatalf("Open failed: %v", errno)
+	}
+	h := fh.(*handle)
+
+	tests := []struct {
+		name     string
+		offset   int64
+		length   int
+		expected string
+	}{
+		{"start", 0, 3, "012"},
+		{"sequential", 3, 3, "345"},
+		{"skip forward", 7, 2, "78"},
+		{"seek backwards", 1, 2, "12"},
+		{"past end", 8, 5, "89"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := make([]byte, tt.length)
+			read, err := h.readAt(dest, tt.offset)
+			if err != nil && err != io.EOF {
+				t.Fatalf("readAt failed: %v", err)
+			}
+			if got := string(dest[:read]); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// Only seeking backwards should reopen the stream
+	if reader.opened != 2 {
+		t.Errorf("expected stream to be opened twice, got %d", reader.opened)
+	}
+
+	if errno := h.Release(context.Background()); errno != 0 {
+		t.Errorf("Release failed: %v", errno)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	n := &node{
+		fsys: &filesystem{name: "local", reader: &sequentialReader{}},
+		path: url.URL{Scheme: "local", Path: "file.txt"},
+	}
+
+	if _, _, errno := n.Open(context.Background(), syscall.O_RDWR); errno != syscall.EROFS {
+		t.Errorf("expected EROFS, got %v", errno)
+	}
+}
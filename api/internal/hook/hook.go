@@ -0,0 +1,279 @@
+// Package hook runs commands before and after operations, e.g. to take a ZFS
+// snapshot before anything is written or to start a scrub after restores.
+//
+// Command arguments are Go templates of the Operation, like
+// "zfs snapshot tank/data@pre-{{.Time.Unix}}". Arguments are split at
+// spaces before they're expanded, so paths with spaces stay one argument and
+// are never interpreted by a shell. A failing before hook aborts the
+// operation. After hooks run in the background once the operation succeeded.
+package hook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Operations hooks can run around
+const (
+	// Write is uploading, creating, saving or copying a file
+	Write = "write"
+
+	// Delete is deleting or trashing a node
+	Delete = "delete"
+
+	// Restore is restoring a node from a snapshot or the trash
+	Restore = "restore"
+
+	// Snapshot is creating a snapshot
+	Snapshot = "snapshot"
+)
+
+// Operations lists all operations
+var Operations = []string{Write, Delete, Restore, Snapshot}
+
+// defaultTimeout limits each command if the hook has no timeout
+const defaultTimeout = time.Minute
+
+// maxOutput limits how much command output is kept for errors and logs
+const maxOutput = 1024
+
+// ErrFailed is returned when a before hook failed, so the operation wasn't
+// performed
+var ErrFailed = errors.New("hook failed")
+
+// Operation describes an operation, the data of argument templates
+type Operation struct {
+	// Name is one of the operations, e.g. "write"
+	Name string
+
+	// Storage is the name of the storage the operation is in
+	Storage string
+
+	// Path is the path of the node relative to the storage root
+	Path string
+
+	// Snapshot is the ID of the snapshot involved, e.g. the one a node is
+	// restored from
+	Snapshot string
+
+	// Destination is where a node is restored or copied to
+	Destination string
+
+	// Time is when the hooks of the operation started
+	Time time.Time
+}
+
+// Command is a command line with templated arguments
+type Command struct {
+	text string
+	args []*template.Template
+}
+
+// ParseCommand parses a command line, splitting it into arguments at spaces
+// outside of template actions
+func ParseCommand(command string) (*Command, error) {
+	fields := splitFields(command)
+	if len(fields) == 0 {
+		return nil, errors.New("empty command")
+	}
+	c := &Command{text: command}
+	for _, field := range fields {
+		tmpl, err := template.New("arg").Option("missingkey=error").Parse(field)
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, tmpl)
+	}
+	return c, nil
+}
+
+// Args expands the arguments for an operation
+func (c *Command) Args(op Operation) ([]string, error) {
+	args := make([]string, len(c.args))
+	for i, tmpl := range c.args {
+		var arg strings.Builder
+		if err := tmpl.Execute(&arg, op); err != nil {
+			return nil, err
+		}
+		args[i] = arg.String()
+	}
+	return args, nil
+}
+
+// String returns the command line as configured
+func (c *Command) String() string {
+	return c.text
+}
+
+// splitFields splits a command line at spaces that aren't within {{ }}
+func splitFields(command string) []string {
+	var fields []string
+	var field strings.Builder
+	depth := 0
+	for i := 0; i < len(command); i++ {
+		switch {
+		case strings.HasPrefix(command[i:], "{{"):
+			depth++
+			field.WriteString("{{")
+			i++
+			continue
+		case depth > 0 && strings.HasPrefix(command[i:], "}}"):
+			depth--
+			field.WriteString("}}")
+			i++
+			continue
+		case depth == 0 && unicode.IsSpace(rune(command[i])):
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteByte(command[i])
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// Hook runs a command before or after an operation
+type Hook struct {
+	// Operation is one of the operations, e.g. "write"
+	Operation string
+
+	// After runs the command after the operation succeeded instead of before
+	After bool
+
+	// Command is run with the expanded arguments
+	Command *Command
+
+	// Timeout limits how long the command may run, defaults to a minute
+	Timeout time.Duration
+}
+
+// Runner runs the hooks of operations
+type Runner struct {
+	hooks []Hook
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New creates a runner for the hooks
+func New(hooks []Hook) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{hooks: hooks, ctx: ctx, cancel: cancel}
+}
+
+// Before runs the before hooks of an operation in order. The first failure
+// stops the others and returns an error wrapping ErrFailed.
+func (r *Runner) Before(ctx context.Context, op Operation) error {
+	if op.Time.IsZero() {
+		op.Time = time.Now().UTC()
+	}
+	for _, h := range r.hooks {
+		if h.After || h.Operation != op.Name {
+			continue
+		}
+		if err := run(ctx, h, op); err != nil {
+			return fmt.Errorf("%w: before %s: %v", ErrFailed, op.Name, err)
+		}
+	}
+	return nil
+}
+
+// After runs the after hooks of an operation in order in the background.
+// Failures are logged.
+func (r *Runner) After(op Operation) {
+	if op.Time.IsZero() {
+		op.Time = time.Now().UTC()
+	}
+	var hooks []Hook
+	for _, h := range r.hooks {
+		if h.After && h.Operation == op.Name {
+			hooks = append(hooks, h)
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for _, h := range hooks {
+			if err := run(r.ctx, h, op); err != nil {
+				log.Printf("After %s hook failed: %v", op.Name, err)
+			}
+		}
+	}()
+}
+
+// Close waits for running after hooks until ctx is done, then kills them
+func (r *Runner) Close(ctx context.Context) error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// run runs the command of a hook for an operation
+func run(ctx context.Context, h Hook, op Operation) error {
+	args, err := h.Command.Args(op)
+	if err != nil {
+		return fmt.Errorf("%s: %w", h.Command, err)
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	// Children of killed commands may keep the output open
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		message := strings.TrimSpace(string(output))
+		if len(message) > maxOutput {
+			message = message[:maxOutput] + "..."
+		}
+		if message != "" {
+			return fmt.Errorf("%s: %w: %s", args[0], err, message)
+		}
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package hook
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandArgs(t *testing.T) {
+	op := Operation{
+		Name:     Restore,
+		Storage:  "local",
+		Path:     "my docs/a.txt",
+		Snapshot: "zfs:daily",
+		Time:     time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{"plain", "zpool scrub tank", []string{"zpool", "scrub", "tank"}, false},
+		{"extra spaces", "  zpool\tscrub  tank ", []string{"zpool", "scrub", "tank"}, false},
+		{"path stays one argument", "logger restored {{.Path}}", []string{"logger", "restored", "my docs/a.txt"}, false},
+		{"spaces in actions", `zfs snapshot tank@pre-{{.Time.Format "20060102"}}`, []string{"zfs", "snapshot", "tank@pre-20261016"}, false},
+		{"fields", "echo {{.Name}} {{.Storage}} {{.Snapshot}} {{.Time.Unix}}", []string{"echo", "restore", "local", "zfs:daily", "1792152000"}, false},
+		{"empty", "  ", nil, true},
+		{"invalid template", "echo {{.Path", nil, true},
+		{"unknown field", "echo {{.Size}}", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, err := ParseCommand(tt.command)
+			var args []string
+			if err == nil {
+				args, err = command.Args(op)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, args)
+			}
+		})
+	}
+}
+
+func TestRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands need a shell")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := filepath.Join(dir, "hook.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> \""+log+"\"\n[ \"$1\" != fail ] || { echo refused; exit 3; }\n"), 0755)
+
+	mustParse := func(command string) *Command {
+		c, err := ParseCommand(command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	readLog := func() string {
+		content, _ := os.ReadFile(log)
+		os.Remove(log)
+		return string(content)
+	}
+
+	r := New([]Hook{
+		{Operation: Write, Command: mustParse(script + " before {{.Path}}")},
+		{Operation: Write, After: true, Command: mustParse(script + " after {{.Path}}")},
+		{Operation: Delete, Command: mustParse(script + " fail {{.Path}}")},
+		{Operation: Delete, Command: mustParse(script + " never")},
+		{Operation: Snapshot, Command: mustParse("sleep 10"), Timeout: 50 * time.Millisecond},
+	})
+
+	t.Run("before", func(t *testing.T) {
+		if err := r.Before(context.Background(), Operation{Name: Write, Path: "a.txt"}); err != nil {
+			t.Fatalf("Before failed: %v", err)
+		}
+		if got := readLog(); got != "before a.txt\n" {
+			t.Errorf("expected before hook only, got %q", got)
+		}
+	})
+
+	t.Run("failure stops the operation", func(t *testing.T) {
+		err := r.Before(context.Background(), Operation{Name: Delete, Path: "b.txt"})
+		if !errors.Is(err, ErrFailed) || !strings.Contains(err.Error(), "refused") {
+			t.Errorf("expected failure with output, got %v", err)
+		}
+		if got := readLog(); got != "fail b.txt\n" {
+			t.Errorf("expected later hooks to be skipped, got %q", got)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		if err := r.Before(context.Background(), Operation{Name: Snapshot}); !errors.Is(err, ErrFailed) {
+			t.Errorf("expected timeout to fail, got %v", err)
+		}
+	})
+
+	t.Run("no hooks", func(t *testing.T) {
+		if err := r.Before(context.Background(), Operation{Name: Restore}); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("after", func(t *testing.T) {
+		r.After(Operation{Name: Write, Path: "c.txt"})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.Close(ctx); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if got := readLog(); got != "after c.txt\n" {
+			t.Errorf("expected after hook, got %q", got)
+		}
+		r.After(Operation{Name: Write, Path: "d.txt"})
+		if got := readLog(); got != "" {
+			t.Errorf("expected no hooks after close, got %q", got)
+		}
+	})
+}
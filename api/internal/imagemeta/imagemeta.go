@@ -0,0 +1,149 @@
+// Package imagemeta reads the dimensions and EXIF metadata of images, like
+// when and where a photo was taken and with which camera.
+package imagemeta
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// headerSize is how much of an image is read. EXIF data is limited to 64 KiB
+// and the dimensions follow shortly after in the formats supported.
+const headerSize = 256 << 10
+
+// exifTimeLayout is the format of EXIF date and time tags
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// ErrNoMetadata is returned for images without readable metadata
+var ErrNoMetadata = errors.New("no image metadata found")
+
+// Metadata describes an image. Fields are zero if unknown.
+type Metadata struct {
+	// Width and Height are the dimensions as displayed, with the orientation
+	// applied
+	Width, Height int
+	// DateTaken is the local time of the camera when the photo was taken.
+	// EXIF has no time zone, so it's returned as UTC.
+	DateTaken time.Time
+	// CameraMake and CameraModel identify the camera
+	CameraMake, CameraModel string
+	// Orientation is the EXIF orientation from 1 to 8
+	Orientation int
+	// HasLocation reports whether GPS coordinates were found
+	HasLocation         bool
+	Latitude, Longitude float64
+}
+
+// supportedExtensions are the extensions of files metadata is read from, in
+// case the MIME type isn't detected
+var supportedExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".jpe":  true,
+	".tif":  true,
+	".tiff": true,
+	".png":  true,
+	".gif":  true,
+}
+
+// Supported reports whether metadata can be read from a file
+func Supported(name, mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/tiff", "image/png", "image/gif":
+		return true
+	}
+	return supportedExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// Read reads the metadata from the start of an image
+func Read(r io.Reader) (Metadata, error) {
+	header, err := io.ReadAll(io.LimitReader(r, headerSize))
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var m Metadata
+	found := false
+	if config, _, err := image.DecodeConfig(bytes.NewReader(header)); err == nil {
+		m.Width, m.Height = config.Width, config.Height
+		found = true
+	}
+
+	// Some tags may be unreadable, the rest is still used
+	x, err := exif.Decode(bytes.NewReader(header))
+	if x != nil && (err == nil || !exif.IsCriticalError(err)) {
+		readExif(x, &m)
+		found = true
+	}
+	if !found {
+		return Metadata{}, ErrNoMetadata
+	}
+
+	// Orientations 5 to 8 rotate the image by 90 degrees
+	if m.Orientation >= 5 && m.Orientation <= 8 {
+		m.Width, m.Height = m.Height, m.Width
+	}
+	return m, nil
+}
+
+// readExif copies the tags of interest
+func readExif(x *exif.Exif, m *Metadata) {
+	m.CameraMake = stringTag(x, exif.Make)
+	m.CameraModel = stringTag(x, exif.Model)
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		m.Orientation, _ = tag.Int(0)
+	}
+	if m.Width == 0 || m.Height == 0 {
+		// TIFF images aren't decoded, so their dimensions come from the tags
+		m.Width = intTag(x, exif.PixelXDimension, exif.ImageWidth)
+		m.Height = intTag(x, exif.PixelYDimension, exif.ImageLength)
+	}
+
+	for _, name := range []exif.FieldName{exif.DateTimeOriginal, exif.DateTime} {
+		t, err := time.Parse(exifTimeLayout, stringTag(x, name))
+		if err == nil {
+			m.DateTaken = t
+			break
+		}
+	}
+
+	if lat, long, err := x.LatLong(); err == nil {
+		m.HasLocation = true
+		m.Latitude, m.Longitude = lat, long
+	}
+}
+
+// stringTag returns a string tag without padding, or "" if missing
+func stringTag(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	s, _ := tag.StringVal()
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+// intTag returns the first integer tag found, or 0
+func intTag(x *exif.Exif, names ...exif.FieldName) int {
+	for _, name := range names {
+		tag, err := x.Get(name)
+		if err != nil || tag.Format() != tiff.IntVal {
+			continue
+		}
+		if v, err := tag.Int(0); err == nil {
+			return v
+		}
+	}
+	return 0
+}
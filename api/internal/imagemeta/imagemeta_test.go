@@ -0,0 +1,215 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+)
+
+// tiffEntry is a tag of a TIFF directory
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func shortEntry(tag uint16, v uint16) tiffEntry {
+	return tiffEntry{tag: tag, typ: 3, count: 1, data: binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func longEntry(tag uint16, v uint32) tiffEntry {
+	return tiffEntry{tag: tag, typ: 4, count: 1, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// degreesEntry encodes a coordinate as degrees, minutes and seconds
+func degreesEntry(tag uint16, v float64) tiffEntry {
+	deg := math.Floor(v)
+	min := math.Floor((v - deg) * 60)
+	sec := ((v-deg)*60 - min) * 60
+	var data []byte
+	for _, r := range [][2]uint32{{uint32(deg), 1}, {uint32(min), 1}, {uint32(math.Round(sec * 100)), 100}} {
+		data = binary.LittleEndian.AppendUint32(data, r[0])
+		data = binary.LittleEndian.AppendUint32(data, r[1])
+	}
+	return tiffEntry{tag: tag, typ: 5, count: 3, data: data}
+}
+
+// ifdSize returns the encoded size of a directory including its values
+func ifdSize(entries []tiffEntry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.data) > 4 {
+			size += uint32(len(e.data)+1) &^ 1
+		}
+	}
+	return size
+}
+
+// appendIFD encodes a directory at an offset with its values following it
+func appendIFD(b []byte, offset uint32, entries []tiffEntry) []byte {
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(entries)))
+	valueOffset := offset + uint32(2+12*len(entries)+4)
+	var values []byte
+	for _, e := range entries {
+		b = binary.LittleEndian.AppendUint16(b, e.tag)
+		b = binary.LittleEndian.AppendUint16(b, e.typ)
+		b = binary.LittleEndian.AppendUint32(b, e.count)
+		if len(e.data) <= 4 {
+			b = append(b, e.data...)
+			b = append(b, make([]byte, 4-len(e.data))...)
+			continue
+		}
+		b = binary.LittleEndian.AppendUint32(b, valueOffset+uint32(len(values)))
+		values = append(values, e.data...)
+		if len(e.data)%2 == 1 {
+			values = append(values, 0)
+		}
+	}
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	return append(b, values...)
+}
+
+// exifJPEG encodes a JPEG with an EXIF segment
+func exifJPEG(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+	exifIFD := []tiffEntry{asciiEntry(0x9003, "2024:07:01 14:03:22")}
+	gpsIFD := []tiffEntry{
+		asciiEntry(0x0001, "N"),
+		degreesEntry(0x0002, 46.05),
+		asciiEntry(0x0003, "E"),
+		degreesEntry(0x0004, 14.5),
+	}
+	ifd0 := []tiffEntry{
+		asciiEntry(0x010f, "Canon"),
+		asciiEntry(0x0110, "Canon EOS R6"),
+		shortEntry(0x0112, orientation),
+		{tag: 0x8769, typ: 4, count: 1},
+		{tag: 0x8825, typ: 4, count: 1},
+	}
+	exifOffset := 8 + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exifIFD)
+	ifd0[3] = longEntry(0x8769, exifOffset)
+	ifd0[4] = longEntry(0x8825, gpsOffset)
+
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = appendIFD(tiff, 8, ifd0)
+	tiff = appendIFD(tiff, exifOffset, exifIFD)
+	tiff = appendIFD(tiff, gpsOffset, gpsIFD)
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	// Insert the segment right after the start of image marker
+	jpg := img.Bytes()
+	return append(append(append([]byte{}, jpg[:2]...), segment...), jpg[2:]...)
+}
+
+func TestRead(t *testing.T) {
+	var plainPNG bytes.Buffer
+	png.Encode(&plainPNG, image.NewGray(image.Rect(0, 0, 3, 5)))
+
+	tests := []struct {
+		name      string
+		content   []byte
+		want      Metadata
+		wantError error
+	}{
+		{
+			name:    "jpeg with exif",
+			content: exifJPEG(t, 4, 2, 1),
+			want: Metadata{
+				Width:       4,
+				Height:      2,
+				DateTaken:   time.Date(2024, 7, 1, 14, 3, 22, 0, time.UTC),
+				CameraMake:  "Canon",
+				CameraModel: "Canon EOS R6",
+				Orientation: 1,
+				HasLocation: true,
+				Latitude:    46.05,
+				Longitude:   14.5,
+			},
+		},
+		{
+			name:    "rotated",
+			content: exifJPEG(t, 4, 2, 6),
+			want: Metadata{
+				Width:       2,
+				Height:      4,
+				DateTaken:   time.Date(2024, 7, 1, 14, 3, 22, 0, time.UTC),
+				CameraMake:  "Canon",
+				CameraModel: "Canon EOS R6",
+				Orientation: 6,
+				HasLocation: true,
+				Latitude:    46.05,
+				Longitude:   14.5,
+			},
+		},
+		{
+			name:    "png without exif",
+			content: plainPNG.Bytes(),
+			want:    Metadata{Width: 3, Height: 5},
+		},
+		{
+			name:      "not an image",
+			content:   []byte("hello"),
+			wantError: ErrNoMetadata,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(bytes.NewReader(tt.content))
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Fatalf("expected error %v, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			// Coordinates are stored with limited precision
+			if math.Abs(got.Latitude-tt.want.Latitude) < 1e-6 && math.Abs(got.Longitude-tt.want.Longitude) < 1e-6 {
+				got.Latitude, got.Longitude = tt.want.Latitude, tt.want.Longitude
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		want     bool
+	}{
+		{"photo.JPG", "", true},
+		{"scan.tiff", "application/octet-stream", true},
+		{"image", "image/png", true},
+		{"notes.txt", "text/plain", false},
+	}
+	for _, tt := range tests {
+		if got := Supported(tt.name, tt.mimeType); got != tt.want {
+			t.Errorf("Supported(%q, %q) = %v, want %v", tt.name, tt.mimeType, got, tt.want)
+		}
+	}
+}
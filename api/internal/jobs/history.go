@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"timeship/internal/state"
+)
+
+// migrations create the jobs table. Jobs are ordered by seq, the order they
+// finished in. Params are stored as JSON, times as Unix milliseconds.
+var migrations = []string{`
+CREATE TABLE jobs (
+	seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+	id          TEXT NOT NULL UNIQUE,
+	type        TEXT NOT NULL,
+	params      TEXT NOT NULL,
+	user        TEXT NOT NULL,
+	state       TEXT NOT NULL,
+	files       INTEGER NOT NULL,
+	bytes       INTEGER NOT NULL,
+	message     TEXT NOT NULL,
+	error       TEXT NOT NULL,
+	started_at  INTEGER NOT NULL,
+	finished_at INTEGER NOT NULL
+);
+CREATE INDEX jobs_finished ON jobs (finished_at);
+`}
+
+// DefaultRetention is how long finished jobs are kept in the history by
+// default
+const DefaultRetention = 90 * 24 * time.Hour
+
+// DefaultHistoryLimit is the number of jobs returned by History.List if the
+// query has no limit
+const DefaultHistoryLimit = 100
+
+// History stores finished jobs in a SQLite database, so they can be looked
+// up after the manager forgot them or the server restarted. Jobs older than
+// the retention are pruned whenever a job is added.
+type History struct {
+	db        *sql.DB
+	retention time.Duration
+	now       func() time.Time
+}
+
+// Query filters the jobs listed from the history. Zero fields don't filter.
+type Query struct {
+	Type  string
+	User  string
+	State State
+	// Since and Until limit when the jobs finished
+	Since time.Time
+	Until time.Time
+	// Before is the ID of a job, only jobs that finished before it are
+	// listed, to fetch the next page
+	Before string
+	Limit  int
+}
+
+// OpenHistory opens or creates the job history at the given path, keeping
+// jobs for retention, DefaultRetention if zero
+func OpenHistory(path string, retention time.Duration) (*History, error) {
+	db, err := state.Open(path, "jobs", migrations, state.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open job history: %w", err)
+	}
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &History{db: db, retention: retention, now: time.Now}, nil
+}
+
+// Close closes the database
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// Add stores a finished job and prunes the jobs older than the retention
+func (h *History) Add(job Job) error {
+	params, err := json.Marshal(job.Params)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.Exec(`INSERT OR REPLACE INTO jobs (id, type, params, user, state, files, bytes, message, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Type, string(params), job.User, string(job.State), job.Progress.Files, job.Progress.Bytes,
+		job.Progress.Message, job.Error, job.Started.UnixMilli(), job.Finished.UnixMilli())
+	if err != nil {
+		return err
+	}
+	_, err = h.Prune()
+	return err
+}
+
+// Prune deletes the jobs that finished longer ago than the retention and
+// returns how many were deleted
+func (h *History) Prune() (int64, error) {
+	result, err := h.db.Exec(`DELETE FROM jobs WHERE finished_at < ?`, h.now().Add(-h.retention).UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// MarkResumed marks an interrupted job as resumed by another job, so it's
+// only resumed once
+func (h *History) MarkResumed(id, resumedBy string) error {
+	_, err := h.db.Exec(`UPDATE jobs SET state = ?, message = ? WHERE id = ? AND state = ?`,
+		string(Canceled), "Resumed as job "+resumedBy, id, string(Interrupted))
+	return err
+}
+
+// MarkFailed marks an interrupted job as failed with the reason, e.g. if it
+// can't be resumed
+func (h *History) MarkFailed(id, reason string) error {
+	_, err := h.db.Exec(`UPDATE jobs SET state = ?, error = ? WHERE id = ? AND state = ?`,
+		string(Failed), reason, id, string(Interrupted))
+	return err
+}
+
+// Get returns a job by ID, failing with ErrNotFound if it isn't stored
+func (h *History) Get(id string) (Job, error) {
+	jobs, err := h.query(`WHERE id = ?`, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if len(jobs) == 0 {
+		return Job{}, ErrNotFound
+	}
+	return jobs[0], nil
+}
+
+// List returns the jobs matching a query, the most recently finished first
+func (h *History) List(q Query) ([]Job, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	var since, until int64
+	if !q.Since.IsZero() {
+		since = q.Since.UnixMilli()
+	}
+	if !q.Until.IsZero() {
+		until = q.Until.UnixMilli()
+	}
+	return h.query(`WHERE (?1 = '' OR type = ?1) AND (?2 = '' OR user = ?2) AND (?3 = '' OR state = ?3)
+		AND (?4 = 0 OR finished_at >= ?4) AND (?5 = 0 OR finished_at < ?5)
+		AND (?6 = '' OR seq < (SELECT seq FROM jobs WHERE id = ?6))
+		ORDER BY seq DESC LIMIT ?7`,
+		q.Type, q.User, string(q.State), since, until, q.Before, limit)
+}
+
+// query returns the jobs selected by a WHERE clause and what follows it
+func (h *History) query(where string, args ...any) ([]Job, error) {
+	rows, err := h.db.Query(`SELECT id, type, params, user, state, files, bytes, message, error, started_at, finished_at FROM jobs `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var j Job
+		var params string
+		var started, finished int64
+		if err := rows.Scan(&j.ID, &j.Type, &params, &j.User, &j.State, &j.Progress.Files, &j.Progress.Bytes,
+			&j.Progress.Message, &j.Error, &started, &finished); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(params), &j.Params); err != nil {
+			return nil, fmt.Errorf("job %s: invalid params: %w", j.ID, err)
+		}
+		j.Started, j.Finished = time.UnixMilli(started), time.UnixMilli(finished)
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,318 @@
+// Package jobs runs long operations, like exporting a snapshot to another
+// storage, in the background. Clients start a job and poll its progress
+// instead of keeping a request open for hours.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Job types
+const (
+	// Export copies a subtree of a storage to another storage
+	Export = "export"
+
+	// Restore copies nodes from a snapshot back into a storage. Restores
+	// run within their request and are only recorded once done.
+	Restore = "restore"
+)
+
+// State is the state of a job
+type State string
+
+const (
+	Running   State = "running"
+	Succeeded State = "succeeded"
+	Failed    State = "failed"
+	Canceled  State = "canceled"
+	// Interrupted jobs were canceled because the server shut down
+	Interrupted State = "interrupted"
+)
+
+// ErrNotFound is returned for unknown jobs
+var ErrNotFound = errors.New("job not found")
+
+// ErrFinished is returned when canceling a job that already finished
+var ErrFinished = errors.New("job already finished")
+
+// Progress counts the work a job has done so far
+type Progress struct {
+	Files int64
+	Bytes int64
+	// Message describes the current step, or the outcome once finished
+	Message string
+}
+
+// Func runs a job until it's done or ctx is canceled, reporting its
+// progress along the way
+type Func func(ctx context.Context, progress func(Progress)) error
+
+// Job describes a started job
+type Job struct {
+	ID   string
+	Type string
+	// Params describe what the job does, e.g. its source and destination
+	Params map[string]string
+	// User started the job, empty without access control
+	User     string
+	State    State
+	Progress Progress
+	Started  time.Time
+	// Finished is zero while the job is running
+	Finished time.Time
+	// Error is why the job failed
+	Error string
+}
+
+// job is a job with its cancel function
+type job struct {
+	Job
+	cancel context.CancelFunc
+	// done is closed when the job finished
+	done chan struct{}
+}
+
+// DefaultKeep is the number of finished jobs kept by default
+const DefaultKeep = 100
+
+// Manager runs jobs and keeps the most recent finished ones
+type Manager struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+	// order has the IDs of the jobs from oldest to newest
+	order []string
+	keep  int
+	wg    sync.WaitGroup
+	// onFinish is called with each finished job, guarded by mu
+	onFinish func(Job)
+	// interrupted makes canceled jobs finish as interrupted, guarded by mu
+	interrupted bool
+}
+
+// New creates a manager keeping up to keep finished jobs, DefaultKeep if
+// zero
+func New(keep int) *Manager {
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	return &Manager{jobs: map[string]*job{}, keep: keep}
+}
+
+// Start runs fn in the background and returns the started job
+func (m *Manager) Start(typ string, params map[string]string, user string, fn Func) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		Job: Job{
+			ID:      newID(),
+			Type:    typ,
+			Params:  params,
+			User:    user,
+			State:   Running,
+			Started: time.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs[j.ID] = j
+	m.order = append(m.order, j.ID)
+	m.prune()
+	started := j.Job
+	m.mu.Unlock()
+
+	m.wg.Go(func() {
+		defer cancel()
+		err := fn(ctx, func(p Progress) {
+			m.mu.Lock()
+			j.Progress = p
+			m.mu.Unlock()
+		})
+
+		m.mu.Lock()
+		j.Finished = time.Now()
+		switch {
+		case err == nil:
+			j.State = Succeeded
+		case ctx.Err() != nil && m.interrupted:
+			j.State = Interrupted
+		case ctx.Err() != nil:
+			j.State = Canceled
+		default:
+			j.State = Failed
+			j.Error = err.Error()
+		}
+		log.Printf("Job %s (%s) %s after %s", j.ID, j.Type, j.State, j.Finished.Sub(j.Started).Round(time.Millisecond))
+		m.prune()
+		finished, onFinish := j.Job, m.onFinish
+		m.mu.Unlock()
+
+		if onFinish != nil {
+			onFinish(finished)
+		}
+		close(j.done)
+	})
+	return started
+}
+
+// Record adds an operation that already ran, like a restore done within a
+// request, as a finished job. The job failed if err isn't nil.
+func (m *Manager) Record(typ string, params map[string]string, user string, started time.Time, progress Progress, err error) Job {
+	j := &job{
+		Job: Job{
+			ID:       newID(),
+			Type:     typ,
+			Params:   params,
+			User:     user,
+			State:    Succeeded,
+			Progress: progress,
+			Started:  started,
+			Finished: time.Now(),
+		},
+		cancel: func() {},
+		done:   make(chan struct{}),
+	}
+	if err != nil {
+		j.State = Failed
+		j.Error = err.Error()
+	}
+	close(j.done)
+
+	m.mu.Lock()
+	m.jobs[j.ID] = j
+	m.order = append(m.order, j.ID)
+	m.prune()
+	finished, onFinish := j.Job, m.onFinish
+	m.mu.Unlock()
+
+	if onFinish != nil {
+		onFinish(finished)
+	}
+	return finished
+}
+
+// OnFinish sets a function called with each job when it finished, e.g. to
+// notify of failures
+func (m *Manager) OnFinish(fn func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onFinish = fn
+}
+
+// prune forgets the oldest finished jobs beyond the ones to keep. Running
+// jobs are always kept.
+func (m *Manager) prune() {
+	finished := 0
+	for _, id := range m.order {
+		if m.jobs[id].State != Running {
+			finished++
+		}
+	}
+	m.order = slices.DeleteFunc(m.order, func(id string) bool {
+		if finished <= m.keep || m.jobs[id].State == Running {
+			return false
+		}
+		finished--
+		delete(m.jobs, id)
+		return true
+	})
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.Job, true
+}
+
+// Wait waits until a job finished and returns it
+func (m *Manager) Wait(id string) (Job, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	<-j.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return j.Job, nil
+}
+
+// List returns all kept jobs, newest first
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]Job, 0, len(m.order))
+	for _, id := range slices.Backward(m.order) {
+		jobs = append(jobs, m.jobs[id].Job)
+	}
+	return jobs
+}
+
+// Cancel stops a running job. The job finishes as canceled once it notices.
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	switch {
+	case !ok:
+		return ErrNotFound
+	case j.State != Running:
+		return fmt.Errorf("%w: %s", ErrFinished, j.State)
+	}
+	j.cancel()
+	return nil
+}
+
+// Running returns the number of running jobs
+func (m *Manager) Running() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	running := 0
+	for _, j := range m.jobs {
+		if j.State == Running {
+			running++
+		}
+	}
+	return running
+}
+
+// Interrupt cancels all running jobs because the server shuts down and waits
+// for them to finish. They finish as interrupted, so they can be resumed.
+func (m *Manager) Interrupt() {
+	m.mu.Lock()
+	m.interrupted = true
+	m.mu.Unlock()
+	m.Close()
+}
+
+// Close cancels all running jobs and waits for them to finish
+func (m *Manager) Close() {
+	m.mu.Lock()
+	for _, j := range m.jobs {
+		j.cancel()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// newID returns a random job ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
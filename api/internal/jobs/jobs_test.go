@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"timeship/internal/schedule"
+)
+
+// wait waits until a job finished
+func wait(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j, ok := m.Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if j.State != Running {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for job %s", id)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManager(t *testing.T) {
+	m := New(2)
+	defer m.Close()
+
+	t.Run("succeeded", func(t *testing.T) {
+		started := m.Start(Export, map[string]string{"source": "a"}, "alice", func(ctx context.Context, progress func(Progress)) error {
+			progress(Progress{Files: 1, Bytes: 10})
+			return nil
+		})
+		if started.State != Running || started.ID == "" || started.User != "alice" {
+			t.Errorf("unexpected started job %+v", started)
+		}
+		j := wait(t, m, started.ID)
+		if j.State != Succeeded || j.Progress.Files != 1 || j.Progress.Bytes != 10 || j.Finished.IsZero() {
+			t.Errorf("unexpected job %+v", j)
+		}
+		if err := m.Cancel(j.ID); !errors.Is(err, ErrFinished) {
+			t.Errorf("expected ErrFinished, got %v", err)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		finished := make(chan Job, 1)
+		m.OnFinish(func(j Job) { finished <- j })
+		defer m.OnFinish(nil)
+		started := m.Start(Export, nil, "", func(ctx context.Context, progress func(Progress)) error {
+			return errors.New("disk full")
+		})
+		if j := wait(t, m, started.ID); j.State != Failed || j.Error != "disk full" {
+			t.Errorf("unexpected job %+v", j)
+		}
+		if j := <-finished; j.ID != started.ID || j.State != Failed {
+			t.Errorf("unexpected finished job %+v", j)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		started := m.Start(Export, nil, "", func(ctx context.Context, progress func(Progress)) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if err := m.Cancel(started.ID); err != nil {
+			t.Fatalf("Cancel failed: %v", err)
+		}
+		if j := wait(t, m, started.ID); j.State != Canceled {
+			t.Errorf("unexpected job %+v", j)
+		}
+	})
+
+	t.Run("kept jobs", func(t *testing.T) {
+		jobs := m.List()
+		if len(jobs) != 2 || jobs[0].State != Canceled || jobs[1].State != Failed {
+			t.Errorf("expected the 2 newest jobs, got %+v", jobs)
+		}
+		if err := m.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestClose(t *testing.T) {
+	m := New(0)
+	started := m.Start(Export, nil, "", func(ctx context.Context, progress func(Progress)) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	m.Close()
+	if j, _ := m.Get(started.ID); j.State != Canceled {
+		t.Errorf("expected a canceled job, got %+v", j)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	m := New(0)
+	started := m.Start(Export, nil, "", func(ctx context.Context, progress func(Progress)) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if n := m.Running(); n != 1 {
+		t.Errorf("expected 1 running job, got %d", n)
+	}
+	m.Interrupt()
+	if j, _ := m.Get(started.ID); j.State != Interrupted {
+		t.Errorf("expected an interrupted job, got %+v", j)
+	}
+	if n := m.Running(); n != 0 {
+		t.Errorf("expected no running jobs, got %d", n)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	m := New(0)
+	defer m.Close()
+	daily, _ := schedule.Parse("@daily")
+	release := make(chan struct{})
+	s := NewScheduler(m, []Scheduled{{
+		Name:     "nightly",
+		Expr:     "@daily",
+		Schedule: daily,
+		Type:     Export,
+		Func: func(ctx context.Context, progress func(Progress)) error {
+			select {
+			case <-release:
+				progress(Progress{Message: "done"})
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}})
+	defer s.Close()
+
+	status := s.Status()
+	if len(status) != 1 || status[0].Last != nil || !status[0].Next.After(time.Now()) {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	started, err := s.Run("nightly")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := s.Run("nightly"); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected ErrRunning, got %v", err)
+	}
+	if _, err := s.Run("missing"); !errors.Is(err, ErrUnknownSchedule) {
+		t.Errorf("expected ErrUnknownSchedule, got %v", err)
+	}
+	if last := s.Status()[0].Last; last == nil || last.ID != started.ID || last.State != Running {
+		t.Errorf("expected the running job, got %+v", last)
+	}
+
+	close(release)
+	if j, err := m.Wait(started.ID); err != nil || j.State != Succeeded || j.Progress.Message != "done" {
+		t.Fatalf("unexpected job %+v: %v", j, err)
+	}
+	// The scheduler notices the finished job in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := s.Run("nightly"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the job to run again")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	history, err := OpenHistory(filepath.Join(t.TempDir(), "jobs.db"), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer history.Close()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	history.now = func() time.Time { return now }
+
+	m := New(1)
+	m.OnFinish(func(j Job) {
+		if err := history.Add(j); err != nil {
+			t.Errorf("Add failed: %v", err)
+		}
+	})
+	failed := m.Record(Restore, map[string]string{"storage": "local", "path": "a.txt"}, "alice", now, Progress{}, errors.New("access denied"))
+	if failed.State != Failed || failed.Error != "access denied" {
+		t.Errorf("expected failed restore, got %+v", failed)
+	}
+	restored := m.Record(Restore, map[string]string{"storage": "local", "path": "b.txt"}, "bob", now, Progress{Files: 1}, nil)
+	exported := wait(t, m, m.Start(Export, nil, "alice", func(ctx context.Context, progress func(Progress)) error {
+		progress(Progress{Files: 2, Bytes: 10})
+		return nil
+	}).ID)
+
+	t.Run("jobs the manager forgot", func(t *testing.T) {
+		if _, ok := m.Get(failed.ID); ok {
+			t.Fatal("expected the manager to keep only the newest job")
+		}
+		job, err := history.Get(failed.ID)
+		if err != nil || job.Type != Restore || job.State != Failed || job.Params["path"] != "a.txt" || job.User != "alice" {
+			t.Errorf("unexpected job %+v, %v", job, err)
+		}
+		if _, err := history.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		jobs, err := history.List(Query{})
+		if err != nil || len(jobs) != 3 || jobs[0].ID != exported.ID || jobs[0].Progress.Bytes != 10 || jobs[2].ID != failed.ID {
+			t.Errorf("expected all jobs newest first, got %+v, %v", jobs, err)
+		}
+		jobs, _ = history.List(Query{Type: Restore, State: Succeeded})
+		if len(jobs) != 1 || jobs[0].ID != restored.ID {
+			t.Errorf("expected the successful restore, got %+v", jobs)
+		}
+		jobs, _ = history.List(Query{User: "alice", Limit: 1})
+		if len(jobs) != 1 || jobs[0].ID != exported.ID {
+			t.Errorf("expected alice's newest job, got %+v", jobs)
+		}
+		jobs, _ = history.List(Query{User: "alice", Before: exported.ID})
+		if len(jobs) != 1 || jobs[0].ID != failed.ID {
+			t.Errorf("expected the next page, got %+v", jobs)
+		}
+		if jobs, _ := history.List(Query{Since: time.Now().Add(time.Hour)}); len(jobs) != 0 {
+			t.Errorf("expected no jobs finished in the future, got %+v", jobs)
+		}
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		now = time.Now().Add(25 * time.Hour)
+		if n, err := history.Prune(); err != nil || n != 3 {
+			t.Errorf("expected all jobs to be pruned, got %d, %v", n, err)
+		}
+	})
+}
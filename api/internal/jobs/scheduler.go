@@ -0,0 +1,193 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"timeship/internal/schedule"
+)
+
+// ErrUnknownSchedule is returned for schedules that aren't configured
+var ErrUnknownSchedule = errors.New("schedule not found")
+
+// ErrRunning is returned when starting a scheduled job whose last run is
+// still running
+var ErrRunning = errors.New("job still running")
+
+// Scheduled is a job started whenever its schedule matches
+type Scheduled struct {
+	Name string
+	// Expr is the cron expression the schedule was parsed from
+	Expr     string
+	Schedule schedule.Schedule
+	Type     string
+	Params   map[string]string
+	Func     Func
+}
+
+// ScheduleStatus describes a scheduled job and its last run
+type ScheduleStatus struct {
+	Name   string
+	Expr   string
+	Type   string
+	Params map[string]string
+	// Next is when the job starts next, zero if the schedule never matches
+	Next time.Time
+	// Last is the most recent run, nil if the job didn't run yet
+	Last *Job
+}
+
+// entry is a scheduled job with its runs, guarded by Scheduler.mu
+type entry struct {
+	Scheduled
+	next    time.Time
+	last    *Job
+	running bool
+}
+
+// Scheduler starts jobs on a manager whenever their schedules match. Runs of
+// the same job never overlap, a run that is due while the last one is still
+// running is skipped.
+type Scheduler struct {
+	manager *Manager
+
+	mu      sync.Mutex
+	entries []*entry
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewScheduler starts scheduling jobs until the scheduler is closed
+func NewScheduler(m *Manager, scheduled []Scheduled) *Scheduler {
+	s := &Scheduler{manager: m, stop: make(chan struct{})}
+	now := time.Now()
+	for _, sc := range scheduled {
+		e := &entry{Scheduled: sc, next: sc.Schedule.Next(now)}
+		s.entries = append(s.entries, e)
+		s.wg.Go(func() { s.loop(e) })
+	}
+	return s
+}
+
+// loop starts the job of an entry whenever its schedule matches
+func (s *Scheduler) loop(e *entry) {
+	for {
+		s.mu.Lock()
+		next := e.next
+		s.mu.Unlock()
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+
+		if _, err := s.start(e); err != nil {
+			log.Printf("Skipping scheduled job %s: %v", e.Name, err)
+		}
+		s.mu.Lock()
+		e.next = e.Schedule.Next(time.Now())
+		s.mu.Unlock()
+	}
+}
+
+// start starts the job of an entry unless its last run is still running
+func (s *Scheduler) start(e *entry) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stop:
+		return Job{}, errors.New("scheduler closed")
+	default:
+	}
+	if e.running {
+		return Job{}, ErrRunning
+	}
+
+	j := s.manager.Start(e.Type, e.Params, "", e.Func)
+	e.last = &j
+	e.running = true
+	s.wg.Go(func() {
+		finished, err := s.manager.Wait(j.ID)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err == nil {
+			e.last = &finished
+		}
+		e.running = false
+	})
+	return j, nil
+}
+
+// Run starts a scheduled job now, outside of its schedule
+func (s *Scheduler) Run(name string) (Job, error) {
+	for _, e := range s.entries {
+		if e.Name == name {
+			return s.start(e)
+		}
+	}
+	return Job{}, ErrUnknownSchedule
+}
+
+// Status returns the scheduled jobs in the configured order
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := make([]ScheduleStatus, len(s.entries))
+	for i, e := range s.entries {
+		status[i] = ScheduleStatus{
+			Name:   e.Name,
+			Expr:   e.Expr,
+			Type:   e.Type,
+			Params: e.Params,
+			Next:   e.next,
+		}
+		if e.last != nil {
+			last := *e.last
+			// Show the progress of running jobs
+			if j, ok := s.manager.Get(last.ID); ok {
+				last = j
+			}
+			status[i].Last = &last
+		}
+	}
+	return status
+}
+
+// Stop stops scheduling, letting the running scheduled jobs finish
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+}
+
+// stopLocked stops scheduling, s.mu must be held
+func (s *Scheduler) stopLocked() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+// Close stops scheduling, cancels the running scheduled jobs and waits for
+// them to finish
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	s.stopLocked()
+	for _, e := range s.entries {
+		if e.running {
+			s.manager.Cancel(e.last.ID)
+		}
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
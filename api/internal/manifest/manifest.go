@@ -0,0 +1,292 @@
+// Package manifest builds and signs integrity manifests for storage subtrees.
+//
+// A manifest lists every file below a path together with its size and SHA-256
+// checksum. Recipients of restored data can use it to verify that nothing was
+// corrupted in transit or on the serving host.
+//
+// # Signing
+//
+// Manifests can be signed with an Ed25519 key. The signature covers the
+// whole manifest in its canonical encoding (see Manifest.Canonical), so
+// neither the files nor the storage, path, snapshot or creation time can be
+// changed without breaking it. The file list can also be checked with
+// standard tools:
+//
+//	sha256sum -c manifest.sha256
+//
+// The public key is included in the manifest for convenience only. Recipients
+// should verify against a key they obtained out of band.
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// File is a single file entry in a manifest
+type File struct {
+	// Path is relative to the manifest root
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the files below a path with their checksums
+type Manifest struct {
+	Storage  string `json:"storage"`
+	Path     string `json:"path"`
+	Snapshot string `json:"snapshot,omitempty"`
+	Created  int64  `json:"created"`
+	Files    []File `json:"files"`
+
+	// Algorithm is the signature algorithm, empty for unsigned manifests
+	Algorithm string `json:"algorithm,omitempty"`
+	// PublicKey is the base64 encoded public key of the signer
+	PublicKey string `json:"public_key,omitempty"`
+	// Signature is the base64 encoded signature of Canonical()
+	Signature string `json:"signature,omitempty"`
+}
+
+// Build walks the storage below root and builds an unsigned manifest.
+// If root points to a file, the manifest contains only that file.
+// The snapshot query parameter of root is preserved while walking.
+func Build(store storage.Storage, root url.URL) (*Manifest, error) {
+	reader, ok := store.(storage.Reader)
+	if !ok {
+		return nil, errors.New("storage does not support reading")
+	}
+	lister, _ := store.(storage.Lister)
+
+	m := &Manifest{
+		Storage:  root.Scheme,
+		Path:     strings.TrimPrefix(root.Path, "/"),
+		Snapshot: root.Query().Get("snapshot"),
+		Created:  time.Now().Unix(),
+		Files:    []File{},
+	}
+
+	var walk func(u url.URL) error
+	walk = func(u url.URL) error {
+		if lister != nil {
+			nodes, err := lister.ListContents(u)
+			if err == nil {
+				for _, node := range nodes {
+					child := node.Path
+					child.RawQuery = root.RawQuery
+					if node.Type == "dir" {
+						if err := walk(child); err != nil {
+							return err
+						}
+						continue
+					}
+					// Unfollowed links and special files have no content
+					// of their own
+					if node.Type == "link" || node.Type == "special" {
+						continue
+					}
+					if err := m.addFile(reader, child); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		}
+		return m.addFile(reader, u)
+	}
+
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+
+	m.Sort()
+	return m, nil
+}
+
+// addFile hashes a file and adds it to the manifest
+func (m *Manifest) addFile(reader storage.Reader, u url.URL) error {
+	stream, err := reader.ReadStream(u)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", u.Path, err)
+	}
+	defer stream.Close()
+
+	rel := strings.TrimPrefix(u.Path, "/")
+	if rel == m.Path {
+		// The root itself is a file
+		rel = path.Base(rel)
+	} else if m.Path != "" {
+		rel = strings.TrimPrefix(rel, m.Path+"/")
+	}
+
+	if err := m.Add(rel, stream); err != nil {
+		return fmt.Errorf("unable to read %s: %w", u.Path, err)
+	}
+	return nil
+}
+
+// Add hashes the content of a file and adds it to the manifest, with its
+// path relative to the manifest root
+func (m *Manifest) Add(rel string, content io.Reader) error {
+	h := sha256.New()
+	size, err := io.Copy(h, content)
+	if err != nil {
+		return err
+	}
+	m.Files = append(m.Files, File{
+		Path:   rel,
+		Size:   size,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	})
+	return nil
+}
+
+// Sort sorts the files by path, the order of Build
+func (m *Manifest) Sort() {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+}
+
+// Result is the outcome of checking files against a manifest
+type Result struct {
+	// Checked is the number of files found with the size and checksum of
+	// the manifest
+	Checked int
+	// Missing are paths of the manifest without a file
+	Missing []string
+	// Changed are paths whose file has another size or checksum
+	Changed []string
+	// Unexpected are paths of files not in the manifest
+	Unexpected []string
+}
+
+// OK reports whether the files match the manifest exactly
+func (r Result) OK() bool {
+	return len(r.Missing) == 0 && len(r.Changed) == 0 && len(r.Unexpected) == 0
+}
+
+// Check compares files, e.g. the contents of an archive, with the manifest.
+// The paths of the result are sorted.
+func (m *Manifest) Check(files []File) Result {
+	result := Result{Missing: []string{}, Changed: []string{}, Unexpected: []string{}}
+	found := make(map[string]File, len(files))
+	for _, f := range files {
+		found[f.Path] = f
+	}
+	for _, want := range m.Files {
+		got, ok := found[want.Path]
+		delete(found, want.Path)
+		switch {
+		case !ok:
+			result.Missing = append(result.Missing, want.Path)
+		case got.Size != want.Size || got.SHA256 != want.SHA256:
+			result.Changed = append(result.Changed, want.Path)
+		default:
+			result.Checked++
+		}
+	}
+	for p := range found {
+		result.Unexpected = append(result.Unexpected, p)
+	}
+	sort.Strings(result.Missing)
+	sort.Strings(result.Changed)
+	sort.Strings(result.Unexpected)
+	return result
+}
+
+// SHA256Sum returns the file list in sha256sum format, one "<sha256>  <path>" line per file
+func (m *Manifest) SHA256Sum() string {
+	var b strings.Builder
+	for _, f := range m.Files {
+		fmt.Fprintf(&b, "%s  %s\n", f.SHA256, f.Path)
+	}
+	return b.String()
+}
+
+// Canonical returns the encoding of the manifest that is signed: compact
+// JSON without whitespace or HTML escaping, with the keys storage, path,
+// snapshot (if any), created, files, algorithm and public_key in this order,
+// files sorted by path with the keys path, size and sha256, and no signature
+func (m *Manifest) Canonical() []byte {
+	c := *m
+	c.Signature = ""
+	c.Files = slices.Clone(m.Files)
+	if c.Files == nil {
+		c.Files = []File{}
+	}
+	slices.SortFunc(c.Files, func(a, b File) int { return strings.Compare(a.Path, b.Path) })
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	// Manifests only hold strings and numbers, which always encode
+	enc.Encode(c)
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+// Sign signs the manifest with the given Ed25519 private key
+func (m *Manifest) Sign(key ed25519.PrivateKey) {
+	m.Algorithm = "ed25519"
+	m.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, m.Canonical()))
+}
+
+// Verify checks the manifest signature against the given public key
+func (m *Manifest) Verify(key ed25519.PublicKey) error {
+	if m.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm: %q", m.Algorithm)
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(key, m.Canonical(), sig) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// LoadSigningKey reads a PEM encoded PKCS #8 Ed25519 private key, as generated by
+//
+//	openssl genpkey -algorithm ed25519 -out timeship.pem
+func LoadSigningKey(filename string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing key: %w", err)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key must be ed25519, got %T", key)
+	}
+
+	return edKey, nil
+}
@@ -0,0 +1,199 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"timeship/internal/storage/local"
+)
+
+func TestBuild(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs", "sub"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "sub", "b.txt"), []byte("world"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "other.txt"), []byte("other"), 0644)
+
+	store, err := local.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	t.Run("directory", func(t *testing.T) {
+		m, err := Build(store, url.URL{Scheme: "local", Path: "docs"})
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+
+		if len(m.Files) != 2 {
+			t.Fatalf("expected 2 files, got %d", len(m.Files))
+		}
+		if m.Files[0].Path != "a.txt" || m.Files[1].Path != "sub/b.txt" {
+			t.Errorf("unexpected paths: %q, %q", m.Files[0].Path, m.Files[1].Path)
+		}
+		if m.Files[0].SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+			t.Errorf("unexpected checksum: %s", m.Files[0].SHA256)
+		}
+		if m.Files[0].Size != 5 {
+			t.Errorf("expected size 5, got %d", m.Files[0].Size)
+		}
+
+		expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  a.txt\n" +
+			"486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7  sub/b.txt\n"
+		if m.SHA256Sum() != expected {
+			t.Errorf("unexpected sha256sum output:\n%s", m.SHA256Sum())
+		}
+	})
+
+	t.Run("single file", func(t *testing.T) {
+		m, err := Build(store, url.URL{Scheme: "local", Path: "other.txt"})
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		if len(m.Files) != 1 || m.Files[0].Path != "other.txt" {
+			t.Errorf("unexpected files: %+v", m.Files)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := Build(store, url.URL{Scheme: "local", Path: "missing"}); err == nil {
+			t.Error("expected error for missing path")
+		}
+	})
+}
+
+func TestCheck(t *testing.T) {
+	m := &Manifest{}
+	m.Add("a.txt", strings.NewReader("hello"))
+	m.Add("b.txt", strings.NewReader("world"))
+	m.Add("c.txt", strings.NewReader("gone"))
+
+	found := &Manifest{}
+	found.Add("a.txt", strings.NewReader("hello"))
+	found.Add("b.txt", strings.NewReader("World"))
+	found.Add("d.txt", strings.NewReader("new"))
+
+	result := m.Check(found.Files)
+	if result.OK() {
+		t.Error("expected differences")
+	}
+	if result.Checked != 1 || !slices.Equal(result.Missing, []string{"c.txt"}) ||
+		!slices.Equal(result.Changed, []string{"b.txt"}) || !slices.Equal(result.Unexpected, []string{"d.txt"}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if result := m.Check(m.Files); !result.OK() || result.Checked != 3 {
+		t.Errorf("expected all files to match, got %+v", result)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	m := &Manifest{
+		Storage:   "local",
+		Path:      "docs",
+		Created:   1698364800,
+		Files:     []File{{Path: "b<1>.txt", Size: 1, SHA256: "def"}, {Path: "a.txt", Size: 5, SHA256: "abc"}},
+		Algorithm: "ed25519",
+		PublicKey: "key",
+		Signature: "sig",
+	}
+	want := `{"storage":"local","path":"docs","created":1698364800,"files":[{"path":"a.txt","size":5,"sha256":"abc"},{"path":"b<1>.txt","size":1,"sha256":"def"}],"algorithm":"ed25519","public_key":"key"}`
+	if got := string(m.Canonical()); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if m.Files[0].Path != "b<1>.txt" {
+		t.Error("expected the files of the manifest to keep their order")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{
+		Storage:  "local",
+		Path:     "docs",
+		Snapshot: "zfs:daily",
+		Created:  1698364800,
+		Files:    []File{{Path: "a.txt", Size: 5, SHA256: "abc"}},
+	}
+	m.Sign(priv)
+
+	if err := m.Verify(pub); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	m.Files[0].SHA256 = "def"
+	if err := m.Verify(pub); err == nil {
+		t.Error("expected verification to fail after tampering")
+	}
+
+	m.Files[0].SHA256 = "abc"
+	for name, tamper := range map[string]func(*Manifest){
+		"storage":    func(m *Manifest) { m.Storage = "other" },
+		"path":       func(m *Manifest) { m.Path = "other" },
+		"snapshot":   func(m *Manifest) { m.Snapshot = "zfs:other" },
+		"created":    func(m *Manifest) { m.Created++ },
+		"size":       func(m *Manifest) { m.Files[0].Size++ },
+		"public key": func(m *Manifest) { m.PublicKey = "" },
+	} {
+		tampered := *m
+		tampered.Files = slices.Clone(m.Files)
+		tamper(&tampered)
+		if err := tampered.Verify(pub); err == nil {
+			t.Errorf("expected verification to fail after changing the %s", name)
+		}
+	}
+
+	// The order of the files doesn't matter
+	m.Files = append(m.Files, File{Path: "b.txt", Size: 1, SHA256: "123"})
+	m.Sign(priv)
+	m.Files[0], m.Files[1] = m.Files[1], m.Files[0]
+	if err := m.Verify(pub); err != nil {
+		t.Errorf("Verify of reordered files failed: %v", err)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if err := m.Verify(otherPub); err == nil {
+		t.Error("expected verification to fail with other key")
+	}
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+	loaded, err := LoadSigningKey(path)
+	if err != nil {
+		t.Fatalf("LoadSigningKey failed: %v", err)
+	}
+	if !loaded.Equal(priv) {
+		t.Error("loaded key does not match")
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	os.WriteFile(invalid, []byte("not a key"), 0600)
+	if _, err := LoadSigningKey(invalid); err == nil {
+		t.Error("expected error for invalid key")
+	}
+}
@@ -0,0 +1,378 @@
+// Package mdns advertises services on the local network with multicast DNS
+// and DNS Service Discovery (RFC 6762 and RFC 6763), so clients can find
+// them without knowing their address.
+//
+// Only answering and announcing is implemented. Names aren't probed for
+// conflicts, so the instance names should be unique on the network, e.g.
+// by including the host name.
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// group is the IPv4 multicast group of mDNS
+var group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// servicesName lists the service types of the host for service browsers
+const servicesName = "_services._dns-sd._udp.local."
+
+// TTLs recommended by RFC 6762 for records with host names and others
+const (
+	hostTTL  = 120
+	otherTTL = 4500
+)
+
+// cacheFlush marks records of which this host has the only copy
+const cacheFlush = 1 << 15
+
+// Service is a service instance advertised with DNS-SD
+type Service struct {
+	// Instance is the user visible name, e.g. "Timeship on nas"
+	Instance string
+
+	// Type is the service type, e.g. "_http._tcp"
+	Type string
+
+	// Subtypes narrow down the type for browsers, e.g. "_timeship"
+	Subtypes []string
+
+	// Port is the port the service listens on
+	Port uint16
+
+	// TXT are the key=value attributes, e.g. "path=/"
+	TXT []string
+}
+
+// name returns the fully qualified name of the instance
+func (s Service) name() string {
+	// Dots would split the instance into labels and labels are limited
+	// to 63 bytes
+	instance := strings.ReplaceAll(s.Instance, ".", "-")
+	if len(instance) > 63 {
+		instance = instance[:63]
+	}
+	return instance + "." + s.Type + ".local."
+}
+
+// Server answers mDNS queries for services of this host
+type Server struct {
+	host     string
+	addrs    func() []netip.Addr
+	services []Service
+
+	conn   *net.UDPConn
+	pconn  *ipv4.PacketConn
+	ifaces []net.Interface
+	wg     sync.WaitGroup
+}
+
+// Advertise advertises the services of this host on all multicast
+// interfaces until the server is closed
+func Advertise(services ...Service) (*Server, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get host name: %w", err)
+	}
+	s := newServer(host, interfaceAddrs, services)
+
+	// Multicast listeners share the port with other responders, e.g. avahi
+	s.conn, err = net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for mdns: %w", err)
+	}
+	s.pconn = ipv4.NewPacketConn(s.conn)
+	s.pconn.SetControlMessage(ipv4.FlagInterface, true)
+	s.pconn.SetMulticastTTL(255)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		s.conn.Close()
+		return nil, fmt.Errorf("unable to list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		// Joining fails for interfaces joined already or without IPv4
+		if err := s.pconn.JoinGroup(&iface, group); err == nil || errors.Is(err, syscall.EADDRINUSE) {
+			s.ifaces = append(s.ifaces, iface)
+		}
+	}
+	if len(s.ifaces) == 0 {
+		s.conn.Close()
+		return nil, errors.New("no multicast interfaces")
+	}
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		s.serve()
+	}()
+	go func() {
+		defer s.wg.Done()
+		// Announce twice, a second apart, as packets may be lost
+		for range 2 {
+			if err := s.announce(false); err != nil {
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+	return s, nil
+}
+
+// newServer returns a server of services on host with the addresses
+// returned by addrs
+func newServer(host string, addrs func() []netip.Addr, services []Service) *Server {
+	host, _, _ = strings.Cut(host, ".")
+	return &Server{
+		host:     host + ".local.",
+		addrs:    addrs,
+		services: services,
+	}
+}
+
+// Close says goodbye, so browsers forget the services, and stops answering
+func (s *Server) Close() error {
+	s.announce(true)
+	err := s.conn.Close()
+	s.wg.Wait()
+	return err
+}
+
+// serve answers queries until the connection is closed
+func (s *Server) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, cm, src, err := s.pconn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("mDNS: failed to read: %v", err)
+			}
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		resp, ok := s.answer(query)
+		if !ok {
+			continue
+		}
+
+		// Queries from other ports than 5353 are one-shot queries of
+		// regular resolvers, which expect a regular unicast response
+		var dst net.Addr = group
+		if addr, ok := src.(*net.UDPAddr); ok && addr.Port != group.Port {
+			dst = addr
+			resp.ID = query.ID
+			resp.Questions = query.Questions
+		}
+		packet, err := resp.Pack()
+		if err != nil {
+			log.Printf("mDNS: failed to pack response: %v", err)
+			continue
+		}
+		var wcm *ipv4.ControlMessage
+		if cm != nil {
+			wcm = &ipv4.ControlMessage{IfIndex: cm.IfIndex}
+		}
+		s.pconn.WriteTo(packet, wcm, dst)
+	}
+}
+
+// announce sends all records unsolicited on all interfaces. Saying goodbye
+// sends the pointers to the instances with a zero TTL, leaving the
+// addresses of the host, which other responders may share.
+func (s *Server) announce(goodbye bool) error {
+	resp := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	for _, svc := range s.services {
+		if goodbye {
+			resp.Answers = append(resp.Answers, s.pointers(svc, 0)...)
+			continue
+		}
+		resp.Answers = append(resp.Answers, s.pointers(svc, otherTTL)...)
+		resp.Answers = append(resp.Answers, s.instance(svc, hostTTL, otherTTL)...)
+	}
+	if !goodbye {
+		resp.Answers = append(resp.Answers, s.addresses(hostTTL)...)
+	}
+	packet, err := resp.Pack()
+	if err != nil {
+		return err
+	}
+	for _, iface := range s.ifaces {
+		if _, err := s.pconn.WriteTo(packet, &ipv4.ControlMessage{IfIndex: iface.Index}, group); errors.Is(err, net.ErrClosed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// answer returns the response to a query, false if there's nothing to
+// answer
+func (s *Server) answer(query dnsmessage.Message) (dnsmessage.Message, bool) {
+	resp := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	if query.Response {
+		return resp, false
+	}
+	additionals := map[string]bool{}
+	for _, q := range query.Questions {
+		name := q.Name.String()
+		all := q.Type == dnsmessage.TypeALL
+		for _, svc := range s.services {
+			if (all || q.Type == dnsmessage.TypePTR) && s.isPointerName(svc, name) {
+				resp.Answers = append(resp.Answers, s.pointer(name, svc.name(), otherTTL))
+				additionals[svc.name()] = true
+			}
+			if strings.EqualFold(name, svc.name()) {
+				for _, r := range s.instance(svc, hostTTL, otherTTL) {
+					if all || q.Type == r.Header.Type {
+						resp.Answers = append(resp.Answers, r)
+					}
+				}
+				additionals[s.host] = true
+			}
+		}
+		if (all || q.Type == dnsmessage.TypePTR) && strings.EqualFold(name, servicesName) {
+			types := map[string]bool{}
+			for _, svc := range s.services {
+				if typ := svc.Type + ".local."; !types[typ] {
+					types[typ] = true
+					resp.Answers = append(resp.Answers, s.pointer(servicesName, typ, otherTTL))
+				}
+			}
+		}
+		if strings.EqualFold(name, s.host) {
+			for _, r := range s.addresses(hostTTL) {
+				if all || q.Type == r.Header.Type {
+					resp.Answers = append(resp.Answers, r)
+				}
+			}
+		}
+	}
+	if len(resp.Answers) == 0 {
+		return resp, false
+	}
+
+	// Save browsers asking for the instance and its addresses separately
+	for _, svc := range s.services {
+		if additionals[svc.name()] {
+			resp.Additionals = append(resp.Additionals, s.instance(svc, hostTTL, otherTTL)...)
+			additionals[s.host] = true
+		}
+	}
+	if additionals[s.host] {
+		resp.Additionals = append(resp.Additionals, s.addresses(hostTTL)...)
+	}
+	return resp, true
+}
+
+// isPointerName reports whether name lists instances of the service, by its
+// type or one of its subtypes
+func (s *Server) isPointerName(svc Service, name string) bool {
+	if strings.EqualFold(name, svc.Type+".local.") {
+		return true
+	}
+	for _, sub := range svc.Subtypes {
+		if strings.EqualFold(name, sub+"._sub."+svc.Type+".local.") {
+			return true
+		}
+	}
+	return false
+}
+
+// pointers returns the records pointing to the instance of svc
+func (s *Server) pointers(svc Service, ttl uint32) []dnsmessage.Resource {
+	rs := []dnsmessage.Resource{
+		s.pointer(servicesName, svc.Type+".local.", ttl),
+		s.pointer(svc.Type+".local.", svc.name(), ttl),
+	}
+	for _, sub := range svc.Subtypes {
+		rs = append(rs, s.pointer(sub+"._sub."+svc.Type+".local.", svc.name(), ttl))
+	}
+	return rs
+}
+
+// pointer returns a shared PTR record from name to target
+func (s *Server) pointer(name, target string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: mustName(name), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: mustName(target)},
+	}
+}
+
+// instance returns the SRV and TXT records of the instance of svc
+func (s *Server) instance(svc Service, hostTTL, otherTTL uint32) []dnsmessage.Resource {
+	name := mustName(svc.name())
+	txt := svc.TXT
+	if len(txt) == 0 {
+		// TXT records must not be empty
+		txt = []string{""}
+	}
+	return []dnsmessage.Resource{
+		{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET | cacheFlush, TTL: hostTTL},
+			Body:   &dnsmessage.SRVResource{Port: svc.Port, Target: mustName(s.host)},
+		},
+		{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET | cacheFlush, TTL: otherTTL},
+			Body:   &dnsmessage.TXTResource{TXT: txt},
+		},
+	}
+}
+
+// addresses returns the A and AAAA records of the host
+func (s *Server) addresses(ttl uint32) []dnsmessage.Resource {
+	var rs []dnsmessage.Resource
+	header := dnsmessage.ResourceHeader{Name: mustName(s.host), Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl}
+	for _, addr := range s.addrs() {
+		if addr.Is4() {
+			header.Type = dnsmessage.TypeA
+			rs = append(rs, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: addr.As4()}})
+		} else {
+			header.Type = dnsmessage.TypeAAAA
+			rs = append(rs, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+	return rs
+}
+
+// interfaceAddrs returns the addresses of this host other than loopback
+func interfaceAddrs() []netip.Addr {
+	var addrs []netip.Addr
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range ifaceAddrs {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil || prefix.Addr().IsLoopback() {
+			continue
+		}
+		addrs = append(addrs, prefix.Addr().Unmap())
+	}
+	return addrs
+}
+
+// mustName converts a valid name
+func mustName(name string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		// Names are short enough, as instances are truncated to a label
+		panic(err)
+	}
+	return n
+}
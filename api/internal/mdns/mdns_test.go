@@ -0,0 +1,105 @@
+package mdns
+
+import (
+	"net/netip"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func newTestServer() *Server {
+	addrs := func() []netip.Addr {
+		return []netip.Addr{netip.MustParseAddr("192.168.1.7"), netip.MustParseAddr("fd00::7")}
+	}
+	return newServer("nas.example.com", addrs, []Service{{
+		Instance: "Timeship on nas",
+		Type:     "_http._tcp",
+		Subtypes: []string{"_timeship"},
+		Port:     8080,
+		TXT:      []string{"path=/"},
+	}})
+}
+
+// ask returns the packed and unpacked response to a question
+func ask(t *testing.T, s *Server, name string, typ dnsmessage.Type) (dnsmessage.Message, bool) {
+	t.Helper()
+	query := dnsmessage.Message{Questions: []dnsmessage.Question{{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  typ,
+		Class: dnsmessage.ClassINET,
+	}}}
+	resp, ok := s.answer(query)
+	if !ok {
+		return resp, false
+	}
+	packet, err := resp.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack response: %v", err)
+	}
+	var unpacked dnsmessage.Message
+	if err := unpacked.Unpack(packet); err != nil {
+		t.Fatalf("failed to unpack response: %v", err)
+	}
+	return unpacked, true
+}
+
+func TestAnswerBrowse(t *testing.T) {
+	s := newTestServer()
+	for _, name := range []string{"_http._tcp.local.", "_timeship._sub._http._tcp.local.", "_TIMESHIP._sub._http._tcp.local."} {
+		resp, ok := ask(t, s, name, dnsmessage.TypePTR)
+		if !ok || len(resp.Answers) != 1 {
+			t.Fatalf("expected a pointer for %s, got %+v", name, resp.Answers)
+		}
+		ptr, ok := resp.Answers[0].Body.(*dnsmessage.PTRResource)
+		if !ok || ptr.PTR.String() != "Timeship on nas._http._tcp.local." {
+			t.Errorf("unexpected pointer %+v", resp.Answers[0])
+		}
+
+		// The instance and its addresses come along
+		var port uint16
+		var addrs int
+		for _, r := range resp.Additionals {
+			switch body := r.Body.(type) {
+			case *dnsmessage.SRVResource:
+				port = body.Port
+				if body.Target.String() != "nas.local." {
+					t.Errorf("expected target nas.local., got %s", body.Target)
+				}
+			case *dnsmessage.AResource, *dnsmessage.AAAAResource:
+				addrs++
+			}
+		}
+		if port != 8080 || addrs != 2 {
+			t.Errorf("expected port 8080 and 2 addresses, got %d and %d", port, addrs)
+		}
+	}
+}
+
+func TestAnswerRecords(t *testing.T) {
+	s := newTestServer()
+
+	resp, ok := ask(t, s, "Timeship on nas._http._tcp.local.", dnsmessage.TypeTXT)
+	if !ok || len(resp.Answers) != 1 {
+		t.Fatalf("expected a TXT record, got %+v", resp.Answers)
+	}
+	if txt := resp.Answers[0].Body.(*dnsmessage.TXTResource); len(txt.TXT) != 1 || txt.TXT[0] != "path=/" {
+		t.Errorf("unexpected TXT record %+v", txt)
+	}
+
+	resp, ok = ask(t, s, "nas.local.", dnsmessage.TypeA)
+	if !ok || len(resp.Answers) != 1 || resp.Answers[0].Body.(*dnsmessage.AResource).A != [4]byte{192, 168, 1, 7} {
+		t.Errorf("expected the IPv4 address, got %+v", resp.Answers)
+	}
+
+	resp, ok = ask(t, s, "_services._dns-sd._udp.local.", dnsmessage.TypePTR)
+	if !ok || len(resp.Answers) != 1 || resp.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String() != "_http._tcp.local." {
+		t.Errorf("expected the service type, got %+v", resp.Answers)
+	}
+
+	if _, ok := ask(t, s, "_ipp._tcp.local.", dnsmessage.TypePTR); ok {
+		t.Error("expected no answer for other services")
+	}
+	if _, ok := s.answer(dnsmessage.Message{Header: dnsmessage.Header{Response: true}}); ok {
+		t.Error("expected no answer to responses")
+	}
+}
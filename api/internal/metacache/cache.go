@@ -0,0 +1,236 @@
+// Package metacache caches the file metadata of snapshots in SQLite.
+//
+// Snapshots are immutable, so once a snapshot tree has been walked its
+// metadata never goes stale. Questions like "which snapshots contain this
+// file and how big was it in each" can then be answered with a single query
+// instead of one filesystem walk per snapshot.
+package metacache
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	statedb "timeship/internal/state"
+	"timeship/internal/storage"
+)
+
+// migrations create the cache tables. Nodes are keyed by path first, so the
+// history of a path is a single range scan.
+var migrations = []string{`
+CREATE TABLE IF NOT EXISTS snapshots (
+	storage    TEXT NOT NULL,
+	snapshot   TEXT NOT NULL,
+	timestamp  INTEGER NOT NULL,
+	indexed_at INTEGER NOT NULL,
+	nodes      INTEGER NOT NULL,
+	PRIMARY KEY (storage, snapshot)
+);
+CREATE TABLE IF NOT EXISTS nodes (
+	storage  TEXT NOT NULL,
+	snapshot TEXT NOT NULL,
+	path     TEXT NOT NULL,
+	parent   TEXT NOT NULL,
+	type     TEXT NOT NULL,
+	size     INTEGER NOT NULL,
+	mtime    INTEGER NOT NULL,
+	hash     TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (storage, path, snapshot)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS nodes_parent ON nodes (storage, parent, snapshot);
+CREATE INDEX IF NOT EXISTS nodes_snapshot ON nodes (storage, snapshot);
+`}
+
+// Entry is the metadata of a node in a snapshot
+type Entry struct {
+	// Snapshot is the ID of the snapshot containing the node
+	Snapshot string
+
+	// Path is the path of the node relative to the storage root, without a
+	// leading slash
+	Path string
+
+	// Type is "file", "dir" or "link"
+	Type string
+
+	Size         int64
+	LastModified int64
+
+	// Hash is the hex encoded SHA-256 of the content of a file, empty if
+	// hashing is disabled
+	Hash string
+}
+
+// SnapshotInfo describes an indexed snapshot
+type SnapshotInfo struct {
+	Snapshot  string
+	Timestamp int64
+	IndexedAt int64
+	Nodes     int64
+}
+
+// Cache stores snapshot metadata in a SQLite database
+type Cache struct {
+	db *sql.DB
+}
+
+// Open opens or creates the cache database at the given path
+func Open(path string) (*Cache, error) {
+	db, err := statedb.Open(path, "metacache", migrations, statedb.Options{Synchronous: "NORMAL"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open metadata cache: %w", err)
+	}
+	return &Cache{db: db}, nil
+}
+
+// Close closes the database
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// Add replaces the metadata of a snapshot. walk is called once and reports
+// every node of the snapshot through add. Nothing is stored if walk fails.
+func (c *Cache) Add(storageName string, snap storage.Snapshot, walk func(add func(Entry) error) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM nodes WHERE storage = ? AND snapshot = ?`, storageName, snap.ID); err != nil {
+		return err
+	}
+
+	insert, err := tx.Prepare(`INSERT OR REPLACE INTO nodes (storage, snapshot, path, parent, type, size, mtime, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	var count int64
+	err = walk(func(e Entry) error {
+		count++
+		_, err := insert.Exec(storageName, snap.ID, e.Path, parentPath(e.Path), e.Type, e.Size, e.LastModified, e.Hash)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO snapshots (storage, snapshot, timestamp, indexed_at, nodes) VALUES (?, ?, ?, ?, ?)`,
+		storageName, snap.ID, snap.Timestamp, time.Now().Unix(), count)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Snapshots returns the indexed snapshots of a storage keyed by ID
+func (c *Cache) Snapshots(storageName string) (map[string]SnapshotInfo, error) {
+	rows, err := c.db.Query(`SELECT snapshot, timestamp, indexed_at, nodes FROM snapshots WHERE storage = ?`, storageName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := map[string]SnapshotInfo{}
+	for rows.Next() {
+		var info SnapshotInfo
+		if err := rows.Scan(&info.Snapshot, &info.Timestamp, &info.IndexedAt, &info.Nodes); err != nil {
+			return nil, err
+		}
+		snapshots[info.Snapshot] = info
+	}
+	return snapshots, rows.Err()
+}
+
+// History returns the metadata of a path in each indexed snapshot that
+// contains it, keyed by snapshot ID
+func (c *Cache) History(storageName string, path string) (map[string]Entry, error) {
+	rows, err := c.db.Query(`SELECT snapshot, path, type, size, mtime, hash FROM nodes WHERE storage = ? AND path = ?`, storageName, path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		history[e.Snapshot] = e
+	}
+	return history, nil
+}
+
+// Children returns the children of a directory in all indexed snapshots
+func (c *Cache) Children(storageName string, dir string) ([]Entry, error) {
+	rows, err := c.db.Query(`SELECT snapshot, path, type, size, mtime, hash FROM nodes WHERE storage = ? AND parent = ?`, storageName, dir)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+// Remove deletes the metadata of a snapshot, e.g. after it was destroyed
+func (c *Cache) Remove(storageName string, snapshotID string) error {
+	return c.exec(
+		[]string{
+			`DELETE FROM nodes WHERE storage = ? AND snapshot = ?`,
+			`DELETE FROM snapshots WHERE storage = ? AND snapshot = ?`,
+		},
+		storageName, snapshotID,
+	)
+}
+
+// Drop deletes all metadata of a storage
+func (c *Cache) Drop(storageName string) error {
+	return c.exec(
+		[]string{
+			`DELETE FROM nodes WHERE storage = ?`,
+			`DELETE FROM snapshots WHERE storage = ?`,
+		},
+		storageName,
+	)
+}
+
+// exec runs statements with the same arguments in a transaction
+func (c *Cache) exec(statements []string, args ...any) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// scanEntries reads and closes rows of snapshot, path, type, size, mtime and
+// hash columns
+func scanEntries(rows *sql.Rows) ([]Entry, error) {
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.Snapshot, &e.Path, &e.Type, &e.Size, &e.LastModified, &e.Hash); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// parentPath returns the parent of a relative path, "" for top-level nodes
+func parentPath(p string) string {
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
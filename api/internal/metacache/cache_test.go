@@ -0,0 +1,288 @@
+package metacache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"timeship/internal/schedule"
+	"timeship/internal/storage"
+	"timeship/internal/storage/local"
+)
+
+func openTestCache(t *testing.T) *Cache {
+	t.Helper()
+	cache, err := Open(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+// addEntries indexes a snapshot with the given entries
+func addEntries(t *testing.T, cache *Cache, snap storage.Snapshot, entries ...Entry) {
+	t.Helper()
+	err := cache.Add("local", snap, func(add func(Entry) error) error {
+		for _, e := range entries {
+			if err := add(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := openTestCache(t)
+
+	addEntries(t, cache, storage.Snapshot{ID: "zfs:a", Timestamp: 100},
+		Entry{Path: "docs", Type: "dir"},
+		Entry{Path: "docs/report.txt", Type: "file", Size: 10, LastModified: 90},
+		Entry{Path: "notes.txt", Type: "file", Size: 5},
+	)
+	addEntries(t, cache, storage.Snapshot{ID: "zfs:b", Timestamp: 200},
+		Entry{Path: "docs", Type: "dir"},
+		Entry{Path: "docs/report.txt", Type: "file", Size: 20, LastModified: 190, Hash: "abc"},
+	)
+
+	t.Run("snapshots", func(t *testing.T) {
+		snapshots, err := cache.Snapshots("local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots) != 2 {
+			t.Fatalf("expected 2 snapshots, got %v", snapshots)
+		}
+		if info := snapshots["zfs:a"]; info.Timestamp != 100 || info.Nodes != 3 || info.IndexedAt == 0 {
+			t.Errorf("unexpected snapshot info %+v", info)
+		}
+	})
+
+	t.Run("history", func(t *testing.T) {
+		history, err := cache.History("local", "docs/report.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 2 {
+			t.Fatalf("expected 2 entries, got %v", history)
+		}
+		if e := history["zfs:b"]; e.Size != 20 || e.LastModified != 190 || e.Hash != "abc" {
+			t.Errorf("unexpected entry %+v", e)
+		}
+	})
+
+	t.Run("children", func(t *testing.T) {
+		children, err := cache.Children("local", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, e := range children {
+			paths = append(paths, e.Snapshot+" "+e.Path)
+		}
+		slices.Sort(paths)
+		expected := []string{"zfs:a docs", "zfs:a notes.txt", "zfs:b docs"}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("reindex replaces nodes", func(t *testing.T) {
+		addEntries(t, cache, storage.Snapshot{ID: "zfs:a", Timestamp: 100},
+			Entry{Path: "notes.txt", Type: "file", Size: 6},
+		)
+		history, _ := cache.History("local", "docs/report.txt")
+		if _, ok := history["zfs:a"]; ok {
+			t.Error("expected stale node to be removed")
+		}
+	})
+
+	t.Run("failed walk stores nothing", func(t *testing.T) {
+		err := cache.Add("local", storage.Snapshot{ID: "zfs:c"}, func(add func(Entry) error) error {
+			add(Entry{Path: "partial", Type: "file"})
+			return os.ErrPermission
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		snapshots, _ := cache.Snapshots("local")
+		if _, ok := snapshots["zfs:c"]; ok {
+			t.Error("expected failed snapshot not to be indexed")
+		}
+	})
+
+	t.Run("remove and drop", func(t *testing.T) {
+		if err := cache.Remove("local", "zfs:b"); err != nil {
+			t.Fatal(err)
+		}
+		history, _ := cache.History("local", "docs/report.txt")
+		if len(history) != 0 {
+			t.Errorf("expected no history after remove, got %v", history)
+		}
+
+		if err := cache.Drop("local"); err != nil {
+			t.Fatal(err)
+		}
+		snapshots, _ := cache.Snapshots("local")
+		if len(snapshots) != 0 {
+			t.Errorf("expected no snapshots after drop, got %v", snapshots)
+		}
+	})
+}
+
+// waitForIndexer waits until no snapshots are pending
+func waitForIndexer(t *testing.T, indexer *Indexer) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for indexer.Pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for indexer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newSnapshotStorage creates a local storage with a file in a snapshot
+func newSnapshotStorage(t *testing.T) *local.Storage {
+	t.Helper()
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "live.txt"), []byte("live"), 0644)
+	snapDir := filepath.Join(root, ".zfs", "snapshot", "daily-2025-11-09")
+	os.MkdirAll(filepath.Join(snapDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(snapDir, "docs", "report.txt"), []byte("hello"), 0644)
+
+	store, err := local.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestIndexer(t *testing.T) {
+	store := newSnapshotStorage(t)
+
+	cache := openTestCache(t)
+	cache.Add("local", storage.Snapshot{ID: "zfs:gone"}, func(add func(Entry) error) error { return nil })
+
+	indexed := make(chan string, 10)
+	indexer := NewIndexer(cache, Config{
+		Hash: true,
+		OnIndexed: func(storageName string, snapshot storage.Snapshot, err error) {
+			if err != nil {
+				t.Errorf("expected snapshot to be indexed, got %v", err)
+			}
+			indexed <- storageName + " " + snapshot.ID
+		},
+	})
+	defer indexer.Close()
+
+	if err := indexer.EnqueueAll("local", store); err != nil {
+		t.Fatalf("EnqueueAll failed: %v", err)
+	}
+
+	waitForIndexer(t, indexer)
+	select {
+	case got := <-indexed:
+		if got != "local zfs:daily-2025-11-09" {
+			t.Errorf("expected OnIndexed for the snapshot, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected OnIndexed to be called")
+	}
+
+	snapshots, err := cache.Snapshots("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := snapshots["zfs:gone"]; ok {
+		t.Error("expected vanished snapshot to be removed")
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 indexed snapshot, got %v", snapshots)
+	}
+
+	history, err := cache.History("local", "docs/report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("expected report in 1 snapshot, got %v", history)
+	}
+	for _, e := range history {
+		// SHA-256 of "hello"
+		if e.Size != 5 || e.Hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+			t.Errorf("unexpected entry %+v", e)
+		}
+	}
+
+	live, _ := cache.History("local", "live.txt")
+	if len(live) != 0 {
+		t.Errorf("expected live files not to be indexed, got %v", live)
+	}
+}
+
+func TestIndexerManagement(t *testing.T) {
+	store := newSnapshotStorage(t)
+	indexer := NewIndexer(openTestCache(t), Config{})
+	defer indexer.Close()
+
+	status := func() Status {
+		t.Helper()
+		st, err := indexer.Status("local")
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		return st
+	}
+
+	t.Run("paused", func(t *testing.T) {
+		indexer.Pause("local")
+		if err := indexer.EnqueueAll("local", store); err != nil {
+			t.Fatal(err)
+		}
+		// Give the worker a chance to pick up the snapshot
+		time.Sleep(50 * time.Millisecond)
+
+		st := status()
+		if !st.Paused || st.Queued != 1 || st.Current != "" || st.Indexed != 0 {
+			t.Errorf("unexpected status %+v", st)
+		}
+	})
+
+	t.Run("resumed", func(t *testing.T) {
+		indexer.Resume("local")
+		waitForIndexer(t, indexer)
+
+		st := status()
+		if st.Paused || st.Queued != 0 || st.Indexed != 1 || st.Nodes != 2 || st.LastIndexed == 0 {
+			t.Errorf("unexpected status %+v", st)
+		}
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		if err := indexer.Drop("local"); err != nil {
+			t.Fatal(err)
+		}
+		if st := status(); st.Indexed != 0 || st.Nodes != 0 {
+			t.Errorf("unexpected status %+v", st)
+		}
+	})
+
+	t.Run("scheduled", func(t *testing.T) {
+		if indexer.Scheduled() {
+			t.Fatal("expected no schedule")
+		}
+		sched, _ := schedule.Parse("@daily")
+		indexer.Schedule(sched, map[string]storage.Storage{"local": store})
+		if !indexer.Scheduled() || status().NextRun <= time.Now().Unix() {
+			t.Errorf("expected next run to be scheduled, got %+v", status())
+		}
+	})
+}
@@ -0,0 +1,537 @@
+package metacache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"timeship/internal/schedule"
+	"timeship/internal/storage"
+)
+
+// Config configures an Indexer
+type Config struct {
+	// Hash records the SHA-256 of each file, which reads all file contents
+	// of every snapshot
+	Hash bool
+
+	// OnIndexed is called when indexing a snapshot finished, with the error
+	// if it failed. It's not called for abandoned snapshots.
+	OnIndexed func(storageName string, snapshot storage.Snapshot, err error)
+}
+
+// job indexes one snapshot of a storage
+type job struct {
+	storage  string
+	store    storage.Storage
+	snapshot storage.Snapshot
+}
+
+// state tracks the indexing of a storage
+type state struct {
+	paused bool
+
+	// generation is increased when the index of the storage is dropped, so
+	// the snapshot being indexed is abandoned
+	generation int
+
+	queued      map[string]bool // keyed by snapshot ID
+	current     string
+	lastIndexed int64
+	lastError   string
+}
+
+// Status describes the indexing of a storage
+type Status struct {
+	Paused bool
+
+	// Queued is the number of snapshots waiting to be indexed
+	Queued int
+
+	// Current is the ID of the snapshot being indexed, empty if idle
+	Current string
+
+	// Indexed and Nodes count the indexed snapshots and their nodes
+	Indexed int
+	Nodes   int64
+
+	// LastIndexed is the Unix time the last snapshot was indexed, zero if
+	// none was indexed since startup
+	LastIndexed int64
+
+	// LastError is the error of the last failed snapshot, empty if the last
+	// snapshot was indexed successfully
+	LastError string
+
+	// NextRun is the Unix time of the next scheduled run, zero if indexing
+	// is not scheduled
+	NextRun int64
+}
+
+// Indexer walks snapshots into a Cache in the background, one at a time
+type Indexer struct {
+	cache  *Cache
+	config Config
+
+	mu     sync.Mutex
+	queue  []job
+	states map[string]*state // keyed by storage name
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+
+	// nextRun is the next scheduled run, zero if not scheduled
+	nextRun time.Time
+
+	// scheduled are the storages indexed on schedule
+	scheduled map[string]storage.Storage
+
+	// working is held while a snapshot is indexed
+	working sync.Mutex
+}
+
+var (
+	// errClosed aborts indexing when the indexer is closed
+	errClosed = errors.New("indexer closed")
+
+	// errPaused aborts indexing when the storage is paused
+	errPaused = errors.New("indexing paused")
+
+	// errDropped aborts indexing when the index of the storage is dropped
+	errDropped = errors.New("index dropped")
+)
+
+// NewIndexer creates an indexer writing to the cache and starts its worker
+func NewIndexer(cache *Cache, config Config) *Indexer {
+	ix := &Indexer{
+		cache:  cache,
+		config: config,
+		states: map[string]*state{},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go ix.run()
+	return ix
+}
+
+// Cache returns the cache the indexer writes to
+func (ix *Indexer) Cache() *Cache {
+	return ix.cache
+}
+
+// Close stops the worker, abandoning the snapshot being indexed
+func (ix *Indexer) Close() error {
+	close(ix.stop)
+	<-ix.done
+	return nil
+}
+
+// state returns the state of a storage, ix.mu must be held
+func (ix *Indexer) state(storageName string) *state {
+	st, ok := ix.states[storageName]
+	if !ok {
+		st = &state{queued: map[string]bool{}}
+		ix.states[storageName] = st
+	}
+	return st
+}
+
+// notify wakes up the worker
+func (ix *Indexer) notify() {
+	select {
+	case ix.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue schedules indexing of a snapshot unless it is already queued.
+// The storage must implement storage.Lister.
+func (ix *Indexer) Enqueue(storageName string, store storage.Storage, snap storage.Snapshot) {
+	ix.mu.Lock()
+	st := ix.state(storageName)
+	if st.queued[snap.ID] {
+		ix.mu.Unlock()
+		return
+	}
+	st.queued[snap.ID] = true
+	ix.queue = append(ix.queue, job{storage: storageName, store: store, snapshot: snap})
+	ix.mu.Unlock()
+
+	ix.notify()
+}
+
+// EnqueueAll schedules indexing of all snapshots of a storage that are not
+// indexed yet and forgets snapshots that no longer exist
+func (ix *Indexer) EnqueueAll(storageName string, store storage.Storage) error {
+	lister, ok := store.(storage.SnapshotLister)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	snapshots, err := lister.ListSnapshots(url.URL{Scheme: storageName})
+	if err != nil {
+		return err
+	}
+	indexed, err := ix.cache.Snapshots(storageName)
+	if err != nil {
+		return err
+	}
+
+	exists := map[string]bool{}
+	for _, snap := range snapshots {
+		exists[snap.ID] = true
+		if _, ok := indexed[snap.ID]; !ok {
+			ix.Enqueue(storageName, store, snap)
+		}
+	}
+	for id := range indexed {
+		if !exists[id] {
+			if err := ix.cache.Remove(storageName, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of snapshots waiting to be indexed, including
+// the one being indexed
+func (ix *Indexer) Pending() int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	n := 0
+	for _, st := range ix.states {
+		n += len(st.queued)
+	}
+	return n
+}
+
+// Pause stops indexing snapshots of a storage until it is resumed. The
+// snapshot being indexed is abandoned and indexed again on resume.
+func (ix *Indexer) Pause(storageName string) {
+	ix.mu.Lock()
+	ix.state(storageName).paused = true
+	ix.mu.Unlock()
+}
+
+// Resume continues indexing snapshots of a paused storage
+func (ix *Indexer) Resume(storageName string) {
+	ix.mu.Lock()
+	ix.state(storageName).paused = false
+	ix.mu.Unlock()
+
+	ix.notify()
+}
+
+// Drop cancels indexing of a storage and deletes its cached metadata
+func (ix *Indexer) Drop(storageName string) error {
+	ix.mu.Lock()
+	st := ix.state(storageName)
+	st.generation++
+	clear(st.queued)
+	st.lastError = ""
+	ix.queue = slices.DeleteFunc(ix.queue, func(j job) bool {
+		return j.storage == storageName
+	})
+	ix.mu.Unlock()
+
+	// Wait for the snapshot being indexed to be abandoned, so it isn't
+	// stored after dropping
+	ix.working.Lock()
+	defer ix.working.Unlock()
+	return ix.cache.Drop(storageName)
+}
+
+// Status returns the indexing status of a storage
+func (ix *Indexer) Status(storageName string) (Status, error) {
+	snapshots, err := ix.cache.Snapshots(storageName)
+	if err != nil {
+		return Status{}, err
+	}
+
+	ix.mu.Lock()
+	st := ix.state(storageName)
+	status := Status{
+		Paused:      st.paused,
+		Queued:      len(st.queued),
+		Current:     st.current,
+		Indexed:     len(snapshots),
+		LastIndexed: st.lastIndexed,
+		LastError:   st.lastError,
+	}
+	if !ix.nextRun.IsZero() {
+		status.NextRun = ix.nextRun.Unix()
+	}
+	ix.mu.Unlock()
+
+	if status.Current != "" {
+		// The snapshot being indexed is not waiting anymore
+		status.Queued--
+	}
+	for _, info := range snapshots {
+		status.Nodes += info.Nodes
+	}
+	return status, nil
+}
+
+// Scheduled reports whether indexing runs on a schedule. Snapshots should
+// then only be indexed on schedule or on request, not whenever needed.
+func (ix *Indexer) Scheduled() bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return !ix.nextRun.IsZero()
+}
+
+// Schedule indexes all snapshots of the storages in the background whenever
+// the schedule matches, until the indexer is closed
+func (ix *Indexer) Schedule(sched schedule.Schedule, storages map[string]storage.Storage) {
+	ix.mu.Lock()
+	ix.nextRun = sched.Next(time.Now())
+	ix.scheduled = storages
+	ix.mu.Unlock()
+
+	go ix.runSchedule(sched)
+}
+
+// SetScheduled replaces the storages indexed on schedule, e.g. after the
+// config was reloaded
+func (ix *Indexer) SetScheduled(storages map[string]storage.Storage) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.scheduled = storages
+}
+
+// runSchedule waits for each scheduled run and queues all snapshots
+func (ix *Indexer) runSchedule(sched schedule.Schedule) {
+	for {
+		ix.mu.Lock()
+		next := ix.nextRun
+		ix.mu.Unlock()
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ix.stop:
+			timer.Stop()
+			return
+		}
+
+		ix.mu.Lock()
+		storages := ix.scheduled
+		ix.mu.Unlock()
+		for name, store := range storages {
+			if _, ok := store.(storage.SnapshotLister); !ok {
+				continue
+			}
+			if err := ix.EnqueueAll(name, store); err != nil {
+				log.Printf("Failed to index snapshots of %s: %v", name, err)
+			}
+		}
+
+		ix.mu.Lock()
+		ix.nextRun = sched.Next(time.Now())
+		ix.mu.Unlock()
+	}
+}
+
+// next removes and returns the first queued job of a storage that isn't
+// paused and the generation of its storage, ix.mu must be held
+func (ix *Indexer) next() (job, int, bool) {
+	for i, j := range ix.queue {
+		st := ix.state(j.storage)
+		if st.paused {
+			continue
+		}
+		ix.queue = slices.Delete(ix.queue, i, i+1)
+		st.current = j.snapshot.ID
+		return j, st.generation, true
+	}
+	return job{}, 0, false
+}
+
+// run indexes queued snapshots until the indexer is closed
+func (ix *Indexer) run() {
+	defer close(ix.done)
+	for {
+		ix.mu.Lock()
+		next, generation, ok := ix.next()
+		ix.mu.Unlock()
+
+		if !ok {
+			select {
+			case <-ix.wake:
+				continue
+			case <-ix.stop:
+				return
+			}
+		}
+
+		ix.working.Lock()
+		err := ix.index(next, generation)
+		ix.working.Unlock()
+
+		ix.mu.Lock()
+		st := ix.state(next.storage)
+		st.current = ""
+		finished := true
+		switch {
+		case errors.Is(err, errClosed), errors.Is(err, errDropped):
+			finished = false
+		case errors.Is(err, errPaused):
+			// Index the snapshot again when resumed
+			ix.queue = slices.Insert(ix.queue, 0, next)
+			finished = false
+		case err != nil:
+			log.Printf("Failed to index snapshot %s of %s: %v", next.snapshot.ID, next.storage, err)
+			st.lastError = fmt.Sprintf("%s: %v", next.snapshot.ID, err)
+			delete(st.queued, next.snapshot.ID)
+		default:
+			st.lastIndexed = time.Now().Unix()
+			st.lastError = ""
+			delete(st.queued, next.snapshot.ID)
+		}
+		ix.mu.Unlock()
+
+		if finished && ix.config.OnIndexed != nil {
+			ix.config.OnIndexed(next.storage, next.snapshot, err)
+		}
+
+		select {
+		case <-ix.stop:
+			return
+		default:
+		}
+	}
+}
+
+// interrupted returns why indexing a storage should stop, nil if it
+// shouldn't
+func (ix *Indexer) interrupted(storageName string, generation int) error {
+	select {
+	case <-ix.stop:
+		return errClosed
+	default:
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	st := ix.state(storageName)
+	if st.generation != generation {
+		return errDropped
+	}
+	if st.paused {
+		return errPaused
+	}
+	return nil
+}
+
+// index walks a snapshot into the cache
+func (ix *Indexer) index(j job, generation int) error {
+	lister, ok := j.store.(storage.Lister)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	reader, _ := j.store.(storage.Reader)
+
+	w := walker{
+		indexer:    ix,
+		lister:     lister,
+		reader:     reader,
+		storage:    j.storage,
+		snapshotID: j.snapshot.ID,
+		generation: generation,
+	}
+	return ix.cache.Add(j.storage, j.snapshot, func(add func(Entry) error) error {
+		return w.walk(snapshotURL(j.storage, "", j.snapshot.ID), add)
+	})
+}
+
+// walker walks the nodes of a snapshot into the cache
+type walker struct {
+	indexer    *Indexer
+	lister     storage.Lister
+	reader     storage.Reader
+	storage    string
+	snapshotID string
+	generation int
+}
+
+// walk adds the nodes of a snapshot directory and its subdirectories
+func (w *walker) walk(dir url.URL, add func(Entry) error) error {
+	if err := w.indexer.interrupted(w.storage, w.generation); err != nil {
+		return err
+	}
+
+	nodes, err := w.lister.ListContents(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		entry := Entry{
+			Snapshot:     w.snapshotID,
+			Path:         strings.Trim(node.Path.Path, "/"),
+			Type:         node.Type,
+			Size:         node.Size,
+			LastModified: node.LastModified,
+		}
+		child := snapshotURL(w.storage, entry.Path, w.snapshotID)
+
+		if entry.Type == "file" && w.indexer.config.Hash && w.reader != nil {
+			// Hashing reads the whole file, so check before each one
+			if err := w.indexer.interrupted(w.storage, w.generation); err != nil {
+				return err
+			}
+			entry.Hash, err = hashFile(w.reader, child)
+			if err != nil {
+				return fmt.Errorf("unable to hash %s: %w", entry.Path, err)
+			}
+		}
+		if err := add(entry); err != nil {
+			return err
+		}
+
+		if entry.Type == "dir" {
+			if err := w.walk(child, add); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotURL returns the URL of a path in a snapshot
+func snapshotURL(storageName string, path string, snapshotID string) url.URL {
+	return url.URL{
+		Scheme:   storageName,
+		Path:     path,
+		RawQuery: url.Values{"snapshot": {snapshotID}}.Encode(),
+	}
+}
+
+// hashFile returns the hex encoded SHA-256 of a file
+func hashFile(reader storage.Reader, path url.URL) (string, error) {
+	stream, err := reader.ReadStream(path)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, stream); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -2,47 +2,119 @@ package middleware
 
 import (
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/cors"
 )
 
-// CORS creates a CORS middleware handler with configuration from environment variables
-func CORS() func(http.Handler) http.Handler {
-	// Get allowed origins from environment variable
-	allowedOrigins := os.Getenv("TIMESHIP_CORS_ALLOWED_ORIGINS")
-	var origins []string
-
-	if allowedOrigins != "" {
-		origins = strings.Split(allowedOrigins, ",")
-		// Trim whitespace from each origin
-		for i, origin := range origins {
-			origins[i] = strings.TrimSpace(origin)
-		}
-	} else {
-		// Default to localhost if not set
-		origins = []string{"http://localhost:5173"}
+// DefaultCORSOrigins are allowed if no origins are configured
+var DefaultCORSOrigins = []string{"http://localhost:5173"}
+
+// corsHeaders are the request headers the UI sends, always allowed
+var corsHeaders = []string{"Accept", "Authorization", "Content-Type", CSRFHeader}
+
+// corsExposedHeaders are the response headers the UI reads, always exposed
+var corsExposedHeaders = []string{"X-File-Size", CSRFHeader}
+
+// CORSPolicy configures which origins may call the API and how
+type CORSPolicy struct {
+	// Origins may call the API, DefaultCORSOrigins if empty
+	Origins []string
+
+	// Methods are allowed in requests
+	Methods []string
+
+	// Headers may be sent in requests, in addition to the ones of the UI
+	Headers []string
+
+	// ExposedHeaders can be read from responses, in addition to the ones
+	// of the UI
+	ExposedHeaders []string
+
+	// Credentials lets requests send cookies
+	Credentials bool
+
+	// MaxAge is how long browsers may cache preflight responses, defaults
+	// to 5 minutes, the maximum not ignored by any major browser
+	MaxAge time.Duration
+}
+
+// CORSRoute applies a policy to the paths starting with Path instead
+type CORSRoute struct {
+	Path   string
+	Policy CORSPolicy
+}
+
+// corsRoute is a route with its handler
+type corsRoute struct {
+	path string
+	cors *cors.Cors
+}
+
+// corsRoutes are the handlers of all routes, the default last
+type corsRoutes []corsRoute
+
+// CORS is a CORS middleware whose policies can be replaced while serving,
+// e.g. when the config is reloaded
+type CORS struct {
+	routes atomic.Pointer[corsRoutes]
+}
+
+// NewCORS creates a CORS middleware applying policy to all paths but the
+// ones of routes
+func NewCORS(policy CORSPolicy, routes []CORSRoute) *CORS {
+	c := &CORS{}
+	c.Set(policy, routes)
+	return c
+}
+
+// Set replaces the policies. Requests already being handled keep the
+// previous ones.
+func (c *CORS) Set(policy CORSPolicy, routes []CORSRoute) {
+	var rs corsRoutes
+	for _, route := range routes {
+		rs = append(rs, corsRoute{path: route.Path, cors: newCORS(route.Policy)})
 	}
+	// The longest path is the most specific
+	slices.SortStableFunc(rs, func(a, b corsRoute) int {
+		return len(b.path) - len(a.path)
+	})
+	rs = append(rs, corsRoute{path: "/", cors: newCORS(policy)})
+	c.routes.Store(&rs)
+}
 
-	// Create CORS handler with configuration
-	c := cors.New(cors.Options{
-		AllowedOrigins: origins,
-		AllowedMethods: []string{
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPut,
-			http.MethodDelete,
-			http.MethodOptions,
-		},
-		AllowedHeaders: []string{
-			"Accept",
-			"Authorization",
-			"Content-Type",
-			"X-CSRF-Token",
-		},
-		MaxAge: 300, // Maximum value not ignored by any of major browsers
+// newCORS creates the handler of a policy
+func newCORS(p CORSPolicy) *cors.Cors {
+	origins := p.Origins
+	if len(origins) == 0 {
+		origins = DefaultCORSOrigins
+	}
+	maxAge := p.MaxAge
+	if maxAge == 0 {
+		maxAge = 5 * time.Minute
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   p.Methods,
+		AllowedHeaders:   append(append([]string{}, corsHeaders...), p.Headers...),
+		ExposedHeaders:   append(append([]string{}, corsExposedHeaders...), p.ExposedHeaders...),
+		AllowCredentials: p.Credentials,
+		MaxAge:           int(maxAge.Seconds()),
 	})
+}
 
-	return c.Handler
+// Handler wraps next with the policy of the request path
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range *c.routes.Load() {
+			if strings.HasPrefix(r.URL.Path, route.path) {
+				route.cors.Handler(next).ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	c := NewCORS(CORSPolicy{
+		Origins: []string{"https://ui.example.com"},
+		Methods: []string{http.MethodGet, http.MethodPatch},
+	}, []CORSRoute{
+		{Path: "/storages/public/", Policy: CORSPolicy{Origins: []string{"*"}, Methods: []string{http.MethodGet}}},
+		{Path: "/storages/public/private/", Policy: CORSPolicy{Origins: []string{"https://ui.example.com"}, Methods: []string{http.MethodGet}}},
+	})
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	preflight := func(path, origin, method string) string {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", "authorization,x-csrf-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		origin string
+		method string
+		want   string
+	}{
+		{"patch from the ui", "/storages/local/nodes/a.txt", "https://ui.example.com", http.MethodPatch, "https://ui.example.com"},
+		{"delete not allowed", "/storages/local/nodes/a.txt", "https://ui.example.com", http.MethodDelete, ""},
+		{"other origin", "/storages/local/nodes/a.txt", "https://evil.example.com", http.MethodGet, ""},
+		{"public route", "/storages/public/a.txt", "https://evil.example.com", http.MethodGet, "*"},
+		{"public route without patch", "/storages/public/a.txt", "https://ui.example.com", http.MethodPatch, ""},
+		{"longest route wins", "/storages/public/private/a.txt", "https://evil.example.com", http.MethodGet, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preflight(tt.path, tt.origin, tt.method); got != tt.want {
+				t.Errorf("expected allowed origin %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Reloading replaces the policies
+	c.Set(CORSPolicy{Origins: []string{"https://new.example.com"}, Methods: []string{http.MethodGet}}, nil)
+	if got := preflight("/storages/public/a.txt", "https://new.example.com", http.MethodGet); got != "https://new.example.com" {
+		t.Errorf("expected new origin to be allowed, got %q", got)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CSRFCookie is the cookie the CSRF token is issued in
+	CSRFCookie = "timeship_csrf"
+
+	// CSRFHeader is the header state-changing requests repeat the token in
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRF middleware protects state-changing requests against cross-site request
+// forgery with a double-submit token. Safe requests are issued a random token
+// in a cookie, which is also returned in the X-CSRF-Token header. POST, PUT,
+// PATCH and DELETE requests must send it back in the X-CSRF-Token header,
+// which other sites can't do, as they can't read the cookie. Requests with a
+// bearer token are exempt, as only scripts that know the token send it.
+// Other schemes aren't, as browsers resend Basic credentials on their own,
+// e.g. those of a reverse proxy.
+func CSRF() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := ""
+			if cookie, err := r.Cookie(CSRFCookie); err == nil {
+				token = cookie.Value
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				if token == "" {
+					token = newCSRFToken()
+					http.SetCookie(w, &http.Cookie{
+						Name:     CSRFCookie,
+						Value:    token,
+						Path:     "/",
+						Secure:   r.TLS != nil,
+						SameSite: http.SameSiteStrictMode,
+					})
+				}
+				w.Header().Set(CSRFHeader, token)
+			default:
+				if !hasBearerToken(r) && !validCSRFToken(token, r.Header.Get(CSRFHeader)) {
+					sendProblem(w, r, http.StatusForbidden, "CSRF Token Invalid", "Missing or invalid CSRF token")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasBearerToken reports whether a request is authorized with a bearer token
+func hasBearerToken(r *http.Request) bool {
+	scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	return ok && strings.EqualFold(scheme, "Bearer") && strings.TrimSpace(credentials) != ""
+}
+
+// newCSRFToken returns a random token
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validCSRFToken reports whether the header repeats the cookie token
+func validCSRFToken(cookie, header string) bool {
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
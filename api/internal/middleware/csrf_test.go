@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	handler := CSRF()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// Safe requests are issued a token
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/storages", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookie || cookies[0].Value == "" {
+		t.Fatalf("expected CSRF cookie, got %v", cookies)
+	}
+	token := cookies[0].Value
+	if w.Header().Get(CSRFHeader) != token {
+		t.Errorf("expected token in header, got %q", w.Header().Get(CSRFHeader))
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		cookie        string
+		header        string
+		authorization string
+		status        int
+	}{
+		{"get without token", http.MethodGet, "", "", "", http.StatusNoContent},
+		{"matching token", http.MethodPost, token, token, "", http.StatusNoContent},
+		{"patch", http.MethodPatch, token, token, "", http.StatusNoContent},
+		{"missing header", http.MethodPost, token, "", "", http.StatusForbidden},
+		{"missing cookie", http.MethodDelete, "", token, "", http.StatusForbidden},
+		{"both empty", http.MethodDelete, "", "", "", http.StatusForbidden},
+		{"wrong token", http.MethodPatch, token, "forged", "", http.StatusForbidden},
+		{"bearer token", http.MethodDelete, "", "", "Bearer secret", http.StatusNoContent},
+		{"basic credentials", http.MethodDelete, "", "", "Basic dXNlcjpwYXNz", http.StatusForbidden},
+		{"empty bearer token", http.MethodDelete, "", "", "Bearer ", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/storages/local/nodes/a.txt", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
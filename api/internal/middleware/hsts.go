@@ -0,0 +1,16 @@
+package middleware
+
+import "net/http"
+
+// HSTS middleware tells browsers to only connect to the host with HTTPS for
+// a year, for listeners serving TLS
+func HSTS() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
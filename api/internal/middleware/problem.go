@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// sendProblem writes an RFC 9457 problem details response in the format of
+// the API, for middleware in front of it
+func sendProblem(w http.ResponseWriter, r *http.Request, status int, title, detail string) {
+	code := strings.ReplaceAll(strings.ToLower(title), " ", "_")
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"type":     "urn:timeship:problem:" + code,
+		"title":    title,
+		"status":   status,
+		"detail":   detail,
+		"instance": r.URL.Path,
+		"code":     code,
+	})
+}
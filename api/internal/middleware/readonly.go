@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// readOnlyKey marks requests of read-only listeners in their context
+type readOnlyKey struct{}
+
+// ReadOnly middleware rejects requests that could change anything, e.g. for
+// a listener exposed to the internet. Only GET, HEAD and OPTIONS requests
+// are let through, marked so IsReadOnly reports them.
+func ReadOnly() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), readOnlyKey{}, true)))
+			default:
+				w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+				sendProblem(w, r, http.StatusMethodNotAllowed, "Read Only", "This listener only allows reading")
+			}
+		})
+	}
+}
+
+// IsReadOnly reports whether the request came through ReadOnly, so
+// handlers can leave out what it would reject
+func IsReadOnly(r *http.Request) bool {
+	readOnly, _ := r.Context().Value(readOnlyKey{}).(bool)
+	return readOnly
+}
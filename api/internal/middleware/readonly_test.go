@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	handler := ReadOnly()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsReadOnly(r) {
+			t.Error("expected request to be marked read-only")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusNoContent},
+		{http.MethodHead, http.StatusNoContent},
+		{http.MethodOptions, http.StatusNoContent},
+		{http.MethodPost, http.StatusMethodNotAllowed},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodPatch, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, "/storages/local/nodes/a.txt", nil))
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status != http.StatusMethodNotAllowed {
+				return
+			}
+			var problem struct {
+				Code string `json:"code"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Code != "read_only" {
+				t.Errorf("expected read_only problem, got %+v: %v", problem, err)
+			}
+		})
+	}
+
+	if IsReadOnly(httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Error("expected other requests not to be read-only")
+	}
+}
@@ -1,33 +1,68 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
 	"net/http"
-	"os"
 	"path"
+	"regexp"
 	"strings"
 )
 
-// SpaFs is a filesystem wrapper that serves index.html for SPA routing
-type SpaFs struct {
-	Root http.FileSystem
-}
+// prefixRegex matches the X-Forwarded-Prefix values used as the base path of
+// the UI, leaving out anything that would need escaping
+var prefixRegex = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)*$`)
 
-func (fs SpaFs) Open(name string) (http.File, error) {
-	f, err := fs.Root.Open(name)
-	if os.IsNotExist(err) && !strings.HasSuffix(name, ".br") && !strings.HasSuffix(name, ".gz") {
-		return fs.Root.Open("index.html")
+// SPA serves a single page app. Requests for files of root are served by
+// files, /config.json serves the runtime config of the app and any other
+// path gets index.html with the config injected, so the app can route it.
+//
+// index.html gets a <base> of the path the app is served at and the config
+// as window.__TIMESHIP_CONFIG__, so one build of the app works behind any
+// reverse proxy path. The path is taken from the X-Forwarded-Prefix header
+// of the proxy, and passed to config with a trailing slash.
+func SPA(root fs.FS, files http.Handler, config func(r *http.Request, base string) any) (http.Handler, error) {
+	index, err := fs.ReadFile(root, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	head := []byte("<head>")
+	if !bytes.Contains(index, head) {
+		return nil, fmt.Errorf("index.html has no <head>")
 	}
-	return f, err
-}
 
-// IndexHTML middleware appends index.html to directory requests
-func IndexHTML() func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.HasSuffix(r.URL.Path, "/") || len(r.URL.Path) == 0 {
-				r.URL.Path = path.Join(r.URL.Path, "index.html")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name != "" && name != "index.html" {
+			if info, err := fs.Stat(root, name); err == nil && !info.IsDir() {
+				files.ServeHTTP(w, r)
+				return
 			}
-			next.ServeHTTP(w, r)
-		})
-	}
+		}
+
+		base := "/"
+		if prefix := strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/"); prefixRegex.MatchString(prefix) {
+			base = prefix + "/"
+		}
+		// JSON escapes <, > and &, so it can't end the script
+		cfg, err := json.Marshal(config(r, base))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The config changes with the server config, so it's never cached
+		w.Header().Set("Cache-Control", "no-cache")
+		if name == "config.json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(cfg)
+			return
+		}
+		inject := fmt.Sprintf(`<head><base href="%s"><script>window.__TIMESHIP_CONFIG__=%s</script>`, html.EscapeString(base), cfg)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(bytes.Replace(index, head, []byte(inject), 1))
+	}), nil
 }
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSPA(t *testing.T) {
+	root := fstest.MapFS{
+		"index.html":      {Data: []byte(`<html><head><script src="assets/app.js"></script></head></html>`)},
+		"assets/app.js":   {Data: []byte("app")},
+		"assets/sub/x.js": {Data: []byte("x")},
+	}
+	files := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("file " + r.URL.Path))
+	})
+	handler, err := SPA(root, files, func(r *http.Request, base string) any {
+		return map[string]string{"base": base, "api_prefix": base + "api", "name": "</script>"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		prefix string
+		want   []string
+	}{
+		{"/assets/app.js", "", []string{"file /assets/app.js"}},
+		{"/", "", []string{`<base href="/">`, `"api_prefix":"/api"`, `<script src="assets/app.js">`}},
+		{"/storages/local/docs", "/timeship", []string{`<base href="/timeship/">`, `"api_prefix":"/timeship/api"`}},
+		{"/config.json", "/timeship/", []string{`"base":"/timeship/"`}},
+		// Prefixes that would need escaping are ignored
+		{"/", `/"><script>`, []string{`<base href="/">`}},
+		{"/assets", "", []string{`<base href="/">`}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.prefix != "" {
+			req.Header.Set("X-Forwarded-Prefix", tt.prefix)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		body := w.Body.String()
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: expected %q in %s", tt.target, want, body)
+			}
+		}
+		if strings.Contains(body, "</script>\"") {
+			t.Errorf("%s: expected config to be escaped in %s", tt.target, body)
+		}
+	}
+}
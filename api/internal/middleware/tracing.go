@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Tracing middleware records a span for each request, named after the
+// matched route. Spans are only exported if tracing is set up.
+func Tracing() func(http.Handler) http.Handler {
+	return otelhttp.NewMiddleware("timeship",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			// The pattern is only known once the request is routed
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return r.Method
+		}),
+	)
+}
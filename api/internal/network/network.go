@@ -14,8 +14,9 @@ type ListenURL struct {
 	URL   string
 }
 
-// GetListenURLs returns all URLs that a listener is available on
-func GetListenURLs(addr net.Addr) ([]ListenURL, error) {
+// GetListenURLs returns all URLs that a listener is available on, with the
+// scheme of its protocol, e.g. "https"
+func GetListenURLs(addr net.Addr, scheme string) ([]ListenURL, error) {
 	var urls []ListenURL
 	switch vaddr := addr.(type) {
 	case *net.TCPAddr:
@@ -35,11 +36,11 @@ func GetListenURLs(addr net.Addr) ([]ListenURL, error) {
 						urls = append(urls, ListenURL{
 							Local: v.IP.IsLoopback(),
 							IPv6:  v.IP.To4() == nil,
-							URL:   fmt.Sprintf("http://%v", net.JoinHostPort(v.IP.String(), strconv.Itoa(vaddr.Port))),
+							URL:   fmt.Sprintf("%s://%v", scheme, net.JoinHostPort(v.IP.String(), strconv.Itoa(vaddr.Port))),
 						})
 					default:
 						urls = append(urls, ListenURL{
-							URL: fmt.Sprintf("http://%v", v),
+							URL: fmt.Sprintf("%s://%v", scheme, v),
 						})
 					}
 				}
@@ -47,20 +48,25 @@ func GetListenURLs(addr net.Addr) ([]ListenURL, error) {
 		} else {
 			urls = append(urls, ListenURL{
 				Local: vaddr.IP.IsLoopback(),
-				URL:   fmt.Sprintf("http://%v", vaddr.AddrPort()),
+				URL:   fmt.Sprintf("%s://%v", scheme, vaddr.AddrPort()),
 			})
 		}
+	case *net.UnixAddr:
+		urls = append(urls, ListenURL{
+			Local: true,
+			URL:   fmt.Sprintf("unix:%v", vaddr.Name),
+		})
 	default:
 		urls = append(urls, ListenURL{
-			URL: fmt.Sprintf("http://%v", addr),
+			URL: fmt.Sprintf("%s://%v", scheme, addr),
 		})
 	}
 	return urls, nil
 }
 
 // PrintListenURLs prints all URLs that a listener is available on
-func PrintListenURLs(addr net.Addr) error {
-	urls, err := GetListenURLs(addr)
+func PrintListenURLs(addr net.Addr, scheme string) error {
+	urls, err := GetListenURLs(addr, scheme)
 	if err != nil {
 		return err
 	}
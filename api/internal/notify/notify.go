@@ -0,0 +1,271 @@
+// Package notify sends events as human readable notifications by email,
+// ntfy or Gotify, e.g. to warn when snapshots stop or a job failed. Each
+// sender implements webhook.Sender, so notifications are queued and retried
+// like webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/webhook"
+)
+
+// Format returns the title and message of a notification for an event
+func Format(event webhook.Event) (title, message string) {
+	where := event.Storage
+	if event.Path != "" {
+		where += ":" + event.Path
+	}
+	switch event.Type {
+	case webhook.UploadCompleted:
+		title = "Upload completed"
+		message = "Uploaded " + where
+	case webhook.NodeDeleted:
+		title = "Deleted"
+		message = "Deleted " + where
+	case webhook.NodeRestored:
+		title = "Restore completed"
+		message = fmt.Sprintf("Restored %s from %s to %s", where, event.Snapshot, event.Destination)
+	case webhook.SnapshotCreated:
+		title = "Snapshot created"
+		message = fmt.Sprintf("Created snapshot %s of %s", event.Snapshot, where)
+	case webhook.IndexFinished:
+		title = "Indexing finished"
+		message = fmt.Sprintf("Indexed snapshot %s of %s", event.Snapshot, event.Storage)
+	case webhook.JobFailed:
+		title = "Job failed"
+		message = fmt.Sprintf("Job %s failed", event.Job)
+		if event.Storage != "" {
+			message += " on " + event.Storage
+		}
+	case webhook.SnapshotMissing:
+		title = "Snapshot missing"
+		message = "No recent snapshot of " + event.Storage
+		if event.Since != nil {
+			message += fmt.Sprintf(", the newest is from %s (%s ago)", event.Since.Local().Format(time.DateTime), time.Since(*event.Since).Round(time.Minute))
+		}
+	case webhook.StorageAdded:
+		title = "Storage added"
+		message = "Added storage " + event.Storage
+	case webhook.StorageRemoved:
+		title = "Storage removed"
+		message = "Removed storage " + event.Storage
+	default:
+		title = event.Type
+		message = event.Type + " " + where
+	}
+	if event.Error != "" {
+		message += ": " + event.Error
+	}
+	return "timeship: " + title, message
+}
+
+// failed reports whether an event is about something going wrong, which is
+// sent with a higher priority
+func failed(event webhook.Event) bool {
+	return event.Error != "" || event.Type == webhook.JobFailed || event.Type == webhook.SnapshotMissing
+}
+
+// Ntfy publishes notifications to a topic of an ntfy server
+type Ntfy struct {
+	// URL of the topic, e.g. "https://ntfy.sh/my-backups"
+	URL string
+
+	// Token is an access token of the server, optional
+	Token string
+
+	// Priority of the notifications from 1 to 5, defaults to 3 and 4 for
+	// failures
+	Priority int
+
+	Client *http.Client
+}
+
+// Send publishes an event to the topic
+func (n *Ntfy) Send(ctx context.Context, event webhook.Event) error {
+	title, message := Format(event)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	priority := n.Priority
+	if priority == 0 {
+		priority = 3
+		if failed(event) {
+			priority = 4
+		}
+	}
+	req.Header.Set("Title", title)
+	req.Header.Set("Priority", strconv.Itoa(priority))
+	req.Header.Set("Tags", strings.ReplaceAll(event.Type, ".", "-"))
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return do(n.Client, req)
+}
+
+// Gotify sends notifications to a Gotify server
+type Gotify struct {
+	// URL of the server, e.g. "https://gotify.example.com"
+	URL string
+
+	// Token is the token of the application sending the notifications
+	Token string
+
+	// Priority of the notifications, defaults to 5 and 8 for failures
+	Priority int
+
+	Client *http.Client
+}
+
+// Send sends an event as a message of the application
+func (g *Gotify) Send(ctx context.Context, event webhook.Event) error {
+	title, message := Format(event)
+	priority := g.Priority
+	if priority == 0 {
+		priority = 5
+		if failed(event) {
+			priority = 8
+		}
+	}
+	body, err := json.Marshal(map[string]any{"title": title, "message": message, "priority": priority})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(g.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.Token)
+	return do(g.Client, req)
+}
+
+// do sends a request, which succeeds with any 2xx response
+func do(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req.Header.Set("User-Agent", "timeship-notify")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTP sends notifications by email
+type SMTP struct {
+	// Address is the host:port of the mail server. Port 465 uses TLS,
+	// other ports STARTTLS if the server supports it.
+	Address string
+
+	// Username and Password authenticate with PLAIN auth if set, which
+	// needs TLS unless the server is local
+	Username string
+	Password string
+
+	// From is the sender address
+	From string
+
+	// To are the recipient addresses
+	To []string
+}
+
+// Send emails an event to the recipients
+func (m *SMTP) Send(ctx context.Context, event webhook.Event) error {
+	host, port, err := net.SplitHostPort(m.Address)
+	if err != nil {
+		return err
+	}
+	var conn net.Conn
+	dialer := &net.Dialer{}
+	if port == "465" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", m.Address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.Address)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && port != "465" {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.message(event)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message returns the email of an event with its headers
+func (m *SMTP) message(event webhook.Event) []byte {
+	title, message := Format(event)
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", sanitizeHeader(title))
+	fmt.Fprintf(&b, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "X-Timeship-Event: %s\r\n", event.Type)
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// sanitizeHeader keeps values like paths from adding headers
+func sanitizeHeader(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
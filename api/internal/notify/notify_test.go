@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"timeship/internal/webhook"
+)
+
+func TestFormat(t *testing.T) {
+	since := time.Now().Add(-30 * time.Hour)
+	tests := []struct {
+		event   webhook.Event
+		title   string
+		message string
+	}{
+		{webhook.Event{Type: webhook.NodeRestored, Storage: "local", Path: "docs/a.txt", Snapshot: "zfs:daily", Destination: "docs/a.txt"}, "timeship: Restore completed", "Restored local:docs/a.txt from zfs:daily to docs/a.txt"},
+		{webhook.Event{Type: webhook.JobFailed, Job: "abc", Storage: "local", Error: "disk full"}, "timeship: Job failed", "Job abc failed on local: disk full"},
+		{webhook.Event{Type: webhook.SnapshotMissing, Storage: "tank", Since: &since}, "timeship: Snapshot missing", "No recent snapshot of tank, the newest is from"},
+	}
+	for _, tt := range tests {
+		title, message := Format(tt.event)
+		if title != tt.title || !strings.HasPrefix(message, tt.message) {
+			t.Errorf("unexpected notification %q %q for %s", title, message, tt.event.Type)
+		}
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got, body = r, string(data)
+	}))
+	defer srv.Close()
+
+	n := &Ntfy{URL: srv.URL + "/backups", Token: "tk_secret"}
+	if err := n.Send(context.Background(), webhook.Event{Type: webhook.JobFailed, Job: "abc", Error: "disk full"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got.URL.Path != "/backups" || got.Header.Get("Title") != "timeship: Job failed" || got.Header.Get("Priority") != "4" || got.Header.Get("Authorization") != "Bearer tk_secret" {
+		t.Errorf("unexpected request %s %v", got.URL, got.Header)
+	}
+	if body != "Job abc failed: disk full" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestGotify(t *testing.T) {
+	var got *http.Request
+	var message map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		json.NewDecoder(r.Body).Decode(&message)
+	}))
+	defer srv.Close()
+
+	g := &Gotify{URL: srv.URL + "/", Token: "app-token"}
+	if err := g.Send(context.Background(), webhook.Event{Type: webhook.NodeRestored, Storage: "local", Path: "a.txt", Snapshot: "zfs:daily", Destination: "a.txt"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got.URL.Path != "/message" || got.Header.Get("X-Gotify-Key") != "app-token" {
+		t.Errorf("unexpected request %s %v", got.URL, got.Header)
+	}
+	if message["title"] != "timeship: Restore completed" || message["priority"] != float64(5) {
+		t.Errorf("unexpected message %v", message)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	if err := (&Gotify{URL: failing.URL}).Send(context.Background(), webhook.Event{Type: webhook.JobFailed}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// serveSMTP answers one SMTP session on l and returns the commands and the
+// message it received
+func serveSMTP(l net.Listener) <-chan []string {
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var lines []string
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250 AUTH PLAIN")
+			case strings.HasPrefix(line, "AUTH"):
+				tp.PrintfLine("235 Authenticated")
+			case line == "DATA":
+				tp.PrintfLine("354 Go ahead")
+				data, _ := tp.ReadDotLines()
+				lines = append(lines, data...)
+				tp.PrintfLine("250 Queued")
+			case line == "QUIT":
+				tp.PrintfLine("221 Bye")
+				received <- lines
+				return
+			default:
+				tp.PrintfLine("250 OK")
+			}
+		}
+		received <- lines
+	}()
+	return received
+}
+
+func TestSMTP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := serveSMTP(l)
+
+	// PLAIN auth is only sent unencrypted to localhost
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	m := &SMTP{Address: "localhost:" + port, Username: "user", Password: "pass", From: "timeship@example.com", To: []string{"me@example.com", "you@example.com"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, webhook.Event{Type: webhook.SnapshotMissing, Storage: "tank"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	lines := <-received
+	text := strings.Join(lines, "\n")
+	for _, want := range []string{"AUTH PLAIN", "MAIL FROM:<timeship@example.com>", "RCPT TO:<me@example.com>", "RCPT TO:<you@example.com>", "Subject: timeship: Snapshot missing", "No recent snapshot of tank"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in session:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package pdfpreview reads the page count of PDFs and renders their first
+// page as a PNG preview.
+//
+// Page counts are read in Go. Rendering needs mutool from MuPDF, which is
+// optional. Rendered previews can be cached on disk, as rendering is slow.
+package pdfpreview
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PreviewSize is the largest width and height of previews in pixels
+const PreviewSize = 512
+
+// renderTimeout limits how long rendering a single preview may take
+const renderTimeout = 30 * time.Second
+
+// maxConcurrentRenders limits how many previews are rendered at once, as
+// rendering is CPU heavy
+const maxConcurrentRenders = 2
+
+// Supported reports whether a file is a PDF
+func Supported(name, mimeType string) bool {
+	return mimeType == "application/pdf" || strings.EqualFold(path.Ext(name), ".pdf")
+}
+
+// PageCount returns the number of pages of a PDF
+func PageCount(r io.ReaderAt, size int64) (count int, err error) {
+	// The reader panics on some malformed files
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("malformed PDF: %v", x)
+		}
+	}()
+	reader, err := pdf.NewReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+	count = reader.NumPage()
+	if count <= 0 {
+		return 0, errors.New("malformed PDF: no pages")
+	}
+	return count, nil
+}
+
+// Renderer renders the first page of PDFs with mutool
+type Renderer struct {
+	mutool   string
+	cacheDir string
+	sem      chan struct{}
+}
+
+// NewRenderer creates a renderer running the given mutool binary. Previews
+// are cached in cacheDir, or rendered on every request if empty.
+func NewRenderer(mutool, cacheDir string) *Renderer {
+	return &Renderer{
+		mutool:   mutool,
+		cacheDir: cacheDir,
+		sem:      make(chan struct{}, maxConcurrentRenders),
+	}
+}
+
+// Render returns a PNG preview of the first page of a PDF. The key
+// identifies the version of the file in the cache, e.g. its path, size and
+// modification time. The file is only opened if the preview isn't cached.
+func (r *Renderer) Render(ctx context.Context, key string, open func() (io.ReadCloser, error)) ([]byte, error) {
+	cachePath := ""
+	if r.cacheDir != "" {
+		sum := sha256.Sum256([]byte(key))
+		cachePath = filepath.Join(r.cacheDir, hex.EncodeToString(sum[:])+".png")
+		if png, err := os.ReadFile(cachePath); err == nil {
+			return png, nil
+		}
+	}
+
+	select {
+	case r.sem <- struct{}{}:
+		defer func() { <-r.sem }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	content, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	png, err := r.render(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+	if cachePath != "" {
+		// The preview is still fine if it can't be cached
+		if err := writeCache(cachePath, png); err != nil {
+			log.Printf("Failed to cache PDF preview: %v", err)
+		}
+	}
+	return png, nil
+}
+
+// render runs mutool on a temporary copy of the content, as it can only read
+// files
+func (r *Renderer) render(ctx context.Context, content io.Reader) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "timeship-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.pdf")
+	f, err := os.Create(input)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+	output := filepath.Join(dir, "page.png")
+	size := strconv.Itoa(PreviewSize)
+	// With a resolution, the width and height are the largest size to fit in
+	cmd := exec.CommandContext(ctx, r.mutool, "draw", "-F", "png", "-r", "150", "-w", size, "-h", size, "-o", output, input, "1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("mutool failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(output)
+}
+
+// writeCache writes a preview to the cache atomically, so concurrent
+// requests never read partial files
+func writeCache(cachePath string, png []byte) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(cachePath), ".preview-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(png)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), cachePath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
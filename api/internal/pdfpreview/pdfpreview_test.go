@@ -0,0 +1,148 @@
+package pdfpreview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// minimalPDF builds a PDF with the given number of empty pages
+func minimalPDF(pages int) []byte {
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", i+3))
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages),
+	}
+	for range pages {
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestPageCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   []byte
+		want      int
+		wantError bool
+	}{
+		{name: "one page", content: minimalPDF(1), want: 1},
+		{name: "many pages", content: minimalPDF(12), want: 12},
+		{name: "not a pdf", content: bytes.Repeat([]byte("hello "), 50), wantError: true},
+		{name: "truncated", content: minimalPDF(3)[:200], wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PageCount(bytes.NewReader(tt.content), int64(len(tt.content)))
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("expected error, got %d pages", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PageCount failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %d pages, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	if !Supported("report.PDF", "") || !Supported("report", "application/pdf") {
+		t.Error("expected PDFs to be supported")
+	}
+	if Supported("notes.txt", "text/plain") {
+		t.Error("expected text files not to be supported")
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake mutool is a shell script")
+	}
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	// Writes the arguments as the preview and records each run
+	mutool := filepath.Join(dir, "mutool")
+	script := fmt.Sprintf(`#!/bin/sh
+echo run >> %q
+while [ "$1" != "-o" ]; do shift; done
+echo "$@" > "$2"
+`, runs)
+	if err := os.WriteFile(mutool, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	openPDF := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(minimalPDF(1))), nil
+	}
+	renderer := NewRenderer(mutool, filepath.Join(dir, "cache"))
+	render := func(t *testing.T, key string) string {
+		t.Helper()
+		png, err := renderer.Render(context.Background(), key, openPDF)
+		if err != nil {
+			t.Fatalf("Render failed: %v", err)
+		}
+		return string(png)
+	}
+	countRuns := func() int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "run")
+	}
+
+	t.Run("renders first page", func(t *testing.T) {
+		if got := render(t, "local://report.pdf 100 1"); !strings.HasSuffix(strings.TrimSpace(got), "input.pdf 1") {
+			t.Errorf("expected first page to be rendered, got %q", got)
+		}
+		if countRuns() != 1 {
+			t.Errorf("expected 1 run, got %d", countRuns())
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		render(t, "local://report.pdf 100 1")
+		if countRuns() != 1 {
+			t.Errorf("expected cached preview, got %d runs", countRuns())
+		}
+	})
+
+	t.Run("changed file", func(t *testing.T) {
+		render(t, "local://report.pdf 200 2")
+		if countRuns() != 2 {
+			t.Errorf("expected new render, got %d runs", countRuns())
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		failing := NewRenderer(filepath.Join(dir, "missing"), "")
+		if _, err := failing.Render(context.Background(), "key", openPDF); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -0,0 +1,119 @@
+// Package recent remembers the paths each user browsed and downloaded most
+// recently, so they can jump back in.
+//
+// Paths are kept in memory only and forgotten on restart. Each user keeps
+// a bounded list per kind of access, most recent first, in which accessing
+// a path again moves it to the front.
+package recent
+
+import (
+	"sync"
+	"time"
+)
+
+// Kinds of access
+const (
+	// Browsed is listing a directory
+	Browsed = "browsed"
+
+	// Downloaded is reading the content of a file
+	Downloaded = "downloaded"
+)
+
+// DefaultLimit is how many paths of each kind are kept per user if the
+// tracker has no limit
+const DefaultLimit = 50
+
+// Entry is a recently accessed path
+type Entry struct {
+	// Kind is how the path was accessed, e.g. "browsed"
+	Kind string
+
+	// Storage is the name of the storage of the path
+	Storage string
+
+	// Path is the path relative to the storage root as seen by the user
+	Path string
+
+	// Snapshot is the snapshot the path was accessed in, empty for the
+	// current state
+	Snapshot string
+
+	// Time is when the path was last accessed
+	Time time.Time
+}
+
+// same reports whether two entries are accesses of the same kind to the
+// same path
+func (e Entry) same(other Entry) bool {
+	return e.Kind == other.Kind && e.Storage == other.Storage && e.Path == other.Path && e.Snapshot == other.Snapshot
+}
+
+// Tracker remembers recently accessed paths of users. It's safe for
+// concurrent use.
+type Tracker struct {
+	limit int
+	now   func() time.Time
+
+	mu    sync.Mutex
+	users map[string][]Entry
+}
+
+// New creates a tracker keeping up to limit paths of each kind per user,
+// DefaultLimit if limit is not positive
+func New(limit int) *Tracker {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return &Tracker{limit: limit, now: time.Now, users: map[string][]Entry{}}
+}
+
+// Track records an access of a user to a path. The time is set if it's
+// zero.
+func (t *Tracker) Track(user string, e Entry) {
+	if e.Time.IsZero() {
+		e.Time = t.now()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := t.users[user]
+	kept := make([]Entry, 0, len(entries)+1)
+	kept = append(kept, e)
+	count := 1
+	for _, other := range entries {
+		if other.same(e) {
+			continue
+		}
+		if other.Kind == e.Kind {
+			if count == t.limit {
+				continue
+			}
+			count++
+		}
+		kept = append(kept, other)
+	}
+	t.users[user] = kept
+}
+
+// List returns the paths a user accessed, most recent first, only of one
+// kind if kind isn't empty
+func (t *Tracker) List(user, kind string) []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := []Entry{}
+	for _, e := range t.users[user] {
+		if kind == "" || e.Kind == kind {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Forget forgets the paths a user accessed
+func (t *Tracker) Forget(user string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.users, user)
+}
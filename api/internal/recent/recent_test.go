@@ -0,0 +1,51 @@
+package recent
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := New(2)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	tracker.Track("alice", Entry{Kind: Browsed, Storage: "local", Path: "docs"})
+	tracker.Track("alice", Entry{Kind: Downloaded, Storage: "local", Path: "docs/a.txt"})
+	tracker.Track("alice", Entry{Kind: Browsed, Storage: "local", Path: "photos"})
+	tracker.Track("alice", Entry{Kind: Browsed, Storage: "local", Path: "docs"})
+	tracker.Track("alice", Entry{Kind: Browsed, Storage: "local", Path: "music"})
+	tracker.Track("bob", Entry{Kind: Browsed, Storage: "local", Path: "bob"})
+
+	paths := func(entries []Entry) []string {
+		var paths []string
+		for _, e := range entries {
+			paths = append(paths, e.Kind+" "+e.Path)
+		}
+		return paths
+	}
+	// Browsing docs again moved it to the front, so photos dropped out, but
+	// downloads are limited on their own
+	want := []string{"browsed music", "browsed docs", "downloaded docs/a.txt"}
+	if got := paths(tracker.List("alice", "")); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := paths(tracker.List("alice", Downloaded)); !slices.Equal(got, []string{"downloaded docs/a.txt"}) {
+		t.Errorf("expected downloads only, got %v", got)
+	}
+	if entries := tracker.List("alice", Browsed); entries[0].Time.Before(entries[1].Time) {
+		t.Errorf("expected most recent first, got %+v", entries)
+	}
+
+	tracker.Forget("alice")
+	if entries := tracker.List("alice", ""); len(entries) != 0 {
+		t.Errorf("expected alice's paths to be forgotten, got %+v", entries)
+	}
+	if entries := tracker.List("bob", ""); len(entries) != 1 {
+		t.Errorf("expected bob's paths to be kept, got %+v", entries)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package removable
+
+// isMountPoint isn't supported
+func isMountPoint(path string) (bool, error) {
+	return false, ErrNotSupported
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package removable
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// isMountPoint reports whether a directory is on another device than its
+// parent
+func isMountPoint(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	parent, err := os.Lstat(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+	stat, ok1 := info.Sys().(*syscall.Stat_t)
+	parentStat, ok2 := parent.Sys().(*syscall.Stat_t)
+	if !ok1 || !ok2 {
+		return false, ErrNotSupported
+	}
+	return stat.Dev != parentStat.Dev, nil
+}
@@ -0,0 +1,203 @@
+// Package removable finds the drives mounted in a directory like /media or
+// /mnt, so they can be served as storages while they're plugged in.
+//
+// Mount points are found by comparing the device of each directory with the
+// device of its parent, which needs no privileges and works on every Unix.
+package removable
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotSupported is returned on platforms without mount points
+var ErrNotSupported = errors.New("finding mounted drives is not supported on this platform")
+
+// Drive is a filesystem mounted in the watched directory
+type Drive struct {
+	// Name is a storage name derived from the mount point, e.g. "backup-2tb"
+	Name string
+
+	// Path is the mount point
+	Path string
+}
+
+// Scan returns the drives mounted in dir, or one level deeper like the
+// /media/$USER/LABEL mounts of desktop systems, sorted by path. Drives with
+// similar labels get the same name. Directories that can't be checked, e.g.
+// stale mounts of unplugged drives, are logged and skipped.
+func Scan(dir string) ([]Drive, error) {
+	var paths []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		p := filepath.Join(dir, entry.Name())
+		mounted, err := mountPoint(p)
+		if errors.Is(err, ErrNotSupported) {
+			return nil, err
+		}
+		if err != nil {
+			log.Printf("Skipping %s while finding drives: %v", p, err)
+			continue
+		}
+		if mounted {
+			paths = append(paths, p)
+			continue
+		}
+		// Not a mount point, but maybe a directory of mount points
+		subentries, err := os.ReadDir(p)
+		if err != nil {
+			continue
+		}
+		for _, sub := range subentries {
+			if !sub.IsDir() || strings.HasPrefix(sub.Name(), ".") {
+				continue
+			}
+			sp := filepath.Join(p, sub.Name())
+			mounted, err := mountPoint(sp)
+			if err != nil {
+				log.Printf("Skipping %s while finding drives: %v", sp, err)
+				continue
+			}
+			if mounted {
+				paths = append(paths, sp)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	drives := make([]Drive, len(paths))
+	for i, p := range paths {
+		drives[i] = Drive{Name: StorageName(filepath.Base(p)), Path: p}
+	}
+	return drives, nil
+}
+
+// mountPoint reports whether a directory is a mount point, replaced in tests
+var mountPoint = isMountPoint
+
+// invalidName matches the runs of characters not allowed in storage names
+var invalidName = regexp.MustCompile(`[^a-z0-9+.-]+`)
+
+// StorageName turns a volume label into a storage name, which is used as
+// a URL scheme, so it's lower case and starts with a letter
+func StorageName(label string) string {
+	name := strings.Trim(invalidName.ReplaceAllString(strings.ToLower(label), "-"), "-.+")
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		name = "drive-" + name
+	}
+	return strings.TrimSuffix(name, "-")
+}
+
+// Watcher checks a directory for drives periodically, reporting the drives
+// that were mounted and unmounted since the last check
+type Watcher struct {
+	dir      string
+	interval time.Duration
+	changed  func(added, removed []Drive)
+
+	// drives are the drives found by the last check by path
+	drives map[string]Drive
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Watch checks dir for drives right away and then every interval until
+// closed, calling changed with the drives mounted and unmounted since the
+// last check. The drives mounted at the start are reported as added.
+func Watch(dir string, interval time.Duration, changed func(added, removed []Drive)) *Watcher {
+	w := &Watcher{
+		dir:      dir,
+		interval: interval,
+		changed:  changed,
+		drives:   map[string]Drive{},
+		stop:     make(chan struct{}),
+	}
+	w.wg.Go(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			w.check()
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+		}
+	})
+	return w
+}
+
+// check scans the directory and reports the differences to the last scan.
+// Drives keep the name they were added with while they're mounted, new
+// drives with a name in use get a numbered one.
+func (w *Watcher) check() {
+	drives, err := Scan(w.dir)
+	if err != nil {
+		log.Printf("Failed to find drives in %s: %v", w.dir, err)
+		return
+	}
+	added, removed := diff(w.drives, drives)
+	for _, d := range removed {
+		delete(w.drives, d.Path)
+	}
+	for _, d := range added {
+		w.drives[d.Path] = d
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		w.changed(added, removed)
+	}
+}
+
+// diff returns the drives of found that aren't known and the known drives
+// that weren't found, matching them by path
+func diff(known map[string]Drive, found []Drive) (added, removed []Drive) {
+	seen := map[string]bool{}
+	names := map[string]bool{}
+	for _, d := range known {
+		names[d.Name] = true
+	}
+	for _, d := range found {
+		seen[d.Path] = true
+		if _, ok := known[d.Path]; !ok {
+			added = append(added, d)
+		}
+	}
+	for p, d := range known {
+		if !seen[p] {
+			removed = append(removed, d)
+			delete(names, d.Name)
+		}
+	}
+	// Names of new drives may clash with each other or with known drives
+	for i, d := range added {
+		name := d.Name
+		for n := 2; names[name]; n++ {
+			name = fmt.Sprintf("%s-%d", d.Name, n)
+		}
+		names[name] = true
+		added[i].Name = name
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Path < removed[j].Path })
+	return added, removed
+}
+
+// Close stops watching and waits for a running check to finish
+func (w *Watcher) Close() {
+	close(w.stop)
+	w.wg.Wait()
+}
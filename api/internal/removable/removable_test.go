@@ -0,0 +1,145 @@
+package removable
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStorageName(t *testing.T) {
+	tests := map[string]string{
+		"BACKUP":          "backup",
+		"My Passport 2TB": "my-passport-2tb",
+		"2TB":             "drive-2tb",
+		"USB_Stick (1)":   "usb-stick-1",
+		"Fotos-Ä":         "fotos",
+		"...":             "drive",
+	}
+	for label, want := range tests {
+		if got := StorageName(label); got != want {
+			t.Errorf("StorageName(%q) = %q, want %q", label, got, want)
+		}
+	}
+}
+
+// fakeMounts makes the directories with the given paths mount points
+func fakeMounts(t *testing.T) map[string]bool {
+	mounts := map[string]bool{}
+	var mu sync.Mutex
+	mountPoint = func(path string) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return mounts[path], nil
+	}
+	t.Cleanup(func() { mountPoint = isMountPoint })
+	return mounts
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"usb", "empty", "alice/Backup", "alice/docs", ".hidden"} {
+		os.MkdirAll(filepath.Join(dir, p), 0755)
+	}
+	os.WriteFile(filepath.Join(dir, "file"), nil, 0644)
+	mounts := fakeMounts(t)
+	mounts[filepath.Join(dir, "usb")] = true
+	mounts[filepath.Join(dir, "alice", "Backup")] = true
+	mounts[filepath.Join(dir, ".hidden")] = true
+
+	drives, err := Scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Drive{
+		{Name: "backup", Path: filepath.Join(dir, "alice", "Backup")},
+		{Name: "usb", Path: filepath.Join(dir, "usb")},
+	}
+	if !slices.Equal(drives, want) {
+		t.Errorf("expected %v, got %v", want, drives)
+	}
+}
+
+func TestScanSkipsErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"stale", "usb", "alice/stale", "alice/Backup"} {
+		os.MkdirAll(filepath.Join(dir, p), 0755)
+	}
+	mountPoint = func(path string) (bool, error) {
+		switch filepath.Base(path) {
+		case "stale":
+			return false, &os.PathError{Op: "stat", Path: path, Err: syscall.EIO}
+		case "usb", "Backup":
+			return true, nil
+		}
+		return false, nil
+	}
+	t.Cleanup(func() { mountPoint = isMountPoint })
+
+	drives, err := Scan(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Drive{
+		{Name: "backup", Path: filepath.Join(dir, "alice", "Backup")},
+		{Name: "usb", Path: filepath.Join(dir, "usb")},
+	}
+	if !slices.Equal(drives, want) {
+		t.Errorf("expected %v, got %v", want, drives)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	known := map[string]Drive{
+		"/media/a": {Name: "backup", Path: "/media/a"},
+		"/media/b": {Name: "usb", Path: "/media/b"},
+	}
+	added, removed := diff(known, []Drive{
+		{Name: "backup", Path: "/media/a"},
+		{Name: "backup", Path: "/media/c"},
+		{Name: "usb", Path: "/media/d"},
+	})
+	// The unmounted drive's name is free again
+	if want := []Drive{{Name: "backup-2", Path: "/media/c"}, {Name: "usb", Path: "/media/d"}}; !slices.Equal(added, want) {
+		t.Errorf("expected added %v, got %v", want, added)
+	}
+	if want := []Drive{{Name: "usb", Path: "/media/b"}}; !slices.Equal(removed, want) {
+		t.Errorf("expected removed %v, got %v", want, removed)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "usb"), 0755)
+	mounts := fakeMounts(t)
+	mounts[filepath.Join(dir, "usb")] = true
+
+	type change struct{ added, removed []Drive }
+	changes := make(chan change, 10)
+	w := Watch(dir, 10*time.Millisecond, func(added, removed []Drive) {
+		changes <- change{added, removed}
+	})
+	defer w.Close()
+
+	next := func() change {
+		t.Helper()
+		select {
+		case c := <-changes:
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a change")
+			return change{}
+		}
+	}
+	if c := next(); len(c.added) != 1 || c.added[0].Name != "usb" || len(c.removed) != 0 {
+		t.Errorf("expected the mounted drive to be added, got %+v", c)
+	}
+
+	os.RemoveAll(filepath.Join(dir, "usb"))
+	if c := next(); len(c.added) != 0 || len(c.removed) != 1 || c.removed[0].Name != "usb" {
+		t.Errorf("expected the drive to be removed, got %+v", c)
+	}
+}
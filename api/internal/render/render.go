@@ -0,0 +1,102 @@
+// Package render converts text files to HTML previews.
+//
+// Markdown is rendered with GitHub Flavored Markdown and sanitized, so the
+// result is safe to embed even for untrusted files. Other text files are
+// syntax highlighted with inline styles, so previews don't need a stylesheet.
+package render
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// MaxSize is the largest file that is rendered, as rendering needs the whole
+// file in memory
+const MaxSize = 1 << 20
+
+// ErrUnsupported is returned for files that aren't text
+var ErrUnsupported = errors.New("file type can't be rendered")
+
+// markdownExtensions are the file extensions rendered as Markdown
+var markdownExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".mdown":    true,
+	".mkd":      true,
+}
+
+var (
+	markdown  = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	policy    = markdownPolicy()
+	formatter = chromahtml.New(
+		chromahtml.WithLineNumbers(true),
+		chromahtml.TabWidth(4),
+	)
+	style = styles.Get("github")
+)
+
+// markdownPolicy allows the HTML of user generated content and the
+// checkboxes of task lists
+func markdownPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Render converts a file to an HTML fragment. The name selects how it's
+// rendered, with the MIME type as a fallback for unknown extensions.
+func Render(name, mimeType string, content []byte) ([]byte, error) {
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+		return nil, ErrUnsupported
+	}
+	if markdownExtensions[strings.ToLower(path.Ext(name))] || strings.HasPrefix(mimeType, "text/markdown") {
+		return Markdown(content)
+	}
+	return Source(name, mimeType, content)
+}
+
+// Markdown renders Markdown to sanitized HTML. Raw HTML in the source is
+// dropped.
+func Markdown(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(content, &buf); err != nil {
+		return nil, err
+	}
+	return policy.SanitizeBytes(buf.Bytes()), nil
+}
+
+// Source renders a syntax highlighted source file. Text files in a language
+// that isn't recognized are rendered as plain text.
+func Source(name, mimeType string, content []byte) ([]byte, error) {
+	lexer := lexers.Match(path.Base(name))
+	if lexer == nil {
+		if !strings.HasPrefix(mimeType, "text/") {
+			return nil, ErrUnsupported
+		}
+		lexer = cmp.Or(lexers.MatchMimeType(mimeType), lexers.Fallback)
+	}
+
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, string(content))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, style, tokens); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
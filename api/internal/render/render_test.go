@@ -0,0 +1,108 @@
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		mimeType  string
+		content   string
+		contains  []string
+		excludes  []string
+		wantError error
+	}{
+		{
+			name:     "markdown",
+			file:     "README.md",
+			mimeType: "text/markdown",
+			content:  "# Title\n\n- [x] done\n\n| a | b |\n|---|---|\n| 1 | 2 |\n",
+			contains: []string{"<h1", "Title</h1>", "<table>", "checkbox"},
+		},
+		{
+			name:     "markdown raw html is dropped",
+			file:     "notes.markdown",
+			content:  "hi <script>alert(1)</script>\n\n<img src=x onerror=alert(1)>\n",
+			contains: []string{"hi"},
+			excludes: []string{"<script", "onerror"},
+		},
+		{
+			name:     "markdown dangerous links are removed",
+			file:     "links.md",
+			content:  "[click](javascript:alert(1))\n",
+			contains: []string{"click"},
+			excludes: []string{"javascript:"},
+		},
+		{
+			name:     "source",
+			file:     "src/main.go",
+			mimeType: "text/x-go",
+			content:  "package main\n\nfunc main() {}\n",
+			contains: []string{"<pre", "style=", "package", "main"},
+		},
+		{
+			name:     "source is escaped",
+			file:     "page.html",
+			mimeType: "text/html",
+			content:  "<script>alert(1)</script>\n",
+			contains: []string{"&lt;"},
+			excludes: []string{"<script"},
+		},
+		{
+			name:     "unknown text",
+			file:     "notes.unknown",
+			mimeType: "text/plain",
+			content:  "just <text>\n",
+			contains: []string{"just", "&lt;text&gt;"},
+		},
+		{
+			name:      "unknown binary mime type",
+			file:      "data",
+			mimeType:  "application/octet-stream",
+			content:   "text",
+			wantError: ErrUnsupported,
+		},
+		{
+			name:      "binary content",
+			file:      "main.go",
+			mimeType:  "text/x-go",
+			content:   "package\x00main",
+			wantError: ErrUnsupported,
+		},
+		{
+			name:      "invalid utf-8",
+			file:      "README.md",
+			content:   "caf\xe9",
+			wantError: ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := Render(tt.file, tt.mimeType, []byte(tt.content))
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Fatalf("expected error %v, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(string(html), s) {
+					t.Errorf("expected %q in %s", s, html)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(string(html), s) {
+					t.Errorf("expected no %q in %s", s, html)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Package rsync computes block signatures of files and applies deltas in the
+// formats of librsync, so clients using rdiff or a librsync binding only
+// transfer the blocks of a large file that changed.
+//
+// A client fetches the signature of the file, computes a delta of its new
+// version against it, e.g. with `rdiff delta`, and sends the delta, which is
+// applied to the file as it was when the signature was taken.
+package rsync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Magic numbers starting librsync signatures and deltas
+const (
+	// blake2SigMagic starts signatures with rollsum weak sums and BLAKE2b
+	// strong sums
+	blake2SigMagic = 0x72730137
+	// deltaMagic starts deltas
+	deltaMagic = 0x72730236
+)
+
+// DefaultBlockSize is the block size of signatures if not chosen, the
+// default of rdiff
+const DefaultBlockSize = 2048
+
+// MinBlockSize and MaxBlockSize limit the block size of signatures
+const (
+	MinBlockSize = 256
+	MaxBlockSize = 1 << 20
+)
+
+// strongSumSize is the length of the strong sums of signatures, a full
+// BLAKE2b-256 hash
+const strongSumSize = blake2b.Size256
+
+// ErrInvalidDelta is returned for deltas that aren't in the librsync format
+// or copy from outside of the file they're applied to
+var ErrInvalidDelta = errors.New("invalid delta")
+
+// WriteSignature writes the librsync signature of r to w, with the weak and
+// strong sum of each block of blockSize bytes
+func WriteSignature(w io.Writer, r io.Reader, blockSize int) error {
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return fmt.Errorf("block size must be between %d and %d", MinBlockSize, MaxBlockSize)
+	}
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint32(header[0:], blake2SigMagic)
+	binary.BigEndian.PutUint32(header[4:], uint32(blockSize))
+	binary.BigEndian.PutUint32(header[8:], strongSumSize)
+	bw.Write(header)
+
+	block := make([]byte, blockSize)
+	sum := make([]byte, 4, 4+strongSumSize)
+	for {
+		n, err := io.ReadFull(r, block)
+		if n > 0 {
+			binary.BigEndian.PutUint32(sum, weakSum(block[:n]))
+			strong := blake2b.Sum256(block[:n])
+			if _, err := bw.Write(append(sum, strong[:]...)); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// weakSum returns the rolling checksum of a block, like rsync's but with
+// an offset of 31 added to each byte
+func weakSum(block []byte) uint32 {
+	const charOffset = 31
+	var s1, s2 uint16
+	for _, b := range block {
+		s1 += uint16(b) + charOffset
+		s2 += s1
+	}
+	return uint32(s2)<<16 | uint32(s1)
+}
+
+// Patch writes the result of applying a librsync delta to basis to w.
+// Basis is read where the delta copies from it.
+func Patch(w io.Writer, basis io.ReadSeeker, delta io.Reader) error {
+	r := bufio.NewReader(delta)
+	magic, err := readInt(r, 4)
+	if err != nil {
+		return fmt.Errorf("%w: reading magic: %v", ErrInvalidDelta, err)
+	}
+	if magic != deltaMagic {
+		return fmt.Errorf("%w: unknown magic %#x", ErrInvalidDelta, magic)
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: missing end: %v", ErrInvalidDelta, err)
+		}
+		switch {
+		case op == 0x00:
+			if _, err := r.ReadByte(); err != io.EOF {
+				return fmt.Errorf("%w: data after end", ErrInvalidDelta)
+			}
+			return nil
+		case op <= 0x40:
+			// The length of short literals is the command itself
+			if err := copyLiteral(w, r, uint64(op)); err != nil {
+				return err
+			}
+		case op <= 0x44:
+			length, err := readInt(r, intSize(op-0x41))
+			if err != nil {
+				return fmt.Errorf("%w: reading literal length: %v", ErrInvalidDelta, err)
+			}
+			if err := copyLiteral(w, r, length); err != nil {
+				return err
+			}
+		case op <= 0x54:
+			// Copy commands encode the sizes of the position and the length
+			position, err := readInt(r, intSize((op-0x45)/4))
+			if err != nil {
+				return fmt.Errorf("%w: reading copy position: %v", ErrInvalidDelta, err)
+			}
+			length, err := readInt(r, intSize((op-0x45)%4))
+			if err != nil {
+				return fmt.Errorf("%w: reading copy length: %v", ErrInvalidDelta, err)
+			}
+			if err := copyBasis(w, basis, position, length); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown command %#x", ErrInvalidDelta, op)
+		}
+	}
+}
+
+// intSize returns the size of an integer of a command from its index
+func intSize(index byte) int {
+	return 1 << index
+}
+
+// readInt reads a big-endian unsigned integer of size bytes
+func readInt(r io.Reader, size int) (uint64, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+// copyLiteral copies a literal of the delta to w
+func copyLiteral(w io.Writer, r io.Reader, length uint64) error {
+	if length > 1<<62 {
+		return fmt.Errorf("%w: literal too long", ErrInvalidDelta)
+	}
+	n, err := io.CopyN(w, r, int64(length))
+	if err == io.EOF && uint64(n) < length {
+		return fmt.Errorf("%w: truncated literal", ErrInvalidDelta)
+	}
+	return err
+}
+
+// copyBasis copies a range of the basis to w
+func copyBasis(w io.Writer, basis io.ReadSeeker, position, length uint64) error {
+	if position > 1<<62 || length > 1<<62 {
+		return fmt.Errorf("%w: copy outside of the file", ErrInvalidDelta)
+	}
+	if _, err := basis.Seek(int64(position), io.SeekStart); err != nil {
+		return err
+	}
+	n, err := io.CopyN(w, basis, int64(length))
+	if err == io.EOF && uint64(n) < length {
+		return fmt.Errorf("%w: copy outside of the file", ErrInvalidDelta)
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package rsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// signatureBlock is a block of a parsed signature
+type signatureBlock struct {
+	index  int
+	strong []byte
+}
+
+// delta computes a delta of data against a signature like rdiff, copying
+// matching blocks and sending the rest as literals
+func delta(t *testing.T, signature, data []byte) []byte {
+	t.Helper()
+	if binary.BigEndian.Uint32(signature) != blake2SigMagic {
+		t.Fatalf("unexpected signature magic %x", signature[:4])
+	}
+	blockSize := int(binary.BigEndian.Uint32(signature[4:]))
+	strongSize := int(binary.BigEndian.Uint32(signature[8:]))
+	blocks := map[uint32][]signatureBlock{}
+	for i, rest := 0, signature[12:]; len(rest) > 0; i++ {
+		weak := binary.BigEndian.Uint32(rest)
+		blocks[weak] = append(blocks[weak], signatureBlock{index: i, strong: rest[4 : 4+strongSize]})
+		rest = rest[4+strongSize:]
+	}
+
+	var out, literal bytes.Buffer
+	binary.Write(&out, binary.BigEndian, uint32(deltaMagic))
+	flush := func() {
+		if literal.Len() > 0 {
+			out.WriteByte(0x43)
+			binary.Write(&out, binary.BigEndian, uint32(literal.Len()))
+			out.Write(literal.Bytes())
+			literal.Reset()
+		}
+	}
+	for i := 0; i < len(data); {
+		window := data[i:min(i+blockSize, len(data))]
+		strong := blake2b.Sum256(window)
+		match := -1
+		for _, block := range blocks[weakSum(window)] {
+			if bytes.Equal(block.strong, strong[:strongSize]) {
+				match = block.index
+				break
+			}
+		}
+		if match < 0 {
+			literal.WriteByte(data[i])
+			i++
+			continue
+		}
+		flush()
+		out.WriteByte(0x54)
+		binary.Write(&out, binary.BigEndian, uint64(match*blockSize))
+		binary.Write(&out, binary.BigEndian, uint64(len(window)))
+		i += len(window)
+	}
+	flush()
+	out.WriteByte(0x00)
+	return out.Bytes()
+}
+
+func TestWeakSum(t *testing.T) {
+	// s1 = (97+31) + (98+31) = 257, s2 = 128 + 257 = 385
+	if sum := weakSum([]byte("ab")); sum != 385<<16|257 {
+		t.Errorf("unexpected weak sum %#x", sum)
+	}
+}
+
+func TestSignatureAndPatch(t *testing.T) {
+	basis := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	changed := bytes.Clone(basis)
+	copy(changed[700:], "changed")
+	changed = append([]byte("prefix"), changed...)
+	changed = append(changed, "suffix"...)
+
+	var signature bytes.Buffer
+	if err := WriteSignature(&signature, bytes.NewReader(basis), 256); err != nil {
+		t.Fatal(err)
+	}
+	// 7 blocks, the last one short
+	if want := 12 + 7*(4+strongSumSize); signature.Len() != want {
+		t.Fatalf("expected signature of %d bytes, got %d", want, signature.Len())
+	}
+
+	d := delta(t, signature.Bytes(), changed)
+	if len(d) > len(changed)/2 {
+		t.Errorf("expected unchanged blocks to be copied, got delta of %d bytes", len(d))
+	}
+	var patched bytes.Buffer
+	if err := Patch(&patched, bytes.NewReader(basis), bytes.NewReader(d)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(patched.Bytes(), changed) {
+		t.Errorf("patched content differs from the changed file")
+	}
+
+	if err := WriteSignature(&signature, bytes.NewReader(basis), 16); err == nil {
+		t.Error("expected too small block size to fail")
+	}
+}
+
+func TestPatchCommands(t *testing.T) {
+	basis := "0123456789"
+	magic := "\x72\x73\x02\x36"
+	tests := []struct {
+		name  string
+		delta string
+		want  string
+		err   bool
+	}{
+		{name: "short literal", delta: magic + "\x03abc\x00", want: "abc"},
+		{name: "literal n1", delta: magic + "\x41\x02xy\x00", want: "xy"},
+		{name: "copy n1 n1", delta: magic + "\x45\x02\x03\x00", want: "234"},
+		{name: "copy n2 n4", delta: magic + "\x4b\x00\x07\x00\x00\x00\x03\x00", want: "789"},
+		{name: "mixed", delta: magic + "\x45\x00\x02\x01-\x45\x08\x02\x00", want: "01-89"},
+		{name: "empty", delta: magic + "\x00", want: ""},
+		{name: "bad magic", delta: "\x72\x73\x01\x37\x00", err: true},
+		{name: "missing end", delta: magic + "\x01a", err: true},
+		{name: "truncated literal", delta: magic + "\x05ab", err: true},
+		{name: "copy past end", delta: magic + "\x45\x08\x05\x00", err: true},
+		{name: "unknown command", delta: magic + "\x60\x00", err: true},
+		{name: "data after end", delta: magic + "\x00\x01", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Patch(&out, strings.NewReader(basis), strings.NewReader(tt.delta))
+			if tt.err {
+				if !errors.Is(err, ErrInvalidDelta) {
+					t.Errorf("expected invalid delta, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+// Package scan checks uploaded content for viruses before it is stored.
+//
+// Content is scanned while it streams to the storage. The scanner's verdict
+// is returned in place of the end of the content, so storages that only
+// commit writes at the end, like the atomic writes of local storages, never
+// keep infected files. Content is scanned by clamd over its INSTREAM
+// protocol, or by a command reading it from stdin, e.g. clamdscan.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// clamdChunkSize is the size of the chunks content is sent to clamd in
+const clamdChunkSize = 64 << 10
+
+// maxReplySize limits how much of a scanner's reply is read
+const maxReplySize = 4 << 10
+
+// ErrScanFailed is returned if content couldn't be scanned, e.g. because
+// the scanner is unreachable. Uploads are rejected, as they may be infected.
+var ErrScanFailed = errors.New("virus scan failed")
+
+// InfectedError is returned for content a scanner found a virus in
+type InfectedError struct {
+	// Signature names the virus, e.g. "Eicar-Test-Signature"
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return "infected with " + e.Signature
+}
+
+// Scanner scans content for viruses
+type Scanner interface {
+	// Scan reads r until EOF and returns an *InfectedError if it's
+	// infected, or another error if it couldn't be scanned
+	Scan(ctx context.Context, r io.Reader) error
+}
+
+// Clamd scans content with clamd over a TCP or Unix socket
+type Clamd struct {
+	network string
+	address string
+}
+
+// NewClamd creates a scanner for the clamd at an address, either a path of a
+// Unix socket like /run/clamav/clamd.ctl or a TCP host:port like
+// localhost:3310
+func NewClamd(address string) *Clamd {
+	if strings.HasPrefix(address, "/") {
+		return &Clamd{network: "unix", address: address}
+	}
+	return &Clamd{network: "tcp", address: address}
+}
+
+// Scan implements Scanner
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := c.send(conn, r); err != nil {
+		var contentErr *contentError
+		if errors.As(err, &contentErr) {
+			return contentErr.err
+		}
+		// clamd hangs up on content over its StreamMaxLength and tells why
+		if reply, replyErr := readReply(conn); replyErr == nil && reply != "" {
+			return parseReply(reply)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("unable to send content to clamd: %w", err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return fmt.Errorf("unable to read clamd reply: %w", err)
+	}
+	return parseReply(reply)
+}
+
+// send streams content as length-prefixed chunks, ended by an empty chunk
+func (c *Clamd) send(conn net.Conn, r io.Reader) error {
+	w := bufio.NewWriterSize(conn, clamdChunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, clamdChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := binary.Write(w, binary.BigEndian, uint32(n)); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return &contentError{err}
+		}
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(0)); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// contentError is an error reading the content to scan, rather than one of
+// the connection to clamd
+type contentError struct {
+	err error
+}
+
+func (e *contentError) Error() string {
+	return e.err.Error()
+}
+
+// readReply reads a null terminated reply of clamd
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(io.LimitReader(conn, maxReplySize)).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", err
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parseReply parses replies like "stream: OK" or
+// "stream: Eicar-Test-Signature FOUND"
+func parseReply(reply string) error {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &InfectedError{Signature: strings.TrimSuffix(result, " FOUND")}
+	default:
+		return fmt.Errorf("clamd: %s", strings.TrimSuffix(result, " ERROR"))
+	}
+}
+
+// Command scans content with a command reading it from stdin. Like
+// clamdscan, it exits with 0 for clean and 1 for infected content, and its
+// output names the virus.
+type Command struct {
+	name string
+	args []string
+}
+
+// NewCommand creates a scanner running a command line split on spaces, e.g.
+// "clamdscan --no-summary -"
+func NewCommand(command string) *Command {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return &Command{}
+	}
+	return &Command{name: fields[0], args: fields[1:]}
+}
+
+// Scan implements Scanner
+func (c *Command) Scan(ctx context.Context, r io.Reader) error {
+	if c.name == "" {
+		return errors.New("no scan command")
+	}
+	var output limitedBuffer
+	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd.Stdin = r
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return &InfectedError{Signature: commandSignature(output.String())}
+	}
+	if err != nil {
+		if message := strings.TrimSpace(output.String()); message != "" {
+			return fmt.Errorf("%s: %w: %s", c.name, err, message)
+		}
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+	return nil
+}
+
+// commandSignature finds the virus name in the output of a scan command,
+// e.g. "stdin: Eicar-Test-Signature FOUND", or uses the first line
+func commandSignature(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines {
+		if name, ok := strings.CutSuffix(strings.TrimSpace(line), " FOUND"); ok {
+			if _, after, ok := strings.Cut(name, ": "); ok {
+				return after
+			}
+			return name
+		}
+	}
+	if lines[0] != "" {
+		return strings.TrimSpace(lines[0])
+	}
+	return "unknown virus"
+}
+
+// limitedBuffer keeps the first maxReplySize bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxReplySize - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// Reader passes content through while a scanner reads it. At the end of the
+// content it waits for the verdict and returns the scanner's error instead
+// of io.EOF, wrapped in ErrScanFailed unless the content is infected.
+type Reader struct {
+	r       io.Reader
+	pw      *io.PipeWriter
+	verdict chan error
+	err     error
+}
+
+// NewReader starts scanning content read through the returned Reader. It
+// must be closed, to stop the scan if the content isn't read to the end.
+func NewReader(ctx context.Context, scanner Scanner, r io.Reader) *Reader {
+	pr, pw := io.Pipe()
+	sr := &Reader{r: r, pw: pw, verdict: make(chan error, 1)}
+	go func() {
+		err := scanner.Scan(ctx, pr)
+		// Unblocks writes if the scanner stopped early
+		pr.CloseWithError(errScannerStopped)
+		sr.verdict <- err
+	}()
+	return sr
+}
+
+// errScannerStopped is returned by writes after the scanner returned
+var errScannerStopped = errors.New("scanner stopped before the end of the content")
+
+// Read implements io.Reader
+func (sr *Reader) Read(p []byte) (int, error) {
+	if sr.err != nil {
+		return 0, sr.err
+	}
+	n, err := sr.r.Read(p)
+	if n > 0 {
+		if _, werr := sr.pw.Write(p[:n]); werr != nil {
+			// Content the scanner hasn't seen must not pass
+			verdict := <-sr.verdict
+			if verdict == nil {
+				verdict = errScannerStopped
+			}
+			sr.err = failure(verdict)
+			return 0, sr.err
+		}
+	}
+	switch {
+	case err == io.EOF:
+		sr.pw.Close()
+		if verdict := <-sr.verdict; verdict != nil {
+			sr.err = failure(verdict)
+		} else {
+			sr.err = io.EOF
+		}
+		return n, sr.err
+	case err != nil:
+		sr.err = err
+		sr.pw.CloseWithError(err)
+	}
+	return n, err
+}
+
+// Close stops the scan if the content wasn't read to the end
+func (sr *Reader) Close() error {
+	sr.pw.CloseWithError(errors.New("content not read to the end"))
+	return nil
+}
+
+// failure wraps errors of scanners in ErrScanFailed, except for infections
+func failure(err error) error {
+	var infected *InfectedError
+	if errors.As(err, &infected) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrScanFailed, err)
+}
@@ -0,0 +1,201 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// eicar is the standard antivirus test string
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers INSTREAM requests like clamd, finding eicar and
+// rejecting streams over maxLength
+func fakeClamd(t *testing.T, maxLength int) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if command, err := r.ReadString(0); err != nil || command != "zINSTREAM\x00" {
+					return
+				}
+				var content bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if content.Len()+int(size) > maxLength {
+						conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+						return
+					}
+					io.CopyN(&content, r, int64(size))
+				}
+				if strings.Contains(content.String(), "EICAR") {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamd(t *testing.T) {
+	clamd := NewClamd(fakeClamd(t, 1<<20))
+
+	tests := []struct {
+		name      string
+		content   string
+		signature string
+		wantErr   bool
+	}{
+		{"clean", "hello", "", false},
+		{"empty", "", "", false},
+		{"large", strings.Repeat("a", 3*clamdChunkSize+5), "", false},
+		{"infected", eicar, "Eicar-Test-Signature", true},
+		{"too large", strings.Repeat("a", 2<<20), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := clamd.Scan(context.Background(), strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			var infected *InfectedError
+			if errors.As(err, &infected) != (tt.signature != "") {
+				t.Fatalf("expected infected %v, got %v", tt.signature != "", err)
+			}
+			if infected != nil && infected.Signature != tt.signature {
+				t.Errorf("expected signature %q, got %q", tt.signature, infected.Signature)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		address := ln.Addr().String()
+		ln.Close()
+		if err := NewClamd(address).Scan(context.Background(), strings.NewReader("hello")); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test script needs a shell")
+	}
+	script := filepath.Join(t.TempDir(), "scan.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\nif grep -q EICAR; then echo 'stdin: Eicar-Test-Signature FOUND'; exit 1; fi\n"), 0755)
+
+	command := NewCommand(script)
+	if err := command.Scan(context.Background(), strings.NewReader("hello")); err != nil {
+		t.Errorf("expected clean content, got %v", err)
+	}
+	err := command.Scan(context.Background(), strings.NewReader(eicar))
+	var infected *InfectedError
+	if !errors.As(err, &infected) || infected.Signature != "Eicar-Test-Signature" {
+		t.Errorf("expected infection, got %v", err)
+	}
+	if err := NewCommand("/nonexistent/scanner").Scan(context.Background(), strings.NewReader("hello")); err == nil || errors.As(err, &infected) {
+		t.Errorf("expected failure, got %v", err)
+	}
+}
+
+// scannerFunc adapts a function to a Scanner
+type scannerFunc func(ctx context.Context, r io.Reader) error
+
+func (f scannerFunc) Scan(ctx context.Context, r io.Reader) error {
+	return f(ctx, r)
+}
+
+func TestReader(t *testing.T) {
+	findEicar := scannerFunc(func(ctx context.Context, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(content, []byte("EICAR")) {
+			return &InfectedError{Signature: "Eicar-Test-Signature"}
+		}
+		return nil
+	})
+	unreachable := scannerFunc(func(ctx context.Context, r io.Reader) error {
+		return errors.New("connection refused")
+	})
+	stopsEarly := scannerFunc(func(ctx context.Context, r io.Reader) error {
+		_, err := r.Read(make([]byte, 10))
+		return err
+	})
+
+	tests := []struct {
+		name     string
+		scanner  Scanner
+		content  string
+		infected bool
+		failed   bool
+	}{
+		{"clean", findEicar, strings.Repeat("clean ", 100000), false, false},
+		{"infected", findEicar, eicar, true, false},
+		{"scan failed", unreachable, "hello", false, true},
+		{"scanner stopped early", stopsEarly, strings.Repeat("a", 1000), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := NewReader(context.Background(), tt.scanner, strings.NewReader(tt.content))
+			defer sr.Close()
+			content, err := io.ReadAll(sr)
+
+			var infected *InfectedError
+			if errors.As(err, &infected) != tt.infected {
+				t.Errorf("expected infected %v, got %v", tt.infected, err)
+			}
+			if errors.Is(err, ErrScanFailed) != tt.failed {
+				t.Errorf("expected failed %v, got %v", tt.failed, err)
+			}
+			if !tt.infected && !tt.failed && string(content) != tt.content {
+				t.Errorf("expected content to pass through unchanged")
+			}
+		})
+	}
+
+	t.Run("not read to the end", func(t *testing.T) {
+		done := make(chan error, 1)
+		scanner := scannerFunc(func(ctx context.Context, r io.Reader) error {
+			_, err := io.ReadAll(r)
+			done <- err
+			return err
+		})
+		sr := NewReader(context.Background(), scanner, strings.NewReader("hello world"))
+		sr.Read(make([]byte, 5))
+		sr.Close()
+		if err := <-done; err == nil {
+			t.Error("expected scan to be stopped")
+		}
+	})
+}
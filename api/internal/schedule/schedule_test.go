@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * * funday",
+		"@yearly",
+	}
+	for _, expr := range invalid {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := Parse(expr); err == nil {
+				t.Errorf("expected error for %q", expr)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Saturday
+	from := time.Date(2025, 11, 8, 14, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, 11, 8, 14, 31, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2025, 11, 9, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 11, 9, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 11, 8, 15, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2025, 11, 8, 14, 40, 0, 0, time.UTC)},
+		{"15,45 14 * * *", time.Date(2025, 11, 8, 14, 45, 0, 0, time.UTC)},
+		{"0 22-23,0-5/2 * * *", time.Date(2025, 11, 8, 22, 0, 0, 0, time.UTC)},
+		{"0 2 * * mon-fri", time.Date(2025, 11, 10, 2, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 11, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Either day field may match if both are restricted
+		{"0 0 20 * mon", time.Date(2025, 11, 10, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if got := s.Next(from); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package state opens the SQLite databases keeping the state of the server,
+// like issued tokens, tags and the activity feed, and migrates their schemas.
+//
+// Each store owns some tables and a list of migrations creating and changing
+// them. The migrations applied so far are recorded per store in the
+// migrations table, so stores can share one database file and each only
+// runs the migrations it hasn't run yet when it's opened.
+package state
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// pragmas are set on all connections. The write-ahead log lets readers
+// and a writer work concurrently, also from several stores of the same file.
+const pragmas = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+
+// Options configure opening a database
+type Options struct {
+	// Synchronous is the synchronous pragma, e.g. NORMAL for caches that
+	// can be rebuilt, defaults to FULL
+	Synchronous string
+}
+
+// Open opens or creates the database at the given path and applies the
+// migrations of a store that weren't applied yet. Migrations are SQL
+// statements applied in order, and must never change once released, only
+// new ones appended.
+func Open(path, store string, migrations []string, opts Options) (*sql.DB, error) {
+	dsn := "file:" + path + "?" + pragmas
+	if opts.Synchronous != "" {
+		dsn += "&_pragma=synchronous(" + opts.Synchronous + ")"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(context.Background(), db, store, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrate applies the migrations of a store after the version recorded in
+// the migrations table, all in one transaction
+func migrate(ctx context.Context, db *sql.DB, store string, migrations []string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Take the write lock right away, so processes opening the database at
+	// the same time don't both apply the same migrations
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(ctx, "ROLLBACK")
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (
+		store      TEXT NOT NULL PRIMARY KEY,
+		version    INTEGER NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	var version int
+	err = conn.QueryRowContext(ctx, `SELECT version FROM migrations WHERE store = ?`, store).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%s schema version %d is newer than this version of timeship supports (%d)", store, version, len(migrations))
+	}
+	if version == len(migrations) {
+		return nil
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if _, err := conn.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migrating %s to version %d: %w", store, i+1, err)
+		}
+	}
+	_, err = conn.ExecContext(ctx, `INSERT INTO migrations (store, version, applied_at) VALUES (?, ?, ?)
+		ON CONFLICT (store) DO UPDATE SET version = excluded.version, applied_at = excluded.applied_at`,
+		store, len(migrations), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,77 @@
+package state
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	v1 := []string{`CREATE TABLE notes (id INTEGER PRIMARY KEY, text TEXT NOT NULL)`}
+	v2 := append(v1, `ALTER TABLE notes ADD COLUMN owner TEXT NOT NULL DEFAULT ''`)
+
+	db, err := Open(path, "notes", v1, Options{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO notes (text) VALUES ('hello')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	t.Run("applied migrations are skipped", func(t *testing.T) {
+		db, err := Open(path, "notes", v1, Options{})
+		if err != nil {
+			t.Fatalf("expected reopening to skip the migration, got %v", err)
+		}
+		db.Close()
+	})
+
+	t.Run("new migrations are applied", func(t *testing.T) {
+		db, err := Open(path, "notes", v2, Options{Synchronous: "NORMAL"})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer db.Close()
+		var text, owner string
+		if err := db.QueryRow(`SELECT text, owner FROM notes`).Scan(&text, &owner); err != nil || text != "hello" {
+			t.Errorf("expected existing row with the new column, got %q, %v", text, err)
+		}
+	})
+
+	t.Run("stores share the file", func(t *testing.T) {
+		db, err := Open(path, "other", []string{`CREATE TABLE other (id INTEGER PRIMARY KEY)`}, Options{})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer db.Close()
+		var version int
+		if err := db.QueryRow(`SELECT version FROM migrations WHERE store = 'notes'`).Scan(&version); err != nil || version != 2 {
+			t.Errorf("expected notes to stay at version 2, got %d, %v", version, err)
+		}
+	})
+
+	t.Run("newer schema fails", func(t *testing.T) {
+		if _, err := Open(path, "notes", v1, Options{}); err == nil || !strings.Contains(err.Error(), "newer") {
+			t.Errorf("expected newer schema to fail, got %v", err)
+		}
+	})
+
+	t.Run("failed migration is rolled back", func(t *testing.T) {
+		broken := append(v2[:2:2], `CREATE TABLE broken (id INTEGER)`, `INVALID SQL`)
+		if _, err := Open(path, "notes", broken, Options{}); err == nil {
+			t.Fatal("expected invalid migration to fail")
+		}
+		db, err := Open(path, "notes", v2, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'broken'`).Scan(&count)
+		if count != 0 {
+			t.Error("expected the migrations before the failed one to be rolled back")
+		}
+	})
+}
@@ -0,0 +1,517 @@
+// Package azure provides read-only storages for Azure Blob Storage containers.
+//
+// Blobs are listed as a directory tree using "/" as the separator. Blob
+// snapshots and versions are exposed as snapshots of each blob, with IDs of
+// the form "azure:snapshot=<time>" or "azure:versionid=<id>".
+//
+// # Authentication
+//
+// Requests are authorized with a SAS token if configured, otherwise with a
+// token of the managed identity of the Azure host the server runs on.
+package azure
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// apiVersion is the Blob service REST API version, versions require 2019-12-12+
+const apiVersion = "2021-08-06"
+
+// defaultStorageName is the storage name used when none is configured
+const defaultStorageName = "azure"
+
+// imdsTokenURL is the Azure instance metadata endpoint for managed identity tokens
+const imdsTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token?api-version=2018-02-01&resource=https%3A%2F%2Fstorage.azure.com%2F"
+
+// Config holds configuration for the Azure Blob storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths, defaults to "azure"
+	Name string
+
+	// Account is the storage account name
+	Account string
+
+	// Container is the blob container name
+	Container string
+
+	// SASToken authorizes requests, e.g. "sv=2021-08-06&ss=b&sig=...".
+	// If empty, the managed identity of the host is used.
+	SASToken string
+
+	// Endpoint overrides the blob service URL, e.g. for Azurite or sovereign
+	// clouds. Defaults to https://<account>.blob.core.windows.net
+	Endpoint string
+
+	// Client is the HTTP client used for requests, defaults to a client with
+	// a timeout
+	Client *http.Client
+
+	// TokenURL overrides the managed identity token endpoint, for testing
+	TokenURL string
+}
+
+// Storage implements read-only storage interfaces for an Azure Blob container
+type Storage struct {
+	name      string
+	container string
+	endpoint  string
+	sasToken  url.Values
+	client    *http.Client
+	tokenURL  string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// New creates a new Azure Blob storage
+func New(config Config) (*Storage, error) {
+	if config.Container == "" {
+		return nil, errors.New("container is required")
+	}
+	if config.Account == "" && config.Endpoint == "" {
+		return nil, errors.New("account or endpoint is required")
+	}
+
+	name := config.Name
+	if name == "" {
+		name = defaultStorageName
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", config.Account)
+	}
+
+	sasToken, err := url.ParseQuery(strings.TrimPrefix(config.SASToken, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAS token: %w", err)
+	}
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	tokenURL := config.TokenURL
+	if tokenURL == "" {
+		tokenURL = imdsTokenURL
+	}
+
+	return &Storage{
+		name:      name,
+		container: config.Container,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		sasToken:  sasToken,
+		client:    client,
+		tokenURL:  tokenURL,
+	}, nil
+}
+
+// blobName returns the blob name of a path
+func blobName(vfPath url.URL) string {
+	return strings.Trim(vfPath.Path, "/")
+}
+
+// snapshotQuery returns the query selecting the snapshot or version of a
+// path, or nil for the current version
+func snapshotQuery(vfPath url.URL) (url.Values, error) {
+	snapshotID := vfPath.Query().Get("snapshot")
+	if snapshotID == "" {
+		return nil, nil
+	}
+	raw, ok := strings.CutPrefix(snapshotID, "azure:")
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid snapshot ID format: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
+	query, err := url.ParseQuery(raw)
+	if err != nil || len(query) != 1 || (query.Get("snapshot") == "" && query.Get("versionid") == "") {
+		return nil, fmt.Errorf("%w: invalid snapshot ID format: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
+	return query, nil
+}
+
+// do sends an authorized request to the container or a blob in it
+func (s *Storage) do(method string, blob string, query url.Values) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint + "/" + url.PathEscape(s.container))
+	if err != nil {
+		return nil, err
+	}
+	if blob != "" {
+		u = u.JoinPath(strings.Split(blob, "/")...)
+	}
+
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	for k, v := range s.sasToken {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+
+	if len(s.sasToken) == 0 {
+		token, err := s.managedIdentityToken()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, statusError(method, blob, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// statusError maps an HTTP error status to an error
+func statusError(method string, blob string, status int) error {
+	var err error
+	switch status {
+	case http.StatusNotFound:
+		err = fs.ErrNotExist
+	case http.StatusForbidden, http.StatusUnauthorized:
+		err = fs.ErrPermission
+	default:
+		err = fmt.Errorf("unexpected status %d", status)
+	}
+	return &fs.PathError{Op: strings.ToLower(method), Path: blob, Err: err}
+}
+
+// managedIdentityToken returns a cached or new token of the host managed identity
+func (s *Storage) managedIdentityToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to get managed identity token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get managed identity token: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid managed identity token: %w", err)
+	}
+
+	expiresIn, _ := strconv.Atoi(token.ExpiresIn)
+	s.token = token.AccessToken
+	// Refresh a minute early to avoid using a token as it expires
+	s.tokenExpiry = time.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// blobItem is a blob in a list blobs response
+type blobItem struct {
+	Name             string `xml:"Name"`
+	Snapshot         string `xml:"Snapshot"`
+	VersionID        string `xml:"VersionId"`
+	IsCurrentVersion bool   `xml:"IsCurrentVersion"`
+	Properties       struct {
+		LastModified  string `xml:"Last-Modified"`
+		ContentLength int64  `xml:"Content-Length"`
+		ContentType   string `xml:"Content-Type"`
+	} `xml:"Properties"`
+}
+
+// listResult is a page of a list blobs response
+type listResult struct {
+	Blobs struct {
+		Blobs    []blobItem `xml:"Blob"`
+		Prefixes []struct {
+			Name string `xml:"Name"`
+		} `xml:"BlobPrefix"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// listPage lists a page of the blobs matching the query, starting at the marker
+func (s *Storage) listPage(query url.Values, marker string) (*listResult, error) {
+	q := url.Values{"restype": {"container"}, "comp": {"list"}}
+	for k, v := range query {
+		q[k] = v
+	}
+	if marker != "" {
+		q.Set("marker", marker)
+	}
+
+	resp, err := s.do(http.MethodGet, "", q)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid list response: %w", err)
+	}
+	return &result, nil
+}
+
+// list lists the blobs matching the query, following continuation markers
+func (s *Storage) list(query url.Values, fn func(*listResult)) error {
+	marker := ""
+	for {
+		result, err := s.listPage(query, marker)
+		if err != nil {
+			return err
+		}
+
+		fn(result)
+
+		if result.NextMarker == "" {
+			return nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// parseTime parses a Last-Modified header value, returning 0 if invalid
+func parseTime(value string) int64 {
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// ListContents implements storage.Lister
+// Lists the current blobs and virtual directories under the path
+func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
+	if vfPath.Query().Get("snapshot") != "" {
+		return nil, fmt.Errorf("listing directories at a snapshot: %w", storage.ErrNotSupported)
+	}
+
+	prefix := blobName(vfPath)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	nodes := []storage.FileNode{}
+	err := s.list(url.Values{"prefix": {prefix}, "delimiter": {"/"}}, func(result *listResult) {
+		for _, p := range result.Blobs.Prefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Name, prefix), "/")
+			nodes = append(nodes, storage.FileNode{
+				Path:     url.URL{Scheme: s.name, Path: strings.TrimSuffix(p.Name, "/")},
+				Type:     "dir",
+				Basename: name,
+				Mode:     fs.ModeDir | 0555,
+			})
+		}
+		for _, b := range result.Blobs.Blobs {
+			name := strings.TrimPrefix(b.Name, prefix)
+			nodes = append(nodes, storage.FileNode{
+				Path:         url.URL{Scheme: s.name, Path: b.Name},
+				Type:         "file",
+				Basename:     name,
+				Extension:    strings.TrimPrefix(path.Ext(name), "."),
+				Size:         b.Properties.ContentLength,
+				LastModified: parseTime(b.Properties.LastModified),
+				MimeType:     b.Properties.ContentType,
+				Mode:         0444,
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The container root always exists, other prefixes only if they have blobs
+	if len(nodes) == 0 && prefix != "" {
+		return nil, &fs.PathError{Op: "list", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+	return nodes, nil
+}
+
+// head returns the properties of a blob
+func (s *Storage) head(vfPath url.URL) (http.Header, error) {
+	query, err := snapshotQuery(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	name := blobName(vfPath)
+	if name == "" {
+		return nil, &fs.PathError{Op: "head", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+	resp, err := s.do(http.MethodHead, name, query)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header, nil
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
+	query, err := snapshotQuery(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodGet, blobName(vfPath), query)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(vfPath url.URL) (int64, error) {
+	header, err := s.head(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(vfPath url.URL) (string, error) {
+	header, err := s.head(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("Content-Type"), nil
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
+	header, err := s.head(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return parseTime(header.Get("Last-Modified")), nil
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(vfPath url.URL) (bool, error) {
+	_, err := s.head(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DirectoryExists implements storage.Existence
+// Directories are virtual and exist if any blob has the path as prefix
+func (s *Storage) DirectoryExists(vfPath url.URL) (bool, error) {
+	prefix := blobName(vfPath)
+	if prefix == "" {
+		return true, nil
+	}
+	result, err := s.listPage(url.Values{"prefix": {prefix + "/"}, "maxresults": {"1"}}, "")
+	if err != nil {
+		return false, err
+	}
+	return len(result.Blobs.Blobs) > 0, nil
+}
+
+// CheckHealth implements storage.HealthChecker
+// Lists a single blob to check the container is reachable and authorized
+func (s *Storage) CheckHealth() error {
+	_, err := s.listPage(url.Values{"maxresults": {"1"}}, "")
+	return err
+}
+
+// ListSnapshots implements storage.SnapshotLister
+// Returns the snapshots and previous versions of a blob, newest first.
+// Directories have no snapshots.
+func (s *Storage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
+	name := blobName(vfPath)
+	snapshots := []storage.Snapshot{}
+	if name == "" {
+		return snapshots, nil
+	}
+
+	query := url.Values{"prefix": {name}, "include": {"snapshots,versions"}}
+	err := s.list(query, func(result *listResult) {
+		for _, b := range result.Blobs.Blobs {
+			if b.Name != name {
+				continue
+			}
+			snap, ok := s.toSnapshot(b)
+			if ok {
+				snapshots = append(snapshots, snap)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp > snapshots[j].Timestamp
+	})
+	return snapshots, nil
+}
+
+// toSnapshot converts a blob snapshot or previous version to a storage.Snapshot
+func (s *Storage) toSnapshot(b blobItem) (storage.Snapshot, bool) {
+	var key, value string
+	switch {
+	case b.Snapshot != "":
+		key, value = "snapshot", b.Snapshot
+	case b.VersionID != "" && !b.IsCurrentVersion:
+		key, value = "versionid", b.VersionID
+	default:
+		// The current version is the live blob
+		return storage.Snapshot{}, false
+	}
+
+	// Snapshot times and version IDs are both RFC 3339 timestamps
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return storage.Snapshot{}, false
+	}
+
+	return storage.Snapshot{
+		ID:        "azure:" + url.Values{key: {value}}.Encode(),
+		Type:      "azure",
+		Timestamp: t.Unix(),
+		Name:      value,
+		Size:      b.Properties.ContentLength,
+		Metadata: storage.SnapshotMetadata{
+			"kind": key,
+			"time": t.Format(time.RFC3339),
+		},
+	}, true
+}
@@ -0,0 +1,251 @@
+package azure
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeBlobService serves a container with a few blobs, a snapshot and a version
+func fakeBlobService(t *testing.T) *httptest.Server {
+	t.Helper()
+	blobs := map[string]string{
+		"readme.txt":       "current",
+		"docs/report.pdf":  "%PDF",
+		"docs/2025/q1.txt": "q1",
+		"readme.txt?snapshot=2025-11-08T10:00:00.0000000Z":  "snapshot",
+		"readme.txt?versionid=2025-11-07T09:00:00.0000000Z": "version",
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sig") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("x-ms-version") == "" {
+			t.Error("missing x-ms-version header")
+		}
+
+		q := r.URL.Query()
+		if q.Get("comp") == "list" {
+			w.Header().Set("Content-Type", "application/xml")
+			switch {
+			case q.Get("include") == "snapshots,versions":
+				io.WriteString(w, `<EnumerationResults><Blobs>
+<Blob><Name>readme.txt</Name><Snapshot>2025-11-08T10:00:00.0000000Z</Snapshot><Properties><Content-Length>8</Content-Length></Properties></Blob>
+<Blob><Name>readme.txt</Name><VersionId>2025-11-07T09:00:00.0000000Z</VersionId><Properties><Content-Length>7</Content-Length></Properties></Blob>
+<Blob><Name>readme.txt</Name><VersionId>2025-11-09T09:00:00.0000000Z</VersionId><IsCurrentVersion>true</IsCurrentVersion><Properties><Content-Length>7</Content-Length></Properties></Blob>
+<Blob><Name>readme.txt.bak</Name><Properties><Content-Length>1</Content-Length></Properties></Blob>
+</Blobs></EnumerationResults>`)
+			case q.Get("prefix") == "" && q.Get("marker") == "":
+				// First page of the root, continued with a marker
+				io.WriteString(w, `<EnumerationResults><Blobs>
+<BlobPrefix><Name>docs/</Name></BlobPrefix>
+</Blobs><NextMarker>page2</NextMarker></EnumerationResults>`)
+			case q.Get("prefix") == "":
+				io.WriteString(w, `<EnumerationResults><Blobs>
+<Blob><Name>readme.txt</Name><Properties><Last-Modified>Sun, 09 Nov 2025 09:00:00 GMT</Last-Modified><Content-Length>7</Content-Length><Content-Type>text/plain</Content-Type></Properties></Blob>
+</Blobs><NextMarker /></EnumerationResults>`)
+			case q.Get("prefix") == "docs/":
+				io.WriteString(w, `<EnumerationResults><Blobs>
+<Blob><Name>docs/report.pdf</Name><Properties><Content-Length>4</Content-Length></Properties></Blob>
+<BlobPrefix><Name>docs/2025/</Name></BlobPrefix>
+</Blobs></EnumerationResults>`)
+			default:
+				io.WriteString(w, `<EnumerationResults><Blobs></Blobs></EnumerationResults>`)
+			}
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/container/")
+		key := name
+		if v := q.Get("snapshot"); v != "" {
+			key += "?snapshot=" + v
+		}
+		if v := q.Get("versionid"); v != "" {
+			key += "?versionid=" + v
+		}
+		content, ok := blobs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", "Sun, 09 Nov 2025 09:00:00 GMT")
+		io.WriteString(w, content)
+	}))
+}
+
+func newTestStorage(t *testing.T, server *httptest.Server) *Storage {
+	t.Helper()
+	s, err := New(Config{
+		Container: "container",
+		Endpoint:  server.URL,
+		SASToken:  "?sv=2021-08-06&sig=secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func blobPath(p string, snapshot string) url.URL {
+	u := url.URL{Scheme: "azure", Path: p}
+	if snapshot != "" {
+		u.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	return u
+}
+
+func TestListContents(t *testing.T) {
+	server := fakeBlobService(t)
+	defer server.Close()
+	s := newTestStorage(t, server)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected []string
+		wantErr  error
+	}{
+		{"root with continuation", "", []string{"dir:docs", "file:readme.txt"}, nil},
+		{"subdirectory", "docs", []string{"dir:2025", "file:report.pdf"}, nil},
+		{"missing", "nope", nil, fs.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := s.ListContents(blobPath(tt.path, ""))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, node := range nodes {
+				got = append(got, node.Type+":"+node.Basename)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	server := fakeBlobService(t)
+	defer server.Close()
+	s := newTestStorage(t, server)
+
+	snapshots, err := s.ListSnapshots(blobPath("readme.txt", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected snapshot and previous version, got %+v", snapshots)
+	}
+	if snapshots[0].Metadata["kind"] != "snapshot" || snapshots[1].Metadata["kind"] != "versionid" {
+		t.Errorf("expected newest first, got %+v", snapshots)
+	}
+
+	for i, expected := range []string{"snapshot", "version"} {
+		r, err := s.ReadStream(blobPath("readme.txt", snapshots[i].ID))
+		if err != nil {
+			t.Fatalf("ReadStream %s failed: %v", snapshots[i].ID, err)
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+		if string(content) != expected {
+			t.Errorf("expected %q, got %q", expected, content)
+		}
+	}
+
+	if _, err := s.ReadStream(blobPath("readme.txt", "zfs:daily")); err == nil {
+		t.Error("expected error for foreign snapshot ID")
+	}
+}
+
+func TestRead(t *testing.T) {
+	server := fakeBlobService(t)
+	defer server.Close()
+	s := newTestStorage(t, server)
+
+	size, err := s.FileSize(blobPath("readme.txt", ""))
+	if err != nil || size != 7 {
+		t.Errorf("expected size 7, got %d %v", size, err)
+	}
+
+	mimeType, err := s.MimeType(blobPath("readme.txt", ""))
+	if err != nil || mimeType != "text/plain" {
+		t.Errorf("expected text/plain, got %q %v", mimeType, err)
+	}
+
+	exists, err := s.FileExists(blobPath("missing.txt", ""))
+	if err != nil || exists {
+		t.Errorf("expected missing file not to exist, got %v %v", exists, err)
+	}
+
+	exists, err = s.DirectoryExists(blobPath("docs", ""))
+	if err != nil || !exists {
+		t.Errorf("expected docs to exist, got %v %v", exists, err)
+	}
+}
+
+func TestManagedIdentity(t *testing.T) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			if r.Header.Get("Metadata") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, `{"access_token":"token123","expires_in":"3600"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	defer server.Close()
+
+	s, err := New(Config{Container: "container", Endpoint: server.URL, TokenURL: server.URL + "/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		r, err := s.ReadStream(blobPath("file.txt", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+	if tokenRequests != 1 {
+		t.Errorf("expected token to be cached, got %d token requests", tokenRequests)
+	}
+}
+
+func TestPermissionDenied(t *testing.T) {
+	server := fakeBlobService(t)
+	defer server.Close()
+
+	s, err := New(Config{Container: "container", Endpoint: server.URL, SASToken: "sig=wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadStream(blobPath("readme.txt", "")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package azure
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("azure", func(sc config.StorageConfig) (storage.Storage, error) {
+		return New(Config{
+			Name:      sc.Name,
+			Account:   sc.Account,
+			Container: sc.Container,
+			SASToken:  sc.SASToken,
+			Endpoint:  sc.Endpoint,
+		})
+	})
+}
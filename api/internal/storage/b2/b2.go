@@ -0,0 +1,605 @@
+// Package b2 provides read-only storages for Backblaze B2 buckets using the
+// native B2 API.
+//
+// Files are listed as a directory tree using "/" as the separator. Older file
+// versions are exposed as snapshots of each file, with IDs of the form
+// "b2:<file id>". Hiding a file in B2 adds a "hide" marker version instead of
+// removing data. Hide markers are listed as snapshots too, with metadata
+// marking them as deletions, and have no content.
+package b2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// defaultStorageName is the storage name used when none is configured
+const defaultStorageName = "b2"
+
+// defaultEndpoint is the B2 API endpoint used to authorize the account
+const defaultEndpoint = "https://api.backblazeb2.com"
+
+// Config holds configuration for the Backblaze B2 storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths, defaults to "b2"
+	Name string
+
+	// Bucket is the bucket name
+	Bucket string
+
+	// KeyID is the application key ID
+	KeyID string
+
+	// ApplicationKey is the application key, which needs the listBuckets,
+	// listFiles and readFiles capabilities
+	ApplicationKey string
+
+	// Endpoint overrides the API URL used to authorize the account, for testing
+	Endpoint string
+
+	// Client is the HTTP client used for requests, defaults to a client with
+	// a timeout
+	Client *http.Client
+}
+
+// Storage implements read-only storage interfaces for a B2 bucket
+type Storage struct {
+	name           string
+	bucket         string
+	keyID          string
+	applicationKey string
+	endpoint       string
+	client         *http.Client
+
+	// mu guards the authorization, which is renewed when it expires
+	mu   sync.Mutex
+	auth *authorization
+}
+
+// authorization is an account authorization with the URLs to use
+type authorization struct {
+	Token       string
+	APIURL      string
+	DownloadURL string
+	BucketID    string
+}
+
+// New creates a new Backblaze B2 storage
+func New(config Config) (*Storage, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+	if config.KeyID == "" || config.ApplicationKey == "" {
+		return nil, errors.New("key ID and application key are required")
+	}
+
+	name := config.Name
+	if name == "" {
+		name = defaultStorageName
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Storage{
+		name:           name,
+		bucket:         config.Bucket,
+		keyID:          config.KeyID,
+		applicationKey: config.ApplicationKey,
+		endpoint:       strings.TrimSuffix(endpoint, "/"),
+		client:         client,
+	}, nil
+}
+
+// apiError is the error body of B2 API responses
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// statusError maps an HTTP error status to an error
+func statusError(op string, name string, resp *http.Response) error {
+	var body apiError
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+
+	// Authorization tokens expire after a day and are renewed
+	if body.Code == "expired_auth_token" || body.Code == "bad_auth_token" {
+		return errExpired
+	}
+
+	var err error
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		err = fs.ErrNotExist
+	case http.StatusForbidden, http.StatusUnauthorized:
+		err = fs.ErrPermission
+	default:
+		err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if body.Code != "" {
+		err = fmt.Errorf("%s: %w", body.Code, err)
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// authorize returns the cached authorization or authorizes the account
+func (s *Storage) authorize() (*authorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.auth != nil {
+		return s.auth, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.endpoint+"/b2api/v2/b2_authorize_account", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(s.keyID, s.applicationKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authorize account: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to authorize account: %w", statusError("authorize", s.bucket, resp))
+	}
+
+	var result struct {
+		AccountID          string `json:"accountId"`
+		AuthorizationToken string `json:"authorizationToken"`
+		APIURL             string `json:"apiUrl"`
+		DownloadURL        string `json:"downloadUrl"`
+		Allowed            struct {
+			BucketID   string `json:"bucketId"`
+			BucketName string `json:"bucketName"`
+		} `json:"allowed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid authorization response: %w", err)
+	}
+
+	auth := &authorization{
+		Token:       result.AuthorizationToken,
+		APIURL:      result.APIURL,
+		DownloadURL: result.DownloadURL,
+	}
+
+	// Keys restricted to a bucket already name its ID
+	if result.Allowed.BucketName == s.bucket {
+		auth.BucketID = result.Allowed.BucketID
+	} else {
+		var buckets struct {
+			Buckets []struct {
+				BucketID string `json:"bucketId"`
+			} `json:"buckets"`
+		}
+		err := s.call(auth, "b2_list_buckets", map[string]any{
+			"accountId":  result.AccountID,
+			"bucketName": s.bucket,
+		}, &buckets)
+		if err != nil {
+			return nil, err
+		}
+		if len(buckets.Buckets) == 0 {
+			return nil, fmt.Errorf("bucket %s: %w", s.bucket, fs.ErrNotExist)
+		}
+		auth.BucketID = buckets.Buckets[0].BucketID
+	}
+
+	s.auth = auth
+	return auth, nil
+}
+
+// invalidate drops an expired authorization so the next request renews it
+func (s *Storage) invalidate(auth *authorization) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.auth == auth {
+		s.auth = nil
+	}
+}
+
+// errExpired is returned for requests with an expired authorization token
+var errExpired = errors.New("authorization token expired")
+
+// call calls an API operation with a JSON request and response body
+func (s *Storage) call(auth *authorization, operation string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, auth.APIURL+"/b2api/v2/"+operation, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(operation, s.bucket, resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("invalid %s response: %w", operation, err)
+	}
+	return nil
+}
+
+// withAuth runs fn with the authorization, renewing it once if it expired
+func (s *Storage) withAuth(fn func(auth *authorization) error) error {
+	auth, err := s.authorize()
+	if err != nil {
+		return err
+	}
+	err = fn(auth)
+	if !errors.Is(err, errExpired) {
+		return err
+	}
+
+	s.invalidate(auth)
+	auth, err = s.authorize()
+	if err != nil {
+		return err
+	}
+	err = fn(auth)
+	if errors.Is(err, errExpired) {
+		return &fs.PathError{Op: "request", Path: s.bucket, Err: fs.ErrPermission}
+	}
+	return err
+}
+
+// file is a file version in list responses
+type file struct {
+	FileID          string `json:"fileId"`
+	FileName        string `json:"fileName"`
+	ContentLength   int64  `json:"contentLength"`
+	ContentType     string `json:"contentType"`
+	UploadTimestamp int64  `json:"uploadTimestamp"`
+
+	// Action is "upload" for file versions, "hide" for hide markers,
+	// "folder" for virtual directories and "start" for unfinished large files
+	Action string `json:"action"`
+}
+
+// listResult is a page of a file names or file versions list response
+type listResult struct {
+	Files        []file  `json:"files"`
+	NextFileName *string `json:"nextFileName"`
+	NextFileID   *string `json:"nextFileId"`
+}
+
+// list lists file names, or all file versions if versions is set, following
+// pages until fn returns false
+func (s *Storage) list(versions bool, prefix string, delimiter string, fn func(file) bool) error {
+	operation := "b2_list_file_names"
+	if versions {
+		operation = "b2_list_file_versions"
+	}
+
+	return s.withAuth(func(auth *authorization) error {
+		request := map[string]any{
+			"bucketId":     auth.BucketID,
+			"prefix":       prefix,
+			"maxFileCount": 1000,
+		}
+		if delimiter != "" {
+			request["delimiter"] = delimiter
+		}
+		for {
+			var result listResult
+			if err := s.call(auth, operation, request, &result); err != nil {
+				return err
+			}
+			for _, f := range result.Files {
+				if !fn(f) {
+					return nil
+				}
+			}
+			if result.NextFileName == nil {
+				return nil
+			}
+			request["startFileName"] = *result.NextFileName
+			if result.NextFileID != nil {
+				request["startFileId"] = *result.NextFileID
+			}
+		}
+	})
+}
+
+// fileName returns the file name of a path
+func fileName(vfPath url.URL) string {
+	return strings.Trim(vfPath.Path, "/")
+}
+
+// snapshotFileID returns the file ID of the snapshot of a path, or "" for the
+// current version
+func snapshotFileID(vfPath url.URL) (string, error) {
+	snapshotID := vfPath.Query().Get("snapshot")
+	if snapshotID == "" {
+		return "", nil
+	}
+	fileID, ok := strings.CutPrefix(snapshotID, "b2:")
+	if !ok || fileID == "" {
+		return "", fmt.Errorf("%w: invalid snapshot ID format: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
+	return fileID, nil
+}
+
+// download requests the content of the current version or a snapshot of a file
+func (s *Storage) download(method string, vfPath url.URL) (*http.Response, error) {
+	fileID, err := snapshotFileID(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	name := fileName(vfPath)
+	if name == "" {
+		return nil, &fs.PathError{Op: "download", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+
+	var resp *http.Response
+	err = s.withAuth(func(auth *authorization) error {
+		var target string
+		if fileID != "" {
+			target = auth.DownloadURL + "/b2api/v2/b2_download_file_by_id?" + url.Values{"fileId": {fileID}}.Encode()
+		} else {
+			segments := strings.Split(name, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			target = auth.DownloadURL + "/file/" + url.PathEscape(s.bucket) + "/" + strings.Join(segments, "/")
+		}
+
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", auth.Token)
+
+		resp, err = s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= 300 {
+			defer resp.Body.Close()
+			return statusError("download", name, resp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// File IDs are unique across the account, so make sure the snapshot is a
+	// version of the requested file
+	if fileID != "" {
+		if got, _ := url.PathUnescape(resp.Header.Get("X-Bz-File-Name")); got != name {
+			resp.Body.Close()
+			return nil, &fs.PathError{Op: "download", Path: vfPath.Path, Err: fs.ErrNotExist}
+		}
+	}
+	return resp, nil
+}
+
+// ListContents implements storage.Lister
+// Lists the current files and virtual directories under the path
+func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
+	if vfPath.Query().Get("snapshot") != "" {
+		return nil, fmt.Errorf("listing directories at a snapshot: %w", storage.ErrNotSupported)
+	}
+
+	prefix := fileName(vfPath)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	nodes := []storage.FileNode{}
+	err := s.list(false, prefix, "/", func(f file) bool {
+		name := strings.TrimSuffix(strings.TrimPrefix(f.FileName, prefix), "/")
+		switch f.Action {
+		case "folder":
+			nodes = append(nodes, storage.FileNode{
+				Path:     url.URL{Scheme: s.name, Path: strings.TrimSuffix(f.FileName, "/")},
+				Type:     "dir",
+				Basename: name,
+				Mode:     fs.ModeDir | 0555,
+			})
+		case "upload":
+			// Placeholder files created by the web UI for empty directories
+			if name == "" || name == ".bzEmpty" {
+				return true
+			}
+			nodes = append(nodes, storage.FileNode{
+				Path:         url.URL{Scheme: s.name, Path: f.FileName},
+				Type:         "file",
+				Basename:     name,
+				Extension:    strings.TrimPrefix(path.Ext(name), "."),
+				Size:         f.ContentLength,
+				LastModified: f.UploadTimestamp / 1000,
+				MimeType:     f.ContentType,
+				Mode:         0444,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The bucket root always exists, other prefixes only if they have files
+	if len(nodes) == 0 && prefix != "" {
+		exists, err := s.DirectoryExists(vfPath)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, &fs.PathError{Op: "list", Path: vfPath.Path, Err: fs.ErrNotExist}
+		}
+	}
+	return nodes, nil
+}
+
+// head returns the headers of the current version or a snapshot of a file
+func (s *Storage) head(vfPath url.URL) (http.Header, error) {
+	resp, err := s.download(http.MethodHead, vfPath)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header, nil
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
+	resp, err := s.download(http.MethodGet, vfPath)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(vfPath url.URL) (int64, error) {
+	header, err := s.head(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(vfPath url.URL) (string, error) {
+	header, err := s.head(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("Content-Type"), nil
+}
+
+// LastModified implements storage.Stater
+// Returns the upload time of the version
+func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
+	header, err := s.head(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	millis, _ := strconv.ParseInt(header.Get("X-Bz-Upload-Timestamp"), 10, 64)
+	return millis / 1000, nil
+}
+
+// FileExists implements storage.Existence
+// Hidden files don't exist, but their versions can still be read as snapshots
+func (s *Storage) FileExists(vfPath url.URL) (bool, error) {
+	_, err := s.head(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DirectoryExists implements storage.Existence
+// Directories are virtual and exist if any current file has the path as prefix
+func (s *Storage) DirectoryExists(vfPath url.URL) (bool, error) {
+	prefix := fileName(vfPath)
+	if prefix == "" {
+		return true, nil
+	}
+	found := false
+	err := s.list(false, prefix+"/", "", func(file) bool {
+		found = true
+		return false
+	})
+	return found, err
+}
+
+// CheckHealth implements storage.HealthChecker
+// Lists the first page of files to check the bucket is reachable and authorized
+func (s *Storage) CheckHealth() error {
+	return s.list(false, "", "", func(file) bool {
+		return false
+	})
+}
+
+// ListSnapshots implements storage.SnapshotLister
+// Returns the older versions and hide markers of a file, newest first. The
+// newest version is the current view unless the file is hidden, then all
+// versions are snapshots. Directories have no snapshots.
+func (s *Storage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
+	name := fileName(vfPath)
+	snapshots := []storage.Snapshot{}
+	if name == "" {
+		return snapshots, nil
+	}
+
+	// Versions of a file are listed newest first
+	current := true
+	err := s.list(true, name, "", func(f file) bool {
+		if f.FileName != name {
+			// Names are sorted, so later files can't match
+			return f.FileName < name
+		}
+		if f.Action != "upload" && f.Action != "hide" {
+			return true
+		}
+		if current && f.Action == "upload" {
+			current = false
+			return true
+		}
+		current = false
+		snapshots = append(snapshots, toSnapshot(f))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// toSnapshot converts a file version or hide marker to a storage.Snapshot
+func toSnapshot(f file) storage.Snapshot {
+	t := time.UnixMilli(f.UploadTimestamp).UTC()
+	snap := storage.Snapshot{
+		ID:        "b2:" + f.FileID,
+		Type:      "b2",
+		Timestamp: t.Unix(),
+		Name:      t.Format(time.RFC3339),
+		Size:      f.ContentLength,
+		Metadata: storage.SnapshotMetadata{
+			"action":  f.Action,
+			"file_id": f.FileID,
+			"time":    t.Format(time.RFC3339),
+		},
+	}
+	if f.Action == "hide" {
+		// Hide markers delete the file from the current view
+		snap.Size = 0
+		snap.Metadata["deleted"] = true
+	}
+	return snap
+}
@@ -0,0 +1,390 @@
+package b2
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"timeship/internal/storage"
+)
+
+// fakeB2 is a B2 API with a single bucket
+type fakeB2 struct {
+	t      *testing.T
+	server *httptest.Server
+
+	// versions are sorted by name, newest first
+	versions []file
+	content  map[string]string
+
+	tokens  int
+	expired map[string]bool
+}
+
+func newFakeB2(t *testing.T) *fakeB2 {
+	t.Helper()
+	f := &fakeB2{
+		t: t,
+		versions: []file{
+			{FileID: "d1", FileName: "docs/.bzEmpty", Action: "upload", UploadTimestamp: 1000_000},
+			{FileID: "d2", FileName: "docs/2025/q1.txt", Action: "upload", ContentLength: 2, UploadTimestamp: 1000_000},
+			{FileID: "d3", FileName: "docs/report.pdf", Action: "upload", ContentLength: 4, UploadTimestamp: 1000_000},
+			{FileID: "g2", FileName: "gone.txt", Action: "hide", UploadTimestamp: 2000_000},
+			{FileID: "g1", FileName: "gone.txt", Action: "upload", ContentLength: 4, UploadTimestamp: 1000_000},
+			{FileID: "r3", FileName: "readme.txt", Action: "upload", ContentLength: 7, ContentType: "text/plain", UploadTimestamp: 3000_000},
+			{FileID: "r2", FileName: "readme.txt", Action: "hide", UploadTimestamp: 2000_000},
+			{FileID: "r1", FileName: "readme.txt", Action: "upload", ContentLength: 3, UploadTimestamp: 1000_000},
+			{FileID: "b1", FileName: "readme.txt.bak", Action: "upload", ContentLength: 1, UploadTimestamp: 1000_000},
+		},
+		content: map[string]string{
+			"d2": "q1", "d3": "%PDF", "g1": "gone", "r3": "current", "r1": "old", "b1": "b",
+		},
+		expired: map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /b2api/v2/b2_authorize_account", func(w http.ResponseWriter, r *http.Request) {
+		if id, key, _ := r.BasicAuth(); id != "key-id" || key != "app-key" {
+			f.fail(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		f.tokens++
+		json.NewEncoder(w).Encode(map[string]any{
+			"accountId":          "account",
+			"authorizationToken": "token-" + strconv.Itoa(f.tokens),
+			"apiUrl":             f.server.URL,
+			"downloadUrl":        f.server.URL,
+		})
+	})
+	mux.HandleFunc("POST /b2api/v2/b2_list_buckets", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(w, r) {
+			return
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		buckets := []map[string]string{}
+		if req["bucketName"] == "bucket" && req["accountId"] == "account" {
+			buckets = append(buckets, map[string]string{"bucketId": "bucket-id"})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"buckets": buckets})
+	})
+	mux.HandleFunc("POST /b2api/v2/{operation}", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(w, r) {
+			return
+		}
+		var req struct {
+			BucketID      string `json:"bucketId"`
+			Prefix        string `json:"prefix"`
+			Delimiter     string `json:"delimiter"`
+			StartFileName string `json:"startFileName"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.BucketID != "bucket-id" {
+			f.fail(w, http.StatusBadRequest, "bad_request")
+			return
+		}
+		switch r.PathValue("operation") {
+		case "b2_list_file_names":
+			json.NewEncoder(w).Encode(f.listNames(req.Prefix, req.Delimiter, req.StartFileName))
+		case "b2_list_file_versions":
+			json.NewEncoder(w).Encode(f.listVersions(req.Prefix))
+		default:
+			f.fail(w, http.StatusNotFound, "not_found")
+		}
+	})
+	mux.HandleFunc("GET /b2api/v2/b2_download_file_by_id", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(w, r) {
+			return
+		}
+		for _, v := range f.versions {
+			if v.FileID == r.URL.Query().Get("fileId") && v.Action == "upload" {
+				f.serve(w, v)
+				return
+			}
+		}
+		f.fail(w, http.StatusNotFound, "not_found")
+	})
+	mux.HandleFunc("GET /file/bucket/", func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorized(w, r) {
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/file/bucket/")
+		for _, v := range f.versions {
+			if v.FileName == name {
+				if v.Action == "upload" {
+					f.serve(w, v)
+					return
+				}
+				break
+			}
+		}
+		f.fail(w, http.StatusNotFound, "not_found")
+	})
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeB2) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Status: status, Code: code})
+}
+
+func (f *fakeB2) authorized(w http.ResponseWriter, r *http.Request) bool {
+	token := r.Header.Get("Authorization")
+	if f.expired[token] {
+		f.fail(w, http.StatusUnauthorized, "expired_auth_token")
+		return false
+	}
+	if !strings.HasPrefix(token, "token-") {
+		f.fail(w, http.StatusUnauthorized, "bad_auth_token")
+		return false
+	}
+	return true
+}
+
+func (f *fakeB2) serve(w http.ResponseWriter, v file) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("X-Bz-File-Name", url.PathEscape(v.FileName))
+	w.Header().Set("X-Bz-Upload-Timestamp", strconv.FormatInt(v.UploadTimestamp, 10))
+	io.WriteString(w, f.content[v.FileID])
+}
+
+// listNames lists current files, one per page to exercise pagination
+func (f *fakeB2) listNames(prefix, delimiter, start string) listResult {
+	result := listResult{Files: []file{}}
+	seen := map[string]bool{}
+	for _, v := range f.versions {
+		if !strings.HasPrefix(v.FileName, prefix) || v.FileName < start || seen[v.FileName] {
+			continue
+		}
+		seen[v.FileName] = true
+		if v.Action != "upload" {
+			continue
+		}
+		entry := v
+		if delimiter != "" {
+			if i := strings.Index(v.FileName[len(prefix):], delimiter); i >= 0 {
+				folder := v.FileName[:len(prefix)+i+1]
+				if folder < start {
+					continue
+				}
+				entry = file{FileName: folder, Action: "folder"}
+			}
+		}
+		if len(result.Files) == 1 {
+			result.NextFileName = &entry.FileName
+			return result
+		}
+		result.Files = append(result.Files, entry)
+		if entry.Action == "folder" {
+			start = entry.FileName + "\xff"
+		}
+	}
+	return result
+}
+
+func (f *fakeB2) listVersions(prefix string) listResult {
+	result := listResult{Files: []file{}}
+	for _, v := range f.versions {
+		if strings.HasPrefix(v.FileName, prefix) {
+			result.Files = append(result.Files, v)
+		}
+	}
+	return result
+}
+
+func newTestStorage(t *testing.T, f *fakeB2) *Storage {
+	t.Helper()
+	s, err := New(Config{
+		Bucket:         "bucket",
+		KeyID:          "key-id",
+		ApplicationKey: "app-key",
+		Endpoint:       f.server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func filePath(p string, snapshot string) url.URL {
+	u := url.URL{Scheme: "b2", Path: p}
+	if snapshot != "" {
+		u.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	return u
+}
+
+func TestListContents(t *testing.T) {
+	f := newFakeB2(t)
+	defer f.server.Close()
+	s := newTestStorage(t, f)
+
+	tests := []struct {
+		name     string
+		path     string
+		snapshot string
+		expected []string
+		wantErr  error
+	}{
+		{"root without hidden files", "", "", []string{"dir:docs", "file:readme.txt", "file:readme.txt.bak"}, nil},
+		{"subdirectory skips placeholder", "docs", "", []string{"dir:2025", "file:report.pdf"}, nil},
+		{"missing", "nope", "", nil, fs.ErrNotExist},
+		{"snapshot", "", "b2:r1", nil, storage.ErrNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := s.ListContents(filePath(tt.path, tt.snapshot))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, node := range nodes {
+				got = append(got, node.Type+":"+node.Basename)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	f := newFakeB2(t)
+	defer f.server.Close()
+	s := newTestStorage(t, f)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		deleted  string
+	}{
+		{"older versions and hide markers", "readme.txt", "b2:r2,b2:r1", "b2:r2"},
+		{"hidden file", "gone.txt", "b2:g2,b2:g1", "b2:g2"},
+		{"directory", "docs", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshots, err := s.ListSnapshots(filePath(tt.path, ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			deleted := []string{}
+			for _, snap := range snapshots {
+				ids = append(ids, snap.ID)
+				if snap.Metadata["deleted"] == true {
+					deleted = append(deleted, snap.ID)
+				}
+			}
+			if strings.Join(ids, ",") != tt.expected {
+				t.Errorf("expected snapshots %s, got %v", tt.expected, ids)
+			}
+			if strings.Join(deleted, ",") != tt.deleted {
+				t.Errorf("expected deletions %s, got %v", tt.deleted, deleted)
+			}
+		})
+	}
+}
+
+func TestReadStream(t *testing.T) {
+	f := newFakeB2(t)
+	defer f.server.Close()
+	s := newTestStorage(t, f)
+
+	tests := []struct {
+		name     string
+		path     string
+		snapshot string
+		expected string
+		wantErr  error
+	}{
+		{"current", "readme.txt", "", "current", nil},
+		{"older version", "readme.txt", "b2:r1", "old", nil},
+		{"version of hidden file", "gone.txt", "b2:g1", "gone", nil},
+		{"hidden file", "gone.txt", "", "", fs.ErrNotExist},
+		{"hide marker", "readme.txt", "b2:r2", "", fs.ErrNotExist},
+		{"version of another file", "readme.txt", "b2:g1", "", fs.ErrNotExist},
+		{"invalid snapshot", "readme.txt", "gcs:1", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.ReadStream(filePath(tt.path, tt.snapshot))
+			if tt.expected == "" {
+				if err == nil {
+					r.Close()
+					t.Fatal("expected error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			data, _ := io.ReadAll(r)
+			if string(data) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, data)
+			}
+		})
+	}
+
+	if ok, err := s.FileExists(filePath("gone.txt", "")); ok || err != nil {
+		t.Errorf("expected hidden file not to exist, got %v, %v", ok, err)
+	}
+	if size, err := s.FileSize(filePath("readme.txt", "b2:r1")); size != 3 || err != nil {
+		t.Errorf("expected size 3, got %d, %v", size, err)
+	}
+	if modified, err := s.LastModified(filePath("readme.txt", "")); modified != 3000 || err != nil {
+		t.Errorf("expected last modified 3000, got %d, %v", modified, err)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	f := newFakeB2(t)
+	defer f.server.Close()
+	s := newTestStorage(t, f)
+
+	if _, err := s.FileSize(filePath("readme.txt", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired tokens are renewed once
+	f.expired["token-1"] = true
+	if _, err := s.ListContents(filePath("", "")); err != nil {
+		t.Fatal(err)
+	}
+	if f.tokens != 2 {
+		t.Errorf("expected 2 authorizations, got %d", f.tokens)
+	}
+
+	bad, err := New(Config{Bucket: "bucket", KeyID: "key-id", ApplicationKey: "wrong", Endpoint: f.server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bad.ListContents(filePath("", "")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected permission error, got %v", err)
+	}
+
+	missing, _ := New(Config{Bucket: "other", KeyID: "key-id", ApplicationKey: "app-key", Endpoint: f.server.URL})
+	if _, err := missing.ListContents(filePath("", "")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected missing bucket error, got %v", err)
+	}
+}
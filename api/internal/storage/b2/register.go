@@ -0,0 +1,19 @@
+package b2
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("b2", func(sc config.StorageConfig) (storage.Storage, error) {
+		return New(Config{
+			Name:           sc.Name,
+			Bucket:         sc.Bucket,
+			KeyID:          sc.KeyID,
+			ApplicationKey: sc.ApplicationKey,
+			Endpoint:       sc.Endpoint,
+		})
+	})
+}
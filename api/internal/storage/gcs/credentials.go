@@ -0,0 +1,265 @@
+package gcs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials
+//
+// Requests are authorized with OAuth 2.0 access tokens obtained with
+// Application Default Credentials (ADC), in order:
+//
+//  1. The configured credentials file
+//  2. The file in GOOGLE_APPLICATION_CREDENTIALS
+//  3. The gcloud default credentials (gcloud auth application-default login)
+//  4. The service account of the GCE/GKE/Cloud Run metadata server
+//
+// Credentials files are either service account keys or gcloud user credentials.
+
+// readOnlyScope is the OAuth scope requested for access tokens
+const readOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// defaultTokenURI is the Google OAuth 2.0 token endpoint
+const defaultTokenURI = "https://oauth2.googleapis.com/token"
+
+// metadataTokenURL is the metadata server endpoint for service account tokens
+const metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// credentialsFile is the JSON credentials file format
+type credentialsFile struct {
+	Type string `json:"type"`
+
+	// Service account keys
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+
+	// gcloud user credentials
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenSource returns access tokens, caching them until shortly before they expire
+type tokenSource struct {
+	client *http.Client
+
+	// fetch requests a new token
+	fetch func() (*http.Request, error)
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// tokenResponse is an OAuth 2.0 token response
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Token returns a valid access token
+func (ts *tokenSource) Token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	req, err := ts.fetch()
+	if err != nil {
+		return "", err
+	}
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get access token: status %d", resp.StatusCode)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid access token response: %w", err)
+	}
+	ts.token = token.AccessToken
+	// Refresh a minute early to avoid using a token as it expires
+	ts.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return ts.token, nil
+}
+
+// defaultCredentials finds Application Default Credentials
+func defaultCredentials(client *http.Client, credentialsPath string) (*tokenSource, error) {
+	if credentialsPath == "" {
+		credentialsPath = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if credentialsPath == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			wellKnown := filepath.Join(dir, "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(wellKnown); err == nil {
+				credentialsPath = wellKnown
+			}
+		}
+	}
+	if credentialsPath == "" {
+		return metadataCredentials(client), nil
+	}
+
+	data, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read credentials: %w", err)
+	}
+	var file credentialsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", credentialsPath, err)
+	}
+
+	switch file.Type {
+	case "service_account":
+		return serviceAccountCredentials(client, file)
+	case "authorized_user":
+		return userCredentials(client, file), nil
+	default:
+		return nil, fmt.Errorf("unsupported credentials type %q", file.Type)
+	}
+}
+
+// metadataCredentials returns tokens of the metadata server service account
+func metadataCredentials(client *http.Client) *tokenSource {
+	return &tokenSource{
+		client: client,
+		fetch: func() (*http.Request, error) {
+			req, err := http.NewRequest(http.MethodGet, metadataTokenURL, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Metadata-Flavor", "Google")
+			return req, nil
+		},
+	}
+}
+
+// userCredentials exchanges the refresh token of gcloud user credentials for tokens
+func userCredentials(client *http.Client, file credentialsFile) *tokenSource {
+	tokenURI := file.TokenURI
+	if tokenURI == "" {
+		tokenURI = defaultTokenURI
+	}
+	return &tokenSource{
+		client: client,
+		fetch: func() (*http.Request, error) {
+			form := url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {file.ClientID},
+				"client_secret": {file.ClientSecret},
+				"refresh_token": {file.RefreshToken},
+			}
+			return formRequest(tokenURI, form)
+		},
+	}
+}
+
+// serviceAccountCredentials exchanges self-signed JWTs of a service account key for tokens
+func serviceAccountCredentials(client *http.Client, file credentialsFile) (*tokenSource, error) {
+	key, err := parsePrivateKey(file.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	tokenURI := file.TokenURI
+	if tokenURI == "" {
+		tokenURI = defaultTokenURI
+	}
+
+	return &tokenSource{
+		client: client,
+		fetch: func() (*http.Request, error) {
+			now := time.Now()
+			assertion, err := signJWT(key, file.PrivateKeyID, map[string]any{
+				"iss":   file.ClientEmail,
+				"scope": readOnlyScope,
+				"aud":   tokenURI,
+				"iat":   now.Unix(),
+				"exp":   now.Add(time.Hour).Unix(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			form := url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			}
+			return formRequest(tokenURI, form)
+		},
+	}, nil
+}
+
+// formRequest creates a form POST request
+func formRequest(target string, form url.Values) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// parsePrivateKey parses a PEM encoded RSA private key
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid private key: no PEM block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		// Older keys use PKCS #1
+		if key, err1 := x509.ParsePKCS1PrivateKey(block.Bytes); err1 == nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid private key: not an RSA key")
+	}
+	return key, nil
+}
+
+// signJWT returns an RS256 signed JSON Web Token with the claims
+func signJWT(key *rsa.PrivateKey, keyID string, claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
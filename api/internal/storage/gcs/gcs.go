@@ -0,0 +1,452 @@
+// Package gcs provides read-only storages for Google Cloud Storage buckets.
+//
+// Objects are listed as a directory tree using "/" as the separator. If
+// object versioning is enabled on the bucket, noncurrent generations of an
+// object are exposed as its snapshots, with IDs of the form
+// "gcs:<generation>". Any generation can be streamed, including the live one.
+//
+// See credentials.go for how requests are authenticated.
+package gcs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// defaultStorageName is the storage name used when none is configured
+const defaultStorageName = "gcs"
+
+// defaultEndpoint is the Cloud Storage JSON API endpoint
+const defaultEndpoint = "https://storage.googleapis.com"
+
+// Config holds configuration for the Google Cloud Storage storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths, defaults to "gcs"
+	Name string
+
+	// Bucket is the bucket name
+	Bucket string
+
+	// CredentialsFile is the path of a service account key or gcloud user
+	// credentials file. If empty, Application Default Credentials are used.
+	CredentialsFile string
+
+	// Anonymous skips authentication, e.g. for public buckets or emulators
+	Anonymous bool
+
+	// Endpoint overrides the JSON API URL, e.g. for emulators.
+	// Defaults to https://storage.googleapis.com
+	Endpoint string
+
+	// Client is the HTTP client used for requests, defaults to a client with
+	// a timeout
+	Client *http.Client
+}
+
+// Storage implements read-only storage interfaces for a Cloud Storage bucket
+type Storage struct {
+	name     string
+	bucket   string
+	endpoint string
+	client   *http.Client
+
+	// tokens is nil for anonymous access
+	tokens *tokenSource
+}
+
+// New creates a new Google Cloud Storage storage
+func New(config Config) (*Storage, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+
+	name := config.Name
+	if name == "" {
+		name = defaultStorageName
+	}
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	s := &Storage{
+		name:     name,
+		bucket:   config.Bucket,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   client,
+	}
+
+	if !config.Anonymous {
+		tokens, err := defaultCredentials(client, config.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		s.tokens = tokens
+	}
+
+	return s, nil
+}
+
+// objectName returns the object name of a path
+func objectName(vfPath url.URL) string {
+	return strings.Trim(vfPath.Path, "/")
+}
+
+// generationQuery returns the query selecting the generation of a path, or
+// nil for the live generation
+func generationQuery(vfPath url.URL) (url.Values, error) {
+	snapshotID := vfPath.Query().Get("snapshot")
+	if snapshotID == "" {
+		return nil, nil
+	}
+	generation, ok := strings.CutPrefix(snapshotID, "gcs:")
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid snapshot ID format: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
+	if _, err := strconv.ParseInt(generation, 10, 64); err != nil {
+		return nil, fmt.Errorf("%w: invalid snapshot ID format: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
+	return url.Values{"generation": {generation}}, nil
+}
+
+// do sends an authorized request to the bucket objects or an object in it
+func (s *Storage) do(object string, query url.Values) (*http.Response, error) {
+	target := s.endpoint + "/storage/v1/b/" + url.PathEscape(s.bucket) + "/o"
+	if object != "" {
+		// Object names are a single path segment, "/" is escaped
+		target += "/" + url.PathEscape(object)
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.tokens != nil {
+		token, err := s.tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, statusError(object, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// statusError maps an HTTP error status to an error
+func statusError(object string, status int) error {
+	var err error
+	switch status {
+	case http.StatusNotFound:
+		err = fs.ErrNotExist
+	case http.StatusForbidden, http.StatusUnauthorized:
+		err = fs.ErrPermission
+	default:
+		err = fmt.Errorf("unexpected status %d", status)
+	}
+	return &fs.PathError{Op: "get", Path: object, Err: err}
+}
+
+// object is an object resource of the JSON API
+type object struct {
+	Name        string `json:"name"`
+	Generation  string `json:"generation"`
+	Size        string `json:"size"`
+	ContentType string `json:"contentType"`
+	Updated     string `json:"updated"`
+	TimeCreated string `json:"timeCreated"`
+
+	// TimeDeleted is set for noncurrent generations
+	TimeDeleted string `json:"timeDeleted"`
+}
+
+// size returns the object size, which the API encodes as a string
+func (o object) size() int64 {
+	size, _ := strconv.ParseInt(o.Size, 10, 64)
+	return size
+}
+
+// listResult is a page of an objects list response
+type listResult struct {
+	Items         []object `json:"items"`
+	Prefixes      []string `json:"prefixes"`
+	NextPageToken string   `json:"nextPageToken"`
+}
+
+// listPage lists a page of the objects matching the query, starting at the page token
+func (s *Storage) listPage(query url.Values, pageToken string) (*listResult, error) {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	if pageToken != "" {
+		q.Set("pageToken", pageToken)
+	}
+
+	resp, err := s.do("", q)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result listResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid list response: %w", err)
+	}
+	return &result, nil
+}
+
+// list lists the objects matching the query, following page tokens
+func (s *Storage) list(query url.Values, fn func(*listResult)) error {
+	pageToken := ""
+	for {
+		result, err := s.listPage(query, pageToken)
+		if err != nil {
+			return err
+		}
+
+		fn(result)
+
+		if result.NextPageToken == "" {
+			return nil
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+// parseTime parses an RFC 3339 timestamp, returning 0 if invalid
+func parseTime(value string) int64 {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// ListContents implements storage.Lister
+// Lists the live objects and virtual directories under the path
+func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
+	if vfPath.Query().Get("snapshot") != "" {
+		return nil, fmt.Errorf("listing directories at a snapshot: %w", storage.ErrNotSupported)
+	}
+
+	prefix := objectName(vfPath)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	nodes := []storage.FileNode{}
+	err := s.list(url.Values{"prefix": {prefix}, "delimiter": {"/"}}, func(result *listResult) {
+		for _, p := range result.Prefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/")
+			nodes = append(nodes, storage.FileNode{
+				Path:     url.URL{Scheme: s.name, Path: strings.TrimSuffix(p, "/")},
+				Type:     "dir",
+				Basename: name,
+				Mode:     fs.ModeDir | 0555,
+			})
+		}
+		for _, o := range result.Items {
+			name := strings.TrimPrefix(o.Name, prefix)
+			// Placeholder objects created by consoles for empty directories
+			if name == "" {
+				continue
+			}
+			nodes = append(nodes, storage.FileNode{
+				Path:         url.URL{Scheme: s.name, Path: o.Name},
+				Type:         "file",
+				Basename:     name,
+				Extension:    strings.TrimPrefix(path.Ext(name), "."),
+				Size:         o.size(),
+				LastModified: parseTime(o.Updated),
+				MimeType:     o.ContentType,
+				Mode:         0444,
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The bucket root always exists, other prefixes only if they have objects
+	if len(nodes) == 0 && prefix != "" {
+		return nil, &fs.PathError{Op: "list", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+	return nodes, nil
+}
+
+// metadata returns the object resource of a path
+func (s *Storage) metadata(vfPath url.URL) (object, error) {
+	query, err := generationQuery(vfPath)
+	if err != nil {
+		return object{}, err
+	}
+	name := objectName(vfPath)
+	if name == "" {
+		return object{}, &fs.PathError{Op: "get", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+	resp, err := s.do(name, query)
+	if err != nil {
+		return object{}, err
+	}
+	defer resp.Body.Close()
+
+	var o object
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return object{}, fmt.Errorf("invalid object response: %w", err)
+	}
+	return o, nil
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
+	query, err := generationQuery(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	name := objectName(vfPath)
+	if name == "" {
+		return nil, &fs.PathError{Op: "get", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("alt", "media")
+	resp, err := s.do(name, query)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(vfPath url.URL) (int64, error) {
+	o, err := s.metadata(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return o.size(), nil
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(vfPath url.URL) (string, error) {
+	o, err := s.metadata(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return o.ContentType, nil
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
+	o, err := s.metadata(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return parseTime(o.Updated), nil
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(vfPath url.URL) (bool, error) {
+	_, err := s.metadata(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DirectoryExists implements storage.Existence
+// Directories are virtual and exist if any object has the path as prefix
+func (s *Storage) DirectoryExists(vfPath url.URL) (bool, error) {
+	prefix := objectName(vfPath)
+	if prefix == "" {
+		return true, nil
+	}
+	result, err := s.listPage(url.Values{"prefix": {prefix + "/"}, "maxResults": {"1"}}, "")
+	if err != nil {
+		return false, err
+	}
+	return len(result.Items) > 0, nil
+}
+
+// CheckHealth implements storage.HealthChecker
+// Lists a single object to check the bucket is reachable and authorized
+func (s *Storage) CheckHealth() error {
+	_, err := s.listPage(url.Values{"maxResults": {"1"}}, "")
+	return err
+}
+
+// ListSnapshots implements storage.SnapshotLister
+// Returns the noncurrent generations of an object, newest first.
+// Directories have no snapshots.
+func (s *Storage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
+	name := objectName(vfPath)
+	snapshots := []storage.Snapshot{}
+	if name == "" {
+		return snapshots, nil
+	}
+
+	query := url.Values{"prefix": {name}, "versions": {"true"}}
+	err := s.list(query, func(result *listResult) {
+		for _, o := range result.Items {
+			// The live generation is the current view
+			if o.Name != name || o.TimeDeleted == "" {
+				continue
+			}
+			snapshots = append(snapshots, toSnapshot(o))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp > snapshots[j].Timestamp
+	})
+	return snapshots, nil
+}
+
+// toSnapshot converts a noncurrent generation to a storage.Snapshot
+func toSnapshot(o object) storage.Snapshot {
+	created := parseTime(o.TimeCreated)
+	return storage.Snapshot{
+		ID:        "gcs:" + o.Generation,
+		Type:      "gcs",
+		Timestamp: created,
+		Name:      o.Generation,
+		Size:      o.size(),
+		Metadata: storage.SnapshotMetadata{
+			"generation": o.Generation,
+			"time":       time.Unix(created, 0).UTC().Format(time.RFC3339),
+			"replaced":   o.TimeDeleted,
+		},
+	}
+}
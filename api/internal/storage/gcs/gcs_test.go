@@ -0,0 +1,365 @@
+package gcs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"timeship/internal/storage"
+)
+
+// fakeJSONAPI serves a bucket with a few objects and two older generations.
+// Requests must carry the token if not empty.
+func fakeJSONAPI(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	objects := map[string]string{
+		"readme.txt":      "current",
+		"readme.txt#100":  "oldest",
+		"readme.txt#200":  "older",
+		"readme.txt#300":  "current",
+		"docs/report.pdf": "%PDF",
+	}
+	const objectsPath = "/storage/v1/b/bucket/o"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.EscapedPath() == objectsPath {
+			switch {
+			case q.Get("versions") == "true":
+				io.WriteString(w, `{"items": [
+{"name": "readme.txt", "generation": "100", "size": "6", "timeCreated": "2025-11-07T09:00:00Z", "timeDeleted": "2025-11-08T09:00:00Z"},
+{"name": "readme.txt", "generation": "300", "size": "7", "timeCreated": "2025-11-09T09:00:00Z"},
+{"name": "readme.txt", "generation": "200", "size": "5", "timeCreated": "2025-11-08T09:00:00Z", "timeDeleted": "2025-11-09T09:00:00Z"},
+{"name": "readme.txt.bak", "generation": "1", "size": "1", "timeCreated": "2025-11-01T09:00:00Z", "timeDeleted": "2025-11-02T09:00:00Z"}
+]}`)
+			case q.Get("prefix") == "" && q.Get("pageToken") == "":
+				// First page of the root, continued with a page token
+				io.WriteString(w, `{"prefixes": ["docs/"], "nextPageToken": "page2"}`)
+			case q.Get("prefix") == "":
+				io.WriteString(w, `{"items": [
+{"name": "readme.txt", "generation": "300", "size": "7", "contentType": "text/plain", "updated": "2025-11-09T09:00:00Z"}
+]}`)
+			case q.Get("prefix") == "docs/":
+				io.WriteString(w, `{"prefixes": ["docs/2025/"], "items": [
+{"name": "docs/", "generation": "1", "size": "0"},
+{"name": "docs/report.pdf", "generation": "1", "size": "4"}
+]}`)
+			default:
+				io.WriteString(w, `{}`)
+			}
+			return
+		}
+
+		// Object names are a single escaped path segment
+		escaped, ok := strings.CutPrefix(r.URL.EscapedPath(), objectsPath+"/")
+		if !ok || strings.Contains(escaped, "/") {
+			t.Errorf("unexpected object path: %s", r.URL.EscapedPath())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		name, _ := url.PathUnescape(escaped)
+		key := name
+		if generation := q.Get("generation"); generation != "" {
+			key += "#" + generation
+		}
+		content, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if q.Get("alt") == "media" {
+			io.WriteString(w, content)
+			return
+		}
+		json.NewEncoder(w).Encode(object{
+			Name:        name,
+			Size:        strconv.Itoa(len(content)),
+			ContentType: "text/plain",
+			Updated:     "2025-11-09T09:00:00Z",
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestStorage(t *testing.T, server *httptest.Server) *Storage {
+	t.Helper()
+	s, err := New(Config{
+		Bucket:    "bucket",
+		Endpoint:  server.URL,
+		Anonymous: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func objectPath(p string, snapshot string) url.URL {
+	u := url.URL{Scheme: "gcs", Path: p}
+	if snapshot != "" {
+		u.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	return u
+}
+
+func TestListContents(t *testing.T) {
+	server := fakeJSONAPI(t, "")
+	defer server.Close()
+	s := newTestStorage(t, server)
+
+	tests := []struct {
+		name     string
+		path     string
+		snapshot string
+		expected []string
+		wantErr  error
+	}{
+		{"root with page token", "", "", []string{"dir:docs", "file:readme.txt"}, nil},
+		{"subdirectory skips placeholder", "docs", "", []string{"dir:2025", "file:report.pdf"}, nil},
+		{"missing", "nope", "", nil, fs.ErrNotExist},
+		{"snapshot", "", "gcs:100", nil, storage.ErrNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := s.ListContents(objectPath(tt.path, tt.snapshot))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, node := range nodes {
+				got = append(got, node.Type+":"+node.Basename)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	server := fakeJSONAPI(t, "")
+	defer server.Close()
+	s := newTestStorage(t, server)
+
+	snapshots, err := s.ListSnapshots(objectPath("readme.txt", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, snap := range snapshots {
+		ids = append(ids, snap.ID)
+	}
+	// Newest first, without the live generation or other objects
+	if strings.Join(ids, ",") != "gcs:200,gcs:100" {
+		t.Fatalf("unexpected snapshots %v", ids)
+	}
+	if snapshots[0].Type != "gcs" || snapshots[0].Size != 5 || snapshots[0].Metadata["time"] != "2025-11-08T09:00:00Z" {
+		t.Errorf("unexpected snapshot %+v", snapshots[0])
+	}
+
+	tests := []struct {
+		name     string
+		snapshot string
+		expected string
+	}{
+		{"live", "", "current"},
+		{"noncurrent generation", "gcs:100", "oldest"},
+		{"live generation", "gcs:300", "current"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.ReadStream(objectPath("readme.txt", tt.snapshot))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			data, _ := io.ReadAll(r)
+			if string(data) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, data)
+			}
+		})
+	}
+
+	if _, err := s.ReadStream(objectPath("readme.txt", "gcs:999")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist for a missing generation, got %v", err)
+	}
+	for _, id := range []string{"zfs:100", "gcs:abc"} {
+		if _, err := s.ReadStream(objectPath("readme.txt", id)); err == nil {
+			t.Errorf("expected error for snapshot ID %q", id)
+		}
+	}
+}
+
+func TestReaderAndExistence(t *testing.T) {
+	server := fakeJSONAPI(t, "")
+	defer server.Close()
+	s := newTestStorage(t, server)
+
+	size, err := s.FileSize(objectPath("docs/report.pdf", ""))
+	if err != nil || size != 4 {
+		t.Errorf("expected size 4, got %d, %v", size, err)
+	}
+	size, err = s.FileSize(objectPath("readme.txt", "gcs:200"))
+	if err != nil || size != 5 {
+		t.Errorf("expected generation size 5, got %d, %v", size, err)
+	}
+	if mime, _ := s.MimeType(objectPath("readme.txt", "")); mime != "text/plain" {
+		t.Errorf("expected text/plain, got %q", mime)
+	}
+	if modified, _ := s.LastModified(objectPath("readme.txt", "")); modified != 1762678800 {
+		t.Errorf("unexpected last modified %d", modified)
+	}
+
+	if ok, err := s.FileExists(objectPath("readme.txt", "")); !ok || err != nil {
+		t.Errorf("expected file to exist, got %v, %v", ok, err)
+	}
+	if ok, err := s.FileExists(objectPath("nope.txt", "")); ok || err != nil {
+		t.Errorf("expected file not to exist, got %v, %v", ok, err)
+	}
+	if ok, err := s.DirectoryExists(objectPath("docs", "")); !ok || err != nil {
+		t.Errorf("expected directory to exist, got %v, %v", ok, err)
+	}
+	if ok, err := s.DirectoryExists(objectPath("nope", "")); ok || err != nil {
+		t.Errorf("expected directory not to exist, got %v, %v", ok, err)
+	}
+	if ok, _ := s.DirectoryExists(objectPath("", "")); !ok {
+		t.Error("expected the bucket root to exist")
+	}
+}
+
+// writeServiceAccountKey writes a service account key file using the token URI
+func writeServiceAccountKey(t *testing.T, tokenURI string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(credentialsFile{
+		Type:         "service_account",
+		ClientEmail:  "timeship@project.iam.gserviceaccount.com",
+		PrivateKeyID: "key1",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:     tokenURI,
+	})
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCredentials(t *testing.T) {
+	api := fakeJSONAPI(t, "access-token")
+	defer api.Close()
+
+	requests := 0
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		r.ParseForm()
+		switch r.Form.Get("grant_type") {
+		case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+			if parts := strings.Split(r.Form.Get("assertion"), "."); len(parts) != 3 {
+				t.Errorf("invalid assertion %q", r.Form.Get("assertion"))
+			}
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				t.Errorf("unexpected refresh token %q", r.Form.Get("refresh_token"))
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"access_token": "access-token", "expires_in": 3600}`)
+	}))
+	defer tokens.Close()
+
+	userCredentials, _ := json.Marshal(credentialsFile{
+		Type:         "authorized_user",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RefreshToken: "refresh",
+		TokenURI:     tokens.URL,
+	})
+	userCredentialsPath := filepath.Join(t.TempDir(), "user.json")
+	os.WriteFile(userCredentialsPath, userCredentials, 0600)
+
+	tests := []struct {
+		name   string
+		config Config
+		env    string
+	}{
+		{"service account key from config", Config{CredentialsFile: writeServiceAccountKey(t, tokens.URL)}, ""},
+		{"user credentials from environment", Config{}, userCredentialsPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", tt.env)
+			requests = 0
+
+			tt.config.Bucket = "bucket"
+			tt.config.Endpoint = api.URL
+			s, err := New(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Tokens are cached across requests
+			for range 2 {
+				if _, err := s.FileSize(objectPath("readme.txt", "")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if requests != 1 {
+				t.Errorf("expected 1 token request, got %d", requests)
+			}
+		})
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		s := newTestStorage(t, api)
+		if _, err := s.FileSize(objectPath("readme.txt", "")); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("expected permission error, got %v", err)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "bad.json")
+		os.WriteFile(path, []byte(`{"type": "external_account"}`), 0600)
+		if _, err := New(Config{Bucket: "bucket", CredentialsFile: path}); err == nil {
+			t.Error("expected error for unsupported credentials")
+		}
+	})
+}
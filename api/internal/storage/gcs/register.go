@@ -0,0 +1,19 @@
+package gcs
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("gcs", func(sc config.StorageConfig) (storage.Storage, error) {
+		return New(Config{
+			Name:            sc.Name,
+			Bucket:          sc.Bucket,
+			CredentialsFile: sc.CredentialsFile,
+			Anonymous:       sc.Anonymous,
+			Endpoint:        sc.Endpoint,
+		})
+	})
+}
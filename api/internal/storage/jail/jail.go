@@ -0,0 +1,442 @@
+// Package jail provides storages confined to a directory of another storage.
+//
+// A jailed storage shows the directory as its root, e.g. a user's home
+// directory, under the same storage name. Paths are mapped to the directory
+// on the way in and back on the way out, so nothing outside of it can be
+// reached or is revealed. Snapshots of the other storage are shared, each
+// showing the directory as it was.
+package jail
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"timeship/internal/storage"
+)
+
+// Storage is a view of a directory of another storage
+type Storage struct {
+	base storage.Storage
+	root string
+}
+
+// New creates a storage showing the directory root of base. Paths keep the
+// storage name of base.
+func New(base storage.Storage, root string) *Storage {
+	return &Storage{base: base, root: strings.Trim(path.Clean("/"+root), "/")}
+}
+
+// Base returns the storage the jail is a view of
+func (s *Storage) Base() storage.Storage {
+	return s.base
+}
+
+// Root returns the directory of the base storage shown as the root
+func (s *Storage) Root() string {
+	return s.root
+}
+
+// ToBase converts a path of the jail to a path of the base storage. Paths
+// are cleaned first, so they can't escape the root.
+func (s *Storage) ToBase(p url.URL) url.URL {
+	p.Path = path.Join(s.root, strings.TrimPrefix(path.Clean("/"+p.Path), "/"))
+	return p
+}
+
+// fromBase converts a path of the base storage to a path of the jail
+func (s *Storage) fromBase(p url.URL) url.URL {
+	p.Path = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(p.Path, "/"), s.root), "/")
+	return p
+}
+
+// contains reports whether a path of the base storage is within the root
+func (s *Storage) contains(p url.URL) bool {
+	basePath := strings.Trim(p.Path, "/")
+	return s.root == "" || basePath == s.root || strings.HasPrefix(basePath, s.root+"/")
+}
+
+// fromBaseNodes converts the paths of nodes of the base storage
+func (s *Storage) fromBaseNodes(nodes []storage.FileNode) []storage.FileNode {
+	for i := range nodes {
+		nodes[i].Path = s.fromBase(nodes[i].Path)
+	}
+	return nodes
+}
+
+// CheckHealth implements storage.HealthChecker
+func (s *Storage) CheckHealth() error {
+	if checker, ok := s.base.(storage.HealthChecker); ok {
+		return checker.CheckHealth()
+	}
+	return nil
+}
+
+// ZFSHealth implements storage.ZFSHealthReporter
+func (s *Storage) ZFSHealth() (storage.ZFSHealth, error) {
+	if reporter, ok := s.base.(storage.ZFSHealthReporter); ok {
+		return reporter.ZFSHealth()
+	}
+	return storage.ZFSHealth{}, storage.ErrNotSupported
+}
+
+// SnapshotSpace implements storage.SnapshotSpaceReporter
+func (s *Storage) SnapshotSpace() (storage.SnapshotSpace, error) {
+	if reporter, ok := s.base.(storage.SnapshotSpaceReporter); ok {
+		return reporter.SnapshotSpace()
+	}
+	return storage.SnapshotSpace{}, storage.ErrNotSupported
+}
+
+// ListContents implements storage.Lister
+func (s *Storage) ListContents(p url.URL) ([]storage.FileNode, error) {
+	lister, ok := s.base.(storage.Lister)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	nodes, err := lister.ListContents(s.ToBase(p))
+	if err != nil {
+		return nil, err
+	}
+	return s.fromBaseNodes(nodes), nil
+}
+
+// ListSnapshots implements storage.SnapshotLister
+func (s *Storage) ListSnapshots(p url.URL) ([]storage.Snapshot, error) {
+	lister, ok := s.base.(storage.SnapshotLister)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return lister.ListSnapshots(s.ToBase(p))
+}
+
+// Walk implements storage.Walker, listing each directory if the base
+// storage can't walk
+func (s *Storage) Walk(p url.URL, fn func(node storage.FileNode) error) error {
+	if walker, ok := s.base.(storage.Walker); ok {
+		return walker.Walk(s.ToBase(p), func(node storage.FileNode) error {
+			node.Path = s.fromBase(node.Path)
+			return fn(node)
+		})
+	}
+	if _, ok := s.base.(storage.Lister); !ok {
+		return storage.ErrNotSupported
+	}
+	nodes, err := s.ListContents(p)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		err := fn(node)
+		if errors.Is(err, fs.SkipDir) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if node.Type != "dir" || node.LinkTarget != "" {
+			continue
+		}
+		child := p
+		child.Path = node.Path.Path
+		if err := s.Walk(child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reader returns the base storage as a Reader
+func (s *Storage) reader() (storage.Reader, error) {
+	reader, ok := s.base.(storage.Reader)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return reader, nil
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(p url.URL) (io.ReadCloser, error) {
+	reader, err := s.reader()
+	if err != nil {
+		return nil, err
+	}
+	return reader.ReadStream(s.ToBase(p))
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(p url.URL) (int64, error) {
+	reader, err := s.reader()
+	if err != nil {
+		return 0, err
+	}
+	return reader.FileSize(s.ToBase(p))
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(p url.URL) (string, error) {
+	reader, err := s.reader()
+	if err != nil {
+		return "", err
+	}
+	return reader.MimeType(s.ToBase(p))
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(p url.URL) (int64, error) {
+	stater, ok := s.base.(storage.Stater)
+	if !ok {
+		return 0, storage.ErrNotSupported
+	}
+	return stater.LastModified(s.ToBase(p))
+}
+
+// NodeType implements storage.NodeTyper
+func (s *Storage) NodeType(p url.URL) (string, error) {
+	typer, ok := s.base.(storage.NodeTyper)
+	if !ok {
+		return "", storage.ErrNotSupported
+	}
+	return typer.NodeType(s.ToBase(p))
+}
+
+// NodeTimes implements storage.TimeStater
+func (s *Storage) NodeTimes(p url.URL) (storage.NodeTimes, error) {
+	stater, ok := s.base.(storage.TimeStater)
+	if !ok {
+		return storage.NodeTimes{}, storage.ErrNotSupported
+	}
+	return stater.NodeTimes(s.ToBase(p))
+}
+
+// Version implements storage.Versioner
+func (s *Storage) Version(p url.URL) (string, error) {
+	versioner, ok := s.base.(storage.Versioner)
+	if !ok {
+		return "", storage.ErrNotSupported
+	}
+	return versioner.Version(s.ToBase(p))
+}
+
+// Identity implements storage.Identifier
+func (s *Storage) Identity(p url.URL) (string, error) {
+	identifier, ok := s.base.(storage.Identifier)
+	if !ok {
+		return "", storage.ErrNotSupported
+	}
+	return identifier.Identity(s.ToBase(p))
+}
+
+// FollowStream implements storage.Follower
+func (s *Storage) FollowStream(p url.URL) (io.ReadSeekCloser, error) {
+	follower, ok := s.base.(storage.Follower)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return follower.FollowStream(s.ToBase(p))
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(p url.URL) (bool, error) {
+	existence, ok := s.base.(storage.Existence)
+	if !ok {
+		return false, storage.ErrNotSupported
+	}
+	return existence.FileExists(s.ToBase(p))
+}
+
+// ResolveOwner implements storage.OwnerResolver
+func (s *Storage) ResolveOwner(owner, group string) (string, string) {
+	resolver, ok := s.base.(storage.OwnerResolver)
+	if !ok {
+		return owner, group
+	}
+	return resolver.ResolveOwner(owner, group)
+}
+
+// DirectoryExists implements storage.Existence
+func (s *Storage) DirectoryExists(p url.URL) (bool, error) {
+	existence, ok := s.base.(storage.Existence)
+	if !ok {
+		return false, storage.ErrNotSupported
+	}
+	return existence.DirectoryExists(s.ToBase(p))
+}
+
+// WriteStream implements storage.Writer
+func (s *Storage) WriteStream(p url.URL, r io.Reader) error {
+	writer, ok := s.base.(storage.Writer)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return writer.WriteStream(s.ToBase(p), r)
+}
+
+// WriteNew implements storage.ExclusiveWriter
+func (s *Storage) WriteNew(p url.URL, r io.Reader) error {
+	writer, ok := s.base.(storage.ExclusiveWriter)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return writer.WriteNew(s.ToBase(p), r)
+}
+
+// WriteStreamAt implements storage.WriterAt
+func (s *Storage) WriteStreamAt(p url.URL, offset int64, r io.Reader) error {
+	writer, ok := s.base.(storage.WriterAt)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return writer.WriteStreamAt(s.ToBase(p), offset, r)
+}
+
+// CreateFile implements storage.Creator
+func (s *Storage) CreateFile(p url.URL) error {
+	creator, ok := s.base.(storage.Creator)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return creator.CreateFile(s.ToBase(p))
+}
+
+// CreateDirectory implements storage.Creator
+func (s *Storage) CreateDirectory(p url.URL) error {
+	creator, ok := s.base.(storage.Creator)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return creator.CreateDirectory(s.ToBase(p))
+}
+
+// Delete implements storage.Deleter
+func (s *Storage) Delete(p url.URL) error {
+	deleter, ok := s.base.(storage.Deleter)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return deleter.Delete(s.ToBase(p))
+}
+
+// DeleteDirectory implements storage.Deleter
+func (s *Storage) DeleteDirectory(p url.URL) error {
+	deleter, ok := s.base.(storage.Deleter)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return deleter.DeleteDirectory(s.ToBase(p))
+}
+
+// Move implements storage.Mover
+func (s *Storage) Move(from, to url.URL) error {
+	mover, ok := s.base.(storage.Mover)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return mover.Move(s.ToBase(from), s.ToBase(to))
+}
+
+// Copy implements storage.Copier
+func (s *Storage) Copy(from, to url.URL, opts storage.CopyOptions) error {
+	copier, ok := s.base.(storage.Copier)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	return copier.Copy(s.ToBase(from), s.ToBase(to), opts)
+}
+
+// trasher returns the base storage as a Trasher
+func (s *Storage) trasher() (storage.Trasher, error) {
+	trasher, ok := s.base.(storage.Trasher)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	return trasher, nil
+}
+
+// ListTrash implements storage.Trasher, listing only the nodes trashed
+// within the root
+func (s *Storage) ListTrash() ([]storage.TrashItem, error) {
+	trasher, err := s.trasher()
+	if err != nil {
+		return nil, err
+	}
+	items, err := trasher.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+	own := []storage.TrashItem{}
+	for _, item := range items {
+		if s.contains(item.Path) {
+			item.Path = s.fromBase(item.Path)
+			own = append(own, item)
+		}
+	}
+	return own, nil
+}
+
+// ownTrash fails with fs.ErrNotExist if the trashed node with the ID isn't
+// from within the root
+func (s *Storage) ownTrash(id string) error {
+	items, err := s.ListTrash()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("trash item %s: %w", id, fs.ErrNotExist)
+}
+
+// RestoreTrash implements storage.Trasher
+func (s *Storage) RestoreTrash(id string) (storage.TrashItem, error) {
+	trasher, err := s.trasher()
+	if err != nil {
+		return storage.TrashItem{}, err
+	}
+	if err := s.ownTrash(id); err != nil {
+		return storage.TrashItem{}, err
+	}
+	item, err := trasher.RestoreTrash(id)
+	if err != nil {
+		return storage.TrashItem{}, err
+	}
+	item.Path = s.fromBase(item.Path)
+	return item, nil
+}
+
+// PurgeTrash implements storage.Trasher
+func (s *Storage) PurgeTrash(id string) error {
+	trasher, err := s.trasher()
+	if err != nil {
+		return err
+	}
+	if err := s.ownTrash(id); err != nil {
+		return err
+	}
+	return trasher.PurgeTrash(id)
+}
+
+// EmptyTrash implements storage.Trasher, purging only the nodes trashed
+// within the root
+func (s *Storage) EmptyTrash() error {
+	trasher, err := s.trasher()
+	if err != nil {
+		return err
+	}
+	items, err := s.ListTrash()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := trasher.PurgeTrash(item.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
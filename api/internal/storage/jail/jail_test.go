@@ -0,0 +1,159 @@
+package jail
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"timeship/internal/storage"
+	"timeship/internal/storage/local"
+)
+
+func TestToBase(t *testing.T) {
+	s := New(nil, "/homes/alice/")
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"", "homes/alice"},
+		{"/", "homes/alice"},
+		{"docs/a.txt", "homes/alice/docs/a.txt"},
+		{"/docs/", "homes/alice/docs"},
+		{"..", "homes/alice"},
+		{"../bob/a.txt", "homes/alice/bob/a.txt"},
+		{"docs/../../../etc", "homes/alice/etc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := s.ToBase(url.URL{Scheme: "local", Path: tt.path, RawQuery: "snapshot=zfs:daily"})
+			if got.Path != tt.expected || got.Scheme != "local" || got.RawQuery != "snapshot=zfs:daily" {
+				t.Errorf("expected %q, got %s", tt.expected, got.String())
+			}
+		})
+	}
+}
+
+func TestStorage(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "homes", "alice", "docs"), 0755)
+	os.MkdirAll(filepath.Join(root, "homes", "alicia"), 0755)
+	os.WriteFile(filepath.Join(root, "homes", "alice", "docs", "a.txt"), []byte("alice"), 0644)
+	os.WriteFile(filepath.Join(root, "homes", "alicia", "b.txt"), []byte("alicia"), 0644)
+	os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644)
+
+	base, err := local.NewWithConfig(root, local.Config{Trash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+	s := New(base, "homes/alice")
+	at := func(p string) url.URL {
+		return url.URL{Scheme: "local", Path: p}
+	}
+
+	t.Run("list", func(t *testing.T) {
+		nodes, err := s.ListContents(at(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 || nodes[0].Path.Path != "docs" || nodes[0].Path.Scheme != "local" {
+			t.Fatalf("expected docs, got %+v", nodes)
+		}
+	})
+
+	t.Run("walk", func(t *testing.T) {
+		var paths []string
+		err := s.Walk(at(""), func(node storage.FileNode) error {
+			paths = append(paths, node.Path.Path)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(paths)
+		if !slices.Equal(paths, []string{"docs", "docs/a.txt"}) {
+			t.Errorf("expected home nodes, got %q", paths)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		r, err := s.ReadStream(at("docs/a.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		content, _ := io.ReadAll(r)
+		if string(content) != "alice" {
+			t.Errorf("expected home content, got %q", content)
+		}
+	})
+
+	t.Run("no escape", func(t *testing.T) {
+		for _, p := range []string{"../../secret.txt", "/../alicia/b.txt", "docs/../../alicia/b.txt"} {
+			if _, err := s.ReadStream(at(p)); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s: expected not exist error, got %v", p, err)
+			}
+		}
+	})
+
+	t.Run("write", func(t *testing.T) {
+		if err := s.WriteStream(at("new.txt"), strings.NewReader("new")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "homes", "alice", "new.txt")); err != nil {
+			t.Errorf("expected file in home, got %v", err)
+		}
+		if err := s.Copy(at("new.txt"), at("docs/copy.txt"), storage.CopyOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "homes", "alice", "docs", "copy.txt")); err != nil {
+			t.Errorf("expected copied file in home, got %v", err)
+		}
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		other := New(base, "homes/alicia")
+		if err := s.Delete(at("docs/copy.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.Delete(at("b.txt")); err != nil {
+			t.Fatal(err)
+		}
+
+		items, err := s.ListTrash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].Path.Path != "docs/copy.txt" {
+			t.Fatalf("expected own trash only, got %+v", items)
+		}
+		others, err := other.ListTrash()
+		if err != nil || len(others) != 1 {
+			t.Fatalf("expected trash of the other home, got %+v, %v", others, err)
+		}
+
+		if _, err := s.RestoreTrash(others[0].ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected foreign trash not to be found, got %v", err)
+		}
+		if err := s.PurgeTrash(others[0].ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected foreign trash not to be found, got %v", err)
+		}
+		item, err := s.RestoreTrash(items[0].ID)
+		if err != nil || item.Path.Path != "docs/copy.txt" {
+			t.Errorf("expected restored home path, got %+v, %v", item, err)
+		}
+
+		if err := s.EmptyTrash(); err != nil {
+			t.Fatal(err)
+		}
+		if others, err := other.ListTrash(); err != nil || len(others) != 1 {
+			t.Errorf("expected trash of the other home to be kept, got %+v, %v", others, err)
+		}
+	})
+}
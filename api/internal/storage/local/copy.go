@@ -0,0 +1,190 @@
+package local
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"timeship/internal/storage"
+)
+
+// Copies
+//
+// Nodes are copied recursively from the live storage or from a snapshot,
+// which restores them. Files are written like uploads, so a failed copy
+// never leaves half-written files behind. Symbolic links are copied as
+// links, other special files are skipped, as are nodes hidden from
+// listings.
+//
+// With Preserve, permissions and modification times are copied as well. The
+// owner is only copied when running as root, as only root may give files
+// away. Directory metadata is applied after their contents, since adding
+// entries changes the modification time.
+
+// preservedModeBits are the mode bits copied with Preserve
+const preservedModeBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// Copy implements storage.Copier
+func (s *Storage) Copy(from, to url.URL, opts storage.CopyOptions) error {
+	srcRel, err := s.urlToRelPath(from)
+	if err != nil {
+		return fmt.Errorf("unable to convert path: %w", err)
+	}
+	dstRel, err := s.writablePath(to)
+	if err != nil {
+		return err
+	}
+	srcRoot, srcRel, err := s.pathRoot(from, srcRel)
+	if err != nil {
+		return err
+	}
+	if srcRoot != s.root {
+		defer srcRoot.Close()
+	}
+	if err := s.checkSymlinks(srcRoot, srcRel); err != nil {
+		return err
+	}
+
+	// A directory can't be copied into itself
+	if srcRoot == s.root && (srcRel == "." || dstRel == srcRel || strings.HasPrefix(dstRel, srcRel+string(filepath.Separator))) {
+		return &fs.PathError{Op: "copy", Path: to.Path, Err: fs.ErrInvalid}
+	}
+	if _, err := s.root.Lstat(dstRel); err == nil {
+		return &fs.PathError{Op: "copy", Path: to.Path, Err: fs.ErrExist}
+	}
+
+	c := &copier{
+		storage:  s,
+		src:      srcRoot,
+		preserve: opts.Preserve,
+		chown:    opts.Preserve && os.Geteuid() == 0,
+	}
+	if err := c.copy(srcRel, dstRel, strings.Trim(from.Path, "/")); err != nil {
+		return err
+	}
+	if s.fsync {
+		return s.syncDir(filepath.Dir(dstRel))
+	}
+	return nil
+}
+
+// copier copies nodes from a source root into the storage root
+type copier struct {
+	storage  *Storage
+	src      *os.Root
+	preserve bool
+	chown    bool
+}
+
+// copy copies the node at the on-disk srcRel to dstRel, apiPath is the
+// decoded path of the source for matching ignore patterns
+func (c *copier) copy(srcRel, dstRel, apiPath string) error {
+	s := c.storage
+	info, err := c.src.Lstat(srcRel)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		if s.symlinks == SymlinksHide {
+			return nil
+		}
+		target, err := c.src.Readlink(srcRel)
+		if err != nil {
+			return err
+		}
+		if err := s.root.Symlink(target, dstRel); err != nil {
+			return err
+		}
+
+	case info.IsDir():
+		if err := s.root.Mkdir(dstRel, 0755); err != nil {
+			return err
+		}
+		names, err := c.readDirNames(srcRel)
+		if err != nil {
+			return err
+		}
+		decoded := s.codec.decodeDir(names)
+		for i, name := range names {
+			// The trash and files being written are never copied
+			if isTempName(name) || (srcRel == "." && name == trashDir) {
+				continue
+			}
+			childAPIPath := path.Join(apiPath, decoded[i])
+			if s.ignore.match(childAPIPath) {
+				continue
+			}
+			if err := c.copy(filepath.Join(srcRel, name), filepath.Join(dstRel, name), childAPIPath); err != nil {
+				return err
+			}
+		}
+
+	case info.Mode().IsRegular():
+		f, err := c.src.Open(srcRel)
+		if err != nil {
+			return err
+		}
+		err = s.writeAtomic(dstRel, f, 0644)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+	default:
+		// Devices, sockets and pipes have no content to copy
+		return nil
+	}
+
+	return c.preserveMetadata(dstRel, info)
+}
+
+// readDirNames returns the sorted entry names of a source directory
+func (c *copier) readDirNames(relPath string) ([]string, error) {
+	f, err := c.src.Open(relPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// preserveMetadata copies the owner, permissions and modification time of
+// the source to a copied node if preserving
+func (c *copier) preserveMetadata(dstRel string, info fs.FileInfo) error {
+	if !c.preserve {
+		return nil
+	}
+	root := c.storage.root
+
+	// Changing the owner clears setuid and setgid bits, so it comes first
+	if c.chown {
+		if uid, gid, ok := fileIDs(info); ok {
+			if err := root.Lchown(dstRel, uid, gid); err != nil {
+				return fmt.Errorf("unable to preserve owner: %w", err)
+			}
+		}
+	}
+	// Links have no permissions or times of their own that can be set
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+	if err := root.Chmod(dstRel, info.Mode()&preservedModeBits); err != nil {
+		return fmt.Errorf("unable to preserve permissions: %w", err)
+	}
+	if err := root.Chtimes(dstRel, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("unable to preserve modification time: %w", err)
+	}
+	return nil
+}
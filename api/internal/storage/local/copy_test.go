@@ -0,0 +1,141 @@
+package local
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+func TestCopy(t *testing.T) {
+	modTime := time.Date(2024, 7, 1, 14, 3, 22, 0, time.UTC)
+	setup := func(t *testing.T) (string, *Storage) {
+		t.Helper()
+		tmpDir := t.TempDir()
+		os.MkdirAll(filepath.Join(tmpDir, "docs", "sub"), 0755)
+		os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("current a"), 0600)
+		os.WriteFile(filepath.Join(tmpDir, "docs", "sub", "b.txt"), []byte("b"), 0640)
+		os.Chtimes(filepath.Join(tmpDir, "docs", "a.txt"), modTime, modTime)
+		os.Chtimes(filepath.Join(tmpDir, "docs", "sub"), modTime, modTime)
+		snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily", "docs")
+		os.MkdirAll(snapDir, 0755)
+		os.WriteFile(filepath.Join(snapDir, "a.txt"), []byte("old a"), 0600)
+		os.Chtimes(filepath.Join(snapDir, "a.txt"), modTime, modTime)
+
+		s, err := NewWithConfig(tmpDir, Config{Ignore: []string{"*.tmp"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return tmpDir, s
+	}
+	local := func(p string) url.URL {
+		return url.URL{Scheme: "local", Path: p}
+	}
+	checkFile := func(t *testing.T, path, content string, perm fs.FileMode, preserved bool) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("expected copy: %v", err)
+		}
+		if string(data) != content {
+			t.Errorf("expected %q, got %q", content, data)
+		}
+		info, _ := os.Stat(path)
+		if runtime.GOOS != "windows" && info.Mode().Perm() != perm {
+			t.Errorf("expected permissions %v, got %v", perm, info.Mode().Perm())
+		}
+		if info.ModTime().Equal(modTime) != preserved {
+			t.Errorf("expected modification time preserved %v, got %v", preserved, info.ModTime())
+		}
+	}
+
+	t.Run("file", func(t *testing.T) {
+		tmpDir, s := setup(t)
+		if err := s.Copy(local("docs/a.txt"), local("a-copy.txt"), storage.CopyOptions{}); err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+		checkFile(t, filepath.Join(tmpDir, "a-copy.txt"), "current a", 0644, false)
+	})
+
+	t.Run("directory with preserve", func(t *testing.T) {
+		tmpDir, s := setup(t)
+		os.WriteFile(filepath.Join(tmpDir, "docs", "scratch.tmp"), []byte("x"), 0644)
+		if err := s.Copy(local("docs"), local("docs-copy"), storage.CopyOptions{Preserve: true}); err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+		checkFile(t, filepath.Join(tmpDir, "docs-copy", "a.txt"), "current a", 0600, true)
+		checkFile(t, filepath.Join(tmpDir, "docs-copy", "sub", "b.txt"), "b", 0640, false)
+		if info, err := os.Stat(filepath.Join(tmpDir, "docs-copy", "sub")); err != nil || !info.ModTime().Equal(modTime) {
+			t.Errorf("expected directory modification time to be preserved, got %v", info.ModTime())
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "docs-copy", "scratch.tmp")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected ignored file not to be copied, got %v", err)
+		}
+	})
+
+	t.Run("restore from snapshot", func(t *testing.T) {
+		tmpDir, s := setup(t)
+		from := local("docs/a.txt")
+		from.RawQuery = "snapshot=zfs:daily"
+		if err := s.Copy(from, local("docs/a-restored.txt"), storage.CopyOptions{Preserve: true}); err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+		checkFile(t, filepath.Join(tmpDir, "docs", "a-restored.txt"), "old a", 0600, true)
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+			t.Skip("changing owners needs root")
+		}
+		tmpDir, s := setup(t)
+		os.Chown(filepath.Join(tmpDir, "docs", "a.txt"), 4321, 4321)
+		if err := s.Copy(local("docs/a.txt"), local("a-copy.txt"), storage.CopyOptions{Preserve: true}); err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+		info, _ := os.Stat(filepath.Join(tmpDir, "a-copy.txt"))
+		if owner, group := fileOwner(info); owner != "4321" || group != "4321" {
+			t.Errorf("expected owner 4321:4321, got %s:%s", owner, group)
+		}
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks need privileges on Windows")
+		}
+		tmpDir, s := setup(t)
+		os.Symlink("a.txt", filepath.Join(tmpDir, "docs", "latest"))
+		if err := s.Copy(local("docs"), local("docs-copy"), storage.CopyOptions{}); err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+		if target, err := os.Readlink(filepath.Join(tmpDir, "docs-copy", "latest")); err != nil || target != "a.txt" {
+			t.Errorf("expected link to a.txt, got %q: %v", target, err)
+		}
+	})
+
+	errorTests := []struct {
+		name string
+		from url.URL
+		to   url.URL
+		want error
+	}{
+		{"existing destination", local("docs/a.txt"), local("docs/sub/b.txt"), fs.ErrExist},
+		{"missing source", local("docs/missing.txt"), local("copy.txt"), fs.ErrNotExist},
+		{"into itself", local("docs"), local("docs/sub/docs"), fs.ErrInvalid},
+		{"snapshot destination", local("docs/a.txt"), url.URL{Scheme: "local", Path: "b.txt", RawQuery: "snapshot=zfs:daily"}, fs.ErrPermission},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s := setup(t)
+			if err := s.Copy(tt.from, tt.to, storage.CopyOptions{}); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
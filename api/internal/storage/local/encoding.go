@@ -0,0 +1,309 @@
+package local
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	gounicode "unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Filename Encoding
+//
+// Filenames on disk are arbitrary byte strings, while the API exposes them as
+// UTF-8 strings. Old backups often contain filenames in legacy encodings such
+// as Latin-1 or Shift-JIS, which would otherwise be mangled when encoded as JSON.
+//
+// Names are converted as follows:
+//   - Valid UTF-8 names are exposed unchanged
+//   - Other names are transcoded from the configured legacy encoding (if any),
+//     and optionally transliterated to ASCII, e.g. "café" to "cafe"
+//   - Names that still can't be represented have each invalid byte escaped as a
+//     rune in the private use range U+EF80-U+EFFF. Valid names containing such
+//     runes have the bytes of those runes escaped too, so they unescape to
+//     themselves.
+//
+// All conversions are reversible, so every node that shows up in a listing can
+// also be opened and downloaded. Transliterated names are found by looking
+// for the entry of the directory they were transliterated from, so names are
+// only transliterated if no other entry would be found by the same name.
+
+// rawByteBase is the first rune of the private use range used to escape raw bytes.
+// Only bytes 0x80-0xFF can be invalid in UTF-8, so they map to U+EF80-U+EFFF.
+const rawByteBase = 0xEF00
+
+// filenameCodec converts between on-disk filenames and the UTF-8 names exposed by the API
+type filenameCodec struct {
+	// enc is the legacy encoding for non-UTF-8 filenames, nil if none is configured
+	enc encoding.Encoding
+
+	// transliterate converts names decoded from the legacy encoding to ASCII
+	transliterate bool
+}
+
+// newFilenameCodec creates a codec for the given encoding name, e.g. "latin1" or "shift_jis".
+// An empty name or "utf-8" only escapes invalid bytes, so there is nothing to
+// transliterate.
+func newFilenameCodec(name string, transliterate bool) (*filenameCodec, error) {
+	if name == "" {
+		return &filenameCodec{}, nil
+	}
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported filename encoding %q: %w", name, err)
+	}
+
+	if enc == unicode.UTF8 {
+		return &filenameCodec{}, nil
+	}
+
+	return &filenameCodec{enc: enc, transliterate: transliterate}, nil
+}
+
+// decode converts an on-disk filename to its UTF-8 representation, without
+// transliterating it
+func (c *filenameCodec) decode(name string) string {
+	if utf8.ValidString(name) && !hasRawBytes(name) {
+		return name
+	}
+
+	if c.enc != nil && !utf8.ValidString(name) {
+		decoded, err := c.enc.NewDecoder().String(name)
+		if err == nil && !strings.ContainsRune(decoded, utf8.RuneError) && !hasRawBytes(decoded) {
+			return decoded
+		}
+	}
+
+	return escapeRawBytes(name)
+}
+
+// decodeIn converts the on-disk filename of an entry of a directory within
+// root to its UTF-8 representation, transliterated if that finds the entry
+// again
+func (c *filenameCodec) decodeIn(root *os.Root, dir, name string) string {
+	decoded := c.decode(name)
+	ascii, ok := c.transliterated(name, decoded)
+	if !ok {
+		return decoded
+	}
+	if _, err := root.Lstat(filepath.Join(dir, ascii)); err == nil {
+		return decoded
+	}
+	names, err := readDirNames(root, dir)
+	if err != nil {
+		return decoded
+	}
+	if c.untransliterate(names, ascii) != name {
+		return decoded
+	}
+	return ascii
+}
+
+// decodeDir converts the on-disk filenames of all entries of a directory like
+// decodeIn, without looking them up again
+func (c *filenameCodec) decodeDir(names []string) []string {
+	decoded := make([]string, len(names))
+	for i, name := range names {
+		decoded[i] = c.decode(name)
+	}
+	if !c.transliterate {
+		return decoded
+	}
+
+	// Transliterations are ambiguous if an entry has the same name or
+	// several entries are transliterated the same
+	counts := map[string]int{}
+	for _, name := range names {
+		counts[name]++
+	}
+	ascii := make([]string, len(names))
+	for i, name := range names {
+		if a, ok := c.transliterated(name, decoded[i]); ok {
+			ascii[i] = a
+			counts[a]++
+		}
+	}
+	for i := range names {
+		if ascii[i] != "" && counts[ascii[i]] == 1 {
+			decoded[i] = ascii[i]
+		}
+	}
+	return decoded
+}
+
+// transliterated returns the ASCII transliteration of a name decoded from
+// the legacy encoding, if it has one that differs from the decoded name
+func (c *filenameCodec) transliterated(name, decoded string) (string, bool) {
+	if !c.transliterate || utf8.ValidString(name) || hasRawBytes(decoded) {
+		return "", false
+	}
+	ascii, ok := transliterate(decoded)
+	if !ok || ascii == decoded || ascii == "" {
+		return "", false
+	}
+	return ascii, true
+}
+
+// untransliterate returns the only name of a directory transliterated to the
+// ASCII name, or an empty name if there's none or several
+func (c *filenameCodec) untransliterate(names []string, ascii string) string {
+	found := ""
+	for _, name := range names {
+		if a, ok := c.transliterated(name, c.decode(name)); ok && a == ascii {
+			if found != "" {
+				return ""
+			}
+			found = name
+		}
+	}
+	return found
+}
+
+// candidates returns the possible on-disk filenames for a UTF-8 name, most likely first
+func (c *filenameCodec) candidates(name string) []string {
+	if hasRawBytes(name) {
+		return []string{unescapeRawBytes(name)}
+	}
+
+	if c.enc == nil || isASCII(name) {
+		return []string{name}
+	}
+
+	encoded, err := c.enc.NewEncoder().String(name)
+	if err != nil || encoded == name {
+		return []string{name}
+	}
+
+	// The name may exist on disk either as UTF-8 or in the legacy encoding
+	return []string{name, encoded}
+}
+
+// resolve maps a relative UTF-8 path to the matching on-disk path within root
+func (c *filenameCodec) resolve(root *os.Root, relPath string) string {
+	if isASCII(relPath) {
+		if !c.transliterate {
+			return relPath
+		}
+		// Transliterated names are ASCII too, but only exist on disk in the
+		// legacy encoding
+		if _, err := root.Lstat(relPath); err == nil {
+			return relPath
+		}
+	}
+
+	parts := strings.Split(relPath, string(filepath.Separator))
+	resolved := ""
+	for _, part := range parts {
+		candidates := c.candidates(part)
+		name := ""
+		for _, candidate := range candidates {
+			if _, err := root.Lstat(filepath.Join(resolved, candidate)); err == nil {
+				name = candidate
+				break
+			}
+		}
+		if name == "" && c.transliterate && isASCII(part) {
+			if names, err := readDirNames(root, resolved); err == nil {
+				name = c.untransliterate(names, part)
+			}
+		}
+		if name == "" {
+			name = candidates[0]
+		}
+		resolved = filepath.Join(resolved, name)
+	}
+
+	return resolved
+}
+
+// readDirNames returns the entry names of a directory within root
+func readDirNames(root *os.Root, dir string) ([]string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	f, err := root.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+// transliterations replace letters that don't decompose into an ASCII letter
+// and combining marks
+var transliterations = strings.NewReplacer(
+	"ß", "ss", "Æ", "AE", "æ", "ae", "Œ", "OE", "œ", "oe", "Ø", "O", "ø", "o",
+	"Đ", "D", "đ", "d", "Ł", "L", "ł", "l", "Þ", "Th", "þ", "th", "Ð", "D", "ð", "d",
+)
+
+// transliterate converts a name to ASCII by removing the accents of letters,
+// failing if it has other non-ASCII characters
+func transliterate(name string) (string, bool) {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(transliterations.Replace(name)) {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case !gounicode.Is(gounicode.Mn, r):
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// escapeRawBytes escapes each byte of an invalid UTF-8 sequence as a private
+// use rune, and so are the bytes of such runes in the name
+func escapeRawBytes(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if (r == utf8.RuneError && size <= 1) || isRawByteRune(r) {
+			for _, c := range []byte(name[i : i+size]) {
+				b.WriteRune(rawByteBase + rune(c))
+			}
+			i += size
+			continue
+		}
+		b.WriteString(name[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// unescapeRawBytes reverses escapeRawBytes
+func unescapeRawBytes(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if isRawByteRune(r) {
+			b.WriteByte(byte(r - rawByteBase))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// hasRawBytes reports whether the name contains escaped raw bytes
+func hasRawBytes(name string) bool {
+	return strings.IndexFunc(name, isRawByteRune) >= 0
+}
+
+func isRawByteRune(r rune) bool {
+	return r >= rawByteBase+0x80 && r <= rawByteBase+0xFF
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,299 @@
+package local
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"unicode/utf8"
+
+	"timeship/internal/storage"
+)
+
+func TestFilenameCodec(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		input    string
+		expected string
+	}{
+		{
+			name:     "valid utf-8 unchanged",
+			encoding: "",
+			input:    "résumé.txt",
+			expected: "résumé.txt",
+		},
+		{
+			name:     "invalid bytes escaped without encoding",
+			encoding: "",
+			input:    "caf\xe9.txt",
+			expected: "caf.txt",
+		},
+		{
+			name:     "latin1 transcoded",
+			encoding: "latin1",
+			input:    "caf\xe9.txt",
+			expected: "café.txt",
+		},
+		{
+			name:     "shift_jis transcoded",
+			encoding: "shift_jis",
+			input:    "\x93\xfa\x96\x7b.txt",
+			expected: "日本.txt",
+		},
+		{
+			name:     "private use runes escaped",
+			encoding: "",
+			input:    "a\uef80\uefff.txt",
+			expected: "a\uefee\uefbe\uef80\uefee\uefbf\uefbf.txt",
+		},
+		{
+			name:     "private use runes escaped with encoding",
+			encoding: "latin1",
+			input:    "a\uefe9.txt",
+			expected: "a\uefee\uefbf\uefa9.txt",
+		},
+		{
+			name:     "shift_jis undecodable escaped",
+			encoding: "shift_jis",
+			input:    "\xff\xfe.txt",
+			expected: ".txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := newFilenameCodec(tt.encoding, false)
+			if err != nil {
+				t.Fatalf("newFilenameCodec failed: %v", err)
+			}
+
+			decoded := codec.decode(tt.input)
+			if decoded != tt.expected {
+				t.Errorf("decode(%q) = %q, want %q", tt.input, decoded, tt.expected)
+			}
+			if !utf8.ValidString(decoded) {
+				t.Errorf("decode(%q) returned invalid UTF-8", tt.input)
+			}
+
+			// The original name must always be among the candidates
+			found := false
+			for _, candidate := range codec.candidates(decoded) {
+				if candidate == tt.input {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("candidates(%q) = %q, missing %q", decoded, codec.candidates(decoded), tt.input)
+			}
+		})
+	}
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		if _, err := newFilenameCodec("no-such-encoding", false); err == nil {
+			t.Error("expected error for unsupported encoding")
+		}
+	})
+}
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"café.txt", "cafe.txt", true},
+		{"Straße Ørsted", "Strasse Orsted", true},
+		{"naïve", "naive", true},
+		{"日本.txt", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := transliterate(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("transliterate(%q) = %q, %v, want %q, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTransliteratedFilenames(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "d\xe9j\xe0"), 0755); err != nil {
+		t.Skipf("filesystem does not support non-UTF-8 names: %v", err)
+	}
+	for name, content := range map[string]string{
+		"d\xe9j\xe0/caf\xe9.txt":  "legacy",
+		"d\xe9j\xe0/na\xefve.txt": "one",
+		"d\xe9j\xe0/na\xeeve.txt": "other",
+		"d\xe9j\xe0/r\xe9sum\xe9": "legacy",
+		"d\xe9j\xe0/resume":       "ascii",
+		"d\xe9j\xe0/\xb5.txt":     "micro",
+	} {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+	}
+
+	a, err := NewWithConfig(tmpDir, Config{FilenameEncoding: "latin1", TransliterateFilenames: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	dir := url.URL{Scheme: "local", Path: "deja"}
+	nodes, err := a.ListContents(dir)
+	if err != nil {
+		t.Fatalf("ListContents failed: %v", err)
+	}
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Basename)
+	}
+	slices.Sort(names)
+	// Names clashing with another entry keep their accents, names without
+	// an ASCII form aren't transliterated
+	want := []string{"cafe.txt", "naîve.txt", "naïve.txt", "resume", "résumé", "µ.txt"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("expected %q, got %q", want, names)
+	}
+
+	for _, node := range nodes {
+		stream, err := a.ReadStream(node.Path)
+		if err != nil {
+			t.Errorf("ReadStream(%s) failed: %v", node.Path.Path, err)
+			continue
+		}
+		stream.Close()
+	}
+
+	// Walks name nodes like listings
+	var walked []string
+	err = a.Walk(dir, func(node storage.FileNode) error {
+		walked = append(walked, node.Basename)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	slices.Sort(walked)
+	if !slices.Equal(walked, want) {
+		t.Errorf("expected walk of %q, got %q", want, walked)
+	}
+}
+
+func TestPrivateUseFilenames(t *testing.T) {
+	tmpDir := t.TempDir()
+	// A valid name that looks like an escaped one
+	os.WriteFile(filepath.Join(tmpDir, "\uefe9.txt"), []byte("private"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "\xe9.txt"), []byte("raw"), 0644)
+
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	nodes, err := a.ListContents(url.URL{Scheme: "local", Path: ""})
+	if err != nil {
+		t.Fatalf("ListContents failed: %v", err)
+	}
+	contents := map[string]bool{}
+	for _, node := range nodes {
+		stream, err := a.ReadStream(node.Path)
+		if err != nil {
+			t.Fatalf("ReadStream(%q) failed: %v", node.Path.Path, err)
+		}
+		content, _ := io.ReadAll(stream)
+		stream.Close()
+		contents[string(content)] = true
+	}
+	if len(contents) != 2 || !contents["private"] || !contents["raw"] {
+		t.Errorf("expected both files to be read, got %v", contents)
+	}
+}
+
+func TestLegacyFilenames(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	legacyDir := filepath.Join(tmpDir, "d\xe9j\xe0")
+	if err := os.Mkdir(legacyDir, 0755); err != nil {
+		t.Skipf("filesystem does not support non-UTF-8 names: %v", err)
+	}
+	os.WriteFile(filepath.Join(legacyDir, "caf\xe9.txt"), []byte("legacy"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "café.txt"), []byte("utf8"), 0644)
+
+	t.Run("latin1", func(t *testing.T) {
+		a, err := NewWithConfig(tmpDir, Config{FilenameEncoding: "latin1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer a.Close()
+
+		nodes, err := a.ListContents(url.URL{Scheme: "local", Path: "déjà"})
+		if err != nil {
+			t.Fatalf("ListContents failed: %v", err)
+		}
+		if len(nodes) != 1 || nodes[0].Basename != "café.txt" {
+			t.Fatalf("unexpected nodes: %+v", nodes)
+		}
+
+		stream, err := a.ReadStream(nodes[0].Path)
+		if err != nil {
+			t.Fatalf("ReadStream failed: %v", err)
+		}
+		defer stream.Close()
+		content, _ := io.ReadAll(stream)
+		if string(content) != "legacy" {
+			t.Errorf("expected legacy content, got %q", content)
+		}
+
+		// UTF-8 names take precedence over legacy ones
+		stream, err = a.ReadStream(url.URL{Scheme: "local", Path: "café.txt"})
+		if err != nil {
+			t.Fatalf("ReadStream failed: %v", err)
+		}
+		defer stream.Close()
+		content, _ = io.ReadAll(stream)
+		if string(content) != "utf8" {
+			t.Errorf("expected utf8 content, got %q", content)
+		}
+	})
+
+	t.Run("escaped", func(t *testing.T) {
+		a, err := New(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer a.Close()
+
+		nodes, err := a.ListContents(url.URL{Scheme: "local", Path: "/"})
+		if err != nil {
+			t.Fatalf("ListContents failed: %v", err)
+		}
+
+		var dirPath url.URL
+		for _, node := range nodes {
+			if !utf8.ValidString(node.Basename) {
+				t.Errorf("invalid UTF-8 basename %q", node.Basename)
+			}
+			if node.Type == "dir" {
+				dirPath = node.Path
+			}
+		}
+
+		children, err := a.ListContents(dirPath)
+		if err != nil {
+			t.Fatalf("ListContents of escaped dir failed: %v", err)
+		}
+		if len(children) != 1 {
+			t.Fatalf("expected 1 child, got %d", len(children))
+		}
+
+		size, err := a.FileSize(children[0].Path)
+		if err != nil {
+			t.Fatalf("FileSize failed: %v", err)
+		}
+		if size != int64(len("legacy")) {
+			t.Errorf("expected size %d, got %d", len("legacy"), size)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package local
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// followInterval is how often a followed file is checked for new content
+const followInterval = 250 * time.Millisecond
+
+// FollowStream implements storage.Follower
+// Files are polled for changes, which works the same on every platform and
+// filesystem, including network mounts without change notifications.
+func (s *Storage) FollowStream(vfPath url.URL) (io.ReadSeekCloser, error) {
+	f, err := s.open(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	return &followReader{f: f, closed: make(chan struct{})}, nil
+}
+
+// followReader reads a file, waiting at its end for more content
+type followReader struct {
+	f         *os.File
+	offset    int64
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		r.offset += int64(n)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+
+		info, err := r.f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if info.Size() < r.offset {
+			// Truncated, e.g. by log rotation with copytruncate
+			if _, err := r.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		select {
+		case <-r.closed:
+			return 0, io.EOF
+		case <-time.After(followInterval):
+		}
+	}
+}
+
+func (r *followReader) Seek(offset int64, whence int) (int64, error) {
+	n, err := r.f.Seek(offset, whence)
+	if err == nil {
+		r.offset = n
+	}
+	return n, err
+}
+
+// Close stops waiting reads, it may be called concurrently with Read
+func (r *followReader) Close() error {
+	err := os.ErrClosed
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		err = r.f.Close()
+	})
+	return err
+}
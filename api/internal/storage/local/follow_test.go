@@ -0,0 +1,77 @@
+package local
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollowStream(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "app.log")
+	os.WriteFile(logPath, []byte("first\n"), 0644)
+
+	s, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	stream, err := s.FollowStream(url.URL{Scheme: "local", Path: "app.log"})
+	if err != nil {
+		t.Fatalf("FollowStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	read := func(t *testing.T, expected string) {
+		t.Helper()
+		buf := make([]byte, len(expected))
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if string(buf) != expected {
+			t.Errorf("expected %q, got %q", expected, buf)
+		}
+	}
+
+	t.Run("existing content", func(t *testing.T) {
+		read(t, "first\n")
+	})
+
+	t.Run("appended content", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+			f.WriteString("second\n")
+			f.Close()
+		}()
+		read(t, "second\n")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		os.WriteFile(logPath, []byte("new\n"), 0644)
+		read(t, "new\n")
+	})
+
+	t.Run("close stops waiting", func(t *testing.T) {
+		done := make(chan error)
+		go func() {
+			_, err := stream.Read(make([]byte, 1))
+			done <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		stream.Close()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("expected read to end after close")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("read still waiting after close")
+		}
+	})
+}
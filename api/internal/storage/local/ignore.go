@@ -0,0 +1,42 @@
+package local
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ignoreMatcher matches nodes that are never listed, e.g. ".git" or
+// "node_modules". Patterns use path.Match syntax. Patterns without a slash
+// match the base name at any depth, patterns with a slash match the full path
+// relative to the storage root.
+type ignoreMatcher struct {
+	patterns []string
+}
+
+// newIgnoreMatcher validates the patterns and returns a matcher for them
+func newIgnoreMatcher(patterns []string) (*ignoreMatcher, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	return &ignoreMatcher{patterns: patterns}, nil
+}
+
+// match reports whether the node at relPath (slash separated) is ignored
+func (m *ignoreMatcher) match(relPath string) bool {
+	relPath = strings.TrimPrefix(relPath, "/")
+	name := path.Base(relPath)
+	for _, pattern := range m.patterns {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = relPath
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
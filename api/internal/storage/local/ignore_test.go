@@ -0,0 +1,72 @@
+package local
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m, err := newIgnoreMatcher([]string{".git", "*.tmp", "build/output", ".zfs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{".git", true},
+		{"project/.git", true},
+		{"project/.gitignore", false},
+		{"a/b/c.tmp", true},
+		{"build/output", true},
+		{"/build/output", true},
+		{"src/build/output", false},
+		{"build", false},
+		{"readme.md", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.match(tt.path); got != tt.ignored {
+				t.Errorf("match(%q) = %v, want %v", tt.path, got, tt.ignored)
+			}
+		})
+	}
+
+	if _, err := newIgnoreMatcher([]string{"["}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestListContentsIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "project", ".git"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "project", "node_modules"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "project", "main.go"), []byte("package main"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".DS_Store"), []byte{}, 0644)
+
+	s, err := NewWithConfig(tmpDir, Config{Ignore: []string{".git", "node_modules", ".DS_Store"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	nodes, err := s.ListContents(url.URL{Scheme: "local", Path: "project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Basename != "main.go" {
+		t.Errorf("expected only main.go, got %+v", nodes)
+	}
+
+	nodes, err = s.ListContents(url.URL{Scheme: "local", Path: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Basename != "project" {
+		t.Errorf("expected only project, got %+v", nodes)
+	}
+}
@@ -1,54 +1,214 @@
 package local
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"timeship/internal/storage"
 )
 
-const storageName = "local"
+// defaultStorageName is the storage name used when none is configured
+const defaultStorageName = "local"
+
+// Config holds configuration for the local storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths, defaults to "local"
+	Name string
+
+	// FilenameEncoding is the legacy character encoding of filenames that are
+	// not valid UTF-8, e.g. "latin1" or "shift_jis". If empty, invalid bytes are
+	// escaped instead. See encoding.go for details.
+	FilenameEncoding string
+
+	// TransliterateFilenames converts names decoded from the FilenameEncoding
+	// to ASCII where that's unambiguous, e.g. "café" to "cafe"
+	TransliterateFilenames bool
+
+	// Trash moves deleted nodes to a trash directory instead of removing them.
+	// See trash.go for details.
+	Trash bool
+
+	// TrashRetention is how long trashed nodes are kept before being purged
+	// automatically. Zero keeps them until purged manually.
+	TrashRetention time.Duration
+
+	// Symlinks is the symlink policy, one of SymlinksFollow (default),
+	// SymlinksLink or SymlinksHide. See symlink.go for details.
+	Symlinks string
+
+	// Ignore lists patterns of nodes that are never listed, e.g. ".git".
+	// See ignore.go for the pattern syntax.
+	Ignore []string
+
+	// SnapshotPatterns are tried before the default patterns when parsing
+	// timestamps from ZFS snapshot names. See zfs.go for details.
+	SnapshotPatterns []DateTimePattern
+
+	// SnapshotTimezone is the IANA time zone snapshot names are parsed in,
+	// e.g. "Europe/Berlin". Defaults to local time.
+	SnapshotTimezone string
+
+	// ManageSnapshots allows creating and destroying ZFS snapshots of the
+	// dataset backing the storage
+	ManageSnapshots bool
+
+	// Fsync flushes written files and their directories to disk before a
+	// write is reported as complete. Slower, but survives power loss.
+	Fsync bool
+}
 
 // Storage implements storage interfaces for local filesystem
 type Storage struct {
+	name     string
 	root     *os.Root
 	rootPath string
 	zfs      *ZFS
+	codec    *filenameCodec
+	owners   *ownerCache
+	ignore   *ignoreMatcher
+
+	trashEnabled   bool
+	trashRetention time.Duration
+	fsync          bool
+	symlinks       string
+
+	manageSnapshots bool
+
+	// stop is closed to stop background goroutines
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
-// New creates a new local filesystem storage
+// New creates a new local filesystem storage with default configuration
 func New(rootPath string) (*Storage, error) {
+	return NewWithConfig(rootPath, Config{})
+}
+
+// NewWithConfig creates a new local filesystem storage with custom configuration
+func NewWithConfig(rootPath string, config Config) (*Storage, error) {
+	name := config.Name
+	if name == "" {
+		name = defaultStorageName
+	}
+
+	symlinks := config.Symlinks
+	if symlinks == "" {
+		symlinks = SymlinksFollow
+	}
+	if err := validSymlinkPolicy(symlinks); err != nil {
+		return nil, err
+	}
+
+	codec, err := newFilenameCodec(config.FilenameEncoding, config.TransliterateFilenames)
+	if err != nil {
+		return nil, err
+	}
+
+	ignore, err := newIgnoreMatcher(config.Ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range config.SnapshotPatterns {
+		if err := pattern.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	patterns := append(slices.Clone(config.SnapshotPatterns), DefaultDateTimePatterns()...)
+
+	location := time.Local
+	if config.SnapshotTimezone != "" {
+		location, err = time.LoadLocation(config.SnapshotTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot timezone %q: %w", config.SnapshotTimezone, err)
+		}
+	}
+
 	// Open the root directory with os.OpenRoot for traversal-resistant operations
 	root, err := os.OpenRoot(rootPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Storage{
-		root:     root,
-		rootPath: rootPath,
-		zfs:      NewZFS(rootPath),
-	}, nil
+	s := &Storage{
+		name:           name,
+		root:           root,
+		rootPath:       rootPath,
+		zfs:            NewZFSWithConfig(rootPath, ZFSConfig{DateTimePatterns: patterns, Location: location}),
+		codec:          codec,
+		owners:         newOwnerCache(),
+		ignore:         ignore,
+		trashEnabled:   config.Trash,
+		trashRetention: config.TrashRetention,
+		fsync:          config.Fsync,
+		symlinks:       symlinks,
+
+		manageSnapshots: config.ManageSnapshots,
+		stop:            make(chan struct{}),
+	}
+
+	if s.trashEnabled && s.trashRetention > 0 {
+		go s.runTrashRetention()
+	}
+
+	return s, nil
 }
 
-// Close closes the root directory handle
+// Close stops background tasks and closes the root directory handle
 func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
 	return s.root.Close()
 }
 
+// CheckHealth implements storage.HealthChecker
+// Stats the root by path, which fails if it was unmounted or went stale
+func (s *Storage) CheckHealth() error {
+	info, err := os.Stat(s.rootPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "stat", Path: s.rootPath, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+// ZFSHealth implements storage.ZFSHealthReporter
+func (s *Storage) ZFSHealth() (storage.ZFSHealth, error) {
+	return s.zfs.Health()
+}
+
+// SnapshotSpace implements storage.SnapshotSpaceReporter
+func (s *Storage) SnapshotSpace() (storage.SnapshotSpace, error) {
+	return s.zfs.SnapshotSpace()
+}
+
 // GetRootPath returns the root path of this storage
 func (s *Storage) GetRootPath() string {
 	return s.rootPath
 }
 
+// urlToRelPath converts the slash-separated path of a URL to an on-disk path
+// relative to the storage root
 func (s *Storage) urlToRelPath(vfPath url.URL) (string, error) {
-	if vfPath.Scheme != storageName {
+	if vfPath.Scheme != s.name {
 		return "", fmt.Errorf("unexpected storage scheme: %s", vfPath.Scheme)
 	}
 	path := vfPath.Path
@@ -60,13 +220,75 @@ func (s *Storage) urlToRelPath(vfPath url.URL) (string, error) {
 	if path == "" {
 		path = "."
 	}
+	if runtime.GOOS == "windows" {
+		if err := checkWindowsPath(path); err != nil {
+			return "", err
+		}
+	}
+	path = filepath.FromSlash(path)
 	if !filepath.IsLocal(path) {
-		return "", fmt.Errorf("non-local paths are not supported: %s", path)
+		return "", fmt.Errorf("%w: %s", storage.ErrOutsideRoot, path)
 	}
 	path = filepath.Clean(path)
+	// The trash is only accessible through the Trasher interface. Names are
+	// compared case-insensitively, as they are on Windows and macOS.
+	first, _, _ := strings.Cut(path, string(filepath.Separator))
+	if strings.EqualFold(first, trashDir) {
+		return "", &fs.PathError{Op: "open", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
 	return path, nil
 }
 
+// checkWindowsPath fails if a slash-separated path could refer to another
+// node on Windows than it says: backslashes are separators there, colons
+// select drives and alternate data streams, and trailing dots and spaces are
+// dropped from names, so e.g. "a\b", "C:/b", "a:b" and "a./b" are rejected
+func checkWindowsPath(p string) error {
+	if strings.ContainsAny(p, `\:`) {
+		return fmt.Errorf("backslashes and colons are not supported in paths: %s", p)
+	}
+	for _, name := range strings.Split(p, "/") {
+		if name == "." || name == ".." {
+			continue
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			return fmt.Errorf("names ending with a dot or space are not supported: %s", p)
+		}
+	}
+	return nil
+}
+
+// writablePath converts a path to an on-disk relative path for modification.
+// Snapshots are read-only and the storage root can't be modified.
+func (s *Storage) writablePath(vfPath url.URL) (string, error) {
+	if vfPath.Query().Get("snapshot") != "" {
+		return "", &fs.PathError{Op: "write", Path: vfPath.Path, Err: fs.ErrPermission}
+	}
+	relPath, err := s.urlToRelPath(vfPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to convert path: %w", err)
+	}
+	if relPath == "." || isTempName(filepath.Base(relPath)) {
+		return "", &fs.PathError{Op: "write", Path: vfPath.Path, Err: fs.ErrPermission}
+	}
+	return s.codec.resolve(s.root, relPath), nil
+}
+
+// pathRoot returns the root containing a path and the resolved on-disk path
+// within it. For snapshots this is the snapshot directory, which the caller
+// must close, otherwise the storage's root.
+func (s *Storage) pathRoot(vfPath url.URL, relPath string) (*os.Root, string, error) {
+	snapshotID := vfPath.Query().Get("snapshot")
+	if snapshotID == "" {
+		return s.root, s.codec.resolve(s.root, relPath), nil
+	}
+	root, snapshotRelPath, err := s.zfs.SnapshotRoot(relPath, snapshotID)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to open: %w", err)
+	}
+	return root, s.codec.resolve(root, snapshotRelPath), nil
+}
+
 // open opens a file or directory, handling both normal paths and snapshots
 // For snapshots: opens from the snapshot directory
 // For normal paths: opens from the storage's root
@@ -76,16 +298,26 @@ func (s *Storage) open(vfPath url.URL) (*os.File, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to convert path: %w", err)
 	}
-	snapshotID := vfPath.Query().Get("snapshot")
-	if snapshotID == "" {
-		return s.root.Open(relPath)
+	root, relPath, err := s.pathRoot(vfPath, relPath)
+	if err != nil {
+		return nil, err
 	}
-	root, snapshotRelPath, err := s.zfs.SnapshotRoot(relPath, snapshotID)
+	if root != s.root {
+		defer root.Close()
+	}
+	if err := s.checkSymlinks(root, relPath); err != nil {
+		return nil, err
+	}
+	// Opening FIFOs blocks until there is a writer and opening devices may
+	// have side effects, so only directories and regular files are opened
+	info, err := root.Stat(relPath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open: %w", err)
+		return nil, err
 	}
-	defer root.Close()
-	return root.Open(snapshotRelPath)
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil, &fs.PathError{Op: "open", Path: vfPath.Path, Err: storage.ErrSpecialFile}
+	}
+	return root.Open(relPath)
 }
 
 // stat gets file info, handling both normal paths and snapshots
@@ -94,16 +326,33 @@ func (s *Storage) stat(vfPath url.URL) (os.FileInfo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to convert path: %w", err)
 	}
-	snapshotID := vfPath.Query().Get("snapshot")
-	if snapshotID == "" {
-		return s.root.Stat(relPath)
+	root, relPath, err := s.pathRoot(vfPath, relPath)
+	if err != nil {
+		return nil, err
 	}
-	root, snapshotRelPath, err := s.zfs.SnapshotRoot(relPath, snapshotID)
+	if root != s.root {
+		defer root.Close()
+	}
+	if err := s.checkSymlinks(root, relPath); err != nil {
+		return nil, err
+	}
+	return root.Stat(relPath)
+}
+
+// readlink returns the target of a symbolic link, handling both normal paths and snapshots
+func (s *Storage) readlink(vfPath url.URL) (string, error) {
+	relPath, err := s.urlToRelPath(vfPath)
 	if err != nil {
-		return nil, fmt.Errorf("unable to open: %w", err)
+		return "", fmt.Errorf("unable to convert path: %w", err)
+	}
+	root, relPath, err := s.pathRoot(vfPath, relPath)
+	if err != nil {
+		return "", err
 	}
-	defer root.Close()
-	return root.Stat(snapshotRelPath)
+	if root != s.root {
+		defer root.Close()
+	}
+	return root.Readlink(relPath)
 }
 
 // ListContents implements storage.Lister
@@ -120,31 +369,87 @@ func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
 		return nil, err
 	}
 
+	isRoot := strings.Trim(vfPath.Path, "/") == ""
+
+	// Names that aren't valid UTF-8 are decoded or escaped
+	names := make([]string, len(entries))
+	for i, info := range entries {
+		names[i] = info.Name()
+	}
+	decoded := s.codec.decodeDir(names)
+
 	nodes := make([]storage.FileNode, 0, len(entries))
-	for _, info := range entries {
+	for i, info := range entries {
+		if isRoot && info.Name() == trashDir {
+			continue
+		}
+		// Files being written are not visible until complete
+		if isTempName(info.Name()) {
+			continue
+		}
+
+		name := decoded[i]
+
 		// Build the full path with storage prefix
 		// Always remove leading slash to avoid local:///path issues
 		filePath := vfPath
-		joinedPath := path.Join(vfPath.Path, info.Name())
+		joinedPath := path.Join(vfPath.Path, name)
 		filePath.Path = strings.TrimPrefix(joinedPath, "/")
 		filePath.RawQuery = ""
 
+		if s.ignore.match(filePath.Path) {
+			continue
+		}
+
+		// childPath keeps the snapshot for accessing the child
+		childPath := vfPath
+		childPath.Path = filePath.Path
+
 		node := storage.FileNode{
-			Path:         filePath,
-			Basename:     info.Name(),
-			LastModified: info.ModTime().Unix(),
+			Path:     filePath,
+			Basename: name,
+			Mode:     info.Mode(),
 		}
+		node.Owner, node.Group = fileOwner(info)
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if s.symlinks == SymlinksHide {
+				continue
+			}
 
-		if info.IsDir() {
+			target, err := s.readlink(childPath)
+			if err != nil {
+				log.Printf("Failed to read link %s: %v", filePath.String(), err)
+			}
+			node.LinkTarget = target
+
+			// Followed links are listed as their target, broken links or
+			// links escaping the root are listed as links
+			if s.symlinks == SymlinksFollow {
+				if targetInfo, err := s.stat(childPath); err == nil {
+					info = targetInfo
+				}
+			}
+		}
+
+		node.LastModified = info.ModTime().Unix()
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			node.Type = "link"
+		case info.IsDir():
 			node.Type = "dir"
-		} else {
+		case !info.Mode().IsRegular():
+			node.Type = "special"
+		default:
 			node.Type = "file"
-			node.Extension = strings.TrimPrefix(path.Ext(info.Name()), ".")
+			node.Extension = strings.TrimPrefix(path.Ext(name), ".")
 			node.Size = info.Size()
+			node.AllocatedSize, node.FileID = fileUsage(info)
 
 			// Detect MIME type
 			if node.Extension != "" {
-				mimeType, _ := s.MimeType(node.Path)
+				mimeType, _ := s.MimeType(childPath)
 				node.MimeType = mimeType
 			}
 		}
@@ -187,16 +492,204 @@ func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
 	return info.ModTime().Unix(), nil
 }
 
+// NodeType implements storage.NodeTyper
+func (s *Storage) NodeType(vfPath url.URL) (string, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case info.IsDir():
+		return "dir", nil
+	case info.Mode().IsRegular():
+		return "file", nil
+	default:
+		return "special", nil
+	}
+}
+
+// Version implements storage.Versioner
+// Writes replace files, so the inode changes with every write even if the
+// modification time is too coarse to tell writes apart
+func (s *Storage) Version(vfPath url.URL) (string, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return "", err
+	}
+	version := strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36)
+	if inode := fileInode(info); inode != 0 {
+		version += "-" + strconv.FormatUint(inode, 36)
+	}
+	return version, nil
+}
+
+// Identity implements storage.Identifier
+// Renames keep the device and inode, unless the node is moved to another
+// file system mounted below the root
+func (s *Storage) Identity(vfPath url.URL) (string, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return "", err
+	}
+	id := fileIdentity(info)
+	if id == "" {
+		return "", storage.ErrNotSupported
+	}
+	return id, nil
+}
+
+// NodeTimes implements storage.TimeStater
+func (s *Storage) NodeTimes(vfPath url.URL) (storage.NodeTimes, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return storage.NodeTimes{}, err
+	}
+	// Only directories and regular files can be opened safely
+	var open func() (*os.File, error)
+	if info.IsDir() || info.Mode().IsRegular() {
+		open = func() (*os.File, error) { return s.open(vfPath) }
+	}
+	created, changed := fileTimes(info, open)
+	return storage.NodeTimes{Created: created, Changed: changed}, nil
+}
+
 // ReadStream implements storage.Reader
 func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
 	return s.open(vfPath)
 }
 
+// CreateFile implements storage.Creator
+// Creates an empty file, failing if a node already exists at the path
+func (s *Storage) CreateFile(vfPath url.URL) error {
+	relPath, err := s.writablePath(vfPath)
+	if err != nil {
+		return err
+	}
+	f, err := s.root.OpenFile(relPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if s.fsync {
+		return s.syncDir(filepath.Dir(relPath))
+	}
+	return nil
+}
+
+// CreateDirectory implements storage.Creator
+// Creates a directory, failing if a node already exists at the path
+func (s *Storage) CreateDirectory(vfPath url.URL) error {
+	relPath, err := s.writablePath(vfPath)
+	if err != nil {
+		return err
+	}
+	if err := s.root.Mkdir(relPath, 0755); err != nil {
+		return err
+	}
+	if s.fsync {
+		return s.syncDir(filepath.Dir(relPath))
+	}
+	return nil
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(vfPath url.URL) (bool, error) {
+	info, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// DirectoryExists implements storage.Existence
+func (s *Storage) DirectoryExists(vfPath url.URL) (bool, error) {
+	info, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// Delete implements storage.Deleter
+// Removes a file or an empty directory, or moves it to the trash if enabled
+func (s *Storage) Delete(vfPath url.URL) error {
+	relPath, err := s.writablePath(vfPath)
+	if err != nil {
+		return err
+	}
+
+	if !s.trashEnabled {
+		return s.root.Remove(relPath)
+	}
+
+	// Match the semantics of Remove, which refuses non-empty directories
+	info, err := s.root.Lstat(relPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		f, err := s.root.Open(relPath)
+		if err != nil {
+			return err
+		}
+		names, _ := f.Readdirnames(1)
+		f.Close()
+		if len(names) > 0 {
+			return &fs.PathError{Op: "remove", Path: vfPath.Path, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	return s.trash(relPath, strings.TrimPrefix(vfPath.Path, "/"))
+}
+
+// DeleteDirectory implements storage.Deleter
+// Removes a file or directory recursively, or moves it to the trash if enabled
+func (s *Storage) DeleteDirectory(vfPath url.URL) error {
+	relPath, err := s.writablePath(vfPath)
+	if err != nil {
+		return err
+	}
+
+	if s.trashEnabled {
+		return s.trash(relPath, strings.TrimPrefix(vfPath.Path, "/"))
+	}
+
+	// RemoveAll succeeds for missing paths, but callers expect an error
+	if _, err := s.root.Lstat(relPath); err != nil {
+		return err
+	}
+	return s.root.RemoveAll(relPath)
+}
+
 // GetSnapshots implements storage.SnapshotProvider
 func (s *Storage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
 	relPath, err := s.urlToRelPath(vfPath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to convert path: %w", err)
 	}
-	return s.zfs.Snapshots(relPath)
+	return s.zfs.Snapshots(s.codec.resolve(s.root, relPath))
+}
+
+// CreateSnapshot implements storage.SnapshotManager
+func (s *Storage) CreateSnapshot(name string) (storage.Snapshot, error) {
+	if !s.manageSnapshots {
+		return storage.Snapshot{}, fmt.Errorf("snapshot management is disabled: %w", fs.ErrPermission)
+	}
+	return s.zfs.CreateSnapshot(name)
+}
+
+// DestroySnapshot implements storage.SnapshotManager
+func (s *Storage) DestroySnapshot(id string) error {
+	if !s.manageSnapshots {
+		return fmt.Errorf("snapshot management is disabled: %w", fs.ErrPermission)
+	}
+	return s.zfs.DestroySnapshot(id)
 }
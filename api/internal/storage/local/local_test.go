@@ -1,10 +1,16 @@
 package local
 
 import (
+	"errors"
 	"io"
+	"io/fs"
+	"net"
 	"net/url"
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -278,6 +284,53 @@ func TestPathTraversalPrevention(t *testing.T) {
 	})
 }
 
+func TestCheckWindowsPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+	}{
+		{"docs/report.txt", true},
+		{".", true},
+		{"a/../b", true},
+		{".hidden/file", true},
+		{`docs\report.txt`, false},
+		{`\\server\share`, false},
+		{"C:/Windows", false},
+		{"C:", false},
+		{"file.txt:stream", false},
+		{"docs./report.txt", false},
+		{"report.txt ", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := checkWindowsPath(tt.path)
+			if tt.valid && err != nil {
+				t.Errorf("expected %q to be valid, got: %v", tt.path, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected %q to be rejected", tt.path)
+			}
+		})
+	}
+}
+
+func TestTrashNotAccessibleByPath(t *testing.T) {
+	a, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, p := range []string{trashDir, trashDir + "/files", strings.ToUpper(trashDir), "/" + trashDir + "/info"} {
+		if _, err := a.urlToRelPath(url.URL{Scheme: "local", Path: p}); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %q to not exist, got: %v", p, err)
+		}
+	}
+	if _, err := a.urlToRelPath(url.URL{Scheme: "local", Path: "docs/" + trashDir}); err != nil {
+		t.Errorf("expected nested trash name to be accessible, got: %v", err)
+	}
+}
+
 func TestMimeType(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -352,6 +405,40 @@ func TestFileSize(t *testing.T) {
 	})
 }
 
+func TestVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("first"), 0644)
+
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	vfPath := url.URL{Scheme: "local", Path: "/test.txt"}
+	before, err := a.Version(vfPath)
+	if err != nil {
+		t.Fatalf("Version failed: %v", err)
+	}
+	if again, _ := a.Version(vfPath); again != before {
+		t.Errorf("expected unchanged version %q, got %q", before, again)
+	}
+
+	// Same size within the same second still changes the version
+	if err := a.WriteStream(vfPath, strings.NewReader("other")); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := a.Version(vfPath); after == before {
+		t.Errorf("expected version to change on write, got %q", after)
+	}
+
+	t.Run("non-existent file", func(t *testing.T) {
+		if _, err := a.Version(url.URL{Scheme: "local", Path: "/nonexistent.txt"}); err == nil {
+			t.Error("expected error for non-existent file")
+		}
+	})
+}
+
 func TestReadStream(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -436,4 +523,226 @@ func TestImplementsInterfaces(t *testing.T) {
 	// Test that storage implements the expected interfaces
 	var _ storage.Lister = a
 	var _ storage.Reader = a
+	var _ storage.Versioner = a
+}
+
+func TestCreate(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "existing.txt"), []byte("x"), 0644)
+
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.CreateDirectory(url.URL{Scheme: "local", Path: "docs"}); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	if exists, _ := a.DirectoryExists(url.URL{Scheme: "local", Path: "docs"}); !exists {
+		t.Error("expected directory to exist")
+	}
+
+	if err := a.CreateFile(url.URL{Scheme: "local", Path: "docs/new.txt"}); err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if exists, _ := a.FileExists(url.URL{Scheme: "local", Path: "docs/new.txt"}); !exists {
+		t.Error("expected file to exist")
+	}
+	if exists, _ := a.DirectoryExists(url.URL{Scheme: "local", Path: "docs/new.txt"}); exists {
+		t.Error("expected file not to be reported as directory")
+	}
+	if exists, err := a.FileExists(url.URL{Scheme: "local", Path: "missing.txt"}); exists || err != nil {
+		t.Errorf("expected missing file to not exist, got %v %v", exists, err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func(url.URL) error
+		path url.URL
+		err  error
+	}{
+		{"existing file", a.CreateFile, url.URL{Scheme: "local", Path: "existing.txt"}, fs.ErrExist},
+		{"existing directory", a.CreateDirectory, url.URL{Scheme: "local", Path: "docs"}, fs.ErrExist},
+		{"missing parent", a.CreateDirectory, url.URL{Scheme: "local", Path: "missing/dir"}, fs.ErrNotExist},
+		{"root", a.CreateDirectory, url.URL{Scheme: "local", Path: ""}, fs.ErrPermission},
+		{"snapshot", a.CreateFile, url.URL{Scheme: "local", Path: "a.txt", RawQuery: "snapshot=zfs:daily"}, fs.ErrPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fn(tt.path); !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestListContentsPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership and symlinks are not supported on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("x"), 0640)
+	os.Chmod(filepath.Join(tmpDir, "file.txt"), 0640)
+	os.Symlink("file.txt", filepath.Join(tmpDir, "link"))
+
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	nodes, err := a.ListContents(url.URL{Scheme: "local", Path: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]storage.FileNode{}
+	for _, n := range nodes {
+		byName[n.Basename] = n
+	}
+
+	file := byName["file.txt"]
+	if file.Mode.Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %o", file.Mode.Perm())
+	}
+	// Listings carry the numeric IDs, resolved only on request
+	if file.Owner != strconv.Itoa(os.Getuid()) || file.Group != strconv.Itoa(os.Getgid()) {
+		t.Errorf("expected owner %d and group %d, got %q %q", os.Getuid(), os.Getgid(), file.Owner, file.Group)
+	}
+	if u, err := user.Current(); err == nil {
+		if owner, _ := a.ResolveOwner(file.Owner, file.Group); owner != u.Username {
+			t.Errorf("expected owner %q, got %q", u.Username, owner)
+		}
+	}
+	if file.LinkTarget != "" {
+		t.Errorf("expected no link target, got %q", file.LinkTarget)
+	}
+
+	if link := byName["link"]; link.LinkTarget != "file.txt" {
+		t.Errorf("expected link target file.txt, got %q", link.LinkTarget)
+	}
+}
+
+func TestSpecialFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix sockets are listed as regular files on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("x"), 0644)
+	ln, err := net.Listen("unix", filepath.Join(tmpDir, "app.sock"))
+	if err != nil {
+		t.Skipf("unable to create socket: %v", err)
+	}
+	defer ln.Close()
+
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	nodes, err := a.ListContents(url.URL{Scheme: "local", Path: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]string{}
+	for _, n := range nodes {
+		types[n.Basename] = n.Type
+	}
+	if types["app.sock"] != "special" || types["file.txt"] != "file" {
+		t.Errorf("expected socket to be special and file to be a file, got %v", types)
+	}
+
+	if _, err := a.ReadStream(url.URL{Scheme: "local", Path: "app.sock"}); !errors.Is(err, storage.ErrSpecialFile) {
+		t.Errorf("expected ErrSpecialFile reading socket, got %v", err)
+	}
+
+	var walked string
+	err = a.Walk(url.URL{Scheme: "local", Path: ""}, func(node storage.FileNode) error {
+		if node.Basename == "app.sock" {
+			walked = node.Type
+		}
+		return nil
+	})
+	if err != nil || walked != "special" {
+		t.Errorf("expected walked socket to be special, got %q: %v", walked, err)
+	}
+}
+
+func TestNodeType(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("x"), 0644)
+
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for p, want := range map[string]string{"": "dir", "docs": "dir", "docs/a.txt": "file"} {
+		if typ, err := a.NodeType(url.URL{Scheme: "local", Path: p}); err != nil || typ != want {
+			t.Errorf("expected %q to be a %s, got %q: %v", p, want, typ, err)
+		}
+	}
+	if _, err := a.NodeType(url.URL{Scheme: "local", Path: "missing"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected missing node not to exist, got %v", err)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inodes are not available on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "b.txt"), []byte("b"), 0644)
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	before, err := a.Identity(url.URL{Scheme: "local", Path: "a.txt"})
+	if err != nil || before == "" {
+		t.Fatalf("expected identity, got %q, %v", before, err)
+	}
+	if other, _ := a.Identity(url.URL{Scheme: "local", Path: "b.txt"}); other == before {
+		t.Errorf("expected files to have different identities, got %q", other)
+	}
+	os.Rename(filepath.Join(tmpDir, "a.txt"), filepath.Join(tmpDir, "c.txt"))
+	if after, err := a.Identity(url.URL{Scheme: "local", Path: "c.txt"}); after != before {
+		t.Errorf("expected identity to survive the rename, got %q, %v", after, err)
+	}
+}
+
+func TestNodeTimes(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("a"), 0644)
+	a, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, p := range []string{"docs", "docs/a.txt"} {
+		times, err := a.NodeTimes(url.URL{Scheme: "local", Path: p})
+		if err != nil {
+			t.Fatalf("failed to get times of %s: %v", p, err)
+		}
+		if runtime.GOOS != "windows" && times.Changed <= 0 {
+			t.Errorf("expected change time of %s, got %+v", p, times)
+		}
+		if times.Created < 0 || times.Changed < 0 {
+			t.Errorf("unexpected times of %s: %+v", p, times)
+		}
+	}
+	if _, err := a.NodeTimes(url.URL{Scheme: "local", Path: "missing"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected missing node not to exist, got %v", err)
+	}
 }
@@ -0,0 +1,64 @@
+package local
+
+import (
+	"os/user"
+	"sync"
+)
+
+// ownerCache resolves numeric user and group IDs to names. Lookups can be slow
+// (e.g. with LDAP), so results are cached for the lifetime of the storage.
+type ownerCache struct {
+	mu     sync.Mutex
+	users  map[string]string
+	groups map[string]string
+}
+
+// ResolveOwner implements storage.OwnerResolver
+func (s *Storage) ResolveOwner(owner, group string) (string, string) {
+	if owner != "" {
+		owner = s.owners.user(owner)
+	}
+	if group != "" {
+		group = s.owners.group(group)
+	}
+	return owner, group
+}
+
+func newOwnerCache() *ownerCache {
+	return &ownerCache{
+		users:  map[string]string{},
+		groups: map[string]string{},
+	}
+}
+
+// user returns the name of the user, or the ID if it can't be resolved
+func (c *ownerCache) user(id string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if name, ok := c.users[id]; ok {
+		return name
+	}
+	name := id
+	if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+	c.users[id] = name
+	return name
+}
+
+// group returns the name of the group, or the ID if it can't be resolved
+func (c *ownerCache) group(id string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if name, ok := c.groups[id]; ok {
+		return name
+	}
+	name := id
+	if g, err := user.LookupGroupId(id); err == nil {
+		name = g.Name
+	}
+	c.groups[id] = name
+	return name
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package local
+
+import "io/fs"
+
+// fileOwner is not supported on this platform, ownership is not a
+// uid/gid pair outside of Unix
+func fileOwner(info fs.FileInfo) (string, string) {
+	return "", ""
+}
+
+// fileIDs is not supported on this platform
+func fileIDs(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// fileInode is not supported on this platform
+func fileInode(info fs.FileInfo) uint64 {
+	return 0
+}
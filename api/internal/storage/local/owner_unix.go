@@ -0,0 +1,37 @@
+//go:build unix
+
+package local
+
+import (
+	"io/fs"
+	"strconv"
+	"syscall"
+)
+
+// fileOwner returns the numeric owner user and group of a file, resolved to
+// names by ResolveOwner
+func fileOwner(info fs.FileInfo) (string, string) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", ""
+	}
+	return strconv.FormatUint(uint64(st.Uid), 10), strconv.FormatUint(uint64(st.Gid), 10)
+}
+
+// fileIDs returns the numeric owner user and group of a file
+func fileIDs(info fs.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// fileInode returns the inode number of a file, or 0 if unknown
+func fileInode(info fs.FileInfo) uint64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(st.Ino)
+}
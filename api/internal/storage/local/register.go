@@ -0,0 +1,29 @@
+package local
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("local", func(sc config.StorageConfig) (storage.Storage, error) {
+		patterns := make([]DateTimePattern, len(sc.SnapshotPatterns))
+		for i, p := range sc.SnapshotPatterns {
+			patterns[i] = DateTimePattern{Regex: p.Regex, Layout: p.Layout, Timezone: p.Timezone}
+		}
+		return NewWithConfig(sc.Root, Config{
+			Name:                   sc.Name,
+			FilenameEncoding:       sc.FilenameEncoding,
+			TransliterateFilenames: sc.TransliterateFilenames,
+			Trash:                  sc.Trash,
+			TrashRetention:         sc.TrashRetention,
+			Fsync:                  sc.Fsync,
+			Symlinks:               sc.Symlinks,
+			Ignore:                 sc.Ignore,
+			ManageSnapshots:        sc.ManageSnapshots,
+			SnapshotPatterns:       patterns,
+			SnapshotTimezone:       sc.SnapshotTimezone,
+		})
+	})
+}
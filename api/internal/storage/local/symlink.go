@@ -0,0 +1,62 @@
+package local
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Symlinks
+//
+// The symlink policy controls how symbolic links are exposed:
+//
+//	follow  links are resolved and listed as their target (default)
+//	link    links are listed as "link" nodes with their target, but not followed
+//	hide    links are omitted from listings and not followed
+//
+// The policy applies to both live paths and snapshots. Links are never followed
+// outside of the storage root regardless of the policy.
+
+const (
+	SymlinksFollow = "follow"
+	SymlinksLink   = "link"
+	SymlinksHide   = "hide"
+)
+
+// validSymlinkPolicy checks that policy is a known symlink policy
+func validSymlinkPolicy(policy string) error {
+	switch policy {
+	case SymlinksFollow, SymlinksLink, SymlinksHide:
+		return nil
+	default:
+		return fmt.Errorf("unknown symlink policy %q, expected %q, %q or %q", policy, SymlinksFollow, SymlinksLink, SymlinksHide)
+	}
+}
+
+// checkSymlinks fails if any component of relPath is a symlink and the policy
+// doesn't allow following them
+func (s *Storage) checkSymlinks(root *os.Root, relPath string) error {
+	if s.symlinks == SymlinksFollow || relPath == "." {
+		return nil
+	}
+
+	current := ""
+	for _, part := range strings.Split(relPath, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := root.Lstat(current)
+		if err != nil {
+			// Missing paths are reported by the actual operation
+			return nil
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if s.symlinks == SymlinksHide {
+			return &fs.PathError{Op: "open", Path: relPath, Err: fs.ErrNotExist}
+		}
+		return &fs.PathError{Op: "open", Path: relPath, Err: fs.ErrPermission}
+	}
+	return nil
+}
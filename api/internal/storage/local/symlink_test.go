@@ -0,0 +1,148 @@
+package local
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"timeship/internal/storage"
+)
+
+func TestSymlinkPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "dir"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "dir", "file.txt"), []byte("hello"), 0644)
+	os.Symlink("dir", filepath.Join(tmpDir, "dirlink"))
+	os.Symlink("dir/file.txt", filepath.Join(tmpDir, "filelink"))
+	os.Symlink("missing", filepath.Join(tmpDir, "broken"))
+	os.Symlink("/etc", filepath.Join(tmpDir, "escape"))
+
+	list := func(t *testing.T, s *Storage) map[string]storage.FileNode {
+		nodes, err := s.ListContents(url.URL{Scheme: "local", Path: ""})
+		if err != nil {
+			t.Fatal(err)
+		}
+		byName := map[string]storage.FileNode{}
+		for _, n := range nodes {
+			byName[n.Basename] = n
+		}
+		return byName
+	}
+
+	t.Run("follow", func(t *testing.T) {
+		s, err := New(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		nodes := list(t, s)
+		expected := map[string]string{
+			"dirlink":  "dir",
+			"filelink": "file",
+			"broken":   "link",
+			"escape":   "link",
+		}
+		for name, typ := range expected {
+			if nodes[name].Type != typ {
+				t.Errorf("expected %s to be %s, got %q", name, typ, nodes[name].Type)
+			}
+		}
+		if nodes["filelink"].Size != 5 {
+			t.Errorf("expected followed link size 5, got %d", nodes["filelink"].Size)
+		}
+		if nodes["dirlink"].LinkTarget != "dir" {
+			t.Errorf("expected link target dir, got %q", nodes["dirlink"].LinkTarget)
+		}
+
+		if _, err := s.ListContents(url.URL{Scheme: "local", Path: "dirlink"}); err != nil {
+			t.Errorf("expected to list through link: %v", err)
+		}
+		if _, err := s.ListContents(url.URL{Scheme: "local", Path: "escape"}); err == nil {
+			t.Error("expected link escaping the root to fail")
+		}
+	})
+
+	t.Run("link", func(t *testing.T) {
+		s, err := NewWithConfig(tmpDir, Config{Symlinks: SymlinksLink})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		nodes := list(t, s)
+		for _, name := range []string{"dirlink", "filelink", "broken", "escape"} {
+			if nodes[name].Type != "link" {
+				t.Errorf("expected %s to be link, got %q", name, nodes[name].Type)
+			}
+		}
+		if nodes["filelink"].LinkTarget != "dir/file.txt" {
+			t.Errorf("expected link target dir/file.txt, got %q", nodes["filelink"].LinkTarget)
+		}
+
+		for _, p := range []string{"filelink", "dirlink/file.txt"} {
+			if _, err := s.ReadStream(url.URL{Scheme: "local", Path: p}); !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("expected permission error for %s, got %v", p, err)
+			}
+		}
+		if _, err := s.ReadStream(url.URL{Scheme: "local", Path: "dir/file.txt"}); err != nil {
+			t.Errorf("expected regular file to be readable: %v", err)
+		}
+	})
+
+	t.Run("hide", func(t *testing.T) {
+		s, err := NewWithConfig(tmpDir, Config{Symlinks: SymlinksHide})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		nodes := list(t, s)
+		if len(nodes) != 1 || nodes["dir"].Type != "dir" {
+			t.Errorf("expected only dir, got %+v", nodes)
+		}
+		if _, err := s.FileSize(url.URL{Scheme: "local", Path: "filelink"}); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist error, got %v", err)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		snapDir := t.TempDir()
+		daily := filepath.Join(snapDir, ".zfs", "snapshot", "daily")
+		os.MkdirAll(daily, 0755)
+		os.WriteFile(filepath.Join(daily, "file.txt"), []byte("old"), 0644)
+		os.Symlink("file.txt", filepath.Join(daily, "filelink"))
+
+		s, err := NewWithConfig(snapDir, Config{Symlinks: SymlinksHide})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		nodes, err := s.ListContents(url.URL{Scheme: "local", Path: "", RawQuery: "snapshot=zfs:daily"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 || nodes[0].Basename != "file.txt" {
+			t.Errorf("expected only file.txt, got %+v", nodes)
+		}
+		_, err = s.ReadStream(url.URL{Scheme: "local", Path: "filelink", RawQuery: "snapshot=zfs:daily"})
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist error, got %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewWithConfig(tmpDir, Config{Symlinks: "maybe"}); err == nil {
+			t.Error("expected error for unknown policy")
+		}
+	})
+}
@@ -0,0 +1,19 @@
+//go:build darwin || freebsd || netbsd
+
+package local
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// fileTimes returns the birth and change times of a file, which stat
+// reports on this platform
+func fileTimes(info fs.FileInfo, open func() (*os.File, error)) (created, changed int64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return int64(st.Birthtimespec.Sec), int64(st.Ctimespec.Sec)
+}
@@ -0,0 +1,39 @@
+package local
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileTimes returns the birth and change times of a file. Linux only
+// reports birth times through statx, on the file opened by open if the file
+// system records them.
+func fileTimes(info fs.FileInfo, open func() (*os.File, error)) (created, changed int64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		changed = int64(st.Ctim.Sec)
+	}
+	if open == nil {
+		return 0, changed
+	}
+	f, err := open()
+	if err != nil {
+		return 0, changed
+	}
+	defer f.Close()
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, changed
+	}
+	var stx unix.Statx_t
+	var statErr error
+	conn.Control(func(fd uintptr) {
+		statErr = unix.Statx(int(fd), "", unix.AT_EMPTY_PATH, unix.STATX_BTIME, &stx)
+	})
+	if statErr == nil && stx.Mask&unix.STATX_BTIME != 0 {
+		created = int64(stx.Btime.Sec)
+	}
+	return created, changed
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package local
+
+import (
+	"io/fs"
+	"os"
+)
+
+// fileTimes is not supported on this platform, nodes are reported without
+// birth and change times
+func fileTimes(info fs.FileInfo, open func() (*os.File, error)) (created, changed int64) {
+	return 0, 0
+}
@@ -0,0 +1,17 @@
+package local
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// fileTimes returns the creation time of a file. Windows doesn't report
+// change times through stat.
+func fileTimes(info fs.FileInfo, open func() (*os.File, error)) (created, changed int64) {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return 0, 0
+	}
+	return attrs.CreationTime.Nanoseconds() / 1e9, 0
+}
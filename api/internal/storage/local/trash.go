@@ -0,0 +1,285 @@
+package local
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// Trash
+//
+// When trash is enabled, deleted nodes are moved into a trash directory at the
+// storage root instead of being removed. The files and info directories are
+// laid out like in the freedesktop.org trash specification, but the info is
+// JSON rather than .trashinfo files, so desktop trash tools don't see it:
+//
+//	.timeship-trash/files/<id>       the deleted file or directory
+//	.timeship-trash/info/<id>.json   metadata about the deleted node
+//
+// The trash directory is hidden from listings and can't be accessed through
+// regular paths. Items older than the configured retention are purged
+// automatically.
+
+// trashDir is the name of the trash directory at the storage root
+const trashDir = ".timeship-trash"
+
+// trashPurgeInterval is how often expired trash items are purged
+const trashPurgeInterval = time.Hour
+
+// trashInfo is the metadata stored for each trashed node
+type trashInfo struct {
+	// Path is the original path relative to the storage root, as exposed by the API
+	Path string `json:"path"`
+
+	// DiskPath is the original on-disk path, which may not be valid UTF-8
+	DiskPath []byte `json:"disk_path"`
+
+	Type      string `json:"type"`
+	Size      int64  `json:"size"`
+	DeletedAt int64  `json:"deleted_at"`
+}
+
+func trashFilesPath(id string) string {
+	return filepath.Join(trashDir, "files", id)
+}
+
+func trashInfoPath(id string) string {
+	return filepath.Join(trashDir, "info", id+".json")
+}
+
+// newTrashID returns a unique, sortable ID for a trash item
+func newTrashID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(b))
+}
+
+// validTrashID checks that an ID can't escape the trash directory
+func validTrashID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\`) && id != "." && id != ".."
+}
+
+// trash moves the node at relPath (on-disk path) into the trash
+func (s *Storage) trash(relPath string, apiPath string) error {
+	info, err := s.root.Lstat(relPath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.root.MkdirAll(filepath.Join(trashDir, "files"), 0700); err != nil {
+		return fmt.Errorf("unable to create trash: %w", err)
+	}
+	if err := s.root.MkdirAll(filepath.Join(trashDir, "info"), 0700); err != nil {
+		return fmt.Errorf("unable to create trash: %w", err)
+	}
+
+	id := newTrashID()
+	meta := trashInfo{
+		Path:      apiPath,
+		DiskPath:  []byte(relPath),
+		Type:      "file",
+		DeletedAt: time.Now().Unix(),
+	}
+	if info.IsDir() {
+		meta.Type = "dir"
+	} else {
+		meta.Size = info.Size()
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// Write metadata first, so a crash never leaves an untracked item in the trash
+	if err := s.root.WriteFile(trashInfoPath(id), data, 0600); err != nil {
+		return fmt.Errorf("unable to write trash info: %w", err)
+	}
+
+	if err := s.root.Rename(relPath, trashFilesPath(id)); err != nil {
+		s.root.Remove(trashInfoPath(id))
+		return fmt.Errorf("unable to move to trash: %w", err)
+	}
+
+	return nil
+}
+
+// readTrashInfo reads the metadata of a trash item
+func (s *Storage) readTrashInfo(id string) (trashInfo, error) {
+	var meta trashInfo
+	data, err := s.root.ReadFile(trashInfoPath(id))
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("invalid trash info for %s: %w", id, err)
+	}
+	return meta, nil
+}
+
+// trashItem converts trash metadata to a storage.TrashItem
+func (s *Storage) trashItem(id string, meta trashInfo) storage.TrashItem {
+	return storage.TrashItem{
+		ID:        id,
+		Path:      url.URL{Scheme: s.name, Path: meta.Path},
+		Type:      meta.Type,
+		Size:      meta.Size,
+		DeletedAt: meta.DeletedAt,
+	}
+}
+
+// ListTrash implements storage.Trasher
+// Returns the trashed items, most recently deleted first
+func (s *Storage) ListTrash() ([]storage.TrashItem, error) {
+	if !s.trashEnabled {
+		return nil, storage.ErrNotSupported
+	}
+
+	entries, err := fs.ReadDir(s.root.FS(), path.Join(trashDir, "info"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []storage.TrashItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]storage.TrashItem, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		meta, err := s.readTrashInfo(id)
+		if err != nil {
+			log.Printf("Skipping trash item %s: %v", id, err)
+			continue
+		}
+		items = append(items, s.trashItem(id, meta))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt > items[j].DeletedAt
+	})
+
+	return items, nil
+}
+
+// RestoreTrash implements storage.Trasher
+// Moves the item back to its original path, recreating missing parent directories.
+// Fails with fs.ErrExist if a node already exists at the original path.
+func (s *Storage) RestoreTrash(id string) (storage.TrashItem, error) {
+	if !s.trashEnabled {
+		return storage.TrashItem{}, storage.ErrNotSupported
+	}
+	if !validTrashID(id) {
+		return storage.TrashItem{}, fs.ErrNotExist
+	}
+
+	meta, err := s.readTrashInfo(id)
+	if err != nil {
+		return storage.TrashItem{}, err
+	}
+
+	target := string(meta.DiskPath)
+	if !filepath.IsLocal(target) {
+		return storage.TrashItem{}, fmt.Errorf("invalid original path in trash info: %q", target)
+	}
+
+	if _, err := s.root.Lstat(target); err == nil {
+		return storage.TrashItem{}, &fs.PathError{Op: "restore", Path: meta.Path, Err: fs.ErrExist}
+	}
+
+	if dir := filepath.Dir(target); dir != "." {
+		if err := s.root.MkdirAll(dir, 0755); err != nil {
+			return storage.TrashItem{}, fmt.Errorf("unable to recreate parent directory: %w", err)
+		}
+	}
+
+	if err := s.root.Rename(trashFilesPath(id), target); err != nil {
+		return storage.TrashItem{}, fmt.Errorf("unable to restore from trash: %w", err)
+	}
+
+	if err := s.root.Remove(trashInfoPath(id)); err != nil {
+		log.Printf("Failed to remove trash info for %s: %v", id, err)
+	}
+
+	return s.trashItem(id, meta), nil
+}
+
+// PurgeTrash implements storage.Trasher
+// Permanently deletes a single item from the trash
+func (s *Storage) PurgeTrash(id string) error {
+	if !s.trashEnabled {
+		return storage.ErrNotSupported
+	}
+	if !validTrashID(id) {
+		return fs.ErrNotExist
+	}
+
+	if _, err := s.root.Lstat(trashInfoPath(id)); err != nil {
+		return err
+	}
+
+	// Remove the content first, so a failure leaves the item listed
+	if err := s.root.RemoveAll(trashFilesPath(id)); err != nil {
+		return fmt.Errorf("unable to purge trash item: %w", err)
+	}
+	return s.root.Remove(trashInfoPath(id))
+}
+
+// EmptyTrash implements storage.Trasher
+// Permanently deletes all items in the trash
+func (s *Storage) EmptyTrash() error {
+	if !s.trashEnabled {
+		return storage.ErrNotSupported
+	}
+	return s.root.RemoveAll(trashDir)
+}
+
+// purgeExpiredTrash permanently deletes items older than the retention period
+func (s *Storage) purgeExpiredTrash() {
+	items, err := s.ListTrash()
+	if err != nil {
+		log.Printf("Failed to list trash of %s: %v", s.name, err)
+		return
+	}
+
+	cutoff := time.Now().Add(-s.trashRetention).Unix()
+	for _, item := range items {
+		if item.DeletedAt >= cutoff {
+			continue
+		}
+		if err := s.PurgeTrash(item.ID); err != nil {
+			log.Printf("Failed to purge trash item %s of %s: %v", item.ID, s.name, err)
+		}
+	}
+}
+
+// runTrashRetention periodically purges expired trash items until stopped
+func (s *Storage) runTrashRetention() {
+	s.purgeExpiredTrash()
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.purgeExpiredTrash()
+		case <-s.stop:
+			return
+		}
+	}
+}
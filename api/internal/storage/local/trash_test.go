@@ -0,0 +1,220 @@
+package local
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+func newTrashStorage(t *testing.T) (*Storage, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs", "sub"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "sub", "b.txt"), []byte("world"), 0644)
+
+	s, err := NewWithConfig(tmpDir, Config{Trash: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, tmpDir
+}
+
+func TestDeleteWithoutTrash(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs", "sub"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("hello"), 0644)
+
+	s, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Delete(url.URL{Scheme: "local", Path: "docs"}); err == nil {
+		t.Error("expected error deleting non-empty directory")
+	}
+
+	if err := s.Delete(url.URL{Scheme: "local", Path: "docs/a.txt"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "docs", "a.txt")); !os.IsNotExist(err) {
+		t.Error("expected file to be removed")
+	}
+
+	if err := s.DeleteDirectory(url.URL{Scheme: "local", Path: "docs"}); err != nil {
+		t.Fatalf("DeleteDirectory failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "docs")); !os.IsNotExist(err) {
+		t.Error("expected directory to be removed")
+	}
+
+	if err := s.DeleteDirectory(url.URL{Scheme: "local", Path: "docs"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+
+	if err := s.Delete(url.URL{Scheme: "local", Path: ""}); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected permission error deleting root, got %v", err)
+	}
+
+	if _, err := s.ListTrash(); !errors.Is(err, storage.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	t.Run("delete moves to trash", func(t *testing.T) {
+		s, tmpDir := newTrashStorage(t)
+
+		if err := s.DeleteDirectory(url.URL{Scheme: "local", Path: "docs"}); err != nil {
+			t.Fatalf("DeleteDirectory failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "docs")); !os.IsNotExist(err) {
+			t.Error("expected directory to be gone from original path")
+		}
+
+		items, err := s.ListTrash()
+		if err != nil {
+			t.Fatalf("ListTrash failed: %v", err)
+		}
+		if len(items) != 1 {
+			t.Fatalf("expected 1 trash item, got %d", len(items))
+		}
+		if items[0].Path.Path != "docs" || items[0].Type != "dir" {
+			t.Errorf("unexpected trash item: %+v", items[0])
+		}
+
+		nodes, err := s.ListContents(url.URL{Scheme: "local", Path: ""})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range nodes {
+			if n.Basename == trashDir {
+				t.Error("trash directory should be hidden from listings")
+			}
+		}
+
+		if _, err := s.FileSize(url.URL{Scheme: "local", Path: trashDir}); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected trash directory to be inaccessible, got %v", err)
+		}
+	})
+
+	t.Run("non-recursive delete of non-empty directory", func(t *testing.T) {
+		s, _ := newTrashStorage(t)
+
+		if err := s.Delete(url.URL{Scheme: "local", Path: "docs"}); err == nil {
+			t.Error("expected error deleting non-empty directory")
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		s, tmpDir := newTrashStorage(t)
+
+		s.Delete(url.URL{Scheme: "local", Path: "docs/sub/b.txt"})
+		s.DeleteDirectory(url.URL{Scheme: "local", Path: "docs"})
+
+		items, _ := s.ListTrash()
+		if len(items) != 2 {
+			t.Fatalf("expected 2 trash items, got %d", len(items))
+		}
+
+		var fileID string
+		for _, item := range items {
+			if item.Path.Path == "docs/sub/b.txt" {
+				fileID = item.ID
+			}
+		}
+
+		// Parent directories are recreated
+		item, err := s.RestoreTrash(fileID)
+		if err != nil {
+			t.Fatalf("RestoreTrash failed: %v", err)
+		}
+		if item.Size != 5 {
+			t.Errorf("expected size 5, got %d", item.Size)
+		}
+		data, err := os.ReadFile(filepath.Join(tmpDir, "docs", "sub", "b.txt"))
+		if err != nil || string(data) != "world" {
+			t.Errorf("expected restored content, got %q (%v)", data, err)
+		}
+
+		if _, err := s.RestoreTrash(fileID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist error restoring twice, got %v", err)
+		}
+	})
+
+	t.Run("restore conflict", func(t *testing.T) {
+		s, tmpDir := newTrashStorage(t)
+
+		s.Delete(url.URL{Scheme: "local", Path: "docs/a.txt"})
+		os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("new"), 0644)
+
+		items, _ := s.ListTrash()
+		if _, err := s.RestoreTrash(items[0].ID); !errors.Is(err, fs.ErrExist) {
+			t.Errorf("expected exist error, got %v", err)
+		}
+	})
+
+	t.Run("purge and empty", func(t *testing.T) {
+		s, _ := newTrashStorage(t)
+
+		s.Delete(url.URL{Scheme: "local", Path: "docs/a.txt"})
+		s.DeleteDirectory(url.URL{Scheme: "local", Path: "docs/sub"})
+
+		items, _ := s.ListTrash()
+		if err := s.PurgeTrash(items[0].ID); err != nil {
+			t.Fatalf("PurgeTrash failed: %v", err)
+		}
+		if err := s.PurgeTrash(items[0].ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist error, got %v", err)
+		}
+		if err := s.PurgeTrash("../docs"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist error for invalid id, got %v", err)
+		}
+
+		items, _ = s.ListTrash()
+		if len(items) != 1 {
+			t.Fatalf("expected 1 trash item, got %d", len(items))
+		}
+
+		if err := s.EmptyTrash(); err != nil {
+			t.Fatalf("EmptyTrash failed: %v", err)
+		}
+		items, _ = s.ListTrash()
+		if len(items) != 0 {
+			t.Errorf("expected empty trash, got %d items", len(items))
+		}
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		s, _ := newTrashStorage(t)
+		s.trashRetention = time.Hour
+
+		s.Delete(url.URL{Scheme: "local", Path: "docs/a.txt"})
+		s.Delete(url.URL{Scheme: "local", Path: "docs/sub/b.txt"})
+
+		// Backdate one item past the retention period
+		items, _ := s.ListTrash()
+		meta, _ := s.readTrashInfo(items[0].ID)
+		meta.DeletedAt = time.Now().Add(-2 * time.Hour).Unix()
+		data, _ := json.Marshal(meta)
+		if err := s.root.WriteFile(trashInfoPath(items[0].ID), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		s.purgeExpiredTrash()
+
+		remaining, _ := s.ListTrash()
+		if len(remaining) != 1 || remaining[0].ID != items[1].ID {
+			t.Errorf("expected only the recent item to remain, got %+v", remaining)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package local
+
+import "io/fs"
+
+// fileUsage is not supported on this platform, files are reported with
+// their apparent size and hard links aren't detected
+func fileUsage(info fs.FileInfo) (allocated int64, id string) {
+	return 0, ""
+}
+
+// fileIdentity is not supported on this platform, renamed files can't be
+// recognized
+func fileIdentity(info fs.FileInfo) string {
+	return ""
+}
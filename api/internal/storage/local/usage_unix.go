@@ -0,0 +1,34 @@
+//go:build unix
+
+package local
+
+import (
+	"io/fs"
+	"strconv"
+	"syscall"
+)
+
+// fileUsage returns the bytes allocated for a file and, if it has more than
+// one hard link, an ID shared by all of them
+func fileUsage(info fs.FileInfo) (allocated int64, id string) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, ""
+	}
+	// Blocks are counted in 512-byte units regardless of the block size
+	allocated = int64(st.Blocks) * 512
+	if st.Nlink > 1 {
+		id = fileIdentity(info)
+	}
+	return allocated, id
+}
+
+// fileIdentity returns the device and inode of a file, which it keeps when
+// renamed, empty if unknown
+func fileIdentity(info fs.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return strconv.FormatUint(uint64(st.Dev), 36) + ":" + strconv.FormatUint(uint64(st.Ino), 36)
+}
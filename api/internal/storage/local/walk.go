@@ -0,0 +1,147 @@
+package local
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"timeship/internal/storage"
+
+	"github.com/charlievieth/fastwalk"
+)
+
+// zfsControlDir is the directory exposing ZFS snapshots at the root of each
+// dataset. Snapshots are walked through their own paths instead.
+const zfsControlDir = ".zfs"
+
+// Walk implements storage.Walker
+// The tree is walked in parallel with fastwalk, so fn is called concurrently.
+// Unreadable directories are logged and skipped.
+func (s *Storage) Walk(vfPath url.URL, fn func(node storage.FileNode) error) error {
+	relPath, err := s.urlToRelPath(vfPath)
+	if err != nil {
+		return err
+	}
+	root, relPath, err := s.pathRoot(vfPath, relPath)
+	if err != nil {
+		return err
+	}
+	if root != s.root {
+		defer root.Close()
+	}
+	if err := s.checkSymlinks(root, relPath); err != nil {
+		return err
+	}
+
+	// Stat through the root, so the walk can't start outside of it
+	info, err := root.Stat(relPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "walk", Path: vfPath.Path, Err: syscall.ENOTDIR}
+	}
+
+	dir := filepath.Join(root.Name(), relPath)
+	base := strings.Trim(vfPath.Path, "/")
+	atStorageRoot := vfPath.Query().Get("snapshot") == "" && base == ""
+
+	conf := fastwalk.Config{
+		Follow: false,
+	}
+	return fastwalk.Walk(&conf, dir, func(p string, d fs.DirEntry, err error) error {
+		if p == dir {
+			return err
+		}
+		if err != nil {
+			log.Printf("Failed to walk %s: %v", p, err)
+			return nil
+		}
+
+		name := d.Name()
+		if isTempName(name) || (d.IsDir() && name == zfsControlDir) {
+			return skip(d)
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if atStorageRoot && rel == trashDir {
+			return skip(d)
+		}
+
+		nodePath := vfPath
+		nodePath.Path = path.Join(base, s.decodePath(root, relPath, rel))
+		nodePath.RawQuery = ""
+		if s.ignore.match(nodePath.Path) {
+			return skip(d)
+		}
+
+		node := storage.FileNode{
+			Path:     nodePath,
+			Basename: path.Base(nodePath.Path),
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			if s.symlinks == SymlinksHide {
+				return nil
+			}
+			node.Type = "link"
+		case d.IsDir():
+			node.Type = "dir"
+		case !d.Type().IsRegular():
+			node.Type = "special"
+		default:
+			node.Type = "file"
+			node.Extension = strings.TrimPrefix(path.Ext(node.Basename), ".")
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// Removed while walking
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		node.Mode = info.Mode()
+		node.LastModified = info.ModTime().Unix()
+		if node.Type == "file" {
+			node.Size = info.Size()
+			node.AllocatedSize, node.FileID = fileUsage(info)
+		}
+
+		return fn(node)
+	})
+}
+
+// skip skips a directory entry and the contents of directories
+func skip(d fs.DirEntry) error {
+	if d.IsDir() {
+		return fs.SkipDir
+	}
+	return nil
+}
+
+// decodePath converts an on-disk path relative to a directory within root to
+// its slash separated UTF-8 representation
+func (s *Storage) decodePath(root *os.Root, dir, rel string) string {
+	rel = filepath.ToSlash(rel)
+	if utf8.ValidString(rel) && !hasRawBytes(rel) {
+		return rel
+	}
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		parts[i] = s.codec.decodeIn(root, dir, part)
+		dir = filepath.Join(dir, part)
+	}
+	return strings.Join(parts, "/")
+}
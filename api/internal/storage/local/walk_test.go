@@ -0,0 +1,150 @@
+package local
+
+import (
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+
+	"timeship/internal/storage"
+)
+
+func TestWalk(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs", "old"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, ".git"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "report.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "old", "notes.md"), []byte("hi"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".git", "HEAD"), []byte("ref"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "caf\xe9.txt"), []byte("latin1"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, tempPrefix+"upload"), []byte("partial"), 0644)
+	os.MkdirAll(filepath.Join(tmpDir, trashDir), 0755)
+	os.WriteFile(filepath.Join(tmpDir, trashDir, "trashed.txt"), []byte("gone"), 0644)
+	snapDir := filepath.Join(tmpDir, ".zfs", "snapshot", "daily-2025-11-09")
+	os.MkdirAll(filepath.Join(snapDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(snapDir, "docs", "report.txt"), []byte("old"), 0644)
+
+	s, err := NewWithConfig(tmpDir, Config{FilenameEncoding: "latin1", Ignore: []string{".git"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	walk := func(t *testing.T, path url.URL) map[string]storage.FileNode {
+		t.Helper()
+		var mu sync.Mutex
+		nodes := map[string]storage.FileNode{}
+		err := s.Walk(path, func(node storage.FileNode) error {
+			mu.Lock()
+			defer mu.Unlock()
+			nodes[node.Path.Path] = node
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+		return nodes
+	}
+
+	keys := func(nodes map[string]storage.FileNode) []string {
+		var paths []string
+		for p := range nodes {
+			paths = append(paths, p)
+		}
+		slices.Sort(paths)
+		return paths
+	}
+
+	t.Run("root", func(t *testing.T) {
+		nodes := walk(t, url.URL{Scheme: "local"})
+		expected := []string{"café.txt", "docs", "docs/old", "docs/old/notes.md", "docs/report.txt"}
+		if got := keys(nodes); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+
+		report := nodes["docs/report.txt"]
+		if report.Type != "file" || report.Size != 5 || report.Basename != "report.txt" || report.Extension != "txt" || report.LastModified == 0 {
+			t.Errorf("unexpected node %+v", report)
+		}
+		if report.Path.Scheme != "local" || report.Path.RawQuery != "" {
+			t.Errorf("unexpected path %s", report.Path.String())
+		}
+		if nodes["docs"].Type != "dir" {
+			t.Errorf("expected docs to be a dir, got %q", nodes["docs"].Type)
+		}
+	})
+
+	t.Run("subdirectory", func(t *testing.T) {
+		nodes := walk(t, url.URL{Scheme: "local", Path: "docs/old"})
+		expected := []string{"docs/old/notes.md"}
+		if got := keys(nodes); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		nodes := walk(t, url.URL{Scheme: "local", RawQuery: "snapshot=zfs:daily-2025-11-09"})
+		expected := []string{"docs", "docs/report.txt"}
+		if got := keys(nodes); !slices.Equal(got, expected) {
+			t.Errorf("expected %v, got %v", expected, got)
+		}
+		if nodes["docs/report.txt"].Size != 3 {
+			t.Errorf("expected snapshot file size 3, got %d", nodes["docs/report.txt"].Size)
+		}
+	})
+
+	t.Run("skip dir", func(t *testing.T) {
+		var mu sync.Mutex
+		var paths []string
+		err := s.Walk(url.URL{Scheme: "local"}, func(node storage.FileNode) error {
+			mu.Lock()
+			paths = append(paths, node.Path.Path)
+			mu.Unlock()
+			if node.Path.Path == "docs" {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(paths)
+		if expected := []string{"café.txt", "docs"}; !slices.Equal(paths, expected) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		err := s.Walk(url.URL{Scheme: "local", Path: "docs/report.txt"}, func(storage.FileNode) error { return nil })
+		if err == nil {
+			t.Error("expected error walking a file")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		err := s.Walk(url.URL{Scheme: "local", Path: "missing"}, func(storage.FileNode) error { return nil })
+		if !os.IsNotExist(err) {
+			t.Errorf("expected not exist error, got %v", err)
+		}
+	})
+
+	t.Run("symlinks are not followed", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("symlinks require privileges on Windows")
+		}
+		os.Symlink("docs", filepath.Join(tmpDir, "docslink"))
+		defer os.Remove(filepath.Join(tmpDir, "docslink"))
+
+		nodes := walk(t, url.URL{Scheme: "local"})
+		if nodes["docslink"].Type != "link" {
+			t.Errorf("expected link, got %+v", nodes["docslink"])
+		}
+		if _, ok := nodes["docslink/report.txt"]; ok {
+			t.Error("expected link not to be followed")
+		}
+	})
+}
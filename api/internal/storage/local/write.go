@@ -0,0 +1,209 @@
+package local
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"timeship/internal/storage"
+)
+
+// Writes
+//
+// Files are written to a temporary file in the same directory and renamed over
+// the target once complete. Renames within a directory are atomic, so readers
+// see either the old or the new content, and interrupted uploads never leave
+// half-written files behind under the target name. New files are linked to
+// the target instead, which fails rather than replacing a file created in the
+// meantime. Temporary files are hidden from listings. Partial writes with WriteStreamAt are the exception and
+// change the file in place, as copying it would defeat their purpose.
+
+// tempPrefix is the name prefix of temporary files used for atomic writes
+const tempPrefix = ".timeship-tmp-"
+
+// isTempName reports whether a file name is a temporary write file
+func isTempName(name string) bool {
+	return strings.HasPrefix(name, tempPrefix)
+}
+
+// tempName returns a unique temporary file name for writing to relPath
+func tempName(relPath string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return filepath.Join(filepath.Dir(relPath), tempPrefix+hex.EncodeToString(b))
+}
+
+// WriteStream implements storage.Writer
+// Atomically creates or replaces the file with the content of r
+func (s *Storage) WriteStream(vfPath url.URL, r io.Reader) error {
+	relPath, err := s.writablePath(vfPath)
+	if err != nil {
+		return err
+	}
+
+	// Keep the permissions of the file being replaced
+	perm := fs.FileMode(0644)
+	if info, err := s.root.Stat(relPath); err == nil {
+		if info.IsDir() {
+			return &fs.PathError{Op: "write", Path: vfPath.Path, Err: syscall.EISDIR}
+		}
+		perm = info.Mode().Perm()
+	}
+
+	return s.writeAtomic(relPath, r, perm)
+}
+
+// WriteNew implements storage.ExclusiveWriter
+// Atomically creates the file with the content of r, failing with fs.ErrExist
+// if a node already exists at the path
+func (s *Storage) WriteNew(vfPath url.URL, r io.Reader) error {
+	relPath, err := s.writablePath(vfPath)
+	if err != nil {
+		return err
+	}
+	return s.writeTemp(relPath, r, 0644, s.linkNew)
+}
+
+// WriteStreamAt implements storage.WriterAt
+// Writes into the file in place, so unlike WriteStream it isn't atomic
+func (s *Storage) WriteStreamAt(vfPath url.URL, offset int64, r io.Reader) error {
+	relPath, err := s.writablePath(vfPath)
+	if err != nil {
+		return err
+	}
+	// Opening FIFOs blocks until there is a reader, so only regular files
+	// are opened
+	info, err := s.root.Stat(relPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &fs.PathError{Op: "write", Path: vfPath.Path, Err: syscall.EISDIR}
+	}
+	if !info.Mode().IsRegular() {
+		return &fs.PathError{Op: "write", Path: vfPath.Path, Err: storage.ErrSpecialFile}
+	}
+	if offset < 0 || offset > info.Size() {
+		return &fs.PathError{Op: "write", Path: vfPath.Path, Err: storage.ErrInvalidOffset}
+	}
+
+	f, err := s.root.OpenFile(relPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(io.NewOffsetWriter(f, offset), r); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+	if s.fsync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("unable to sync: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+	return nil
+}
+
+// writeAtomic writes r to a temporary file and renames it to relPath
+func (s *Storage) writeAtomic(relPath string, r io.Reader, perm fs.FileMode) error {
+	return s.writeTemp(relPath, r, perm, func(tmpPath, relPath string) error {
+		if err := s.root.Rename(tmpPath, relPath); err != nil {
+			return fmt.Errorf("unable to replace file: %w", err)
+		}
+		return nil
+	})
+}
+
+// linkNew moves a temporary file to relPath without replacing a node there.
+// Hard links fail if the target exists. File systems without them reserve
+// the name with an empty file first, which the rename then replaces.
+func (s *Storage) linkNew(tmpPath, relPath string) error {
+	err := s.root.Link(tmpPath, relPath)
+	if err == nil {
+		// The file stays reachable under relPath
+		s.root.Remove(tmpPath)
+		return nil
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	f, err := s.root.OpenFile(relPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if err := s.root.Rename(tmpPath, relPath); err != nil {
+		s.root.Remove(relPath)
+		return fmt.Errorf("unable to create file: %w", err)
+	}
+	return nil
+}
+
+// writeTemp writes r to a temporary file next to relPath and moves it there
+// with commit, removing it if anything fails
+func (s *Storage) writeTemp(relPath string, r io.Reader, perm fs.FileMode, commit func(tmpPath, relPath string) error) error {
+	tmpPath := tempName(relPath)
+	f, err := s.root.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	// Clean up the temporary file on any failure
+	committed := false
+	defer func() {
+		if !committed {
+			f.Close()
+			s.root.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+	if s.fsync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("unable to sync: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write: %w", err)
+	}
+
+	if err := commit(tmpPath, relPath); err != nil {
+		return err
+	}
+	committed = true
+
+	if s.fsync {
+		return s.syncDir(filepath.Dir(relPath))
+	}
+	return nil
+}
+
+// syncDir flushes a directory to disk so renames within it are durable
+func (s *Storage) syncDir(relPath string) error {
+	// Directories can't be synced on Windows, renames are durable there
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := s.root.Open(relPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("unable to sync directory: %w", err)
+	}
+	return nil
+}
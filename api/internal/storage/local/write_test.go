@@ -0,0 +1,230 @@
+package local
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"timeship/internal/storage"
+)
+
+// failingReader returns some data and then an error, like an interrupted upload
+type failingReader struct {
+	sent bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("connection reset")
+	}
+	r.sent = true
+	return copy(p, "partial"), nil
+}
+
+func TestWriteStream(t *testing.T) {
+	for _, fsync := range []bool{false, true} {
+		name := "default"
+		if fsync {
+			name = "fsync"
+		}
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			os.Mkdir(filepath.Join(tmpDir, "docs"), 0755)
+
+			s, err := NewWithConfig(tmpDir, Config{Fsync: fsync})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			target := url.URL{Scheme: "local", Path: "docs/a.txt"}
+
+			if err := s.WriteStream(target, strings.NewReader("hello")); err != nil {
+				t.Fatalf("WriteStream failed: %v", err)
+			}
+			data, _ := os.ReadFile(filepath.Join(tmpDir, "docs", "a.txt"))
+			if string(data) != "hello" {
+				t.Errorf("expected %q, got %q", "hello", data)
+			}
+
+			os.Chmod(filepath.Join(tmpDir, "docs", "a.txt"), 0600)
+			if err := s.WriteStream(target, strings.NewReader("replaced")); err != nil {
+				t.Fatalf("WriteStream failed: %v", err)
+			}
+			data, _ = os.ReadFile(filepath.Join(tmpDir, "docs", "a.txt"))
+			if string(data) != "replaced" {
+				t.Errorf("expected %q, got %q", "replaced", data)
+			}
+			info, _ := os.Stat(filepath.Join(tmpDir, "docs", "a.txt"))
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("expected permissions to be kept, got %v", info.Mode().Perm())
+			}
+		})
+	}
+
+	t.Run("interrupted write", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("original"), 0644)
+
+		s, err := New(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		err = s.WriteStream(url.URL{Scheme: "local", Path: "a.txt"}, &failingReader{})
+		if err == nil {
+			t.Fatal("expected error for interrupted write")
+		}
+
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "a.txt"))
+		if string(data) != "original" {
+			t.Errorf("expected original content to be kept, got %q", data)
+		}
+
+		entries, _ := os.ReadDir(tmpDir)
+		if len(entries) != 1 {
+			t.Errorf("expected temporary file to be removed, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("temporary files are hidden", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		os.WriteFile(filepath.Join(tmpDir, tempPrefix+"abc"), []byte("partial"), 0644)
+		os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+
+		s, err := New(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		nodes, err := s.ListContents(url.URL{Scheme: "local", Path: ""})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 || nodes[0].Basename != "a.txt" {
+			t.Errorf("expected only a.txt, got %+v", nodes)
+		}
+	})
+
+	t.Run("invalid targets", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		os.Mkdir(filepath.Join(tmpDir, "docs"), 0755)
+
+		s, err := New(tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		tests := []struct {
+			name string
+			path url.URL
+		}{
+			{"root", url.URL{Scheme: "local", Path: ""}},
+			{"directory", url.URL{Scheme: "local", Path: "docs"}},
+			{"snapshot", url.URL{Scheme: "local", Path: "a.txt", RawQuery: "snapshot=zfs:daily"}},
+			{"missing parent", url.URL{Scheme: "local", Path: "missing/a.txt"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := s.WriteStream(tt.path, strings.NewReader("x")); err == nil {
+					t.Error("expected error")
+				}
+			})
+		}
+
+		err = s.WriteStream(url.URL{Scheme: "local", Path: "a.txt", RawQuery: "snapshot=zfs:daily"}, strings.NewReader("x"))
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("expected permission error for snapshot, got %v", err)
+		}
+	})
+}
+
+func TestWriteNew(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.Mkdir(filepath.Join(tmpDir, "docs"), 0755)
+
+	s, err := New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	target := url.URL{Scheme: "local", Path: "a.txt"}
+	if err := s.WriteNew(target, strings.NewReader("first")); err != nil {
+		t.Fatalf("WriteNew failed: %v", err)
+	}
+	for _, path := range []string{"a.txt", "docs"} {
+		err := s.WriteNew(url.URL{Scheme: "local", Path: path}, strings.NewReader("second"))
+		if !errors.Is(err, fs.ErrExist) {
+			t.Errorf("expected %s to exist, got %v", path, err)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(tmpDir, "a.txt"))
+	if string(data) != "first" {
+		t.Errorf("expected the first content to be kept, got %q", data)
+	}
+	if err := s.WriteNew(url.URL{Scheme: "local", Path: "b.txt"}, &failingReader{}); err == nil {
+		t.Error("expected error for interrupted write")
+	}
+
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 2 {
+		t.Errorf("expected only a.txt and docs, got %d entries", len(entries))
+	}
+}
+
+func TestWriteStreamAt(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.Mkdir(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "a.txt"), []byte("0123456789"), 0640)
+
+	s, err := NewWithConfig(tmpDir, Config{Fsync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	target := url.URL{Scheme: "local", Path: "docs/a.txt"}
+	steps := []struct {
+		offset  int64
+		content string
+		want    string
+	}{
+		{offset: 2, content: "ab", want: "01ab456789"},
+		{offset: 8, content: "xyz", want: "01ab4567xyz"},
+		{offset: 11, content: "!", want: "01ab4567xyz!"},
+	}
+	for _, step := range steps {
+		if err := s.WriteStreamAt(target, step.offset, strings.NewReader(step.content)); err != nil {
+			t.Fatalf("WriteStreamAt at %d failed: %v", step.offset, err)
+		}
+		data, _ := os.ReadFile(filepath.Join(tmpDir, "docs", "a.txt"))
+		if string(data) != step.want {
+			t.Errorf("expected %q after writing at %d, got %q", step.want, step.offset, data)
+		}
+	}
+	if info, _ := os.Stat(filepath.Join(tmpDir, "docs", "a.txt")); info.Mode().Perm() != 0640 {
+		t.Errorf("expected permissions to be kept, got %v", info.Mode().Perm())
+	}
+
+	if err := s.WriteStreamAt(target, 20, strings.NewReader("x")); !errors.Is(err, storage.ErrInvalidOffset) {
+		t.Errorf("expected invalid offset past the end, got %v", err)
+	}
+	if err := s.WriteStreamAt(url.URL{Scheme: "local", Path: "docs/missing.txt"}, 0, strings.NewReader("x")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected missing file not to be created, got %v", err)
+	}
+	if err := s.WriteStreamAt(url.URL{Scheme: "local", Path: "docs"}, 0, strings.NewReader("x")); err == nil {
+		t.Error("expected writing into a directory to fail")
+	}
+	snapshot := url.URL{Scheme: "local", Path: "docs/a.txt", RawQuery: "snapshot=daily"}
+	if err := s.WriteStreamAt(snapshot, 0, strings.NewReader("x")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected snapshots to be read-only, got %v", err)
+	}
+}
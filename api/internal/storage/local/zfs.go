@@ -31,17 +31,27 @@
 //
 // Patterns are tried in order, and the first matching pattern is used.
 // If no pattern matches, the snapshot directory's modification time is used as a fallback.
+//
+// Most snapshot tools name snapshots in local time, so names are parsed in the
+// configured Location (local time by default), unless the pattern has its own
+// Timezone, e.g. "Europe/Berlin". Layouts containing a zone offset use the
+// offset from the name instead. The resolved time is included in the snapshot
+// metadata as RFC 3339 under "time".
 package local
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"time"
 
+	"timeship/internal/config"
 	"timeship/internal/storage"
 )
 
@@ -52,6 +62,10 @@ type ZFSConfig struct {
 	// The regex should capture the date/time portion of the snapshot name.
 	// If empty, defaults to common patterns.
 	DateTimePatterns []DateTimePattern
+
+	// Location is the time zone snapshot names are parsed in, unless a
+	// pattern has its own time zone. Defaults to local time.
+	Location *time.Location
 }
 
 // DateTimePattern defines how to extract and parse dates from snapshot names
@@ -64,8 +78,22 @@ type DateTimePattern struct {
 	// See https://golang.org/pkg/time/#Parse for format
 	Layout string
 
+	// Timezone is the IANA time zone name the extracted date/time is in,
+	// e.g. "Europe/Berlin" or "UTC". Defaults to the ZFSConfig Location.
+	Timezone string
+
 	// compiled is the compiled regex (cached)
 	compiled *regexp.Regexp
+
+	// location is the loaded Timezone (cached), nil if not set
+	location *time.Location
+}
+
+// Validate checks that the regex compiles and captures the date/time, and
+// that the layout and time zone are set and valid, like the configuration
+// does
+func (p DateTimePattern) Validate() error {
+	return config.SnapshotPatternConfig{Regex: p.Regex, Layout: p.Layout, Timezone: p.Timezone}.Validate()
 }
 
 // DefaultDateTimePatterns returns the default patterns for parsing snapshot names
@@ -98,6 +126,11 @@ func DefaultDateTimePatterns() []DateTimePattern {
 type ZFS struct {
 	rootDir          string
 	dateTimePatterns []DateTimePattern
+	location         *time.Location
+
+	// run and runPool run the zfs and zpool commands, replaceable for testing
+	run     func(args ...string) ([]byte, error)
+	runPool func(args ...string) ([]byte, error)
 }
 
 // NewZFS creates a new ZFS snapshot provider with default configuration
@@ -114,24 +147,43 @@ func NewZFSWithConfig(rootDir string, config ZFSConfig) *ZFS {
 		patterns = DefaultDateTimePatterns()
 	}
 
-	// Compile all regex patterns
+	location := config.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	// Compile all regex patterns and load time zones, invalid time zones fall
+	// back to the location (see DateTimePattern.Validate)
 	for i := range patterns {
 		if patterns[i].Regex != "" {
 			patterns[i].compiled = regexp.MustCompile(patterns[i].Regex)
 		}
+		if patterns[i].Timezone != "" {
+			if loc, err := time.LoadLocation(patterns[i].Timezone); err == nil {
+				patterns[i].location = loc
+			}
+		}
 	}
 
 	return &ZFS{
 		rootDir:          rootDir,
 		dateTimePatterns: patterns,
+		location:         location,
+		run:              runZFS,
+		runPool:          runZpool,
 	}
 }
 
 // findSnapshotRoot traverses up from the given path looking for a .zfs directory
 // Returns the path to the ZFS root (where .zfs/snapshot exists) and the relative path from that root
 // Returns empty strings if not found
+//
+// There is no ZFS on Windows, so only .zfs directories within the root are
+// found there, e.g. copied snapshots, rather than scanning up to the drive or
+// network share root on every request.
 func (z *ZFS) findSnapshotRoot(relPath string) (snapshotDir string, relFromRoot string, err error) {
-	currentPath := filepath.Join(z.rootDir, relPath)
+	rootDir := filepath.Clean(z.rootDir)
+	currentPath := filepath.Join(rootDir, relPath)
 	originalPath := currentPath
 
 	// If the path points to a file (not a directory), start from its parent
@@ -152,6 +204,10 @@ func (z *ZFS) findSnapshotRoot(relPath string) (snapshotDir string, relFromRoot
 			return dir, relFromZFS, nil
 		}
 
+		if runtime.GOOS == "windows" && currentPath == rootDir {
+			break
+		}
+
 		// Move up one directory
 		parent := filepath.Dir(currentPath)
 		if parent == currentPath {
@@ -183,7 +239,11 @@ func (z *ZFS) parseTimestampFromName(name string) (int64, bool) {
 		dateTimeStr := matches[1]
 
 		// Try to parse it with the specified layout
-		t, err := time.Parse(pattern.Layout, dateTimeStr)
+		loc := z.location
+		if pattern.location != nil {
+			loc = pattern.location
+		}
+		t, err := time.ParseInLocation(pattern.Layout, dateTimeStr, loc)
 		if err == nil {
 			return t.Unix(), true
 		}
@@ -237,6 +297,7 @@ func (z *ZFS) Snapshots(relPath string) ([]storage.Snapshot, error) {
 			Size:      -1, // ZFS snapshot size is not easily determinable
 			Metadata: storage.SnapshotMetadata{
 				"zfs_root": rootPath,
+				"time":     z.formatTime(timestamp),
 			},
 		}
 
@@ -251,13 +312,22 @@ func (z *ZFS) Snapshots(relPath string) ([]storage.Snapshot, error) {
 	return snapshots, nil
 }
 
+// formatTime formats a Unix timestamp as RFC 3339 in the configured location
+func (z *ZFS) formatTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).In(z.location).Format(time.RFC3339)
+}
+
 // getSnapshotPath extracts the snapshot path from the snapshot ID
 // Input format: "zfs:snapshot-name"
 // Returns just the "snapshot-name" part
 func (z *ZFS) getSnapshotPath(snapshotID string) (string, error) {
 	parts := strings.SplitN(snapshotID, ":", 2)
 	if len(parts) != 2 || parts[0] != "zfs" {
-		return "", fmt.Errorf("invalid snapshot ID format: %s", snapshotID)
+		return "", fmt.Errorf("%w: invalid snapshot ID format: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
+	// The name is a directory in .zfs/snapshot, never a path leading out of it
+	if !filepath.IsLocal(parts[1]) || filepath.Base(parts[1]) != parts[1] {
+		return "", fmt.Errorf("%w: invalid snapshot name: %s", storage.ErrSnapshotNotFound, snapshotID)
 	}
 	return parts[1], nil
 }
@@ -271,8 +341,9 @@ func (z *ZFS) SnapshotRoot(relPath string, snapshotID string) (*os.Root, string,
 		return nil, "", fmt.Errorf("unable to find snapshot root: %w", err)
 	}
 
+	// Paths outside of any ZFS dataset have no snapshots
 	if rootPath == "" {
-		return nil, "", fmt.Errorf("root path empty: %s", relPath)
+		return nil, "", fmt.Errorf("%w: %s has no snapshots", storage.ErrSnapshotNotFound, relPath)
 	}
 
 	// Get the snapshot name from the snapshot ID
@@ -286,6 +357,9 @@ func (z *ZFS) SnapshotRoot(relPath string, snapshotID string) (*os.Root, string,
 
 	// Open the snapshot root
 	root, err := os.OpenRoot(snapshotPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("%w: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to open snapshot root: %w", err)
 	}
@@ -0,0 +1,218 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// datasetProperties are the properties read by Health, in the order of
+// the ZFSDataset fields
+var datasetProperties = []string{"used", "available", "referenced", "usedbysnapshots", "compression", "compressratio"}
+
+// scrubTimeLayout is the layout of the time a scrub finished in zpool status
+const scrubTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+// Health returns the status of the pool and the properties of the dataset
+// containing the root directory. Fails with storage.ErrNotSupported if the
+// root isn't on ZFS or the zfs tools aren't installed.
+func (z *ZFS) Health() (storage.ZFSHealth, error) {
+	name, err := z.rootDataset()
+	if err != nil {
+		return storage.ZFSHealth{}, err
+	}
+	out, err := z.run(append([]string{"get", "-Hp", "-o", "property,value", strings.Join(datasetProperties, ",")}, name)...)
+	if err != nil {
+		return storage.ZFSHealth{}, toolError(err)
+	}
+	dataset, err := parseDatasetProperties(name, out)
+	if err != nil {
+		return storage.ZFSHealth{}, err
+	}
+
+	// Datasets are named after their pool, e.g. tank/data is in tank
+	poolName, _, _ := strings.Cut(name, "/")
+	out, err = z.runPool("status", "-p", poolName)
+	if err != nil {
+		return storage.ZFSHealth{}, toolError(err)
+	}
+	pool := parsePoolStatus(out, z.location)
+	if pool.Name == "" {
+		pool.Name = poolName
+	}
+
+	return storage.ZFSHealth{Pool: pool, Dataset: dataset}, nil
+}
+
+// rootDataset returns the name of the dataset containing the root
+// directory, failing with storage.ErrNotSupported if the root isn't on ZFS
+// or the zfs tools aren't installed
+func (z *ZFS) rootDataset() (string, error) {
+	snapshotDir, _, err := z.findSnapshotRoot("")
+	if err != nil {
+		return "", err
+	}
+	if snapshotDir == "" {
+		return "", fmt.Errorf("root is not on a ZFS dataset: %w", storage.ErrNotSupported)
+	}
+	name, err := z.dataset()
+	if err != nil {
+		return "", toolError(err)
+	}
+	return name, nil
+}
+
+// toolError marks errors of missing zfs tools as not supported
+func toolError(err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%w: %w", storage.ErrNotSupported, err)
+	}
+	return err
+}
+
+// parseDatasetProperties parses the output of zfs get -Hp -o property,value
+func parseDatasetProperties(name string, out []byte) (storage.ZFSDataset, error) {
+	dataset := storage.ZFSDataset{Name: name}
+	for line := range strings.Lines(string(out)) {
+		property, value, ok := strings.Cut(strings.TrimRight(line, "\r\n"), "\t")
+		if !ok {
+			continue
+		}
+		if property == "compression" {
+			dataset.Compression = value
+			continue
+		}
+		if property == "compressratio" {
+			ratio, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+			if err != nil {
+				return dataset, fmt.Errorf("invalid compressratio %q of %s", value, name)
+			}
+			dataset.CompressRatio = ratio
+			continue
+		}
+		var field *int64
+		switch property {
+		case "used":
+			field = &dataset.Used
+		case "available":
+			field = &dataset.Available
+		case "referenced":
+			field = &dataset.Referenced
+		case "usedbysnapshots":
+			field = &dataset.UsedBySnapshots
+		default:
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return dataset, fmt.Errorf("invalid %s %q of %s", property, value, name)
+		}
+		*field = n
+	}
+	return dataset, nil
+}
+
+// parsePoolStatus parses the output of zpool status -p for a single pool.
+// Fields wrapped onto indented lines are joined, devices are read from the
+// config table with their depth given by the indentation.
+func parsePoolStatus(out []byte, loc *time.Location) storage.ZFSPool {
+	var pool storage.ZFSPool
+	var field *string
+	inConfig := false
+	for line := range strings.Lines(string(out)) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Fields are right-aligned names, their continuations and the
+		// config table are indented with a tab
+		if !strings.HasPrefix(line, "\t") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+			if !ok {
+				field = nil
+				continue
+			}
+			value = strings.TrimSpace(value)
+			inConfig = key == "config"
+			field = nil
+			switch key {
+			case "pool":
+				pool.Name = value
+			case "state":
+				pool.State = value
+			case "status":
+				field = &pool.Status
+			case "action":
+				field = &pool.Action
+			case "scan":
+				field = &pool.Scan
+			case "errors":
+				field = &pool.Errors
+			}
+			if field != nil {
+				*field = value
+			}
+			continue
+		}
+
+		if inConfig {
+			if device, ok := parsePoolDevice(line[1:]); ok {
+				pool.Devices = append(pool.Devices, device)
+			}
+			continue
+		}
+		if field != nil {
+			*field = strings.TrimSpace(*field + " " + strings.TrimSpace(line))
+		}
+	}
+	pool.LastScrub = lastScrub(pool.Scan, loc)
+	return pool
+}
+
+// parsePoolDevice parses a row of the config table of zpool status, indented
+// by two spaces per level. Rows of spares and caches may lack error counts.
+func parsePoolDevice(row string) (storage.ZFSDevice, bool) {
+	trimmed := strings.TrimLeft(row, " ")
+	fields := strings.Fields(trimmed)
+	if len(fields) == 0 || (fields[0] == "NAME" && len(fields) > 1 && fields[1] == "STATE") {
+		return storage.ZFSDevice{}, false
+	}
+	device := storage.ZFSDevice{
+		Name:  fields[0],
+		Depth: (len(row) - len(trimmed)) / 2,
+	}
+	if len(fields) > 1 {
+		device.State = fields[1]
+	}
+	if len(fields) >= 5 {
+		counts := []*int64{&device.Read, &device.Write, &device.Checksum}
+		for i, count := range counts {
+			*count, _ = strconv.ParseInt(fields[2+i], 10, 64)
+		}
+	}
+	return device, true
+}
+
+// lastScrub returns the Unix time a finished scrub described by the scan
+// field ended, e.g. "scrub repaired 0B in 00:01:23 with 0 errors on Sun Oct
+// 12 00:25:24 2025", zero for other scans
+func lastScrub(scan string, loc *time.Location) int64 {
+	if !strings.HasPrefix(scan, "scrub repaired") {
+		return 0
+	}
+	i := strings.LastIndex(scan, " on ")
+	if i < 0 {
+		return 0
+	}
+	t, err := time.ParseInLocation(scrubTimeLayout, strings.TrimSpace(scan[i+len(" on "):]), loc)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,192 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+const degradedStatus = `  pool: tank
+ state: DEGRADED
+status: One or more devices could not be opened.  Sufficient replicas exist for
+	the pool to continue functioning in a degraded state.
+action: Attach the missing device and online it using 'zpool online'.
+   see: https://openzfs.github.io/openzfs-docs/msg/ZFS-8000-2Q
+  scan: scrub repaired 0B in 00:01:23 with 0 errors on Sun Oct 12 00:25:24 2025
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        DEGRADED     0     0     0
+	  mirror-0  DEGRADED     0     0     0
+	    sda     ONLINE       0     0     2
+	    sdb     UNAVAIL      4     1     0  cannot open
+	spares
+	  sdc       AVAIL
+
+errors: No known data errors
+`
+
+const datasetOutput = "used\t1073741824\navailable\t4294967296\nreferenced\t805306368\nusedbysnapshots\t268435456\ncompression\tlz4\ncompressratio\t1.52\n"
+
+func TestParsePoolStatus(t *testing.T) {
+	pool := parsePoolStatus([]byte(degradedStatus), time.UTC)
+
+	if pool.Name != "tank" || pool.State != "DEGRADED" {
+		t.Errorf("unexpected pool %q in state %q", pool.Name, pool.State)
+	}
+	wantStatus := "One or more devices could not be opened.  Sufficient replicas exist for the pool to continue functioning in a degraded state."
+	if pool.Status != wantStatus {
+		t.Errorf("expected status %q, got %q", wantStatus, pool.Status)
+	}
+	if pool.Action != "Attach the missing device and online it using 'zpool online'." {
+		t.Errorf("unexpected action %q", pool.Action)
+	}
+	if pool.Errors != "No known data errors" {
+		t.Errorf("unexpected errors %q", pool.Errors)
+	}
+	if want := time.Date(2025, 10, 12, 0, 25, 24, 0, time.UTC).Unix(); pool.LastScrub != want {
+		t.Errorf("expected last scrub %d, got %d", want, pool.LastScrub)
+	}
+
+	want := []storage.ZFSDevice{
+		{Name: "tank", State: "DEGRADED"},
+		{Name: "mirror-0", State: "DEGRADED", Depth: 1},
+		{Name: "sda", State: "ONLINE", Depth: 2, Checksum: 2},
+		{Name: "sdb", State: "UNAVAIL", Depth: 2, Read: 4, Write: 1},
+		{Name: "spares"},
+		{Name: "sdc", State: "AVAIL", Depth: 1},
+	}
+	if fmt.Sprint(pool.Devices) != fmt.Sprint(want) {
+		t.Errorf("expected devices %v, got %v", want, pool.Devices)
+	}
+}
+
+func TestLastScrub(t *testing.T) {
+	tests := []struct {
+		scan string
+		want int64
+	}{
+		{"scrub repaired 0B in 00:00:01 with 0 errors on Sat Nov  1 03:04:05 2025", time.Date(2025, 11, 1, 3, 4, 5, 0, time.UTC).Unix()},
+		{"scrub in progress since Sun Oct 12 00:24:01 2025 1.2G scanned", 0},
+		{"resilvered 1.5G in 00:02:00 with 0 errors on Sun Oct 12 00:25:24 2025", 0},
+		{"none requested", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := lastScrub(tt.scan, time.UTC); got != tt.want {
+			t.Errorf("lastScrub(%q) = %d, want %d", tt.scan, got, tt.want)
+		}
+	}
+}
+
+func TestZFSHealth(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot"), 0755)
+
+	t.Run("healthy", func(t *testing.T) {
+		var calls []string
+		z := NewZFS(root)
+		z.run = func(args ...string) ([]byte, error) {
+			calls = append(calls, "zfs "+strings.Join(args, " "))
+			if args[0] == "list" {
+				return []byte("tank/data\n"), nil
+			}
+			return []byte(datasetOutput), nil
+		}
+		z.runPool = func(args ...string) ([]byte, error) {
+			calls = append(calls, "zpool "+strings.Join(args, " "))
+			return []byte(degradedStatus), nil
+		}
+
+		health, err := z.Health()
+		if err != nil {
+			t.Fatalf("Health failed: %v", err)
+		}
+		wantDataset := storage.ZFSDataset{
+			Name:            "tank/data",
+			Used:            1073741824,
+			Available:       4294967296,
+			Referenced:      805306368,
+			UsedBySnapshots: 268435456,
+			Compression:     "lz4",
+			CompressRatio:   1.52,
+		}
+		if health.Dataset != wantDataset {
+			t.Errorf("expected dataset %+v, got %+v", wantDataset, health.Dataset)
+		}
+		if health.Pool.Name != "tank" || len(health.Pool.Devices) != 6 {
+			t.Errorf("unexpected pool %+v", health.Pool)
+		}
+		if last := calls[len(calls)-1]; last != "zpool status -p tank" {
+			t.Errorf("expected status of the pool, got %q", last)
+		}
+	})
+
+	t.Run("tools missing", func(t *testing.T) {
+		z := NewZFS(root)
+		z.run = func(args ...string) ([]byte, error) {
+			return nil, fmt.Errorf("zfs list: %w", &exec.Error{Name: "zfs", Err: exec.ErrNotFound})
+		}
+		if _, err := z.Health(); !errors.Is(err, storage.ErrNotSupported) {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+	})
+
+	t.Run("not on ZFS", func(t *testing.T) {
+		z := NewZFS(t.TempDir())
+		z.run = func(args ...string) ([]byte, error) {
+			t.Fatalf("unexpected zfs %v", args)
+			return nil, nil
+		}
+		if _, err := z.Health(); !errors.Is(err, storage.ErrNotSupported) {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+	})
+}
+
+func TestSnapshotSpace(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot"), 0755)
+
+	var calls []string
+	z := NewZFS(root)
+	z.run = func(args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " "))
+		switch args[0] {
+		case "list":
+			if args[1] == "-H" {
+				return []byte("tank/data\n"), nil
+			}
+			return []byte("tank/data@daily-2025-11-08\t1024\t4096\t8192\t1762560000\n" +
+				"tank/data@before-cleanup\t0\t512\t8704\t1762600000\n"), nil
+		default:
+			return []byte("1536\n"), nil
+		}
+	}
+
+	space, err := z.SnapshotSpace()
+	if err != nil {
+		t.Fatalf("SnapshotSpace failed: %v", err)
+	}
+	if space.Dataset != "tank/data" || space.Used != 1536 {
+		t.Errorf("unexpected space %+v", space)
+	}
+	daily, _ := z.parseTimestampFromName("daily-2025-11-08")
+	want := []storage.SnapshotUsage{
+		{ID: "zfs:daily-2025-11-08", Name: "daily-2025-11-08", Timestamp: daily, Used: 1024, Written: 4096, Referenced: 8192},
+		{ID: "zfs:before-cleanup", Name: "before-cleanup", Timestamp: 1762600000, Written: 512, Referenced: 8704},
+	}
+	if fmt.Sprint(space.Snapshots) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, space.Snapshots)
+	}
+	if last := calls[len(calls)-1]; !strings.Contains(last, "-t snapshot -d 1") || !strings.HasSuffix(last, " tank/data") {
+		t.Errorf("expected snapshots of the dataset to be listed, got %q", last)
+	}
+}
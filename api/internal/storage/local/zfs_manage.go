@@ -0,0 +1,147 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// snapshotNameRegex matches snapshot names that are safe to pass to zfs.
+// Notably it excludes "%" and "," which zfs destroy interprets as ranges and lists.
+var snapshotNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,200}$`)
+
+// defaultSnapshotPrefix prefixes generated snapshot names
+const defaultSnapshotPrefix = "timeship-"
+
+// runZFS runs the zfs command line tool and returns its standard output.
+// Errors include the standard error output of the command.
+func runZFS(args ...string) ([]byte, error) {
+	return runTool("zfs", args...)
+}
+
+// runZpool runs the zpool command line tool like runZFS
+func runZpool(args ...string) ([]byte, error) {
+	return runTool("zpool", args...)
+}
+
+// runTool runs a command line tool and returns its standard output
+func runTool(name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, fmt.Errorf("%s %s: %w", name, args[0], err)
+		}
+		return nil, fmt.Errorf("%s %s: %s", name, args[0], msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// dataset returns the name of the ZFS dataset containing the root directory
+func (z *ZFS) dataset() (string, error) {
+	rootDir, err := filepath.Abs(z.rootDir)
+	if err != nil {
+		return "", err
+	}
+	out, err := z.run("list", "-H", "-o", "name", rootDir)
+	if err != nil {
+		return "", fmt.Errorf("unable to find dataset: %w", err)
+	}
+	name := strings.TrimSpace(string(out))
+	if name == "" {
+		return "", errors.New("unable to find dataset: no output")
+	}
+	return name, nil
+}
+
+// CreateSnapshot creates a snapshot of the dataset containing the root
+// directory. Datasets nested below the root aren't included, as their
+// snapshots are separate.
+func (z *ZFS) CreateSnapshot(name string) (storage.Snapshot, error) {
+	now := time.Now()
+	if name == "" {
+		// Generated names are parsed back in the same location
+		name = defaultSnapshotPrefix + now.In(z.location).Format("2006-01-02_15-04-05")
+	}
+	if !snapshotNameRegex.MatchString(name) {
+		return storage.Snapshot{}, fmt.Errorf("invalid snapshot name %q: %w", name, fs.ErrInvalid)
+	}
+
+	dataset, err := z.rootDataset()
+	if err != nil {
+		return storage.Snapshot{}, err
+	}
+
+	if _, err := z.run("snapshot", dataset+"@"+name); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return storage.Snapshot{}, fmt.Errorf("snapshot %q: %w", name, fs.ErrExist)
+		}
+		return storage.Snapshot{}, err
+	}
+
+	timestamp, parsed := z.parseTimestampFromName(name)
+	if !parsed {
+		timestamp = now.Unix()
+	}
+
+	return storage.Snapshot{
+		ID:        "zfs:" + name,
+		Type:      "zfs",
+		Timestamp: timestamp,
+		Name:      name,
+		Size:      -1,
+		Metadata: storage.SnapshotMetadata{
+			"zfs_dataset": dataset,
+			"time":        z.formatTime(timestamp),
+		},
+	}, nil
+}
+
+// DestroySnapshot destroys a snapshot of the dataset containing the root
+// directory. Snapshots of nested datasets share the form of their IDs but
+// aren't destroyed, failing with storage.ErrSnapshotNotFound unless the root
+// dataset has one of the same name.
+func (z *ZFS) DestroySnapshot(id string) error {
+	name, err := z.getSnapshotPath(id)
+	if err != nil {
+		return fmt.Errorf("%w: %w", fs.ErrInvalid, err)
+	}
+	if !snapshotNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q: %w", name, fs.ErrInvalid)
+	}
+
+	dataset, err := z.rootDataset()
+	if err != nil {
+		return err
+	}
+
+	// The snapshot directory of the root lists only the snapshots of its
+	// own dataset
+	snapshotDir, _, err := z.findSnapshotRoot("")
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(filepath.Join(snapshotDir, name)); err != nil || !info.IsDir() {
+		return fmt.Errorf("snapshot %q of %s: %w", name, dataset, storage.ErrSnapshotNotFound)
+	}
+
+	if _, err := z.run("destroy", dataset+"@"+name); err != nil {
+		if strings.Contains(err.Error(), "could not find") || strings.Contains(err.Error(), "does not exist") {
+			return fmt.Errorf("snapshot %q: %w", name, storage.ErrSnapshotNotFound)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package local
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"timeship/internal/storage"
+)
+
+// fakeZFS records zfs invocations and answers them with canned results
+type fakeZFS struct {
+	calls [][]string
+	err   error
+}
+
+func (f *fakeZFS) run(args ...string) ([]byte, error) {
+	f.calls = append(f.calls, args)
+	if args[0] == "list" {
+		return []byte("tank/data\n"), nil
+	}
+	return nil, f.err
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot"), 0755)
+
+	t.Run("named", func(t *testing.T) {
+		fake := &fakeZFS{}
+		z := NewZFS(root)
+		z.run = fake.run
+
+		snap, err := z.CreateSnapshot("before-cleanup")
+		if err != nil {
+			t.Fatalf("CreateSnapshot failed: %v", err)
+		}
+		if snap.ID != "zfs:before-cleanup" || snap.Name != "before-cleanup" {
+			t.Errorf("unexpected snapshot %+v", snap)
+		}
+		if snap.Timestamp == 0 {
+			t.Error("expected creation time as timestamp")
+		}
+
+		abs, _ := filepath.Abs(root)
+		want := [][]string{
+			{"list", "-H", "-o", "name", abs},
+			{"snapshot", "tank/data@before-cleanup"},
+		}
+		if len(fake.calls) != len(want) {
+			t.Fatalf("expected %v, got %v", want, fake.calls)
+		}
+		for i := range want {
+			if strings.Join(fake.calls[i], " ") != strings.Join(want[i], " ") {
+				t.Errorf("call %d: expected %v, got %v", i, want[i], fake.calls[i])
+			}
+		}
+	})
+
+	t.Run("generated name", func(t *testing.T) {
+		fake := &fakeZFS{}
+		z := NewZFS(root)
+		z.run = fake.run
+
+		snap, err := z.CreateSnapshot("")
+		if err != nil {
+			t.Fatalf("CreateSnapshot failed: %v", err)
+		}
+		if !strings.HasPrefix(snap.Name, defaultSnapshotPrefix) {
+			t.Errorf("expected generated name, got %q", snap.Name)
+		}
+		if _, ok := z.parseTimestampFromName(snap.Name); !ok {
+			t.Errorf("expected generated name %q to be parseable", snap.Name)
+		}
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		for _, name := range []string{"a b", "a@b", "a/b", "a%b", "a,b", strings.Repeat("a", 201)} {
+			fake := &fakeZFS{}
+			z := NewZFS(root)
+			z.run = fake.run
+
+			_, err := z.CreateSnapshot(name)
+			if !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("%q: expected ErrInvalid, got %v", name, err)
+			}
+			if len(fake.calls) != 0 {
+				t.Errorf("%q: expected no zfs calls, got %v", name, fake.calls)
+			}
+		}
+	})
+
+	t.Run("not on ZFS", func(t *testing.T) {
+		fake := &fakeZFS{}
+		z := NewZFS(t.TempDir())
+		z.run = fake.run
+
+		_, err := z.CreateSnapshot("x")
+		if !errors.Is(err, storage.ErrNotSupported) {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+		if len(fake.calls) != 0 {
+			t.Errorf("expected no zfs calls, got %v", fake.calls)
+		}
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		fake := &fakeZFS{err: errors.New("zfs snapshot: cannot create snapshot 'tank/data@x': dataset already exists")}
+		z := NewZFS(root)
+		z.run = fake.run
+
+		_, err := z.CreateSnapshot("x")
+		if !errors.Is(err, fs.ErrExist) {
+			t.Errorf("expected ErrExist, got %v", err)
+		}
+	})
+}
+
+func TestDestroySnapshot(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"before-cleanup", "racing"} {
+		os.MkdirAll(filepath.Join(root, ".zfs", "snapshot", name), 0755)
+	}
+	// A nested dataset with snapshots of its own
+	os.MkdirAll(filepath.Join(root, "child", ".zfs", "snapshot", "child-only"), 0755)
+
+	tests := []struct {
+		name    string
+		id      string
+		zfsErr  error
+		wantErr error
+		wantArg string
+	}{
+		{name: "destroy", id: "zfs:before-cleanup", wantArg: "tank/data@before-cleanup"},
+		{name: "not found", id: "zfs:gone", wantErr: storage.ErrSnapshotNotFound},
+		{name: "nested dataset", id: "zfs:child-only", wantErr: storage.ErrSnapshotNotFound},
+		{name: "destroyed meanwhile", id: "zfs:racing", zfsErr: errors.New("zfs destroy: could not find any snapshots to destroy"), wantErr: storage.ErrSnapshotNotFound},
+		{name: "wrong type", id: "git:abc", wantErr: fs.ErrInvalid},
+		{name: "range", id: "zfs:a%b", wantErr: fs.ErrInvalid},
+		{name: "empty", id: "zfs:", wantErr: fs.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeZFS{err: tt.zfsErr}
+			z := NewZFS(root)
+			z.run = fake.run
+
+			err := z.DestroySnapshot(tt.id)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				if tt.zfsErr == nil {
+					for _, call := range fake.calls {
+						if call[0] == "destroy" {
+							t.Errorf("expected no destroy, got %v", call)
+						}
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DestroySnapshot failed: %v", err)
+			}
+			last := fake.calls[len(fake.calls)-1]
+			if last[0] != "destroy" || last[1] != tt.wantArg {
+				t.Errorf("expected destroy %s, got %v", tt.wantArg, last)
+			}
+		})
+	}
+}
+
+func TestManageSnapshotsDisabled(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer s.Close()
+
+	if _, err := s.CreateSnapshot("x"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("CreateSnapshot: expected ErrPermission, got %v", err)
+	}
+	if err := s.DestroySnapshot("zfs:x"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("DestroySnapshot: expected ErrPermission, got %v", err)
+	}
+}
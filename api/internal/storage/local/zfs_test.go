@@ -1,8 +1,14 @@
 package local
 
 import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"timeship/internal/storage"
 )
 
 func TestParseTimestampFromName(t *testing.T) {
@@ -74,12 +80,39 @@ func TestParseTimestampFromName(t *testing.T) {
 			wantUnix:   time.Date(2025, 11, 9, 0, 0, 0, 0, time.UTC).Unix(),
 			wantParsed: true,
 		},
+		{
+			name:         "custom pattern with timezone",
+			snapshotName: "snap_20251109-1430",
+			patterns: []DateTimePattern{
+				{
+					Regex:    `snap_(\d{8}-\d{4})`,
+					Layout:   "20060102-1504",
+					Timezone: "Europe/Berlin",
+				},
+			},
+			wantUnix:   time.Date(2025, 11, 9, 13, 30, 0, 0, time.UTC).Unix(),
+			wantParsed: true,
+		},
+		{
+			name:         "offset in name overrides timezone",
+			snapshotName: "snap_2025-11-09T14:30:00+02:00",
+			patterns: []DateTimePattern{
+				{
+					Regex:    `snap_(\S+)`,
+					Layout:   time.RFC3339,
+					Timezone: "Europe/Berlin",
+				},
+			},
+			wantUnix:   time.Date(2025, 11, 9, 12, 30, 0, 0, time.UTC).Unix(),
+			wantParsed: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			zfs := NewZFSWithConfig("/tmp", ZFSConfig{
 				DateTimePatterns: tt.patterns,
+				Location:         time.UTC,
 			})
 
 			gotUnix, gotParsed := zfs.parseTimestampFromName(tt.snapshotName)
@@ -159,3 +192,165 @@ func TestNewZFS(t *testing.T) {
 		}
 	})
 }
+
+func TestDateTimePatternValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern DateTimePattern
+		wantErr bool
+	}{
+		{"valid", DateTimePattern{Regex: `snap_(\d{8})`, Layout: "20060102"}, false},
+		{"valid timezone", DateTimePattern{Regex: `snap_(\d{8})`, Layout: "20060102", Timezone: "America/New_York"}, false},
+		{"invalid regex", DateTimePattern{Regex: `snap_(`, Layout: "20060102"}, true},
+		{"no capturing group", DateTimePattern{Regex: `snap_\d{8}`, Layout: "20060102"}, true},
+		{"missing layout", DateTimePattern{Regex: `snap_(\d{8})`}, true},
+		{"invalid timezone", DateTimePattern{Regex: `snap_(\d{8})`, Layout: "20060102", Timezone: "Mars/Olympus"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pattern.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnapshotPatternsConfig(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot", "nightly.09.11.2025"), 0755)
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot", "daily-2025-11-08"), 0755)
+
+	s, err := NewWithConfig(root, Config{
+		SnapshotPatterns: []DateTimePattern{
+			{Regex: `nightly\.(\d{2}\.\d{2}\.\d{4})`, Layout: "02.01.2006"},
+		},
+		SnapshotTimezone: "UTC",
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig failed: %v", err)
+	}
+	defer s.Close()
+
+	snapshots, err := s.ListSnapshots(url.URL{Scheme: "local"})
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+
+	want := map[string]int64{
+		"nightly.09.11.2025": time.Date(2025, 11, 9, 0, 0, 0, 0, time.UTC).Unix(),
+		// Default patterns still apply after the custom ones
+		"daily-2025-11-08": time.Date(2025, 11, 8, 0, 0, 0, 0, time.UTC).Unix(),
+	}
+	if len(snapshots) != len(want) {
+		t.Fatalf("expected %d snapshots, got %+v", len(want), snapshots)
+	}
+	for _, snap := range snapshots {
+		if snap.Timestamp != want[snap.Name] {
+			t.Errorf("%s: expected timestamp %d, got %d", snap.Name, want[snap.Name], snap.Timestamp)
+		}
+	}
+
+	_, err = NewWithConfig(root, Config{
+		SnapshotPatterns: []DateTimePattern{{Regex: `(`, Layout: "2006"}},
+	})
+	if err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestSnapshotTimezone(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, ".zfs", "snapshot", "auto-hourly-2025-11-09_13-30"), 0755)
+
+	tests := []struct {
+		name     string
+		timezone string
+		wantUnix int64
+		wantTime string
+	}{
+		{"utc", "UTC", time.Date(2025, 11, 9, 13, 30, 0, 0, time.UTC).Unix(), "2025-11-09T13:30:00Z"},
+		{"berlin", "Europe/Berlin", time.Date(2025, 11, 9, 12, 30, 0, 0, time.UTC).Unix(), "2025-11-09T13:30:00+01:00"},
+		{"new york", "America/New_York", time.Date(2025, 11, 9, 18, 30, 0, 0, time.UTC).Unix(), "2025-11-09T13:30:00-05:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewWithConfig(root, Config{SnapshotTimezone: tt.timezone})
+			if err != nil {
+				t.Fatalf("NewWithConfig failed: %v", err)
+			}
+			defer s.Close()
+
+			snapshots, err := s.ListSnapshots(url.URL{Scheme: "local"})
+			if err != nil || len(snapshots) != 1 {
+				t.Fatalf("expected 1 snapshot, got %+v %v", snapshots, err)
+			}
+			if snapshots[0].Timestamp != tt.wantUnix {
+				t.Errorf("expected timestamp %d, got %d", tt.wantUnix, snapshots[0].Timestamp)
+			}
+			if snapshots[0].Metadata["time"] != tt.wantTime {
+				t.Errorf("expected time %s, got %v", tt.wantTime, snapshots[0].Metadata["time"])
+			}
+		})
+	}
+
+	t.Run("default local", func(t *testing.T) {
+		z := NewZFS(root)
+		got, _ := z.parseTimestampFromName("auto-hourly-2025-11-09_13-30")
+		want := time.Date(2025, 11, 9, 13, 30, 0, 0, time.Local).Unix()
+		if got != want {
+			t.Errorf("expected local time %d, got %d", want, got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewWithConfig(root, Config{SnapshotTimezone: "Mars/Olympus"}); err == nil {
+			t.Error("expected error for unknown timezone")
+		}
+	})
+}
+
+func TestSnapshotRootRejectsTraversal(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootDir, ".zfs", "snapshot", "daily-2025-11-09", "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	z := NewZFS(rootDir)
+
+	root, relPath, err := z.SnapshotRoot("docs", "zfs:daily-2025-11-09")
+	if err != nil {
+		t.Fatalf("SnapshotRoot failed: %v", err)
+	}
+	root.Close()
+	if relPath != "docs" {
+		t.Errorf("expected relative path docs, got %q", relPath)
+	}
+
+	for _, id := range []string{"zfs:..", "zfs:../..", "zfs:daily/../..", "zfs:", "zfs:" + filepath.Join("..", "..")} {
+		if root, _, err := z.SnapshotRoot("docs", id); err == nil {
+			root.Close()
+			t.Errorf("expected snapshot ID %q to be rejected", id)
+		}
+	}
+}
+
+func TestSnapshotRootNotFound(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootDir, ".zfs", "snapshot", "daily-2025-11-09"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	z := NewZFS(rootDir)
+
+	for _, id := range []string{"zfs:weekly-2025-11-09", "git:abc", "zfs:.."} {
+		if _, _, err := z.SnapshotRoot("docs", id); !errors.Is(err, storage.ErrSnapshotNotFound) {
+			t.Errorf("expected snapshot %s not to be found, got %v", id, err)
+		}
+	}
+
+	// Directories outside of any dataset have no snapshots
+	if _, _, err := NewZFS(t.TempDir()).SnapshotRoot("docs", "zfs:daily-2025-11-09"); !errors.Is(err, storage.ErrSnapshotNotFound) {
+		t.Errorf("expected no snapshots outside of a dataset, got %v", err)
+	}
+}
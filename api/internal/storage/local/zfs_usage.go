@@ -0,0 +1,83 @@
+package local
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"timeship/internal/storage"
+)
+
+// SnapshotSpace returns the space held by each snapshot of the dataset
+// containing the root directory, oldest first. Fails with
+// storage.ErrNotSupported if the root isn't on ZFS or the zfs tools aren't
+// installed.
+func (z *ZFS) SnapshotSpace() (storage.SnapshotSpace, error) {
+	name, err := z.rootDataset()
+	if err != nil {
+		return storage.SnapshotSpace{}, err
+	}
+
+	out, err := z.run("get", "-Hp", "-o", "value", "usedbysnapshots", name)
+	if err != nil {
+		return storage.SnapshotSpace{}, toolError(err)
+	}
+	used, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return storage.SnapshotSpace{}, fmt.Errorf("invalid usedbysnapshots %q of %s", strings.TrimSpace(string(out)), name)
+	}
+
+	// Only snapshots of the dataset itself, as those of child datasets
+	// aren't in its .zfs directory
+	out, err = z.run("list", "-Hp", "-t", "snapshot", "-d", "1", "-s", "createtxg", "-o", "name,used,written,referenced,creation", name)
+	if err != nil {
+		return storage.SnapshotSpace{}, toolError(err)
+	}
+	snapshots, err := z.parseSnapshotUsage(name, out)
+	if err != nil {
+		return storage.SnapshotSpace{}, err
+	}
+
+	return storage.SnapshotSpace{Dataset: name, Used: used, Snapshots: snapshots}, nil
+}
+
+// parseSnapshotUsage parses the output of zfs list -Hp -o
+// name,used,written,referenced,creation for snapshots of the dataset.
+// Snapshots are timestamped like Snapshots does, falling back to their
+// creation time.
+func (z *ZFS) parseSnapshotUsage(dataset string, out []byte) ([]storage.SnapshotUsage, error) {
+	snapshots := []storage.SnapshotUsage{}
+	for line := range strings.Lines(string(out)) {
+		fields := strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+		if len(fields) != 5 {
+			continue
+		}
+		name, ok := strings.CutPrefix(fields[0], dataset+"@")
+		if !ok {
+			continue
+		}
+
+		var values [4]int64
+		for i, field := range fields[1:] {
+			n, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q of snapshot %s", field, fields[0])
+			}
+			values[i] = n
+		}
+
+		timestamp, parsed := z.parseTimestampFromName(name)
+		if !parsed {
+			timestamp = values[3]
+		}
+		snapshots = append(snapshots, storage.SnapshotUsage{
+			ID:         "zfs:" + name,
+			Name:       name,
+			Timestamp:  timestamp,
+			Used:       values[0],
+			Written:    values[1],
+			Referenced: values[2],
+		})
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,268 @@
+// Package pinned provides read-only storages pinned to a single snapshot of
+// another storage.
+//
+// A pinned storage exposes the contents of the snapshot as if it was the
+// current state of the storage, so clients get a consistent point-in-time view
+// without passing the snapshot with every request.
+package pinned
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"timeship/internal/storage"
+)
+
+// nameRegex matches valid pinned storage names, e.g. "local.daily-2025-11-09".
+// Names are used as URL schemes like those of other storages, so they follow
+// the same rules.
+var nameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+// invalidLabelChars matches the characters of snapshot names not allowed in
+// storage names
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9+.-]+`)
+
+// ValidName reports whether name is a valid pinned storage name
+func ValidName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+// DefaultName returns the default name of a storage pinned to a snapshot,
+// the base storage name and the snapshot name joined by ".", e.g.
+// "local.daily-2025-11-09" for the snapshot "zfs:daily-2025-11-09".
+// Characters not allowed in storage names are replaced by "-".
+func DefaultName(baseName string, snapshotID string) string {
+	name := snapshotID
+	if _, after, ok := strings.Cut(name, ":"); ok {
+		name = after
+	}
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[i+1:]
+	}
+	return baseName + "." + invalidLabelChars.ReplaceAllString(name, "-")
+}
+
+// Storage is a read-only view of a snapshot of another storage
+type Storage struct {
+	name     string
+	base     storage.Storage
+	baseName string
+	snapshot storage.Snapshot
+}
+
+// New creates a storage named name showing the snapshot with the given ID of
+// the base storage named baseName. Fails with fs.ErrNotExist if the base
+// storage has no such snapshot.
+func New(name string, base storage.Storage, baseName string, snapshotID string) (*Storage, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid pinned storage name %q", name)
+	}
+
+	snap, err := findSnapshot(base, baseName, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		name:     name,
+		base:     base,
+		baseName: baseName,
+		snapshot: snap,
+	}, nil
+}
+
+// findSnapshot returns the snapshot of the base storage with the ID
+func findSnapshot(base storage.Storage, baseName string, snapshotID string) (storage.Snapshot, error) {
+	lister, ok := base.(storage.SnapshotLister)
+	if !ok {
+		return storage.Snapshot{}, fmt.Errorf("storage %s does not support snapshots: %w", baseName, storage.ErrNotSupported)
+	}
+
+	snapshots, err := lister.ListSnapshots(url.URL{Scheme: baseName})
+	if err != nil {
+		return storage.Snapshot{}, fmt.Errorf("unable to list snapshots of %s: %w", baseName, err)
+	}
+	for _, snap := range snapshots {
+		if snap.ID == snapshotID {
+			return snap, nil
+		}
+	}
+
+	return storage.Snapshot{}, fmt.Errorf("snapshot %s of %s: %w", snapshotID, baseName, storage.ErrSnapshotNotFound)
+}
+
+// CheckHealth implements storage.HealthChecker
+// The base storage must be healthy and the snapshot must still exist
+func (s *Storage) CheckHealth() error {
+	if checker, ok := s.base.(storage.HealthChecker); ok {
+		if err := checker.CheckHealth(); err != nil {
+			return err
+		}
+	}
+	_, err := findSnapshot(s.base, s.baseName, s.snapshot.ID)
+	return err
+}
+
+// Name returns the name of the pinned storage
+func (s *Storage) Name() string {
+	return s.name
+}
+
+// BaseName returns the name of the storage the snapshot belongs to
+func (s *Storage) BaseName() string {
+	return s.baseName
+}
+
+// Snapshot returns the pinned snapshot
+func (s *Storage) Snapshot() storage.Snapshot {
+	return s.snapshot
+}
+
+// toBase converts a path of the pinned storage to a snapshot path of the base storage
+func (s *Storage) toBase(path url.URL) (url.URL, error) {
+	if path.Scheme != s.name {
+		return url.URL{}, fmt.Errorf("path %q does not belong to storage %s: %w", path.String(), s.name, fs.ErrNotExist)
+	}
+	// The pinned snapshot always wins over a snapshot requested by the caller
+	q := url.Values{}
+	q.Set("snapshot", s.snapshot.ID)
+	return url.URL{
+		Scheme:   s.baseName,
+		Path:     path.Path,
+		RawQuery: q.Encode(),
+	}, nil
+}
+
+// fromBase converts a snapshot path of the base storage to a path of the pinned storage
+func (s *Storage) fromBase(path url.URL) url.URL {
+	return url.URL{
+		Scheme: s.name,
+		Path:   path.Path,
+	}
+}
+
+// ListContents implements storage.Lister
+func (s *Storage) ListContents(path url.URL) ([]storage.FileNode, error) {
+	lister, ok := s.base.(storage.Lister)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	basePath, err := s.toBase(path)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := lister.ListContents(basePath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range nodes {
+		nodes[i].Path = s.fromBase(nodes[i].Path)
+	}
+	return nodes, nil
+}
+
+// reader returns the base storage as a Reader and the base path
+func (s *Storage) reader(path url.URL) (storage.Reader, url.URL, error) {
+	reader, ok := s.base.(storage.Reader)
+	if !ok {
+		return nil, url.URL{}, storage.ErrNotSupported
+	}
+	basePath, err := s.toBase(path)
+	return reader, basePath, err
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(path url.URL) (io.ReadCloser, error) {
+	reader, basePath, err := s.reader(path)
+	if err != nil {
+		return nil, err
+	}
+	return reader.ReadStream(basePath)
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(path url.URL) (int64, error) {
+	reader, basePath, err := s.reader(path)
+	if err != nil {
+		return 0, err
+	}
+	return reader.FileSize(basePath)
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(path url.URL) (string, error) {
+	reader, basePath, err := s.reader(path)
+	if err != nil {
+		return "", err
+	}
+	return reader.MimeType(basePath)
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(path url.URL) (int64, error) {
+	stater, ok := s.base.(storage.Stater)
+	if !ok {
+		return 0, storage.ErrNotSupported
+	}
+	basePath, err := s.toBase(path)
+	if err != nil {
+		return 0, err
+	}
+	return stater.LastModified(basePath)
+}
+
+// NodeType implements storage.NodeTyper
+func (s *Storage) NodeType(path url.URL) (string, error) {
+	typer, ok := s.base.(storage.NodeTyper)
+	if !ok {
+		return "", storage.ErrNotSupported
+	}
+	basePath, err := s.toBase(path)
+	if err != nil {
+		return "", err
+	}
+	return typer.NodeType(basePath)
+}
+
+// NodeTimes implements storage.TimeStater
+func (s *Storage) NodeTimes(path url.URL) (storage.NodeTimes, error) {
+	stater, ok := s.base.(storage.TimeStater)
+	if !ok {
+		return storage.NodeTimes{}, storage.ErrNotSupported
+	}
+	basePath, err := s.toBase(path)
+	if err != nil {
+		return storage.NodeTimes{}, err
+	}
+	return stater.NodeTimes(basePath)
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(path url.URL) (bool, error) {
+	existence, ok := s.base.(storage.Existence)
+	if !ok {
+		return false, storage.ErrNotSupported
+	}
+	basePath, err := s.toBase(path)
+	if err != nil {
+		return false, err
+	}
+	return existence.FileExists(basePath)
+}
+
+// DirectoryExists implements storage.Existence
+func (s *Storage) DirectoryExists(path url.URL) (bool, error) {
+	existence, ok := s.base.(storage.Existence)
+	if !ok {
+		return false, storage.ErrNotSupported
+	}
+	basePath, err := s.toBase(path)
+	if err != nil {
+		return false, err
+	}
+	return existence.DirectoryExists(basePath)
+}
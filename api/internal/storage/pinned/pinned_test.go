@@ -0,0 +1,146 @@
+package pinned
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"timeship/internal/storage"
+	"timeship/internal/storage/local"
+)
+
+func TestDefaultName(t *testing.T) {
+	tests := []struct {
+		baseName   string
+		snapshotID string
+		expected   string
+	}{
+		{"local", "zfs:daily-2025-11-09", "local.daily-2025-11-09"},
+		{"local", "zfs:tank@daily-2025-11-09", "local.daily-2025-11-09"},
+		{"nas", "plain", "nas.plain"},
+		{"nas", "restic:2025_11_09 10:00", "nas.2025-11-09-10-00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.snapshotID, func(t *testing.T) {
+			name := DefaultName(tt.baseName, tt.snapshotID)
+			if name != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, name)
+			}
+			if !ValidName(name) {
+				t.Errorf("expected %q to be valid", name)
+			}
+		})
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"local.2025-11-09", true},
+		{"local+daily", true},
+		{"local@2025-11-09", false},
+		{"local.zfs:daily", false},
+		{"local.a/b", false},
+		{"1local.daily", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ValidName(tt.name) != tt.valid {
+				t.Errorf("expected valid=%v", tt.valid)
+			}
+		})
+	}
+}
+
+func TestStorage(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "file.txt"), []byte("current"), 0644)
+	daily := filepath.Join(root, ".zfs", "snapshot", "daily-2025-11-09")
+	os.MkdirAll(filepath.Join(daily, "docs"), 0755)
+	os.WriteFile(filepath.Join(daily, "file.txt"), []byte("old"), 0644)
+
+	base, err := local.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+
+	s, err := New("local.2025-11-09", base, "local", "zfs:daily-2025-11-09")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		nodes, err := s.ListContents(url.URL{Scheme: "local.2025-11-09"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 2 {
+			t.Fatalf("expected 2 nodes, got %+v", nodes)
+		}
+		for _, node := range nodes {
+			if node.Path.Scheme != "local.2025-11-09" || node.Path.RawQuery != "" {
+				t.Errorf("expected path in pinned storage, got %s", node.Path.String())
+			}
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		// A snapshot requested by the caller is ignored
+		r, err := s.ReadStream(url.URL{Scheme: "local.2025-11-09", Path: "file.txt", RawQuery: "snapshot=zfs:other"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		content, _ := io.ReadAll(r)
+		if string(content) != "old" {
+			t.Errorf("expected snapshot content, got %q", content)
+		}
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		exists, err := s.DirectoryExists(url.URL{Scheme: "local.2025-11-09", Path: "docs"})
+		if err != nil || !exists {
+			t.Errorf("expected docs to exist, got %v %v", exists, err)
+		}
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		var store storage.Storage = s
+		if _, ok := store.(storage.Writer); ok {
+			t.Error("expected pinned storage not to be writable")
+		}
+		if _, ok := store.(storage.Deleter); ok {
+			t.Error("expected pinned storage not to support deletes")
+		}
+	})
+
+	t.Run("wrong storage", func(t *testing.T) {
+		_, err := s.FileSize(url.URL{Scheme: "local", Path: "file.txt"})
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist error, got %v", err)
+		}
+	})
+
+	t.Run("missing snapshot", func(t *testing.T) {
+		_, err := New("local.missing", base, "local", "zfs:missing")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist error, got %v", err)
+		}
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		if _, err := New("local@2025-11-09", base, "local", "zfs:daily-2025-11-09"); err == nil {
+			t.Error("expected error for name that isn't a valid URL scheme")
+		}
+	})
+}
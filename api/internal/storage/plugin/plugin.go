@@ -0,0 +1,506 @@
+// Package plugin provides storages backed by external programs, so storage
+// backends can be added without changing timeship.
+//
+// The program is started once and answers requests, one at a time, as
+// newline-delimited JSON on its standard input and output. Its standard
+// error is logged. Each request has a method and the fields it needs:
+//
+//	{"method":"hello","options":{"host":"backup.example.com"}}
+//	{"methods":["list","stat","read","snapshots"]}
+//
+//	{"method":"list","path":"docs","snapshot":""}
+//	{"nodes":[{"name":"a.txt","type":"file","size":5,"modified":1760000000,"mime_type":"text/plain"}]}
+//
+//	{"method":"stat","path":"docs/a.txt","snapshot":""}
+//	{"node":{"name":"a.txt","type":"file","size":5,"modified":1760000000}}
+//
+//	{"method":"read","path":"docs/a.txt","snapshot":"","offset":0,"length":65536}
+//	{"data":"aGVsbG8="}
+//
+//	{"method":"snapshots","path":"docs"}
+//	{"snapshots":[{"id":"s3:v1","type":"s3","name":"v1","timestamp":1760000000,"size":-1}]}
+//
+//	{"method":"health"}
+//	{}
+//
+// The hello request is sent first and passes the options of the storage
+// config. Its response lists the methods the program supports, the others
+// fail with storage.ErrNotSupported. Paths are relative to the storage root
+// without leading slashes. Node types are "file", "dir" or "special". Read
+// returns data as base64, less than the length only at the end of the file.
+//
+// Failures are responses with an error, e.g.
+// {"error":{"code":"not_found","message":"no such file"}}. The codes
+// not_found, permission_denied, invalid, not_supported and
+// snapshot_not_found map to the errors of the storage package.
+//
+// If the program exits or answers with invalid JSON, it's started again for
+// the next request. Programs not answering a request within the timeout are
+// killed and started again as well, failing the request.
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// readChunkSize is how many bytes are read from the program per request
+const readChunkSize = 256 * 1024
+
+// defaultTimeout is how long the program may take to answer a request
+const defaultTimeout = 30 * time.Second
+
+// maxMessageSize is the maximum size of a response line, large enough for
+// a read chunk in base64 and long listings
+const maxMessageSize = 64 * 1024 * 1024
+
+// Config holds configuration for the plugin storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths
+	Name string
+
+	// Command is the program and its arguments
+	Command []string
+
+	// Options are passed to the program in the hello request
+	Options map[string]string
+
+	// Timeout limits how long the program may take to answer a request,
+	// defaults to 30s
+	Timeout time.Duration
+}
+
+// request is a request to the program
+type request struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path,omitempty"`
+	Snapshot string            `json:"snapshot,omitempty"`
+	Offset   int64             `json:"offset,omitempty"`
+	Length   int64             `json:"length,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+// node is a file or directory in a response
+type node struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"`
+	MimeType string `json:"mime_type"`
+}
+
+// snapshot is a snapshot in a response
+type snapshot struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Timestamp int64  `json:"timestamp"`
+	Size      int64  `json:"size"`
+}
+
+// response is a response of the program
+type response struct {
+	Methods   []string   `json:"methods"`
+	Nodes     []node     `json:"nodes"`
+	Node      *node      `json:"node"`
+	Snapshots []snapshot `json:"snapshots"`
+	Data      []byte     `json:"data"`
+	Error     *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Storage implements read-only storage interfaces by asking a program
+type Storage struct {
+	name    string
+	command []string
+	options map[string]string
+	timeout time.Duration
+
+	// mu is held for each request, so a program that doesn't answer
+	// blocks the others until it's killed after the timeout
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	pipe    io.Closer
+	stdout  *bufio.Scanner
+	methods []string
+}
+
+// New creates a plugin storage and starts its program
+func New(config Config) (*Storage, error) {
+	if len(config.Command) == 0 {
+		return nil, errors.New("command is required")
+	}
+	name := config.Name
+	if name == "" {
+		name = "plugin"
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	s := &Storage{name: name, command: config.Command, options: config.Options, timeout: timeout}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// start starts the program and says hello. The caller must hold the lock.
+func (s *Storage) start() error {
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = &logWriter{prefix: "Plugin " + s.name + ": "}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start plugin: %w", err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, maxMessageSize)
+	s.cmd, s.stdin, s.pipe, s.stdout = cmd, stdin, stdout, scanner
+
+	resp, err := s.roundTrip(request{Method: "hello", Options: s.options})
+	if err != nil {
+		s.stop()
+		return fmt.Errorf("plugin hello failed: %w", err)
+	}
+	s.methods = resp.Methods
+	return nil
+}
+
+// stop stops the program. The caller must hold the lock.
+func (s *Storage) stop() {
+	if s.cmd == nil {
+		return
+	}
+	s.stdin.Close()
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	s.cmd = nil
+}
+
+// roundTrip sends a request and reads the response. Programs not answering
+// within the timeout are killed, leaving them to be started again. The
+// caller must hold the lock.
+func (s *Storage) roundTrip(req request) (response, error) {
+	line, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.exchange(line)
+	}()
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return response{}, err
+		}
+	case <-timer.C:
+		// Closing the pipes unblocks the exchange even if children of
+		// the program keep them open
+		s.cmd.Process.Kill()
+		s.stdin.Close()
+		s.pipe.Close()
+		<-done
+		return response{}, fmt.Errorf("no response within %v: %w", s.timeout, os.ErrDeadlineExceeded)
+	}
+
+	var resp response
+	if err := json.Unmarshal(s.stdout.Bytes(), &resp); err != nil {
+		return response{}, fmt.Errorf("invalid plugin response: %w", err)
+	}
+	return resp, nil
+}
+
+// exchange writes a request line and reads the response line
+func (s *Storage) exchange(line []byte) error {
+	if _, err := s.stdin.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to write to plugin: %w", err)
+	}
+	if !s.stdout.Scan() {
+		err := s.stdout.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("unable to read from plugin: %w", err)
+	}
+	return nil
+}
+
+// call sends a request to the program, starting it again if it stopped
+func (s *Storage) call(req request) (response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cmd == nil {
+		if err := s.start(); err != nil {
+			return response{}, err
+		}
+	}
+	if !slices.Contains(s.methods, req.Method) {
+		return response{}, fmt.Errorf("plugin %s: %w", req.Method, storage.ErrNotSupported)
+	}
+	resp, err := s.roundTrip(req)
+	if err != nil {
+		// The program is in an unknown state, so it's started again
+		s.stop()
+		return response{}, fmt.Errorf("plugin %s: %w", req.Method, err)
+	}
+	if resp.Error != nil {
+		return response{}, fmt.Errorf("plugin %s %s: %s: %w", req.Method, req.Path, resp.Error.Message, codeError(resp.Error.Code))
+	}
+	return resp, nil
+}
+
+// codeError returns the error of an error code of a response
+func codeError(code string) error {
+	switch code {
+	case "not_found":
+		return fs.ErrNotExist
+	case "permission_denied":
+		return fs.ErrPermission
+	case "invalid":
+		return fs.ErrInvalid
+	case "not_supported":
+		return storage.ErrNotSupported
+	case "snapshot_not_found":
+		return storage.ErrSnapshotNotFound
+	default:
+		return fmt.Errorf("plugin error %s", code)
+	}
+}
+
+// pathRequest returns a request of a method for a storage path
+func pathRequest(method string, vfPath url.URL) request {
+	return request{
+		Method:   method,
+		Path:     strings.Trim(path.Clean("/"+vfPath.Path), "/"),
+		Snapshot: vfPath.Query().Get("snapshot"),
+	}
+}
+
+// Close implements io.Closer, stopping the program
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+	return nil
+}
+
+// CheckHealth implements storage.HealthChecker
+func (s *Storage) CheckHealth() error {
+	_, err := s.call(request{Method: "health"})
+	if errors.Is(err, storage.ErrNotSupported) {
+		// The program answered hello, so it's running
+		return nil
+	}
+	return err
+}
+
+// toFileNode converts a node of a response in a directory
+func (s *Storage) toFileNode(dir string, n node) storage.FileNode {
+	fileNode := storage.FileNode{
+		Path:         url.URL{Scheme: s.name, Path: strings.TrimPrefix(path.Join(dir, n.Name), "/")},
+		Type:         n.Type,
+		Basename:     n.Name,
+		LastModified: n.Modified,
+	}
+	switch n.Type {
+	case "dir":
+		fileNode.Mode = fs.ModeDir | 0555
+	case "file":
+		fileNode.Mode = 0444
+		fileNode.Size = n.Size
+		fileNode.Extension = strings.TrimPrefix(path.Ext(n.Name), ".")
+		fileNode.MimeType = n.MimeType
+	default:
+		fileNode.Type = "special"
+	}
+	return fileNode
+}
+
+// ListContents implements storage.Lister
+func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
+	req := pathRequest("list", vfPath)
+	resp, err := s.call(req)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]storage.FileNode, 0, len(resp.Nodes))
+	for _, n := range resp.Nodes {
+		if n.Name == "" || strings.Contains(n.Name, "/") || n.Name == "." || n.Name == ".." {
+			continue
+		}
+		nodes = append(nodes, s.toFileNode(req.Path, n))
+	}
+	return nodes, nil
+}
+
+// stat returns the node of a path
+func (s *Storage) stat(vfPath url.URL) (node, error) {
+	resp, err := s.call(pathRequest("stat", vfPath))
+	if err != nil {
+		return node{}, err
+	}
+	if resp.Node == nil {
+		return node{}, fmt.Errorf("plugin stat %s: missing node", vfPath.Path)
+	}
+	return *resp.Node, nil
+}
+
+// NodeType implements storage.NodeTyper
+func (s *Storage) NodeType(vfPath url.URL) (string, error) {
+	n, err := s.stat(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return s.toFileNode("", n).Type, nil
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(vfPath url.URL) (int64, error) {
+	n, err := s.stat(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return n.Size, nil
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(vfPath url.URL) (string, error) {
+	n, err := s.stat(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return n.MimeType, nil
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
+	n, err := s.stat(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return n.Modified, nil
+}
+
+// ReadStream implements storage.Reader
+// Content is read in chunks as the stream is read
+func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
+	n, err := s.stat(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	if n.Type == "dir" {
+		return nil, &fs.PathError{Op: "read", Path: vfPath.Path, Err: fs.ErrInvalid}
+	}
+	if n.Type != "file" {
+		return nil, storage.ErrSpecialFile
+	}
+	return &chunkReader{storage: s, req: pathRequest("read", vfPath)}, nil
+}
+
+// ListSnapshots implements storage.SnapshotLister
+func (s *Storage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
+	resp, err := s.call(pathRequest("snapshots", vfPath))
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]storage.Snapshot, 0, len(resp.Snapshots))
+	for _, snap := range resp.Snapshots {
+		snapshots = append(snapshots, storage.Snapshot{
+			ID:        snap.ID,
+			Type:      snap.Type,
+			Name:      snap.Name,
+			Timestamp: snap.Timestamp,
+			Size:      snap.Size,
+		})
+	}
+	return snapshots, nil
+}
+
+// chunkReader reads a file from the program in chunks
+type chunkReader struct {
+	storage *Storage
+	req     request
+	buf     []byte
+	eof     bool
+}
+
+// Read implements io.Reader
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		r.req.Length = readChunkSize
+		resp, err := r.storage.call(r.req)
+		if err != nil {
+			return 0, err
+		}
+		r.buf = resp.Data
+		r.req.Offset += int64(len(resp.Data))
+		r.eof = len(resp.Data) < readChunkSize
+		if len(r.buf) == 0 {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close implements io.Closer
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+// logWriter logs the lines written to it
+type logWriter struct {
+	prefix string
+	buf    bytes.Buffer
+}
+
+// Write implements io.Writer
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			w.buf.WriteString(line)
+			return len(p), nil
+		}
+		log.Print(w.prefix + strings.TrimSuffix(line, "\n"))
+	}
+}
@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// files are the files of the test plugin
+var files = map[string]string{
+	"docs/a.txt": "hello",
+	"docs/big":   strings.Repeat("x", readChunkSize+10),
+}
+
+// TestMain runs the test binary as the test plugin if asked to
+func TestMain(m *testing.M) {
+	if os.Getenv("TIMESHIP_TEST_PLUGIN") == "1" {
+		servePlugin()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// servePlugin answers requests for the files
+func servePlugin() {
+	scanner := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	notFound := map[string]any{"error": map[string]string{"code": "not_found", "message": "no such file"}}
+	for scanner.Scan() {
+		var req request
+		json.Unmarshal(scanner.Bytes(), &req)
+		switch req.Method {
+		case "hello":
+			if req.Options["crash"] == "hello" {
+				return
+			}
+			enc.Encode(map[string]any{"methods": []string{"list", "stat", "read"}})
+		case "list":
+			if req.Path != "docs" {
+				enc.Encode(notFound)
+				continue
+			}
+			enc.Encode(map[string]any{"nodes": []node{{Name: "a.txt", Type: "file", Size: 5}, {Name: "big", Type: "file"}}})
+		case "stat":
+			if req.Path == "crash" {
+				return
+			}
+			if req.Path == "hang" {
+				time.Sleep(time.Hour)
+			}
+			if req.Path == "docs" {
+				enc.Encode(map[string]any{"node": node{Name: "docs", Type: "dir"}})
+				continue
+			}
+			content, ok := files[req.Path]
+			if !ok {
+				enc.Encode(notFound)
+				continue
+			}
+			enc.Encode(map[string]any{"node": node{Name: req.Path, Type: "file", Size: int64(len(content)), Modified: 1760000000}})
+		case "read":
+			content := files[req.Path]
+			end := min(req.Offset+req.Length, int64(len(content)))
+			enc.Encode(map[string]any{"data": []byte(content[req.Offset:end])})
+		}
+	}
+}
+
+// newTestStorage starts the test binary as a plugin
+func newTestStorage(t *testing.T, options map[string]string) (*Storage, error) {
+	t.Setenv("TIMESHIP_TEST_PLUGIN", "1")
+	return New(Config{Name: "ext", Command: []string{os.Args[0]}, Options: options})
+}
+
+func TestPlugin(t *testing.T) {
+	s, err := newTestStorage(t, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer s.Close()
+
+	nodes, err := s.ListContents(url.URL{Scheme: "ext", Path: "/docs"})
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %+v: %v", nodes, err)
+	}
+	if nodes[0].Path.Path != "docs/a.txt" || nodes[0].Extension != "txt" || nodes[0].Size != 5 {
+		t.Errorf("unexpected node %+v", nodes[0])
+	}
+
+	if typ, err := s.NodeType(url.URL{Scheme: "ext", Path: "docs"}); err != nil || typ != "dir" {
+		t.Errorf("expected docs to be a dir, got %q: %v", typ, err)
+	}
+	if _, err := s.ListContents(url.URL{Scheme: "ext", Path: "missing"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected missing directory not to exist, got %v", err)
+	}
+	if _, err := s.ListSnapshots(url.URL{Scheme: "ext", Path: "docs"}); !errors.Is(err, storage.ErrNotSupported) {
+		t.Errorf("expected snapshots not to be supported, got %v", err)
+	}
+
+	for name, want := range files {
+		stream, err := s.ReadStream(url.URL{Scheme: "ext", Path: name})
+		if err != nil {
+			t.Fatalf("ReadStream failed: %v", err)
+		}
+		content, err := io.ReadAll(stream)
+		stream.Close()
+		if err != nil || string(content) != want {
+			t.Errorf("expected %d bytes of %s, got %d: %v", len(want), name, len(content), err)
+		}
+	}
+
+	// A crashed program is started again
+	if _, err := s.FileSize(url.URL{Scheme: "ext", Path: "crash"}); err == nil {
+		t.Error("expected crashing request to fail")
+	}
+	if size, err := s.FileSize(url.URL{Scheme: "ext", Path: "docs/a.txt"}); err != nil || size != 5 {
+		t.Errorf("expected size 5 after restart, got %d: %v", size, err)
+	}
+}
+
+func TestPluginTimeout(t *testing.T) {
+	t.Setenv("TIMESHIP_TEST_PLUGIN", "1")
+	s, err := New(Config{Name: "ext", Command: []string{os.Args[0]}, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer s.Close()
+
+	start := time.Now()
+	if _, err := s.FileSize(url.URL{Scheme: "ext", Path: "hang"}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected hanging request to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the request to fail after the timeout, took %v", elapsed)
+	}
+	if size, err := s.FileSize(url.URL{Scheme: "ext", Path: "docs/a.txt"}); err != nil || size != 5 {
+		t.Errorf("expected size 5 after restart, got %d: %v", size, err)
+	}
+}
+
+func TestPluginHelloFails(t *testing.T) {
+	if _, err := newTestStorage(t, map[string]string{"crash": "hello"}); err == nil {
+		t.Error("expected a plugin failing hello to fail")
+	}
+	if _, err := New(Config{Command: []string{"/nonexistent/timeship-plugin"}}); err == nil {
+		t.Error("expected a missing program to fail")
+	}
+}
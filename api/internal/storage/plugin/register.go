@@ -0,0 +1,18 @@
+package plugin
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("plugin", func(sc config.StorageConfig) (storage.Storage, error) {
+		return New(Config{
+			Name:    sc.Name,
+			Command: sc.Command,
+			Options: sc.Options,
+			Timeout: sc.Timeout,
+		})
+	})
+}
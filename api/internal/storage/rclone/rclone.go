@@ -0,0 +1,339 @@
+// Package rclone provides read-only storages for rclone remotes.
+//
+// Instead of implementing every cloud backend, any remote configured in
+// rclone can be browsed by running the rclone command line tool: "lsjson" to
+// list and stat nodes and "cat" to stream file contents. Remotes have no
+// snapshots.
+package rclone
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// defaultStorageName is the storage name used when none is configured
+const defaultStorageName = "rclone"
+
+// rclone exit codes, see https://rclone.org/docs/#exit-code
+const (
+	exitDirNotFound  = 3
+	exitFileNotFound = 4
+)
+
+// Config holds configuration for the rclone storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths, defaults to "rclone"
+	Name string
+
+	// Remote is the rclone remote and optional root path, e.g. "gdrive:" or
+	// "s3:bucket/backups"
+	Remote string
+
+	// Binary is the rclone executable, defaults to "rclone" on the PATH
+	Binary string
+
+	// ConfigFile is the rclone config file, defaults to the rclone default
+	ConfigFile string
+}
+
+// Storage implements read-only storage interfaces for an rclone remote
+type Storage struct {
+	name   string
+	remote string
+
+	// run runs rclone and returns its output, replaceable for testing
+	run func(args ...string) ([]byte, error)
+
+	// stream runs rclone and streams its output, replaceable for testing
+	stream func(args ...string) (io.ReadCloser, error)
+}
+
+// New creates a new rclone storage
+func New(config Config) (*Storage, error) {
+	if config.Remote == "" {
+		return nil, errors.New("remote is required")
+	}
+	if !strings.Contains(config.Remote, ":") {
+		return nil, fmt.Errorf("invalid remote %q: expected the form name:[path]", config.Remote)
+	}
+
+	name := config.Name
+	if name == "" {
+		name = defaultStorageName
+	}
+
+	binary := config.Binary
+	if binary == "" {
+		binary = "rclone"
+	}
+	var global []string
+	if config.ConfigFile != "" {
+		global = append(global, "--config", config.ConfigFile)
+	}
+
+	return &Storage{
+		name:   name,
+		remote: config.Remote,
+		run: func(args ...string) ([]byte, error) {
+			return runRclone(binary, slices.Concat(global, args)...)
+		},
+		stream: func(args ...string) (io.ReadCloser, error) {
+			return streamRclone(binary, slices.Concat(global, args)...)
+		},
+	}, nil
+}
+
+// commandError converts an rclone failure to an error, mapping not found
+// exit codes to fs.ErrNotExist. Errors include the standard error output.
+func commandError(op string, err error, stderr string) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case exitDirNotFound, exitFileNotFound:
+			err = fs.ErrNotExist
+		}
+	}
+	msg := strings.TrimSpace(stderr)
+	if msg == "" || errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("rclone %s: %w", op, err)
+	}
+	return fmt.Errorf("rclone %s: %s: %w", op, msg, err)
+}
+
+// runRclone runs the rclone command line tool and returns its standard output
+func runRclone(binary string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, commandError(command(args), err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// streamRclone starts the rclone command line tool and returns its standard
+// output. Reading fails if the command does, closing stops it.
+func streamRclone(binary string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.Command(binary, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, commandError(command(args), err, "")
+	}
+	return &commandReader{cmd: cmd, stdout: stdout, stderr: stderr, op: command(args)}, nil
+}
+
+// command returns the rclone subcommand of the arguments, skipping flags
+func command(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--config" {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			return args[i]
+		}
+	}
+	return ""
+}
+
+// commandReader reads the output of a running command
+type commandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *bytes.Buffer
+	op     string
+	done   bool
+}
+
+// Read implements io.Reader, reporting the command exit status at the end
+func (r *commandReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF && !r.done {
+		r.done = true
+		if waitErr := r.cmd.Wait(); waitErr != nil {
+			return n, commandError(r.op, waitErr, r.stderr.String())
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer, stopping the command if still running
+func (r *commandReader) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	r.stdout.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
+
+// remotePath returns the rclone path of a storage path
+func (s *Storage) remotePath(vfPath url.URL) (string, error) {
+	if vfPath.Query().Get("snapshot") != "" {
+		return "", fmt.Errorf("rclone remotes have no snapshots: %w", storage.ErrNotSupported)
+	}
+	rel := path.Clean("/" + vfPath.Path)
+	rel = strings.TrimPrefix(rel, "/")
+	if rel == "" {
+		return s.remote, nil
+	}
+	if strings.HasSuffix(s.remote, ":") || strings.HasSuffix(s.remote, "/") {
+		return s.remote + rel, nil
+	}
+	return s.remote + "/" + rel, nil
+}
+
+// item is an entry of the rclone lsjson output
+type item struct {
+	Path     string    `json:"Path"`
+	Name     string    `json:"Name"`
+	Size     int64     `json:"Size"`
+	MimeType string    `json:"MimeType"`
+	ModTime  time.Time `json:"ModTime"`
+	IsDir    bool      `json:"IsDir"`
+}
+
+// stat returns the lsjson item of a path
+func (s *Storage) stat(vfPath url.URL) (item, error) {
+	remotePath, err := s.remotePath(vfPath)
+	if err != nil {
+		return item{}, err
+	}
+	out, err := s.run("lsjson", "--stat", remotePath)
+	if err != nil {
+		return item{}, err
+	}
+	var it item
+	if err := json.Unmarshal(out, &it); err != nil {
+		return item{}, fmt.Errorf("invalid rclone lsjson output: %w", err)
+	}
+	return it, nil
+}
+
+// CheckHealth implements storage.HealthChecker
+// Stats the root of the remote
+func (s *Storage) CheckHealth() error {
+	_, err := s.run("lsjson", "--stat", s.remote)
+	return err
+}
+
+// ListContents implements storage.Lister
+func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
+	remotePath, err := s.remotePath(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.run("lsjson", remotePath)
+	if err != nil {
+		return nil, err
+	}
+	var items []item
+	if err := json.Unmarshal(out, &items); err != nil {
+		return nil, fmt.Errorf("invalid rclone lsjson output: %w", err)
+	}
+
+	dir := strings.Trim(vfPath.Path, "/")
+	nodes := make([]storage.FileNode, 0, len(items))
+	for _, it := range items {
+		node := storage.FileNode{
+			Path:         url.URL{Scheme: s.name, Path: strings.TrimPrefix(path.Join(dir, it.Name), "/")},
+			Basename:     it.Name,
+			LastModified: it.ModTime.Unix(),
+		}
+		if it.IsDir {
+			node.Type = "dir"
+			node.Mode = fs.ModeDir | 0555
+		} else {
+			node.Type = "file"
+			node.Mode = 0444
+			node.Size = it.Size
+			node.Extension = strings.TrimPrefix(path.Ext(it.Name), ".")
+			node.MimeType = it.MimeType
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
+	remotePath, err := s.remotePath(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.stream("cat", remotePath)
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(vfPath url.URL) (int64, error) {
+	it, err := s.stat(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return it.Size, nil
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(vfPath url.URL) (string, error) {
+	it, err := s.stat(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return it.MimeType, nil
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
+	it, err := s.stat(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return it.ModTime.Unix(), nil
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(vfPath url.URL) (bool, error) {
+	it, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !it.IsDir, nil
+}
+
+// DirectoryExists implements storage.Existence
+func (s *Storage) DirectoryExists(vfPath url.URL) (bool, error) {
+	if strings.Trim(vfPath.Path, "/") == "" {
+		return true, nil
+	}
+	it, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return it.IsDir, nil
+}
@@ -0,0 +1,223 @@
+package rclone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"timeship/internal/storage"
+)
+
+// fakeRclone answers lsjson and cat for a remote with a few nodes
+type fakeRclone struct{}
+
+var fakeItems = map[string]string{
+	"remote:backups":                   `[{"Path":"docs","Name":"docs","Size":-1,"ModTime":"2025-11-09T09:00:00Z","IsDir":true},{"Path":"readme.txt","Name":"readme.txt","Size":7,"MimeType":"text/plain","ModTime":"2025-11-09T09:00:00Z","IsDir":false}]`,
+	"remote:backups/docs":              `[]`,
+	"--stat remote:backups/docs":       `{"Path":"docs","Name":"docs","Size":-1,"ModTime":"2025-11-09T09:00:00Z","IsDir":true}`,
+	"--stat remote:backups/readme.txt": `{"Path":"readme.txt","Name":"readme.txt","Size":7,"MimeType":"text/plain","ModTime":"2025-11-09T09:00:00Z","IsDir":false}`,
+}
+
+func (f *fakeRclone) run(args ...string) ([]byte, error) {
+	if args[0] != "lsjson" {
+		return nil, fmt.Errorf("unexpected command %v", args)
+	}
+	out, ok := fakeItems[strings.Join(args[1:], " ")]
+	if !ok {
+		return nil, fmt.Errorf("rclone lsjson: %w", fs.ErrNotExist)
+	}
+	return []byte(out), nil
+}
+
+func (f *fakeRclone) stream(args ...string) (io.ReadCloser, error) {
+	if strings.Join(args, " ") != "cat remote:backups/readme.txt" {
+		return nil, fmt.Errorf("rclone cat: %w", fs.ErrNotExist)
+	}
+	return io.NopCloser(strings.NewReader("current")), nil
+}
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := New(Config{Remote: "remote:backups"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := fakeRclone{}
+	s.run = fake.run
+	s.stream = fake.stream
+	return s
+}
+
+func remotePath(p string, snapshot string) url.URL {
+	u := url.URL{Scheme: "rclone", Path: p}
+	if snapshot != "" {
+		u.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	return u
+}
+
+func TestRemotePath(t *testing.T) {
+	tests := []struct {
+		remote   string
+		path     string
+		expected string
+	}{
+		{"remote:", "", "remote:"},
+		{"remote:", "a/b.txt", "remote:a/b.txt"},
+		{"remote:backups", "/a/../b.txt", "remote:backups/b.txt"},
+		{"remote:backups/", "a", "remote:backups/a"},
+		{"remote:backups", "../../etc", "remote:backups/etc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remote+tt.path, func(t *testing.T) {
+			s, err := New(Config{Remote: tt.remote})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.remotePath(remotePath(tt.path, ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := New(Config{Remote: "no-colon"}); err == nil {
+		t.Error("expected error for a remote without a colon")
+	}
+}
+
+func TestListContents(t *testing.T) {
+	s := newTestStorage(t)
+
+	nodes, err := s.ListContents(remotePath("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %d", len(nodes))
+	}
+	if nodes[0].Type != "dir" || nodes[0].Path.Path != "docs" || nodes[0].Size != 0 {
+		t.Errorf("unexpected directory %+v", nodes[0])
+	}
+	if nodes[1].Type != "file" || nodes[1].Size != 7 || nodes[1].Extension != "txt" || nodes[1].LastModified != 1762678800 {
+		t.Errorf("unexpected file %+v", nodes[1])
+	}
+
+	if _, err := s.ListContents(remotePath("missing", "")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+	if _, err := s.ListContents(remotePath("", "zfs:x")); !errors.Is(err, storage.ErrNotSupported) {
+		t.Errorf("expected not supported for snapshots, got %v", err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	s := newTestStorage(t)
+
+	r, err := s.ReadStream(remotePath("readme.txt", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "current" {
+		t.Errorf("expected current, got %q", data)
+	}
+
+	if size, err := s.FileSize(remotePath("readme.txt", "")); size != 7 || err != nil {
+		t.Errorf("expected size 7, got %d, %v", size, err)
+	}
+	if mime, _ := s.MimeType(remotePath("readme.txt", "")); mime != "text/plain" {
+		t.Errorf("expected text/plain, got %q", mime)
+	}
+
+	tests := []struct {
+		path string
+		file bool
+		dir  bool
+	}{
+		{"", false, true},
+		{"docs", false, true},
+		{"readme.txt", true, false},
+		{"missing", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if ok, err := s.FileExists(remotePath(tt.path, "")); ok != tt.file || err != nil {
+				t.Errorf("FileExists: expected %v, got %v, %v", tt.file, ok, err)
+			}
+			if ok, err := s.DirectoryExists(remotePath(tt.path, "")); ok != tt.dir || err != nil {
+				t.Errorf("DirectoryExists: expected %v, got %v, %v", tt.dir, ok, err)
+			}
+		})
+	}
+}
+
+// TestHelperProcess stands in for rclone in TestCommand
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("TIMESHIP_RCLONE_HELPER") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	switch strings.Join(args[1:], " ") {
+	case "cat remote:ok":
+		fmt.Print("content")
+		os.Exit(0)
+	case "cat remote:missing":
+		fmt.Fprint(os.Stderr, "object not found")
+		os.Exit(exitFileNotFound)
+	default:
+		fmt.Fprint(os.Stderr, "failed")
+		os.Exit(1)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	t.Setenv("TIMESHIP_RCLONE_HELPER", "1")
+	helper := func(args ...string) []string {
+		return append([]string{"-test.run=TestHelperProcess", "--"}, args...)
+	}
+
+	out, err := runRclone(os.Args[0], helper("cat", "remote:ok")...)
+	if err != nil || string(out) != "content" {
+		t.Errorf("expected content, got %q, %v", out, err)
+	}
+	if _, err := runRclone(os.Args[0], helper("cat", "remote:missing")...); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+	if _, err := runRclone(os.Args[0], helper("lsjson", "remote:x")...); err == nil || !strings.Contains(err.Error(), "rclone lsjson: failed") {
+		t.Errorf("expected error with stderr, got %v", err)
+	}
+
+	r, err := streamRclone(os.Args[0], helper("cat", "remote:ok")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "content" {
+		t.Errorf("expected streamed content, got %q, %v", data, err)
+	}
+
+	// Failures are reported when the output ends
+	r, err = streamRclone(os.Args[0], helper("cat", "remote:missing")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(r)
+	r.Close()
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist while streaming, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package rclone
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("rclone", func(sc config.StorageConfig) (storage.Storage, error) {
+		return New(Config{
+			Name:       sc.Name,
+			Remote:     sc.Remote,
+			ConfigFile: sc.RcloneConfig,
+		})
+	})
+}
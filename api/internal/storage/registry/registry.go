@@ -0,0 +1,69 @@
+// Package registry creates storages by their configured type.
+//
+// Storage implementations register a factory for their type when their
+// package is imported, usually in an init function:
+//
+//	func init() {
+//		registry.Register("sftp", func(sc config.StorageConfig) (storage.Storage, error) {
+//			return New(Config{Name: sc.Name, Host: sc.Options["host"]})
+//		})
+//	}
+//
+// The server imports the built-in storages, so adding a storage type only
+// takes importing its package. Settings the configuration has no fields for
+// are passed in StorageConfig.Options.
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"timeship/internal/config"
+	"timeship/internal/storage"
+)
+
+// Factory creates a storage from its configuration
+type Factory func(sc config.StorageConfig) (storage.Storage, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a storage type available to Open. It panics if the type is
+// registered twice or the factory is nil, like database/sql.Register.
+func Register(typ string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if factory == nil {
+		panic("registry: nil factory for storage type " + typ)
+	}
+	if _, ok := factories[typ]; ok {
+		panic("registry: storage type registered twice: " + typ)
+	}
+	factories[typ] = factory
+}
+
+// Open creates a storage of the configured type
+func Open(sc config.StorageConfig) (storage.Storage, error) {
+	mu.RLock()
+	factory, ok := factories[sc.Type]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage type %q", sc.Type)
+	}
+	return factory(sc)
+}
+
+// Types returns the registered storage types, sorted alphabetically
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
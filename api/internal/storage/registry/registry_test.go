@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+
+	"timeship/internal/config"
+	"timeship/internal/storage"
+)
+
+// fakeStorage is a storage of a type registered by the test
+type fakeStorage struct {
+	root string
+}
+
+func (f *fakeStorage) ListContents(path url.URL) ([]storage.FileNode, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register("fake", func(sc config.StorageConfig) (storage.Storage, error) {
+		return &fakeStorage{root: sc.Options["root"]}, nil
+	})
+
+	store, err := Open(config.StorageConfig{Name: "a", Type: "fake", Options: map[string]string{"root": "/srv"}})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if fake, ok := store.(*fakeStorage); !ok || fake.root != "/srv" {
+		t.Errorf("expected fake storage with options, got %#v", store)
+	}
+
+	if _, err := Open(config.StorageConfig{Name: "b", Type: "ftp"}); err == nil {
+		t.Error("expected unregistered type to fail")
+	}
+	if !slices.Contains(Types(), "fake") {
+		t.Errorf("expected fake in types, got %v", Types())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a type twice to panic")
+		}
+	}()
+	Register("fake", func(sc config.StorageConfig) (storage.Storage, error) { return nil, nil })
+}
@@ -0,0 +1,290 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// Autoindex
+//
+// Directory indexes are HTML pages generated by web servers, listing the
+// entries of a directory as links, usually one per line followed by the
+// modification time and size:
+//
+//	<a href="docs/">docs/</a>             09-Nov-2025 09:00       -
+//	<a href="readme.txt">readme.txt</a>   09-Nov-2025 09:00       7
+//
+// Links to other directories, parents, sorting options or other hosts are
+// ignored. Times and sizes are parsed on a best effort basis in the formats
+// of nginx, Apache and lighttpd. Times are assumed to be UTC, as indexes
+// don't include the time zone. Sizes abbreviated by Apache, like "1.2K", are
+// approximate. nginx indexes in JSON format (autoindex_format json) are
+// supported too, and have exact sizes.
+
+// maxIndexSize limits the size of index pages that are parsed
+const maxIndexSize = 16 << 20
+
+// hrefRegex matches the target of the first link in a line
+var hrefRegex = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*["']([^"']*)["'][^>]*>`)
+
+// tagRegex matches HTML tags
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// indexTime is a modification time format of directory indexes
+type indexTime struct {
+	regex  *regexp.Regexp
+	layout string
+}
+
+// indexTimes are the modification time formats of nginx, Apache and lighttpd
+var indexTimes = []indexTime{
+	{regexp.MustCompile(`\d{2}-[A-Z][a-z]{2}-\d{4} \d{2}:\d{2}(:\d{2})?`), "02-Jan-2006 15:04"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}(:\d{2})?`), "2006-01-02 15:04"},
+	{regexp.MustCompile(`\d{4}-[A-Z][a-z]{2}-\d{2} \d{2}:\d{2}(:\d{2})?`), "2006-Jan-02 15:04"},
+}
+
+// sizeRegex matches a size following the modification time, "-" for directories
+var sizeRegex = regexp.MustCompile(`^\s*(-|\d+(?:\.\d+)?)\s*([KMGTP]i?B?)?(?:\s|$)`)
+
+// indexEntry is an entry of a directory index
+type indexEntry struct {
+	name     string
+	isDir    bool
+	size     int64
+	modified int64
+}
+
+// parseHTMLIndex parses the entries of an HTML directory index
+func parseHTMLIndex(page string) []indexEntry {
+	entries := []indexEntry{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(page, "\n") {
+		loc := hrefRegex.FindStringSubmatchIndex(line)
+		if loc == nil {
+			continue
+		}
+		name, isDir, ok := parseHref(html.UnescapeString(line[loc[2]:loc[3]]))
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		entry := indexEntry{name: name, isDir: isDir}
+		rest := html.UnescapeString(tagRegex.ReplaceAllString(line[loc[1]:], " "))
+		for _, format := range indexTimes {
+			m := format.regex.FindStringIndex(rest)
+			if m == nil {
+				continue
+			}
+			value := rest[m[0]:m[1]]
+			layout := format.layout
+			if len(value) > len(layout) {
+				layout += ":05"
+			}
+			if t, err := time.Parse(layout, value); err == nil {
+				entry.modified = t.Unix()
+			}
+			if !isDir {
+				entry.size = parseSize(rest[m[1]:])
+			}
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// parseHref returns the entry name of a link target, if it is an entry of
+// the directory itself
+func parseHref(href string) (name string, isDir bool, ok bool) {
+	if href == "" || strings.ContainsAny(href[:1], "?#/") || strings.Contains(href, "://") {
+		return "", false, false
+	}
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+	href = strings.TrimPrefix(href, "./")
+	isDir = strings.HasSuffix(href, "/")
+	href = strings.TrimSuffix(href, "/")
+
+	name, err := url.PathUnescape(href)
+	if err != nil || name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return "", false, false
+	}
+	return name, isDir, true
+}
+
+// parseSize parses a size like "1234" or "1.2K", returning 0 if unknown
+func parseSize(value string) int64 {
+	m := sizeRegex.FindStringSubmatch(value)
+	if m == nil || m[1] == "-" {
+		return 0
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	if m[2] != "" {
+		n *= float64(int64(1) << (10 * (strings.Index("KMGTP", m[2][:1]) + 1)))
+	}
+	return int64(n)
+}
+
+// jsonIndexEntry is an entry of an nginx JSON directory index
+type jsonIndexEntry struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	MTime string `json:"mtime"`
+	Size  int64  `json:"size"`
+}
+
+// parseJSONIndex parses the entries of an nginx JSON directory index
+func parseJSONIndex(data []byte) ([]indexEntry, error) {
+	var items []jsonIndexEntry
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON index: %w", err)
+	}
+	entries := make([]indexEntry, 0, len(items))
+	for _, item := range items {
+		if item.Name == "" || strings.Contains(item.Name, "/") {
+			continue
+		}
+		entry := indexEntry{name: item.Name, isDir: item.Type == "directory"}
+		if !entry.isDir {
+			entry.size = item.Size
+		}
+		if t, err := http.ParseTime(item.MTime); err == nil {
+			entry.modified = t.Unix()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// isIndex reports whether a response is a directory index
+func isIndex(resp *http.Response) (isJSON bool, ok bool) {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		return false, true
+	case "application/json":
+		return true, true
+	}
+	return false, false
+}
+
+// autoindexURL returns the URL of a path, directories end with a slash
+func (s *Storage) autoindexURL(vfPath url.URL, dir bool) *url.URL {
+	rel := relPath(vfPath)
+	u := s.resolve(strings.Split(rel, "/")...)
+	if dir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u
+}
+
+// listAutoindex lists a directory of a directory index
+func (s *Storage) listAutoindex(vfPath url.URL) ([]storage.FileNode, error) {
+	if vfPath.Query().Get("snapshot") != "" {
+		return nil, fmt.Errorf("directory indexes have no snapshots: %w", storage.ErrNotSupported)
+	}
+
+	resp, err := s.get(http.MethodGet, s.autoindexURL(vfPath, true), "text/html, application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Files may be served regardless of the trailing slash, don't download them
+	isJSON, ok := isIndex(resp)
+	if !ok {
+		return nil, &fs.PathError{Op: "list", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []indexEntry
+	if isJSON {
+		entries, err = parseJSONIndex(data)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		entries = parseHTMLIndex(string(data))
+	}
+
+	dir := relPath(vfPath)
+	nodes := make([]storage.FileNode, 0, len(entries))
+	for _, entry := range entries {
+		node := storage.FileNode{
+			Path:         url.URL{Scheme: s.name, Path: strings.TrimPrefix(path.Join(dir, entry.name), "/")},
+			Basename:     entry.name,
+			LastModified: entry.modified,
+		}
+		if entry.isDir {
+			node.Type = "dir"
+			node.Mode = fs.ModeDir | 0555
+		} else {
+			node.Type = "file"
+			node.Mode = 0444
+			node.Size = entry.size
+			node.Extension = strings.TrimPrefix(path.Ext(entry.name), ".")
+			node.MimeType = mime.TypeByExtension(path.Ext(entry.name))
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// getAutoindexFile requests a file of a directory index
+func (s *Storage) getAutoindexFile(method string, vfPath url.URL) (*http.Response, error) {
+	if vfPath.Query().Get("snapshot") != "" {
+		return nil, fmt.Errorf("directory indexes have no snapshots: %w", storage.ErrNotSupported)
+	}
+	if relPath(vfPath) == "" {
+		return nil, &fs.PathError{Op: strings.ToLower(method), Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+	return s.get(method, s.autoindexURL(vfPath, false), "")
+}
+
+// statAutoindex returns the metadata of a node of a directory index.
+// Web servers redirect directories without a trailing slash to the
+// directory, which is how they are told apart from files.
+func (s *Storage) statAutoindex(vfPath url.URL) (fileInfo, error) {
+	if relPath(vfPath) == "" {
+		return fileInfo{isDir: true}, nil
+	}
+	resp, err := s.getAutoindexFile(http.MethodHead, vfPath)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	resp.Body.Close()
+
+	info := fileInfo{
+		size:     resp.ContentLength,
+		mimeType: resp.Header.Get("Content-Type"),
+		isDir:    strings.HasSuffix(resp.Request.URL.Path, "/"),
+	}
+	if info.size < 0 {
+		info.size = 0
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.lastModified = t.Unix()
+	}
+	return info, nil
+}
@@ -0,0 +1,224 @@
+package remote
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHTMLIndex(t *testing.T) {
+	nov9 := time.Date(2025, 11, 9, 9, 0, 0, 0, time.UTC).Unix()
+
+	tests := []struct {
+		name     string
+		page     string
+		expected []indexEntry
+	}{
+		{
+			name: "nginx",
+			page: `<html><head><title>Index of /pub/</title></head><body>
+<h1>Index of /pub/</h1><hr><pre><a href="../">../</a>
+<a href="docs/">docs/</a>                                              09-Nov-2025 09:00                   -
+<a href="read%20me.txt">read me.txt</a>                                     09-Nov-2025 09:00                   7
+<a href="a&amp;b.txt">a&amp;b.txt</a>                                     09-Nov-2025 09:00                1234
+</pre><hr></body></html>`,
+			expected: []indexEntry{
+				{name: "docs", isDir: true, modified: nov9},
+				{name: "read me.txt", size: 7, modified: nov9},
+				{name: "a&b.txt", size: 1234, modified: nov9},
+			},
+		},
+		{
+			name: "apache",
+			page: `<table>
+<tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th></tr>
+<tr><td valign="top"><img src="/icons/back.gif" alt="[PARENTDIR]"></td><td><a href="/pub/">Parent Directory</a></td><td>&nbsp;</td><td align="right">  - </td></tr>
+<tr><td valign="top"><img src="/icons/folder.gif" alt="[DIR]"></td><td><a href="docs/">docs/</a></td><td align="right">2025-11-09 09:00  </td><td align="right">  - </td></tr>
+<tr><td valign="top"><img src="/icons/text.gif" alt="[TXT]"></td><td><a href="big.iso">big.iso</a></td><td align="right">2025-11-09 09:00  </td><td align="right">1.5K</td></tr>
+<tr><td><a href="https://example.com/">elsewhere</a></td></tr>
+</table>`,
+			expected: []indexEntry{
+				{name: "docs", isDir: true, modified: nov9},
+				{name: "big.iso", size: 1536, modified: nov9},
+			},
+		},
+		{
+			name: "lighttpd",
+			page: `<tr class="d"><td class="n"><a href="docs/">docs</a>/</td><td class="m">2025-Nov-09 09:00:00</td><td class="s">- &nbsp;</td></tr>
+<tr><td class="n"><a href="./readme.txt">readme.txt</a></td><td class="m">2025-Nov-09 09:00:30</td><td class="s">7 </td></tr>`,
+			expected: []indexEntry{
+				{name: "docs", isDir: true, modified: nov9},
+				{name: "readme.txt", size: 7, modified: nov9 + 30},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseHTMLIndex(tt.page)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseHref(t *testing.T) {
+	tests := []struct {
+		href  string
+		name  string
+		isDir bool
+		ok    bool
+	}{
+		{"file.txt", "file.txt", false, true},
+		{"dir/", "dir", true, true},
+		{"./file.txt", "file.txt", false, true},
+		{"with%2Fslash", "", false, false},
+		{"../", "", false, false},
+		{"/absolute/", "", false, false},
+		{"?C=N;O=D", "", false, false},
+		{"#top", "", false, false},
+		{"https://example.com/", "", false, false},
+		{"nested/file.txt", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.href, func(t *testing.T) {
+			name, isDir, ok := parseHref(tt.href)
+			if name != tt.name || isDir != tt.isDir || ok != tt.ok {
+				t.Errorf("expected %q %v %v, got %q %v %v", tt.name, tt.isDir, tt.ok, name, isDir, ok)
+			}
+		})
+	}
+}
+
+// fakeNginx serves a directory index under /pub/, redirecting directories
+// without a trailing slash like nginx does
+func fakeNginx(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/pub/":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<pre><a href="../">../</a>
+<a href="docs/">docs/</a>      09-Nov-2025 09:00     -
+<a href="readme.txt">readme.txt</a>      09-Nov-2025 09:00     7
+</pre>`)
+		case "/pub/docs/":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `[{"name":"report.pdf","type":"file","mtime":"Sun, 09 Nov 2025 09:00:00 GMT","size":4}]`)
+		case "/pub/docs":
+			http.Redirect(w, r, "/pub/docs/", http.StatusMovedPermanently)
+		case "/pub/readme.txt", "/pub/readme.txt/":
+			// Some servers ignore the trailing slash
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Last-Modified", "Sun, 09 Nov 2025 09:00:00 GMT")
+			io.WriteString(w, "current")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func indexPath(p string) url.URL {
+	return url.URL{Scheme: "autoindex", Path: p}
+}
+
+func TestAutoindex(t *testing.T) {
+	server := fakeNginx(t)
+	defer server.Close()
+
+	s, err := New(Config{URL: server.URL + "/pub/", Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listTests := []struct {
+		path     string
+		expected []string
+		wantErr  error
+	}{
+		{"", []string{"dir:docs", "file:readme.txt"}, nil},
+		{"docs", []string{"file:report.pdf"}, nil},
+		{"readme.txt", nil, fs.ErrNotExist},
+		{"missing", nil, fs.ErrNotExist},
+	}
+	for _, tt := range listTests {
+		t.Run("list "+tt.path, func(t *testing.T) {
+			nodes, err := s.ListContents(indexPath(tt.path))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, node := range nodes {
+				got = append(got, node.Type+":"+node.Path.Path)
+			}
+			expected := []string{}
+			for _, e := range tt.expected {
+				kind, name, _ := strings.Cut(e, ":")
+				expected = append(expected, kind+":"+strings.TrimPrefix(tt.path+"/"+name, "/"))
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+
+	existsTests := []struct {
+		path string
+		file bool
+		dir  bool
+	}{
+		{"", false, true},
+		{"docs", false, true},
+		{"readme.txt", true, false},
+		{"missing", false, false},
+	}
+	for _, tt := range existsTests {
+		t.Run("exists "+tt.path, func(t *testing.T) {
+			if ok, err := s.FileExists(indexPath(tt.path)); ok != tt.file || err != nil {
+				t.Errorf("FileExists: expected %v, got %v, %v", tt.file, ok, err)
+			}
+			if ok, err := s.DirectoryExists(indexPath(tt.path)); ok != tt.dir || err != nil {
+				t.Errorf("DirectoryExists: expected %v, got %v, %v", tt.dir, ok, err)
+			}
+		})
+	}
+
+	r, err := s.ReadStream(indexPath("readme.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "current" {
+		t.Errorf("expected current, got %q", data)
+	}
+	if size, err := s.FileSize(indexPath("readme.txt")); size != 7 || err != nil {
+		t.Errorf("expected size 7, got %d, %v", size, err)
+	}
+	if modified, _ := s.LastModified(indexPath("readme.txt")); modified != 1762678800 {
+		t.Errorf("unexpected last modified %d", modified)
+	}
+
+	unauthorized, _ := New(Config{URL: server.URL + "/pub/"})
+	if _, err := unauthorized.ListContents(indexPath("")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
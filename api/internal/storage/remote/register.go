@@ -0,0 +1,30 @@
+package remote
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("autoindex", func(sc config.StorageConfig) (storage.Storage, error) {
+		return New(Config{
+			Name:     sc.Name,
+			Mode:     ModeAutoindex,
+			URL:      sc.URL,
+			Username: sc.Username,
+			Password: sc.Password,
+		})
+	})
+	registry.Register("remote", func(sc config.StorageConfig) (storage.Storage, error) {
+		return New(Config{
+			Name:     sc.Name,
+			Mode:     ModeTimeship,
+			URL:      sc.URL,
+			Storage:  sc.RemoteStorage,
+			Username: sc.Username,
+			Password: sc.Password,
+			Token:    sc.Token,
+		})
+	})
+}
@@ -0,0 +1,316 @@
+// Package remote provides read-only storages browsing other HTTP servers.
+//
+// Two kinds of servers are supported:
+//
+//   - Web servers with directory indexes, like nginx autoindex or Apache
+//     mod_autoindex. See autoindex.go for details.
+//   - Other timeship servers, using the nodes and snapshots API of one of
+//     their storages. Snapshots of the remote storage are passed through, so
+//     servers can be chained to browse storages of several hosts from one.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// Modes of remote servers
+const (
+	ModeAutoindex = "autoindex"
+	ModeTimeship  = "timeship"
+)
+
+// errIsDir is returned for reading directories as files
+var errIsDir = errors.New("is a directory")
+
+// Config holds configuration for the remote storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths, defaults to the mode
+	Name string
+
+	// Mode is the kind of remote server, ModeAutoindex (default) or ModeTimeship
+	Mode string
+
+	// URL is the directory index root, or the API URL of a timeship server,
+	// e.g. "https://files.example.com/pub/" or "https://nas.example.com/api"
+	URL string
+
+	// Storage is the storage of the timeship server to browse
+	Storage string
+
+	// Username and Password are sent with basic authentication if set
+	Username string
+	Password string
+
+	// Token is sent as a bearer token if set, e.g. for timeship servers
+	// behind an authenticating reverse proxy
+	Token string
+
+	// Client is the HTTP client used for requests, defaults to a client with
+	// a timeout
+	Client *http.Client
+}
+
+// Storage implements read-only storage interfaces for a remote HTTP server
+type Storage struct {
+	name     string
+	mode     string
+	base     *url.URL
+	storage  string
+	username string
+	password string
+	token    string
+	client   *http.Client
+}
+
+// New creates a new remote storage
+func New(config Config) (*Storage, error) {
+	mode := config.Mode
+	if mode == "" {
+		mode = ModeAutoindex
+	}
+	if mode != ModeAutoindex && mode != ModeTimeship {
+		return nil, fmt.Errorf("unsupported mode %q", mode)
+	}
+	if mode == ModeTimeship && config.Storage == "" {
+		return nil, errors.New("storage is required")
+	}
+	if config.Token != "" && (config.Username != "" || config.Password != "") {
+		return nil, errors.New("token and basic authentication can't be used together")
+	}
+
+	base, err := url.Parse(config.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: expected an http or https URL", config.URL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+	base.RawQuery = ""
+	base.Fragment = ""
+
+	name := config.Name
+	if name == "" {
+		name = mode
+	}
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Storage{
+		name:     name,
+		mode:     mode,
+		base:     base,
+		storage:  config.Storage,
+		username: config.Username,
+		password: config.Password,
+		token:    config.Token,
+		client:   client,
+	}, nil
+}
+
+// relPath returns the cleaned path relative to the storage root
+func relPath(vfPath url.URL) string {
+	return strings.Trim(cleanPath(vfPath.Path), "/")
+}
+
+// cleanPath cleans a path without allowing it to escape the root
+func cleanPath(p string) string {
+	parts := []string{}
+	for _, part := range strings.Split(p, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if len(parts) > 0 {
+				parts = parts[:len(parts)-1]
+			}
+		default:
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// resolve returns the URL of the base path joined with the path segments
+func (s *Storage) resolve(segments ...string) *url.URL {
+	u := *s.base
+	return u.JoinPath(segments...)
+}
+
+// get sends an authorized request, mapping error statuses to errors
+func (s *Storage) get(method string, u *url.URL, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, statusError(method, u.Path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// statusError maps an HTTP error status to an error
+func statusError(method string, p string, status int) error {
+	var err error
+	switch status {
+	case http.StatusNotFound, http.StatusGone:
+		err = fs.ErrNotExist
+	case http.StatusForbidden, http.StatusUnauthorized:
+		err = fs.ErrPermission
+	case http.StatusBadRequest:
+		err = fs.ErrInvalid
+	case http.StatusNotImplemented:
+		err = storage.ErrNotSupported
+	default:
+		err = fmt.Errorf("unexpected status %d", status)
+	}
+	return &fs.PathError{Op: strings.ToLower(method), Path: p, Err: err}
+}
+
+// ListContents implements storage.Lister
+func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
+	if s.mode == ModeTimeship {
+		return s.listTimeship(vfPath)
+	}
+	return s.listAutoindex(vfPath)
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
+	if s.mode == ModeTimeship {
+		return s.readTimeship(vfPath)
+	}
+	resp, err := s.getAutoindexFile(http.MethodGet, vfPath)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// fileInfo is the metadata of a remote file
+type fileInfo struct {
+	size         int64
+	mimeType     string
+	lastModified int64
+	isDir        bool
+}
+
+// stat returns the metadata of a remote node
+func (s *Storage) stat(vfPath url.URL) (fileInfo, error) {
+	if s.mode == ModeTimeship {
+		return s.statTimeship(vfPath)
+	}
+	return s.statAutoindex(vfPath)
+}
+
+// statFile returns the metadata of a remote file
+func (s *Storage) statFile(vfPath url.URL) (fileInfo, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	if info.isDir {
+		return fileInfo{}, &fs.PathError{Op: "stat", Path: vfPath.Path, Err: errIsDir}
+	}
+	return info, nil
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(vfPath url.URL) (int64, error) {
+	info, err := s.statFile(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.size, nil
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(vfPath url.URL) (string, error) {
+	info, err := s.statFile(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return info.mimeType, nil
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.lastModified, nil
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(vfPath url.URL) (bool, error) {
+	info, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.isDir, nil
+}
+
+// DirectoryExists implements storage.Existence
+func (s *Storage) DirectoryExists(vfPath url.URL) (bool, error) {
+	if relPath(vfPath) == "" && vfPath.Query().Get("snapshot") == "" {
+		return true, nil
+	}
+	info, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.isDir, nil
+}
+
+// CheckHealth implements storage.HealthChecker
+func (s *Storage) CheckHealth() error {
+	if s.mode == ModeTimeship {
+		return s.checkTimeship()
+	}
+	resp, err := s.get(http.MethodHead, s.autoindexURL(url.URL{}, true), "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListSnapshots implements storage.SnapshotLister
+// Directory indexes have no snapshots, timeship servers pass theirs through
+func (s *Storage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
+	if s.mode == ModeTimeship {
+		return s.snapshotsTimeship(vfPath)
+	}
+	return []storage.Snapshot{}, nil
+}
@@ -0,0 +1,196 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"timeship/internal/storage"
+)
+
+// timeshipNode is a node of the timeship API, or a directory listing if
+// Files is set
+type timeshipNode struct {
+	Path         string          `json:"path"`
+	Type         string          `json:"type"`
+	Basename     string          `json:"basename"`
+	MimeType     string          `json:"mime_type"`
+	FileSize     int64           `json:"file_size"`
+	LastModified int64           `json:"last_modified"`
+	LinkTarget   string          `json:"link_target"`
+	Files        *[]timeshipNode `json:"files"`
+}
+
+// timeshipSnapshot is a snapshot of the timeship API
+type timeshipSnapshot struct {
+	ID        string         `json:"id"`
+	Type      string         `json:"type"`
+	Timestamp int64          `json:"timestamp"`
+	Name      string         `json:"name"`
+	Size      int64          `json:"size"`
+	Metadata  map[string]any `json:"metadata"`
+}
+
+// timeshipURL returns the API URL of an endpoint of the remote storage for a
+// path, selecting the snapshot of the path if any
+func (s *Storage) timeshipURL(endpoint string, vfPath url.URL) *url.URL {
+	segments := []string{"storages", s.storage, endpoint}
+	if rel := relPath(vfPath); rel != "" {
+		segments = append(segments, strings.Split(rel, "/")...)
+	}
+	u := s.resolve(segments...)
+	if snapshot := vfPath.Query().Get("snapshot"); snapshot != "" {
+		u.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	return u
+}
+
+// getTimeshipNode requests a node of the remote storage
+func (s *Storage) getTimeshipNode(vfPath url.URL, accept string) (*http.Response, error) {
+	return s.get(http.MethodGet, s.timeshipURL("nodes", vfPath), accept)
+}
+
+// readTimeship streams a file of the remote storage. Files are requested as
+// downloads, as directories are listed regardless of the accepted type and
+// only file downloads have a Content-Disposition.
+func (s *Storage) readTimeship(vfPath url.URL) (io.ReadCloser, error) {
+	u := s.timeshipURL("nodes", vfPath)
+	q := u.Query()
+	q.Set("download", "true")
+	u.RawQuery = q.Encode()
+
+	resp, err := s.get(http.MethodGet, u, "application/octet-stream")
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Get("Content-Disposition") == "" {
+		resp.Body.Close()
+		return nil, &fs.PathError{Op: "read", Path: vfPath.Path, Err: errIsDir}
+	}
+	return resp.Body, nil
+}
+
+// decodeTimeship decodes a JSON response of the timeship API
+func decodeTimeship(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid timeship response: %w", err)
+	}
+	return nil
+}
+
+// nodeTimeship returns a node of the remote storage
+func (s *Storage) nodeTimeship(vfPath url.URL) (timeshipNode, error) {
+	resp, err := s.getTimeshipNode(vfPath, "application/json")
+	if err != nil {
+		return timeshipNode{}, err
+	}
+	var node timeshipNode
+	err = decodeTimeship(resp, &node)
+	return node, err
+}
+
+// listTimeship lists a directory of the remote storage
+func (s *Storage) listTimeship(vfPath url.URL) ([]storage.FileNode, error) {
+	node, err := s.nodeTimeship(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	if node.Files == nil {
+		return nil, &fs.PathError{Op: "list", Path: vfPath.Path, Err: fs.ErrNotExist}
+	}
+
+	dir := relPath(vfPath)
+	nodes := make([]storage.FileNode, 0, len(*node.Files))
+	for _, child := range *node.Files {
+		fileNode := storage.FileNode{
+			Path:         url.URL{Scheme: s.name, Path: strings.TrimPrefix(path.Join(dir, child.Basename), "/")},
+			Type:         child.Type,
+			Basename:     child.Basename,
+			LastModified: child.LastModified,
+			LinkTarget:   child.LinkTarget,
+		}
+		switch child.Type {
+		case "dir":
+			fileNode.Mode = fs.ModeDir | 0555
+		case "link":
+			fileNode.Mode = fs.ModeSymlink | 0444
+		case "special":
+			fileNode.Mode = fs.ModeIrregular | 0444
+		default:
+			fileNode.Mode = 0444
+			fileNode.Size = child.FileSize
+			fileNode.Extension = strings.TrimPrefix(path.Ext(child.Basename), ".")
+			fileNode.MimeType = child.MimeType
+		}
+		nodes = append(nodes, fileNode)
+	}
+	return nodes, nil
+}
+
+// statTimeship returns the metadata of a node of the remote storage
+func (s *Storage) statTimeship(vfPath url.URL) (fileInfo, error) {
+	node, err := s.nodeTimeship(vfPath)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	return fileInfo{
+		size:         node.FileSize,
+		mimeType:     node.MimeType,
+		lastModified: node.LastModified,
+		isDir:        node.Files != nil,
+	}, nil
+}
+
+// checkTimeship checks that the remote server has the storage
+func (s *Storage) checkTimeship() error {
+	resp, err := s.get(http.MethodGet, s.resolve("storages"), "application/json")
+	if err != nil {
+		return err
+	}
+	var list struct {
+		Storages []string `json:"storages"`
+	}
+	if err := decodeTimeship(resp, &list); err != nil {
+		return err
+	}
+	if !slices.Contains(list.Storages, s.storage) {
+		return fmt.Errorf("remote storage %s: %w", s.storage, fs.ErrNotExist)
+	}
+	return nil
+}
+
+// snapshotsTimeship returns the snapshots of a node of the remote storage
+func (s *Storage) snapshotsTimeship(vfPath url.URL) ([]storage.Snapshot, error) {
+	u := s.timeshipURL("snapshots", vfPath)
+	u.RawQuery = ""
+	resp, err := s.get(http.MethodGet, u, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Snapshots []timeshipSnapshot `json:"snapshots"`
+	}
+	if err := decodeTimeship(resp, &list); err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]storage.Snapshot, 0, len(list.Snapshots))
+	for _, snap := range list.Snapshots {
+		snapshots = append(snapshots, storage.Snapshot{
+			ID:        snap.ID,
+			Type:      snap.Type,
+			Timestamp: snap.Timestamp,
+			Name:      snap.Name,
+			Size:      snap.Size,
+			Metadata:  storage.SnapshotMetadata(snap.Metadata),
+		})
+	}
+	return snapshots, nil
+}
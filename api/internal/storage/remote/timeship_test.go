@@ -0,0 +1,160 @@
+package remote
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"timeship/internal/api"
+	"timeship/internal/storage"
+	"timeship/internal/storage/local"
+)
+
+// snapshotStorage is a local storage with a fixed snapshot
+type snapshotStorage struct {
+	*local.Storage
+}
+
+func (s snapshotStorage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
+	return []storage.Snapshot{{
+		ID:        "zfs:daily",
+		Type:      "zfs",
+		Timestamp: 1762678800,
+		Name:      "daily",
+		Size:      3,
+		Metadata:  storage.SnapshotMetadata{"pool": "tank"},
+	}}, nil
+}
+
+// newTimeshipServer serves the API of a server with a local storage behind
+// a proxy requiring the bearer token
+func newTimeshipServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs"), 0755)
+	os.WriteFile(filepath.Join(root, "docs", "data.json"), []byte(`{"a":1}`), 0644)
+	os.WriteFile(filepath.Join(root, "readme.txt"), []byte("current"), 0644)
+
+	store, err := local.NewWithConfig(root, local.Config{Name: "tank"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	server, err := api.NewServer(map[string]storage.Storage{"tank": snapshotStorage{store}}, "tank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", api.HandlerWithOptions(server, api.StdHTTPServerOptions{})))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func TestTimeship(t *testing.T) {
+	server := newTimeshipServer(t, "secret")
+	defer server.Close()
+
+	s, err := New(Config{Name: "nas", Mode: ModeTimeship, URL: server.URL + "/api", Storage: "tank", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nasPath := func(p string) url.URL {
+		return url.URL{Scheme: "nas", Path: p}
+	}
+
+	nodes, err := s.ListContents(nasPath(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Type != "dir" || nodes[0].Path.Path != "docs" || nodes[1].Size != 7 {
+		t.Errorf("unexpected nodes %+v", nodes)
+	}
+	if nodes[1].Path.Scheme != "nas" || nodes[1].Extension != "txt" {
+		t.Errorf("unexpected file node %+v", nodes[1])
+	}
+
+	nodes, err = s.ListContents(nasPath("docs"))
+	if err != nil || len(nodes) != 1 || nodes[0].Path.Path != "docs/data.json" {
+		t.Errorf("unexpected docs nodes %+v, %v", nodes, err)
+	}
+	if _, err := s.ListContents(nasPath("readme.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist listing a file, got %v", err)
+	}
+	if _, err := s.ListContents(nasPath("missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+
+	// JSON files are streamed as content, not mistaken for listings
+	for path, expected := range map[string]string{"readme.txt": "current", "docs/data.json": `{"a":1}`} {
+		r, err := s.ReadStream(nasPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if string(data) != expected {
+			t.Errorf("expected %q, got %q", expected, data)
+		}
+	}
+	if _, err := s.ReadStream(nasPath("docs")); err == nil {
+		t.Error("expected error reading a directory")
+	}
+
+	if size, err := s.FileSize(nasPath("readme.txt")); size != 7 || err != nil {
+		t.Errorf("expected size 7, got %d, %v", size, err)
+	}
+	if ok, _ := s.FileExists(nasPath("readme.txt")); !ok {
+		t.Error("expected file to exist")
+	}
+	if ok, _ := s.FileExists(nasPath("docs")); ok {
+		t.Error("expected directory not to be a file")
+	}
+	if ok, _ := s.DirectoryExists(nasPath("docs")); !ok {
+		t.Error("expected directory to exist")
+	}
+
+	snapshots, err := s.ListSnapshots(nasPath("readme.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != "zfs:daily" || snapshots[0].Metadata["pool"] != "tank" {
+		t.Errorf("unexpected snapshots %+v", snapshots)
+	}
+
+	wrongToken, _ := New(Config{Mode: ModeTimeship, URL: server.URL + "/api", Storage: "tank", Token: "wrong"})
+	if _, err := wrongToken.ListContents(nasPath("")); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected permission error, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"missing URL", Config{}},
+		{"unsupported scheme", Config{URL: "ftp://example.com/"}},
+		{"unknown mode", Config{URL: "https://example.com/", Mode: "webdav"}},
+		{"timeship without storage", Config{URL: "https://example.com/api", Mode: ModeTimeship}},
+		{"token and basic authentication", Config{URL: "https://example.com/", Token: "t", Username: "u"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -1,10 +1,33 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 )
 
+// ErrNotSupported is returned when a storage implements a capability
+// interface but the capability is disabled by its configuration
+var ErrNotSupported = errors.New("operation not supported by storage")
+
+// ErrSpecialFile is returned when reading sockets, FIFOs, device nodes and
+// other nodes without content to read, which are listed as "special"
+var ErrSpecialFile = errors.New("special files can't be read")
+
+// ErrSnapshotNotFound is returned when a path is accessed in a snapshot the
+// storage doesn't have. It matches fs.ErrNotExist too.
+var ErrSnapshotNotFound = fmt.Errorf("snapshot not found: %w", fs.ErrNotExist)
+
+// ErrOutsideRoot is returned for paths leading out of the storage root,
+// e.g. with ".." segments
+var ErrOutsideRoot = errors.New("path outside of the storage root")
+
+// ErrInvalidOffset is returned when writing at an offset past the end of a
+// file, which would leave a hole
+var ErrInvalidOffset = errors.New("offset past the end of the file")
+
 // Path Handling Convention:
 //
 // All paths in the storage layer MUST use the following convention:
@@ -24,12 +47,24 @@ import (
 // All Path fields MUST include the storage prefix (e.g., "local://path/to/file")
 type FileNode struct {
 	Path         url.URL // Full path with storage prefix, e.g., "local://documents/file.txt"
-	Type         string  // "file" or "dir"
+	Type         string  // "file", "dir", "link" or "special"
 	Basename     string  // Base name without path, e.g., "file.txt"
 	Extension    string  // File extension without dot, e.g., "txt"
 	Size         int64
 	LastModified int64
 	MimeType     string
+	Mode         fs.FileMode // Type and permission bits, 0 if unknown
+	Owner        string      // Owner user name or numeric ID, see OwnerResolver
+	Group        string      // Owner group name or numeric ID, see OwnerResolver
+	LinkTarget   string      // Target of a symbolic link, empty for other nodes
+
+	// AllocatedSize is the number of bytes a file takes up on disk, less than
+	// Size for sparse files, 0 if unknown
+	AllocatedSize int64
+
+	// FileID is shared by all hard links to the same file, so it can be
+	// counted once, empty if the file has a single link or it's unknown
+	FileID string
 }
 
 // Snapshot represents a point-in-time snapshot of a node
@@ -58,6 +93,24 @@ type Snapshot struct {
 // SnapshotMetadata represents backend-specific metadata for a snapshot
 type SnapshotMetadata map[string]interface{}
 
+// TrashItem represents a deleted node kept in the trash
+type TrashItem struct {
+	// ID uniquely identifies the item within the storage trash
+	ID string
+
+	// Path is the original path of the node, with storage prefix
+	Path url.URL
+
+	// Type is "file" or "dir"
+	Type string
+
+	// Size is the file size (0 for directories)
+	Size int64
+
+	// DeletedAt is the Unix timestamp when the node was moved to the trash
+	DeletedAt int64
+}
+
 // Storage is a marker interface for storage storages
 // All methods are optional - storages implement only the capabilities they support
 type Storage interface {
@@ -73,11 +126,41 @@ type Lister interface {
 	ListContents(path url.URL) ([]FileNode, error)
 }
 
+// OwnerResolver resolves the numeric owner user and group IDs of listed nodes
+// to names. Lookups can be slow (e.g. with LDAP), so storages implementing it
+// list the IDs and names are only resolved when needed.
+type OwnerResolver interface {
+	// ResolveOwner returns the names of the user and group, or their IDs
+	// if they can't be resolved
+	ResolveOwner(owner, group string) (string, string)
+}
+
 // SnapshotLister lists snapshots for a specific path (for /snapshots endpoint)
 type SnapshotLister interface {
 	ListSnapshots(path url.URL) ([]Snapshot, error)
 }
 
+// SnapshotManager creates and destroys snapshots of the whole storage
+type SnapshotManager interface {
+	// CreateSnapshot creates a snapshot with the given name, or a generated
+	// name if empty
+	CreateSnapshot(name string) (Snapshot, error)
+
+	// DestroySnapshot permanently destroys the snapshot with the given ID
+	DestroySnapshot(id string) error
+}
+
+// Walker walks all nodes below a directory, faster than listing each
+// directory with Lister (for /reports endpoints).
+// The path parameter MUST include the storage prefix and may select a
+// snapshot. fn is called for every node below the path, possibly
+// concurrently and in any order. Symbolic links are reported as links and
+// not followed. Returning fs.SkipDir from fn for a directory skips its
+// contents, returning another error stops the walk with that error.
+type Walker interface {
+	Walk(path url.URL, fn func(node FileNode) error) error
+}
+
 // SubfolderLister lists subdirectories (for /subfolders endpoint)
 // The path parameter MUST include the storage prefix (e.g., "local://documents")
 // All returned FileNode.Path values MUST include the storage prefix
@@ -104,11 +187,73 @@ type Stater interface {
 	LastModified(path url.URL) (int64, error)
 }
 
+// NodeTimes are the timestamps of a node besides its modification time, as
+// Unix timestamps, 0 if unknown
+type NodeTimes struct {
+	// Created is when the node was created (birth time), which few file
+	// systems record
+	Created int64
+
+	// Changed is when the content or metadata of the node like its
+	// permissions, owner or links last changed (ctime)
+	Changed int64
+}
+
+// TimeStater gets the birth and change times of files and directories (for
+// the (times) field), e.g. to tell apart files that were modified from files
+// whose modification time was set back
+type TimeStater interface {
+	NodeTimes(path url.URL) (NodeTimes, error)
+}
+
+// NodeTyper tells what kind of node a path is without listing or reading it,
+// following symbolic links the storage follows. The type is "file", "dir" or
+// "special", like FileNode.Type. Missing nodes fail with fs.ErrNotExist.
+type NodeTyper interface {
+	NodeType(path url.URL) (string, error)
+}
+
+// Versioner returns an opaque version of a file that changes whenever the
+// file is written, finer than LastModified (for ETag and If-Match)
+type Versioner interface {
+	Version(path url.URL) (string, error)
+}
+
+// Identifier returns an opaque identity of a file or directory that stays
+// the same when it's renamed or moved within the storage, like its inode
+// (for finding tagged and bookmarked nodes renamed outside of the API)
+type Identifier interface {
+	Identity(path url.URL) (string, error)
+}
+
+// Follower follows files as they grow, like tail -f (for ?follow=true).
+// Reads at the end of a followed stream wait for more content instead of
+// returning io.EOF, until the stream is closed. A truncated file is read
+// again from the start.
+type Follower interface {
+	FollowStream(path url.URL) (io.ReadSeekCloser, error)
+}
+
 // Writer writes file content (for /upload and /save endpoints)
 type Writer interface {
 	WriteStream(path url.URL, r io.Reader) error
 }
 
+// ExclusiveWriter writes new files atomically, failing with fs.ErrExist if a
+// node already exists at the path instead of replacing it (for creating
+// files without overwriting ones created concurrently)
+type ExclusiveWriter interface {
+	WriteNew(path url.URL, r io.Reader) error
+}
+
+// WriterAt writes the content of r into an existing file at an offset,
+// keeping the bytes around it and extending the file if the content ends
+// past it (for PATCH with a byte range). Offsets past the end of the file
+// fail with ErrInvalidOffset.
+type WriterAt interface {
+	WriteStreamAt(path url.URL, offset int64, r io.Reader) error
+}
+
 // Creator creates files and directories (for /newfile and /newfolder endpoints)
 type Creator interface {
 	CreateFile(path url.URL) error
@@ -121,17 +266,132 @@ type Deleter interface {
 	DeleteDirectory(path url.URL) error
 }
 
+// Trasher keeps deleted nodes in a trash area so they can be restored
+// Storages with trash enabled move nodes to the trash on Delete and DeleteDirectory
+type Trasher interface {
+	ListTrash() ([]TrashItem, error)
+	RestoreTrash(id string) (TrashItem, error)
+	PurgeTrash(id string) error
+	EmptyTrash() error
+}
+
 // Mover moves/renames files and directories (for /move and /rename endpoints)
 type Mover interface {
 	Move(from, to url.URL) error
 }
 
+// CopyOptions configures how nodes are copied
+type CopyOptions struct {
+	// Preserve keeps the permissions and modification times of the copied
+	// nodes, and their owners if the server may change them (as root).
+	// Otherwise copies get default permissions and the current time.
+	Preserve bool
+}
+
+// Copier copies files and directories recursively within a storage
+// (for /copies endpoint). The source may select a snapshot to restore from
+// it, the destination must not exist yet.
+type Copier interface {
+	Copy(from, to url.URL, opts CopyOptions) error
+}
+
 // Archiver creates and extracts archives (for /archive and /unarchive endpoints)
 type Archiver interface {
 	Archive(items []url.URL, archivePath url.URL) error
 	Unarchive(archivePath, targetPath url.URL) error
 }
 
+// HealthChecker checks that a storage is reachable, e.g. that its root
+// directory can be opened or its service answers (for /readyz endpoint).
+// Checks should be cheap, as they may run every few seconds.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// ZFSHealth is the health of the ZFS dataset backing a storage and of the
+// pool containing it
+type ZFSHealth struct {
+	Pool    ZFSPool
+	Dataset ZFSDataset
+}
+
+// ZFSPool is the status of a pool as reported by zpool status
+type ZFSPool struct {
+	Name string
+	// State is the health of the pool, e.g. ONLINE or DEGRADED
+	State string
+	// Status and Action explain a problem and how to fix it, empty if healthy
+	Status string
+	Action string
+	// Scan describes the last or running scrub or resilver
+	Scan string
+	// LastScrub is the Unix time the last scrub finished, zero if unknown
+	LastScrub int64
+	// Errors summarizes data errors, e.g. "No known data errors"
+	Errors  string
+	Devices []ZFSDevice
+}
+
+// ZFSDevice is a virtual or physical device of a pool with its error counts.
+// Depth is 0 for the pool itself, 1 for its top-level vdevs and so on.
+type ZFSDevice struct {
+	Name     string
+	State    string
+	Depth    int
+	Read     int64
+	Write    int64
+	Checksum int64
+}
+
+// ZFSDataset holds properties of a dataset, sizes are in bytes
+type ZFSDataset struct {
+	Name            string
+	Used            int64
+	Available       int64
+	Referenced      int64
+	UsedBySnapshots int64
+	Compression     string
+	CompressRatio   float64
+}
+
+// ZFSHealthReporter reports the health of the ZFS pool and dataset backing
+// a storage (for /storages/{storage}/zfs endpoint). Storages that aren't on
+// ZFS or can't run the zfs tools return ErrNotSupported.
+type ZFSHealthReporter interface {
+	ZFSHealth() (ZFSHealth, error)
+}
+
+// SnapshotSpace is the space held by the snapshots of a storage, sizes are
+// in bytes
+type SnapshotSpace struct {
+	// Dataset is the name of the dataset or volume the snapshots are of
+	Dataset string
+	// Used is the space freed if all snapshots were destroyed, including
+	// data shared by several snapshots
+	Used      int64
+	Snapshots []SnapshotUsage
+}
+
+// SnapshotUsage is the space held by a snapshot, sizes are in bytes
+type SnapshotUsage struct {
+	// ID is the snapshot identifier as listed by SnapshotLister
+	ID        string
+	Name      string
+	Timestamp int64
+	// Used is the data only this snapshot holds, freed by destroying it
+	Used int64
+	// Written is the data written between the previous snapshot and this one
+	Written int64
+	// Referenced is the data the snapshot shows, shared or not
+	Referenced int64
+}
+
+// SnapshotSpaceReporter reports the space held by each snapshot of a storage
+// (for /storages/{storage}/reports/snapshots endpoint)
+type SnapshotSpaceReporter interface {
+	SnapshotSpace() (SnapshotSpace, error)
+}
+
 // Existence checks if files/directories exist
 type Existence interface {
 	FileExists(path url.URL) (bool, error)
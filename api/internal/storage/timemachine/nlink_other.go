@@ -0,0 +1,10 @@
+//go:build !unix
+
+package timemachine
+
+import "io/fs"
+
+// linkCount returns 0, directory hard links are only resolved on Unix
+func linkCount(info fs.FileInfo) uint64 {
+	return 0
+}
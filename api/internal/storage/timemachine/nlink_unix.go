@@ -0,0 +1,17 @@
+//go:build unix
+
+package timemachine
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// linkCount returns the number of hard links of a file
+func linkCount(info fs.FileInfo) uint64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint64(st.Nlink)
+}
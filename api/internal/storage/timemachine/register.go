@@ -0,0 +1,16 @@
+package timemachine
+
+import (
+	"timeship/internal/config"
+	"timeship/internal/storage"
+	"timeship/internal/storage/registry"
+)
+
+func init() {
+	registry.Register("timemachine", func(sc config.StorageConfig) (storage.Storage, error) {
+		return NewWithConfig(sc.Root, Config{
+			Name:    sc.Name,
+			Machine: sc.Machine,
+		})
+	})
+}
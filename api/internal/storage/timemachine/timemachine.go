@@ -0,0 +1,467 @@
+// Package timemachine provides read-only storages for macOS Time Machine backups.
+//
+// # Backup Layouts
+//
+// Two layouts are supported, depending on the backup disk format:
+//
+//	Backups.backupdb/<machine>/2025-11-09-143045/<volume>/...   HFS+ backups
+//	2025-11-09-143045.backup/2025-11-09-143045.backup/<volume>/...   APFS backups
+//
+// The root may also point directly at a machine directory containing the
+// dated backups. Each backup is exposed as a snapshot, the current state of
+// the storage is the latest backup.
+//
+// # Directory Hard Links
+//
+// HFS+ backups use directory hard links for unchanged directories. When the
+// disk is mounted on Linux, these appear as empty files whose link count is
+// the ID of the real directory stored in the private directory at the volume
+// root ("dir_<id>"). They are resolved transparently.
+package timemachine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// defaultStorageName is the storage name used when none is configured
+const defaultStorageName = "timemachine"
+
+// backupLayout is the time layout of backup directory names
+const backupLayout = "2006-01-02-150405"
+
+// backupDB is the directory containing HFS+ backups of all machines
+const backupDB = "Backups.backupdb"
+
+// privateDirData is the HFS+ directory containing hard linked directories
+const privateDirData = ".HFS+ Private Directory Data\r"
+
+// Config holds configuration for the Time Machine storage
+type Config struct {
+	// Name is the storage name used as the scheme of all paths,
+	// defaults to "timemachine"
+	Name string
+
+	// Machine selects the machine in Backups.backupdb, defaults to the
+	// first one in alphabetical order
+	Machine string
+}
+
+// Storage implements read-only storage interfaces for Time Machine backups
+type Storage struct {
+	name     string
+	root     *os.Root
+	rootPath string
+	machine  string
+}
+
+// backup is a single dated backup
+type backup struct {
+	// name is the backup name, e.g. "2025-11-09-143045"
+	name string
+
+	// dir is the backup directory relative to the root
+	dir string
+
+	time time.Time
+}
+
+// New creates a new Time Machine storage with default configuration
+func New(rootPath string) (*Storage, error) {
+	return NewWithConfig(rootPath, Config{})
+}
+
+// NewWithConfig creates a new Time Machine storage with custom configuration
+func NewWithConfig(rootPath string, config Config) (*Storage, error) {
+	name := config.Name
+	if name == "" {
+		name = defaultStorageName
+	}
+
+	root, err := os.OpenRoot(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{
+		name:     name,
+		root:     root,
+		rootPath: rootPath,
+		machine:  config.Machine,
+	}, nil
+}
+
+// Close releases the root directory
+func (s *Storage) Close() error {
+	return s.root.Close()
+}
+
+// CheckHealth implements storage.HealthChecker
+// The backup disk must be mounted and contain at least one backup
+func (s *Storage) CheckHealth() error {
+	if _, err := os.Stat(s.rootPath); err != nil {
+		return err
+	}
+	backups, err := s.backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no backups found in %s", s.rootPath)
+	}
+	return nil
+}
+
+// backups returns all backups, oldest first. Backups are discovered on every
+// call, as Time Machine adds and thins out backups over time.
+func (s *Storage) backups() ([]backup, error) {
+	var backups []backup
+
+	if info, err := s.root.Stat(backupDB); err == nil && info.IsDir() {
+		machine, err := s.machineDir()
+		if err != nil {
+			return nil, err
+		}
+		backups, err = s.datedDirs(path.Join(backupDB, machine), "")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// APFS backups, or a root pointing at a machine directory
+		apfs, err := s.datedDirs(".", ".backup")
+		if err != nil {
+			return nil, err
+		}
+		hfs, err := s.datedDirs(".", "")
+		if err != nil {
+			return nil, err
+		}
+		backups = append(apfs, hfs...)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.Before(backups[j].time)
+	})
+	return backups, nil
+}
+
+// machineDir returns the configured or first machine directory in Backups.backupdb
+func (s *Storage) machineDir() (string, error) {
+	if s.machine != "" {
+		return s.machine, nil
+	}
+
+	entries, err := fs.ReadDir(s.root.FS(), backupDB)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			return entry.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no machines in %s: %w", backupDB, fs.ErrNotExist)
+}
+
+// datedDirs returns the backups in dir named with the backup layout and suffix
+func (s *Storage) datedDirs(dir string, suffix string) ([]backup, error) {
+	entries, err := fs.ReadDir(s.root.FS(), dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []backup{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name, ok := strings.CutSuffix(entry.Name(), suffix)
+		if !ok {
+			continue
+		}
+		// Backups are named in the local time of the backed up machine
+		t, err := time.ParseInLocation(backupLayout, name, time.Local)
+		if err != nil {
+			continue
+		}
+
+		backupDir := path.Join(dir, entry.Name())
+		// Mounted APFS backup snapshots nest a directory with the same name
+		nested := path.Join(backupDir, entry.Name())
+		if info, err := s.root.Stat(nested); err == nil && info.IsDir() {
+			backupDir = nested
+		}
+
+		backups = append(backups, backup{name: name, dir: backupDir, time: t})
+	}
+	return backups, nil
+}
+
+// findBackup returns the backup selected by the snapshot query parameter,
+// or the latest backup if none is selected
+func (s *Storage) findBackup(vfPath url.URL) (backup, error) {
+	backups, err := s.backups()
+	if err != nil {
+		return backup{}, err
+	}
+
+	snapshotID := vfPath.Query().Get("snapshot")
+	if snapshotID == "" {
+		if len(backups) == 0 {
+			return backup{}, fmt.Errorf("no backups found: %w", fs.ErrNotExist)
+		}
+		return backups[len(backups)-1], nil
+	}
+
+	name, ok := strings.CutPrefix(snapshotID, "tm:")
+	if !ok {
+		return backup{}, fmt.Errorf("%w: invalid snapshot ID format: %s", storage.ErrSnapshotNotFound, snapshotID)
+	}
+	for _, b := range backups {
+		if b.name == name {
+			return b, nil
+		}
+	}
+	return backup{}, fmt.Errorf("backup %s: %w", name, storage.ErrSnapshotNotFound)
+}
+
+// resolve returns the path relative to the root of a path within a backup,
+// following directory hard links
+func (s *Storage) resolve(b backup, apiPath string) (string, error) {
+	rel := b.dir
+	for _, segment := range strings.Split(strings.Trim(apiPath, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if !filepath.IsLocal(segment) || strings.ContainsRune(segment, filepath.Separator) {
+			return "", &fs.PathError{Op: "resolve", Path: apiPath, Err: fs.ErrNotExist}
+		}
+		rel = path.Join(rel, segment)
+
+		info, err := s.root.Lstat(rel)
+		if err != nil {
+			return "", err
+		}
+		if target, ok := s.dirLink(info); ok {
+			rel = target
+		}
+	}
+	return rel, nil
+}
+
+// dirLink returns the real directory of an HFS+ directory hard link
+func (s *Storage) dirLink(info fs.FileInfo) (string, bool) {
+	if !info.Mode().IsRegular() || info.Size() != 0 {
+		return "", false
+	}
+	id := linkCount(info)
+	if id == 0 {
+		return "", false
+	}
+	target := path.Join(privateDirData, fmt.Sprintf("dir_%d", id))
+	if targetInfo, err := s.root.Stat(target); err != nil || !targetInfo.IsDir() {
+		return "", false
+	}
+	return target, true
+}
+
+// locate resolves an API path to a path relative to the root
+func (s *Storage) locate(vfPath url.URL) (string, error) {
+	b, err := s.findBackup(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return s.resolve(b, vfPath.Path)
+}
+
+// stat returns information about a node, following directory hard links
+func (s *Storage) stat(vfPath url.URL) (fs.FileInfo, error) {
+	rel, err := s.locate(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.root.Lstat(rel)
+}
+
+// ListContents implements storage.Lister
+func (s *Storage) ListContents(vfPath url.URL) ([]storage.FileNode, error) {
+	dir, err := s.locate(vfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(s.root.FS(), dir)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]storage.FileNode, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		rel := path.Join(dir, entry.Name())
+		if target, ok := s.dirLink(info); ok {
+			if targetInfo, err := s.root.Lstat(target); err == nil {
+				info = targetInfo
+				rel = target
+			}
+		}
+
+		node := storage.FileNode{
+			Path: url.URL{
+				Scheme: s.name,
+				Path:   strings.TrimPrefix(path.Join(vfPath.Path, entry.Name()), "/"),
+			},
+			Basename:     entry.Name(),
+			Mode:         info.Mode(),
+			LastModified: info.ModTime().Unix(),
+		}
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			// Links are not followed, as they point into the backed up machine
+			node.Type = "link"
+			node.LinkTarget, _ = s.root.Readlink(rel)
+		case info.IsDir():
+			node.Type = "dir"
+		default:
+			node.Type = "file"
+			node.Extension = strings.TrimPrefix(path.Ext(entry.Name()), ".")
+			node.Size = info.Size()
+			if node.Extension != "" {
+				node.MimeType, _ = s.detectMimeType(rel)
+			}
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// detectMimeType detects the MIME type of a file from its first bytes
+func (s *Storage) detectMimeType(rel string) (string, error) {
+	f, err := s.root.Open(rel)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buffer := make([]byte, 512)
+	n, _ := f.Read(buffer)
+	return http.DetectContentType(buffer[:n]), nil
+}
+
+// MimeType implements storage.Reader
+func (s *Storage) MimeType(vfPath url.URL) (string, error) {
+	rel, err := s.locate(vfPath)
+	if err != nil {
+		return "", err
+	}
+	return s.detectMimeType(rel)
+}
+
+// FileSize implements storage.Reader
+func (s *Storage) FileSize(vfPath url.URL) (int64, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// ReadStream implements storage.Reader
+func (s *Storage) ReadStream(vfPath url.URL) (io.ReadCloser, error) {
+	rel, err := s.locate(vfPath)
+	if err != nil {
+		return nil, err
+	}
+	return s.root.Open(rel)
+}
+
+// LastModified implements storage.Stater
+func (s *Storage) LastModified(vfPath url.URL) (int64, error) {
+	info, err := s.stat(vfPath)
+	if err != nil {
+		return 0, err
+	}
+	return info.ModTime().Unix(), nil
+}
+
+// FileExists implements storage.Existence
+func (s *Storage) FileExists(vfPath url.URL) (bool, error) {
+	info, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// DirectoryExists implements storage.Existence
+func (s *Storage) DirectoryExists(vfPath url.URL) (bool, error) {
+	info, err := s.stat(vfPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// ListSnapshots implements storage.SnapshotLister
+// Returns the backups containing the path, newest first
+func (s *Storage) ListSnapshots(vfPath url.URL) ([]storage.Snapshot, error) {
+	backups, err := s.backups()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []storage.Snapshot{}
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		rel, err := s.resolve(b, vfPath.Path)
+		if err != nil {
+			continue
+		}
+		info, err := s.root.Lstat(rel)
+		if err != nil {
+			continue
+		}
+
+		size := int64(-1)
+		if info.Mode().IsRegular() {
+			size = info.Size()
+		}
+
+		snapshots = append(snapshots, storage.Snapshot{
+			ID:        "tm:" + b.name,
+			Type:      "timemachine",
+			Timestamp: b.time.Unix(),
+			Name:      b.name,
+			Size:      size,
+			Metadata: storage.SnapshotMetadata{
+				"backup_dir": b.dir,
+				"time":       b.time.Format(time.RFC3339),
+			},
+		})
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,199 @@
+package timemachine
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"timeship/internal/storage"
+)
+
+// writeFile creates a file and its parent directories
+func writeFile(t *testing.T, name string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func snapshotPath(p string, snapshot string) url.URL {
+	u := url.URL{Scheme: "timemachine", Path: p}
+	if snapshot != "" {
+		u.RawQuery = url.Values{"snapshot": {snapshot}}.Encode()
+	}
+	return u
+}
+
+func readAll(t *testing.T, s *Storage, u url.URL) string {
+	t.Helper()
+	r, err := s.ReadStream(u)
+	if err != nil {
+		t.Fatalf("ReadStream(%s) failed: %v", u.String(), err)
+	}
+	defer r.Close()
+	content, _ := io.ReadAll(r)
+	return string(content)
+}
+
+func TestHFSBackups(t *testing.T) {
+	root := t.TempDir()
+	machine := filepath.Join(root, backupDB, "MacBook")
+	writeFile(t, filepath.Join(machine, "2025-11-08-120000", "Macintosh HD", "notes.txt"), "old")
+	writeFile(t, filepath.Join(machine, "2025-11-09-120000", "Macintosh HD", "notes.txt"), "new")
+	writeFile(t, filepath.Join(machine, "2025-11-09-120000", "Macintosh HD", "added.txt"), "added")
+	os.Symlink("2025-11-09-120000", filepath.Join(machine, "Latest"))
+
+	s, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	t.Run("snapshots", func(t *testing.T) {
+		snapshots, err := s.ListSnapshots(snapshotPath("Macintosh HD/notes.txt", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots) != 2 {
+			t.Fatalf("expected 2 snapshots, got %+v", snapshots)
+		}
+		if snapshots[0].ID != "tm:2025-11-09-120000" || snapshots[0].Size != 3 {
+			t.Errorf("unexpected newest snapshot %+v", snapshots[0])
+		}
+		want := time.Date(2025, 11, 8, 12, 0, 0, 0, time.Local).Unix()
+		if snapshots[1].Timestamp != want {
+			t.Errorf("expected timestamp %d, got %d", want, snapshots[1].Timestamp)
+		}
+
+		// Only backups containing the path are listed
+		snapshots, err = s.ListSnapshots(snapshotPath("Macintosh HD/added.txt", ""))
+		if err != nil || len(snapshots) != 1 {
+			t.Errorf("expected 1 snapshot, got %+v %v", snapshots, err)
+		}
+	})
+
+	t.Run("latest is current", func(t *testing.T) {
+		if got := readAll(t, s, snapshotPath("Macintosh HD/notes.txt", "")); got != "new" {
+			t.Errorf("expected latest content, got %q", got)
+		}
+	})
+
+	t.Run("read snapshot", func(t *testing.T) {
+		if got := readAll(t, s, snapshotPath("Macintosh HD/notes.txt", "tm:2025-11-08-120000")); got != "old" {
+			t.Errorf("expected old content, got %q", got)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		nodes, err := s.ListContents(snapshotPath("Macintosh HD", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 2 {
+			t.Fatalf("expected 2 nodes, got %+v", nodes)
+		}
+		for _, node := range nodes {
+			if node.Type != "file" || node.Path.Scheme != "timemachine" {
+				t.Errorf("unexpected node %+v", node)
+			}
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := s.FileSize(snapshotPath("Macintosh HD/added.txt", "tm:2025-11-08-120000"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist, got %v", err)
+		}
+		_, err = s.FileSize(snapshotPath("Macintosh HD/notes.txt", "tm:2020-01-01-000000"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist for unknown backup, got %v", err)
+		}
+		_, err = s.FileSize(snapshotPath("../../../etc/passwd", ""))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected not exist for escaping path, got %v", err)
+		}
+	})
+}
+
+func TestDirectoryHardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory hard links are only resolved on Unix")
+	}
+
+	root := t.TempDir()
+	backup := filepath.Join(root, backupDB, "MacBook", "2025-11-09-120000", "Macintosh HD")
+
+	// An empty file with 3 links stands for the directory dir_3
+	link := filepath.Join(backup, "Users")
+	writeFile(t, link, "")
+	os.MkdirAll(filepath.Join(root, "links"), 0755)
+	os.Link(link, filepath.Join(root, "links", "a"))
+	os.Link(link, filepath.Join(root, "links", "b"))
+	writeFile(t, filepath.Join(root, privateDirData, "dir_3", "report.txt"), "linked")
+
+	s, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	nodes, err := s.ListContents(snapshotPath("Macintosh HD", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Type != "dir" {
+		t.Fatalf("expected Users to be listed as a directory, got %+v", nodes)
+	}
+
+	if got := readAll(t, s, snapshotPath("Macintosh HD/Users/report.txt", "")); got != "linked" {
+		t.Errorf("expected linked content, got %q", got)
+	}
+
+	exists, err := s.DirectoryExists(snapshotPath("Macintosh HD/Users", ""))
+	if err != nil || !exists {
+		t.Errorf("expected Users to exist as a directory, got %v %v", exists, err)
+	}
+}
+
+func TestAPFSBackups(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "2025-11-08-120000.backup", "2025-11-08-120000.backup", "Data", "a.txt"), "old")
+	writeFile(t, filepath.Join(root, "2025-11-09-120000.backup", "2025-11-09-120000.backup", "Data", "a.txt"), "new")
+	os.MkdirAll(filepath.Join(root, "not-a-backup"), 0755)
+
+	s, err := NewWithConfig(root, Config{Name: "tm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	snapshots, err := s.ListSnapshots(url.URL{Scheme: "tm", Path: "Data/a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Name != "2025-11-09-120000" {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+
+	nodes, err := s.ListContents(url.URL{Scheme: "tm", RawQuery: "snapshot=tm:2025-11-08-120000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Basename != "Data" || nodes[0].Path.Scheme != "tm" {
+		t.Errorf("unexpected nodes %+v", nodes)
+	}
+
+	var store storage.Storage = s
+	if _, ok := store.(storage.Writer); ok {
+		t.Error("expected Time Machine storage to be read-only")
+	}
+}
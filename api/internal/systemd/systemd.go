@@ -0,0 +1,67 @@
+// Package systemd tells systemd about the state of a service with the
+// sd_notify protocol, so units of Type=notify know when the service is ready
+// and units with WatchdogSec= can restart it once it stops responding.
+//
+// Outside of systemd, NOTIFY_SOCKET isn't set and notifying does nothing.
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notifications understood by systemd
+const (
+	// Ready tells that the service finished starting up
+	Ready = "READY=1"
+	// Reloading tells that the service reloads its config, followed by
+	// Ready once done
+	Reloading = "RELOADING=1"
+	// Stopping tells that the service is shutting down
+	Stopping = "STOPPING=1"
+	// Watchdog keeps the watchdog from restarting the service
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends the state to systemd, e.g. Ready. Returns false without an
+// error if the service isn't run by systemd with notifications enabled.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// Sockets starting with @ are in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("notify systemd: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("notify systemd: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often systemd expects Watchdog notifications,
+// zero if the watchdog is disabled or meant for another process
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid WATCHDOG_USEC: " + usec)
+	}
+	return time.Duration(n) * time.Microsecond, nil
+}
@@ -0,0 +1,74 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Run("without systemd", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+		if sent, err := Notify(Ready); sent || err != nil {
+			t.Errorf("expected nothing to be sent, got %v, %v", sent, err)
+		}
+	})
+
+	t.Run("sends state", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "notify.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		if err != nil {
+			t.Skipf("unix datagram sockets not supported: %v", err)
+		}
+		defer conn.Close()
+		t.Setenv("NOTIFY_SOCKET", path)
+
+		for _, state := range []string{Ready, Watchdog} {
+			if sent, err := Notify(state); !sent || err != nil {
+				t.Fatalf("expected %s to be sent, got %v, %v", state, sent, err)
+			}
+			buf := make([]byte, 64)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(buf)
+			if err != nil || string(buf[:n]) != state {
+				t.Errorf("expected %q, got %q, %v", state, buf[:n], err)
+			}
+		}
+	})
+
+	t.Run("missing socket", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+		if sent, err := Notify(Ready); sent || err == nil {
+			t.Errorf("expected an error, got %v, %v", sent, err)
+		}
+	})
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", usec: "30000000", want: 30 * time.Second},
+		{name: "this process", usec: "2000000", pid: strconv.Itoa(os.Getpid()), want: 2 * time.Second},
+		{name: "other process", usec: "2000000", pid: "1"},
+		{name: "invalid", usec: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			got, err := WatchdogInterval()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("got %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+// Package tags stores the tags and bookmarks users put on nodes in SQLite.
+//
+// Tags and bookmarks belong to the user that created them. Nodes are stored
+// by storage and path together with an identity that survives renames, like
+// the inode of a local file, so nodes renamed outside of the API can be
+// found again. Renames through the API move the stored paths directly.
+package tags
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+	"unicode"
+
+	"timeship/internal/state"
+)
+
+// migrations create the tags and bookmarks tables
+var migrations = []string{`
+CREATE TABLE IF NOT EXISTS tags (
+	owner      TEXT NOT NULL,
+	tag        TEXT NOT NULL,
+	storage    TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	identity   TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (owner, storage, path, tag)
+);
+CREATE INDEX IF NOT EXISTS tags_tag ON tags (owner, tag);
+CREATE INDEX IF NOT EXISTS tags_path ON tags (storage, path);
+CREATE TABLE IF NOT EXISTS bookmarks (
+	id         TEXT NOT NULL PRIMARY KEY,
+	owner      TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	storage    TEXT NOT NULL,
+	path       TEXT NOT NULL,
+	identity   TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS bookmarks_owner ON bookmarks (owner);
+CREATE INDEX IF NOT EXISTS bookmarks_path ON bookmarks (storage, path);
+`}
+
+// maxTagLength is the maximum length of a tag in bytes
+const maxTagLength = 100
+
+// Node identifies a tagged or bookmarked node
+type Node struct {
+	// Storage is the name of the storage of the node
+	Storage string
+
+	// Path is the path of the node relative to the storage root
+	Path string
+
+	// Identity stays the same when the node is renamed, e.g. its inode,
+	// empty if the storage can't tell
+	Identity string
+}
+
+// TagCount is a tag and the number of nodes it's on
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// Bookmark is a node bookmarked by a user
+type Bookmark struct {
+	Node
+
+	// ID identifies the bookmark, e.g. to delete it
+	ID string
+
+	// Owner is the name of the user that created the bookmark
+	Owner string
+
+	// Name is shown instead of the path
+	Name string
+
+	// CreatedAt is when the bookmark was created as a Unix timestamp
+	CreatedAt int64
+}
+
+// Store stores tags and bookmarks in a SQLite database
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens or creates the tag database at the given path
+func Open(path string) (*Store, error) {
+	db, err := state.Open(path, "tags", migrations, state.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open tag database: %w", err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// ValidTag reports whether a tag can be stored. Tags are short, have no
+// slashes, so they can be part of a URL path, and no surrounding spaces or
+// control characters.
+func ValidTag(tag string) bool {
+	if tag == "" || len(tag) > maxTagLength || strings.TrimSpace(tag) != tag {
+		return false
+	}
+	return !strings.ContainsFunc(tag, func(r rune) bool {
+		return r == '/' || unicode.IsControl(r)
+	})
+}
+
+// Tag puts a tag on a node, updating the identity of the node if it's
+// already tagged
+func (s *Store) Tag(owner, tag string, node Node) error {
+	_, err := s.db.Exec(`INSERT INTO tags (owner, tag, storage, path, identity, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (owner, storage, path, tag) DO UPDATE SET identity = excluded.identity`,
+		owner, tag, node.Storage, node.Path, node.Identity, s.now().Unix())
+	return err
+}
+
+// Untag removes a tag from a node, failing with fs.ErrNotExist if the node
+// doesn't have the tag
+func (s *Store) Untag(owner, tag, storage, path string) error {
+	result, err := s.db.Exec(`DELETE FROM tags WHERE owner = ? AND tag = ? AND storage = ? AND path = ?`, owner, tag, storage, path)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("tag %s: %w", tag, fs.ErrNotExist)
+	}
+	return nil
+}
+
+// NodeTags returns the tags of a user on a node in name order
+func (s *Store) NodeTags(owner, storage, path string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT tag FROM tags WHERE owner = ? AND storage = ? AND path = ? ORDER BY tag`, owner, storage, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// Tags returns the tags of a user with the number of nodes they're on, in
+// name order
+func (s *Store) Tags(owner string) ([]TagCount, error) {
+	rows, err := s.db.Query(`SELECT tag, COUNT(*) FROM tags WHERE owner = ? GROUP BY tag ORDER BY tag`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []TagCount{}
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Tag, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Tagged returns the nodes a user put a tag on, ordered by storage and path
+func (s *Store) Tagged(owner, tag string) ([]Node, error) {
+	rows, err := s.db.Query(`SELECT storage, path, identity FROM tags WHERE owner = ? AND tag = ? ORDER BY storage, path`, owner, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []Node{}
+	for rows.Next() {
+		var n Node
+		if err := rows.Scan(&n.Storage, &n.Path, &n.Identity); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
+
+// AddBookmark bookmarks a node for a user
+func (s *Store) AddBookmark(owner, name string, node Node) (Bookmark, error) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	b := Bookmark{
+		Node:      node,
+		ID:        hex.EncodeToString(id),
+		Owner:     owner,
+		Name:      name,
+		CreatedAt: s.now().Unix(),
+	}
+	_, err := s.db.Exec(`INSERT INTO bookmarks (id, owner, name, storage, path, identity, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		b.ID, b.Owner, b.Name, b.Storage, b.Path, b.Identity, b.CreatedAt)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	return b, nil
+}
+
+// Bookmarks returns the bookmarks of a user, oldest first
+func (s *Store) Bookmarks(owner string) ([]Bookmark, error) {
+	rows, err := s.db.Query(`SELECT id, owner, name, storage, path, identity, created_at FROM bookmarks
+		WHERE owner = ? ORDER BY created_at, id`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.ID, &b.Owner, &b.Name, &b.Storage, &b.Path, &b.Identity, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// DeleteBookmark deletes a bookmark of a user, failing with fs.ErrNotExist
+// if the user has no bookmark with the ID
+func (s *Store) DeleteBookmark(owner, id string) error {
+	result, err := s.db.Exec(`DELETE FROM bookmarks WHERE owner = ? AND id = ?`, owner, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("bookmark %s: %w", id, fs.ErrNotExist)
+	}
+	return nil
+}
+
+// Move moves the tags and bookmarks of all users from a node and the nodes
+// below it to another path, after the node was renamed or moved. Tags
+// already on the destination are kept.
+func (s *Store) Move(storage, from, to string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Paths below the node keep their part after it. SQLite counts
+	// characters, not bytes, so lengths are taken in SQL.
+	for _, query := range []string{
+		`UPDATE OR REPLACE tags SET path = ?1 || substr(path, length(?2) + 1)
+			WHERE storage = ?3 AND (path = ?2 OR substr(path, 1, length(?4)) = ?4)`,
+		`UPDATE bookmarks SET path = ?1 || substr(path, length(?2) + 1)
+			WHERE storage = ?3 AND (path = ?2 OR substr(path, 1, length(?4)) = ?4)`,
+	} {
+		if _, err := tx.Exec(query, to, from, storage, from+"/"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TagRecord is a tag on a node, to move tags to another database. Nodes
+// are only moved by path, as identities like inodes don't carry over.
+type TagRecord struct {
+	Owner     string `json:"owner"`
+	Tag       string `json:"tag"`
+	Storage   string `json:"storage"`
+	Path      string `json:"path"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// BookmarkRecord is a bookmark, to move bookmarks to another database
+type BookmarkRecord struct {
+	ID        string `json:"id"`
+	Owner     string `json:"owner"`
+	Name      string `json:"name"`
+	Storage   string `json:"storage"`
+	Path      string `json:"path"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Export returns the tags and bookmarks of all users
+func (s *Store) Export() ([]TagRecord, []BookmarkRecord, error) {
+	rows, err := s.db.Query(`SELECT owner, tag, storage, path, created_at FROM tags ORDER BY owner, tag, storage, path`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	tags := []TagRecord{}
+	for rows.Next() {
+		var t TagRecord
+		if err := rows.Scan(&t.Owner, &t.Tag, &t.Storage, &t.Path, &t.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT id, owner, name, storage, path, created_at FROM bookmarks ORDER BY created_at, id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	bookmarks := []BookmarkRecord{}
+	for rows.Next() {
+		var b BookmarkRecord
+		if err := rows.Scan(&b.ID, &b.Owner, &b.Name, &b.Storage, &b.Path, &b.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return tags, bookmarks, rows.Err()
+}
+
+// Import adds exported tags and bookmarks without identities. Tags already
+// on a node and bookmarks with an ID that's already stored are skipped.
+// Returns how many tags and bookmarks were added.
+func (s *Store) Import(tags []TagRecord, bookmarks []BookmarkRecord) (int, int, error) {
+	for _, t := range tags {
+		if !ValidTag(t.Tag) || t.Owner == "" || t.Storage == "" {
+			return 0, 0, fmt.Errorf("tag %q on %s://%s: invalid tag", t.Tag, t.Storage, t.Path)
+		}
+	}
+	for _, b := range bookmarks {
+		if b.ID == "" || b.Owner == "" || b.Storage == "" {
+			return 0, 0, fmt.Errorf("bookmark %q: missing ID, owner or storage", b.ID)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	added := func(result sql.Result) int {
+		n, _ := result.RowsAffected()
+		return int(n)
+	}
+	addedTags, addedBookmarks := 0, 0
+	for _, t := range tags {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO tags (owner, tag, storage, path, identity, created_at) VALUES (?, ?, ?, ?, '', ?)`,
+			t.Owner, t.Tag, t.Storage, t.Path, t.CreatedAt)
+		if err != nil {
+			return 0, 0, err
+		}
+		addedTags += added(result)
+	}
+	for _, b := range bookmarks {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO bookmarks (id, owner, name, storage, path, identity, created_at) VALUES (?, ?, ?, ?, ?, '', ?)`,
+			b.ID, b.Owner, b.Name, b.Storage, b.Path, b.CreatedAt)
+		if err != nil {
+			return 0, 0, err
+		}
+		addedBookmarks += added(result)
+	}
+	return addedTags, addedBookmarks, tx.Commit()
+}
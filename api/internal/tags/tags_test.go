@@ -0,0 +1,180 @@
+package tags
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "tags.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	for _, tagged := range []struct {
+		owner, tag, path string
+	}{
+		{"alice", "taxes", "docs/taxes.pdf"},
+		{"alice", "2024", "docs/taxes.pdf"},
+		{"alice", "2024", "docs"},
+		{"alice", "2024", "docs-old/a.txt"},
+		{"bob", "taxes", "docs/taxes.pdf"},
+	} {
+		if err := store.Tag(tagged.owner, tagged.tag, Node{Storage: "local", Path: tagged.path, Identity: "1:" + tagged.path}); err != nil {
+			t.Fatalf("Tag failed: %v", err)
+		}
+	}
+	// Tagging again only updates the identity
+	if err := store.Tag("alice", "taxes", Node{Storage: "local", Path: "docs/taxes.pdf", Identity: "2:taxes"}); err != nil {
+		t.Fatalf("Tag failed: %v", err)
+	}
+
+	t.Run("node tags", func(t *testing.T) {
+		nodeTags, err := store.NodeTags("alice", "local", "docs/taxes.pdf")
+		if err != nil || !slices.Equal(nodeTags, []string{"2024", "taxes"}) {
+			t.Errorf("expected alice's tags, got %v, %v", nodeTags, err)
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		counts, err := store.Tags("alice")
+		if err != nil || !slices.Equal(counts, []TagCount{{"2024", 3}, {"taxes", 1}}) {
+			t.Errorf("unexpected counts %v, %v", counts, err)
+		}
+	})
+
+	t.Run("tagged", func(t *testing.T) {
+		nodes, err := store.Tagged("alice", "taxes")
+		if err != nil || len(nodes) != 1 || nodes[0] != (Node{Storage: "local", Path: "docs/taxes.pdf", Identity: "2:taxes"}) {
+			t.Errorf("unexpected nodes %+v, %v", nodes, err)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		if err := store.Tag("alice", "2024", Node{Storage: "local", Path: "papers/taxes.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Move("local", "docs", "papers"); err != nil {
+			t.Fatalf("Move failed: %v", err)
+		}
+		nodes, err := store.Tagged("alice", "2024")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, n := range nodes {
+			paths = append(paths, n.Path)
+		}
+		// Siblings with the same prefix stay, tags already at the destination
+		// are kept once
+		if !slices.Equal(paths, []string{"docs-old/a.txt", "papers", "papers/taxes.pdf"}) {
+			t.Errorf("unexpected paths %v", paths)
+		}
+		if nodes, _ := store.Tagged("bob", "taxes"); len(nodes) != 1 || nodes[0].Path != "papers/taxes.pdf" {
+			t.Errorf("expected tags of all users to move, got %+v", nodes)
+		}
+	})
+
+	t.Run("move non-ASCII paths", func(t *testing.T) {
+		store.Tag("alice", "photos", Node{Storage: "local", Path: "fotos/größe/ö.jpg"})
+		if err := store.Move("local", "fotos/größe", "fotos/groß"); err != nil {
+			t.Fatal(err)
+		}
+		if nodes, _ := store.Tagged("alice", "photos"); len(nodes) != 1 || nodes[0].Path != "fotos/groß/ö.jpg" {
+			t.Errorf("unexpected nodes %+v", nodes)
+		}
+	})
+
+	t.Run("untag", func(t *testing.T) {
+		if err := store.Untag("alice", "taxes", "local", "papers/taxes.pdf"); err != nil {
+			t.Fatalf("Untag failed: %v", err)
+		}
+		if err := store.Untag("alice", "taxes", "local", "papers/taxes.pdf"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected fs.ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("bookmarks", func(t *testing.T) {
+		b, err := store.AddBookmark("alice", "Taxes", Node{Storage: "local", Path: "papers"})
+		if err != nil {
+			t.Fatalf("AddBookmark failed: %v", err)
+		}
+		if b.ID == "" || b.CreatedAt != now.Unix() {
+			t.Errorf("unexpected bookmark %+v", b)
+		}
+		if err := store.Move("local", "papers", "archive/papers"); err != nil {
+			t.Fatal(err)
+		}
+		bookmarks, err := store.Bookmarks("alice")
+		if err != nil || len(bookmarks) != 1 || bookmarks[0].Path != "archive/papers" || bookmarks[0].Name != "Taxes" {
+			t.Errorf("unexpected bookmarks %+v, %v", bookmarks, err)
+		}
+		if err := store.DeleteBookmark("bob", b.ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected bob not to delete alice's bookmark, got %v", err)
+		}
+		if err := store.DeleteBookmark("alice", b.ID); err != nil {
+			t.Errorf("DeleteBookmark failed: %v", err)
+		}
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		if _, err := store.AddBookmark("bob", "Photos", Node{Storage: "local", Path: "fotos", Identity: "1:fotos"}); err != nil {
+			t.Fatal(err)
+		}
+		tagRecords, bookmarks, err := store.Export()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tagRecords) == 0 || len(bookmarks) != 1 || bookmarks[0].Path != "fotos" {
+			t.Fatalf("unexpected export %+v, %+v", tagRecords, bookmarks)
+		}
+
+		other, err := Open(filepath.Join(t.TempDir(), "other.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		nTags, nBookmarks, err := other.Import(tagRecords, bookmarks)
+		if err != nil || nTags != len(tagRecords) || nBookmarks != 1 {
+			t.Fatalf("expected all records to be imported, got %d, %d, %v", nTags, nBookmarks, err)
+		}
+		if nTags, nBookmarks, err := other.Import(tagRecords, bookmarks); err != nil || nTags != 0 || nBookmarks != 0 {
+			t.Errorf("expected imported records to be skipped, got %d, %d, %v", nTags, nBookmarks, err)
+		}
+		nodes, err := other.Tagged("bob", "taxes")
+		if err != nil || len(nodes) != 1 || nodes[0].Path != "archive/papers/taxes.pdf" || nodes[0].Identity != "" {
+			t.Errorf("expected tags to be imported by path, got %+v, %v", nodes, err)
+		}
+		if _, _, err := other.Import([]TagRecord{{Owner: "bob", Tag: "bad/tag", Storage: "local"}}, nil); err == nil {
+			t.Error("expected invalid tag to be rejected")
+		}
+	})
+}
+
+func TestValidTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{"taxes", true},
+		{"tax return 2024", true},
+		{"größe", true},
+		{"", false},
+		{" taxes", false},
+		{"a/b", false},
+		{"a\nb", false},
+		{string(make([]byte, 101)), false},
+	}
+	for _, tt := range tests {
+		if got := ValidTag(tt.tag); got != tt.want {
+			t.Errorf("ValidTag(%q) = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
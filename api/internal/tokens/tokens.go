@@ -0,0 +1,274 @@
+// Package tokens stores API tokens issued at runtime in SQLite.
+//
+// Tokens belong to the configured user that created them and grant a subset
+// of that user's rules until they expire or are revoked, so they can be
+// rotated without editing the config and restarting. Only the SHA-256 of
+// each token is stored, the token itself is only returned when it's created.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/state"
+)
+
+// migrations create the tokens table. Rules are stored as JSON.
+var migrations = []string{`
+CREATE TABLE IF NOT EXISTS tokens (
+	id         TEXT NOT NULL PRIMARY KEY,
+	owner      TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	hash       TEXT NOT NULL UNIQUE,
+	rules      TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tokens_owner ON tokens (owner);
+`}
+
+// Prefix starts all issued tokens, so they're easy to recognize, e.g. by
+// secret scanners
+const Prefix = "tst_"
+
+// Token describes an issued token
+type Token struct {
+	// ID identifies the token, e.g. to revoke it
+	ID string
+
+	// Owner is the name of the user that created the token
+	Owner string
+
+	// Name describes what the token is used for
+	Name string
+
+	// Rules grant the token permissions
+	Rules []access.Rule
+
+	// CreatedAt is when the token was created as a Unix timestamp
+	CreatedAt int64
+
+	// ExpiresAt is when the token expires as a Unix timestamp, zero if it
+	// never does
+	ExpiresAt int64
+}
+
+// storedRule is the JSON representation of a rule
+type storedRule struct {
+	Path  string   `json:"path"`
+	Allow []string `json:"allow"`
+}
+
+// Store stores issued tokens in a SQLite database
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens or creates the token database at the given path
+func Open(path string) (*Store, error) {
+	db, err := state.Open(path, "tokens", migrations, state.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open token database: %w", err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// hash returns the hex encoded SHA-256 of a token
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a token and returns it together with its description.
+// Expired tokens are removed along the way.
+func (s *Store) Create(owner, name string, rules []access.Rule, expiresAt int64) (Token, string, error) {
+	secret := make([]byte, 32)
+	id := make([]byte, 8)
+	rand.Read(secret)
+	rand.Read(id)
+	token := Prefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	stored := make([]storedRule, len(rules))
+	for i, rule := range rules {
+		stored[i] = storedRule{Path: rule.String(), Allow: rule.Permissions}
+	}
+	rulesJSON, err := json.Marshal(stored)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	t := Token{
+		ID:        hex.EncodeToString(id),
+		Owner:     owner,
+		Name:      name,
+		Rules:     rules,
+		CreatedAt: s.now().Unix(),
+		ExpiresAt: expiresAt,
+	}
+	if _, err := s.db.Exec(`DELETE FROM tokens WHERE expires_at > 0 AND expires_at <= ?`, t.CreatedAt); err != nil {
+		return Token{}, "", err
+	}
+	_, err = s.db.Exec(`INSERT INTO tokens (id, owner, name, hash, rules, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Owner, t.Name, hash(token), string(rulesJSON), t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return Token{}, "", err
+	}
+	return t, token, nil
+}
+
+// List returns the tokens of a user that haven't expired, oldest first
+func (s *Store) List(owner string) ([]Token, error) {
+	rows, err := s.db.Query(`SELECT id, owner, name, rules, created_at, expires_at FROM tokens
+		WHERE owner = ? AND (expires_at = 0 OR expires_at > ?) ORDER BY created_at, id`, owner, s.now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		var t Token
+		var rulesJSON string
+		if err := rows.Scan(&t.ID, &t.Owner, &t.Name, &rulesJSON, &t.CreatedAt, &t.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if t.Rules, err = parseRules(rulesJSON); err != nil {
+			return nil, fmt.Errorf("token %s: %w", t.ID, err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke deletes a token of a user, failing with fs.ErrNotExist if the user
+// has no token with the ID
+func (s *Store) Revoke(owner, id string) error {
+	result, err := s.db.Exec(`DELETE FROM tokens WHERE owner = ? AND id = ?`, owner, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("token %s: %w", id, fs.ErrNotExist)
+	}
+	return nil
+}
+
+// Lookup implements access.Issuer
+func (s *Store) Lookup(token string) (*access.IssuedToken, error) {
+	var owner, name, rulesJSON string
+	err := s.db.QueryRow(`SELECT owner, name, rules FROM tokens WHERE hash = ? AND (expires_at = 0 OR expires_at > ?)`,
+		hash(token), s.now().Unix()).Scan(&owner, &name, &rulesJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseRules(rulesJSON)
+	if err != nil {
+		return nil, err
+	}
+	return &access.IssuedToken{Owner: owner, Name: name, Rules: rules}, nil
+}
+
+// parseRules parses the JSON representation of rules
+func parseRules(rulesJSON string) ([]access.Rule, error) {
+	var stored []storedRule
+	if err := json.Unmarshal([]byte(rulesJSON), &stored); err != nil {
+		return nil, err
+	}
+	rules := make([]access.Rule, len(stored))
+	for i, sr := range stored {
+		rule, err := access.ParseRule(sr.Path, sr.Allow)
+		if err != nil {
+			return nil, err
+		}
+		rules[i] = rule
+	}
+	return rules, nil
+}
+
+// Record is a token as stored, with the hash of its secret instead of the
+// secret, to move tokens to another database
+type Record struct {
+	ID        string          `json:"id"`
+	Owner     string          `json:"owner"`
+	Name      string          `json:"name"`
+	Hash      string          `json:"hash"`
+	Rules     json.RawMessage `json:"rules"`
+	CreatedAt int64           `json:"created_at"`
+	ExpiresAt int64           `json:"expires_at"`
+}
+
+// Export returns all tokens that haven't expired, oldest first
+func (s *Store) Export() ([]Record, error) {
+	rows, err := s.db.Query(`SELECT id, owner, name, hash, rules, created_at, expires_at FROM tokens
+		WHERE expires_at = 0 OR expires_at > ? ORDER BY created_at, id`, s.now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		var rulesJSON string
+		if err := rows.Scan(&r.ID, &r.Owner, &r.Name, &r.Hash, &rulesJSON, &r.CreatedAt, &r.ExpiresAt); err != nil {
+			return nil, err
+		}
+		r.Rules = json.RawMessage(rulesJSON)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Import adds exported tokens, so they keep working with the same secrets.
+// Tokens with an ID or secret that's already stored are skipped. Returns
+// how many tokens were added.
+func (s *Store) Import(records []Record) (int, error) {
+	for _, r := range records {
+		if r.ID == "" || r.Owner == "" {
+			return 0, fmt.Errorf("token %q: missing ID or owner", r.ID)
+		}
+		if b, err := hex.DecodeString(r.Hash); err != nil || len(b) != sha256.Size {
+			return 0, fmt.Errorf("token %s: invalid hash", r.ID)
+		}
+		if _, err := parseRules(string(r.Rules)); err != nil {
+			return 0, fmt.Errorf("token %s: %w", r.ID, err)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	added := 0
+	for _, r := range records {
+		result, err := tx.Exec(`INSERT OR IGNORE INTO tokens (id, owner, name, hash, rules, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.Owner, r.Name, r.Hash, string(r.Rules), r.CreatedAt, r.ExpiresAt)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			added += int(n)
+		}
+	}
+	return added, tx.Commit()
+}
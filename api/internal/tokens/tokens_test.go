@@ -0,0 +1,129 @@
+package tokens
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"timeship/internal/access"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	rule, err := access.ParseRule("local://public/**", []string{access.Read})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, token, err := store.Create("alice", "backup job", []access.Rule{rule}, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(token, Prefix) || created.ID == "" || created.CreatedAt != now.Unix() {
+		t.Errorf("unexpected token %q %+v", token, created)
+	}
+	expiring, expiringToken, err := store.Create("alice", "expiring", []access.Rule{rule}, now.Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, _, err := store.Create("bob", "other", []access.Rule{rule}, 0); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	t.Run("only hashes are stored", func(t *testing.T) {
+		var count int
+		store.db.QueryRow(`SELECT COUNT(*) FROM tokens WHERE hash = ? OR id = ?`, token, token).Scan(&count)
+		if count != 0 {
+			t.Error("expected token not to be stored")
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		issued, err := store.Lookup(token)
+		if err != nil || issued == nil {
+			t.Fatalf("expected token, got %v, %v", issued, err)
+		}
+		if issued.Owner != "alice" || issued.Name != "backup job" || len(issued.Rules) != 1 || issued.Rules[0].String() != "local://public/**" {
+			t.Errorf("unexpected token %+v", issued)
+		}
+		if issued, err := store.Lookup(Prefix + "unknown"); issued != nil || err != nil {
+			t.Errorf("expected unknown token to be missing, got %v, %v", issued, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		tokens, err := store.List("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 2 || tokens[0].Name != "backup job" || tokens[1].ExpiresAt != expiring.ExpiresAt {
+			t.Errorf("expected alice's tokens, got %+v", tokens)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		if issued, err := store.Lookup(expiringToken); issued != nil || err != nil {
+			t.Errorf("expected expired token to be missing, got %v, %v", issued, err)
+		}
+		if tokens, err := store.List("alice"); err != nil || len(tokens) != 1 {
+			t.Errorf("expected expired token not to be listed, got %+v, %v", tokens, err)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		if err := store.Revoke("bob", created.ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected other users' tokens not to be found, got %v", err)
+		}
+		if err := store.Revoke("alice", created.ID); err != nil {
+			t.Fatalf("Revoke failed: %v", err)
+		}
+		if issued, err := store.Lookup(token); issued != nil || err != nil {
+			t.Errorf("expected revoked token to be missing, got %v, %v", issued, err)
+		}
+		if err := store.Revoke("alice", created.ID); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected revoked token not to be found, got %v", err)
+		}
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		records, err := store.Export()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Revoked and expired tokens aren't exported
+		if len(records) != 1 || records[0].Owner != "bob" {
+			t.Fatalf("expected bob's token, got %+v", records)
+		}
+
+		other, err := Open(filepath.Join(t.TempDir(), "other.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		if n, err := other.Import(records); err != nil || n != 1 {
+			t.Fatalf("expected 1 token to be imported, got %d, %v", n, err)
+		}
+		if n, err := other.Import(records); err != nil || n != 0 {
+			t.Errorf("expected imported token to be skipped, got %d, %v", n, err)
+		}
+		if tokens, err := other.List("bob"); err != nil || len(tokens) != 1 || tokens[0].ID != records[0].ID {
+			t.Errorf("expected imported token to be listed, got %+v, %v", tokens, err)
+		}
+
+		invalid := records[0]
+		invalid.ID, invalid.Hash = "invalid", "not-a-hash"
+		if _, err := other.Import([]Record{invalid}); err == nil {
+			t.Error("expected invalid hash to be rejected")
+		}
+	})
+}
@@ -0,0 +1,298 @@
+// Package webhook notifies external services of activity with HTTP POSTs.
+//
+// Events are sent as JSON in the background, so slow or unreachable
+// receivers never hold up requests. Other sinks, like email, receive the
+// same events through the Sender interface. Failed deliveries are retried a few
+// times, then dropped. Payloads of hooks with a secret are signed with
+// HMAC-SHA256 in the X-Timeship-Signature header, as "sha256=" and the hex
+// digest of the body, so receivers can check they came from timeship.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	// UploadCompleted is sent when a file upload was stored
+	UploadCompleted = "upload.completed"
+
+	// NodeDeleted is sent when a file or directory was deleted or trashed
+	NodeDeleted = "node.deleted"
+
+	// NodeRestored is sent when a node was restored from a snapshot or the
+	// trash
+	NodeRestored = "node.restored"
+
+	// SnapshotCreated is sent when a snapshot was created
+	SnapshotCreated = "snapshot.created"
+
+	// IndexFinished is sent when indexing a snapshot into the metadata cache
+	// finished, with an error if it failed
+	IndexFinished = "index.finished"
+
+	// JobFailed is sent when a background job like an export failed
+	JobFailed = "job.failed"
+
+	// SnapshotMissing is sent when the newest snapshot of a storage is older
+	// than expected
+	SnapshotMissing = "snapshot.missing"
+
+	// StorageAdded is sent when a storage was added, e.g. because a drive
+	// was mounted
+	StorageAdded = "storage.added"
+
+	// StorageRemoved is sent when a storage was removed, e.g. because its
+	// drive was unmounted
+	StorageRemoved = "storage.removed"
+)
+
+// Events lists all event types
+var Events = []string{UploadCompleted, NodeDeleted, NodeRestored, SnapshotCreated, IndexFinished, JobFailed, SnapshotMissing, StorageAdded, StorageRemoved}
+
+// queueSize is how many events wait for delivery before new ones are dropped
+const queueSize = 256
+
+// defaultTimeout limits each delivery attempt
+const defaultTimeout = 10 * time.Second
+
+// retryDelays are the waits before retrying failed deliveries
+var retryDelays = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// Event is the JSON payload of a notification
+type Event struct {
+	// Type is one of the event types, e.g. "node.deleted"
+	Type string `json:"event"`
+
+	// Time is when the event happened
+	Time time.Time `json:"time"`
+
+	// Storage is the name of the storage the event happened in
+	Storage string `json:"storage,omitempty"`
+
+	// Path is the path of the node relative to the storage root
+	Path string `json:"path,omitempty"`
+
+	// Snapshot is the ID of the snapshot involved, e.g. the one a node was
+	// restored from
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// Destination is where a node was restored to
+	Destination string `json:"destination,omitempty"`
+
+	// Job is the ID of the job involved, e.g. the one that failed
+	Job string `json:"job,omitempty"`
+
+	// Since is when the newest snapshot was taken for missing snapshots
+	Since *time.Time `json:"since,omitempty"`
+
+	// Error describes why the operation failed
+	Error string `json:"error,omitempty"`
+}
+
+// Hook is a receiver of events
+type Hook struct {
+	// URL receives events as POST requests
+	URL string
+
+	// Secret signs payloads if set
+	Secret string
+
+	// Events limits the event types sent, all are sent if empty
+	Events []string
+
+	// Timeout limits each delivery attempt, defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// Sender delivers events other than by webhook, e.g. as email
+type Sender interface {
+	Send(ctx context.Context, event Event) error
+}
+
+// Sink is a receiver of events other than a webhook
+type Sink struct {
+	// Name describes the sink in logs, e.g. "ntfy https://ntfy.sh/backups"
+	Name string
+
+	Sender Sender
+
+	// Events limits the event types sent, all are sent if empty
+	Events []string
+}
+
+// Notifier delivers events to hooks and sinks in the background
+type Notifier struct {
+	hooks  []Hook
+	sinks  []Sink
+	client *http.Client
+	delays []time.Duration
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan Event
+	done   chan struct{}
+	stop   chan struct{}
+}
+
+// New creates a notifier for the hooks and starts delivering events
+func New(hooks []Hook) *Notifier {
+	return NewWithSinks(hooks, nil)
+}
+
+// NewWithSinks creates a notifier for hooks and other sinks and starts
+// delivering events
+func NewWithSinks(hooks []Hook, sinks []Sink) *Notifier {
+	n := &Notifier{
+		hooks:  hooks,
+		sinks:  sinks,
+		client: &http.Client{},
+		delays: retryDelays,
+		queue:  make(chan Event, queueSize),
+		done:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Notify queues an event for delivery. The time is set if it's zero.
+// Events are dropped if too many are waiting.
+func (n *Notifier) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		log.Printf("Dropped %s webhook event, too many are waiting", event.Type)
+	}
+}
+
+// Close delivers the waiting events until ctx is done and stops the
+// notifier. Retries are abandoned.
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		close(n.stop)
+		<-n.done
+		return ctx.Err()
+	}
+}
+
+// run delivers queued events one at a time, in order
+func (n *Notifier) run() {
+	defer close(n.done)
+	for event := range n.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Failed to encode %s webhook event: %v", event.Type, err)
+			continue
+		}
+		for _, hook := range n.hooks {
+			if len(hook.Events) > 0 && !slices.Contains(hook.Events, event.Type) {
+				continue
+			}
+			err := n.retry(func() error { return n.send(hook, event.Type, body) })
+			if err != nil {
+				log.Printf("Failed to deliver %s webhook to %s: %v", event.Type, hook.URL, err)
+			}
+		}
+		for _, sink := range n.sinks {
+			if len(sink.Events) > 0 && !slices.Contains(sink.Events, event.Type) {
+				continue
+			}
+			err := n.retry(func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+				defer cancel()
+				return sink.Sender.Send(ctx, event)
+			})
+			if err != nil {
+				log.Printf("Failed to deliver %s event to %s: %v", event.Type, sink.Name, err)
+			}
+		}
+	}
+}
+
+// retry makes delivery attempts until one succeeds or all retries failed
+func (n *Notifier) retry(send func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = send(); err == nil {
+			return nil
+		}
+		if attempt >= len(n.delays) {
+			return err
+		}
+		select {
+		case <-time.After(n.delays[attempt]):
+		case <-n.stop:
+			return err
+		}
+	}
+}
+
+// send makes one delivery attempt, which succeeds with any 2xx response
+func (n *Notifier) send(hook Hook, eventType string, body []byte) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "timeship-webhook")
+	req.Header.Set("X-Timeship-Event", eventType)
+	if hook.Secret != "" {
+		req.Header.Set("X-Timeship-Signature", Sign(hook.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature of a payload as sent in X-Timeship-Signature
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
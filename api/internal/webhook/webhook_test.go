@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver records the events posted to it
+type receiver struct {
+	mu       sync.Mutex
+	events   []Event
+	headers  []http.Header
+	bodies   [][]byte
+	failures int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var event Event
+	json.Unmarshal(body, &event)
+	rc.events = append(rc.events, event)
+	rc.headers = append(rc.headers, r.Header.Clone())
+	rc.bodies = append(rc.bodies, body)
+}
+
+// sender records the events sent to it
+type sender struct {
+	events   []Event
+	failures int
+}
+
+func (s *sender) Send(ctx context.Context, event Event) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestNotifier(t *testing.T) {
+	closeNotifier := func(t *testing.T, n *Notifier) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := n.Close(ctx); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	t.Run("signed delivery", func(t *testing.T) {
+		rc := &receiver{}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+
+		n := New([]Hook{{URL: srv.URL, Secret: "s3cret"}})
+		n.Notify(Event{Type: NodeDeleted, Storage: "local", Path: "docs/a.txt"})
+		closeNotifier(t, n)
+
+		if len(rc.events) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(rc.events))
+		}
+		event := rc.events[0]
+		if event.Type != NodeDeleted || event.Storage != "local" || event.Path != "docs/a.txt" || event.Time.IsZero() {
+			t.Errorf("unexpected event %+v", event)
+		}
+		if got := rc.headers[0].Get("X-Timeship-Event"); got != NodeDeleted {
+			t.Errorf("expected event header, got %q", got)
+		}
+		if got, want := rc.headers[0].Get("X-Timeship-Signature"), Sign("s3cret", rc.bodies[0]); got != want {
+			t.Errorf("expected signature %q, got %q", want, got)
+		}
+	})
+
+	t.Run("event filter", func(t *testing.T) {
+		all, deletes := &receiver{}, &receiver{}
+		allSrv, deleteSrv := httptest.NewServer(all), httptest.NewServer(deletes)
+		defer allSrv.Close()
+		defer deleteSrv.Close()
+
+		n := New([]Hook{{URL: allSrv.URL}, {URL: deleteSrv.URL, Events: []string{NodeDeleted}}})
+		n.Notify(Event{Type: UploadCompleted})
+		n.Notify(Event{Type: NodeDeleted})
+		closeNotifier(t, n)
+
+		if len(all.events) != 2 {
+			t.Errorf("expected all events, got %+v", all.events)
+		}
+		if len(deletes.events) != 1 || deletes.events[0].Type != NodeDeleted {
+			t.Errorf("expected only the delete, got %+v", deletes.events)
+		}
+		if all.headers[0].Get("X-Timeship-Signature") != "" {
+			t.Error("expected no signature without secret")
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		rc := &receiver{failures: 2}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+
+		n := New([]Hook{{URL: srv.URL}})
+		n.delays = []time.Duration{time.Millisecond, time.Millisecond}
+		n.Notify(Event{Type: SnapshotCreated})
+		closeNotifier(t, n)
+
+		if len(rc.events) != 1 {
+			t.Errorf("expected delivery after retries, got %d events", len(rc.events))
+		}
+	})
+
+	t.Run("sinks", func(t *testing.T) {
+		sender := &sender{failures: 1}
+		n := NewWithSinks(nil, []Sink{{Name: "test", Sender: sender, Events: []string{JobFailed}}})
+		n.delays = []time.Duration{time.Millisecond}
+		n.Notify(Event{Type: NodeDeleted})
+		n.Notify(Event{Type: JobFailed, Job: "abc"})
+		closeNotifier(t, n)
+
+		if len(sender.events) != 1 || sender.events[0].Job != "abc" {
+			t.Errorf("expected the failed job after a retry, got %+v", sender.events)
+		}
+	})
+
+	t.Run("close abandons retries", func(t *testing.T) {
+		rc := &receiver{failures: 100}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+
+		n := New([]Hook{{URL: srv.URL}})
+		n.delays = []time.Duration{time.Hour}
+		n.Notify(Event{Type: SnapshotCreated})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := n.Close(ctx); err == nil {
+			t.Error("expected error for undelivered events")
+		}
+		n.Notify(Event{Type: SnapshotCreated})
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"timeship/internal/config"
+	"timeship/internal/mdns"
+	"timeship/internal/middleware"
+)
+
+// listen opens the listener of lc, removing the stale socket file a previous
+// run left behind
+func listen(lc config.ListenerConfig) (net.Listener, error) {
+	path, ok := strings.CutPrefix(lc.Address, "unix:")
+	if !ok {
+		return net.Listen("tcp", lc.Address)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		// A socket nobody accepts on is stale
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use", path)
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// newHTTPServer returns a server of handler with the middleware and
+// certificate of lc, sharing the timeouts of cfg
+func newHTTPServer(cfg *config.Config, lc config.ListenerConfig, handler http.Handler) (*http.Server, error) {
+	if lc.ReadOnly {
+		handler = middleware.ReadOnly()(handler)
+	}
+	if lc.HSTS {
+		handler = middleware.HSTS()(handler)
+	}
+	srv := &http.Server{
+		Addr:         lc.Address,
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	if lc.TLSCert != "" {
+		// Load the certificate upfront, so a missing one fails startup
+		cert, err := tls.LoadX509KeyPair(lc.TLSCert, lc.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	return srv, nil
+}
+
+// serveHTTP serves srv on listener, with TLS if it has a certificate
+func serveHTTP(srv *http.Server, listener net.Listener) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(listener, "", "")
+	}
+	return srv.Serve(listener)
+}
+
+// advertise advertises the TCP listeners reachable from other hosts with
+// mDNS, as _http._tcp or _https._tcp services of the _timeship subtype
+func advertise(cfg *config.Config, listeners []config.ListenerConfig, netListeners []net.Listener, uiEmbedded bool) (*mdns.Server, error) {
+	instance := cfg.Branding.Name
+	if instance == "" {
+		host, _ := os.Hostname()
+		host, _, _ = strings.Cut(host, ".")
+		instance = "Timeship on " + host
+	}
+	path := "/"
+	if !uiEmbedded {
+		path = cfg.APIPrefix
+	}
+
+	var services []mdns.Service
+	ports := map[string]int{}
+	for i, lc := range listeners {
+		addr, ok := netListeners[i].Addr().(*net.TCPAddr)
+		if !ok || addr.IP.IsLoopback() {
+			continue
+		}
+		typ := "_http._tcp"
+		if lc.TLSCert != "" {
+			typ = "_https._tcp"
+		}
+		// Instances of the same type need different names
+		name := instance
+		if ports[typ]++; ports[typ] > 1 {
+			name = fmt.Sprintf("%s (%d)", instance, addr.Port)
+		}
+		services = append(services, mdns.Service{
+			Instance: name,
+			Type:     typ,
+			Subtypes: []string{"_timeship"},
+			Port:     uint16(addr.Port),
+			TXT:      []string{"path=" + path, "api=" + cfg.APIPrefix, "version=" + version},
+		})
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no listeners reachable from other hosts")
+	}
+	return mdns.Advertise(services...)
+}
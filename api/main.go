@@ -1,28 +1,26 @@
 package main
 
 import (
-	"context"
-	"flag"
 	"fmt"
 	"io"
-	"io/fs"
 	"log"
-	"mime"
-	"net"
-	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
-	"timeship/internal/api"
-	"timeship/internal/middleware"
-	"timeship/internal/network"
+	"timeship/internal/config"
+	"timeship/internal/metacache"
 	"timeship/internal/storage"
-	"timeship/internal/storage/local"
-
-	"github.com/joho/godotenv"
-	"github.com/lpar/gzipped"
+	"timeship/internal/storage/pinned"
+	"timeship/internal/storage/registry"
+
+	// Built-in storage types register themselves
+	_ "timeship/internal/storage/azure"
+	_ "timeship/internal/storage/b2"
+	_ "timeship/internal/storage/gcs"
+	_ "timeship/internal/storage/local"
+	_ "timeship/internal/storage/plugin"
+	_ "timeship/internal/storage/rclone"
+	_ "timeship/internal/storage/remote"
+	_ "timeship/internal/storage/timemachine"
 )
 
 //go:generate go tool oapi-codegen -config oapi-codegen.yaml api.yaml
@@ -34,7 +32,9 @@ var (
 	builtBy = "unknown"
 )
 
-func printBanner(version string) {
+// printBanner prints the logo with the version, and the instance name if
+// one is configured
+func printBanner(version, name string) {
 	log.Printf(`
  _______               __   _    
 /_  __(_)_ _  ___ ___ / /  (_)__ 
@@ -42,178 +42,113 @@ func printBanner(version string) {
 /_/ /_/_/_/_/\__/___/_//_/_/ .__/
 %25s /_/    
 `, version)
+	if name != "" {
+		log.Printf("Instance: %s", name)
+	}
 	log.Println()
 }
 
-func main() {
-	log.SetFlags(0)
-
-	versionFlag := flag.Bool("version", false, "print version and exit")
-	flag.Parse()
-
-	if *versionFlag {
-		fmt.Printf("timeship %s, commit %s, built on %s by %s\n", version, commit, date, builtBy)
-		return
-	}
-
-	// Print banner
-	printBanner(version)
-
-	godotenv.Load()
-
-	// Get the root directory for the local storage from environment or use current directory
-	rootDir := os.Getenv("TIMESHIP_ROOT")
-	if rootDir == "" {
-		var err error
-		rootDir, err = os.Getwd()
+// openStorages creates all storages in the configuration
+func openStorages(cfg *config.Config) (map[string]storage.Storage, error) {
+	storages := map[string]storage.Storage{}
+	for _, sc := range cfg.Storages {
+		store, err := registry.Open(sc)
 		if err != nil {
-			log.Fatalf("Failed to get current directory: %v", err)
+			closeStorages(storages)
+			return nil, fmt.Errorf("storage %s: %w", sc.Name, err)
 		}
+		storages[sc.Name] = store
 	}
 
-	// Get API prefix from environment or use default
-	apiPrefix := os.Getenv("TIMESHIP_API_PREFIX")
-	if apiPrefix == "" {
-		apiPrefix = "/api"
+	for _, pc := range cfg.Pins {
+		name := pc.Name
+		if name == "" {
+			name = pinned.DefaultName(pc.Storage, pc.Snapshot)
+		}
+		if _, ok := storages[name]; ok {
+			closeStorages(storages)
+			return nil, fmt.Errorf("pin %s: duplicate storage name", name)
+		}
+		store, err := pinned.New(name, storages[pc.Storage], pc.Storage, pc.Snapshot)
+		if err != nil {
+			closeStorages(storages)
+			return nil, fmt.Errorf("pin %s: %w", name, err)
+		}
+		storages[name] = store
 	}
 
-	// Configuration section
-	log.Printf("Root: %s", rootDir)
-
-	// Create local storage
-	store, err := local.New(rootDir)
-	if err != nil {
-		log.Fatalf("Failed to create local storage: %v", err)
-	}
-	defer store.Close()
+	return storages, nil
+}
 
-	// Create storages map
-	storages := map[string]storage.Storage{
-		"local": store,
+// logStorages logs the storages in the configuration
+func logStorages(cfg *config.Config) {
+	for _, sc := range cfg.Storages {
+		log.Printf("Storage %s: %s", sc.Name, sc.Root)
 	}
-
-	// Ensure storages are closed on exit
-	defer func() {
-		for name, s := range storages {
-			if closer, ok := s.(io.Closer); ok {
-				if err := closer.Close(); err != nil {
-					log.Printf("Error closing storage %s: %v", name, err)
-				}
-			}
+	for _, pc := range cfg.Pins {
+		name := pc.Name
+		if name == "" {
+			name = pinned.DefaultName(pc.Storage, pc.Snapshot)
 		}
-	}()
-
-	// Create API server (local is the default storage)
-	server, err := api.NewServer(storages, "local")
-	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		log.Printf("Storage %s: %s pinned to %s", name, pc.Storage, pc.Snapshot)
 	}
+}
 
-	// Create HTTP server with routing
-	mux := http.NewServeMux()
-
-	// API routes with CORS
-	handler := api.HandlerWithOptions(server, api.StdHTTPServerOptions{})
-	corsHandler := middleware.CORS()(handler)
+// openDrive opens the storage of a removable drive mounted at root, with
+// the storage options of the removable config
+func openDrive(cfg *config.Config, name, root string) (storage.Storage, error) {
+	sc := cfg.Removable.Storage
+	sc.Name, sc.Root = name, root
+	return registry.Open(sc)
+}
 
-	// Mount API, stripping prefix if not at root
-	if apiPrefix == "/" {
-		mux.Handle("/", corsHandler)
-	} else {
-		mux.Handle(apiPrefix+"/", http.StripPrefix(apiPrefix, corsHandler))
+// indexStorages queues all snapshots of the storages that support them for
+// indexing
+func indexStorages(indexer *metacache.Indexer, storages map[string]storage.Storage) {
+	for name, store := range storages {
+		if _, ok := store.(storage.SnapshotLister); !ok {
+			continue
+		}
+		if err := indexer.EnqueueAll(name, store); err != nil {
+			log.Printf("Failed to index snapshots of %s: %v", name, err)
+		}
 	}
+}
 
-	// Serve embedded UI if available (when built with -tags embedui)
-	uiEmbedded := false
-	if apiPrefix != "/" {
-		// Try to read from embedded FS to check if UI is available
-		_, err := StaticFs.Open("ui/dist")
-		if err == nil {
-			uiEmbedded = true
-			// Hardcode well-known mime types, see https://github.com/golang/go/issues/32350
-			mime.AddExtensionType(".js", "text/javascript")
-			mime.AddExtensionType(".css", "text/css")
-			mime.AddExtensionType(".html", "text/html")
-			mime.AddExtensionType(".woff", "font/woff")
-			mime.AddExtensionType(".woff2", "font/woff2")
-			mime.AddExtensionType(".png", "image/png")
-			mime.AddExtensionType(".jpg", "image/jpg")
-			mime.AddExtensionType(".jpeg", "image/jpeg")
-			mime.AddExtensionType(".ico", "image/vnd.microsoft.icon")
-			mime.AddExtensionType(".svg", "image/svg+xml")
-			mime.AddExtensionType(".webmanifest", "application/manifest+json")
-
-			uifs, err := fs.Sub(StaticFs, "ui/dist")
-			if err != nil {
-				panic(err)
+// closeStorages closes all storages that support it
+func closeStorages(storages map[string]storage.Storage) {
+	for name, s := range storages {
+		if closer, ok := s.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("Error closing storage %s: %v", name, err)
 			}
-			uihandler := gzipped.FileServer(
-				middleware.SpaFs{
-					Root: http.FS(uifs),
-				},
-			)
-
-			// Create UI mux with middleware
-			uiMux := http.NewServeMux()
-			uiMux.Handle("/", uihandler)
-
-			// Wrap with cache control and index.html middleware
-			uiHandler := middleware.CacheControl()(middleware.IndexHTML()(uiMux))
-			mux.Handle("/", uiHandler)
 		}
 	}
+}
 
-	// Get server address from environment or use default
-	addr := os.Getenv("TIMESHIP_ADDRESS")
-	if addr == "" {
-		addr = ":8080"
-	}
-
-	httpServer := &http.Server{
-		Addr:         addr,
-		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
-	// Create listener to get actual address
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Fatalf("Failed to start listener: %v", err)
-	}
-
-	// Start server in a goroutine
-	go func() {
-		if !uiEmbedded {
-			log.Printf("API-only mode (build with -tags embedui to embed UI)")
-		}
+// commands are the subcommands, see the Usage of runServe
+var commands = map[string]func(args []string){
+	"serve":     runServe,
+	"check":     runCheck,
+	"ls":        runLs,
+	"cat":       runCat,
+	"snapshots": runSnapshots,
+	"mount":     runMount,
+	"export":    runExport,
+	"import":    runImport,
+	"service":   runService,
+}
 
-		log.Println("\nRunning (Press Ctrl+C to stop)")
-		if err := network.PrintListenURLs(listener.Addr()); err != nil {
-			log.Printf("Warning: couldn't list all network addresses: %v", err)
-			log.Printf("  API: http://%s%s", addr, apiPrefix)
-		}
+func main() {
+	log.SetFlags(0)
 
-		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed: %v", err)
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			run(os.Args[2:])
+			return
 		}
-	}()
-
-	// Wait for interrupt signal for graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("\nShutting down server...")
-
-	// Graceful shutdown with 30 second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
-	log.Println("Server stopped")
+	// Without a command, the server runs as it did before commands existed
+	runServe(os.Args[1:])
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"timeship/internal/config"
+	"timeship/internal/fusefs"
+
+	"github.com/joho/godotenv"
+)
+
+// runMount implements the "mount" command, which exposes a storage as a
+// read-only FUSE filesystem until interrupted
+func runMount(args []string) {
+	flags := flag.NewFlagSet("mount", flag.ExitOnError)
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to YAML config file")
+	storageFlag := flags.String("storage", "", "storage to mount (defaults to the first configured storage)")
+	allowOther := flags.Bool("allow-other", false, "allow other users to access the mount")
+	debug := flags.Bool("debug", false, "enable FUSE debug logging")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s mount [flags] <mountpoint>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Mounts a storage as a read-only filesystem with the live contents in\n")
+		fmt.Fprintf(flags.Output(), "current/ and each snapshot in snapshots/<name>/.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	mountpoint := flags.Arg(0)
+
+	if !fusefs.Supported {
+		log.Fatalf("FUSE mounts are not supported on this platform")
+	}
+
+	godotenv.Load()
+
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	logStorages(cfg)
+	storages, err := openStorages(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create storages: %v", err)
+	}
+	defer closeStorages(storages)
+
+	name := *storageFlag
+	if name == "" {
+		name = cfg.DefaultStorage()
+	}
+	store, ok := storages[name]
+	if !ok {
+		log.Fatalf("Storage not found: %s", name)
+	}
+
+	server, err := fusefs.Mount(mountpoint, name, store, fusefs.Options{
+		AllowOther: *allowOther,
+		Debug:      *debug,
+	})
+	if err != nil {
+		log.Fatalf("Failed to mount: %v", err)
+	}
+
+	log.Printf("Mounted %s at %s (Press Ctrl+C to unmount)", name, mountpoint)
+
+	// Unmount on interrupt, Wait returns once unmounted
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-quit
+		if err := server.Unmount(); err != nil {
+			log.Printf("Failed to unmount: %v", err)
+		}
+	}()
+
+	server.Wait()
+	log.Println("Unmounted")
+}
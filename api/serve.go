@@ -0,0 +1,770 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"timeship/internal/access"
+	"timeship/internal/activity"
+	"timeship/internal/api"
+	"timeship/internal/config"
+	"timeship/internal/demo"
+	"timeship/internal/hook"
+	"timeship/internal/jobs"
+	"timeship/internal/manifest"
+	"timeship/internal/mdns"
+	"timeship/internal/metacache"
+	"timeship/internal/middleware"
+	"timeship/internal/network"
+	"timeship/internal/notify"
+	"timeship/internal/pdfpreview"
+	"timeship/internal/recent"
+	"timeship/internal/removable"
+	"timeship/internal/scan"
+	"timeship/internal/schedule"
+	"timeship/internal/storage"
+	"timeship/internal/systemd"
+	"timeship/internal/tags"
+	"timeship/internal/tokens"
+	"timeship/internal/tracing"
+	"timeship/internal/webhook"
+
+	"github.com/joho/godotenv"
+	"github.com/lpar/gzipped"
+)
+
+// useDemo replaces the storages of the config with the demo data in dir
+func useDemo(cfg *config.Config, dir string) {
+	cfg.Storages = []config.StorageConfig{{Name: "demo", Type: "local", Root: dir}}
+	cfg.Pins = nil
+}
+
+// notificationSink returns the sink of a notification receiver
+func notificationSink(n config.NotificationConfig) webhook.Sink {
+	sink := webhook.Sink{Events: n.Events}
+	switch n.Type {
+	case "smtp":
+		sink.Name = "smtp " + n.Address
+		sink.Sender = &notify.SMTP{Address: n.Address, Username: n.Username, Password: n.Password, From: n.From, To: n.To}
+	case "gotify":
+		sink.Name = "gotify " + n.URL
+		sink.Sender = &notify.Gotify{URL: n.URL, Token: n.Token, Priority: n.Priority}
+	default:
+		sink.Name = "ntfy " + n.URL
+		sink.Sender = &notify.Ntfy{URL: n.URL, Token: n.Token, Priority: n.Priority}
+	}
+	return sink
+}
+
+// corsPolicies returns the CORS policies of the config, with routes taking
+// what they leave empty from the top-level policy, and all methods of the
+// API allowed by default
+func corsPolicies(cfg *config.Config) (middleware.CORSPolicy, []middleware.CORSRoute) {
+	policy := func(origins []string, pc config.CORSPolicyConfig) middleware.CORSPolicy {
+		return middleware.CORSPolicy{
+			Origins:        origins,
+			Methods:        pc.Methods,
+			Headers:        pc.Headers,
+			ExposedHeaders: pc.ExposedHeaders,
+			Credentials:    pc.Credentials,
+			MaxAge:         pc.MaxAge,
+		}
+	}
+	top := cfg.CORS.CORSPolicyConfig
+	if len(top.Methods) == 0 {
+		top.Methods = api.Methods()
+	}
+	var routes []middleware.CORSRoute
+	for _, rc := range cfg.CORS.Routes {
+		pc := rc.CORSPolicyConfig
+		origins := rc.Origins
+		if len(origins) == 0 {
+			origins = cfg.CORSOrigins
+		}
+		if len(pc.Methods) == 0 {
+			pc.Methods = top.Methods
+		}
+		if len(pc.Headers) == 0 {
+			pc.Headers = top.Headers
+		}
+		if len(pc.ExposedHeaders) == 0 {
+			pc.ExposedHeaders = top.ExposedHeaders
+		}
+		if pc.MaxAge == 0 {
+			pc.MaxAge = top.MaxAge
+		}
+		routes = append(routes, middleware.CORSRoute{Path: rc.Path, Policy: policy(origins, pc)})
+	}
+	return policy(cfg.CORSOrigins, top), routes
+}
+
+// Requests to shut down and reload the config, which arrive as signals or
+// from the Windows service manager
+var (
+	shutdownRequests = make(chan os.Signal, 1)
+	reloadRequests   = make(chan os.Signal, 1)
+)
+
+// runServe implements the "serve" command, which runs the server until
+// interrupted
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	versionFlag := flags.Bool("version", false, "print version and exit")
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to YAML config file")
+	demoFlag := flags.Bool("demo", false, "serve generated sample data with snapshots instead of the configured storages")
+	logFlag := flags.String("log", "", "append the log to this file instead of writing it to stderr")
+	pidFileFlag := flags.String("pidfile", "", "write the process ID to this file while running")
+	daemonFlag := flags.Bool("daemon", false, "run in the background, detached from the terminal (Unix only)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [command] [flags]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Commands:\n")
+		fmt.Fprintf(flags.Output(), "  serve      run the server (default)\n")
+		fmt.Fprintf(flags.Output(), "  check      check the config and that all storages are reachable\n")
+		fmt.Fprintf(flags.Output(), "  ls         list a directory\n")
+		fmt.Fprintf(flags.Output(), "  cat        print files\n")
+		fmt.Fprintf(flags.Output(), "  snapshots  list the snapshots of a file or directory\n")
+		fmt.Fprintf(flags.Output(), "  mount      mount a storage as a read-only filesystem\n")
+		fmt.Fprintf(flags.Output(), "  export     export the config, tokens, tags and bookmarks to a bundle\n")
+		fmt.Fprintf(flags.Output(), "  import     import a bundle on another instance\n")
+		fmt.Fprintf(flags.Output(), "  service    install, uninstall or run the Windows service\n\n")
+		fmt.Fprintf(flags.Output(), "Run '%s <command> -h' for the flags of a command.\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Flags of serve:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *versionFlag {
+		fmt.Printf("timeship %s, commit %s, built on %s by %s\n", version, commit, date, builtBy)
+		return
+	}
+
+	// The process started in the background reports to the one starting it
+	// once it's ready
+	ready := daemonReadyPipe()
+	if *daemonFlag && ready == nil {
+		pid, err := daemonize(*logFlag)
+		if err != nil {
+			log.Fatalf("Failed to start in the background: %v", err)
+		}
+		fmt.Printf("Started in the background with PID %d\n", pid)
+		return
+	}
+	if *logFlag != "" {
+		f, err := openLog(*logFlag)
+		if err != nil {
+			log.Fatalf("Failed to open log: %v", err)
+		}
+		defer f.Close()
+		log.SetOutput(f)
+	}
+	if *pidFileFlag != "" {
+		removePIDFile, err := writePIDFile(*pidFileFlag)
+		if err != nil {
+			log.Fatalf("Failed to write PID file: %v", err)
+		}
+		defer removePIDFile()
+	}
+
+	godotenv.Load()
+
+	cfg, err := config.Load(*configFlag)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Print banner, after loading the config as it names the instance
+	printBanner(version, cfg.Branding.Name)
+
+	// Serve sample data from a temporary directory in demo mode
+	demoDir := ""
+	if *demoFlag {
+		demoDir, err = os.MkdirTemp("", "timeship-demo-")
+		if err != nil {
+			log.Fatalf("Failed to create demo directory: %v", err)
+		}
+		defer os.RemoveAll(demoDir)
+		if err := demo.Generate(demoDir, time.Now()); err != nil {
+			// Fatalf skips deferred calls
+			os.RemoveAll(demoDir)
+			log.Fatalf("Failed to generate demo data: %v", err)
+		}
+		useDemo(cfg, demoDir)
+		log.Printf("Demo mode: serving sample data from %s", demoDir)
+	}
+
+	apiPrefix := cfg.APIPrefix
+
+	// Set up tracing if configured by OTEL_* environment variables
+	shutdownTracing, err := tracing.Setup(context.Background(), version)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	if tracing.Enabled() {
+		log.Printf("Tracing enabled")
+	}
+
+	// Create storages from configuration
+	logStorages(cfg)
+	storages, err := openStorages(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create storages: %v", err)
+	}
+
+	// Ensure storages are closed on exit. The server takes them over and
+	// replaces them when the config is reloaded.
+	var server *api.Server
+	defer func() {
+		if server != nil {
+			server.Close()
+		}
+	}()
+
+	serverConfig := api.Config{
+		ContentDigest:   cfg.ContentDigest,
+		ActiveContent:   cfg.ActiveContent,
+		ReadTimeout:     cfg.ReadTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		StreamRateLimit: int64(cfg.StreamRateLimit),
+		TotalRateLimit:  int64(cfg.TotalRateLimit),
+		CSRF:            cfg.CSRF,
+		Branding: api.UIBranding{
+			Name:        cfg.Branding.Name,
+			LogoURL:     cfg.Branding.LogoURL,
+			AccentColor: cfg.Branding.AccentColor,
+		},
+		Build: api.BuildInfo{
+			Version: version,
+			Commit:  commit,
+			Date:    date,
+			BuiltBy: builtBy,
+		},
+	}
+	if cfg.SigningKey != "" {
+		serverConfig.SigningKey, err = manifest.LoadSigningKey(cfg.SigningKey)
+		if err != nil {
+			log.Fatalf("Failed to load signing key: %v", err)
+		}
+	}
+
+	var notifier *webhook.Notifier
+	if len(cfg.Webhooks) > 0 || len(cfg.Notifications) > 0 {
+		hooks := make([]webhook.Hook, len(cfg.Webhooks))
+		for i, w := range cfg.Webhooks {
+			hooks[i] = webhook.Hook{URL: w.URL, Secret: w.Secret, Events: w.Events, Timeout: w.Timeout}
+			log.Printf("Webhook: %s", w.URL)
+		}
+		sinks := make([]webhook.Sink, len(cfg.Notifications))
+		for i, n := range cfg.Notifications {
+			sinks[i] = notificationSink(n)
+			log.Printf("Notifications: %s", sinks[i].Name)
+		}
+		notifier = webhook.NewWithSinks(hooks, sinks)
+		serverConfig.Notifier = notifier
+	}
+
+	var hooks *hook.Runner
+	if len(cfg.Hooks) > 0 {
+		configured := make([]hook.Hook, len(cfg.Hooks))
+		for i, h := range cfg.Hooks {
+			// The config was validated, so commands parse
+			command, _ := hook.ParseCommand(h.Command)
+			configured[i] = hook.Hook{Operation: h.Before + h.After, After: h.After != "", Command: command, Timeout: h.Timeout}
+			if h.After != "" {
+				log.Printf("Hook after %s: %s", h.After, h.Command)
+			} else {
+				log.Printf("Hook before %s: %s", h.Before, h.Command)
+			}
+		}
+		hooks = hook.New(configured)
+		serverConfig.Hooks = hooks
+	}
+
+	// Open the snapshot metadata cache if configured
+	var indexer *metacache.Indexer
+	if cfg.MetadataCache.Path != "" {
+		cache, err := metacache.Open(cfg.MetadataCache.Path)
+		if err != nil {
+			log.Fatalf("Failed to open metadata cache: %v", err)
+		}
+		defer cache.Close()
+
+		indexerConfig := metacache.Config{Hash: cfg.MetadataCache.Hash}
+		if notifier != nil {
+			indexerConfig.OnIndexed = func(storageName string, snapshot storage.Snapshot, err error) {
+				event := webhook.Event{Type: webhook.IndexFinished, Storage: storageName, Snapshot: snapshot.ID}
+				if err != nil {
+					event.Error = err.Error()
+				}
+				notifier.Notify(event)
+			}
+		}
+		indexer = metacache.NewIndexer(cache, indexerConfig)
+		defer indexer.Close()
+		serverConfig.MetadataCache = indexer
+		log.Printf("Metadata cache: %s", cfg.MetadataCache.Path)
+
+		// Listing snapshots of remote storages may be slow. The server adds
+		// pinned storages to the map, so index a copy.
+		if cfg.MetadataCache.IndexOnStart {
+			go indexStorages(indexer, maps.Clone(storages))
+		}
+		if cfg.MetadataCache.Schedule != "" {
+			// Validated when loading the config
+			sched, _ := schedule.Parse(cfg.MetadataCache.Schedule)
+			indexer.Schedule(sched, maps.Clone(storages))
+			log.Printf("Indexing snapshots on schedule: %s", cfg.MetadataCache.Schedule)
+		}
+	}
+
+	if cfg.Thumbnails.Mutool != "" {
+		serverConfig.PDFRenderer = pdfpreview.NewRenderer(cfg.Thumbnails.Mutool, cfg.Thumbnails.CacheDir)
+		log.Printf("PDF thumbnails: %s", cfg.Thumbnails.Mutool)
+	}
+
+	switch {
+	case cfg.Scan.Clamd != "":
+		serverConfig.Scanner = scan.NewClamd(cfg.Scan.Clamd)
+		log.Printf("Virus scanning: clamd at %s", cfg.Scan.Clamd)
+	case cfg.Scan.Command != "":
+		serverConfig.Scanner = scan.NewCommand(cfg.Scan.Command)
+		log.Printf("Virus scanning: %s", cfg.Scan.Command)
+	}
+
+	// Open the database of tokens issued through the API if configured
+	var issuer access.Issuer
+	if cfg.Tokens != "" {
+		store, err := tokens.Open(cfg.Tokens)
+		if err != nil {
+			log.Fatalf("Failed to open token database: %v", err)
+		}
+		defer store.Close()
+		serverConfig.Tokens = store
+		issuer = store
+		log.Printf("Token database: %s", cfg.Tokens)
+	}
+
+	// Open the database of tags and bookmarks if configured
+	if cfg.Tags != "" {
+		store, err := tags.Open(cfg.Tags)
+		if err != nil {
+			log.Fatalf("Failed to open tag database: %v", err)
+		}
+		defer store.Close()
+		serverConfig.Tags = store
+		log.Printf("Tag database: %s", cfg.Tags)
+	}
+
+	// Open the activity database if configured
+	if cfg.Activity != "" {
+		store, err := activity.Open(cfg.Activity)
+		if err != nil {
+			log.Fatalf("Failed to open activity database: %v", err)
+		}
+		defer store.Close()
+		serverConfig.Activity = store
+		log.Printf("Activity database: %s", cfg.Activity)
+	}
+
+	// Open the job history if configured
+	if cfg.JobHistory != "" {
+		history, err := jobs.OpenHistory(cfg.JobHistory, cfg.JobHistoryRetention)
+		if err != nil {
+			log.Fatalf("Failed to open job history: %v", err)
+		}
+		serverConfig.JobHistory = history
+		serverConfig.ResumeJobs = cfg.ResumeJobs
+		log.Printf("Job history: %s", cfg.JobHistory)
+	}
+
+	if !cfg.DisableRecent {
+		serverConfig.Recent = recent.New(recent.DefaultLimit)
+	}
+
+	for _, sc := range cfg.Schedules {
+		serverConfig.Schedules = append(serverConfig.Schedules, api.ScheduledTask{
+			Name:               sc.Name,
+			Schedule:           sc.Schedule,
+			Action:             sc.Action,
+			Storage:            sc.Storage,
+			Path:               sc.Path,
+			Snapshot:           sc.Snapshot,
+			DestinationStorage: sc.DestinationStorage,
+			Destination:        sc.Destination,
+			Include:            sc.Include,
+			Exclude:            sc.Exclude,
+			OlderThan:          sc.OlderThan,
+			MaxGap:             sc.MaxGap,
+		})
+		log.Printf("Scheduled %s (%s): %s", sc.Name, sc.Action, sc.Schedule)
+	}
+
+	for _, sc := range cfg.Storages {
+		if sc.MaxSnapshotAge > 0 {
+			if serverConfig.SnapshotMaxAge == nil {
+				serverConfig.SnapshotMaxAge = map[string]time.Duration{}
+			}
+			serverConfig.SnapshotMaxAge[sc.Name] = sc.MaxSnapshotAge
+			log.Printf("Monitoring snapshots of %s: at most %s old", sc.Name, sc.MaxSnapshotAge)
+		}
+	}
+
+	serverConfig.Access, err = cfg.AccessPolicy(issuer)
+	if err != nil {
+		log.Fatalf("Failed to set up access control: %v", err)
+	}
+	if serverConfig.Access != nil {
+		log.Printf("Access control: %d users", len(cfg.Access))
+	}
+
+	// Storages, access control and CORS policies are reloaded on SIGHUP or
+	// through the API, other settings need a restart
+	cors := middleware.NewCORS(corsPolicies(cfg))
+	// current is the config in effect, replaced on reload. drives are the
+	// mount points of the removable drives served, by storage name.
+	var reloadMu sync.Mutex
+	current := cfg
+	drives := map[string]string{}
+	reload := func() error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		newCfg, err := config.Load(*configFlag)
+		if err != nil {
+			return err
+		}
+		if demoDir != "" {
+			useDemo(newCfg, demoDir)
+		}
+		logStorages(newCfg)
+		storages, err := openStorages(newCfg)
+		if err != nil {
+			return err
+		}
+		// Drives that are still mounted stay, unless their name is taken
+		var dropped []string
+		for name, root := range drives {
+			if _, ok := storages[name]; ok {
+				log.Printf("Drive %s dropped: replaced by a configured storage", name)
+				dropped = append(dropped, name)
+				continue
+			}
+			store, err := openDrive(newCfg, name, root)
+			if err != nil {
+				log.Printf("Drive %s dropped: %v", name, err)
+				dropped = append(dropped, name)
+				continue
+			}
+			storages[name] = store
+		}
+		policy, err := newCfg.AccessPolicy(issuer)
+		if err != nil {
+			closeStorages(storages)
+			return err
+		}
+		// The server adds pinned storages to the map, so index a copy
+		scheduled := maps.Clone(storages)
+		if err := server.Reload(storages, newCfg.DefaultStorage(), policy); err != nil {
+			closeStorages(storages)
+			return err
+		}
+		for _, name := range dropped {
+			delete(drives, name)
+		}
+		if indexer != nil && indexer.Scheduled() {
+			indexer.SetScheduled(scheduled)
+		}
+		cors.Set(corsPolicies(newCfg))
+		current = newCfg
+		log.Printf("Config reloaded: %d storages, %d users", len(scheduled), len(newCfg.Access))
+		return nil
+	}
+	serverConfig.Reload = reload
+	if cfg.Removable.Path != "" {
+		// Ejected drives are served again once mounted again
+		serverConfig.EjectDrive = func(name string) error {
+			reloadMu.Lock()
+			defer reloadMu.Unlock()
+			if _, ok := drives[name]; !ok {
+				return fmt.Errorf("drive %s: %w", name, fs.ErrNotExist)
+			}
+			delete(drives, name)
+			server.RemoveStorage(name)
+			log.Printf("Drive %s ejected", name)
+			return nil
+		}
+	}
+	serverConfig.ExportConfig = func() ([]byte, error) {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		return current.Export()
+	}
+
+	// Create API server (the first configured storage is the default)
+	server, err = api.NewServerWithConfig(storages, cfg.DefaultStorage(), serverConfig)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+
+	// Serve the drives mounted in the removable directory while they're
+	// mounted
+	var driveWatcher *removable.Watcher
+	if cfg.Removable.Path != "" {
+		driveWatcher = removable.Watch(cfg.Removable.Path, cfg.Removable.Interval, func(added, removed []removable.Drive) {
+			reloadMu.Lock()
+			defer reloadMu.Unlock()
+			for _, d := range removed {
+				if _, ok := drives[d.Name]; ok {
+					delete(drives, d.Name)
+					server.RemoveStorage(d.Name)
+					log.Printf("Drive %s unmounted: %s", d.Name, d.Path)
+				}
+			}
+			for _, d := range added {
+				store, err := openDrive(current, d.Name, d.Path)
+				if err != nil {
+					log.Printf("Failed to open drive %s: %v", d.Path, err)
+					continue
+				}
+				if err := server.AddStorage(d.Name, store); err != nil {
+					closeStorages(map[string]storage.Storage{d.Name: store})
+					log.Printf("Drive %s skipped: %v", d.Path, err)
+					continue
+				}
+				drives[d.Name] = d.Path
+				log.Printf("Drive %s mounted: %s", d.Name, d.Path)
+			}
+		})
+		log.Printf("Watching for drives in %s", cfg.Removable.Path)
+	}
+
+	// Create HTTP server with routing
+	mux := http.NewServeMux()
+
+	// API routes with CORS
+	handler := api.HandlerWithOptions(server, api.StdHTTPServerOptions{
+		Middlewares:      []api.MiddlewareFunc{server.Authorize, server.Track},
+		ErrorHandlerFunc: server.ParamError,
+	})
+	if cfg.CSRF {
+		handler = middleware.CSRF()(handler)
+		log.Printf("CSRF protection enabled")
+	}
+	corsHandler := cors.Handler(middleware.Tracing()(handler))
+
+	// Mount API, stripping prefix if not at root
+	if apiPrefix == "/" {
+		mux.Handle("/", corsHandler)
+	} else {
+		mux.Handle(apiPrefix+"/", http.StripPrefix(apiPrefix, corsHandler))
+	}
+
+	// Serve embedded UI if available (when built with -tags embedui)
+	uiEmbedded := false
+	if apiPrefix != "/" {
+		// Try to read from embedded FS to check if UI is available
+		_, err := StaticFs.Open("ui/dist")
+		if err == nil {
+			uiEmbedded = true
+			// Hardcode well-known mime types, see https://github.com/golang/go/issues/32350
+			mime.AddExtensionType(".js", "text/javascript")
+			mime.AddExtensionType(".css", "text/css")
+			mime.AddExtensionType(".html", "text/html")
+			mime.AddExtensionType(".woff", "font/woff")
+			mime.AddExtensionType(".woff2", "font/woff2")
+			mime.AddExtensionType(".png", "image/png")
+			mime.AddExtensionType(".jpg", "image/jpg")
+			mime.AddExtensionType(".jpeg", "image/jpeg")
+			mime.AddExtensionType(".ico", "image/vnd.microsoft.icon")
+			mime.AddExtensionType(".svg", "image/svg+xml")
+			mime.AddExtensionType(".webmanifest", "application/manifest+json")
+
+			uifs, err := fs.Sub(StaticFs, "ui/dist")
+			if err != nil {
+				panic(err)
+			}
+			files := middleware.CacheControl()(gzipped.FileServer(http.FS(uifs)))
+
+			// Other paths are routes of the UI, which gets its runtime
+			// config with index.html
+			uiHandler, err := middleware.SPA(uifs, files, func(r *http.Request, base string) any {
+				c := server.UIConfig(base, strings.TrimSuffix(base, "/")+apiPrefix)
+				if middleware.IsReadOnly(r) {
+					c.Features.Write = false
+					c.Features.Trash = false
+				}
+				return c
+			})
+			if err != nil {
+				log.Fatalf("Failed to serve UI: %v", err)
+			}
+			mux.Handle("/", uiHandler)
+		}
+	}
+
+	// All listeners serve the same routes, each with its own middleware
+	listeners := cfg.AllListeners()
+	httpServers := make([]*http.Server, len(listeners))
+	netListeners := make([]net.Listener, len(listeners))
+	for i, lc := range listeners {
+		httpServers[i], err = newHTTPServer(cfg, lc, mux)
+		if err != nil {
+			log.Fatalf("Failed to set up listener %s: %v", lc.Address, err)
+		}
+		netListeners[i], err = listen(lc)
+		if err != nil {
+			log.Fatalf("Failed to start listener: %v", err)
+		}
+	}
+
+	for _, lc := range listeners {
+		if lc.ReadOnly {
+			log.Printf("Read-only listener: %s", lc.Address)
+		}
+	}
+	if !uiEmbedded {
+		log.Printf("API-only mode (build with -tags embedui to embed UI)")
+	}
+
+	log.Println("\nRunning (Press Ctrl+C to stop)")
+	schemes := make([]string, len(listeners))
+	for i, lc := range listeners {
+		scheme := "http"
+		if lc.TLSCert != "" {
+			scheme = "https"
+		}
+		schemes[i] = scheme
+		if err := network.PrintListenURLs(netListeners[i].Addr(), scheme); err != nil {
+			log.Printf("Warning: couldn't list all network addresses: %v", err)
+			log.Printf("  API: %s://%s%s", scheme, lc.Address, apiPrefix)
+		}
+	}
+
+	// Start servers in goroutines
+	for i := range httpServers {
+		go func() {
+			if err := serveHTTP(httpServers[i], netListeners[i]); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server failed: %v", err)
+			}
+		}()
+	}
+
+	// Let clients on the LAN discover the server
+	var advertiser *mdns.Server
+	if cfg.MDNS {
+		advertiser, err = advertise(cfg, listeners, netListeners, uiEmbedded)
+		if err != nil {
+			log.Printf("Failed to advertise with mDNS: %v", err)
+		} else {
+			log.Printf("Advertising with mDNS")
+		}
+	}
+
+	// Tell systemd the server is up and keep its watchdog from restarting it
+	// while it's healthy
+	notifySystemd(systemd.Ready)
+	stopWatchdog := startWatchdog(server, netListeners, schemes, apiPrefix)
+	if ready != nil {
+		io.WriteString(ready, daemonReadyMessage)
+		ready.Close()
+	}
+
+	// Reload the config on SIGHUP
+	signal.Notify(reloadRequests, syscall.SIGHUP)
+	go func() {
+		for range reloadRequests {
+			log.Println("Reloading config...")
+			notifySystemd(systemd.Reloading)
+			if err := reload(); err != nil {
+				log.Printf("Failed to reload config: %v", err)
+			}
+			notifySystemd(systemd.Ready)
+		}
+	}()
+
+	// Wait for interrupt signal for graceful shutdown
+	quit := shutdownRequests
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("\nShutting down server...")
+	notifySystemd(systemd.Stopping)
+
+	// Say goodbye first, so clients stop connecting
+	if advertiser != nil {
+		advertiser.Close()
+	}
+
+	// Let downloads and jobs finish while health checks report draining, a
+	// second signal stops waiting
+	drainCtx, stopDraining := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-quit:
+			log.Println("Stopped draining")
+			stopDraining()
+		case <-drainCtx.Done():
+		}
+	}()
+	log.Printf("Draining for up to %s...", cfg.DrainTimeout)
+	server.Drain(drainCtx, cfg.DrainTimeout)
+	stopDraining()
+	stopWatchdog()
+	if driveWatcher != nil {
+		driveWatcher.Close()
+	}
+
+	// Graceful shutdown with 30 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Shut down all listeners together, so none waits for another. Requests
+	// still in flight after draining are cut off.
+	closeCtx, cancelClose := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelClose()
+	var shutdownWg sync.WaitGroup
+	shutdownErrs := make([]error, len(httpServers))
+	for i, srv := range httpServers {
+		shutdownWg.Go(func() {
+			if shutdownErrs[i] = srv.Shutdown(closeCtx); shutdownErrs[i] != nil {
+				srv.Close()
+			}
+		})
+	}
+	shutdownWg.Wait()
+	if err := errors.Join(shutdownErrs...); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	if notifier != nil {
+		if err := notifier.Close(ctx); err != nil {
+			log.Printf("Failed to deliver webhooks: %v", err)
+		}
+	}
+
+	if hooks != nil {
+		if err := hooks.Close(ctx); err != nil {
+			log.Printf("Failed to finish hooks: %v", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
+	log.Println("Server stopped")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// defaultServiceName is the name of the Windows service if not set
+const defaultServiceName = "timeship"
+
+// runService implements the "service" command, which installs, uninstalls
+// and runs the server as a Windows service
+func runService(args []string) {
+	flags := flag.NewFlagSet("service", flag.ExitOnError)
+	nameFlag := flags.String("name", defaultServiceName, "name of the service")
+	configFlag := flags.String("config", os.Getenv("TIMESHIP_CONFIG"), "path to YAML config file")
+	logFlag := flags.String("log", "", "file the service logs to (default timeship.log next to the config or the executable)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s service [flags] install|uninstall|run\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Installs the server as a Windows service starting automatically and\n")
+		fmt.Fprintf(flags.Output(), "restarting after failures, or uninstalls it. The service manager runs\n")
+		fmt.Fprintf(flags.Output(), "the service with 'run', in the directory of the config, or of the\n")
+		fmt.Fprintf(flags.Output(), "executable without a config.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Services start in the system directory, so paths must be absolute
+	dir, configPath, logPath, err := serviceFiles(*configFlag, *logFlag)
+	if err != nil {
+		log.Fatalf("Failed to resolve paths: %v", err)
+	}
+	serveArgs := []string{"-log", logPath}
+	if configPath != "" {
+		serveArgs = append(serveArgs, "-config", configPath)
+	}
+
+	switch flags.Arg(0) {
+	case "install":
+		if err := installService(*nameFlag, serveArgs); err != nil {
+			log.Fatalf("Failed to install service %s: %v", *nameFlag, err)
+		}
+		log.Printf("Installed service %s, logging to %s", *nameFlag, logPath)
+	case "uninstall":
+		if err := uninstallService(*nameFlag); err != nil {
+			log.Fatalf("Failed to uninstall service %s: %v", *nameFlag, err)
+		}
+		log.Printf("Uninstalled service %s", *nameFlag)
+	case "run":
+		if err := os.Chdir(dir); err != nil {
+			log.Fatalf("Failed to change directory: %v", err)
+		}
+		if err := runAsService(*nameFlag, serveArgs); err != nil {
+			log.Fatalf("Failed to run service %s: %v", *nameFlag, err)
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+// serviceFiles returns the directory the service runs in with the absolute
+// paths of the config, empty if not set, and of the log
+func serviceFiles(configPath, logPath string) (dir, absConfig, absLog string, err error) {
+	if configPath != "" {
+		if absConfig, err = filepath.Abs(configPath); err != nil {
+			return "", "", "", err
+		}
+		dir = filepath.Dir(absConfig)
+	} else {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", "", "", err
+		}
+		dir = filepath.Dir(exe)
+	}
+	if logPath == "" {
+		logPath = filepath.Join(dir, "timeship.log")
+	}
+	absLog, err = filepath.Abs(logPath)
+	return dir, absConfig, absLog, err
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// errNoService is returned by the service functions outside of Windows
+var errNoService = errors.New("services are only supported on Windows, use systemd or 'timeship serve -daemon' instead")
+
+func installService(name string, serveArgs []string) error {
+	return errNoService
+}
+
+func uninstallService(name string) error {
+	return errNoService
+}
+
+func runAsService(name string, serveArgs []string) error {
+	return errNoService
+}
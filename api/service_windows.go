@@ -0,0 +1,124 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installService registers this executable as a service starting
+// automatically, which the service manager restarts after failures
+func installService(name string, serveArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return errors.New("service already exists")
+	}
+	// The flags of serve are flags of the service command too
+	args := append([]string{"service", "-name", name}, serveArgs...)
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "Timeship",
+		Description: "Browses and restores files from snapshots",
+		StartType:   mgr.StartAutomatic,
+	}, append(args, "run")...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 5 * time.Second}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, uint32((24 * time.Hour).Seconds())); err != nil {
+		s.Delete()
+		return fmt.Errorf("set recovery actions: %w", err)
+	}
+	return nil
+}
+
+// uninstallService removes the service, which stops once it's stopped
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return s.Delete()
+}
+
+// runAsService serves until the service manager stops the service. Run from
+// a console, it serves like the serve command instead.
+func runAsService(name string, serveArgs []string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		runServe(serveArgs)
+		return nil
+	}
+	return svc.Run(name, &service{serveArgs: serveArgs})
+}
+
+// service runs the server for the service manager
+type service struct {
+	serveArgs []string
+}
+
+// Execute serves until the server stops, turning stop and shutdown requests
+// into a graceful shutdown and parameter changes into reloads
+func (s *service) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runServe(s.serveArgs)
+	}()
+
+	accepts := svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				request(shutdownRequests, syscall.SIGTERM)
+			case svc.ParamChange:
+				request(reloadRequests, syscall.SIGHUP)
+			}
+		case <-done:
+			return false, 0
+		}
+	}
+}
+
+// request sends a signal to the server, dropping it if one is still pending
+func request(requests chan<- os.Signal, sig os.Signal) {
+	select {
+	case requests <- sig:
+	default:
+	}
+}
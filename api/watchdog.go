@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"timeship/internal/api"
+	"timeship/internal/systemd"
+)
+
+// notifySystemd tells systemd about the state of the server, if it runs the
+// server with notifications enabled
+func notifySystemd(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
+
+// startWatchdog notifies the systemd watchdog at half its interval as long
+// as every listener answers health checks and every storage passes its
+// self-check, so systemd restarts hung instances. Returns a function
+// stopping the watchdog, which does nothing without a watchdog.
+func startWatchdog(server *api.Server, netListeners []net.Listener, schemes []string, apiPrefix string) (stop func()) {
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		log.Printf("Watchdog disabled: %v", err)
+	}
+	if interval <= 0 {
+		return func() {}
+	}
+	log.Printf("Watchdog: every %s", interval)
+
+	// Checks must finish before systemd gives up on the next notification
+	timeout := interval / 4
+	healthPath := strings.TrimSuffix(apiPrefix, "/") + "/healthz"
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			err := checkListeners(netListeners, schemes, healthPath, timeout)
+			if err == nil {
+				err = server.SelfCheck(timeout)
+			}
+			if err != nil {
+				log.Printf("Watchdog: self-check failed: %v", err)
+			} else {
+				notifySystemd(systemd.Watchdog)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// checkListeners requests the health check through every listener, which
+// passes if the server answers at all
+func checkListeners(netListeners []net.Listener, schemes []string, healthPath string, timeout time.Duration) error {
+	var errs []error
+	for i, l := range netListeners {
+		addr := l.Addr()
+		client := &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, addr.Network(), addr.String())
+				},
+				// The listener is our own, only whether it answers matters
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+		}
+		resp, err := client.Get(schemes[i] + "://localhost" + healthPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listener %s: %w", addr, err))
+			continue
+		}
+		resp.Body.Close()
+	}
+	return errors.Join(errs...)
+}
@@ -1,2 +1,44 @@
-// API configuration from environment variables
-export const API_BASE_URL = import.meta.env.VITE_API_BASE_URL || '/api';
+// Runtime configuration injected into index.html by the server, missing
+// when the UI is served by the Vite dev server
+export interface RuntimeConfig {
+  base: string;
+  api_prefix: string;
+  auth: 'none' | 'optional' | 'token';
+  csrf: boolean;
+  branding: {
+    name?: string;
+    logo_url?: string;
+    accent_color?: string;
+  };
+  features: {
+    write: boolean;
+    snapshots: boolean;
+    trash: boolean;
+    search: boolean;
+    thumbnails: boolean;
+    tags: boolean;
+    activity: boolean;
+    recent: boolean;
+  };
+}
+
+declare global {
+  interface Window {
+    __TIMESHIP_CONFIG__?: RuntimeConfig;
+  }
+}
+
+export const RUNTIME_CONFIG: RuntimeConfig | undefined = window.__TIMESHIP_CONFIG__;
+
+// Path the UI is served at, e.g. behind a reverse proxy
+export const BASE_URL = RUNTIME_CONFIG?.base || '/';
+
+// API configuration from the runtime config or environment variables
+export const API_BASE_URL = RUNTIME_CONFIG?.api_prefix || import.meta.env.VITE_API_BASE_URL || '/api';
+
+// Branding telling instances apart, defaults to the spaceship
+export const BRANDING = {
+  name: RUNTIME_CONFIG?.branding?.name || 'Timeship',
+  logoUrl: RUNTIME_CONFIG?.branding?.logo_url || 'logo.png',
+  accentColor: RUNTIME_CONFIG?.branding?.accent_color,
+};
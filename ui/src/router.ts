@@ -1,8 +1,9 @@
 import { createRouter, createWebHistory } from 'vue-router'
 import Browser from './components/Browser.vue'
+import { BASE_URL } from './config'
 
 const router = createRouter({
-  history: createWebHistory(),
+  history: createWebHistory(BASE_URL),
   routes: [
     {
       path: '/',
@@ -3,6 +3,9 @@ import vue from '@vitejs/plugin-vue'
 
 // https://vite.dev/config/
 export default defineConfig({
+  // Assets are loaded relative to the <base> the server injects, so the
+  // build works behind any reverse proxy path
+  base: './',
   plugins: [vue()],
   optimizeDeps: {
     include: ['monaco-editor'],